@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"go.uber.org/zap/zapcore"
+
+	"shh/agent/internal/config"
+	"shh/agent/internal/protocol"
+)
+
+func runCheckConfig(args []string) int {
+	fs := flag.NewFlagSet("check-config", flag.ExitOnError)
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 1
+	}
+	if len(cfg.Files) == 0 {
+		fmt.Println("No config file found, using defaults")
+	}
+	for _, f := range cfg.Files {
+		fmt.Printf("Read %s\n", f)
+	}
+	for _, key := range cfg.UnknownKeys {
+		fmt.Printf("Warning: unknown key %s is ignored\n", key)
+	}
+
+	problems := validateConfig(cfg)
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", p)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Println("Configuration OK")
+	return 0
+}
+
+// validateConfig returns the problems that Load doesn't catch but that
+// would stop the agent from starting or connecting
+func validateConfig(cfg *config.Config) []string {
+	var problems []string
+	for _, e := range serverEndpoints(cfg.Server) {
+		u, err := url.Parse(e.URL)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("server URL %q: %v", e.URL, err))
+		case u.Scheme != "ws" && u.Scheme != "wss":
+			problems = append(problems, fmt.Sprintf("server URL %q: scheme must be ws or wss", e.URL))
+		case u.Host == "":
+			problems = append(problems, fmt.Sprintf("server URL %q: host is missing", e.URL))
+		}
+	}
+	for _, name := range cfg.Server.Codecs {
+		if _, err := protocol.NewCodec(name); err != nil {
+			problems = append(problems, fmt.Sprintf("server.codecs: %v", err))
+		}
+	}
+	if cfg.Server.Compression.Level < 1 || cfg.Server.Compression.Level > 9 {
+		problems = append(problems, "server.compression.level must be between 1 and 9")
+	}
+	if _, err := zapcore.ParseLevel(cfg.Logging.Level); err != nil {
+		problems = append(problems, fmt.Sprintf("logging.level: %v", err))
+	}
+	if cfg.Metrics.Interval <= 0 {
+		problems = append(problems, "metrics.interval must be positive")
+	}
+	if cfg.Metrics.Listen != "" {
+		if _, _, err := net.SplitHostPort(cfg.Metrics.Listen); err != nil {
+			problems = append(problems, fmt.Sprintf("metrics.listen: %v", err))
+		}
+	}
+	if cfg.Security.TLSEnabled {
+		if _, err := os.Stat(cfg.Security.CertFile); err != nil {
+			problems = append(problems, fmt.Sprintf("security.cert_file: %v", err))
+		}
+		if _, err := os.Stat(cfg.Security.KeyFile); err != nil {
+			problems = append(problems, fmt.Sprintf("security.key_file: %v", err))
+		}
+	}
+	if cfg.Security.CAFile != "" {
+		if _, err := os.Stat(cfg.Security.CAFile); err != nil {
+			problems = append(problems, fmt.Sprintf("security.ca_file: %v", err))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Build information, set with -ldflags "-X main.version=... -X main.commit=..."
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// command is a CLI subcommand. run receives the arguments after the
+// subcommand name and returns the exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "Run the agent (default); --status and --stop control a running agent", runAgent},
+		{"version", "Print version information", runVersion},
+		{"check-config", "Validate the configuration and exit", runCheckConfig},
+		{"top", "Show live metrics, processes, containers, health and events of the local agent", runTop},
+		{"dashboard", "Print the URL that opens the local dashboard", runDashboard},
+		{"export", "Write the journal of an offline or disconnected agent", runExport},
+		{"diagnose", "Check the environment, server connectivity and permissions", runDiagnose},
+		{"install-service", "Generate a systemd unit or launchd plist", runInstallService},
+		{"help", "Show this help", runHelp},
+	}
+}
+
+func main() {
+	args := os.Args[1:]
+	// Without a subcommand, or with only flags, the agent runs
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"run"}, args...)
+	}
+	// The Windows service control manager starts the agent as "run"
+	if args[0] == "run" {
+		if code, ok := runAsService(args[1:]); ok {
+			os.Exit(code)
+		}
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			os.Exit(c.run(args[1:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+func runHelp(args []string) int {
+	usage()
+	return 0
+}
+
+func runVersion(args []string) int {
+	fmt.Printf("shh-agent %s", version)
+	if commit != "" {
+		fmt.Printf(" (%s)", commit)
+	}
+	fmt.Printf(" %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// agentControl lets a service manager stop, pause and resume the agent
+// run by runAgent
+type agentControl struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mu     sync.Mutex
+	pause  func() error
+	resume func() error
+}
+
+var control = &agentControl{stop: make(chan struct{})}
+
+// setPauseHandlers sets what pausing and resuming do once the agent runs
+func (c *agentControl) setPauseHandlers(pause, resume func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pause = pause
+	c.resume = resume
+}
+
+// Stop asks runAgent to shut down
+func (c *agentControl) Stop() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+// Pause suspends the agent's work without stopping it
+func (c *agentControl) Pause() error {
+	c.mu.Lock()
+	pause := c.pause
+	c.mu.Unlock()
+	if pause == nil {
+		return fmt.Errorf("agent is not running")
+	}
+	return pause()
+}
+
+// Resume undoes Pause
+func (c *agentControl) Resume() error {
+	c.mu.Lock()
+	resume := c.resume
+	c.mu.Unlock()
+	if resume == nil {
+		return fmt.Errorf("agent is not running")
+	}
+	return resume()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// runDashboard prints the URL that logs a browser in to the local
+// dashboard with the agent's token
+func runDashboard(args []string) int {
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	addr := fs.String("addr", "", "local API address; defaults to api.listen")
+	fs.Parse(args)
+
+	client, err := newAPIClient(*addr, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	fmt.Printf("%s/?token=%s\n", client.base, url.QueryEscape(client.token))
+	return 0
+}
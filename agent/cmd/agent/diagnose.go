@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"shh/agent/internal/config"
+	"shh/agent/internal/instance"
+)
+
+// dockerSocket is where the Docker integration connects by default
+const dockerSocket = "/var/run/docker.sock"
+
+// diagnosis prints check results and remembers whether any failed
+type diagnosis struct {
+	failed bool
+}
+
+func (d *diagnosis) ok(format string, args ...interface{}) {
+	fmt.Printf("  [ok]   "+format+"\n", args...)
+}
+
+func (d *diagnosis) warn(format string, args ...interface{}) {
+	fmt.Printf("  [warn] "+format+"\n", args...)
+}
+
+func (d *diagnosis) fail(format string, args ...interface{}) {
+	d.failed = true
+	fmt.Printf("  [fail] "+format+"\n", args...)
+}
+
+func runDiagnose(args []string) int {
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for each server connection test")
+	fs.Parse(args)
+
+	d := &diagnosis{}
+	fmt.Println("Environment:")
+	hostname, _ := os.Hostname()
+	fmt.Printf("  version   %s\n", version)
+	fmt.Printf("  go        %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("  hostname  %s\n", hostname)
+	fmt.Printf("  uid/gid   %d/%d\n", os.Getuid(), os.Getgid())
+	for _, env := range agentEnv() {
+		fmt.Printf("  env       %s\n", env)
+	}
+
+	fmt.Println("Configuration:")
+	cfg, err := config.Load()
+	if err != nil {
+		d.fail("load: %v", err)
+		return 1
+	}
+	if len(cfg.Files) == 0 {
+		d.warn("no config file found, using defaults")
+	}
+	for _, f := range cfg.Files {
+		d.ok("read %s", f)
+	}
+	for _, key := range cfg.UnknownKeys {
+		d.warn("unknown key %s is ignored", key)
+	}
+	for _, p := range validateConfig(cfg) {
+		d.fail("%s", p)
+	}
+
+	fmt.Println("Server connectivity:")
+	for _, e := range serverEndpoints(cfg.Server) {
+		start := time.Now()
+		if err := probeServer(e.URL, *timeout); err != nil {
+			d.fail("%s: %v", e.URL, err)
+			continue
+		}
+		d.ok("%s: connected in %s", e.URL, time.Since(start).Round(time.Millisecond))
+	}
+
+	fmt.Println("Permissions:")
+	checkWritable(d, "data directory", cfg.Agent.DataDir)
+	if cfg.Logging.File != "" {
+		checkWritable(d, "log directory", filepath.Dir(cfg.Logging.File))
+	}
+	if status, err := instance.Query(cfg.Agent.DataDir); err != nil {
+		d.warn("instance lock: %v", err)
+	} else if status.Running {
+		d.ok("agent running (pid %d)", status.PID)
+	} else {
+		d.ok("no agent running for %s", cfg.Agent.DataDir)
+	}
+	if runtime.GOOS != "windows" {
+		if _, err := os.Stat(dockerSocket); err != nil {
+			d.warn("docker socket: %v", err)
+		} else if f, err := os.OpenFile(dockerSocket, os.O_RDWR, 0); err != nil {
+			d.warn("docker socket: %v", err)
+		} else {
+			f.Close()
+			d.ok("docker socket %s accessible", dockerSocket)
+		}
+		if os.Geteuid() != 0 {
+			d.warn("not running as root; system changes such as packages and services will fail")
+		}
+	}
+
+	if d.failed {
+		return 1
+	}
+	return 0
+}
+
+// agentEnv returns the SHH_ environment variables, hiding values that
+// look like secrets
+func agentEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, "SHH_") {
+			continue
+		}
+		upper := strings.ToUpper(key)
+		for _, secret := range []string{"TOKEN", "SECRET", "PASSWORD", "KEY"} {
+			if strings.Contains(upper, secret) {
+				value = "********"
+				break
+			}
+		}
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// probeServer completes a websocket handshake with a server and closes
+// the connection without registering
+func probeServer(url string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	dialer := websocket.Dialer{HandshakeTimeout: timeout}
+	conn, resp, err := dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("%w (HTTP %s)", err, resp.Status)
+		}
+		return err
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "diagnose"))
+	return conn.Close()
+}
+
+// checkWritable checks that a file can be created in dir
+func checkWritable(d *diagnosis, name, dir string) {
+	f, err := os.CreateTemp(dir, ".diagnose-*")
+	if err != nil {
+		d.fail("%s %s not writable: %v", name, dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+	d.ok("%s %s writable", name, dir)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"shh/agent/internal/config"
+	"shh/agent/internal/journal"
+)
+
+// journalDir is where the journal is kept in the data directory
+func journalDir(cfg *config.Config) string {
+	return filepath.Join(cfg.Agent.DataDir, "journal")
+}
+
+// runExport writes the journal as JSON lines, for carrying the records of
+// an offline agent to the server
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "-", "file to write, gzipped if it ends in .gz; - for stdout")
+	since := fs.Duration("since", 0, "only export records this recent; 0 for all")
+	ack := fs.Bool("ack", false, "mark the exported records as uploaded, so they aren't uploaded again on reconnect")
+	fs.Parse(args)
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", *output, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+		if strings.HasSuffix(*output, ".gz") {
+			gz := gzip.NewWriter(file)
+			defer gz.Close()
+			w = gz
+		}
+	}
+
+	var from time.Time
+	if *since > 0 {
+		from = time.Now().Add(-*since)
+	}
+	dir := journalDir(cfg)
+	count, end, err := journal.Export(dir, w, from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export journal: %v\n", err)
+		return 1
+	}
+	if *ack && end.Segment != "" {
+		if err := journal.SaveCursor(dir, end); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to mark records as uploaded: %v\n", err)
+			return 1
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d records\n", count)
+	return 0
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/config"
+	"shh/agent/internal/logging"
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/store"
+)
+
+// logCollection builds the components that follow the configured log
+// files and journals, ship their lines through send and report pattern
+// matches and rate anomalies on events. Without files or journals there
+// is nothing to collect and no components are returned.
+func logCollection(log *zap.Logger, cfg config.LogCollectConfig, dataDir string, state *store.Store,
+	send func(protocol.Message) error, events chan<- interface{}) ([]component, error) {
+	if len(cfg.Files) == 0 && len(cfg.Journals) == 0 {
+		return nil, nil
+	}
+
+	logs := logging.NewManager(log)
+	logs.SetStore(state)
+	logs.SetEvents(events)
+	for _, f := range cfg.Files {
+		if err := logs.AddLogFile(f.Path, logging.LogConfig{
+			MultilineStart:    f.MultilineStart,
+			MultilineMaxLines: f.MultilineMaxLines,
+			MultilineTimeout:  f.MultilineTimeout,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, j := range cfg.Journals {
+		// Where reading stopped is saved under the name
+		name := j.Name
+		switch {
+		case name != "":
+		case len(j.Units) > 0:
+			name = strings.Join(j.Units, ",")
+		case len(j.Identifiers) > 0:
+			name = strings.Join(j.Identifiers, ",")
+		default:
+			name = "journal"
+		}
+		if err := logs.AddJournal(name, logging.JournalConfig{
+			Units:       j.Units,
+			Identifiers: j.Identifiers,
+			Priority:    j.Priority,
+			Matches:     j.Matches,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range cfg.Patterns {
+		level := logging.LogLevel(p.Level)
+		switch level {
+		case logging.LevelDebug, logging.LevelInfo, logging.LevelWarn, logging.LevelError:
+		case "":
+			level = logging.LevelInfo
+		default:
+			return nil, fmt.Errorf("invalid level %q for log pattern %q", p.Level, p.Pattern)
+		}
+		if err := logs.AddPattern(logging.LogPattern{Pattern: p.Pattern, Level: level, Description: p.Description}); err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range cfg.Extractors {
+		if err := logs.AddExtractor(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Redact.Enabled {
+		rules := logging.DefaultRedactionRules()
+		for _, r := range cfg.Redact.Rules {
+			rules = append(rules, logging.RedactionRule{
+				Name:        r.Name,
+				Pattern:     r.Pattern,
+				Replacement: r.Replacement,
+				Luhn:        r.Luhn,
+			})
+		}
+		redactor, err := logging.NewRedactor(rules)
+		if err != nil {
+			return nil, err
+		}
+		logs.SetRedactor(redactor)
+	}
+
+	// The server is told how many entries were dropped, which only the
+	// shipper built around its sink knows
+	var shipper *logging.Shipper
+	sinks := []logging.Sink{logging.NewServerSink(send, func() int64 { return shipper.Dropped() })}
+	if cfg.Ship.LokiURL != "" {
+		sinks = append(sinks, logging.NewLokiSink(cfg.Ship.LokiURL, cfg.Ship.LokiLabels))
+	}
+	shipper, err := logging.NewShipper(log, logging.ShipperConfig{
+		BatchSize:      cfg.Ship.BatchSize,
+		FlushInterval:  cfg.Ship.FlushInterval,
+		BufferDir:      filepath.Join(dataDir, "logs", "spool"),
+		MaxBufferBytes: cfg.Ship.MaxBufferBytes,
+		RetryInterval:  cfg.Ship.RetryInterval,
+	}, sinks...)
+	if err != nil {
+		return nil, err
+	}
+	logs.SetShipper(shipper, cfg.Ship.All)
+
+	components := []component{{"logship", shipper.Start, shipper.Shutdown}}
+	if cfg.Anomaly.Enabled {
+		detector := logging.NewAnomalyDetector(log, logging.AnomalyConfig{
+			Interval:         cfg.Anomaly.Interval,
+			WarmupIntervals:  cfg.Anomaly.WarmupIntervals,
+			Threshold:        cfg.Anomaly.Threshold,
+			MinCount:         cfg.Anomaly.MinCount,
+			SilenceIntervals: cfg.Anomaly.SilenceIntervals,
+		}, events)
+		logs.SetAnomalyDetector(detector)
+		components = append(components, component{"loganomaly", detector.Start, nothing})
+	}
+	return append(components, component{"logs", logs.Start, withoutContext(logs.Close)}), nil
+}
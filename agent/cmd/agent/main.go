@@ -3,25 +3,221 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"shh/agent/internal/authz"
+	"shh/agent/internal/boot"
+	"shh/agent/internal/budget"
+	"shh/agent/internal/clock"
 	"shh/agent/internal/config"
+	"shh/agent/internal/crash"
+	"shh/agent/internal/discovery"
 	"shh/agent/internal/docker"
+	"shh/agent/internal/enroll"
+	"shh/agent/internal/events"
+	"shh/agent/internal/fim"
 	"shh/agent/internal/health"
+	"shh/agent/internal/heartbeat"
+	"shh/agent/internal/idempotency"
+	"shh/agent/internal/instance"
+	"shh/agent/internal/inventory"
+	"shh/agent/internal/journal"
 	"shh/agent/internal/logger"
+	"shh/agent/internal/logging"
+	"shh/agent/internal/maintenance"
 	"shh/agent/internal/metrics"
+	"shh/agent/internal/network"
+	"shh/agent/internal/optimizer"
+	"shh/agent/internal/plugins"
 	"shh/agent/internal/process"
+	"shh/agent/internal/profiler"
 	"shh/agent/internal/protocol"
+	"shh/agent/internal/resolver"
+	"shh/agent/internal/security"
+	"shh/agent/internal/selfmetrics"
+	"shh/agent/internal/sshkeys"
+	"shh/agent/internal/store"
+	"shh/agent/internal/system"
+	"shh/agent/internal/systemd"
+	"shh/agent/internal/tasks"
+	"shh/agent/internal/transfer"
+	"shh/agent/internal/updates"
+	"shh/agent/internal/web"
 	"shh/agent/internal/websocket"
 
 	"go.uber.org/zap"
 )
 
+// commandFunc runs a "component:action" command
+type commandFunc func(ctx context.Context, cmd string, args []string) (interface{}, error)
+
+// commandFor returns the handler of the longest prefix of cmd in commands,
+// or nil if no component owns cmd
+func commandFor(commands map[string]commandFunc, cmd string) commandFunc {
+	var handle commandFunc
+	longest := 0
+	for prefix, h := range commands {
+		if strings.HasPrefix(cmd, prefix) && len(prefix) > longest {
+			handle, longest = h, len(prefix)
+		}
+	}
+	return handle
+}
+
+// runProcess runs a command no component owns as a process and returns
+// its result
+func runProcess(ctx context.Context, processes *process.Manager, id string, cmd protocol.AgentCommand) (idempotency.Reply, error) {
+	response := protocol.ResultPayload{CommandID: id}
+	result, err := processes.Execute(ctx, cmd.Command, cmd.Args)
+	if result != nil {
+		response.ExitCode = result.ExitCode
+		response.Stdout = result.Stdout
+		response.Stderr = result.Stderr
+	}
+	if err != nil {
+		response.Error = err.Error()
+		// A command that ran and failed is told apart by its exit code
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			response.ErrorCode = protocol.CodeOf(err)
+		}
+	}
+
+	payload, err := json.Marshal(response)
+	if err != nil {
+		return idempotency.Reply{}, fmt.Errorf("failed to marshal result of %s: %w", cmd.Command, err)
+	}
+	return idempotency.Reply{Type: protocol.TypeResult, Payload: payload}, nil
+}
+
+// maintenanceCommand names maintenance requests for authorization:
+// changing maintenance windows is maintenance:set
+func maintenanceCommand(req protocol.MaintenanceRequest) string {
+	if req.Action == "" || req.Action == "status" {
+		return "maintenance:status"
+	}
+	return "maintenance:set"
+}
+
+// sshKeysCommand names SSH key requests for authorization, e.g.
+// sshkeys:policy
+func sshKeysCommand(req protocol.SSHKeyRequest) string {
+	if req.Action == "" {
+		return "sshkeys:inventory"
+	}
+	return "sshkeys:" + req.Action
+}
+
+// configStateCommand names desired state requests for authorization like
+// the config:drift and config:desired commands
+func configStateCommand(req protocol.ConfigStateRequest) string {
+	switch req.Action {
+	case "", "drift":
+		return "config:drift"
+	default:
+		return "config:desired:" + req.Action
+	}
+}
+
+// configActionCommand names config action requests for authorization,
+// e.g. config:action:set. Actions run commands, so only admins have them.
+func configActionCommand(req protocol.ConfigActionRequest) string {
+	if req.Action == "" {
+		return "config:action:list"
+	}
+	return "config:action:" + req.Action
+}
+
+// claimedRequest is a request carrying the claims of its user
+type claimedRequest interface {
+	RequestClaims() protocol.Claims
+}
+
+// requestHandler answers the messages of one type with the result of
+// handle, decoding their payload into a T. Requests are authorized like
+// commands, as the command name returns for them.
+func requestHandler[T claimedRequest](client *websocket.Client, authorizer *authz.Authorizer, log *zap.Logger, kind string,
+	name func(req T) string, handle func(ctx context.Context, req T) (interface{}, error)) protocol.MessageHandler {
+	return func(ctx context.Context, msg protocol.Message) error {
+		var req T
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			return fmt.Errorf("invalid %s payload: %w", kind, err)
+		}
+
+		response := protocol.AgentResponse{Success: true}
+		claims := req.RequestClaims()
+		var result interface{}
+		err := authorizer.Authorize(name(req), protocol.AgentCommand{Command: name(req), Tenant: claims.Tenant, Roles: claims.Roles})
+		if err != nil {
+			log.Warn("Request refused",
+				zap.String("command", name(req)),
+				zap.String("tenant", claims.Tenant),
+				zap.Strings("roles", claims.Roles),
+				zap.Error(err))
+		} else {
+			result, err = handle(ctx, req)
+		}
+		if err != nil {
+			response.Success = false
+			response.Error = err.Error()
+			response.ErrorCode = protocol.CodeOf(err)
+		} else if response.Data, err = json.Marshal(result); err != nil {
+			return fmt.Errorf("failed to marshal %s result: %w", kind, err)
+		}
+
+		payload, err := json.Marshal(response)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s response: %w", kind, err)
+		}
+		return client.SendMessage(protocol.Message{
+			Type:      protocol.TypeResponse,
+			ID:        msg.ID,
+			Timestamp: time.Now(),
+			Payload:   payload,
+		})
+	}
+}
+
+// healthy fails while checker reports the agent unhealthy
+func healthy(checker *health.Checker) updates.VerifyFunc {
+	return func(context.Context) error {
+		if status := checker.GetStatus(); status == health.StatusUnhealthy {
+			return fmt.Errorf("agent is %s", status)
+		}
+		return nil
+	}
+}
+
+// component is started with the agent and cleaned up in reverse order on
+// shutdown
+type component struct {
+	name    string
+	start   func(context.Context) error
+	cleanup func(context.Context) error
+}
+
+// nothing is the start or cleanup of a component with nothing to do
+func nothing(context.Context) error { return nil }
+
+// withoutContext adapts a start or cleanup that takes no context
+func withoutContext(fn func() error) func(context.Context) error {
+	return func(context.Context) error { return fn() }
+}
+
 // wrapHealthCheck converts a simple health check function to the health.Check interface
 func wrapHealthCheck(check func(context.Context) error) health.Check {
 	return func(ctx context.Context) *health.CheckResult {
@@ -45,30 +241,475 @@ func wrapHealthCheck(check func(context.Context) error) health.Check {
 	}
 }
 
-func main() {
+// serverEndpoints returns the servers to connect to: the failover list if
+// configured, the single URL otherwise
+func serverEndpoints(cfg config.ServerConfig) []websocket.Endpoint {
+	if len(cfg.URLs) == 0 {
+		return []websocket.Endpoint{{URL: cfg.URL}}
+	}
+	endpoints := make([]websocket.Endpoint, 0, len(cfg.URLs))
+	for _, u := range cfg.URLs {
+		endpoints = append(endpoints, websocket.Endpoint{URL: u.URL, Priority: u.Priority, Weight: u.Weight})
+	}
+	return endpoints
+}
+
+// healthStallLimit is how long health checks may go without completing
+// before the systemd watchdog is no longer fed
+const healthStallLimit = 5 * time.Minute
+
+func compressionConfig(cfg config.ServerConfig) websocket.CompressionConfig {
+	return websocket.CompressionConfig{
+		Deflate:       cfg.Compression.Deflate,
+		Level:         cfg.Compression.Level,
+		GzipThreshold: cfg.Compression.GzipThreshold,
+	}
+}
+
+func rateLimits(cfg config.RateLimitConfig) websocket.RateLimits {
+	limits := websocket.RateLimits{
+		Global: websocket.RateLimit{Rate: cfg.Rate, Burst: cfg.Burst},
+		Types:  make(map[string]websocket.RateLimit, len(cfg.Types)),
+	}
+	for kind, limit := range cfg.Types {
+		limits.Types[kind] = websocket.RateLimit{Rate: limit.Rate, Burst: limit.Burst}
+	}
+	return limits
+}
+
+// enrollAgent returns the agent's identity, enrolling it first if needed.
+// Without one the agent registers unauthenticated only when enrollment
+// isn't required.
+func enrollAgent(ctx context.Context, log *zap.Logger, cfg *config.Config) (*enroll.Identity, error) {
+	enrollment := cfg.Server.Enrollment
+	url := enrollment.URL
+	if url == "" {
+		var err error
+		if url, err = enroll.DefaultURL(cfg.Server.URL); err != nil {
+			return nil, err
+		}
+	}
+	identity, err := enroll.Enroll(ctx, log, filepath.Join(cfg.Agent.DataDir, "identity"), enroll.Config{
+		URL:          url,
+		Token:        enrollment.Token,
+		PollInterval: enrollment.PollInterval,
+	}, cfg.Agent.ID)
+	if errors.Is(err, enroll.ErrNotEnrolled) && !enrollment.Required {
+		log.Warn("Agent is not enrolled, registering unauthenticated")
+		return nil, nil
+	}
+	return identity, err
+}
+
+// adminActions lets the dashboard in admin mode restart containers and
+// cancel transfers. The actions are listed with the server's commands.
+func adminActions(api *web.Server, commandLog *web.CommandLog, dockerPlugin *docker.Plugin, transfers *transfer.Manager) {
+	action := func(path, command string, do func(ctx context.Context, id string) (interface{}, error)) {
+		api.Action(path, func(r *http.Request) (interface{}, error) {
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				return nil, fmt.Errorf("id required")
+			}
+			received := time.Now()
+			result, err := do(r.Context(), id)
+			logged := web.Command{
+				ID:        fmt.Sprintf("local-%d", received.UnixNano()),
+				Command:   command,
+				Args:      []string{id},
+				Roles:     []string{"local-admin"},
+				Success:   err == nil,
+				Duration:  time.Since(received),
+				Timestamp: received,
+			}
+			if err != nil {
+				logged.Error = err.Error()
+			}
+			commandLog.Add(logged)
+			return result, err
+		})
+	}
+	action("/api/admin/containers/restart", "docker:container:restart", func(ctx context.Context, id string) (interface{}, error) {
+		return dockerPlugin.HandleCommand(ctx, "docker:container:restart", []string{id})
+	})
+	action("/api/admin/transfers/cancel", "transfer:cancel", func(ctx context.Context, id string) (interface{}, error) {
+		return nil, transfers.CancelTransfer(id)
+	})
+}
+
+// apiAuth lets the agent's token, the configured tokens and users, and
+// clients with certificates use the local API
+func apiAuth(cfg *config.Config, token string) (*web.Auth, error) {
+	authConfig := web.AuthConfig{
+		Tokens:          []web.Token{{Value: token, Admin: true}},
+		AdminClients:    cfg.API.TLS.AdminClients,
+		AllowedNetworks: cfg.API.AllowedNetworks,
+	}
+	for _, t := range cfg.API.Tokens {
+		authConfig.Tokens = append(authConfig.Tokens, web.Token{Value: t.Token, Admin: t.Admin})
+	}
+	for _, u := range cfg.API.Users {
+		authConfig.Users = append(authConfig.Users, web.User{Username: u.Username, PasswordHash: u.PasswordHash, Admin: u.Admin})
+	}
+	return web.NewAuth(authConfig)
+}
+
+// healthChecks returns the last result of every health check, by name
+func healthChecks(checker *health.Checker) []web.HealthCheck {
+	results := checker.GetCheckResults()
+	checks := make([]web.HealthCheck, 0, len(results))
+	for name, result := range results {
+		if result == nil {
+			continue
+		}
+		check := web.HealthCheck{
+			Name:      name,
+			Status:    string(result.Status),
+			Message:   result.Message,
+			Timestamp: result.Timestamp,
+			Duration:  result.Duration,
+		}
+		if result.Error != nil {
+			check.Error = result.Error.Error()
+		}
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+	return checks
+}
+
+func aggregationPolicy(cfg config.AggregationConfig) metrics.AggregationPolicy {
+	return metrics.AggregationPolicy{
+		Windows:         cfg.Windows,
+		FlushInterval:   cfg.FlushInterval,
+		ChangeThreshold: cfg.ChangeThreshold,
+	}
+}
+
+func snmpDevices(cfg config.SNMPConfig) []metrics.SNMPDevice {
+	devices := make([]metrics.SNMPDevice, 0, len(cfg.Devices))
+	for _, d := range cfg.Devices {
+		devices = append(devices, metrics.SNMPDevice{
+			Name:           d.Name,
+			Address:        d.Address,
+			Port:           d.Port,
+			Version:        d.Version,
+			Community:      d.Community,
+			Timeout:        d.Timeout,
+			Retries:        d.Retries,
+			Username:       d.Username,
+			AuthProtocol:   d.AuthProtocol,
+			AuthPassphrase: d.AuthPassphrase,
+			PrivProtocol:   d.PrivProtocol,
+			PrivPassphrase: d.PrivPassphrase,
+		})
+	}
+	return devices
+}
+
+func clockConfig(cfg config.ClockConfig) clock.Config {
+	return clock.Config{
+		Servers:   cfg.Servers,
+		Interval:  cfg.Interval,
+		Threshold: cfg.Threshold,
+		Timeout:   cfg.Timeout,
+	}
+}
+
+func fimConfig(cfg *config.Config) fim.Config {
+	monitor := fim.DefaultConfig
+	monitor.Paths = cfg.FIM.Paths
+	monitor.Exclude = cfg.FIM.Exclude
+	monitor.Interval = cfg.FIM.Interval
+	monitor.Watch = cfg.FIM.Watch
+	monitor.MaxFileSize = cfg.FIM.MaxFileSize
+	monitor.BaselineFile = filepath.Join(cfg.Agent.DataDir, "fim", "baseline.json")
+	return monitor
+}
+
+func securityScan(cfg config.SecurityScanConfig) (security.ScanConfig, error) {
+	scan := security.ScanConfig{Paths: cfg.Paths, Interval: cfg.Interval}
+	for _, r := range cfg.Rules {
+		rule := security.Rule{
+			Type:      security.RuleType(r.Type),
+			Target:    r.Target,
+			Owner:     r.Owner,
+			Group:     r.Group,
+			Pattern:   r.Pattern,
+			MaxSize:   r.MaxSize,
+			Severity:  r.Severity,
+			Remediate: r.Remediate,
+		}
+		if r.Permission != "" {
+			perm, err := strconv.ParseUint(r.Permission, 8, 32)
+			if err != nil {
+				return scan, fmt.Errorf("invalid permission %q of rule %s: %w", r.Permission, r.Target, err)
+			}
+			rule.Permission = os.FileMode(perm)
+		}
+		scan.Rules = append(scan.Rules, rule)
+	}
+	return scan, nil
+}
+
+func macConfig(cfg config.MACConfig) security.MACConfig {
+	return security.MACConfig{
+		AllowToggle:  cfg.AllowToggle,
+		AuditLogs:    cfg.AuditLogs,
+		DenialWindow: cfg.DenialWindow,
+		MaxDenials:   cfg.MaxDenials,
+	}
+}
+
+func resolverConfig(cfg config.ResolverConfig) resolver.Config {
+	return resolver.Config{
+		Interval:    cfg.Interval,
+		AutoResolve: cfg.AutoResolve,
+	}
+}
+
+func escalationPolicy(cfg config.ResolverConfig) resolver.EscalationPolicy {
+	return resolver.EscalationPolicy{
+		AfterFailures:     cfg.EscalateAfter,
+		ResolvedRetention: cfg.ResolvedRetention,
+	}
+}
+
+// updateWindows is the maintenance config of cfg, or nil to allow updates
+// at any time
+func updateWindows(cfg config.UpdatesConfig) (*updates.MaintenanceConfig, error) {
+	if len(cfg.Windows) == 0 && len(cfg.Blackouts) == 0 {
+		return nil, nil
+	}
+	maintenance := &updates.MaintenanceConfig{
+		Blackouts: cfg.Blackouts,
+		Location:  cfg.Location,
+		Defer:     cfg.Defer,
+	}
+	for _, w := range cfg.Windows {
+		window := updates.MaintenanceWindow{Start: w.Start, End: w.End}
+		for _, name := range w.Days {
+			day, ok := weekday(name)
+			if !ok {
+				return nil, fmt.Errorf("invalid update window day %q", name)
+			}
+			window.Days = append(window.Days, day)
+		}
+		maintenance.Windows = append(maintenance.Windows, window)
+	}
+	return maintenance, nil
+}
+
+// weekday parses a day name such as monday or mon
+func weekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+func discoveryScan(cfg config.DiscoveryConfig) discovery.ScanConfig {
+	scan := discovery.DefaultScanConfig
+	scan.Interval = cfg.Interval
+	scan.Sweep = cfg.Scan
+	scan.AllowNetworks = cfg.AllowNetworks
+	scan.ExcludeNetworks = cfg.ExcludeNetworks
+	return scan
+}
+
+func dnsWatchlist(cfg config.NetworkConfig) network.DNSWatchlist {
+	return network.DNSWatchlist{
+		Allow: cfg.DNSAllow,
+		Deny:  cfg.DNSDeny,
+	}
+}
+
+func crashPolicy(cfg config.CrashLoopConfig) docker.CrashPolicy {
+	return docker.CrashPolicy{
+		Restarts: cfg.Restarts,
+		Window:   cfg.Window,
+		Cooldown: cfg.Cooldown,
+		LogLines: cfg.LogLines,
+	}
+}
+
+func driftPolicy(cfg config.ComposeDriftConfig) docker.DriftPolicy {
+	return docker.DriftPolicy{
+		Interval:     cfg.Interval,
+		AutoConverge: cfg.AutoConverge,
+	}
+}
+
+func updatePolicy(cfg config.AutoUpdateConfig) docker.UpdatePolicy {
+	return docker.UpdatePolicy{
+		Interval:      cfg.Interval,
+		HealthTimeout: cfg.HealthTimeout,
+	}
+}
+
+func authorization(cfg config.AgentConfig) authz.Config {
+	return authz.Config{
+		Tenant:       cfg.Tenant,
+		Roles:        cfg.Authorization.Roles,
+		DefaultRoles: cfg.Authorization.DefaultRoles,
+	}
+}
+
+func resourceBudget(cfg config.ResourceConfig) budget.Config {
+	return budget.Config{
+		MaxProcs:    cfg.MaxProcs,
+		CPUPercent:  cfg.CPUPercent,
+		MemoryLimit: cfg.MemoryLimit,
+		Cgroup:      cfg.Cgroup,
+		ThrottleAt:  cfg.ThrottleAt,
+	}
+}
+
+// runControl handles --status and --stop, which talk to the agent already
+// running for the configured data directory, and returns the exit code
+func runControl(cfg *config.Config, stop bool) int {
+	if stop {
+		// Leave the agent its own shutdown time before giving up
+		status, err := instance.Stop(cfg.Agent.DataDir, cfg.Agent.ShutdownWait+5*time.Second)
+		if errors.Is(err, instance.ErrNotRunning) {
+			fmt.Println("Agent is not running")
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to stop agent: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Agent stopped (pid file %s)\n", status.PIDFile)
+		return 0
+	}
+
+	status, err := instance.Query(cfg.Agent.DataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to query agent status: %v\n", err)
+		return 1
+	}
+	if !status.Running {
+		fmt.Println("Agent is not running")
+		// LSB status code for a stopped service
+		return 3
+	}
+	fmt.Printf("Agent is running (pid %d)\n", status.PID)
+	return 0
+}
+
+// runAgent runs the agent until it receives a shutdown signal and returns
+// the exit code
+func runAgent(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	statusFlag := fs.Bool("status", false, "report whether the agent is running and exit")
+	stopFlag := fs.Bool("stop", false, "stop the running agent and exit")
+	fs.Parse(args)
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
-		os.Exit(1)
+		return 1
+	}
+	if *statusFlag || *stopFlag {
+		return runControl(cfg, *stopFlag)
 	}
 
 	// Initialize logger
 	log, err := logger.Setup(&cfg.Logging)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to setup logger: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
 	defer logger.Sync(log)
 
+	// Keep the recent log entries, so that a crash report written by any
+	// of the agent's goroutines shows what led up to the crash
+	logRing := crash.NewLogRing(crash.DefaultRingSize, zap.InfoLevel)
+	log = logRing.Attach(log)
+	crashes := crash.NewReporter(log, cfg.Agent.DataDir, logRing, crash.HashFiles(cfg.Files), cfg.Agent.Version)
+	crash.SetDefault(crashes)
+	defer crash.Recover("main")
+	if cfg.Agent.CoreDump {
+		crash.EnableCoreDumps()
+	}
+	if len(cfg.UnknownKeys) > 0 {
+		log.Warn("Unknown config keys ignored", zap.Strings("keys", cfg.UnknownKeys))
+	}
+
+	// Refuse to run alongside another agent using the same data directory
+	lock, err := instance.Acquire(cfg.Agent.DataDir)
+	if err != nil {
+		log.Fatal("Failed to acquire instance lock", zap.Error(err))
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			log.Warn("Failed to release instance lock", zap.Error(err))
+		}
+	}()
+
+	// Managers keep their state in the local store, so that it survives
+	// restarts
+	state, err := store.Open(cfg.Agent.DataDir)
+	if err != nil {
+		log.Fatal("Failed to open local store", zap.Error(err))
+	}
+	defer func() {
+		if err := state.Close(); err != nil {
+			log.Warn("Failed to close local store", zap.Error(err))
+		}
+	}()
+
+	// Keep the agent within its resource budgets before anything heavy
+	// starts, so monitoring never competes with the workloads
+	governor, err := budget.NewGovernor(log, resourceBudget(cfg.Agent.Resources))
+	if err != nil {
+		log.Fatal("Failed to create resource governor", zap.Error(err))
+	}
+	if err := governor.Apply(); err != nil {
+		log.Warn("Failed to apply resource budgets", zap.Error(err))
+	}
+
 	// Create root context
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Subsystems report events through the bus, so consumers subscribe
+	// to them uniformly
+	bus := events.NewBus(log)
+	selfMetrics := selfmetrics.NewRegistry()
+	selfMetrics.Counter("events", bus.Dropped)
+
 	// Initialize components
 	healthChecker := health.NewChecker(log)
 	metricsCollector := metrics.NewCollector(log)
 	processManager := process.NewManager(log)
+	governor.Register(metricsCollector)
+
+	// Failed and restart-looping units are among the first things an
+	// operator checks
+	unitMonitor := systemd.NewUnitMonitor(log)
+	metricsCollector.SetUnits(unitMonitor.Status)
+	governor.Register(processManager)
+
+	// Network devices polled over SNMP are reported with the host's
+	// metrics
+	snmpPoller := metrics.NewSNMPPoller(log, snmpDevices(cfg.Metrics.SNMP), cfg.Metrics.SNMP.Interval, nil)
+	if len(cfg.Metrics.SNMP.Devices) > 0 {
+		metricsCollector.SetDevices(snmpPoller.GetMetrics)
+	}
+
+	// Reboots and kernel changes are reported from the boot recorded in
+	// the data directory
+	bootTracker := boot.NewTracker(log, cfg.Agent.DataDir, bus.Publisher(events.TopicAlert))
+	metricsCollector.SetBoot(bootTracker.Info)
+
+	// Asset management integrations query the hardware through commands
+	// and learn of swapped parts from events
+	hardware := system.NewHardwareCollector(log, cfg.Agent.DataDir, bus.Publisher(events.TopicInventory))
 
 	// Initialize Docker plugin
 	dockerManager, err := docker.NewManager(log)
@@ -76,19 +717,219 @@ func main() {
 		log.Fatal("Failed to create Docker manager", zap.Error(err))
 	}
 
-	// Create events channel for Docker plugin
-	dockerEvents := make(chan interface{}, 100)
-	dockerPlugin, err := docker.NewPlugin(log, dockerEvents)
+	dockerPlugin, err := docker.NewPlugin(log, bus.Publisher(events.TopicDocker))
 	if err != nil {
 		log.Fatal("Failed to create Docker plugin", zap.Error(err))
 	}
 
+	// Files copied to and from containers go through transfers
+	transfers, err := transfer.NewManager(filepath.Join(cfg.Agent.DataDir, "transfers"), transfer.DefaultMaxSize, log)
+	if err != nil {
+		log.Fatal("Failed to create transfer manager", zap.Error(err))
+	}
+	if err := transfers.SetStore(state); err != nil {
+		log.Warn("Interrupted transfers won't resume", zap.Error(err))
+	}
+	// Long-running operations report their progress as tasks, which are
+	// published for the local API and the server
+	taskRegistry := tasks.NewRegistry(tasks.DefaultHistory)
+	taskRegistry.OnChange(func(task protocol.TaskProgress) {
+		bus.Publish(events.TopicTask, task)
+	})
+	transfers.SetTasks(taskRegistry)
+	dockerPlugin.SetTransfers(transfers)
+	dockerPlugin.SetMountAllowlist(cfg.Docker.MountAllowlist)
+	dockerPlugin.SetCrashPolicy(crashPolicy(cfg.Docker.CrashLoop))
+	dockerPlugin.SetDriftPolicy(driftPolicy(cfg.Docker.ComposeDrift))
+	dockerPlugin.SetUpdatePolicy(updatePolicy(cfg.Docker.AutoUpdate))
+	dockerPlugin.SetUpdates(bus.Publisher(events.TopicUpdate))
+	dockerPlugin.SetAlerts(bus.Publisher(events.TopicAlert))
+
+	// Installed packages, images and runtimes are inventoried for SBOMs
+	software := inventory.NewCollector(log, dockerManager, 0)
+
+	// Every update check also matches the installed packages against
+	// known advisories, reporting vulnerable ones as security findings
+	updateManager := updates.NewManager(log, bus.Publisher(events.TopicUpdate))
+	updateManager.SetTasks(taskRegistry)
+	if err := updateManager.SetStore(state); err != nil {
+		log.Warn("Update history won't survive restarts", zap.Error(err))
+	}
+	maintenanceWindows, err := updateWindows(cfg.Updates)
+	if err != nil {
+		log.Fatal("Invalid updates configuration", zap.Error(err))
+	}
+	if err := updateManager.SetMaintenanceConfig(maintenanceWindows); err != nil {
+		log.Fatal("Invalid updates configuration", zap.Error(err))
+	}
+	advisories := security.NewVulnerabilityMatcher(log, nil, bus.Publisher(events.TopicSecurity))
+	updateManager.OnCheck(func(ctx context.Context) {
+		inv, err := software.Collect(ctx)
+		if err != nil {
+			log.Warn("Failed to collect inventory for advisory matching", zap.Error(err))
+			return
+		}
+		findings, err := advisories.Match(ctx, inv)
+		if err != nil {
+			log.Warn("Failed to match packages against advisories", zap.Error(err))
+			return
+		}
+		log.Info("Matched packages against advisories", zap.Int("findings", len(findings)))
+	})
+
+	// Services found on the network are reported to the server as they
+	// appear, change and go away
+	services := discovery.NewService(log, bus.Publisher(events.TopicNetwork))
+	services.Configure(discoveryScan(cfg.Discovery))
+	services.ConfigureDiscovery(discovery.Config{SearchDomains: cfg.Discovery.SearchDomains})
+
+	// Flows, DNS lookups and listening ports are tracked from the traffic,
+	// and the server can run connectivity checks from the agent
+	analyzer := network.NewAnalyzer(log, bus.Publisher(events.TopicNetwork))
+	analyzer.SetDNSWatchlist(dnsWatchlist(cfg.Network))
+	if err := analyzer.SetBPFFilter(cfg.Network.BPFFilter); err != nil {
+		log.Fatal("Invalid network configuration", zap.Error(err))
+	}
+	diagnostics := network.NewDiagnostics(log)
+	if cfg.Network.Enabled {
+		metricsCollector.SetFlows(analyzer.GetFlowTableStats)
+	}
+
+	// The server can capture runtime profiles of the agent and profile
+	// the host, tracing the kernel only when the feature is on
+	agentProfiler := profiler.NewProfiler(log)
+	agentProfiler.EnableEBPF(cfg.Features.EBPFProfiling)
+
+	// Components in planned maintenance raise no health alerts and run no
+	// config actions
+	maintenanceManager := maintenance.NewManager(log, bus.Publisher(events.TopicMaintenance))
+	healthChecker.SetMaintenance(maintenanceManager)
+
+	// SSH keys are inventoried here and changed through the server, which
+	// approves rotations. Policies never remove the break-glass keys.
+	sshKeys := sshkeys.NewManager(log, bus.Publisher(events.TopicSSHKeys))
+	sshKeys.SetBreakGlass(cfg.SSHKeys.BreakGlass)
+	sshCA := sshkeys.DefaultCAConfig
+	sshCA.KeyPath = cfg.SSHKeys.CAKey
+	if err := sshKeys.SetCA(sshCA); err != nil {
+		log.Fatal("Invalid SSH key configuration", zap.Error(err))
+	}
+
+	// Monitored files are verified against a baseline kept in the data
+	// directory
+	integrity := fim.NewMonitor(log, fimConfig(cfg), bus.Publisher(events.TopicFIM))
+
+	// Benchmarks and MAC status are checked on demand. Indicators,
+	// exposed secrets, login failures and the configured file rules are
+	// scanned on schedule, reporting what changed since the last scan.
+	benchmark := security.NewBenchmark(log)
+	indicators := security.NewIndicatorScanner(log, security.DefaultIndicatorConfig)
+	secretScanner, err := security.NewSecretScanner(log, security.DefaultSecretConfig)
+	if err != nil {
+		log.Fatal("Failed to create secret scanner", zap.Error(err))
+	}
+	if containers, err := docker.NewScanner(log); err != nil {
+		log.Warn("Container environments won't be scanned for secrets", zap.Error(err))
+	} else {
+		secretScanner.SetContainerSource(containers.ContainerEnvs)
+	}
+	macReporter := security.NewMACReporter(log, macConfig(cfg.Security.MAC))
+	logins := security.NewLoginMonitor(log, security.DefaultLoginConfig)
+	scans := security.NewScheduler(log, security.DefaultScheduleConfig, bus.Publisher(events.TopicSecurity))
+	scans.SetTasks(taskRegistry)
+	scans.SetStore(state)
+	scans.Add(security.ScanJob{
+		Name:     "indicators",
+		Interval: security.DefaultIndicatorConfig.Interval,
+		Run:      indicators.Results,
+	})
+	scans.Add(security.ScanJob{
+		Name:     "secrets",
+		Interval: security.DefaultSecretConfig.Interval,
+		Run:      secretScanner.Results,
+	})
+	scans.Add(security.ScanJob{
+		Name:     "logins",
+		Interval: security.DefaultLoginConfig.Interval,
+		Run:      logins.Results,
+	})
+	fileRules, err := securityScan(cfg.Security.Scan)
+	if err != nil {
+		log.Fatal("Invalid security configuration", zap.Error(err))
+	}
+	if len(fileRules.Paths) > 0 {
+		scanner := security.NewScanner(log)
+		scanner.Configure(fileRules)
+		scans.Add(security.ScanJob{
+			Name:     "rules",
+			Interval: fileRules.Interval,
+			Run: func(ctx context.Context) ([]security.ScanResult, error) {
+				return scanner.Scan(ctx, fileRules)
+			},
+		})
+	}
+
+	// Managed config files are versioned, rendered from templates, kept
+	// in their desired state and followed by their reload actions
+	configFiles, err := config.NewManager(log)
+	if err != nil {
+		log.Fatal("Failed to create config manager", zap.Error(err))
+	}
+	configFiles.SetMaintenance(maintenanceManager)
+	configFiles.SetWriteAllowlist(cfg.ConfigFiles.WriteAllowlist)
+	configFiles.SetEvents(bus.Publisher(events.TopicConfig))
+	if err := configFiles.SetStore(state); err != nil {
+		log.Warn("Config change history won't survive restarts", zap.Error(err))
+	}
+	desiredState, err := config.NewReconciler(log, configFiles, bus.Publisher(events.TopicConfig))
+	if err != nil {
+		log.Fatal("Failed to create config reconciler", zap.Error(err))
+	}
+
+	// The optimizer suggests ways to free resources, which the server
+	// approves unless they are low-risk and safe mode is off
+	hostOptimizations := optimizer.NewOptimizer(log, bus.Publisher(events.TopicOptimizer))
+	if err := hostOptimizations.SetHistoryPath(filepath.Join(cfg.Agent.DataDir, "optimizer", "history.json")); err != nil {
+		log.Warn("Optimization history won't survive restarts", zap.Error(err))
+	}
+
+	// Problems are detected from the metrics and the discovered
+	// containers, and resolved through the optimizer and Docker. Those
+	// that keep failing are escalated to the server as alerts.
+	problems := resolver.NewResolver(log, resolver.Dependencies{
+		Metrics:     hostUsage{metricsCollector},
+		Health:      hostContainers{services, dockerManager},
+		Discovery:   hostContainers{services, dockerManager},
+		Optimizer:   hostOptimizer{hostOptimizations},
+		Services:    hostContainers{services, dockerManager},
+		Maintenance: maintenanceManager,
+		Notifier:    resolver.NewEventNotifier(bus.Publisher(events.TopicAlert)),
+	})
+	problems.Configure(resolverConfig(cfg.Resolver))
+	problems.SetEscalationPolicy(escalationPolicy(cfg.Resolver))
+	if err := problems.SetStore(state); err != nil {
+		log.Warn("Problem history won't survive restarts", zap.Error(err))
+	}
+	if cfg.Resolver.Runbooks != "" {
+		if err := problems.LoadRunbooks(cfg.Resolver.Runbooks); err != nil {
+			log.Fatal("Invalid resolver configuration", zap.Error(err))
+		}
+	}
+
 	// Get system info for agent registration
 	hostname, err := os.Hostname()
 	if err != nil {
 		log.Fatal("Failed to get hostname", zap.Error(err))
 	}
 
+	// An offline agent has no server to enroll with
+	var identity *enroll.Identity
+	if !cfg.Journal.Offline {
+		if identity, err = enrollAgent(ctx, log, cfg); err != nil {
+			log.Fatal("Failed to enroll agent", zap.Error(err))
+		}
+	}
+
 	// Create agent info
 	agentInfo := protocol.AgentInfo{
 		ID:       cfg.Agent.ID,
@@ -98,6 +939,7 @@ func main() {
 		OS:       runtime.GOOS,
 		Arch:     runtime.GOARCH,
 		Labels:   cfg.Agent.Labels,
+		Tenant:   cfg.Agent.Tenant,
 		Features: []string{
 			"exec",
 			"metrics",
@@ -105,151 +947,793 @@ func main() {
 			"docker",
 			"docker:compose",
 			"docker:logs",
+			"docker:cp",
+			"system:inventory",
+			"system:info",
+			"inventory",
+			"updates",
 		},
 	}
 
-	// Initialize WebSocket client
+	// Initialize WebSocket client, failing over between the configured
+	// servers
+	if identity != nil {
+		agentInfo.ID = identity.AgentID
+	}
 	wsClient := websocket.NewClient(cfg.Server.URL, agentInfo, log)
+	if identity != nil {
+		wsClient.SetIdentity(identity)
+	}
+	if err := wsClient.SetEndpoints(ctx, serverEndpoints(cfg.Server)); err != nil {
+		log.Fatal("Invalid server configuration", zap.Error(err))
+	}
+	wsClient.SetFailover(cfg.Server.ReconnectDelay, cfg.Server.FailbackInterval)
+	wsClient.SetCompression(compressionConfig(cfg.Server))
+	if err := wsClient.SetCodecs(cfg.Server.Codecs); err != nil {
+		log.Fatal("Invalid server configuration", zap.Error(err))
+	}
+	wsClient.SetRateLimits(rateLimits(cfg.Server.RateLimits))
+	wsClient.SetEvents(bus.Publisher(events.TopicConnection))
+	wsClient.SetObserver(selfMetrics)
+	if err := wsClient.SetDeadLetterStore(state); err != nil {
+		log.Warn("Dead letters won't survive restarts", zap.Error(err))
+	}
+	selfMetrics.Queue("websocket_send", wsClient.SendQueueDepth)
+	selfMetrics.Counter("throttle", wsClient.Throttled)
+
+	// Events and metrics that can't reach the server are journaled, and
+	// uploaded once it is reachable again. Offline, everything is.
+	records, err := journal.Open(log, journalDir(cfg), journal.Config{
+		MaxAge:  cfg.Journal.MaxAge,
+		MaxSize: cfg.Journal.MaxSize,
+	})
+	if err != nil {
+		log.Fatal("Failed to open journal", zap.Error(err))
+	}
+	sender := journal.NewSender(log, records, wsClient)
+	sender.SetOffline(cfg.Journal.Offline)
+
+	// Collected log lines are shipped straight to the server, since the
+	// shipper spools what can't be sent itself
+	logComponents, err := logCollection(log, cfg.Logging.Collect, cfg.Agent.DataDir, state,
+		wsClient.SendMessage, bus.Publisher(events.TopicLog))
+	if err != nil {
+		log.Fatal("Invalid logging configuration", zap.Error(err))
+	}
+
+	// The server learns the OS, CPUs and memory at registration, and of
+	// upgrades from events
+	sysInfo := system.NewInfoCollector(log, bus.Publisher(events.TopicInventory))
+	sysInfo.OnChange(func(info *system.SystemInfo) {
+		data, err := json.Marshal(info)
+		if err != nil {
+			log.Warn("Failed to marshal system info", zap.Error(err))
+			return
+		}
+		wsClient.SetSystemInfo(data)
+	})
+
+	// Commands run only if the role claims they carry allow them
+	authorizer := authz.New(authorization(cfg.Agent))
+	executed := idempotency.NewCache(log, idempotency.DefaultTTL, idempotency.DefaultMaxEntries)
+	if err := executed.SetStore(state); err != nil {
+		log.Warn("Executed commands may run again after a restart", zap.Error(err))
+	}
+
+	// Commands go to the component owning their prefix; the others run
+	// as processes
+	commands := map[string]commandFunc{
+		"docker:":     dockerPlugin.HandleCommand,
+		"system:":     hardware.HandleCommand,
+		"system:info": sysInfo.HandleCommand,
+		"inventory:":  software.HandleCommand,
+		"updates:":    updateManager.HandleCommand,
+		"net:":        diagnostics.HandleCommand,
+		"profiler:":   agentProfiler.HandleCommand,
+
+		"maintenance:":        maintenanceManager.HandleCommand,
+		"sshkeys:":            sshKeys.HandleCommand,
+		"security:":           benchmark.HandleCommand,
+		"security:indicators": indicators.HandleCommand,
+		"security:secrets":    secretScanner.HandleCommand,
+		"security:scan":       scans.HandleCommand,
+		"security:mac":        macReporter.HandleCommand,
+		"security:logins":     logins.HandleCommand,
+		"fim:":                integrity.HandleCommand,
+		"config:drift":        desiredState.HandleCommand,
+		"config:desired":      desiredState.HandleCommand,
+		"changes:":            configFiles.HandleCommand,
+		"optimizer:":          hostOptimizations.HandleCommand,
+		"resolver:":           problems.HandleCommand,
+		"deadletters:":        wsClient.HandleDeadLetterCommand,
+	}
+
+	// External plugins are loaded from the plugin directory. They can't
+	// take over the prefixes of the components, and the server learns
+	// the capabilities and commands they register.
+	var external *plugins.Manager
+	if cfg.Plugins.Dir != "" {
+		external = plugins.NewManager(log, cfg.Plugins.Dir, cfg.Agent.Version, bus.Publisher(events.TopicPlugin))
+		host := plugins.DefaultHostConfig
+		host.Metrics = metricsCollector
+		external.SetHostConfig(host)
+		for prefix := range commands {
+			external.Reserve(prefix)
+		}
+		baseFeatures := agentInfo.Features
+		external.OnRegistration(func(reg plugins.Registration) {
+			features := append([]string(nil), baseFeatures...)
+			for _, c := range reg.Capabilities {
+				if !slices.Contains(features, c) {
+					features = append(features, c)
+				}
+			}
+			if err := wsClient.UpdateFeatures(features, reg.Commands); err != nil {
+				log.Warn("Failed to send feature update", zap.Error(err))
+			}
+		})
+	}
 
-	// Create handler wrapper for Docker plugin
-	dockerHandler := func(ctx context.Context, msg protocol.Message) error {
+	// The dashboard lists the recent commands
+	commandLog := web.NewCommandLog(web.DefaultCommandLogSize)
+
+	// Create handler wrapper for the component commands
+	commandHandler := func(ctx context.Context, msg protocol.Message) error {
 		var cmd protocol.AgentCommand
 		if err := json.Unmarshal(msg.Payload, &cmd); err != nil {
 			return fmt.Errorf("invalid command payload: %w", err)
 		}
+		received := time.Now()
+		// Processes are authorized as exec:<command>, so that roles
+		// allowing a component's commands don't allow running a binary
+		// of the same name
+		handle := commandFor(commands, cmd.Command)
+		if handle == nil && external != nil && external.Handles(cmd.Command) {
+			handle = external.HandleCommand
+		}
+		name := cmd.Command
+		if handle == nil {
+			name = authz.ExecPrefix + cmd.Command
+		}
+		if err := authorizer.Authorize(name, cmd); err != nil {
+			commandLog.Add(web.Command{
+				ID:        msg.ID,
+				Command:   cmd.Command,
+				Args:      cmd.Args,
+				Roles:     cmd.Roles,
+				Error:     err.Error(),
+				Timestamp: received,
+			})
+			log.Warn("Command refused",
+				zap.String("command", name),
+				zap.String("tenant", cmd.Tenant),
+				zap.Strings("roles", cmd.Roles),
+				zap.Error(err))
+			response, err := json.Marshal(protocol.AgentResponse{
+				Success:   false,
+				Error:     err.Error(),
+				ErrorCode: protocol.CodeOf(err),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to marshal response: %w", err)
+			}
+			return wsClient.SendMessage(protocol.Message{
+				Type:      protocol.TypeResponse,
+				ID:        msg.ID,
+				Timestamp: time.Now(),
+				Payload:   response,
+			})
+		}
 
-		result, err := dockerPlugin.HandleCommand(ctx, cmd.Command, cmd.Args)
-		if err != nil {
-			return err
+		// Commands resent after a reconnect are answered with the result
+		// of their first run
+		key := cmd.IdempotencyKey
+		if key == "" {
+			key = msg.ID
 		}
+		reply, cached, err := executed.Do(key, func() (idempotency.Reply, error) {
+			if handle == nil {
+				return runProcess(ctx, processManager, msg.ID, cmd)
+			}
+			result, err := handle(ctx, cmd.Command, cmd.Args)
+			if err != nil {
+				return idempotency.Reply{}, err
+			}
 
-		resultJSON, err := json.Marshal(map[string]interface{}{
-			"result": result,
+			resultJSON, err := json.Marshal(map[string]interface{}{
+				"result": result,
+			})
+			if err != nil {
+				return idempotency.Reply{}, fmt.Errorf("failed to marshal result: %w", err)
+			}
+			return idempotency.Reply{Type: protocol.TypeResult, Payload: resultJSON}, nil
 		})
+		logged := web.Command{
+			ID:        msg.ID,
+			Command:   cmd.Command,
+			Args:      cmd.Args,
+			Roles:     cmd.Roles,
+			Success:   err == nil,
+			Cached:    cached,
+			Duration:  time.Since(received),
+			Timestamp: received,
+		}
+		if err != nil {
+			logged.Error = err.Error()
+		}
+		commandLog.Add(logged)
 		if err != nil {
-			return fmt.Errorf("failed to marshal result: %w", err)
+			return err
+		}
+		if cached {
+			log.Info("Command already executed, resending its result",
+				zap.String("command", cmd.Command),
+				zap.String("key", key))
 		}
 
 		return wsClient.SendMessage(protocol.Message{
-			Type:      protocol.TypeResult,
+			Type:      reply.Type,
 			ID:        msg.ID,
 			Timestamp: time.Now(),
-			Payload:   resultJSON,
+			Payload:   reply.Payload,
 		})
 	}
 
 	// Register command handlers
-	wsClient.RegisterHandler(protocol.TypeCommand, dockerHandler)
+	wsClient.RegisterHandler(protocol.TypeCommand, commandHandler)
+	wsClient.RegisterHandler(protocol.TypeMaintenance, requestHandler(wsClient, authorizer, log, "maintenance",
+		maintenanceCommand,
+		func(ctx context.Context, req protocol.MaintenanceRequest) (interface{}, error) {
+			return maintenanceManager.HandleRequest(req)
+		}))
+	// Rotations are only put in place once the server approves them with
+	// a second request
+	wsClient.RegisterHandler(protocol.TypeSSHKeys, requestHandler(wsClient, authorizer, log, "ssh key",
+		sshKeysCommand, sshKeys.HandleRequest))
+	wsClient.RegisterHandler(protocol.TypeConfigTemplate, requestHandler(wsClient, authorizer, log, "config template",
+		func(protocol.ConfigTemplate) string { return "config:template" },
+		func(ctx context.Context, req protocol.ConfigTemplate) (interface{}, error) {
+			return configFiles.Render(req, config.CollectFacts(wsClient.AgentInfo().ID, cfg.Agent.Labels))
+		}))
+	wsClient.RegisterHandler(protocol.TypeConfigState, requestHandler(wsClient, authorizer, log, "config state",
+		configStateCommand,
+		func(ctx context.Context, req protocol.ConfigStateRequest) (interface{}, error) {
+			return desiredState.HandleRequest(req)
+		}))
+	wsClient.RegisterHandler(protocol.TypeConfigAction, requestHandler(wsClient, authorizer, log, "config action",
+		configActionCommand,
+		func(ctx context.Context, req protocol.ConfigActionRequest) (interface{}, error) {
+			return configFiles.HandleActionRequest(req)
+		}))
+
+	// Skewed clocks break message timestamps and log correlation
+	clockMonitor := clock.NewMonitor(log, bus.Publisher(events.TopicAlert))
+	clockMonitor.Set(clockConfig(cfg.Clock))
+
+	// Summarize samples before uploading them, so that large fleets don't
+	// send every raw sample
+	metricsHistory := web.NewMetricsHistory(web.DefaultHistorySize)
+	metricsCollector.OnCollect(metricsHistory.Observe)
+	aggregator := metrics.NewAggregator(log, sender)
+	aggregator.SetPolicy(aggregationPolicy(cfg.Metrics.Aggregation))
+	if cfg.Metrics.Aggregation.Enabled {
+		metricsCollector.OnCollect(aggregator.Observe)
+	}
+
+	// Apply config changes on SIGHUP or when the config files change
+	metricsCollector.SetInterval(cfg.Metrics.Interval)
+	reloader, err := config.NewReloader(log, cfg, bus.Publisher(events.TopicConfig))
+	if err != nil {
+		log.Fatal("Failed to create config reloader", zap.Error(err))
+	}
+	reloader.OnChange("logging.level", func(c *config.Config) error {
+		return logger.SetLevel(c.Logging.Level)
+	})
+	reloader.OnChange("agent.authorization", func(c *config.Config) error {
+		authorizer.Set(authorization(c.Agent))
+		return nil
+	})
+	reloader.OnChange("docker", func(c *config.Config) error {
+		dockerPlugin.SetMountAllowlist(c.Docker.MountAllowlist)
+		dockerPlugin.SetCrashPolicy(crashPolicy(c.Docker.CrashLoop))
+		dockerPlugin.SetDriftPolicy(driftPolicy(c.Docker.ComposeDrift))
+		dockerPlugin.SetUpdatePolicy(updatePolicy(c.Docker.AutoUpdate))
+		return nil
+	})
+	reloader.OnChange("discovery", func(c *config.Config) error {
+		services.Configure(discoveryScan(c.Discovery))
+		services.ConfigureDiscovery(discovery.Config{SearchDomains: c.Discovery.SearchDomains})
+		return nil
+	})
+	reloader.OnChange("network", func(c *config.Config) error {
+		analyzer.SetDNSWatchlist(dnsWatchlist(c.Network))
+		return nil
+	})
+	reloader.OnChange("resolver", func(c *config.Config) error {
+		problems.Configure(resolverConfig(c.Resolver))
+		problems.SetEscalationPolicy(escalationPolicy(c.Resolver))
+		if c.Resolver.Runbooks == "" {
+			return nil
+		}
+		return problems.LoadRunbooks(c.Resolver.Runbooks)
+	})
+	reloader.OnChange("updates", func(c *config.Config) error {
+		maintenance, err := updateWindows(c.Updates)
+		if err != nil {
+			return err
+		}
+		updateManager.SetStaging(healthy(healthChecker), c.Updates.Settle)
+		return updateManager.SetMaintenanceConfig(maintenance)
+	})
+	reloader.OnChange("config_files", func(c *config.Config) error {
+		configFiles.SetWriteAllowlist(c.ConfigFiles.WriteAllowlist)
+		return nil
+	})
+	reloader.OnChange("features.ebpf_profiling", func(c *config.Config) error {
+		agentProfiler.EnableEBPF(c.Features.EBPFProfiling)
+		return nil
+	})
+	reloader.OnChange("clock", func(c *config.Config) error {
+		clockMonitor.Set(clockConfig(c.Clock))
+		return nil
+	})
+	reloader.OnChange("metrics.aggregation", func(c *config.Config) error {
+		aggregator.SetPolicy(aggregationPolicy(c.Metrics.Aggregation))
+		return nil
+	})
+	reloader.OnChange("metrics.interval", func(c *config.Config) error {
+		metricsCollector.SetInterval(c.Metrics.Interval)
+		return nil
+	})
+	reloader.OnChange("server", func(c *config.Config) error {
+		wsClient.SetFailover(c.Server.ReconnectDelay, c.Server.FailbackInterval)
+		wsClient.SetCompression(compressionConfig(c.Server))
+		wsClient.SetRateLimits(rateLimits(c.Server.RateLimits))
+		if err := wsClient.SetCodecs(c.Server.Codecs); err != nil {
+			return err
+		}
+		return wsClient.SetEndpoints(ctx, serverEndpoints(c.Server))
+	})
 
 	// Register health checks
-	healthChecker.AddCheck("websocket", wrapHealthCheck(wsClient.HealthCheck))
+	if !cfg.Journal.Offline {
+		healthChecker.AddCheck("websocket", wrapHealthCheck(wsClient.HealthCheck))
+	}
 	healthChecker.AddCheck("process_manager", wrapHealthCheck(processManager.HealthCheck))
 	healthChecker.AddCheck("metrics", wrapHealthCheck(metricsCollector.HealthCheck))
 	healthChecker.AddCheck("docker", wrapHealthCheck(dockerManager.HealthCheck))
+	healthChecker.AddCheck("systemd_units", unitMonitor.Check, health.WithRequired(false), health.WithRetries(0, 0))
+	healthChecker.AddCheck("clock", clockMonitor.Check, health.WithRequired(false), health.WithRetries(0, 0))
 
-	// Start components
-	components := []struct {
-		name    string
-		start   func(context.Context) error
-		cleanup func(context.Context) error
-	}{
-		{"health", healthChecker.Start, healthChecker.Shutdown},
-		{"metrics", metricsCollector.Start, metricsCollector.Shutdown},
-		{"process", processManager.Start, processManager.Shutdown},
-		{"docker", dockerPlugin.Start, dockerPlugin.Shutdown},
-		{"websocket", wsClient.Connect, wsClient.Shutdown},
-	}
+	// Staged updates halt once a package leaves the agent unhealthy
+	updateManager.SetStaging(healthy(healthChecker), cfg.Updates.Settle)
 
-	// Start all components
-	for _, c := range components {
-		log.Info("Starting component", zap.String("component", c.name))
-		if err := c.start(ctx); err != nil {
-			log.Fatal("Failed to start component",
-				zap.String("component", c.name),
-				zap.Error(err))
+	// Heartbeats are built from cached snapshots, so a stalled metrics or
+	// process source can't hold them up
+	heartbeats := heartbeat.NewSender(log, wsClient, metricsCollector, processManager, func() string {
+		return string(healthChecker.GetStatus())
+	})
+	heartbeats.SetSelfMetrics(selfMetrics.Snapshot)
+	selfMetrics.Counter("heartbeat", heartbeats.Failures)
+
+	// Feed the systemd watchdog while health checks keep completing, so
+	// that systemd restarts an agent whose internals have wedged. An
+	// unhealthy status alone, such as the server being unreachable, is not
+	// a reason to restart.
+	notifier := systemd.NewNotifier(log)
+	started := time.Now()
+	notifier.SetWatchdogCheck(func() error {
+		last := healthChecker.LastCheck()
+		if last.Before(started) {
+			last = started
 		}
-	}
+		if stalled := time.Since(last); stalled > healthStallLimit {
+			return fmt.Errorf("no health check completed for %s", stalled.Round(time.Second))
+		}
+		return nil
+	}, func() string {
+		return "Health " + string(healthChecker.GetStatus())
+	})
 
 	// Forward Docker events to WebSocket
-	go func() {
-		for event := range dockerEvents {
-			eventJSON, err := json.Marshal(map[string]interface{}{
-				"event": event,
-			})
-			if err != nil {
-				log.Error("Failed to marshal Docker event", zap.Error(err))
-				continue
+	dockerEvents := bus.Subscribe("docker-forwarder", events.Options{Overflow: events.DropOldest}, events.TopicDocker)
+	selfMetrics.Queue("events:docker-forwarder", dockerEvents.Len)
+	crash.Go("docker-forwarder", func() {
+		for e := range dockerEvents.C() {
+			var msg protocol.Message
+			switch event := e.Payload.(type) {
+			case protocol.DockerEvent:
+				// Container events go out as typed events
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Error("Failed to marshal Docker event", zap.Error(err))
+					continue
+				}
+				eventJSON, err := json.Marshal(protocol.Event{
+					AgentID:   cfg.Agent.ID,
+					Kind:      "docker_event",
+					Data:      data,
+					Timestamp: event.Timestamp,
+				})
+				if err != nil {
+					log.Error("Failed to marshal Docker event", zap.Error(err))
+					continue
+				}
+				msg = protocol.Message{Type: protocol.TypeEvent, Payload: eventJSON}
+			default:
+				eventJSON, err := json.Marshal(map[string]interface{}{
+					"event": event,
+				})
+				if err != nil {
+					log.Error("Failed to marshal Docker event", zap.Error(err))
+					continue
+				}
+				msg = protocol.Message{Type: protocol.TypeResult, Payload: eventJSON}
 			}
+			msg.ID = fmt.Sprintf("docker-event-%d", time.Now().UnixNano())
+			msg.Timestamp = time.Now()
 
-			if err := wsClient.SendMessage(protocol.Message{
-				Type:      protocol.TypeResult,
-				ID:        fmt.Sprintf("docker-event-%d", time.Now().UnixNano()),
-				Timestamp: time.Now(),
-				Payload:   eventJSON,
-			}); err != nil {
+			if err := sender.SendMessage(msg); err != nil {
+				selfMetrics.Error("docker")
 				log.Error("Failed to send Docker event", zap.Error(err))
 			}
 		}
-	}()
-
-	// Start heartbeat sender
-	go func() {
-		ticker := time.NewTicker(15 * time.Second)
-		defer ticker.Stop()
+	})
 
+	// Report config reloads, connection changes and the other subsystem
+	// events to the server
+	serverEvents := bus.Subscribe("server-forwarder", events.Options{Overflow: events.DropOldest},
+		events.TopicConfig, events.TopicConnection, events.TopicAlert, events.TopicLog,
+		events.TopicSecurity, events.TopicUpdate, events.TopicPlugin, events.TopicInventory,
+		events.TopicNetwork, events.TopicMaintenance, events.TopicSSHKeys, events.TopicFIM,
+		events.TopicOptimizer)
+	selfMetrics.Queue("events:server-forwarder", serverEvents.Len)
+	crash.Go("server-forwarder", func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
-				metrics := metricsCollector.GetMetrics()
-				processes, _ := processManager.GetProcesses()
-
-				heartbeat := protocol.AgentHeartbeat{
-					Status:    string(healthChecker.GetStatus()),
-					Uptime:    metrics.UptimeSeconds,
-					LoadAvg:   [3]float64(metrics.LoadAverage),
-					Processes: len(processes),
-					Metrics: protocol.AgentMetrics{
-						CPU:    metrics.CPUUsage,
-						Memory: float64(metrics.MemoryUsed) / float64(metrics.MemoryTotal),
-						Disk:   float64(metrics.DiskUsed) / float64(metrics.DiskTotal),
-					},
+			case e, ok := <-serverEvents.C():
+				if !ok {
+					return
 				}
-
-				heartbeatJSON, err := json.Marshal(heartbeat)
+				event := e.Payload
+				kind := string(e.Topic)
+				switch event.(type) {
+				case config.ReloadReport:
+					kind = "config_reload"
+				case protocol.ConnectionEvent:
+					kind = "connection"
+				case docker.ContainerAlert:
+					kind = "container_alert"
+				case docker.ImageUpdate:
+					kind = "image_update"
+				case protocol.ClockDrift:
+					kind = "clock_drift"
+				case protocol.Reboot:
+					kind = "reboot"
+				case protocol.HardwareChange:
+					kind = "hardware_change"
+				case protocol.SystemInfoChange:
+					kind = "system_info"
+				case protocol.ServiceEvent:
+					kind = "service"
+				case protocol.TopologyReport:
+					kind = "topology"
+				case network.DNSAlert:
+					kind = "dns_alert"
+				case network.PortChange:
+					kind = "port_change"
+				case protocol.SSHKeyDrift:
+					kind = "ssh_key_drift"
+				case protocol.ConfigDrift:
+					kind = "config_drift"
+				case protocol.ConfigActionResult:
+					kind = "config_action"
+				case security.ScanReport:
+					kind = "security_scan"
+				case optimizer.Optimization:
+					kind = "optimization"
+				case resolver.Notification:
+					kind = "problem_notification"
+				case logging.LogEntry:
+					kind = "log_match"
+				case logging.AnomalyEvent:
+					kind = "log_anomaly"
+				}
+				data, err := json.Marshal(event)
 				if err != nil {
-					log.Error("Failed to marshal heartbeat", zap.Error(err))
+					log.Error("Failed to marshal event", zap.String("kind", kind), zap.Error(err))
 					continue
 				}
-
-				if err := wsClient.SendMessage(protocol.Message{
-					Type:      protocol.TypeHeartbeat,
-					ID:        fmt.Sprintf("heartbeat-%d", time.Now().Unix()),
+				eventJSON, err := json.Marshal(protocol.Event{
+					AgentID:   cfg.Agent.ID,
+					Kind:      kind,
+					Data:      data,
 					Timestamp: time.Now(),
-					Payload:   heartbeatJSON,
+				})
+				if err != nil {
+					log.Error("Failed to marshal event", zap.String("kind", kind), zap.Error(err))
+					continue
+				}
+				if err := sender.SendMessage(protocol.Message{
+					Type:      protocol.TypeEvent,
+					ID:        fmt.Sprintf("%s-%d", kind, time.Now().UnixNano()),
+					Timestamp: time.Now(),
+					Payload:   eventJSON,
 				}); err != nil {
-					log.Error("Failed to send heartbeat", zap.Error(err))
+					selfMetrics.Error("events")
+					log.Warn("Failed to send event", zap.String("kind", kind), zap.Error(err))
 				}
 			}
 		}
-	}()
+	})
+
+	// Report task progress to the server
+	events.On(bus, "task-forwarder", events.Options{Overflow: events.DropOldest}, events.TopicTask, func(task protocol.TaskProgress) {
+		payload, err := json.Marshal(task)
+		if err != nil {
+			log.Error("Failed to marshal task progress", zap.String("task", task.ID), zap.Error(err))
+			return
+		}
+		if err := sender.SendMessage(protocol.Message{
+			Type:      protocol.TypeProgress,
+			ID:        fmt.Sprintf("progress-%d", time.Now().UnixNano()),
+			Timestamp: time.Now(),
+			Payload:   payload,
+		}); err != nil {
+			selfMetrics.Error("events")
+			log.Warn("Failed to send task progress", zap.String("task", task.ID), zap.Error(err))
+		}
+	})
+
+	// Upload the reports of earlier crashes once the server is reachable.
+	// Reports that fail to upload are retried on the next connection.
+	events.On(bus, "crash-uploader", events.Options{}, events.TopicConnection, func(e protocol.ConnectionEvent) {
+		if e.State != websocket.StateConnected {
+			return
+		}
+		if err := crashes.Upload(cfg.Agent.ID, wsClient.SendMessage); err != nil {
+			log.Warn("Failed to upload crash reports", zap.Error(err))
+		}
+	})
+
+	// Upload what was journaled while the server was unreachable
+	if cfg.Journal.Upload {
+		events.On(bus, "journal-uploader", events.Options{}, events.TopicConnection, func(e protocol.ConnectionEvent) {
+			if e.State != websocket.StateConnected {
+				return
+			}
+			sent, err := records.Replay(wsClient.SendMessage)
+			if err != nil {
+				log.Warn("Failed to upload journal", zap.Int("uploaded", sent), zap.Error(err))
+			} else if sent > 0 {
+				log.Info("Uploaded journal", zap.Int("records", sent))
+			}
+		})
+	}
+
+	// Offline, the agent never connects. Heartbeats only tell the server
+	// the agent is alive, so they aren't journaled; metrics are through
+	// the aggregator.
+	connect, disconnect := wsClient.Connect, wsClient.Shutdown
+	startHeartbeats, stopHeartbeats := heartbeats.Start, heartbeats.Shutdown
+	if cfg.Journal.Offline {
+		log.Info("Running offline, journaling to the data directory")
+		connect = func(context.Context) error { return nil }
+		disconnect, startHeartbeats, stopHeartbeats = connect, connect, connect
+	}
+
+	// Start components
+	components := []component{
+		{"events", bus.Start, bus.Shutdown},
+		{"budget", governor.Start, governor.Shutdown},
+		{"reloader", reloader.Start, reloader.Shutdown},
+		{"maintenance", maintenanceManager.Start, maintenanceManager.Shutdown},
+		{"health", healthChecker.Start, healthChecker.Shutdown},
+		{"boot", bootTracker.Start, bootTracker.Shutdown},
+		{"units", unitMonitor.Start, unitMonitor.Shutdown},
+		{"hardware", hardware.Start, hardware.Shutdown},
+		{"inventory", software.Start, software.Shutdown},
+		{"updates", updateManager.Start, updateManager.Shutdown},
+		{"metrics", metricsCollector.Start, metricsCollector.Shutdown},
+		{"snmp", snmpPoller.Start, snmpPoller.Shutdown},
+		{"process", processManager.Start, processManager.Shutdown},
+		{"docker", dockerPlugin.Start, dockerPlugin.Shutdown},
+		{"transfers", transfers.Start, withoutContext(transfers.Shutdown)},
+		{"sysinfo", sysInfo.Start, sysInfo.Shutdown},
+		{"sshkeys", sshKeys.Start, sshKeys.Shutdown},
+		{"fim", integrity.Start, integrity.Shutdown},
+		{"scans", scans.Start, scans.Shutdown},
+		{"configs", configFiles.Start, configFiles.Shutdown},
+		{"desired", desiredState.Start, desiredState.Shutdown},
+		{"journal", nothing, withoutContext(records.Close)},
+		{"websocket", connect, disconnect},
+		{"heartbeat", startHeartbeats, stopHeartbeats},
+		{"aggregator", aggregator.Start, aggregator.Shutdown},
+		{"clock", clockMonitor.Start, clockMonitor.Shutdown},
+		{"systemd", notifier.Start, notifier.Shutdown},
+	}
+	if cfg.Metrics.Pprof != "" {
+		// The endpoints are served until their context is done
+		stopPprof := func() {}
+		components = append(components, component{"pprof", func(ctx context.Context) error {
+			ctx, stopPprof = context.WithCancel(ctx)
+			return agentProfiler.ServePprof(ctx, cfg.Metrics.Pprof)
+		}, func(context.Context) error {
+			stopPprof()
+			return nil
+		}})
+	}
+	if cfg.Network.Enabled {
+		healthChecker.AddCheck("network", wrapHealthCheck(analyzer.HealthCheck), health.WithRequired(false), health.WithRetries(0, 0))
+		components = append(components, component{"network", func(ctx context.Context) error {
+			return analyzer.Start(ctx, cfg.Network.Interface)
+		}, analyzer.Shutdown})
+		if cfg.Network.Export.Collector != "" {
+			exporter, err := network.NewFlowExporter(log, analyzer, network.ExportConfig{
+				Collector: cfg.Network.Export.Collector,
+				Format:    cfg.Network.Export.Format,
+				Interval:  cfg.Network.Export.Interval,
+			})
+			if err != nil {
+				log.Fatal("Invalid network configuration", zap.Error(err))
+			}
+			components = append(components, component{"flowexport", exporter.Start, exporter.Shutdown})
+		}
+	}
+	if cfg.Discovery.Enabled {
+		components = append(components, component{"discovery", services.Start, services.Shutdown})
+		if cfg.Discovery.Mesh {
+			mesh := discovery.NewPeerMesh(log, services, discovery.PeerConfig{
+				AgentID: wsClient.AgentInfo().ID,
+				Port:    cfg.Discovery.MeshPort,
+				Secret:  cfg.Discovery.MeshSecret,
+			}, bus.Publisher(events.TopicNetwork))
+			components = append(components, component{"mesh", mesh.Start, mesh.Shutdown})
+		}
+	}
+	components = append(components, logComponents...)
+	if cfg.Resolver.Enabled {
+		components = append(components, component{"resolver", problems.Start, problems.Shutdown})
+	}
+	if external != nil {
+		components = append(components, component{"plugins", external.Start, external.Shutdown})
+	}
+	if cfg.Metrics.Listen != "" {
+		metricsServer := selfmetrics.NewServer(log, selfMetrics, cfg.Metrics.Listen)
+		components = append(components, component{"selfmetrics", metricsServer.Start, metricsServer.Shutdown})
+	}
+
+	// The local API serves the dashboard and the top command
+	recentEvents := web.NewEventLog(web.DefaultEventLogSize)
+	apiEvents := bus.Subscribe("api-events", events.Options{Overflow: events.DropOldest}, events.All)
+	selfMetrics.Queue("events:api-events", apiEvents.Len)
+	crash.Go("api-events", func() {
+		for e := range apiEvents.C() {
+			recentEvents.Add(e)
+		}
+	})
+	if cfg.API.Listen != "" {
+		token, err := web.LoadOrCreateToken(apiTokenFile(cfg))
+		if err != nil {
+			log.Fatal("Failed to set up local API token", zap.Error(err))
+		}
+		auth, err := apiAuth(cfg, token)
+		if err != nil {
+			log.Fatal("Invalid local API authentication", zap.Error(err))
+		}
+		api := web.NewServer(log, cfg.API.Listen, auth, taskRegistry)
+		if cfg.API.TLS.Cert != "" {
+			tlsConfig, err := web.LoadTLS(cfg.API.TLS.Cert, cfg.API.TLS.Key, cfg.API.TLS.ClientCA)
+			if err != nil {
+				log.Fatal("Failed to set up local API TLS", zap.Error(err))
+			}
+			api.SetTLS(tlsConfig)
+		}
+		agentStatus := func(ctx context.Context) web.Status {
+			return web.Status{
+				AgentID:   wsClient.AgentInfo().ID,
+				Version:   cfg.Agent.Version,
+				Hostname:  hostname,
+				Started:   started,
+				Health:    string(healthChecker.GetStatus()),
+				Connected: wsClient.HealthCheck(ctx) == nil,
+				Offline:   cfg.Journal.Offline,
+			}
+		}
+		api.JSON("/api/status", func(ctx context.Context) (interface{}, error) {
+			return agentStatus(ctx), nil
+		})
+
+		// The dashboard is pushed the status, metrics and health as they
+		// are collected, and the status when the connection changes
+		metricsCollector.OnCollect(func(*metrics.SystemMetrics) {
+			samples := metricsHistory.Samples()
+			if len(samples) > 0 {
+				api.Publish("sample", samples[len(samples)-1])
+			}
+			api.Publish("status", agentStatus(ctx))
+			api.Publish("health", healthChecks(healthChecker))
+		})
+		events.On(bus, "api-status", events.Options{}, events.TopicConnection, func(protocol.ConnectionEvent) {
+			api.Publish("status", agentStatus(ctx))
+		})
+		api.JSON("/api/metrics", func(context.Context) (interface{}, error) {
+			return metricsCollector.GetMetrics(), nil
+		})
+		api.JSON("/api/processes", func(context.Context) (interface{}, error) {
+			return processManager.GetProcesses()
+		})
+		api.JSON("/api/containers", func(ctx context.Context) (interface{}, error) {
+			return dockerManager.ListContainers(ctx, true)
+		})
+		api.JSON("/api/health", func(context.Context) (interface{}, error) {
+			return healthChecks(healthChecker), nil
+		})
+		api.JSON("/api/events", func(context.Context) (interface{}, error) {
+			return recentEvents.Recent(), nil
+		})
+		api.JSON("/api/metrics/history", func(context.Context) (interface{}, error) {
+			return metricsHistory.Samples(), nil
+		})
+		api.JSON("/api/commands", func(context.Context) (interface{}, error) {
+			return commandLog.Recent(), nil
+		})
+		api.JSON("/api/transfers", func(context.Context) (interface{}, error) {
+			return transfers.ListTransfers(), nil
+		})
+		api.Handle("/", web.NewDashboard(log, "shh-agent on "+hostname, cfg.API.Admin, auth))
+		if cfg.API.Admin {
+			adminActions(api, commandLog, dockerPlugin, transfers)
+		}
+		components = append(components, component{"api", api.Start, api.Shutdown})
+	}
+
+	// Start all components
+	for _, c := range components {
+		log.Info("Starting component", zap.String("component", c.name))
+		if err := c.start(ctx); err != nil {
+			log.Fatal("Failed to start component",
+				zap.String("component", c.name),
+				zap.Error(err))
+		}
+	}
+
+	// Discover the host's SSH keys, reporting the progress as a task
+	sshKeyPlugin := &plugins.SSHKeyPlugin{Keys: sshKeys, AgentID: wsClient.AgentInfo().ID, Tasks: taskRegistry}
+	crash.Go(sshKeyPlugin.Name(), sshKeyPlugin.Start)
 
 	// Handle shutdown signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Wait for shutdown signal
-	<-sigChan
-	log.Info("Received shutdown signal")
+	// Pausing a Windows service drops the server connection, so that the
+	// agent takes no commands until it is resumed
+	control.setPauseHandlers(func() error {
+		log.Info("Pausing agent")
+		return disconnect(ctx)
+	}, func() error {
+		log.Info("Resuming agent")
+		return connect(ctx)
+	})
+
+	// Components are up; a Type=notify unit becomes active now
+	notifier.Ready()
+
+	// Wait for shutdown signal or a service stop request
+	select {
+	case <-sigChan:
+		log.Info("Received shutdown signal")
+	case <-control.stop:
+		log.Info("Service stop requested")
+	}
+	notifier.Stopping()
 
 	// Create shutdown context with timeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Agent.ShutdownWait)
 	defer shutdownCancel()
 
-	// Close Docker events channel
-	close(dockerEvents)
-
 	// Shutdown components in reverse order
 	for i := len(components) - 1; i >= 0; i-- {
 		c := components[i]
@@ -262,4 +1746,5 @@ func main() {
 	}
 
 	log.Info("Agent shutdown complete")
+	return 0
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"shh/agent/internal/discovery"
+	"shh/agent/internal/docker"
+	"shh/agent/internal/metrics"
+	"shh/agent/internal/optimizer"
+	"shh/agent/internal/resolver"
+)
+
+// hostUsage reports the resource usage of the last metrics collection to
+// the resolver
+type hostUsage struct {
+	collector *metrics.Collector
+}
+
+func (u hostUsage) GetCPUUsage(ctx context.Context) (float64, error) {
+	m := u.collector.GetMetrics()
+	if m == nil || m.CPU == nil {
+		return 0, fmt.Errorf("no CPU usage collected yet")
+	}
+	return m.CPUUsage, nil
+}
+
+func (u hostUsage) GetMemoryUsage(ctx context.Context) (float64, error) {
+	m := u.collector.GetMetrics()
+	if m == nil || m.MemoryTotal == 0 {
+		return 0, fmt.Errorf("no memory usage collected yet")
+	}
+	return float64(m.MemoryUsed) / float64(m.MemoryTotal) * 100, nil
+}
+
+func (u hostUsage) GetDiskUsage(ctx context.Context) (float64, error) {
+	m := u.collector.GetMetrics()
+	if m == nil || m.DiskTotal == 0 {
+		return 0, fmt.Errorf("no disk usage collected yet")
+	}
+	return float64(m.DiskUsed) / float64(m.DiskTotal) * 100, nil
+}
+
+// hostContainers are the host's own services to the resolver: the Docker
+// containers found by discovery, which are healthy while discovery keeps
+// finding them running. Failed containers are restarted.
+type hostContainers struct {
+	services *discovery.Service
+	docker   *docker.Manager
+}
+
+func (h hostContainers) GetServices(ctx context.Context) ([]resolver.ServiceRef, error) {
+	var refs []resolver.ServiceRef
+	for id, info := range h.services.GetServices() {
+		if info.Source == "docker" {
+			refs = append(refs, resolver.ServiceRef{ID: id, Name: info.Name})
+		}
+	}
+	return refs, nil
+}
+
+// GetEndpoints returns no endpoints; the agent's connection to the server
+// has failover of its own
+func (h hostContainers) GetEndpoints(ctx context.Context) ([]resolver.Endpoint, error) {
+	return nil, nil
+}
+
+func (h hostContainers) CheckService(ctx context.Context, id string) (*resolver.ServiceHealth, error) {
+	info, ok := h.services.GetServices()[id]
+	if !ok {
+		return &resolver.ServiceHealth{Status: "gone"}, nil
+	}
+	state, _ := info.Metadata["state"].(string)
+	if info.Status != discovery.StatusActive {
+		state = info.Status
+	}
+	return &resolver.ServiceHealth{Healthy: state == "running", Status: state}, nil
+}
+
+func (h hostContainers) RestartService(ctx context.Context, name string) error {
+	for _, info := range h.services.GetServices() {
+		if info.Source != "docker" || info.Name != name {
+			continue
+		}
+		id, _ := info.Metadata["id"].(string)
+		if id == "" {
+			return fmt.Errorf("container %s has no ID", name)
+		}
+		return h.docker.RestartContainer(ctx, id, nil)
+	}
+	return fmt.Errorf("unknown container: %s", name)
+}
+
+// hostOptimizer frees exhausted resources by having the optimizer analyze
+// the host. Its suggestions go through the approval workflow, so only
+// low-risk ones are applied right away, and only outside safe mode.
+type hostOptimizer struct {
+	optimizer *optimizer.Optimizer
+}
+
+func (o hostOptimizer) OptimizeCPU(ctx context.Context) error    { return o.optimizer.Analyze(ctx) }
+func (o hostOptimizer) OptimizeMemory(ctx context.Context) error { return o.optimizer.Analyze(ctx) }
+func (o hostOptimizer) OptimizeDisk(ctx context.Context) error   { return o.optimizer.Analyze(ctx) }
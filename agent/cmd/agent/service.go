@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"text/template"
+)
+
+// serviceName names the generated unit and launchd label
+const serviceName = "shh-agent"
+
+var systemdUnit = template.Must(template.New("systemd").Parse(`[Unit]
+Description=SHH agent
+Wants=network-online.target
+After=network-online.target docker.service
+
+[Service]
+Type=notify
+NotifyAccess=main
+WatchdogSec=5min
+ExecStart={{.Binary}} run
+ExecReload=/bin/kill -HUP $MAINPID
+ExecStop={{.Binary}} run --stop
+Restart=on-failure
+RestartSec=5s
+{{- if .User}}
+User={{.User}}
+{{- end}}
+{{- if .ConfigDir}}
+WorkingDirectory={{.ConfigDir}}
+{{- end}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+var launchdPlist = template.Must(template.New("launchd").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>com.{{.Name}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{.Binary}}</string>
+		<string>run</string>
+	</array>
+{{- if .User}}
+	<key>UserName</key>
+	<string>{{.User}}</string>
+{{- end}}
+{{- if .ConfigDir}}
+	<key>WorkingDirectory</key>
+	<string>{{.ConfigDir}}</string>
+{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardErrorPath</key>
+	<string>/var/log/{{.Name}}.err</string>
+</dict>
+</plist>
+`))
+
+var windowsScript = template.Must(template.New("windows").Parse(`sc.exe create {{.Name}} binPath= "\"{{.Binary}}\" run" start= delayed-auto DisplayName= "SHH agent"
+sc.exe description {{.Name}} "SHH agent"
+sc.exe failure {{.Name}} reset= 86400 actions= restart/5000/restart/5000/restart/60000
+`))
+
+// serviceSpec fills the service templates
+type serviceSpec struct {
+	Name      string
+	Binary    string
+	User      string
+	ConfigDir string
+}
+
+func runInstallService(args []string) int {
+	fs := flag.NewFlagSet("install-service", flag.ExitOnError)
+	kind := fs.String("type", defaultServiceType(), "service manager: systemd, launchd or windows")
+	binary := fs.String("binary", "", "agent binary path (default: this executable)")
+	user := fs.String("user", "", "user to run the agent as (default: root)")
+	configDir := fs.String("config-dir", "", "working directory, searched for config.yaml")
+	output := fs.String("output", "-", "file to write, or - for standard output")
+	fs.Parse(args)
+
+	spec := serviceSpec{Name: serviceName, Binary: *binary, User: *user, ConfigDir: *configDir}
+	if spec.Binary == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to find agent binary: %v\n", err)
+			return 1
+		}
+		spec.Binary = exe
+	}
+
+	var tmpl *template.Template
+	var hint string
+	switch *kind {
+	case "systemd":
+		tmpl = systemdUnit
+		hint = "Install as /etc/systemd/system/" + serviceName + ".service, then run: " +
+			"systemctl daemon-reload && systemctl enable --now " + serviceName
+	case "launchd":
+		tmpl = launchdPlist
+		path := "/Library/LaunchDaemons/com." + serviceName + ".plist"
+		hint = "Install as " + path + ", then run: launchctl load -w " + path
+	case "windows":
+		tmpl = windowsScript
+		hint = "Run these commands as administrator, then: sc.exe start " + serviceName
+	default:
+		fmt.Fprintf(os.Stderr, "Unsupported service type %q\n", *kind)
+		return 2
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", *output, err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := tmpl.Execute(w, spec); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write service definition: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, hint)
+	return 0
+}
+
+func defaultServiceType() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "launchd"
+	case "windows":
+		return "windows"
+	}
+	return "systemd"
+}
@@ -0,0 +1,30 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// cbreakTerminal makes the terminal on fd pass keys as they are typed,
+// without echoing them, and returns a function restoring it
+func cbreakTerminal(fd int) (func(), error) {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	saved := *termios
+	termios.Lflag &^= unix.ICANON | unix.ECHO
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, termios); err != nil {
+		return nil, err
+	}
+	return func() { unix.IoctlSetTermios(fd, unix.TCSETS, &saved) }, nil
+}
+
+// terminalSize returns the columns and rows of the terminal on fd, 80x24
+// when it isn't one
+func terminalSize(fd int) (int, int) {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
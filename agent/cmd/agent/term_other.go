@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// cbreakTerminal is only supported on Linux
+func cbreakTerminal(fd int) (func(), error) {
+	return nil, errors.New("not supported on this platform")
+}
+
+// terminalSize returns 80x24 where the size can't be read
+func terminalSize(fd int) (int, int) {
+	return 80, 24
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"shh/agent/internal/config"
+	"shh/agent/internal/metrics"
+	"shh/agent/internal/process"
+	"shh/agent/internal/web"
+)
+
+const (
+	// topMaxContainers and topMaxEvents bound their sections, leaving
+	// the rest of the screen to processes
+	topMaxContainers = 8
+	topMaxEvents     = 6
+	topMinProcesses  = 5
+)
+
+// container is what top shows of a Docker container
+type container struct {
+	Names  []string `json:"Names"`
+	Image  string   `json:"Image"`
+	State  string   `json:"State"`
+	Status string   `json:"Status"`
+}
+
+// topSnapshot is what one refresh fetched from the local API
+type topSnapshot struct {
+	status     web.Status
+	metrics    *metrics.SystemMetrics
+	processes  []process.ProcessInfo
+	containers []container
+	health     []web.HealthCheck
+	events     []web.Event
+	err        error
+}
+
+// apiTokenFile is where the agent keeps the token of its local API, in
+// the data directory
+func apiTokenFile(cfg *config.Config) string {
+	return filepath.Join(cfg.Agent.DataDir, "api.token")
+}
+
+// apiClient is a client of the local API, authenticated with the agent's
+// token
+type apiClient struct {
+	client *http.Client
+	base   string
+	token  string
+}
+
+// newAPIClient creates a client of the API at addr, or api.listen without
+// one. The token is read from the agent's data directory unless given.
+func newAPIClient(addr, token string) (*apiClient, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if addr == "" {
+		addr = cfg.API.Listen
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("the local API is disabled; set api.listen or pass -addr")
+	}
+	if token == "" {
+		if token, err = web.ReadToken(apiTokenFile(cfg)); err != nil {
+			return nil, fmt.Errorf("failed to read the API token, which only the agent's user can: %w", err)
+		}
+	}
+
+	c := &apiClient{client: &http.Client{Timeout: 5 * time.Second}, base: "http://" + addr, token: token}
+	// The API's own certificate is trusted, since it is usually self-signed
+	if cfg.API.TLS.Cert != "" {
+		pem, err := os.ReadFile(cfg.API.TLS.Cert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API certificate: %w", err)
+		}
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(pem)
+		c.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+		c.base = "https://" + addr
+	}
+	return c, nil
+}
+
+// runTop shows the local agent's metrics, processes, containers, health
+// checks and recent events until q or Ctrl-C
+func runTop(args []string) int {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	addr := fs.String("addr", "", "local API address; defaults to api.listen")
+	token := fs.String("token", "", "API token; defaults to the agent's")
+	interval := fs.Duration("interval", 2*time.Second, "refresh interval")
+	fs.Parse(args)
+
+	client, err := newAPIClient(*addr, *token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if *interval < 500*time.Millisecond {
+		*interval = 500 * time.Millisecond
+	}
+
+	// Keys are read one at a time where the terminal allows it; elsewhere
+	// top only quits on Ctrl-C
+	keys := make(chan byte, 1)
+	if restore, err := cbreakTerminal(int(os.Stdin.Fd())); err == nil {
+		defer restore()
+		go func() {
+			buf := make([]byte, 1)
+			for {
+				if n, err := os.Stdin.Read(buf); err != nil || n == 0 {
+					return
+				}
+				keys <- buf[0]
+			}
+		}()
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// Use the alternate screen and hide the cursor while running
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	sortBy := "cpu"
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		width, height := terminalSize(int(os.Stdout.Fd()))
+		snap := fetchTop(client)
+		fmt.Print("\x1b[H\x1b[2J" + renderTop(snap, client.base, sortBy, width, height))
+
+		select {
+		case <-signals:
+			return 0
+		case key := <-keys:
+			switch key {
+			case 'q', 'Q':
+				return 0
+			case 'c':
+				sortBy = "cpu"
+			case 'm':
+				sortBy = "memory"
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchTop reads everything top shows from the local API
+func fetchTop(client *apiClient) topSnapshot {
+	var snap topSnapshot
+	// Only the status is required; sections the agent can't provide, such
+	// as containers without Docker, are left empty
+	get := func(path string, v interface{}) {
+		if snap.err != nil {
+			return
+		}
+		if err := client.getJSON(path, v); err != nil && path == "/api/status" {
+			snap.err = err
+		}
+	}
+	get("/api/status", &snap.status)
+	get("/api/metrics", &snap.metrics)
+	get("/api/processes", &snap.processes)
+	get("/api/containers", &snap.containers)
+	get("/api/health", &snap.health)
+	get("/api/events", &snap.events)
+	return snap
+}
+
+// getJSON decodes the JSON response to a GET of path into v
+func (c *apiClient) getJSON(path string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.client.Timeout)
+	defer cancel()
+	url := c.base + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
+
+// renderTop lays the snapshot out on a width x height screen
+func renderTop(snap topSnapshot, addr, sortBy string, width, height int) string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	if snap.err != nil {
+		add("Failed to reach the agent at %s: %v", addr, snap.err)
+		add("Retrying; q quits")
+		return fitScreen(lines, width, height)
+	}
+
+	s := snap.status
+	server := "disconnected"
+	switch {
+	case s.Offline:
+		server = "offline"
+	case s.Connected:
+		server = "connected"
+	}
+	add("shh-agent %s on %s  %s  up %s  health %s  server %s",
+		s.AgentID, s.Hostname, s.Version, time.Since(s.Started).Round(time.Second), s.Health, server)
+	if m := snap.metrics; m != nil {
+		add("CPU %5.1f%%  load %.2f %.2f %.2f  mem %s/%s  disk %s/%s",
+			m.CPUUsage, m.LoadAverage[0], m.LoadAverage[1], m.LoadAverage[2],
+			formatBytes(m.MemoryUsed), formatBytes(m.MemoryTotal),
+			formatBytes(m.DiskUsed), formatBytes(m.DiskTotal))
+	} else {
+		add("Metrics not collected yet")
+	}
+
+	add("")
+	add("HEALTH")
+	for _, c := range snap.health {
+		detail := c.Message
+		if c.Error != "" {
+			detail = c.Error
+		}
+		add("  %-10s %-20s %s", c.Status, c.Name, detail)
+	}
+
+	var containers []string
+	if len(snap.containers) > 0 {
+		containers = append(containers, "", "CONTAINERS")
+		for i, c := range snap.containers {
+			if i == topMaxContainers {
+				containers = append(containers, fmt.Sprintf("  ... %d more", len(snap.containers)-i))
+				break
+			}
+			name := ""
+			if len(c.Names) > 0 {
+				name = strings.TrimPrefix(c.Names[0], "/")
+			}
+			containers = append(containers, fmt.Sprintf("  %-24s %-10s %-20s %s", name, c.State, c.Status, c.Image))
+		}
+	}
+
+	var recent []string
+	if len(snap.events) > 0 {
+		recent = append(recent, "", "EVENTS")
+		for i, e := range snap.events {
+			if i == topMaxEvents {
+				break
+			}
+			data, _ := json.Marshal(e.Data)
+			recent = append(recent, fmt.Sprintf("  %s %-12s %s", e.Timestamp.Local().Format("15:04:05"), e.Topic, data))
+		}
+	}
+
+	// Processes get what the other sections leave
+	rows := height - len(lines) - len(containers) - len(recent) - 4
+	if rows < topMinProcesses {
+		rows = topMinProcesses
+	}
+	processes := snap.processes
+	sort.Slice(processes, func(i, j int) bool {
+		if sortBy == "memory" {
+			return processes[i].RSS > processes[j].RSS
+		}
+		return processes[i].CPU > processes[j].CPU
+	})
+	add("")
+	add("PROCESSES by %s (c: cpu, m: memory, q: quit)", sortBy)
+	add("  %7s %-10s %6s %6s %8s  %s", "PID", "USER", "CPU%", "MEM%", "RSS", "COMMAND")
+	for i, p := range processes {
+		if i == rows {
+			break
+		}
+		command := p.CmdLine
+		if command == "" {
+			command = p.Name
+		}
+		add("  %7d %-10.10s %6.1f %6.1f %8s  %s", p.PID, p.Username, p.CPU, p.Memory, formatBytes(p.RSS), command)
+	}
+
+	lines = append(lines, containers...)
+	lines = append(lines, recent...)
+	return fitScreen(lines, width, height)
+}
+
+// fitScreen cuts lines to the screen
+func fitScreen(lines []string, width, height int) string {
+	if len(lines) > height-1 {
+		lines = lines[:height-1]
+	}
+	for i, line := range lines {
+		if r := []rune(line); len(r) > width {
+			lines[i] = string(r[:width])
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// formatBytes formats n in binary units
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// runAsService reports that the agent isn't run by a Windows service
+// manager
+func runAsService(args []string) (int, bool) {
+	return 0, false
+}
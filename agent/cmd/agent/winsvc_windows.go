@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// windowsService runs the agent under the Windows service control manager
+type windowsService struct {
+	args []string
+	code int
+}
+
+// runAsService runs the agent as a Windows service when started by the
+// service control manager, reporting whether it did
+func runAsService(args []string) (int, bool) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to detect service mode: %v\n", err)
+		return 1, true
+	}
+	if !isService {
+		return 0, false
+	}
+	s := &windowsService{args: args}
+	if err := svc.Run(serviceName, s); err != nil {
+		return 1, true
+	}
+	return s.code, true
+}
+
+// Execute implements svc.Handler
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
+	status <- svc.Status{State: svc.StartPending}
+
+	done := make(chan int, 1)
+	go func() {
+		done <- runAgent(s.args)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case s.code = <-done:
+			status <- svc.Status{State: svc.StopPending}
+			return false, uint32(s.code)
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				control.Stop()
+			case svc.Pause:
+				status <- svc.Status{State: svc.PausePending, Accepts: accepted}
+				if err := control.Pause(); err != nil {
+					status <- svc.Status{State: svc.Running, Accepts: accepted}
+					continue
+				}
+				status <- svc.Status{State: svc.Paused, Accepts: accepted}
+			case svc.Continue:
+				status <- svc.Status{State: svc.ContinuePending, Accepts: accepted}
+				if err := control.Resume(); err != nil {
+					status <- svc.Status{State: svc.Paused, Accepts: accepted}
+					continue
+				}
+				status <- svc.Status{State: svc.Running, Accepts: accepted}
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package authz decides which commands the server may run on the agent,
+// by the tenant and role claims carried with each command. Roles map to
+// the command prefixes they allow, so a read-only role can never run
+// processes or change the host. A prefix ending in a colon allows every
+// command below it; any other prefix allows the command it names and the
+// commands below that, so security:mac doesn't allow security:mac_mode.
+package authz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"shh/agent/internal/protocol"
+)
+
+// Wildcard allows every command
+const Wildcard = "*"
+
+// ExecPrefix prefixes the commands run as processes, which have no
+// component prefix of their own
+const ExecPrefix = "exec:"
+
+// Built-in roles
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleReadOnly = "read-only"
+)
+
+// DefaultRoles are the built-in roles. Operators manage the agent's
+// components but can't run processes, load plugins, rotate keys, render
+// configs or weaken the host's security, e.g. by switching its MAC mode;
+// read-only users only query.
+var DefaultRoles = map[string][]string{
+	RoleAdmin: {Wildcard},
+	RoleOperator: {
+		"docker:", "maintenance:", "fim:", "inventory:", "system:",
+		"security:benchmark", "security:profiles", "security:indicators", "security:secrets",
+		"security:scan", "security:scan_history", "security:scan_jobs",
+		"security:logins", "security:mac",
+		"resolver:", "optimizer:", "net:", "profiler:", "deadletters:",
+		"config:drift", "changes:", "plugins:list",
+		"sshkeys:inventory", "sshkeys:drift", "sshkeys:rotations",
+	},
+	RoleReadOnly: {
+		"docker:containers", "docker:stats", "docker:container:logs", "docker:container:diff",
+		"docker:compose:drift",
+		"maintenance:status", "fim:status", "inventory:get", "system:inventory", "system:info",
+		"security:scan_history", "security:scan_jobs", "security:profiles", "security:logins",
+		"resolver:problems", "resolver:runbooks",
+		"optimizer:history", "optimizer:pending", "optimizer:report",
+		"deadletters:list", "config:drift", "changes:export", "plugins:list",
+		"sshkeys:inventory", "sshkeys:drift", "sshkeys:rotations",
+	},
+}
+
+// Config is the authorization policy of the agent
+type Config struct {
+	// Tenant is the tenant the agent belongs to. Commands claiming
+	// another tenant or none are refused; empty accepts any tenant.
+	Tenant string
+	// Roles add to or replace DefaultRoles
+	Roles map[string][]string
+	// DefaultRoles apply to commands without role claims. Nil grants
+	// RoleAdmin, so that servers sending no claims keep working; an empty
+	// list refuses such commands.
+	DefaultRoles []string
+}
+
+// Denied is the error of a command the claims don't allow
+type Denied struct {
+	Command string
+	Tenant  string
+	Roles   []string
+	Reason  string
+}
+
+func (e *Denied) Error() string {
+	return fmt.Sprintf("command %s not authorized: %s", e.Command, e.Reason)
+}
+
+// ErrorCode classifies the error for results sent to the server
+func (e *Denied) ErrorCode() protocol.ErrorCode {
+	return protocol.ErrorPermission
+}
+
+// Authorizer checks commands against the policy
+type Authorizer struct {
+	mu       sync.RWMutex
+	tenant   string
+	roles    map[string][]string
+	defaults []string
+}
+
+// New creates an authorizer enforcing cfg
+func New(cfg Config) *Authorizer {
+	a := &Authorizer{}
+	a.Set(cfg)
+	return a
+}
+
+// Set replaces the policy
+func (a *Authorizer) Set(cfg Config) {
+	roles := make(map[string][]string, len(DefaultRoles)+len(cfg.Roles))
+	for role, prefixes := range DefaultRoles {
+		roles[role] = prefixes
+	}
+	for role, prefixes := range cfg.Roles {
+		roles[role] = append([]string(nil), prefixes...)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tenant = cfg.Tenant
+	a.roles = roles
+	a.defaults = []string{RoleAdmin}
+	if cfg.DefaultRoles != nil {
+		a.defaults = append([]string{}, cfg.DefaultRoles...)
+	}
+}
+
+// Tenant returns the tenant the agent belongs to
+func (a *Authorizer) Tenant() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.tenant
+}
+
+// Roles returns the roles and the command prefixes they allow
+func (a *Authorizer) Roles() map[string][]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	roles := make(map[string][]string, len(a.roles))
+	for role, prefixes := range a.roles {
+		roles[role] = append([]string(nil), prefixes...)
+	}
+	return roles
+}
+
+// Authorize returns a *Denied error unless the claims of cmd allow
+// running name, the command as the handlers see it: cmd.Command for
+// component commands and ExecPrefix+cmd.Command for processes
+func (a *Authorizer) Authorize(name string, cmd protocol.AgentCommand) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.tenant != "" && cmd.Tenant == "" {
+		return &Denied{Command: name, Roles: cmd.Roles, Reason: "no tenant claimed"}
+	}
+	if a.tenant != "" && cmd.Tenant != a.tenant {
+		return &Denied{Command: name, Tenant: cmd.Tenant, Roles: cmd.Roles, Reason: "agent belongs to another tenant"}
+	}
+	roles := cmd.Roles
+	if len(roles) == 0 {
+		roles = a.defaults
+	}
+	if len(roles) == 0 {
+		return &Denied{Command: name, Tenant: cmd.Tenant, Reason: "no role claimed"}
+	}
+	for _, role := range roles {
+		if allows(a.roles[role], name) {
+			return nil
+		}
+	}
+	return &Denied{
+		Command: name,
+		Tenant:  cmd.Tenant,
+		Roles:   roles,
+		Reason:  fmt.Sprintf("not allowed for roles %s", strings.Join(sortedCopy(roles), ", ")),
+	}
+}
+
+// allows reports whether a prefix allows name
+func allows(prefixes []string, name string) bool {
+	for _, prefix := range prefixes {
+		switch {
+		case prefix == Wildcard, name == prefix:
+			return true
+		case strings.HasSuffix(prefix, ":") && strings.HasPrefix(name, prefix):
+			return true
+		case strings.HasPrefix(name, prefix+":"):
+			return true
+		}
+	}
+	return false
+}
+
+func sortedCopy(list []string) []string {
+	sorted := append([]string(nil), list...)
+	sort.Strings(sorted)
+	return sorted
+}
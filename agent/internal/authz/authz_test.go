@@ -0,0 +1,62 @@
+package authz
+
+import (
+	"errors"
+	"testing"
+
+	"shh/agent/internal/protocol"
+)
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		command string
+		tenant  string
+		roles   []string
+		allowed bool
+	}{
+		{"admin runs anything", Config{}, "exec:rm", "", []string{RoleAdmin}, true},
+		{"no claims default to admin", Config{}, "plugins:load", "", nil, true},
+		{"no claims refused", Config{DefaultRoles: []string{}}, "docker:containers", "", nil, false},
+		{"unknown role", Config{}, "docker:containers", "", []string{"guest"}, false},
+
+		{"same tenant", Config{Tenant: "acme"}, "docker:containers", "acme", []string{RoleReadOnly}, true},
+		{"other tenant", Config{Tenant: "acme"}, "docker:containers", "globex", []string{RoleAdmin}, false},
+		{"empty tenant", Config{Tenant: "acme"}, "docker:containers", "", []string{RoleAdmin}, false},
+		{"agent without tenant", Config{}, "docker:containers", "globex", []string{RoleReadOnly}, true},
+
+		{"colon prefix", Config{}, "docker:container:restart", "", []string{RoleOperator}, true},
+		{"exact command", Config{}, "security:mac", "", []string{RoleOperator}, true},
+		{"subcommand", Config{}, "docker:container:logs:tail", "", []string{RoleReadOnly}, true},
+		{"longer name is not a subcommand", Config{}, "security:mac_mode", "", []string{RoleOperator}, false},
+		{"read-only can't write", Config{}, "docker:container:restart", "", []string{RoleReadOnly}, false},
+		{"operator can't run processes", Config{}, ExecPrefix + "sh", "", []string{RoleOperator}, false},
+		{"operator can't render configs", Config{}, "config:template", "", []string{RoleOperator}, false},
+		{"operator can't set config actions", Config{}, "config:action:set", "", []string{RoleOperator}, false},
+		{"operator can't set key policies", Config{}, "sshkeys:policy", "", []string{RoleOperator}, false},
+		{"any role allowing wins", Config{}, "fim:accept", "", []string{RoleReadOnly, RoleOperator}, true},
+
+		{"custom role", Config{Roles: map[string][]string{"dba": {"exec:psql"}}}, "exec:psql", "", []string{"dba"}, true},
+		{"custom role prefix", Config{Roles: map[string][]string{"dba": {"exec:psql"}}}, "exec:psqlx", "", []string{"dba"}, false},
+		{"replaced role", Config{Roles: map[string][]string{RoleOperator: {"fim:"}}}, "docker:stats", "", []string{RoleOperator}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New(tt.cfg).Authorize(tt.command, protocol.AgentCommand{Command: tt.command, Tenant: tt.tenant, Roles: tt.roles})
+			if tt.allowed {
+				if err != nil {
+					t.Fatalf("denied: %v", err)
+				}
+				return
+			}
+			var denied *Denied
+			if !errors.As(err, &denied) {
+				t.Fatalf("got %v, want *Denied", err)
+			}
+			if denied.ErrorCode() != protocol.ErrorPermission {
+				t.Errorf("error code = %s, want %s", denied.ErrorCode(), protocol.ErrorPermission)
+			}
+		})
+	}
+}
@@ -9,12 +9,15 @@ import (
 	"time"
 
 	"go.uber.org/zap"
+
+	"shh/agent/internal/tasks"
 )
 
 type Manager struct {
 	config   *BackupConfig
 	logger   *zap.Logger
 	archiver *Archiver
+	tasks    *tasks.Registry
 }
 
 func NewManager(config *BackupConfig, logger *zap.Logger) (*Manager, error) {
@@ -31,6 +34,11 @@ func NewManager(config *BackupConfig, logger *zap.Logger) (*Manager, error) {
 	}, nil
 }
 
+// SetTasks reports backups and restores as tasks in registry
+func (m *Manager) SetTasks(registry *tasks.Registry) {
+	m.tasks = registry
+}
+
 func (m *Manager) Start(ctx context.Context) error {
 	// Create backup directory if it doesn't exist
 	if err := os.MkdirAll(m.config.Path, 0755); err != nil {
@@ -47,8 +55,11 @@ func (m *Manager) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-func (m *Manager) CreateBackup(ctx context.Context, source string) error {
+func (m *Manager) CreateBackup(ctx context.Context, source string) (err error) {
 	backupPath := filepath.Join(m.config.Path, fmt.Sprintf("backup_%s.tar.gz", time.Now().Format("20060102_150405")))
+	task := m.tasks.Start("", "backup", source)
+	task.SetDetail("archive", backupPath)
+	defer func() { task.Finish(err) }()
 
 	// Create new archive
 	if err := m.archiver.Create(backupPath); err != nil {
@@ -87,7 +98,11 @@ func (m *Manager) CreateBackup(ctx context.Context, source string) error {
 	return nil
 }
 
-func (m *Manager) RestoreBackup(ctx context.Context, backupFile string, destination string) error {
+func (m *Manager) RestoreBackup(ctx context.Context, backupFile string, destination string) (err error) {
+	task := m.tasks.Start("", "restore", backupFile)
+	task.SetDetail("destination", destination)
+	defer func() { task.Finish(err) }()
+
 	if m.config.Encrypt {
 		// In a real implementation, you would get this from a secure key management system
 		key := []byte("0123456789abcdef0123456789abcdef")
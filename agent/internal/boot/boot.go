@@ -0,0 +1,241 @@
+// Package boot tracks the boots of the host. The agent records the boot
+// it runs on in the data directory; starting on another boot reports a
+// reboot with its downtime, and whether it was unexpected because the
+// agent never shut down cleanly.
+package boot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/protocol"
+)
+
+const (
+	// stateFile is the record of the last boot in the data directory
+	stateFile = "boot.json"
+	// DefaultSaveInterval is how often the agent records that it still
+	// runs, bounding the error of the downtime of unexpected reboots
+	DefaultSaveInterval = time.Minute
+	// bootIDPath holds the random ID the Linux kernel picks every boot
+	bootIDPath = "/proc/sys/kernel/random/boot_id"
+)
+
+// state is the persisted record of the boot the agent last ran on
+type state struct {
+	BootID   string    `json:"boot_id"`
+	BootTime time.Time `json:"boot_time"`
+	Kernel   string    `json:"kernel"`
+	LastSeen time.Time `json:"last_seen"`
+	// Running is cleared when the agent shuts down cleanly
+	Running bool `json:"running"`
+}
+
+// Tracker detects reboots and kernel changes
+type Tracker struct {
+	logger *zap.Logger
+	path   string
+	events chan<- interface{}
+
+	mu      sync.RWMutex
+	current state
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewTracker creates a tracker keeping its record in dataDir and
+// publishing reboots to events
+func NewTracker(logger *zap.Logger, dataDir string, events chan<- interface{}) *Tracker {
+	return &Tracker{
+		logger: logger,
+		path:   filepath.Join(dataDir, stateFile),
+		events: events,
+	}
+}
+
+// Start compares the current boot with the recorded one, reports a
+// reboot if they differ, and records that the agent runs until Shutdown
+func (t *Tracker) Start(ctx context.Context) error {
+	current, err := currentBoot()
+	if err != nil {
+		return err
+	}
+	previous, err := t.load()
+	if err != nil {
+		t.logger.Warn("Failed to read the last boot, not reporting reboots", zap.Error(err))
+	} else if previous != nil && previous.BootID != current.BootID {
+		t.report(*previous, current)
+	}
+
+	current.Running = true
+	current.LastSeen = time.Now()
+	t.mu.Lock()
+	t.current = current
+	t.mu.Unlock()
+	if err := t.save(); err != nil {
+		return err
+	}
+
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.done = make(chan struct{})
+	crash.Go("boot", func() {
+		defer close(t.done)
+		ticker := time.NewTicker(DefaultSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			t.mu.Lock()
+			t.current.LastSeen = time.Now()
+			t.mu.Unlock()
+			if err := t.save(); err != nil {
+				t.logger.Warn("Failed to record boot", zap.Error(err))
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown records a clean shutdown, so that the next boot isn't
+// reported as unexpected
+func (t *Tracker) Shutdown(ctx context.Context) error {
+	if t.cancel == nil {
+		return nil
+	}
+	t.cancel()
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	t.mu.Lock()
+	t.current.Running = false
+	t.current.LastSeen = time.Now()
+	t.mu.Unlock()
+	return t.save()
+}
+
+// Info describes the current boot, nil before Start
+func (t *Tracker) Info() *protocol.BootInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.current.BootID == "" {
+		return nil
+	}
+	return &protocol.BootInfo{
+		BootID:   t.current.BootID,
+		BootTime: t.current.BootTime,
+		Kernel:   t.current.Kernel,
+		Uptime:   time.Since(t.current.BootTime).Seconds(),
+	}
+}
+
+// report publishes the reboot from previous to current
+func (t *Tracker) report(previous, current state) {
+	reboot := protocol.Reboot{
+		BootID:         current.BootID,
+		PreviousBootID: previous.BootID,
+		BootTime:       current.BootTime,
+		LastSeen:       previous.LastSeen,
+		Unexpected:     previous.Running,
+		Kernel:         current.Kernel,
+		PreviousKernel: previous.Kernel,
+		KernelChanged:  previous.Kernel != "" && previous.Kernel != current.Kernel,
+		Timestamp:      time.Now(),
+	}
+	if !previous.LastSeen.IsZero() && current.BootTime.After(previous.LastSeen) {
+		reboot.Downtime = current.BootTime.Sub(previous.LastSeen).Seconds()
+	}
+
+	log := t.logger.Info
+	if reboot.Unexpected {
+		log = t.logger.Warn
+	}
+	log("Host rebooted",
+		zap.Bool("unexpected", reboot.Unexpected),
+		zap.Duration("downtime", time.Duration(reboot.Downtime*float64(time.Second))),
+		zap.String("kernel", reboot.Kernel),
+		zap.Bool("kernel_changed", reboot.KernelChanged))
+
+	if t.events == nil {
+		return
+	}
+	select {
+	case t.events <- reboot:
+	default:
+		t.logger.Warn("Failed to send reboot: channel full")
+	}
+}
+
+// load reads the recorded boot, nil if there is none
+func (t *Tracker) load() (*state, error) {
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boot record: %w", err)
+	}
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse boot record: %w", err)
+	}
+	return &s, nil
+}
+
+// save writes the current boot atomically
+func (t *Tracker) save() error {
+	t.mu.RLock()
+	data, err := json.Marshal(t.current)
+	t.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal boot record: %w", err)
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write boot record: %w", err)
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write boot record: %w", err)
+	}
+	return nil
+}
+
+// currentBoot identifies the running boot. Without a kernel boot ID the
+// boot time stands in for it.
+func currentBoot() (state, error) {
+	bootTime, err := host.BootTime()
+	if err != nil {
+		return state{}, fmt.Errorf("failed to get boot time: %w", err)
+	}
+	kernel, err := host.KernelVersion()
+	if err != nil {
+		return state{}, fmt.Errorf("failed to get kernel version: %w", err)
+	}
+	s := state{
+		BootID:   fmt.Sprintf("boot-%d", bootTime),
+		BootTime: time.Unix(int64(bootTime), 0),
+		Kernel:   kernel,
+	}
+	if data, err := os.ReadFile(bootIDPath); err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			s.BootID = id
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,252 @@
+// Package budget keeps the agent within CPU and memory budgets, so that
+// monitoring never competes with the workloads it monitors
+package budget
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+)
+
+const (
+	// sampleInterval is how often the agent's own usage is measured
+	sampleInterval = 5 * time.Second
+	// maxThrottle is the most collectors are slowed down by
+	maxThrottle = 4.0
+	// throttleStep is the smallest throttle change passed on, so that
+	// collectors aren't retuned on every sample
+	throttleStep = 0.25
+)
+
+// Config sets the budgets
+type Config struct {
+	// MaxProcs caps GOMAXPROCS; 0 derives it from CPUPercent and the
+	// CPU quota of the agent's cgroup
+	MaxProcs int
+	// CPUPercent is the CPU budget in percent of one core; 0 disables it
+	CPUPercent float64
+	// MemoryLimit is the memory budget in bytes, also set as the Go
+	// runtime's soft memory limit; 0 disables it
+	MemoryLimit int64
+	// Cgroup is a cgroup v2 path, relative to the cgroup root, the agent
+	// moves itself into with the budgets as limits. Linux only.
+	Cgroup string
+	// ThrottleAt is the fraction of a budget at which collectors are
+	// slowed down
+	ThrottleAt float64
+}
+
+// Throttled is slowed down when the agent approaches its budgets. A
+// factor of 1 runs at the configured pace, 2 at half of it.
+type Throttled interface {
+	SetThrottle(factor float64)
+}
+
+// Usage is the agent's measured resource usage
+type Usage struct {
+	CPUPercent  float64 `json:"cpu_percent"`
+	MemoryBytes uint64  `json:"memory_bytes"`
+	// Pressure is the usage of the tightest budget, 1 when at the budget
+	Pressure float64 `json:"pressure"`
+	Throttle float64 `json:"throttle"`
+}
+
+// Governor applies the budgets and throttles collectors as the agent
+// approaches them
+type Governor struct {
+	logger  *zap.Logger
+	config  Config
+	self    *process.Process
+	mu      sync.RWMutex
+	targets []Throttled
+	usage   Usage
+	lastCPU float64
+	lastAt  time.Time
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewGovernor creates a governor for the agent process
+func NewGovernor(logger *zap.Logger, config Config) (*Governor, error) {
+	self, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect agent process: %w", err)
+	}
+	if config.ThrottleAt <= 0 || config.ThrottleAt >= 1 {
+		config.ThrottleAt = 0.8
+	}
+	return &Governor{
+		logger: logger,
+		config: config,
+		self:   self,
+		usage:  Usage{Throttle: 1},
+	}, nil
+}
+
+// Apply sets GOMAXPROCS and the Go memory limit, and moves the agent into
+// its cgroup if one is configured
+func (g *Governor) Apply() error {
+	procs := g.config.MaxProcs
+	if procs <= 0 {
+		procs = runtime.NumCPU()
+		if g.config.CPUPercent > 0 {
+			procs = min(procs, int(math.Ceil(g.config.CPUPercent/100)))
+		}
+		if quota, ok := cgroupCPUQuota(); ok {
+			procs = min(procs, int(math.Ceil(quota)))
+		}
+	}
+	procs = max(procs, 1)
+	runtime.GOMAXPROCS(procs)
+
+	if g.config.MemoryLimit > 0 {
+		debug.SetMemoryLimit(g.config.MemoryLimit)
+	}
+	g.logger.Info("Resource budgets applied",
+		zap.Int("gomaxprocs", procs),
+		zap.Float64("cpu_percent", g.config.CPUPercent),
+		zap.Int64("memory_limit", g.config.MemoryLimit))
+
+	if g.config.Cgroup != "" {
+		if err := placeInCgroup(g.config.Cgroup, g.config.CPUPercent, g.config.MemoryLimit); err != nil {
+			return fmt.Errorf("failed to move agent into cgroup %s: %w", g.config.Cgroup, err)
+		}
+		g.logger.Info("Agent moved into cgroup", zap.String("cgroup", g.config.Cgroup))
+	}
+	return nil
+}
+
+// Register throttles t along with the other collectors
+func (g *Governor) Register(t Throttled) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.targets = append(g.targets, t)
+}
+
+// Usage returns the latest measurement
+func (g *Governor) Usage() Usage {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.usage
+}
+
+// Start measures the agent's usage until Shutdown
+func (g *Governor) Start(ctx context.Context) error {
+	if g.config.CPUPercent <= 0 && g.config.MemoryLimit <= 0 {
+		return nil
+	}
+	ctx, g.cancel = context.WithCancel(ctx)
+	g.done = make(chan struct{})
+
+	crash.Go("budget", func() {
+		defer close(g.done)
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := g.sample(); err != nil {
+					g.logger.Warn("Failed to measure agent resource usage", zap.Error(err))
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown stops measuring and lifts any throttling
+func (g *Governor) Shutdown(ctx context.Context) error {
+	if g.cancel == nil {
+		return nil
+	}
+	g.cancel()
+	select {
+	case <-g.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	g.setThrottle(1)
+	return nil
+}
+
+// sample measures usage and retunes the collectors
+func (g *Governor) sample() error {
+	times, err := g.self.Times()
+	if err != nil {
+		return fmt.Errorf("failed to read CPU time: %w", err)
+	}
+	mem, err := g.self.MemoryInfo()
+	if err != nil {
+		return fmt.Errorf("failed to read memory usage: %w", err)
+	}
+	now := time.Now()
+	cpuTime := times.User + times.System
+
+	g.mu.Lock()
+	usage := g.usage
+	if !g.lastAt.IsZero() {
+		usage.CPUPercent = (cpuTime - g.lastCPU) / now.Sub(g.lastAt).Seconds() * 100
+	}
+	g.lastCPU, g.lastAt = cpuTime, now
+	usage.MemoryBytes = mem.RSS
+	usage.Pressure = 0
+	if g.config.CPUPercent > 0 {
+		usage.Pressure = usage.CPUPercent / g.config.CPUPercent
+	}
+	if g.config.MemoryLimit > 0 {
+		usage.Pressure = max(usage.Pressure, float64(mem.RSS)/float64(g.config.MemoryLimit))
+	}
+	g.usage = usage
+	g.mu.Unlock()
+
+	g.setThrottle(throttleFor(usage.Pressure, g.config.ThrottleAt))
+	return nil
+}
+
+// throttleFor scales the throttle from 1 at throttleAt up to maxThrottle
+// at the budget, in steps of throttleStep
+func throttleFor(pressure, throttleAt float64) float64 {
+	if pressure <= throttleAt {
+		return 1
+	}
+	over := min((pressure-throttleAt)/(1-throttleAt), 1)
+	factor := 1 + over*(maxThrottle-1)
+	return math.Round(factor/throttleStep) * throttleStep
+}
+
+func (g *Governor) setThrottle(factor float64) {
+	g.mu.Lock()
+	previous := g.usage.Throttle
+	g.usage.Throttle = factor
+	targets := append([]Throttled(nil), g.targets...)
+	usage := g.usage
+	g.mu.Unlock()
+	if factor == previous {
+		return
+	}
+
+	if factor > 1 {
+		g.logger.Warn("Agent near its resource budget, throttling collectors",
+			zap.Float64("throttle", factor),
+			zap.Float64("cpu_percent", usage.CPUPercent),
+			zap.Uint64("memory_bytes", usage.MemoryBytes))
+	} else {
+		g.logger.Info("Agent back within its resource budget")
+	}
+	for _, t := range targets {
+		t.SetThrottle(factor)
+	}
+}
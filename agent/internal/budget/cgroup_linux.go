@@ -0,0 +1,82 @@
+package budget
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+	// cpuPeriod is the cpu.max period, in microseconds
+	cpuPeriod = 100000
+)
+
+// currentCgroup returns the cgroup v2 path of the agent
+func currentCgroup() (string, bool) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// cgroupCPUQuota returns the CPU quota of the agent's cgroup in cores
+func cgroupCPUQuota() (float64, bool) {
+	path, ok := currentCgroup()
+	if !ok {
+		return 0, false
+	}
+	data, err := os.ReadFile(filepath.Join(cgroupRoot, path, "cpu.max"))
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, false
+	}
+	quota, err1 := strconv.ParseFloat(fields[0], 64)
+	period, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil || period <= 0 {
+		return 0, false
+	}
+	return quota / period, true
+}
+
+// placeInCgroup creates a cgroup v2 group limited to the budgets and
+// moves the agent into it. Memory is limited with memory.high, which
+// reclaims rather than kills.
+func placeInCgroup(name string, cpuPercent float64, memoryLimit int64) error {
+	dir := filepath.Join(cgroupRoot, filepath.Clean("/"+name))
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return fmt.Errorf("cgroup v2 is not mounted at %s", cgroupRoot)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// The parent has to delegate the controllers to the new group
+	controllers := filepath.Join(filepath.Dir(dir), "cgroup.subtree_control")
+	if err := os.WriteFile(controllers, []byte("+cpu +memory"), 0644); err != nil {
+		return fmt.Errorf("failed to enable controllers: %w", err)
+	}
+
+	if cpuPercent > 0 {
+		quota := int(cpuPercent / 100 * cpuPeriod)
+		if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(fmt.Sprintf("%d %d", quota, cpuPeriod)), 0644); err != nil {
+			return fmt.Errorf("failed to set CPU limit: %w", err)
+		}
+	}
+	if memoryLimit > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "memory.high"), []byte(strconv.FormatInt(memoryLimit, 10)), 0644); err != nil {
+			return fmt.Errorf("failed to set memory limit: %w", err)
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0644)
+}
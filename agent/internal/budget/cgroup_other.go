@@ -0,0 +1,15 @@
+//go:build !linux
+
+package budget
+
+import "fmt"
+
+// cgroupCPUQuota finds no quota outside Linux
+func cgroupCPUQuota() (float64, bool) {
+	return 0, false
+}
+
+// placeInCgroup is unsupported outside Linux
+func placeInCgroup(name string, cpuPercent float64, memoryLimit int64) error {
+	return fmt.Errorf("cgroups are only supported on Linux")
+}
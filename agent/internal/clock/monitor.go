@@ -0,0 +1,229 @@
+// Package clock monitors the drift of the system clock against NTP
+// servers. A skewed clock breaks the timestamps of the protocol and the
+// correlation of logs across hosts.
+package clock
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/health"
+	"shh/agent/internal/protocol"
+)
+
+// Config sets the servers the clock is measured against and how much
+// drift is tolerated
+type Config struct {
+	Servers   []string
+	Interval  time.Duration
+	Threshold time.Duration
+	Timeout   time.Duration
+}
+
+// DefaultConfig measures against pool.ntp.org every 15 minutes and
+// tolerates half a second of drift
+var DefaultConfig = Config{
+	Servers:   []string{"pool.ntp.org"},
+	Interval:  15 * time.Minute,
+	Threshold: 500 * time.Millisecond,
+	Timeout:   5 * time.Second,
+}
+
+// Monitor measures the clock offset periodically
+type Monitor struct {
+	logger *zap.Logger
+	events chan<- interface{}
+
+	mu     sync.RWMutex
+	config Config
+	last   *protocol.ClockDrift
+	err    error
+	// changed wakes the measuring loop when the config changes
+	changed chan struct{}
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMonitor creates a monitor publishing threshold crossings to events
+func NewMonitor(logger *zap.Logger, events chan<- interface{}) *Monitor {
+	return &Monitor{
+		logger:  logger,
+		events:  events,
+		config:  DefaultConfig,
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Set changes the servers and threshold, measuring again right away.
+// Zero fields take the defaults.
+func (m *Monitor) Set(config Config) {
+	if len(config.Servers) == 0 {
+		config.Servers = DefaultConfig.Servers
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultConfig.Interval
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultConfig.Threshold
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultConfig.Timeout
+	}
+	m.mu.Lock()
+	m.config = config
+	m.mu.Unlock()
+
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Start measures the clock until Shutdown
+func (m *Monitor) Start(ctx context.Context) error {
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	crash.Go("clock-monitor", func() {
+		defer close(m.done)
+		for {
+			m.measure(ctx)
+
+			m.mu.RLock()
+			interval := m.config.Interval
+			m.mu.RUnlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.changed:
+			case <-time.After(interval):
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown stops measuring
+func (m *Monitor) Shutdown(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Last returns the latest measurement, if any
+func (m *Monitor) Last() (protocol.ClockDrift, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.last == nil {
+		return protocol.ClockDrift{}, false
+	}
+	return *m.last, true
+}
+
+// Check reports the clock degraded while its drift exceeds the
+// threshold. Servers being unreachable doesn't degrade it.
+func (m *Monitor) Check(ctx context.Context) *health.CheckResult {
+	m.mu.RLock()
+	last, err := m.last, m.err
+	m.mu.RUnlock()
+
+	result := &health.CheckResult{Status: health.StatusHealthy, Timestamp: time.Now()}
+	switch {
+	case last == nil && err != nil:
+		result.Message = fmt.Sprintf("clock offset unknown: %v", err)
+	case last == nil:
+		result.Message = "clock offset not measured yet"
+	default:
+		result.Metadata = map[string]interface{}{
+			"offset_seconds": last.Offset,
+			"servers":        last.Servers,
+		}
+		if last.Exceeded {
+			result.Status = health.StatusDegraded
+			result.Message = fmt.Sprintf("clock drift %.3fs exceeds %.3fs", last.Offset, last.Threshold)
+		}
+	}
+	return result
+}
+
+// measure queries every server and keeps the median offset, so that one
+// bad server doesn't skew the result
+func (m *Monitor) measure(ctx context.Context) {
+	m.mu.RLock()
+	config := m.config
+	m.mu.RUnlock()
+
+	type sample struct {
+		offset, delay time.Duration
+	}
+	var samples []sample
+	var servers []string
+	var lastErr error
+	for _, server := range config.Servers {
+		offset, delay, err := Query(ctx, server, config.Timeout)
+		if err != nil {
+			m.logger.Debug("NTP query failed", zap.String("server", server), zap.Error(err))
+			lastErr = err
+			continue
+		}
+		samples = append(samples, sample{offset, delay})
+		servers = append(servers, server)
+	}
+	if len(samples) == 0 {
+		m.logger.Warn("Failed to measure clock offset", zap.Error(lastErr))
+		m.mu.Lock()
+		m.err = lastErr
+		m.mu.Unlock()
+		return
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].offset < samples[j].offset })
+	median := samples[len(samples)/2]
+	abs := median.offset
+	if abs < 0 {
+		abs = -abs
+	}
+	drift := protocol.ClockDrift{
+		Offset:    median.offset.Seconds(),
+		Delay:     median.delay.Seconds(),
+		Threshold: config.Threshold.Seconds(),
+		Exceeded:  abs > config.Threshold,
+		Servers:   servers,
+		Timestamp: time.Now(),
+	}
+
+	m.mu.Lock()
+	crossed := (m.last == nil && drift.Exceeded) || (m.last != nil && m.last.Exceeded != drift.Exceeded)
+	m.last = &drift
+	m.err = nil
+	m.mu.Unlock()
+
+	if !crossed {
+		return
+	}
+	if drift.Exceeded {
+		m.logger.Warn("Clock drift exceeds threshold",
+			zap.Duration("offset", median.offset),
+			zap.Duration("threshold", config.Threshold))
+	} else {
+		m.logger.Info("Clock drift back within threshold", zap.Duration("offset", median.offset))
+	}
+	select {
+	case m.events <- drift:
+	default:
+		m.logger.Warn("Failed to send clock drift event: channel full")
+	}
+}
@@ -0,0 +1,85 @@
+package clock
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ntpEpochOffset is the seconds from the NTP epoch, 1900, to the Unix
+// epoch
+const ntpEpochOffset = 2208988800
+
+// Query measures the offset of the local clock against an NTP server
+// with a single SNTP exchange, and the round trip delay. A positive
+// offset means the local clock is behind.
+func Query(ctx context.Context, server string, timeout time.Duration) (offset, delay time.Duration, err error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to connect to %s: %w", server, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Version 3, client mode
+	request := make([]byte, 48)
+	request[0] = 0x1B
+	sent := time.Now()
+	binary.BigEndian.PutUint64(request[40:], toNTP(sent))
+	if _, err := conn.Write(request); err != nil {
+		return 0, 0, fmt.Errorf("failed to query %s: %w", server, err)
+	}
+
+	response := make([]byte, 48)
+	n, err := conn.Read(response)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read from %s: %w", server, err)
+	}
+	// The monotonic clock measures the round trip, so that the local
+	// clock being stepped meanwhile doesn't skew it
+	received := sent.Add(time.Since(sent))
+
+	if n < 48 {
+		return 0, 0, fmt.Errorf("short response from %s", server)
+	}
+	if mode := response[0] & 0x07; mode != 4 {
+		return 0, 0, fmt.Errorf("unexpected mode %d from %s", mode, server)
+	}
+	if stratum := response[1]; stratum == 0 || stratum > 15 {
+		return 0, 0, fmt.Errorf("server %s is unsynchronized (stratum %d)", server, stratum)
+	}
+	if binary.BigEndian.Uint64(response[24:]) != binary.BigEndian.Uint64(request[40:]) {
+		return 0, 0, fmt.Errorf("response from %s doesn't match the request", server)
+	}
+
+	serverReceived := fromNTP(binary.BigEndian.Uint64(response[32:]))
+	serverSent := fromNTP(binary.BigEndian.Uint64(response[40:]))
+	offset = (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	delay = received.Sub(sent) - serverSent.Sub(serverReceived)
+	return offset, delay, nil
+}
+
+// toNTP encodes t as an NTP timestamp: seconds since 1900 and a binary
+// fraction
+func toNTP(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+func fromNTP(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	nanos := (ntp & 0xFFFFFFFF) * uint64(time.Second) >> 32
+	return time.Unix(seconds, int64(nanos))
+}
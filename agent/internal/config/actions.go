@@ -0,0 +1,273 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Action stages
+const (
+	StageValidate = "validate"
+	StageApply    = "apply"
+	StageCheck    = "check"
+	StageDone     = "done"
+)
+
+const (
+	defaultActionTimeout = time.Minute
+	defaultActionSettle  = 5 * time.Second
+	// maxActionOutput bounds the command output kept with a result
+	maxActionOutput = 4096
+	// maxActionResults is how many results are kept
+	maxActionResults = 100
+)
+
+// SetEvents sends the results of config actions to events
+func (m *Manager) SetEvents(events chan<- interface{}) {
+	m.events = events
+}
+
+// SetAction runs action after every change to a managed config. The
+// current content counts as applied.
+func (m *Manager) SetAction(path string, action protocol.ConfigAction) error {
+	if len(action.Apply) == 0 {
+		return fmt.Errorf("an apply command is required")
+	}
+	sum, err := m.calculateChecksum(path)
+	if err != nil {
+		return fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.configs[path]; !ok {
+		return fmt.Errorf("config not found: %s", path)
+	}
+	m.actions[path] = action
+	m.applied[path] = sum
+	m.logger.Info("Config action set",
+		zap.String("path", path),
+		zap.Strings("apply", action.Apply))
+	return nil
+}
+
+// RemoveAction stops running an action after changes to path
+func (m *Manager) RemoveAction(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.actions[path]; !ok {
+		return fmt.Errorf("no action for %s", path)
+	}
+	delete(m.actions, path)
+	delete(m.applied, path)
+	return nil
+}
+
+// Actions returns the actions of all managed configs by path
+func (m *Manager) Actions() map[string]protocol.ConfigAction {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	actions := make(map[string]protocol.ConfigAction, len(m.actions))
+	for path, action := range m.actions {
+		actions[path] = action
+	}
+	return actions
+}
+
+// ActionResults returns the latest action results, oldest first
+func (m *Manager) ActionResults() []protocol.ConfigActionResult {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]protocol.ConfigActionResult(nil), m.actionResults...)
+}
+
+// HandleActionRequest applies a config action request received from the
+// server
+func (m *Manager) HandleActionRequest(req protocol.ConfigActionRequest) (interface{}, error) {
+	switch req.Action {
+	case "set":
+		if req.Config == nil {
+			return nil, fmt.Errorf("an action is required")
+		}
+		return nil, m.SetAction(req.Path, *req.Config)
+	case "remove":
+		return nil, m.RemoveAction(req.Path)
+	case "", "list":
+		return m.Actions(), nil
+	case "results":
+		return m.ActionResults(), nil
+	default:
+		return nil, fmt.Errorf("unknown config action request: %s", req.Action)
+	}
+}
+
+// runAction validates and applies a changed config. If any stage fails
+// the config is rolled back to its previous version, and reapplied if the
+// service may already have loaded the change. Changes already applied,
+// such as the rollback itself, are skipped.
+func (m *Manager) runAction(path string) {
+	m.actionMu.Lock()
+	defer m.actionMu.Unlock()
+
+	sum, err := m.calculateChecksum(path)
+	if err != nil {
+		m.logger.Warn("Failed to checksum changed config", zap.String("path", path), zap.Error(err))
+		return
+	}
+	m.mu.RLock()
+	action, ok := m.actions[path]
+	applied := m.applied[path]
+	m.mu.RUnlock()
+	if !ok || sum == applied {
+		return
+	}
+
+	result := protocol.ConfigActionResult{Path: path, StartedAt: time.Now()}
+	var previous string
+	if versions, err := m.Versions(path, 2); err != nil {
+		m.logger.Warn("Failed to read config history", zap.String("path", path), zap.Error(err))
+	} else {
+		if len(versions) > 0 {
+			result.Commit = versions[0].Commit
+		}
+		if len(versions) > 1 {
+			previous = versions[1].Commit
+		}
+	}
+
+	var output strings.Builder
+	result.Stage, err = runStages(action, &output)
+	if err == nil {
+		result.Stage = StageDone
+		result.Success = true
+		m.setApplied(path, sum)
+	} else {
+		result.Error = err.Error()
+		m.rollbackAction(path, previous, action, &result, &output)
+	}
+	result.Output = truncateOutput(output.String())
+	result.Duration = time.Since(result.StartedAt).Seconds()
+	m.recordAction(result)
+}
+
+// runStages runs the commands of an action, returning the stage reached
+func runStages(action protocol.ConfigAction, output *strings.Builder) (string, error) {
+	timeout := defaultActionTimeout
+	if action.TimeoutSeconds > 0 {
+		timeout = time.Duration(action.TimeoutSeconds) * time.Second
+	}
+	if len(action.Validate) > 0 {
+		if err := runActionCommand(action.Validate, timeout, output); err != nil {
+			return StageValidate, err
+		}
+	}
+	if err := runActionCommand(action.Apply, timeout, output); err != nil {
+		return StageApply, err
+	}
+	if len(action.Check) == 0 {
+		return StageApply, nil
+	}
+	settle := defaultActionSettle
+	if action.SettleSeconds > 0 {
+		settle = time.Duration(action.SettleSeconds) * time.Second
+	}
+	time.Sleep(settle)
+	if err := runActionCommand(action.Check, timeout, output); err != nil {
+		return StageCheck, err
+	}
+	return StageCheck, nil
+}
+
+// rollbackAction restores the previous version of a config whose action
+// failed and reapplies it
+func (m *Manager) rollbackAction(path, previous string, action protocol.ConfigAction, result *protocol.ConfigActionResult, output *strings.Builder) {
+	if previous == "" {
+		result.Error += "; no previous version to roll back to"
+		return
+	}
+	if err := m.RollbackTo(path, previous, defaultAuthor); err != nil {
+		result.Error += "; rollback failed: " + err.Error()
+		return
+	}
+	result.RolledBack = true
+	result.RollbackTo = previous
+	if sum, err := m.calculateChecksum(path); err == nil {
+		m.setApplied(path, sum)
+	}
+
+	// A config rejected by validation never reached the service
+	if result.Stage == StageValidate {
+		return
+	}
+	timeout := defaultActionTimeout
+	if action.TimeoutSeconds > 0 {
+		timeout = time.Duration(action.TimeoutSeconds) * time.Second
+	}
+	if err := runActionCommand(action.Apply, timeout, output); err != nil {
+		result.Error += "; reapplying the previous version failed: " + err.Error()
+	}
+}
+
+func runActionCommand(args []string, timeout time.Duration, output *strings.Builder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	fmt.Fprintf(output, "$ %s\n%s", strings.Join(args, " "), out)
+	if err != nil {
+		return fmt.Errorf("%s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func (m *Manager) setApplied(path, sum string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.actions[path]; ok {
+		m.applied[path] = sum
+	}
+}
+
+func (m *Manager) recordAction(result protocol.ConfigActionResult) {
+	m.mu.Lock()
+	m.actionResults = append(m.actionResults, result)
+	if len(m.actionResults) > maxActionResults {
+		m.actionResults = m.actionResults[len(m.actionResults)-maxActionResults:]
+	}
+	m.mu.Unlock()
+
+	if result.Success {
+		m.logger.Info("Config action succeeded",
+			zap.String("path", result.Path),
+			zap.Float64("duration", result.Duration))
+	} else {
+		m.logger.Error("Config action failed",
+			zap.String("path", result.Path),
+			zap.String("stage", result.Stage),
+			zap.Bool("rolled_back", result.RolledBack),
+			zap.String("error", result.Error))
+	}
+
+	if m.events == nil {
+		return
+	}
+	select {
+	case m.events <- result:
+	default:
+		m.logger.Warn("Failed to send config action result: channel full")
+	}
+}
+
+func truncateOutput(s string) string {
+	if len(s) <= maxActionOutput {
+		return s
+	}
+	return "...\n" + s[len(s)-maxActionOutput:]
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/store"
+)
+
+const (
+	// DefaultMaxChanges bounds the change history; the oldest changes
+	// are pruned first
+	DefaultMaxChanges = 1000
+	// DefaultChangeMaxAge is how long changes are kept
+	DefaultChangeMaxAge = 90 * 24 * time.Hour
+)
+
+// SetChangeRetention bounds the change history to maxCount changes no
+// older than maxAge, pruning it right away. Zero disables a bound.
+func (m *Manager) SetChangeRetention(maxAge time.Duration, maxCount int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changeMaxAge = maxAge
+	m.maxChanges = maxCount
+	m.pruneChanges(time.Now(), maxAge, maxCount)
+}
+
+// SetStore keeps the change history in s and restores it, so that it
+// survives restarts
+func (m *Manager) SetStore(s *store.Store) error {
+	records := store.NewBucket[ConfigChange](s, store.BucketConfigChanges)
+	saved, err := records.All()
+	if err != nil {
+		return fmt.Errorf("failed to load config changes: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changeRecords = records
+	restored := make([]ConfigChange, 0, len(saved)+len(m.changes))
+	for _, change := range saved {
+		restored = append(restored, change)
+	}
+	for _, change := range m.changes {
+		if _, ok := saved[changeKey(change)]; !ok {
+			restored = append(restored, change)
+			m.saveChange(change)
+		}
+	}
+	sort.SliceStable(restored, func(i, j int) bool {
+		return restored[i].Timestamp.Before(restored[j].Timestamp)
+	})
+	m.changes = restored
+	m.pruneChanges(time.Now(), m.changeMaxAge, m.maxChanges)
+	m.logger.Info("Config changes restored", zap.Int("changes", len(m.changes)))
+	return nil
+}
+
+// PruneChanges removes the changes older than maxAge and the oldest
+// beyond maxCount, and returns how many were removed. Zero disables a
+// bound.
+func (m *Manager) PruneChanges(maxAge time.Duration, maxCount int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pruneChanges(time.Now(), maxAge, maxCount)
+}
+
+// HandleCommand runs a changes:* command
+func (m *Manager) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "changes:export":
+		// changes:export [path-glob] [since] [until], times in RFC 3339
+		var filter ChangeFilter
+		if len(args) > 0 {
+			filter.Path = args[0]
+		}
+		for i, t := range []*time.Time{&filter.Since, &filter.Until} {
+			if len(args) > i+1 && args[i+1] != "" {
+				parsed, err := time.Parse(time.RFC3339, args[i+1])
+				if err != nil {
+					return nil, protocol.Errorf(protocol.ErrorValidation, "invalid time %q: %w", args[i+1], err)
+				}
+				*t = parsed
+			}
+		}
+		return m.GetChanges(filter), nil
+	case "changes:prune":
+		// changes:prune <max-age> [max-count]
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "max age required")
+		}
+		maxAge, err := time.ParseDuration(args[0])
+		if err != nil {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "invalid max age: %w", err)
+		}
+		maxCount := 0
+		if len(args) > 1 {
+			if maxCount, err = strconv.Atoi(args[1]); err != nil {
+				return nil, protocol.Errorf(protocol.ErrorValidation, "invalid max count: %w", err)
+			}
+		}
+		return map[string]int{"pruned": m.PruneChanges(maxAge, maxCount)}, nil
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown changes command: %s", cmd)
+	}
+}
+
+// recordChange adds a change to the history. The caller holds mu.
+func (m *Manager) recordChange(change ConfigChange) {
+	m.changes = append(m.changes, change)
+	m.saveChange(change)
+	m.pruneChanges(change.Timestamp, m.changeMaxAge, m.maxChanges)
+}
+
+// saveChange persists a change if a store is set. The caller holds mu.
+func (m *Manager) saveChange(change ConfigChange) {
+	if m.changeRecords == nil {
+		return
+	}
+	if err := m.changeRecords.Put(changeKey(change), change); err != nil {
+		m.logger.Warn("Failed to persist config change", zap.String("path", change.Path), zap.Error(err))
+	}
+}
+
+// pruneChanges removes the changes older than maxAge and the oldest
+// beyond maxCount. The history is oldest first. The caller holds mu.
+func (m *Manager) pruneChanges(now time.Time, maxAge time.Duration, maxCount int) int {
+	drop := 0
+	if maxAge > 0 {
+		for drop < len(m.changes) && now.Sub(m.changes[drop].Timestamp) > maxAge {
+			drop++
+		}
+	}
+	if maxCount > 0 && len(m.changes)-drop > maxCount {
+		drop = len(m.changes) - maxCount
+	}
+	if drop == 0 {
+		return 0
+	}
+
+	for _, change := range m.changes[:drop] {
+		if m.changeRecords == nil {
+			break
+		}
+		if err := m.changeRecords.Delete(changeKey(change)); err != nil {
+			m.logger.Warn("Failed to delete config change", zap.String("path", change.Path), zap.Error(err))
+		}
+	}
+	m.changes = append([]ConfigChange(nil), m.changes[drop:]...)
+	return drop
+}
+
+// changeKey identifies a change in the store, sorting by time
+func changeKey(change ConfigChange) string {
+	return fmt.Sprintf("%020d %s", change.Timestamp.UnixNano(), change.Path)
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -16,6 +18,29 @@ type Config struct {
 	Metrics   MetricsConfig   `mapstructure:"metrics"`
 	Logging   LoggingConfig   `mapstructure:"logging"`
 	Security  SecurityConfig  `mapstructure:"security"`
+	Features  FeaturesConfig  `mapstructure:"features"`
+	Docker    DockerConfig    `mapstructure:"docker"`
+	Clock     ClockConfig     `mapstructure:"clock"`
+	Journal   JournalConfig   `mapstructure:"journal"`
+	API       APIConfig       `mapstructure:"api"`
+	Discovery DiscoveryConfig `mapstructure:"discovery"`
+	Network   NetworkConfig   `mapstructure:"network"`
+	SSHKeys   SSHKeysConfig   `mapstructure:"ssh_keys"`
+	FIM       FIMConfig       `mapstructure:"fim"`
+	Plugins   PluginsConfig   `mapstructure:"plugins"`
+	Resolver  ResolverConfig  `mapstructure:"resolver"`
+	Updates   UpdatesConfig   `mapstructure:"updates"`
+	// ConfigFiles limits the files templates and desired state may write
+	ConfigFiles ConfigFilesConfig `mapstructure:"config_files"`
+	// Include lists drop-in files merged over the config file, e.g.
+	// conf.d/*.yaml
+	Include []string `mapstructure:"include"`
+	// Strict makes unknown keys an error
+	Strict bool `mapstructure:"strict"`
+	// UnknownKeys are the keys no setting matches, for warnings
+	UnknownKeys []string `mapstructure:"-"`
+	// Files are the config file and drop-ins read, in merge order
+	Files []string `mapstructure:"-"`
 }
 
 type AgentConfig struct {
@@ -26,27 +51,256 @@ type AgentConfig struct {
 	DataDir      string            `mapstructure:"data_dir"`
 	MaxJobs      int               `mapstructure:"max_jobs"`
 	ShutdownWait time.Duration     `mapstructure:"shutdown_wait"`
+	Resources    ResourceConfig    `mapstructure:"resources"`
+	CoreDump     bool              `mapstructure:"core_dump"`
+	// Tenant is the tenant the agent belongs to; commands claiming
+	// another tenant or none are refused
+	Tenant        string              `mapstructure:"tenant"`
+	Authorization AuthorizationConfig `mapstructure:"authorization"`
+}
+
+// AuthorizationConfig maps the roles claimed by commands to the command
+// prefixes they allow, over the built-in admin, operator and read-only
+// roles. A prefix ending in a colon allows every command below it, others
+// the command they name and its subcommands. Processes are authorized as
+// exec:<command>.
+type AuthorizationConfig struct {
+	Roles map[string][]string `mapstructure:"roles"`
+	// DefaultRoles apply to commands without role claims; empty refuses
+	// them
+	DefaultRoles []string `mapstructure:"default_roles"`
+}
+
+// ResourceConfig budgets the agent's own CPU and memory. Collectors are
+// slowed down once usage reaches throttle_at of a budget.
+type ResourceConfig struct {
+	MaxProcs    int     `mapstructure:"max_procs"`    // 0 derives GOMAXPROCS from cpu_percent
+	CPUPercent  float64 `mapstructure:"cpu_percent"`  // percent of one core, 0 for no budget
+	MemoryLimit int64   `mapstructure:"memory_limit"` // bytes, 0 for no budget
+	Cgroup      string  `mapstructure:"cgroup"`       // cgroup v2 path to move into, Linux only
+	ThrottleAt  float64 `mapstructure:"throttle_at"`
 }
 
 type ServerConfig struct {
 	URL            string        `mapstructure:"url"`
 	ReconnectDelay time.Duration `mapstructure:"reconnect_delay"`
 	Timeout        time.Duration `mapstructure:"timeout"`
+	// URLs are servers to fail over between, used instead of URL when set
+	URLs []ServerEndpoint `mapstructure:"urls"`
+	// FailbackInterval is how often more preferred servers are retried
+	// while connected to another; 0 disables failback
+	FailbackInterval time.Duration     `mapstructure:"failback_interval"`
+	Compression      CompressionConfig `mapstructure:"compression"`
+	// Codecs are the binary codecs offered to the server, in order of
+	// preference; empty keeps messages in JSON
+	Codecs     []string         `mapstructure:"codecs"`
+	RateLimits RateLimitConfig  `mapstructure:"rate_limits"`
+	Enrollment EnrollmentConfig `mapstructure:"enrollment"`
+}
+
+// EnrollmentConfig configures how the agent obtains its identity. URL
+// defaults to the enrollment endpoint of the server URL; Token is the
+// one-time token the server issued. Unless Required is unset, the agent
+// doesn't connect without an identity.
+type EnrollmentConfig struct {
+	URL          string        `mapstructure:"url"`
+	Token        string        `mapstructure:"token"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	Required     bool          `mapstructure:"required"`
+}
+
+// RateLimitConfig limits the messages the server sends the agent, in
+// messages per second with bursts of up to burst. Types limits message
+// types, and request methods as request:<method>, on top of the global
+// rate. A rate of 0 disables a limit.
+type RateLimitConfig struct {
+	Rate  float64              `mapstructure:"rate"`
+	Burst int                  `mapstructure:"burst"`
+	Types map[string]RateLimit `mapstructure:"types"`
+}
+
+// RateLimit is the limit of one message type
+type RateLimit struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+// CompressionConfig controls compression of messages to the server.
+// Payloads are gzipped only when the server doesn't accept
+// permessage-deflate.
+type CompressionConfig struct {
+	Deflate       bool `mapstructure:"deflate"`
+	Level         int  `mapstructure:"level"`
+	GzipThreshold int  `mapstructure:"gzip_threshold"`
+}
+
+// ServerEndpoint is a server to fail over to. Lower priorities are
+// preferred; weights spread agents over servers of equal priority.
+type ServerEndpoint struct {
+	URL      string `mapstructure:"url"`
+	Priority int    `mapstructure:"priority"`
+	Weight   int    `mapstructure:"weight"`
 }
 
 type MetricsConfig struct {
 	Enabled       bool          `mapstructure:"enabled"`
 	Interval      time.Duration `mapstructure:"interval"`
 	RetentionDays int           `mapstructure:"retention_days"`
+	// Listen serves the agent's own metrics for Prometheus; empty
+	// disables it
+	Listen        string        `mapstructure:"listen"`
+	// Pprof serves the agent's net/http/pprof endpoints, and should be
+	// a loopback address; empty disables them
+	Pprof string `mapstructure:"pprof"`
+	// Aggregation summarizes samples before they are uploaded
+	Aggregation AggregationConfig `mapstructure:"aggregation"`
+	// SNMP polls network devices, reporting them with the metrics
+	SNMP SNMPConfig `mapstructure:"snmp"`
+}
+
+// SNMPConfig polls devices every interval
+type SNMPConfig struct {
+	Interval time.Duration      `mapstructure:"interval"`
+	Devices  []SNMPDeviceConfig `mapstructure:"devices"`
+}
+
+// SNMPDeviceConfig is a device polled over SNMP v2c with community, or
+// v3 with username and the auth and priv settings
+type SNMPDeviceConfig struct {
+	Name           string        `mapstructure:"name"`
+	Address        string        `mapstructure:"address"`
+	Port           uint16        `mapstructure:"port"`
+	Version        string        `mapstructure:"version"`
+	Community      string        `mapstructure:"community"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	Retries        int           `mapstructure:"retries"`
+	Username       string        `mapstructure:"username"`
+	AuthProtocol   string        `mapstructure:"auth_protocol"`
+	AuthPassphrase string        `mapstructure:"auth_passphrase"`
+	PrivProtocol   string        `mapstructure:"priv_protocol"`
+	PrivPassphrase string        `mapstructure:"priv_passphrase"`
+}
+
+// AggregationConfig summarizes metric samples over windows, sending the
+// summaries every flush_interval, or right away when a usage changes by
+// change_threshold percentage points. Disabled, no metrics are uploaded
+// besides heartbeats.
+type AggregationConfig struct {
+	Enabled         bool            `mapstructure:"enabled"`
+	Windows         []time.Duration `mapstructure:"windows"`
+	FlushInterval   time.Duration   `mapstructure:"flush_interval"`
+	ChangeThreshold float64         `mapstructure:"change_threshold"`
 }
 
 type LoggingConfig struct {
-	Level      string `mapstructure:"level"`
-	File       string `mapstructure:"file"`
-	MaxSize    int    `mapstructure:"max_size"`
-	MaxBackups int    `mapstructure:"max_backups"`
-	MaxAge     int    `mapstructure:"max_age"`
-	Compress   bool   `mapstructure:"compress"`
+	Level      string         `mapstructure:"level"`
+	File       string         `mapstructure:"file"`
+	MaxSize    int            `mapstructure:"max_size"`
+	MaxBackups int            `mapstructure:"max_backups"`
+	MaxAge     int            `mapstructure:"max_age"`
+	Compress   bool           `mapstructure:"compress"`
+	Syslog     SyslogConfig   `mapstructure:"syslog"`
+	EventLog   EventLogConfig `mapstructure:"eventlog"`
+	// Collect tails log files and journals, matching their lines
+	// against patterns and shipping them
+	Collect LogCollectConfig `mapstructure:"collect"`
+}
+
+// LogCollectConfig follows files and journals; with neither, no logs are
+// collected. Lines matching a pattern become events, and are shipped with
+// every other line when ship.all is set.
+type LogCollectConfig struct {
+	Files      []LogFileConfig    `mapstructure:"files"`
+	Journals   []LogJournalConfig `mapstructure:"journals"`
+	Patterns   []LogPatternConfig `mapstructure:"patterns"`
+	Extractors []string           `mapstructure:"extractors"` // grok or regexp patterns whose named groups become fields
+	Redact     LogRedactConfig    `mapstructure:"redact"`
+	Anomaly    LogAnomalyConfig   `mapstructure:"anomaly"`
+	Ship       LogShipConfig      `mapstructure:"ship"`
+}
+
+// LogFileConfig is a file followed across rotation. Lines not matching
+// multiline_start are appended to the record before them.
+type LogFileConfig struct {
+	Path              string        `mapstructure:"path"`
+	MultilineStart    string        `mapstructure:"multiline_start"`
+	MultilineMaxLines int           `mapstructure:"multiline_max_lines"`
+	MultilineTimeout  time.Duration `mapstructure:"multiline_timeout"`
+}
+
+// LogJournalConfig follows the systemd journal entries of units and
+// identifiers, or all entries when both are empty
+type LogJournalConfig struct {
+	Name        string   `mapstructure:"name"`
+	Units       []string `mapstructure:"units"`
+	Identifiers []string `mapstructure:"identifiers"`
+	Priority    int      `mapstructure:"priority"` // 0=emerg .. 7=debug, 0 for all
+	Matches     []string `mapstructure:"matches"`  // FIELD=value
+}
+
+// LogPatternConfig raises lines matching pattern at level
+type LogPatternConfig struct {
+	Pattern     string `mapstructure:"pattern"`
+	Level       string `mapstructure:"level"` // debug, info, warn or error
+	Description string `mapstructure:"description"`
+}
+
+// LogRedactConfig masks secrets and personal data in lines before they
+// are matched or shipped, with the built-in rules followed by rules
+type LogRedactConfig struct {
+	Enabled bool                     `mapstructure:"enabled"`
+	Rules   []LogRedactionRuleConfig `mapstructure:"rules"`
+}
+
+// LogRedactionRuleConfig replaces matches of pattern, with
+// [REDACTED:<name>] unless replacement is set
+type LogRedactionRuleConfig struct {
+	Name        string `mapstructure:"name"`
+	Pattern     string `mapstructure:"pattern"`
+	Replacement string `mapstructure:"replacement"`
+	Luhn        bool   `mapstructure:"luhn"` // only matches passing the Luhn checksum
+}
+
+// LogAnomalyConfig alerts when the rate of a source's warnings and errors
+// spikes above its baseline, or a busy source goes silent. Zero values
+// use the detector's defaults.
+type LogAnomalyConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	Interval         time.Duration `mapstructure:"interval"`
+	WarmupIntervals  int           `mapstructure:"warmup_intervals"`
+	Threshold        float64       `mapstructure:"threshold"` // standard deviations above the baseline
+	MinCount         int64         `mapstructure:"min_count"`
+	SilenceIntervals int           `mapstructure:"silence_intervals"`
+}
+
+// LogShipConfig sends collected lines to the server and, when loki_url is
+// set, to Loki. Batches a sink can't take are spooled below the data dir
+// up to max_buffer_bytes and retried every retry_interval.
+type LogShipConfig struct {
+	All            bool              `mapstructure:"all"`
+	LokiURL        string            `mapstructure:"loki_url"`
+	LokiLabels     map[string]string `mapstructure:"loki_labels"`
+	BatchSize      int               `mapstructure:"batch_size"`
+	FlushInterval  time.Duration     `mapstructure:"flush_interval"`
+	MaxBufferBytes int64             `mapstructure:"max_buffer_bytes"`
+	RetryInterval  time.Duration     `mapstructure:"retry_interval"`
+}
+
+// EventLogConfig sends logs to the Windows Event Log
+type EventLogConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Source  string `mapstructure:"source"` // registered on first use, default shh-agent
+}
+
+type SyslogConfig struct {
+	Enabled          bool   `mapstructure:"enabled"`
+	Network          string `mapstructure:"network"` // udp, tcp, unix, or empty for the local daemon
+	Address          string `mapstructure:"address"`
+	Facility         string `mapstructure:"facility"`
+	Tag              string `mapstructure:"tag"`
+	Format           string `mapstructure:"format"` // rfc3164 or rfc5424
+	StructuredDataID string `mapstructure:"structured_data_id"`
+	FallbackFile     string `mapstructure:"fallback_file"` // used while syslog is unreachable, stderr if empty
 }
 
 type SecurityConfig struct {
@@ -55,6 +309,249 @@ type SecurityConfig struct {
 	KeyFile     string `mapstructure:"key_file"`
 	CAFile      string `mapstructure:"ca_file"`
 	SkipVerify  bool   `mapstructure:"skip_verify"`
+	// Scan checks the rules against paths every interval
+	Scan SecurityScanConfig `mapstructure:"scan"`
+	// MAC reports SELinux and AppArmor status and denials
+	MAC MACConfig `mapstructure:"mac"`
+}
+
+// SecurityScanConfig checks the files below paths against rules; no paths
+// disables the scheduled scan
+type SecurityScanConfig struct {
+	Paths    []string             `mapstructure:"paths"`
+	Rules    []SecurityRuleConfig `mapstructure:"rules"`
+	Interval time.Duration        `mapstructure:"interval"`
+}
+
+// SecurityRuleConfig is a permission, ownership or content rule matching
+// the files whose name matches target
+type SecurityRuleConfig struct {
+	Type       string `mapstructure:"type"`
+	Target     string `mapstructure:"target"`
+	Permission string `mapstructure:"permission"` // octal, such as 0600
+	Owner      string `mapstructure:"owner"`
+	Group      string `mapstructure:"group"`
+	Pattern    string `mapstructure:"pattern"`
+	MaxSize    int64  `mapstructure:"max_size"`
+	Severity   string `mapstructure:"severity"`
+	Remediate  bool   `mapstructure:"remediate"`
+}
+
+// MACConfig reports the denials of the last denial_window found in the
+// first of audit_logs that exists. allow_toggle lets the server switch
+// between enforcing and permissive.
+type MACConfig struct {
+	AllowToggle  bool          `mapstructure:"allow_toggle"`
+	AuditLogs    []string      `mapstructure:"audit_logs"`
+	DenialWindow time.Duration `mapstructure:"denial_window"`
+	MaxDenials   int           `mapstructure:"max_denials"`
+}
+
+// UpdatesConfig restricts package updates to windows, except on blackout
+// dates. Updates requested while the window is closed are refused or,
+// with defer set, applied once it opens. Staged updates wait settle after
+// each package and halt when the agent is then unhealthy.
+type UpdatesConfig struct {
+	Windows   []UpdateWindowConfig `mapstructure:"windows"`
+	Blackouts []string             `mapstructure:"blackouts"` // YYYY-MM-DD
+	Location  string               `mapstructure:"location"`  // IANA zone, local time if empty
+	Defer     bool                 `mapstructure:"defer"`
+	Settle    time.Duration        `mapstructure:"settle"`
+}
+
+// UpdateWindowConfig opens at start and closes at end, wrapping past
+// midnight when end is earlier, on days, or every day when empty
+type UpdateWindowConfig struct {
+	Days  []string `mapstructure:"days"`  // monday or mon, ...
+	Start string   `mapstructure:"start"` // HH:MM
+	End   string   `mapstructure:"end"`   // HH:MM
+}
+
+// ConfigFilesConfig lets templates and desired state write the paths in
+// write_allowlist, and everything below them, besides the managed configs
+type ConfigFilesConfig struct {
+	WriteAllowlist []string `mapstructure:"write_allowlist"`
+}
+
+type FeaturesConfig struct {
+	EBPFProfiling bool `mapstructure:"ebpf_profiling"` // requires Linux, root and bpftrace
+}
+
+// DockerConfig limits what the server may do through the Docker plugin
+type DockerConfig struct {
+	// MountAllowlist are the host paths, and everything below them, that
+	// containers run from a spec may bind mount
+	MountAllowlist []string `mapstructure:"mount_allowlist"`
+	// CrashLoop decides when OOM kills and dying containers are alerted
+	// on
+	CrashLoop CrashLoopConfig `mapstructure:"crash_loop"`
+	// ComposeDrift decides how compose projects are checked against
+	// their compose files
+	ComposeDrift ComposeDriftConfig `mapstructure:"compose_drift"`
+	// AutoUpdate decides how containers labeled shh.auto-update=true
+	// are updated to newer images
+	AutoUpdate AutoUpdateConfig `mapstructure:"auto_update"`
+}
+
+// CrashLoopConfig makes restarts deaths within window a restart loop
+type CrashLoopConfig struct {
+	Restarts int           `mapstructure:"restarts"`
+	Window   time.Duration `mapstructure:"window"`
+	Cooldown time.Duration `mapstructure:"cooldown"`  // least time between alerts per container
+	LogLines int           `mapstructure:"log_lines"` // attached to alerts
+}
+
+// ComposeDriftConfig checks compose projects every interval, 0 disabling
+// the checks. Drifted projects listed in auto_converge, or all for "*",
+// are brought back in line with compose up -d.
+type ComposeDriftConfig struct {
+	Interval     time.Duration `mapstructure:"interval"`
+	AutoConverge []string      `mapstructure:"auto_converge"`
+}
+
+// AutoUpdateConfig checks for newer images every interval, 0 disabling
+// the checks. Updated containers not healthy within health_timeout are
+// rolled back.
+type AutoUpdateConfig struct {
+	Interval      time.Duration `mapstructure:"interval"`
+	HealthTimeout time.Duration `mapstructure:"health_timeout"`
+}
+
+// ClockConfig measures the clock offset against servers every interval
+// and degrades health while it exceeds threshold
+type ClockConfig struct {
+	Servers   []string      `mapstructure:"servers"`
+	Interval  time.Duration `mapstructure:"interval"`
+	Threshold time.Duration `mapstructure:"threshold"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+}
+
+// JournalConfig keeps what the agent would have sent the server in a local
+// journal, trimmed to max_age and max_size bytes. Offline runs the agent
+// without a server, journaling everything; otherwise only what fails to
+// send is journaled, and uploaded on reconnect when upload is set.
+type JournalConfig struct {
+	Offline bool          `mapstructure:"offline"`
+	MaxAge  time.Duration `mapstructure:"max_age"`
+	MaxSize int64         `mapstructure:"max_size"`
+	Upload  bool          `mapstructure:"upload"`
+}
+
+// APIConfig configures the local API the dashboard and the top command
+// use. Listen must be a loopback address unless TLS is configured; empty
+// disables the API. Admin lets the dashboard restart containers and
+// cancel transfers; otherwise it is read-only.
+//
+// Clients authenticate with the token the agent writes to api.token in
+// the data directory, with Tokens, as Users, or with a client certificate
+// signed by TLS.ClientCA. Only AllowedNetworks may connect.
+type APIConfig struct {
+	Listen          string       `mapstructure:"listen"`
+	Admin           bool         `mapstructure:"admin"`
+	Tokens          []APIToken   `mapstructure:"tokens"`
+	Users           []APIUser    `mapstructure:"users"`
+	TLS             APITLSConfig `mapstructure:"tls"`
+	AllowedNetworks []string     `mapstructure:"allowed_networks"`
+}
+
+// APIToken is a bearer token; Admin lets it use the admin actions
+type APIToken struct {
+	Token string `mapstructure:"token"`
+	Admin bool   `mapstructure:"admin"`
+}
+
+// APIUser is a basic-auth user with a bcrypt password hash
+type APIUser struct {
+	Username     string `mapstructure:"username"`
+	PasswordHash string `mapstructure:"password_hash"`
+	Admin        bool   `mapstructure:"admin"`
+}
+
+// APITLSConfig serves the API over TLS. With ClientCA, clients must
+// present a certificate it signed; those named in AdminClients get the
+// admin role.
+type APITLSConfig struct {
+	Cert         string   `mapstructure:"cert"`
+	Key          string   `mapstructure:"key"`
+	ClientCA     string   `mapstructure:"client_ca"`
+	AdminClients []string `mapstructure:"admin_clients"`
+}
+
+// DiscoveryConfig finds services through DNS, DNS-SD, Docker and
+// Kubernetes every interval. Scan also probes the local subnets, limited
+// to allow_networks when set, for open ports. Mesh measures the latency to
+// the other agents found through DNS-SD over UDP mesh_port; agents sharing
+// mesh_secret also learn of each other from their probes.
+type DiscoveryConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Interval        time.Duration `mapstructure:"interval"`
+	SearchDomains   []string      `mapstructure:"search_domains"`
+	Scan            bool          `mapstructure:"scan"`
+	AllowNetworks   []string      `mapstructure:"allow_networks"`
+	ExcludeNetworks []string      `mapstructure:"exclude_networks"`
+	Mesh            bool          `mapstructure:"mesh"`
+	MeshPort        int           `mapstructure:"mesh_port"`
+	MeshSecret      string        `mapstructure:"mesh_secret"`
+}
+
+// NetworkConfig analyzes the traffic of interface, capturing packets in
+// builds with the pcap tag and polling the socket table otherwise.
+// Lookups of domains in dns_deny, or their subdomains, raise alerts unless
+// dns_allow lists them.
+type NetworkConfig struct {
+	Enabled   bool             `mapstructure:"enabled"`
+	Interface string           `mapstructure:"interface"`
+	BPFFilter string           `mapstructure:"bpf_filter"`
+	DNSAllow  []string         `mapstructure:"dns_allow"`
+	DNSDeny   []string         `mapstructure:"dns_deny"`
+	Export    FlowExportConfig `mapstructure:"export"`
+}
+
+// FlowExportConfig sends the flows to a NetFlow v9 or IPFIX collector at
+// host:port every interval; an empty collector disables export
+type FlowExportConfig struct {
+	Collector string        `mapstructure:"collector"`
+	Format    string        `mapstructure:"format"` // netflow9 or ipfix
+	Interval  time.Duration `mapstructure:"interval"`
+}
+
+// SSHKeysConfig protects the keys whose fingerprints are in break_glass
+// from removal by authorized_keys policies. ca_key signs SSH certificates
+// and renews host certificates; empty leaves issuing to the server.
+type SSHKeysConfig struct {
+	BreakGlass []string `mapstructure:"break_glass"`
+	CAKey      string   `mapstructure:"ca_key"`
+}
+
+// FIMConfig monitors the integrity of the files below paths, verifying
+// them every interval and, with watch, as they change. Files larger than
+// max_file_size are compared by size and modification time only.
+type FIMConfig struct {
+	Paths       []string      `mapstructure:"paths"`
+	Exclude     []string      `mapstructure:"exclude"`
+	Interval    time.Duration `mapstructure:"interval"`
+	Watch       bool          `mapstructure:"watch"`
+	MaxFileSize int64         `mapstructure:"max_file_size"`
+}
+
+// PluginsConfig loads the external plugins in dir; empty disables them
+type PluginsConfig struct {
+	Dir string `mapstructure:"dir"`
+}
+
+// ResolverConfig detects problems from the metrics and the discovered
+// containers every interval. With auto_resolve, they are resolved without
+// waiting for the server. Runbooks is a YAML file or a directory of them
+// mapping problems to remediation steps. Problems are escalated after
+// escalate_after failed resolutions, 0 never, and resolved problems are
+// kept for resolved_retention.
+type ResolverConfig struct {
+	Enabled           bool          `mapstructure:"enabled"`
+	Interval          time.Duration `mapstructure:"interval"`
+	AutoResolve       bool          `mapstructure:"auto_resolve"`
+	Runbooks          string        `mapstructure:"runbooks"`
+	EscalateAfter     int           `mapstructure:"escalate_after"`
+	ResolvedRetention time.Duration `mapstructure:"resolved_retention"`
 }
 
 // Load reads configuration from file and environment variables
@@ -84,17 +581,26 @@ func Load() (*Config, error) {
 		v.Set("agent.id", fmt.Sprintf("%s-%d", hostname, os.Getpid()))
 	}
 
-	// Read config file
+	// Read config file, expanding ${ENV_VAR} references and merging
+	// drop-ins
+	var files []string
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
+	} else if files, err = readLayered(v); err != nil {
+		return nil, err
 	}
 
 	var config Config
 	if err := v.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	config.Files = files
+	config.UnknownKeys = unknownKeys(v.AllSettings(), reflect.TypeOf(config), "")
+	if config.Strict && len(config.UnknownKeys) > 0 {
+		return nil, fmt.Errorf("unknown config keys: %s", strings.Join(config.UnknownKeys, ", "))
+	}
 
 	// Create data directory if it doesn't exist
 	if err := os.MkdirAll(config.Agent.DataDir, 0755); err != nil {
@@ -110,16 +616,40 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("agent.data_dir", filepath.Join(os.TempDir(), "shh-agent"))
 	v.SetDefault("agent.max_jobs", runtime.NumCPU()*2)
 	v.SetDefault("agent.shutdown_wait", 30*time.Second)
+	v.SetDefault("agent.core_dump", false)
+	v.SetDefault("agent.tenant", "")
+	v.SetDefault("agent.authorization.default_roles", []string{"admin"})
+	v.SetDefault("agent.resources.cpu_percent", 50)
+	v.SetDefault("agent.resources.memory_limit", 256*1024*1024)
+	v.SetDefault("agent.resources.throttle_at", 0.8)
 
 	// Server defaults
 	v.SetDefault("server.url", "ws://localhost:4000/ws/agent")
 	v.SetDefault("server.reconnect_delay", 5*time.Second)
 	v.SetDefault("server.timeout", 30*time.Second)
+	v.SetDefault("server.failback_interval", 5*time.Minute)
+	v.SetDefault("server.compression.deflate", true)
+	v.SetDefault("server.compression.level", 1)
+	v.SetDefault("server.compression.gzip_threshold", 4096)
+	v.SetDefault("server.codecs", []string{"cbor"})
+	v.SetDefault("server.rate_limits.rate", 50)
+	v.SetDefault("server.rate_limits.burst", 200)
+	v.SetDefault("server.rate_limits.types", map[string]interface{}{
+		"command": map[string]interface{}{"rate": 10, "burst": 50},
+	})
+	v.SetDefault("server.enrollment.poll_interval", 30*time.Second)
+	v.SetDefault("server.enrollment.required", true)
 
 	// Metrics defaults
 	v.SetDefault("metrics.enabled", true)
 	v.SetDefault("metrics.interval", 15*time.Second)
 	v.SetDefault("metrics.retention_days", 7)
+	v.SetDefault("metrics.aggregation.enabled", true)
+	v.SetDefault("metrics.aggregation.windows", []time.Duration{time.Minute, 5 * time.Minute})
+	v.SetDefault("metrics.aggregation.flush_interval", 5*time.Minute)
+	v.SetDefault("metrics.aggregation.change_threshold", 20)
+	v.SetDefault("metrics.snmp.interval", time.Minute)
+	v.SetDefault("metrics.pprof", "")
 
 	// Logging defaults
 	v.SetDefault("logging.level", "info")
@@ -128,8 +658,117 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("logging.max_backups", 3)
 	v.SetDefault("logging.max_age", 28)      // 28 days
 	v.SetDefault("logging.compress", true)
+	v.SetDefault("logging.syslog.enabled", false)
+	v.SetDefault("logging.eventlog.enabled", false)
+	v.SetDefault("logging.eventlog.source", "shh-agent")
+	v.SetDefault("logging.syslog.network", "")
+	v.SetDefault("logging.syslog.facility", "local0")
+	v.SetDefault("logging.syslog.tag", "shh-agent")
+	v.SetDefault("logging.syslog.format", "rfc5424")
+	v.SetDefault("logging.syslog.structured_data_id", "shh@32473")
+	v.SetDefault("logging.collect.extractors", []string{})
+	v.SetDefault("logging.collect.redact.enabled", true)
+	v.SetDefault("logging.collect.anomaly.enabled", true)
+	v.SetDefault("logging.collect.ship.all", false)
+	v.SetDefault("logging.collect.ship.loki_url", "")
+	v.SetDefault("logging.collect.ship.batch_size", 500)
+	v.SetDefault("logging.collect.ship.flush_interval", 5*time.Second)
+	v.SetDefault("logging.collect.ship.max_buffer_bytes", 100*1024*1024)
+	v.SetDefault("logging.collect.ship.retry_interval", 30*time.Second)
 
 	// Security defaults
 	v.SetDefault("security.tls_enabled", false)
 	v.SetDefault("security.skip_verify", false)
+
+	// Docker defaults
+	v.SetDefault("docker.mount_allowlist", []string{})
+	v.SetDefault("docker.crash_loop.restarts", 5)
+	v.SetDefault("docker.crash_loop.window", 5*time.Minute)
+	v.SetDefault("docker.crash_loop.cooldown", 15*time.Minute)
+	v.SetDefault("docker.crash_loop.log_lines", 50)
+	v.SetDefault("docker.compose_drift.interval", 10*time.Minute)
+	v.SetDefault("docker.compose_drift.auto_converge", []string{})
+	v.SetDefault("docker.auto_update.interval", 6*time.Hour)
+	v.SetDefault("docker.auto_update.health_timeout", 2*time.Minute)
+
+	// Clock defaults
+	v.SetDefault("clock.servers", []string{"pool.ntp.org"})
+	v.SetDefault("clock.interval", 15*time.Minute)
+	v.SetDefault("clock.threshold", 500*time.Millisecond)
+	v.SetDefault("clock.timeout", 5*time.Second)
+
+	// Journal defaults
+	v.SetDefault("journal.offline", false)
+	v.SetDefault("journal.max_age", 7*24*time.Hour)
+	v.SetDefault("journal.max_size", 256*1024*1024)
+	v.SetDefault("journal.upload", true)
+
+	// Local API defaults
+	v.SetDefault("api.listen", "127.0.0.1:8484")
+	v.SetDefault("api.admin", false)
+	v.SetDefault("api.allowed_networks", []string{"127.0.0.0/8", "::1/128"})
+
+	// Discovery defaults
+	v.SetDefault("discovery.enabled", true)
+	v.SetDefault("discovery.interval", 5*time.Minute)
+	v.SetDefault("discovery.search_domains", []string{})
+	v.SetDefault("discovery.scan", false)
+	v.SetDefault("discovery.allow_networks", []string{})
+	v.SetDefault("discovery.exclude_networks", []string{})
+	v.SetDefault("discovery.mesh", false)
+	v.SetDefault("discovery.mesh_port", 7946)
+
+	// Network defaults
+	v.SetDefault("network.enabled", true)
+	v.SetDefault("network.interface", "any")
+	v.SetDefault("network.dns_allow", []string{})
+	v.SetDefault("network.dns_deny", []string{})
+	v.SetDefault("network.export.format", "ipfix")
+	v.SetDefault("network.export.interval", time.Minute)
+
+	// SSH key defaults
+	v.SetDefault("ssh_keys.break_glass", []string{})
+	v.SetDefault("ssh_keys.ca_key", "")
+
+	// File integrity defaults
+	v.SetDefault("fim.paths", []string{})
+	v.SetDefault("fim.exclude", []string{})
+	v.SetDefault("fim.interval", time.Hour)
+	v.SetDefault("fim.watch", true)
+	v.SetDefault("fim.max_file_size", 64*1024*1024)
+
+	// Security scan and MAC defaults
+	v.SetDefault("security.scan.paths", []string{})
+	v.SetDefault("security.scan.interval", 24*time.Hour)
+	v.SetDefault("security.mac.allow_toggle", false)
+	v.SetDefault("security.mac.audit_logs", []string{"/var/log/audit/audit.log", "/var/log/kern.log", "/var/log/syslog", "/var/log/messages"})
+	v.SetDefault("security.mac.denial_window", 24*time.Hour)
+	v.SetDefault("security.mac.max_denials", 50)
+
+	// Plugin defaults
+	v.SetDefault("plugins.dir", "")
+
+	// Resolver defaults
+	v.SetDefault("resolver.enabled", true)
+	v.SetDefault("resolver.interval", time.Minute)
+	v.SetDefault("resolver.auto_resolve", false)
+	v.SetDefault("resolver.runbooks", "")
+	v.SetDefault("resolver.escalate_after", 3)
+	v.SetDefault("resolver.resolved_retention", 24*time.Hour)
+
+	// Update defaults
+	v.SetDefault("updates.blackouts", []string{})
+	v.SetDefault("updates.location", "")
+	v.SetDefault("updates.defer", false)
+	v.SetDefault("updates.settle", 2*time.Minute)
+
+	// Config file defaults
+	v.SetDefault("config_files.write_allowlist", []string{})
+
+	// Feature flags
+	v.SetDefault("features.ebpf_profiling", false)
+
+	// Layering defaults
+	v.SetDefault("include", []string{})
+	v.SetDefault("strict", false)
 }
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffContext is the number of unchanged lines shown around changes
+const diffContext = 3
+
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff returns the unified diff from want to got, truncated to
+// limit bytes
+func unifiedDiff(path, want, got string, limit int) string {
+	var lines []diffLine
+	for _, d := range diff.Do(want, got) {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+		if d.Text == "" {
+			continue
+		}
+		for _, text := range strings.Split(strings.TrimSuffix(d.Text, "\n"), "\n") {
+			lines = append(lines, diffLine{op: op, text: text})
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s (desired)\n+++ %s\n", path, path)
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(lines); {
+		// Find the next change and extend the hunk over changes closer
+		// than twice the context
+		change := i
+		for change < len(lines) && lines[change].op == ' ' {
+			change++
+		}
+		if change == len(lines) {
+			break
+		}
+		end := change
+		for {
+			for end < len(lines) && lines[end].op != ' ' {
+				end++
+			}
+			next := end
+			for next < len(lines) && lines[next].op == ' ' && next-end < 2*diffContext {
+				next++
+			}
+			if next == len(lines) || lines[next].op == ' ' {
+				break
+			}
+			end = next
+		}
+		start := max(change-diffContext, i)
+		stop := min(end+diffContext, len(lines))
+
+		// Advance the line numbers to the start of the hunk
+		for _, l := range lines[i:start] {
+			oldLine, newLine = oldLine+countOld(l), newLine+countNew(l)
+		}
+		var oldCount, newCount int
+		for _, l := range lines[start:stop] {
+			oldCount, newCount = oldCount+countOld(l), newCount+countNew(l)
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+		for _, l := range lines[start:stop] {
+			b.WriteByte(l.op)
+			b.WriteString(l.text)
+			b.WriteByte('\n')
+		}
+		oldLine, newLine = oldLine+oldCount, newLine+newCount
+
+		if b.Len() > limit {
+			return b.String()[:limit] + "\n... diff truncated\n"
+		}
+		i = stop
+	}
+	return b.String()
+}
+
+func countOld(l diffLine) int {
+	if l.op == '+' {
+		return 0
+	}
+	return 1
+}
+
+func countNew(l diffLine) int {
+	if l.op == '-' {
+		return 0
+	}
+	return 1
+}
+
+// hunkRange formats the range of a hunk; an empty range starts at the
+// line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,410 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// INI files parse to a map of sections, each a map of string values. Keys
+// before the first section header are kept at the top level. ENV files
+// parse to a flat map of string values.
+//
+// The writers take the file being replaced as a template: comments, blank
+// lines and the order of keys are kept, changed values are rewritten in
+// place, removed keys are dropped and new keys are appended.
+
+// iniLine is a line of an INI or ENV file
+type iniLine struct {
+	raw     string
+	section string
+	key     string
+	// prefix is kept when the line is rewritten, e.g. "export "
+	prefix string
+	// assignment is the separator as written, e.g. " = "
+	assignment string
+	isKey      bool
+	isSection  bool
+}
+
+// parseINI parses INI content. Comments start with ';' or '#'; values may
+// be quoted.
+func parseINI(data []byte) (map[string]interface{}, error) {
+	content := make(map[string]interface{})
+	lines, err := scanINI(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		switch {
+		case l.isSection:
+			if _, ok := content[l.section].(map[string]interface{}); !ok {
+				content[l.section] = make(map[string]interface{})
+			}
+		case l.isKey:
+			value := iniValue(l.raw)
+			if l.section == "" {
+				content[l.key] = value
+			} else {
+				content[l.section].(map[string]interface{})[l.key] = value
+			}
+		}
+	}
+	return content, nil
+}
+
+func scanINI(data []byte) ([]iniLine, error) {
+	var lines []iniLine
+	section := ""
+	for i, raw := range splitLines(data) {
+		line := strings.TrimSpace(raw)
+		l := iniLine{raw: raw, section: section}
+		switch {
+		case line == "" || line[0] == ';' || line[0] == '#':
+		case line[0] == '[':
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated section header", i+1)
+			}
+			section = strings.TrimSpace(line[1:end])
+			l.section = section
+			l.isSection = true
+		default:
+			sep := strings.IndexAny(line, "=:")
+			if sep <= 0 {
+				return nil, fmt.Errorf("line %d: expected key = value", i+1)
+			}
+			l.key = strings.TrimSpace(line[:sep])
+			l.isKey = true
+			l.assignment = assignmentOf(raw)
+		}
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
+
+// iniValue returns the value of a key line, unquoted and without an
+// inline comment
+func iniValue(raw string) string {
+	line := strings.TrimSpace(raw)
+	sep := strings.IndexAny(line, "=:")
+	value := strings.TrimSpace(line[sep+1:])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[1 : end+1]
+		}
+	}
+	return strings.TrimSpace(strings.TrimSuffix(value, inlineComment(raw)))
+}
+
+// inlineComment returns the comment after an unquoted value, with the
+// whitespace before it
+func inlineComment(raw string) string {
+	line := strings.TrimSpace(raw)
+	value := line[strings.IndexAny(line, "=:")+1:]
+	if v := strings.TrimSpace(value); v != "" && (v[0] == '"' || v[0] == '\'') {
+		return ""
+	}
+	start := -1
+	for _, marker := range []string{" ;", " #", "\t;", "\t#"} {
+		if i := strings.Index(value, marker); i >= 0 && (start < 0 || i < start) {
+			start = i
+		}
+	}
+	if start < 0 {
+		return ""
+	}
+	for start > 0 && (value[start-1] == ' ' || value[start-1] == '\t') {
+		start--
+	}
+	return value[start:]
+}
+
+// marshalINI writes content as INI, keeping the layout of template
+func marshalINI(content map[string]interface{}, template []byte) ([]byte, error) {
+	lines, err := scanINI(template)
+	if err != nil {
+		// An unparsable file can't serve as a template
+		lines = nil
+	}
+
+	sectionValues := func(section string) map[string]interface{} {
+		if section == "" {
+			return content
+		}
+		values, _ := content[section].(map[string]interface{})
+		return values
+	}
+
+	var buf bytes.Buffer
+	written := make(map[string]bool)
+	seenSections := make(map[string]bool)
+	// appendMissing writes the keys of a section the template lacks
+	appendMissing := func(section string) {
+		values := sectionValues(section)
+		for _, key := range sortedKeys(values) {
+			if _, isSection := values[key].(map[string]interface{}); isSection && section == "" {
+				continue
+			}
+			if !written[section+"\x00"+key] {
+				fmt.Fprintf(&buf, "%s = %s\n", key, quoteINI(values[key]))
+				written[section+"\x00"+key] = true
+			}
+		}
+	}
+
+	// Blank lines are held back so that new keys go before the blank
+	// lines ending a section
+	var blanks int
+	flush := func() {
+		buf.WriteString(strings.Repeat("\n", blanks))
+		blanks = 0
+	}
+
+	current := ""
+	skipSection := false
+	for _, l := range lines {
+		switch {
+		case l.isSection:
+			appendMissing(current)
+			current = l.section
+			_, keep := content[current].(map[string]interface{})
+			skipSection = !keep
+			if skipSection {
+				continue
+			}
+			seenSections[current] = true
+			flush()
+			buf.WriteString(l.raw + "\n")
+		case skipSection:
+			// The section was removed
+		case l.isKey:
+			values := sectionValues(current)
+			value, ok := values[l.key]
+			if !ok || written[current+"\x00"+l.key] {
+				continue
+			}
+			written[current+"\x00"+l.key] = true
+			flush()
+			if iniValue(l.raw) == fmt.Sprint(value) {
+				buf.WriteString(l.raw + "\n")
+				continue
+			}
+			fmt.Fprintf(&buf, "%s%s%s%s\n", leadingSpace(l.raw), l.key, l.assignment+quoteINI(value), inlineComment(l.raw))
+		case strings.TrimSpace(l.raw) == "":
+			blanks++
+		default:
+			flush()
+			buf.WriteString(l.raw + "\n")
+		}
+	}
+	appendMissing(current)
+	flush()
+
+	for _, name := range sortedKeys(content) {
+		if _, isSection := content[name].(map[string]interface{}); !isSection || seenSections[name] {
+			continue
+		}
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n\n")) {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "[%s]\n", name)
+		appendMissing(name)
+	}
+	return buf.Bytes(), nil
+}
+
+func quoteINI(value interface{}) string {
+	s := fmt.Sprint(value)
+	if s == strings.TrimSpace(s) && !strings.ContainsAny(s, ";#\"'") {
+		return s
+	}
+	// INI has no escapes; pick the quote the value doesn't contain
+	if !strings.Contains(s, `"`) {
+		return `"` + s + `"`
+	}
+	return "'" + s + "'"
+}
+
+// parseENV parses dotenv content: KEY=value lines, optionally prefixed
+// with "export". Double-quoted values support escapes, single-quoted
+// values are literal and unquoted values end at a " #" comment.
+func parseENV(data []byte) (map[string]interface{}, error) {
+	content := make(map[string]interface{})
+	lines, err := scanENV(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		if l.isKey {
+			value, err := envValue(l.raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", l.key, err)
+			}
+			content[l.key] = value
+		}
+	}
+	return content, nil
+}
+
+func scanENV(data []byte) ([]iniLine, error) {
+	var lines []iniLine
+	for i, raw := range splitLines(data) {
+		line := strings.TrimSpace(raw)
+		l := iniLine{raw: raw}
+		if line != "" && line[0] != '#' {
+			if rest, ok := strings.CutPrefix(line, "export "); ok {
+				l.prefix = "export "
+				line = strings.TrimSpace(rest)
+			}
+			sep := strings.IndexByte(line, '=')
+			if sep <= 0 {
+				return nil, fmt.Errorf("line %d: expected KEY=value", i+1)
+			}
+			l.key = strings.TrimSpace(line[:sep])
+			if strings.ContainsAny(l.key, " \t") {
+				return nil, fmt.Errorf("line %d: invalid key %q", i+1, l.key)
+			}
+			l.isKey = true
+		}
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
+
+func envValue(raw string) (string, error) {
+	line := strings.TrimSpace(raw)
+	line = strings.TrimPrefix(line, "export ")
+	value := strings.TrimSpace(line[strings.IndexByte(line, '=')+1:])
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return unescapeENV(value[1:end]), nil
+	case strings.HasPrefix(value, "'"):
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return value[1 : end+1], nil
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// closingQuote returns the index of the unescaped double quote ending
+// value, which starts with one
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeENV(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// marshalENV writes content as dotenv, keeping the layout of template
+func marshalENV(content map[string]interface{}, template []byte) ([]byte, error) {
+	lines, err := scanENV(template)
+	if err != nil {
+		lines = nil
+	}
+
+	var buf bytes.Buffer
+	written := make(map[string]bool)
+	for _, l := range lines {
+		if !l.isKey {
+			buf.WriteString(l.raw + "\n")
+			continue
+		}
+		value, ok := content[l.key]
+		if !ok || written[l.key] {
+			continue
+		}
+		written[l.key] = true
+		if old, err := envValue(l.raw); err == nil && old == fmt.Sprint(value) {
+			buf.WriteString(l.raw + "\n")
+			continue
+		}
+		fmt.Fprintf(&buf, "%s%s=%s\n", l.prefix, l.key, quoteENV(value))
+	}
+	for _, key := range sortedKeys(content) {
+		if !written[key] {
+			fmt.Fprintf(&buf, "%s=%s\n", key, quoteENV(content[key]))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func quoteENV(value interface{}) string {
+	s := fmt.Sprint(value)
+	if !strings.ContainsAny(s, " \t\n\"'#$\\`") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(s) + `"`
+}
+
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// assignmentOf returns the separator of a key line with its spacing
+func assignmentOf(raw string) string {
+	line := strings.TrimSpace(raw)
+	sep := strings.IndexAny(line, "=:")
+	start, end := sep, sep+1
+	for start > 0 && (line[start-1] == ' ' || line[start-1] == '\t') {
+		start--
+	}
+	for end < len(line) && (line[end] == ' ' || line[end] == '\t') {
+		end++
+	}
+	return line[start:end]
+}
+
+func leadingSpace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
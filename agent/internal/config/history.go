@@ -0,0 +1,318 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"go.uber.org/zap"
+)
+
+// DefaultHistoryDir holds the git repository versioning managed configs
+const DefaultHistoryDir = "/var/lib/agent/config-history"
+
+// historyFilesDir is the directory of the repository mirroring the managed
+// files by absolute path
+const historyFilesDir = "files"
+
+// defaultAuthor signs changes made without a known user, such as edits
+// found by the watcher
+const defaultAuthor = "agent"
+
+// ConfigVersion is a committed version of a managed config
+type ConfigVersion struct {
+	Commit    string    `json:"commit"`
+	Author    string    `json:"author"`
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SetHistoryDir sets where the version history is kept. It must be called
+// before configs are added.
+func (m *Manager) SetHistoryDir(dir string) {
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+	m.historyDir = dir
+	m.repo = nil
+}
+
+// history opens the version repository, creating it on first use. The
+// caller holds historyMu.
+func (m *Manager) history() (*git.Repository, error) {
+	if m.repo != nil {
+		return m.repo, nil
+	}
+	dir := m.historyDir
+	if dir == "" {
+		dir = DefaultHistoryDir
+	}
+	repo, err := git.PlainOpen(dir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create config history directory: %w", err)
+		}
+		repo, err = git.PlainInit(dir, false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config history: %w", err)
+	}
+	m.repo = repo
+	m.historyDir = dir
+	return repo, nil
+}
+
+// historyPath returns where a managed file is mirrored in the repository
+func historyPath(path string) string {
+	return filepath.ToSlash(filepath.Join(historyFilesDir, strings.TrimPrefix(filepath.Clean(path), string(filepath.Separator))))
+}
+
+// commitVersion records the current content of a managed file. Nothing is
+// committed if it matches the last version. An empty user is recorded as
+// the agent.
+func (m *Manager) commitVersion(path, user, reason string) error {
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+
+	repo, err := m.history()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	rel := historyPath(path)
+	mirror := filepath.Join(m.historyDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(mirror), 0700); err != nil {
+		return fmt.Errorf("failed to create config history directory: %w", err)
+	}
+	if err := os.WriteFile(mirror, data, 0600); err != nil {
+		return fmt.Errorf("failed to record config version: %w", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to open config history: %w", err)
+	}
+	if _, err := wt.Add(rel); err != nil {
+		return fmt.Errorf("failed to record config version: %w", err)
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return fmt.Errorf("failed to record config version: %w", err)
+	}
+	if status.IsClean() {
+		return nil
+	}
+
+	if user == "" {
+		user = defaultAuthor
+	}
+	if reason == "" {
+		reason = "Update " + path
+	}
+	message := fmt.Sprintf("%s\n\nPath: %s\nUser: %s\n", reason, path, user)
+	hash, err := wt.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: user, Email: user + "@agent", When: time.Now()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit config version: %w", err)
+	}
+
+	m.logger.Info("Config version committed",
+		zap.String("path", path),
+		zap.String("commit", hash.String()[:12]),
+		zap.String("user", user),
+		zap.String("reason", reason))
+	return nil
+}
+
+// Versions returns the committed versions of a managed config, newest
+// first. A limit of 0 returns all of them.
+func (m *Manager) Versions(path string, limit int) ([]ConfigVersion, error) {
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+
+	repo, err := m.history()
+	if err != nil {
+		return nil, err
+	}
+	rel := historyPath(path)
+	commits, err := repo.Log(&git.LogOptions{FileName: &rel})
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read config history: %w", err)
+	}
+	defer commits.Close()
+
+	var versions []ConfigVersion
+	err = commits.ForEach(func(c *object.Commit) error {
+		if limit > 0 && len(versions) >= limit {
+			return storer.ErrStop
+		}
+		reason, _, _ := strings.Cut(c.Message, "\n")
+		versions = append(versions, ConfigVersion{
+			Commit:    c.Hash.String(),
+			Author:    c.Author.Name,
+			Reason:    reason,
+			Timestamp: c.Author.When,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config history: %w", err)
+	}
+	return versions, nil
+}
+
+// Diff returns the unified diff of a managed config between two versions.
+// An empty to means the latest version and an empty from the version
+// before to.
+func (m *Manager) Diff(path, from, to string) (string, error) {
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+
+	repo, err := m.history()
+	if err != nil {
+		return "", err
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+	toCommit, err := resolveCommit(repo, to)
+	if err != nil {
+		return "", err
+	}
+	toTree, err := toCommit.Tree()
+	if err != nil {
+		return "", fmt.Errorf("failed to read version %s: %w", to, err)
+	}
+
+	var fromTree *object.Tree
+	switch {
+	case from != "":
+		fromCommit, err := resolveCommit(repo, from)
+		if err != nil {
+			return "", err
+		}
+		if fromTree, err = fromCommit.Tree(); err != nil {
+			return "", fmt.Errorf("failed to read version %s: %w", from, err)
+		}
+	case toCommit.NumParents() > 0:
+		parent, err := toCommit.Parent(0)
+		if err != nil {
+			return "", fmt.Errorf("failed to read version before %s: %w", to, err)
+		}
+		if fromTree, err = parent.Tree(); err != nil {
+			return "", fmt.Errorf("failed to read version before %s: %w", to, err)
+		}
+	}
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff versions: %w", err)
+	}
+	rel := historyPath(path)
+	var matching object.Changes
+	for _, c := range changes {
+		if c.From.Name == rel || c.To.Name == rel {
+			matching = append(matching, c)
+		}
+	}
+	if len(matching) == 0 {
+		return "", nil
+	}
+	patch, err := matching.Patch()
+	if err != nil {
+		return "", fmt.Errorf("failed to diff versions: %w", err)
+	}
+	return patch.String(), nil
+}
+
+// RollbackTo restores a managed config to a committed version and records
+// the rollback as a new version
+func (m *Manager) RollbackTo(path, commit, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	config, ok := m.configs[path]
+	if !ok {
+		return fmt.Errorf("config not found: %s", path)
+	}
+
+	m.historyMu.Lock()
+	repo, err := m.history()
+	if err != nil {
+		m.historyMu.Unlock()
+		return err
+	}
+	c, err := resolveCommit(repo, commit)
+	if err != nil {
+		m.historyMu.Unlock()
+		return err
+	}
+	file, err := c.File(historyPath(path))
+	if err != nil {
+		m.historyMu.Unlock()
+		if errors.Is(err, object.ErrFileNotFound) {
+			return fmt.Errorf("%s has no version in commit %s", path, commit)
+		}
+		return fmt.Errorf("failed to read version %s: %w", commit, err)
+	}
+	data, err := file.Contents()
+	m.historyMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to read version %s: %w", commit, err)
+	}
+
+	if err := replaceFile(path, []byte(data), 0); err != nil {
+		return err
+	}
+	content, err := m.readConfig(path, config.Format)
+	if err != nil {
+		return fmt.Errorf("failed to read restored config: %w", err)
+	}
+	checksum, err := m.calculateChecksum(path)
+	if err != nil {
+		return fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	reason := fmt.Sprintf("Roll back %s to %s", path, c.Hash.String()[:12])
+	m.recordChange(ConfigChange{
+		Path:      path,
+		Type:      config.Type,
+		Format:    config.Format,
+		OldValue:  config.Content,
+		NewValue:  content,
+		Timestamp: time.Now(),
+		User:      user,
+		Reason:    reason,
+	})
+	config.Content = content
+	config.Checksum = checksum
+	config.ModTime = time.Now()
+
+	return m.commitVersion(path, user, reason)
+}
+
+func resolveCommit(repo *git.Repository, rev string) (*object.Commit, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("unknown config version %s: %w", rev, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version %s: %w", rev, err)
+	}
+	return commit, nil
+}
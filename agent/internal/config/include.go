@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// envRef matches ${VAR} and ${VAR:-default}, and $${...} which escapes a
+// literal ${...}
+var envRef = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces environment variable references in config content.
+// A variable that is unset and has no default is an error.
+func expandEnv(data []byte) ([]byte, error) {
+	var missing []string
+	out := envRef.ReplaceAllFunc(data, func(ref []byte) []byte {
+		if bytes.HasPrefix(ref, []byte("$$")) {
+			return ref[1:]
+		}
+		m := envRef.FindSubmatch(ref)
+		if value, ok := os.LookupEnv(string(m[1])); ok {
+			return []byte(value)
+		}
+		if m[2] != nil {
+			return m[3]
+		}
+		missing = append(missing, string(m[1]))
+		return ref
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined environment variables: %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// readLayered rereads the config file found by v with environment
+// variables expanded, then merges the drop-in files its include directive
+// names. Relative include patterns are resolved against the directory of
+// the config file; matches are merged in lexical order, so later files
+// override earlier ones. Drop-ins can't include further files. It returns
+// the files read.
+func readLayered(v *viper.Viper) ([]string, error) {
+	path := v.ConfigFileUsed()
+	if err := readExpanded(path, v.ReadConfig); err != nil {
+		return nil, err
+	}
+
+	patterns := includePatterns(path, v.GetStringSlice("include"))
+	files := []string{path}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %s: %w", pattern, err)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	for _, file := range files[1:] {
+		if err := readExpanded(file, v.MergeConfig); err != nil {
+			return nil, err
+		}
+	}
+	// Keep the directive as written rather than as a drop-in changed it
+	v.Set("include", patterns)
+	return files, nil
+}
+
+// includePatterns resolves relative include patterns against the
+// directory of the config file
+func includePatterns(path string, patterns []string) []string {
+	resolved := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		resolved = append(resolved, pattern)
+	}
+	return resolved
+}
+
+func readExpanded(path string, read func(in io.Reader) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	if data, err = expandEnv(data); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	if err := read(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// unknownKeys returns the settings, as dotted keys, that match no field of
+// the config. Maps such as agent.labels accept any key.
+func unknownKeys(settings map[string]interface{}, t reflect.Type, prefix string) []string {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = f.Type
+	}
+
+	var unknown []string
+	for key, value := range settings {
+		ft, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, prefix+key)
+			continue
+		}
+		nested, isMap := value.(map[string]interface{})
+		if isMap && ft.Kind() == reflect.Struct {
+			unknown = append(unknown, unknownKeys(nested, ft, prefix+key+".")...)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
@@ -17,6 +17,9 @@ import (
 	"github.com/go-git/go-git/v5"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
+
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/store"
 )
 
 // ConfigType represents the type of configuration
@@ -73,10 +76,29 @@ type Manager struct {
 	changes   []ConfigChange
 	mu        sync.RWMutex
 	scheduler *CommandScheduler
-	dashboard *AgentHealthDashboard
 	plugins   *PluginSystem
 	metrics   *EnhancedMetrics
 	alerts    *AlertingSystem
+	// historyDir holds repo; historyMu serializes its use
+	historyDir string
+	historyMu  sync.Mutex
+	// actions run after changes to configs; applied holds the checksum
+	// each action last applied
+	actions       map[string]protocol.ConfigAction
+	applied       map[string]string
+	actionResults []protocol.ConfigActionResult
+	actionMu      sync.Mutex
+	events        chan<- interface{}
+
+	// changes are bounded by count and age, and persisted in
+	// changeRecords when set
+	maxChanges    int
+	changeMaxAge  time.Duration
+	changeRecords *store.Bucket[ConfigChange]
+
+	// writeAllowlist are the paths besides the managed configs that may
+	// be written
+	writeAllowlist []string
 }
 
 // NewManager creates a new configuration manager
@@ -87,7 +109,6 @@ func NewManager(logger *zap.Logger) (*Manager, error) {
 	}
 
 	scheduler := &CommandScheduler{}
-	dashboard := &AgentHealthDashboard{}
 	plugins := &PluginSystem{}
 	metrics := &EnhancedMetrics{}
 	alerts := &AlertingSystem{}
@@ -98,13 +119,22 @@ func NewManager(logger *zap.Logger) (*Manager, error) {
 		watcher:   watcher,
 		changes:   make([]ConfigChange, 0),
 		scheduler: scheduler,
-		dashboard: dashboard,
 		plugins:   plugins,
 		metrics:   metrics,
 		alerts:    alerts,
+		actions:   make(map[string]protocol.ConfigAction),
+		applied:   make(map[string]string),
+
+		maxChanges:   DefaultMaxChanges,
+		changeMaxAge: DefaultChangeMaxAge,
 	}, nil
 }
 
+// SetMaintenance suppresses alerts during maintenance
+func (m *Manager) SetMaintenance(maintenance interface{ Active(component string) bool }) {
+	m.alerts.Maintenance = maintenance
+}
+
 // Start begins configuration management
 func (m *Manager) Start(ctx context.Context) error {
 	// Start watching files
@@ -136,9 +166,6 @@ func (m *Manager) Start(ctx context.Context) error {
 	// Start command scheduler
 	go m.scheduler.Start()
 
-	// Start health dashboard
-	go m.dashboard.Start()
-
 	// Start plugin system
 	go m.plugins.Start()
 
@@ -192,6 +219,10 @@ func (m *Manager) AddConfig(path string, configType ConfigType) error {
 	m.configs[absPath] = config
 	m.mu.Unlock()
 
+	if err := m.commitVersion(absPath, "", "Start tracking "+absPath); err != nil {
+		m.logger.Warn("Failed to record config version", zap.String("path", absPath), zap.Error(err))
+	}
+
 	// Start watching file
 	if err := m.watcher.Add(absPath); err != nil {
 		return fmt.Errorf("failed to watch file: %w", err)
@@ -236,10 +267,18 @@ func (m *Manager) readConfig(path string, format ConfigFormat) (map[string]inter
 		if err := yaml.NewDecoder(file).Decode(&content); err != nil {
 			return nil, fmt.Errorf("failed to decode YAML config %s: %w", path, err)
 		}
-	case FormatINI:
-		return nil, fmt.Errorf("INI format not implemented for config file %s", path)
-	case FormatENV:
-		return nil, fmt.Errorf("ENV format not implemented for config file %s", path)
+	case FormatINI, FormatENV:
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+		parse := parseINI
+		if format == FormatENV {
+			parse = parseENV
+		}
+		if content, err = parse(data); err != nil {
+			return nil, fmt.Errorf("failed to decode %s config %s: %w", strings.ToUpper(string(format)), path, err)
+		}
 	default:
 		return nil, fmt.Errorf("unsupported format for config file %s: %s", path, format)
 	}
@@ -294,30 +333,48 @@ func (m *Manager) handleFileChange(path string) error {
 		NewValue:  newContent,
 		Timestamp: time.Now(),
 	}
-	m.changes = append(m.changes, change)
+	m.recordChange(change)
 
 	// Update config
 	config.Content = newContent
 	config.Checksum = newChecksum
 	config.ModTime = time.Now()
 
+	if err := m.commitVersion(path, "", "Change detected in "+path); err != nil {
+		m.logger.Warn("Failed to record config version", zap.String("path", path), zap.Error(err))
+	}
+	if _, ok := m.actions[path]; ok {
+		go m.runAction(path)
+	}
+
 	return nil
 }
 
-// GetConfig returns a configuration file
+// GetConfig returns a copy of a configuration file
 func (m *Manager) GetConfig(path string) (*ConfigFile, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	config, ok := m.configs[path]
-	return config, ok
+	if !ok {
+		return nil, false
+	}
+	return config.clone(), true
 }
 
-// GetChanges returns configuration changes
-func (m *Manager) GetChanges() []ConfigChange {
+// GetChanges returns copies of the configuration changes filter matches,
+// oldest first
+func (m *Manager) GetChanges(filter ChangeFilter) []ConfigChange {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.changes
+
+	changes := make([]ConfigChange, 0, len(m.changes))
+	for _, change := range m.changes {
+		if filter.matches(change) {
+			changes = append(changes, change.clone())
+		}
+	}
+	return changes
 }
 
 // ValidateConfig validates a configuration file
@@ -361,24 +418,18 @@ func (m *Manager) RollbackChange(path string) error {
 	}
 
 	// Write content based on format
-	var data []byte
-	var err error
-
-	switch config.Format {
-	case FormatJSON:
-		data, err = json.MarshalIndent(lastChange.OldValue, "", "  ")
-	case FormatYAML:
-		data, err = yaml.Marshal(lastChange.OldValue)
-	default:
-		return fmt.Errorf("unsupported format for rollback: %s", config.Format)
+	old, _ := lastChange.OldValue.(map[string]interface{})
+	data, err := encodeContent(path, config.Format, old)
+	if err != nil {
+		return err
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to marshal content: %w", err)
+	if err := replaceFile(path, data, 0); err != nil {
+		return err
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	if err := m.commitVersion(path, "", "Roll back last change to "+path); err != nil {
+		m.logger.Warn("Failed to record config version", zap.String("path", path), zap.Error(err))
 	}
 
 	return nil
@@ -476,7 +527,7 @@ func (m *Manager) GetPluginConfig(pluginName string) map[string]interface{} {
 		if config.Type == TypeService {
 			if plugins, ok := config.Content["plugins"].(map[string]interface{}); ok {
 				if pluginConfig, ok := plugins[pluginName].(map[string]interface{}); ok {
-					return pluginConfig
+					return copyContent(pluginConfig)
 				}
 			}
 		}
@@ -507,20 +558,6 @@ func (cs *CommandScheduler) Start() {
 	}
 }
 
-// AgentHealthDashboard provides a web-based dashboard for monitoring agent health.
-type AgentHealthDashboard struct{}
-
-// StartHealthDashboard starts the health dashboard server.
-func (a *AgentHealthDashboard) StartHealthDashboard() {
-	// Start the dashboard server
-	fmt.Println("Starting health dashboard server...")
-}
-
-// Start starts the health dashboard.
-func (a *AgentHealthDashboard) Start() {
-	a.StartHealthDashboard()
-}
-
 // PluginSystem allows for extending agent functionality with custom plugins.
 type PluginSystem struct {
 	plugins map[string]Plugin
@@ -553,10 +590,17 @@ func (m *EnhancedMetrics) Start() {
 }
 
 // AlertingSystem notifies users of critical events.
-type AlertingSystem struct{}
+type AlertingSystem struct {
+	// Maintenance suppresses alerts while "alerting" or the whole agent is
+	// in maintenance
+	Maintenance interface{ Active(component string) bool }
+}
 
 // SendAlert sends an alert notification.
 func (as *AlertingSystem) SendAlert(message string) {
+	if as.Maintenance != nil && as.Maintenance.Active("alerting") {
+		return
+	}
 	// Send alert
 	fmt.Println("Sending alert:", message)
 }
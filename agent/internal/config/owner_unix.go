@@ -0,0 +1,22 @@
+//go:build !windows
+
+package config
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the uid and gid owning a file
+func fileOwner(info os.FileInfo) (int, int) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return int(stat.Uid), int(stat.Gid)
+}
+
+// chownLike gives f the owner of the file described by info
+func chownLike(f *os.File, info os.FileInfo) error {
+	return f.Chown(fileOwner(info))
+}
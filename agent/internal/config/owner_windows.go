@@ -0,0 +1,13 @@
+package config
+
+import "os"
+
+// fileOwner is unsupported on Windows, where ownership is not tracked
+func fileOwner(info os.FileInfo) (int, int) {
+	return 0, 0
+}
+
+// chownLike does nothing on Windows, where ownership is not tracked
+func chownLike(f *os.File, info os.FileInfo) error {
+	return nil
+}
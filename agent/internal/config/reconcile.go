@@ -0,0 +1,429 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Desired state policies
+const (
+	// PolicyEnforce reverts drift
+	PolicyEnforce = "enforce"
+	// PolicyMonitor only reports drift
+	PolicyMonitor = "monitor"
+)
+
+const (
+	// reconcileInterval is how often all desired config state is checked
+	reconcileInterval = time.Minute
+	// settleDelay lets an edit finish before the file is checked
+	settleDelay = time.Second
+	// maxDriftDiff bounds the diff reported with content drift
+	maxDriftDiff = 64 * 1024
+)
+
+// Reconciler enforces the state the server declares for config files.
+// Files under the enforce policy are reverted when they drift; monitored
+// files only report it. Drift is checked when a file changes and
+// periodically, and sent to events.
+type Reconciler struct {
+	logger  *zap.Logger
+	manager *Manager
+	events  chan<- interface{}
+	desired map[string]protocol.DesiredConfig
+	watcher *fsnotify.Watcher
+	// watched counts the desired files in each watched directory
+	watched     map[string]int
+	mu          sync.Mutex
+	reconcileMu sync.Mutex
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+// NewReconciler creates a reconciler writing through manager, so that
+// reverts are recorded in the config history
+func NewReconciler(logger *zap.Logger, manager *Manager, events chan<- interface{}) (*Reconciler, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	return &Reconciler{
+		logger:  logger,
+		manager: manager,
+		events:  events,
+		desired: make(map[string]protocol.DesiredConfig),
+		watcher: watcher,
+		watched: make(map[string]int),
+	}, nil
+}
+
+// Start checks desired state in the background
+func (r *Reconciler) Start(ctx context.Context) error {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+		settle := time.NewTimer(settleDelay)
+		settle.Stop()
+		pending := make(map[string]bool)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.Reconcile()
+			case event, ok := <-r.watcher.Events:
+				if !ok {
+					return
+				}
+				if r.isDesired(event.Name) {
+					pending[filepath.Clean(event.Name)] = true
+					settle.Reset(settleDelay)
+				}
+			case err, ok := <-r.watcher.Errors:
+				if !ok {
+					return
+				}
+				r.logger.Error("Watcher error", zap.Error(err))
+			case <-settle.C:
+				paths := make([]string, 0, len(pending))
+				for path := range pending {
+					paths = append(paths, path)
+				}
+				pending = make(map[string]bool)
+				r.reconcile(paths)
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the reconciler
+func (r *Reconciler) Shutdown(ctx context.Context) error {
+	if r.cancel != nil {
+		r.cancel()
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return r.watcher.Close()
+}
+
+// SetDesired replaces the desired state of all files and reconciles them
+// right away. Files without a desired state are left alone.
+func (r *Reconciler) SetDesired(configs []protocol.DesiredConfig) ([]protocol.ConfigDrift, error) {
+	desired := make(map[string]protocol.DesiredConfig, len(configs))
+	for _, c := range configs {
+		if c.Path == "" || !filepath.IsAbs(c.Path) {
+			return nil, fmt.Errorf("an absolute path is required: %q", c.Path)
+		}
+		c.Path = filepath.Clean(c.Path)
+		if _, ok := desired[c.Path]; ok {
+			return nil, fmt.Errorf("duplicate desired state for %s", c.Path)
+		}
+		switch c.Policy {
+		case "":
+			c.Policy = PolicyMonitor
+		case PolicyEnforce, PolicyMonitor:
+		default:
+			return nil, fmt.Errorf("unknown policy for %s: %s", c.Path, c.Policy)
+		}
+		if c.Content == nil && c.Mode == 0 && c.Owner == "" && c.Group == "" {
+			return nil, fmt.Errorf("no desired state for %s", c.Path)
+		}
+		if _, _, err := lookupOwner(c.Owner, c.Group); err != nil {
+			return nil, fmt.Errorf("invalid desired state for %s: %w", c.Path, err)
+		}
+		desired[c.Path] = c
+	}
+
+	r.mu.Lock()
+	r.desired = desired
+	r.updateWatches()
+	r.mu.Unlock()
+
+	r.logger.Info("Desired config state updated", zap.Int("files", len(desired)))
+	return r.Reconcile(), nil
+}
+
+// Desired returns the desired state of all files, sorted by path
+func (r *Reconciler) Desired() []protocol.DesiredConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	configs := make([]protocol.DesiredConfig, 0, len(r.desired))
+	for _, c := range r.desired {
+		configs = append(configs, c)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Path < configs[j].Path })
+	return configs
+}
+
+// Reconcile checks every file against its desired state and reverts the
+// enforced ones that drifted. It returns the drift found, including drift
+// that was reverted.
+func (r *Reconciler) Reconcile() []protocol.ConfigDrift {
+	return r.reconcile(nil)
+}
+
+// reconcile checks the given files, or all of them if paths is nil
+func (r *Reconciler) reconcile(paths []string) []protocol.ConfigDrift {
+	r.reconcileMu.Lock()
+	defer r.reconcileMu.Unlock()
+
+	r.mu.Lock()
+	var configs []protocol.DesiredConfig
+	if paths == nil {
+		for _, c := range r.desired {
+			configs = append(configs, c)
+		}
+	}
+	for _, path := range paths {
+		if c, ok := r.desired[path]; ok {
+			configs = append(configs, c)
+		}
+	}
+	r.mu.Unlock()
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Path < configs[j].Path })
+
+	var drifts []protocol.ConfigDrift
+	for _, c := range configs {
+		drift := r.reconcileFile(c)
+		if len(drift.Fields) == 0 && !drift.Missing && drift.Error == "" {
+			continue
+		}
+		r.logger.Warn("Config drifted from desired state",
+			zap.String("path", drift.Path),
+			zap.Strings("fields", drift.Fields),
+			zap.Bool("missing", drift.Missing),
+			zap.Bool("reconciled", drift.Reconciled),
+			zap.String("error", drift.Error))
+		r.emit(drift)
+		drifts = append(drifts, drift)
+	}
+	return drifts
+}
+
+// reconcileFile diffs one file against its desired state and, under the
+// enforce policy, reverts it
+func (r *Reconciler) reconcileFile(c protocol.DesiredConfig) protocol.ConfigDrift {
+	drift := protocol.ConfigDrift{Path: c.Path, Policy: c.Policy, CheckedAt: time.Now()}
+	uid, gid, err := lookupOwner(c.Owner, c.Group)
+	if err != nil {
+		drift.Error = err.Error()
+		return drift
+	}
+
+	var current []byte
+	info, err := os.Stat(c.Path)
+	switch {
+	case os.IsNotExist(err):
+		drift.Missing = true
+	case err != nil:
+		drift.Error = err.Error()
+		return drift
+	default:
+		if c.Content != nil {
+			if current, err = os.ReadFile(c.Path); err != nil {
+				drift.Error = err.Error()
+				return drift
+			}
+		}
+	}
+
+	if c.Content != nil {
+		drift.Expected = checksum([]byte(*c.Content))
+		if !drift.Missing {
+			drift.Actual = checksum(current)
+			if drift.Actual != drift.Expected {
+				drift.Fields = append(drift.Fields, "content")
+				drift.Diff = unifiedDiff(c.Path, *c.Content, string(current), maxDriftDiff)
+			}
+		}
+	}
+	if !drift.Missing {
+		fileUID, fileGID := fileOwner(info)
+		if c.Mode != 0 && info.Mode().Perm() != os.FileMode(c.Mode).Perm() {
+			drift.Fields = append(drift.Fields, "mode")
+		}
+		if uid >= 0 && fileUID != uid {
+			drift.Fields = append(drift.Fields, "owner")
+		}
+		if gid >= 0 && fileGID != gid {
+			drift.Fields = append(drift.Fields, "group")
+		}
+	}
+
+	if c.Policy != PolicyEnforce || (len(drift.Fields) == 0 && !drift.Missing) {
+		return drift
+	}
+	if drift.Missing && c.Content == nil {
+		drift.Error = "file is missing and has no desired content"
+		return drift
+	}
+	if err := r.revert(c, drift, uid, gid); err != nil {
+		drift.Error = err.Error()
+		return drift
+	}
+	drift.Reconciled = true
+	r.logger.Info("Reverted config to desired state", zap.String("path", c.Path))
+	return drift
+}
+
+// revert restores the drifted fields of a file
+func (r *Reconciler) revert(c protocol.DesiredConfig, drift protocol.ConfigDrift, uid, gid int) error {
+	mode := os.FileMode(c.Mode).Perm()
+	if drift.Missing || hasField(drift.Fields, "content") {
+		reason := "Revert drift in " + c.Path
+		if drift.Missing {
+			reason = "Restore missing " + c.Path
+		}
+		if _, err := r.manager.writeVersioned(c.Path, []byte(*c.Content), mode, "", reason); err != nil {
+			return err
+		}
+	}
+	if mode != 0 {
+		if err := os.Chmod(c.Path, mode); err != nil {
+			return fmt.Errorf("failed to set mode of %s: %w", c.Path, err)
+		}
+	}
+	if uid >= 0 || gid >= 0 {
+		if err := os.Chown(c.Path, uid, gid); err != nil {
+			return fmt.Errorf("failed to set owner of %s: %w", c.Path, err)
+		}
+	}
+	return nil
+}
+
+// HandleRequest applies a config state request received from the server
+func (r *Reconciler) HandleRequest(req protocol.ConfigStateRequest) (interface{}, error) {
+	switch req.Action {
+	case "set":
+		return r.SetDesired(req.Configs)
+	case "", "drift":
+		return r.Reconcile(), nil
+	case "list":
+		return r.Desired(), nil
+	default:
+		return nil, fmt.Errorf("unknown config state action: %s", req.Action)
+	}
+}
+
+// HandleCommand processes config state commands
+func (r *Reconciler) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "config:drift":
+		return r.Reconcile(), nil
+	case "config:desired":
+		return r.Desired(), nil
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown config command: %s", cmd)
+	}
+}
+
+func (r *Reconciler) isDesired(path string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.desired[filepath.Clean(path)]
+	return ok
+}
+
+// updateWatches watches the directories of the desired files, so that
+// files replaced by rename or recreated are still noticed. The caller
+// holds mu.
+func (r *Reconciler) updateWatches() {
+	dirs := make(map[string]int)
+	for path := range r.desired {
+		dirs[filepath.Dir(path)]++
+	}
+	for dir := range r.watched {
+		if _, ok := dirs[dir]; !ok {
+			_ = r.watcher.Remove(dir)
+		}
+	}
+	for dir := range dirs {
+		if _, ok := r.watched[dir]; ok {
+			continue
+		}
+		if err := r.watcher.Add(dir); err != nil {
+			// The periodic check still covers the files
+			r.logger.Warn("Failed to watch config directory", zap.String("dir", dir), zap.Error(err))
+			delete(dirs, dir)
+		}
+	}
+	r.watched = dirs
+}
+
+func (r *Reconciler) emit(drift protocol.ConfigDrift) {
+	if r.events == nil {
+		return
+	}
+	select {
+	case r.events <- drift:
+	default:
+		r.logger.Warn("Failed to send config drift: channel full")
+	}
+}
+
+// lookupOwner resolves user and group names or ids. An empty name
+// resolves to -1, which leaves that part of the ownership alone.
+func lookupOwner(owner, group string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner != "" {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			if u, err = user.LookupId(owner); err != nil {
+				return 0, 0, fmt.Errorf("unknown user %s", owner)
+			}
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("unsupported uid %s for %s", u.Uid, owner)
+		}
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			if g, err = user.LookupGroupId(group); err != nil {
+				return 0, 0, fmt.Errorf("unknown group %s", group)
+			}
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("unsupported gid %s for %s", g.Gid, group)
+		}
+	}
+	return uid, gid, nil
+}
+
+func hasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
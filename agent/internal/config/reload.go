@@ -0,0 +1,283 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+)
+
+// reloadDelay lets edits to the config files finish before reloading
+const reloadDelay = time.Second
+
+// Change is a setting that differs between two configs
+type Change struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// ReloadReport describes a reload of the agent config
+type ReloadReport struct {
+	Changes []Change `json:"changes,omitempty"`
+	// Applied are the changed keys applied while running
+	Applied []string `json:"applied,omitempty"`
+	// Failed maps changed keys to the error applying them
+	Failed map[string]string `json:"failed,omitempty"`
+	// RestartRequired are the changed keys that only take effect after a
+	// restart
+	RestartRequired []string  `json:"restart_required,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// reloadHandler applies changes to the keys under prefix
+type reloadHandler struct {
+	prefix string
+	apply  func(*Config) error
+}
+
+// Reloader reloads the agent config on SIGHUP or when one of its files
+// changes, and hands the changed settings to the components that can
+// apply them while running. Reports are sent to events.
+type Reloader struct {
+	logger   *zap.Logger
+	events   chan<- interface{}
+	current  *Config
+	handlers []reloadHandler
+	load     func() (*Config, error)
+	watcher  *fsnotify.Watcher
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewReloader creates a reloader for the config loaded at startup
+func NewReloader(logger *zap.Logger, current *Config, events chan<- interface{}) (*Reloader, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	return &Reloader{
+		logger:  logger,
+		events:  events,
+		current: current,
+		load:    Load,
+		watcher: watcher,
+	}, nil
+}
+
+// OnChange registers apply for changes to key and the keys under it. It
+// is called with the new config once per reload, however many of its keys
+// changed.
+func (r *Reloader) OnChange(key string, apply func(*Config) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers = append(r.handlers, reloadHandler{prefix: key, apply: apply})
+}
+
+// Current returns the config in effect
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Start reloads on SIGHUP and on changes to the config files
+func (r *Reloader) Start(ctx context.Context) error {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+	r.watchFiles(r.Current())
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	crash.Go("config-reloader", func() {
+		defer close(r.done)
+		defer signal.Stop(hup)
+		settle := time.NewTimer(reloadDelay)
+		settle.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				r.logger.Info("Received SIGHUP, reloading config")
+				r.Reload()
+			case event, ok := <-r.watcher.Events:
+				if !ok {
+					return
+				}
+				if r.isConfigFile(event.Name) {
+					settle.Reset(reloadDelay)
+				}
+			case err, ok := <-r.watcher.Errors:
+				if !ok {
+					return
+				}
+				r.logger.Error("Watcher error", zap.Error(err))
+			case <-settle.C:
+				r.logger.Info("Config files changed, reloading config")
+				r.Reload()
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown stops reloading
+func (r *Reloader) Shutdown(ctx context.Context) error {
+	if r.cancel != nil {
+		r.cancel()
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return r.watcher.Close()
+}
+
+// Reload loads the config again and applies what changed. A config that
+// fails to load leaves the current one in effect.
+func (r *Reloader) Reload() ReloadReport {
+	report := ReloadReport{Timestamp: time.Now()}
+	next, err := r.load()
+	if err != nil {
+		report.Error = err.Error()
+		r.logger.Error("Failed to reload config", zap.Error(err))
+		r.emit(report)
+		return report
+	}
+
+	r.mu.Lock()
+	previous := r.current
+	r.current = next
+	handlers := append([]reloadHandler(nil), r.handlers...)
+	r.mu.Unlock()
+
+	report.Changes = Diff(previous, next)
+	if len(report.Changes) == 0 {
+		r.logger.Info("Config reloaded without changes")
+		return report
+	}
+
+	applied := make(map[string]error)
+	for _, c := range report.Changes {
+		handled := false
+		for _, h := range handlers {
+			if c.Key != h.prefix && !strings.HasPrefix(c.Key, h.prefix+".") {
+				continue
+			}
+			handled = true
+			err, done := applied[h.prefix]
+			if !done {
+				err = h.apply(next)
+				applied[h.prefix] = err
+			}
+			if err != nil {
+				if report.Failed == nil {
+					report.Failed = make(map[string]string)
+				}
+				report.Failed[c.Key] = err.Error()
+			}
+		}
+		switch {
+		case !handled:
+			report.RestartRequired = append(report.RestartRequired, c.Key)
+		case report.Failed[c.Key] == "":
+			report.Applied = append(report.Applied, c.Key)
+		}
+	}
+	r.watchFiles(next)
+
+	r.logger.Info("Config reloaded",
+		zap.Strings("applied", report.Applied),
+		zap.Int("failed", len(report.Failed)),
+		zap.Strings("restart_required", report.RestartRequired))
+	r.emit(report)
+	return report
+}
+
+// watchFiles watches the directories of the config files and drop-ins, so
+// that replaced, new and removed files are noticed
+func (r *Reloader) watchFiles(cfg *Config) {
+	dirs := make(map[string]bool)
+	for _, f := range cfg.Files {
+		dirs[filepath.Dir(f)] = true
+	}
+	for _, pattern := range cfg.Include {
+		dirs[filepath.Dir(pattern)] = true
+	}
+	for dir := range dirs {
+		if err := r.watcher.Add(dir); err != nil {
+			r.logger.Warn("Failed to watch config directory", zap.String("dir", dir), zap.Error(err))
+		}
+	}
+}
+
+// isConfigFile reports whether path is one of the config files or could
+// be a drop-in
+func (r *Reloader) isConfigFile(path string) bool {
+	cfg := r.Current()
+	for _, f := range cfg.Files {
+		if f == path {
+			return true
+		}
+	}
+	for _, pattern := range cfg.Include {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) emit(report ReloadReport) {
+	if r.events == nil {
+		return
+	}
+	select {
+	case r.events <- report:
+	default:
+		r.logger.Warn("Failed to send config reload report: channel full")
+	}
+}
+
+// Diff returns the settings that differ between two configs, as dotted
+// keys
+func Diff(old, new *Config) []Change {
+	return diffValues(reflect.ValueOf(*old), reflect.ValueOf(*new), "")
+}
+
+func diffValues(a, b reflect.Value, prefix string) []Change {
+	var changes []Change
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		fa, fb := a.Field(i), b.Field(i)
+		if fa.Kind() == reflect.Struct {
+			changes = append(changes, diffValues(fa, fb, prefix+name+".")...)
+			continue
+		}
+		if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			changes = append(changes, Change{Key: prefix + name, Old: fa.Interface(), New: fb.Interface()})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ChangeFilter selects config changes. Zero fields match every change.
+type ChangeFilter struct {
+	// Path is a config path or a glob matching config paths
+	Path  string
+	Since time.Time
+	Until time.Time
+}
+
+func (f ChangeFilter) matches(c ConfigChange) bool {
+	if f.Path != "" && f.Path != c.Path {
+		if ok, _ := filepath.Match(f.Path, c.Path); !ok {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && c.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && c.Timestamp.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Snapshot is every managed config and the change history at one time
+type Snapshot struct {
+	Taken   time.Time      `json:"taken"`
+	Configs []ConfigFile   `json:"configs"`
+	Changes []ConfigChange `json:"changes,omitempty"`
+}
+
+// Snapshot returns copies of the managed configs, by path, and of their
+// changes
+func (m *Manager) Snapshot() Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshot := Snapshot{
+		Taken:   time.Now(),
+		Configs: make([]ConfigFile, 0, len(m.configs)),
+		Changes: make([]ConfigChange, 0, len(m.changes)),
+	}
+	for _, config := range m.configs {
+		snapshot.Configs = append(snapshot.Configs, *config.clone())
+	}
+	sort.Slice(snapshot.Configs, func(i, j int) bool {
+		return snapshot.Configs[i].Path < snapshot.Configs[j].Path
+	})
+	for _, change := range m.changes {
+		snapshot.Changes = append(snapshot.Changes, change.clone())
+	}
+	return snapshot
+}
+
+// ExportSnapshot writes a snapshot to w as JSON
+func (m *Manager) ExportSnapshot(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m.Snapshot()); err != nil {
+		return fmt.Errorf("failed to export config snapshot: %w", err)
+	}
+	return nil
+}
+
+// ImportSnapshot reads a snapshot written by ExportSnapshot and restores
+// its configs: files whose content differs are rewritten, and configs not
+// managed yet are added. Each restored file is recorded as a change by
+// user. The change history of the snapshot is not imported.
+func (m *Manager) ImportSnapshot(r io.Reader, user string) error {
+	var snapshot Snapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return fmt.Errorf("invalid config snapshot: %w", err)
+	}
+
+	reason := "Import snapshot taken " + snapshot.Taken.Format(time.RFC3339)
+	for _, config := range snapshot.Configs {
+		if err := m.restore(config, user, reason); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", config.Path, err)
+		}
+	}
+	return nil
+}
+
+// restore writes the content of a config from a snapshot
+func (m *Manager) restore(want ConfigFile, user, reason string) error {
+	if !filepath.IsAbs(want.Path) {
+		return fmt.Errorf("path must be absolute")
+	}
+
+	m.mu.Lock()
+	config, managed := m.configs[want.Path]
+	if managed && config.Checksum == want.Checksum {
+		m.mu.Unlock()
+		return nil
+	}
+	if !managed {
+		config = &ConfigFile{Path: want.Path, Type: want.Type, Format: want.Format}
+	}
+
+	data, err := encodeContent(want.Path, want.Format, want.Content)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	if err := replaceFile(want.Path, data, 0); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	content, err := m.readConfig(want.Path, want.Format)
+	if err != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("failed to read restored config: %w", err)
+	}
+	checksum, err := m.calculateChecksum(want.Path)
+	if err != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	m.recordChange(ConfigChange{
+		Path:      want.Path,
+		Type:      config.Type,
+		Format:    config.Format,
+		OldValue:  config.Content,
+		NewValue:  content,
+		Timestamp: time.Now(),
+		User:      user,
+		Reason:    reason,
+	})
+	config.Content = content
+	config.Checksum = checksum
+	config.ModTime = time.Now()
+	m.configs[want.Path] = config
+	if err := m.commitVersion(want.Path, user, reason); err != nil {
+		m.logger.Warn("Failed to record config version", zap.String("path", want.Path), zap.Error(err))
+	}
+	m.mu.Unlock()
+
+	if !managed {
+		if err := m.watcher.Add(want.Path); err != nil {
+			return fmt.Errorf("failed to watch file: %w", err)
+		}
+	}
+	return nil
+}
+
+// encodeContent renders content in format. INI and ENV files keep the
+// comments and layout of the file at path.
+func encodeContent(path string, format ConfigFormat, content map[string]interface{}) ([]byte, error) {
+	var data []byte
+	var err error
+	switch format {
+	case FormatJSON:
+		data, err = json.MarshalIndent(content, "", "  ")
+	case FormatYAML:
+		data, err = yaml.Marshal(content)
+	case FormatINI, FormatENV:
+		template, readErr := os.ReadFile(path)
+		if readErr != nil && !os.IsNotExist(readErr) {
+			return nil, fmt.Errorf("failed to read file: %w", readErr)
+		}
+		if format == FormatINI {
+			data, err = marshalINI(content, template)
+		} else {
+			data, err = marshalENV(content, template)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal content: %w", err)
+	}
+	return data, nil
+}
+
+// clone returns a deep copy of the config
+func (c *ConfigFile) clone() *ConfigFile {
+	clone := *c
+	clone.Content = copyContent(c.Content)
+	return &clone
+}
+
+// clone returns a deep copy of the change
+func (c ConfigChange) clone() ConfigChange {
+	c.OldValue = copyValue(c.OldValue)
+	c.NewValue = copyValue(c.NewValue)
+	return c
+}
+
+func copyContent(content map[string]interface{}) map[string]interface{} {
+	if content == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(content))
+	for key, value := range content {
+		copied[key] = copyValue(value)
+	}
+	return copied
+}
+
+// copyValue deep copies the maps and slices of decoded config content
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyContent(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
@@ -0,0 +1,337 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// HostFacts are the host variables available to config templates
+type HostFacts struct {
+	AgentID  string `json:"agent_id"`
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	CPUs     int    `json:"cpus"`
+	// MemoryMB is the total memory
+	MemoryMB uint64 `json:"memory_mb"`
+	// IP is the first non-loopback IPv4 address, or IPv6 if there is none
+	IP  string   `json:"ip"`
+	IPs []string `json:"ips"`
+	// Interfaces maps interface names to their addresses
+	Interfaces map[string][]string `json:"interfaces"`
+	Labels     map[string]string   `json:"labels"`
+}
+
+// CollectFacts gathers the facts of this host
+func CollectFacts(agentID string, labels map[string]string) HostFacts {
+	facts := HostFacts{
+		AgentID:    agentID,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		CPUs:       runtime.NumCPU(),
+		Interfaces: make(map[string][]string),
+		Labels:     make(map[string]string, len(labels)),
+	}
+	facts.Hostname, _ = os.Hostname()
+	if vm, err := mem.VirtualMemory(); err == nil {
+		facts.MemoryMB = vm.Total / (1024 * 1024)
+	}
+	for k, v := range labels {
+		facts.Labels[k] = v
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return facts
+	}
+	var v6 string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ip := ipNet.IP.String()
+			facts.IPs = append(facts.IPs, ip)
+			facts.Interfaces[iface.Name] = append(facts.Interfaces[iface.Name], ip)
+			switch {
+			case ipNet.IP.To4() != nil && facts.IP == "":
+				facts.IP = ip
+			case ipNet.IP.To4() == nil && v6 == "":
+				v6 = ip
+			}
+		}
+	}
+	if facts.IP == "" {
+		facts.IP = v6
+	}
+	return facts
+}
+
+// templateData is what templates are executed with: the host facts, plus
+// the variables pushed with the template as .Vars
+type templateData struct {
+	HostFacts
+	Vars map[string]string
+}
+
+// templateFuncs are the functions available to config templates
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+	"split": strings.Split,
+	"trim":  strings.TrimSpace,
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+	"sortedKeys": func(m map[string]string) []string {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	},
+}
+
+// RenderTemplate executes a template with the host facts. Referencing a
+// missing variable or label is an error.
+func RenderTemplate(text string, facts HostFacts, vars map[string]string) ([]byte, error) {
+	tmpl, err := template.New("config").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, templateData{HostFacts: facts, Vars: vars}); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Render renders a pushed template and writes the result. The file is only
+// rewritten if its content changes; the new version is recorded in the
+// config history and the file is managed from then on.
+func (m *Manager) Render(req protocol.ConfigTemplate, facts HostFacts) (*protocol.RenderedConfig, error) {
+	if req.Path == "" || !filepath.IsAbs(req.Path) {
+		return nil, fmt.Errorf("an absolute path is required")
+	}
+	path := filepath.Clean(req.Path)
+
+	data, err := RenderTemplate(req.Template, facts, req.Vars)
+	if err != nil {
+		return nil, err
+	}
+	result := &protocol.RenderedConfig{
+		Path:       path,
+		Checksum:   checksum(data),
+		Size:       len(data),
+		RenderedAt: time.Now(),
+	}
+
+	mode := os.FileMode(req.Mode).Perm()
+	current, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		result.Changed = !bytes.Equal(current, data)
+		if info, err := os.Stat(path); err == nil && mode != 0 && info.Mode().Perm() != mode {
+			result.Changed = true
+		}
+	case os.IsNotExist(err):
+		result.Changed = true
+	default:
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if req.DryRun {
+		result.Content = string(data)
+		return result, nil
+	}
+	if !result.Changed {
+		return result, nil
+	}
+
+	if err := m.writeRendered(path, data, mode, req); err != nil {
+		return nil, err
+	}
+
+	m.logger.Info("Config template rendered",
+		zap.String("path", path),
+		zap.String("checksum", result.Checksum))
+	return result, nil
+}
+
+// writeRendered writes a rendering, records it in the config history and
+// manages the file from then on. Files in formats the manager can't parse
+// are only versioned.
+func (m *Manager) writeRendered(path string, data []byte, mode os.FileMode, req protocol.ConfigTemplate) error {
+	reason := req.Reason
+	if reason == "" {
+		reason = "Render template to " + path
+	}
+	managed, err := m.writeVersioned(path, data, mode, req.User, reason)
+	if err != nil {
+		return err
+	}
+	if !managed {
+		if err := m.AddConfig(path, TypeService); err != nil {
+			m.logger.Debug("Rendered config isn't parsed", zap.String("path", path), zap.Error(err))
+			return nil
+		}
+	}
+
+	m.mu.Lock()
+	if config, ok := m.configs[path]; ok {
+		config.Template = req.Template
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// writeVersioned writes a managed or allowlisted file on the agent's
+// behalf, with mode unless it is 0, refreshes it if it is managed and
+// records the new version. It reports whether the file is managed.
+func (m *Manager) writeVersioned(path string, data []byte, mode os.FileMode, user, reason string) (bool, error) {
+	// Holding the lock keeps the watcher from recording the write as an
+	// outside change
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	config, managed := m.configs[path]
+	if !managed {
+		if err := m.allowWrite(path); err != nil {
+			return false, err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	if err := replaceFile(path, data, mode); err != nil {
+		return false, err
+	}
+	if managed {
+		if content, err := m.readConfig(path, config.Format); err == nil {
+			config.Content = content
+		}
+		if checksum, err := m.calculateChecksum(path); err == nil {
+			config.Checksum = checksum
+		}
+		config.ModTime = time.Now()
+	}
+	if err := m.commitVersion(path, user, reason); err != nil {
+		m.logger.Warn("Failed to record config version", zap.String("path", path), zap.Error(err))
+	}
+	return managed, nil
+}
+
+// SetWriteAllowlist sets the paths, along with everything below them,
+// that templates and desired state may write besides the managed configs.
+// An empty allowlist limits them to the managed configs.
+func (m *Manager) SetWriteAllowlist(paths []string) {
+	allowed := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if path != "" {
+			allowed = append(allowed, filepath.Clean(path))
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writeAllowlist = allowed
+}
+
+// allowWrite checks a path that isn't managed against the allowlist. Its
+// directory's symlinks are resolved first, so that a link can't point the
+// write elsewhere. The caller holds m.mu.
+func (m *Manager) allowWrite(path string) error {
+	resolved := filepath.Clean(path)
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(resolved)); err == nil {
+		resolved = filepath.Join(dir, filepath.Base(resolved))
+	}
+	for _, allowed := range m.writeAllowlist {
+		if resolved == allowed || allowed == "/" || strings.HasPrefix(resolved, allowed+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return protocol.Errorf(protocol.ErrorPermission, "%s is neither managed nor allowed to be written", path)
+}
+
+// replaceFile atomically replaces path with data, through a temp file in
+// the same directory. An existing file keeps its owner and, unless mode is
+// set, its permission; a new one gets mode or 0644. A symlink or other
+// special file at path is refused rather than followed.
+func replaceFile(path string, data []byte, mode os.FileMode) error {
+	perm := os.FileMode(0644)
+	existing, err := os.Lstat(path)
+	switch {
+	case err == nil:
+		if !existing.Mode().IsRegular() {
+			return fmt.Errorf("refusing to replace %s: not a regular file", path)
+		}
+		perm = existing.Mode().Perm()
+	case os.IsNotExist(err):
+		existing = nil
+	default:
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if mode != 0 {
+		perm = mode.Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if existing != nil {
+		if err := chownLike(tmp, existing); err != nil {
+			return fail(err)
+		}
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return fail(err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
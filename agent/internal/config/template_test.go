@@ -0,0 +1,182 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+func TestRender(t *testing.T) {
+	facts := HostFacts{Hostname: "web1", CPUs: 4, Labels: map[string]string{"env": "prod"}}
+
+	tests := []struct {
+		name     string
+		template string
+		vars     map[string]string
+		existing string      // content of the file before, none when empty
+		perm     os.FileMode // of the existing file
+		mode     uint32      // requested
+		setup    func(t *testing.T, dir, path string)
+		outside  bool // path isn't below the allowlist
+		want     string
+		wantPerm os.FileMode
+		changed  bool
+		refused  bool
+	}{
+		{
+			name:     "facts and vars",
+			template: "host={{.Hostname}} workers={{.CPUs}} env={{.Labels.env}} port={{.Vars.port}}\n",
+			vars:     map[string]string{"port": "8080"},
+			want:     "host=web1 workers=4 env=prod port=8080\n",
+			wantPerm: 0644,
+			changed:  true,
+		},
+		{
+			name:     "missing var",
+			template: "port={{.Vars.port}}\n",
+			refused:  true,
+		},
+		{
+			name:     "missing label",
+			template: "region={{.Labels.region}}\n",
+			refused:  true,
+		},
+		{
+			name:     "mode of a new file",
+			template: "a\n",
+			mode:     0600,
+			want:     "a\n",
+			wantPerm: 0600,
+			changed:  true,
+		},
+		{
+			name:     "existing file keeps its mode",
+			template: "b\n",
+			existing: "a\n",
+			perm:     0640,
+			want:     "b\n",
+			wantPerm: 0640,
+			changed:  true,
+		},
+		{
+			name:     "mode of an existing file",
+			template: "a\n",
+			existing: "a\n",
+			perm:     0644,
+			mode:     0600,
+			want:     "a\n",
+			wantPerm: 0600,
+			changed:  true,
+		},
+		{
+			name:     "unchanged",
+			template: "a\n",
+			existing: "a\n",
+			perm:     0600,
+			mode:     0600,
+			want:     "a\n",
+			wantPerm: 0600,
+		},
+		{
+			name:     "symlink",
+			template: "a\n",
+			setup: func(t *testing.T, dir, path string) {
+				target := filepath.Join(dir, "target")
+				if err := os.WriteFile(target, []byte("x\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink(target, path); err != nil {
+					t.Fatal(err)
+				}
+			},
+			refused: true,
+		},
+		{
+			name:     "not allowlisted",
+			template: "a\n",
+			outside:  true,
+			refused:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if runtime.GOOS == "windows" && (tt.wantPerm != 0 || tt.setup != nil) {
+				t.Skip("permissions and symlinks differ on Windows")
+			}
+			m, err := NewManager(zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Shutdown(context.Background())
+			m.SetHistoryDir(t.TempDir())
+			allowed := t.TempDir()
+			m.SetWriteAllowlist([]string{allowed})
+
+			dir := allowed
+			if tt.outside {
+				dir = t.TempDir()
+			}
+			path := filepath.Join(dir, "app.conf")
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), tt.perm); err != nil {
+					t.Fatal(err)
+				}
+				// The umask may have narrowed it
+				if err := os.Chmod(path, tt.perm); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.setup != nil {
+				tt.setup(t, dir, path)
+			}
+
+			result, err := m.Render(protocol.ConfigTemplate{Path: path, Template: tt.template, Vars: tt.vars, Mode: tt.mode}, facts)
+			if tt.refused {
+				if err == nil {
+					t.Fatal("rendered")
+				}
+				if tt.outside {
+					var perr *protocol.Error
+					if !errors.As(err, &perr) || perr.Code != protocol.ErrorPermission {
+						t.Errorf("got %v, want a permission error", err)
+					}
+					if _, err := os.Stat(path); !os.IsNotExist(err) {
+						t.Error("file written outside the allowlist")
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Changed != tt.changed {
+				t.Errorf("changed = %v, want %v", result.Changed, tt.changed)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("wrote %q, want %q", data, tt.want)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.Mode().Perm(); got != tt.wantPerm {
+				t.Errorf("mode = %o, want %o", got, tt.wantPerm)
+			}
+			leftovers, _ := filepath.Glob(filepath.Join(dir, ".app.conf.tmp-*"))
+			if len(leftovers) != 0 {
+				t.Errorf("temp files left behind: %v", leftovers)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+// Package crash captures panics in the agent's goroutines. A crash report
+// with the stack traces, the recent log entries and a hash of the config
+// is written to the data directory before the agent exits, and uploaded to
+// the server once the agent is back.
+package crash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+const (
+	// dirName is the directory of the reports in the data directory
+	dirName = "crashes"
+	// maxStacks bounds the size of the dump of all goroutines
+	maxStacks = 4 << 20
+	// maxReports is how many reports are kept waiting for upload
+	maxReports = 20
+)
+
+// Report describes a crash
+type Report struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Goroutine  string    `json:"goroutine"`
+	Panic      string    `json:"panic"`
+	Stack      string    `json:"stack"`
+	AllStacks  string    `json:"all_stacks"`
+	Logs       []string  `json:"logs,omitempty"`
+	ConfigHash string    `json:"config_hash,omitempty"`
+	Version    string    `json:"version"`
+	GoVersion  string    `json:"go_version"`
+	OS         string    `json:"os"`
+	Arch       string    `json:"arch"`
+	Uptime     float64   `json:"uptime"`
+}
+
+// Reporter writes crash reports and uploads them
+type Reporter struct {
+	logger     *zap.Logger
+	dir        string
+	ring       *LogRing
+	configHash string
+	version    string
+	started    time.Time
+}
+
+// NewReporter creates a reporter writing to dataDir. ring may be nil.
+func NewReporter(logger *zap.Logger, dataDir string, ring *LogRing, configHash, version string) *Reporter {
+	return &Reporter{
+		logger:     logger,
+		dir:        filepath.Join(dataDir, dirName),
+		ring:       ring,
+		configHash: configHash,
+		version:    version,
+		started:    time.Now(),
+	}
+}
+
+// EnableCoreDumps makes the runtime abort with a core dump after an
+// unrecovered panic or fatal error, for the OS to save if core dumps are
+// enabled for the process
+func EnableCoreDumps() {
+	debug.SetTraceback("crash")
+}
+
+var defaultReporter atomic.Pointer[Reporter]
+
+// SetDefault makes r report the crashes caught by Go and Recover
+func SetDefault(r *Reporter) {
+	defaultReporter.Store(r)
+}
+
+// Go runs fn in a goroutine whose panics are reported
+func Go(goroutine string, fn func()) {
+	go func() {
+		defer Recover(goroutine)
+		fn()
+	}()
+}
+
+// Recover reports a panic of the calling goroutine and panics again, so
+// that the agent still exits. It must be deferred directly.
+func Recover(goroutine string) {
+	if v := recover(); v != nil {
+		if r := defaultReporter.Load(); r != nil {
+			r.capture(goroutine, v)
+		}
+		panic(v)
+	}
+}
+
+// Recover reports a panic of the calling goroutine and panics again. It
+// must be deferred directly.
+func (r *Reporter) Recover(goroutine string) {
+	if v := recover(); v != nil {
+		r.capture(goroutine, v)
+		panic(v)
+	}
+}
+
+// capture writes the report of a panic
+func (r *Reporter) capture(goroutine string, v interface{}) {
+	now := time.Now()
+	report := Report{
+		ID:         fmt.Sprintf("crash-%d", now.UnixNano()),
+		Time:       now,
+		Goroutine:  goroutine,
+		Panic:      fmt.Sprint(v),
+		Stack:      string(debug.Stack()),
+		AllStacks:  allStacks(),
+		ConfigHash: r.configHash,
+		Version:    r.version,
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Uptime:     now.Sub(r.started).Seconds(),
+	}
+	if r.ring != nil {
+		report.Logs = r.ring.Lines()
+	}
+
+	path, err := r.write(report)
+	if err != nil {
+		r.logger.Error("Failed to write crash report", zap.Error(err))
+		return
+	}
+	r.logger.Error("Agent crashed",
+		zap.String("goroutine", goroutine),
+		zap.String("panic", report.Panic),
+		zap.String("report", path))
+	r.logger.Sync()
+}
+
+func (r *Reporter) write(report Report) (string, error) {
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create crash directory: %w", err)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal crash report: %w", err)
+	}
+	path := filepath.Join(r.dir, report.ID+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write crash report: %w", err)
+	}
+	return path, nil
+}
+
+// Pending returns the reports not uploaded yet, oldest first
+func (r *Reporter) Pending() ([]Report, error) {
+	files, err := r.files()
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]Report, 0, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read crash report: %w", err)
+		}
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			r.logger.Warn("Discarding unreadable crash report", zap.String("path", f), zap.Error(err))
+			os.Remove(f)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Upload sends the pending reports to the server as crash events and
+// removes the ones sent. Reports beyond the newest maxReports are dropped.
+func (r *Reporter) Upload(agentID string, send func(protocol.Message) error) error {
+	reports, err := r.Pending()
+	if err != nil {
+		return err
+	}
+	if len(reports) > maxReports {
+		for _, report := range reports[:len(reports)-maxReports] {
+			os.Remove(filepath.Join(r.dir, report.ID+".json"))
+		}
+		reports = reports[len(reports)-maxReports:]
+	}
+
+	for _, report := range reports {
+		data, err := json.Marshal(report)
+		if err != nil {
+			return fmt.Errorf("failed to marshal crash report: %w", err)
+		}
+		payload, err := json.Marshal(protocol.Event{
+			AgentID:   agentID,
+			Kind:      "crash",
+			Data:      data,
+			Timestamp: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal crash event: %w", err)
+		}
+		if err := send(protocol.Message{
+			Type:      protocol.TypeEvent,
+			ID:        report.ID,
+			Timestamp: time.Now(),
+			Payload:   payload,
+		}); err != nil {
+			return fmt.Errorf("failed to upload crash report %s: %w", report.ID, err)
+		}
+		if err := os.Remove(filepath.Join(r.dir, report.ID+".json")); err != nil {
+			r.logger.Warn("Failed to remove uploaded crash report", zap.String("id", report.ID), zap.Error(err))
+		}
+		r.logger.Info("Uploaded crash report",
+			zap.String("id", report.ID),
+			zap.Time("crashed_at", report.Time))
+	}
+	return nil
+}
+
+func (r *Reporter) files() ([]string, error) {
+	entries, err := os.ReadDir(r.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list crash reports: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			files = append(files, filepath.Join(r.dir, e.Name()))
+		}
+	}
+	// IDs are timestamps of equal length
+	sort.Strings(files)
+	return files, nil
+}
+
+// allStacks dumps the stacks of every goroutine
+func allStacks() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStacks {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// HashFiles returns a short hash of the content of files, identifying the
+// config in effect without including it. Unreadable files are skipped.
+func HashFiles(files []string) string {
+	h := sha256.New()
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		h.Write([]byte(f))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,105 @@
+package crash
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultRingSize is how many log entries a crash report includes
+const DefaultRingSize = 200
+
+// ringBuffer keeps the last entries written to it
+type ringBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func (b *ringBuffer) add(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+func (b *ringBuffer) snapshot() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]string(nil), b.lines[:b.next]...)
+	}
+	return append(append([]string(nil), b.lines[b.next:]...), b.lines[:b.next]...)
+}
+
+// LogRing is a zap core keeping the most recent log entries in memory, so
+// that a crash report shows what led up to the crash
+type LogRing struct {
+	zapcore.LevelEnabler
+	buf *ringBuffer
+	enc zapcore.Encoder
+}
+
+// NewLogRing creates a ring of size entries at level and above
+func NewLogRing(size int, level zapcore.LevelEnabler) *LogRing {
+	if size <= 0 {
+		size = DefaultRingSize
+	}
+	config := zap.NewProductionEncoderConfig()
+	config.EncodeTime = zapcore.ISO8601TimeEncoder
+	return &LogRing{
+		LevelEnabler: level,
+		buf:          &ringBuffer{lines: make([]string, size)},
+		enc:          zapcore.NewJSONEncoder(config),
+	}
+}
+
+// Lines returns the kept entries, oldest first
+func (r *LogRing) Lines() []string {
+	return r.buf.snapshot()
+}
+
+// Attach returns logger with its entries also kept in the ring
+func (r *LogRing) Attach(logger *zap.Logger) *zap.Logger {
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, r)
+	}))
+}
+
+// With implements zapcore.Core
+func (r *LogRing) With(fields []zapcore.Field) zapcore.Core {
+	enc := r.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &LogRing{LevelEnabler: r.LevelEnabler, buf: r.buf, enc: enc}
+}
+
+// Check implements zapcore.Core
+func (r *LogRing) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if r.Enabled(entry.Level) {
+		return ce.AddCore(entry, r)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (r *LogRing) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	line, err := r.enc.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	r.buf.add(string(line.Bytes()[:max(line.Len()-1, 0)]))
+	line.Free()
+	return nil
+}
+
+// Sync implements zapcore.Core
+func (r *LogRing) Sync() error {
+	return nil
+}
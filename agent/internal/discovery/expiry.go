@@ -0,0 +1,141 @@
+package discovery
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Service status values
+const (
+	StatusActive = "active"
+	StatusStale  = "stale"
+)
+
+// Service event actions
+const (
+	ActionAdded   = "added"
+	ActionChanged = "changed"
+	ActionStale   = "stale"
+	ActionRemoved = "removed"
+)
+
+// registerService adds or refreshes a discovered service and emits an event
+// when it is new or any of its attributes changed
+func (s *Service) registerService(info *ServiceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := fmt.Sprintf("%s-%s-%s", info.Source, info.Name, info.Address)
+	now := time.Now()
+
+	existing, exists := s.services[key]
+	if !exists {
+		info.LastSeen = now
+		info.Status = StatusActive
+		s.services[key] = info
+		s.logger.Info("New service discovered",
+			zap.String("name", info.Name),
+			zap.String("source", info.Source),
+			zap.String("address", info.Address))
+		s.emit(ActionAdded, key, info)
+		return
+	}
+
+	changed := existing.Status != StatusActive
+	if info.Port != 0 && info.Port != existing.Port {
+		existing.Port = info.Port
+		changed = true
+	}
+	if info.Type != "" && info.Type != existing.Type {
+		existing.Type = info.Type
+		changed = true
+	}
+	if info.Version != "" && info.Version != existing.Version {
+		existing.Version = info.Version
+		changed = true
+	}
+	if info.Metadata != nil && !reflect.DeepEqual(info.Metadata, existing.Metadata) {
+		existing.Metadata = info.Metadata
+		changed = true
+	}
+
+	existing.LastSeen = now
+	existing.Status = StatusActive
+	existing.Missed = 0
+
+	if changed {
+		s.emit(ActionChanged, key, existing)
+	}
+}
+
+// expire ages services from source that were not seen since the start of
+// the pass that just completed, marking them stale and eventually removing them
+func (s *Service) expire(source string, since time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	staleAfter := s.config.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = 2
+	}
+	removeAfter := s.config.RemoveAfter
+	if removeAfter < staleAfter {
+		removeAfter = staleAfter
+	}
+
+	for key, info := range s.services {
+		if info.Source != source || !info.LastSeen.Before(since) {
+			continue
+		}
+
+		info.Missed++
+		switch {
+		case info.Missed >= removeAfter:
+			delete(s.services, key)
+			s.logger.Info("Service removed",
+				zap.String("name", info.Name),
+				zap.String("source", info.Source),
+				zap.String("address", info.Address))
+			s.emit(ActionRemoved, key, info)
+		case info.Missed >= staleAfter && info.Status != StatusStale:
+			info.Status = StatusStale
+			s.emit(ActionStale, key, info)
+		}
+	}
+}
+
+// emit sends a service event without blocking discovery. The caller holds s.mu.
+func (s *Service) emit(action, key string, info *ServiceInfo) {
+	if s.events == nil {
+		return
+	}
+
+	event := protocol.ServiceEvent{
+		Action:    action,
+		Key:       key,
+		Name:      info.Name,
+		Type:      info.Type,
+		Address:   info.Address,
+		Port:      info.Port,
+		Protocol:  info.Protocol,
+		Version:   info.Version,
+		Status:    info.Status,
+		Source:    info.Source,
+		LastSeen:  info.LastSeen,
+		Metadata:  info.Metadata,
+		Timestamp: time.Now(),
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		s.logger.Warn("Failed to send service event: channel full",
+			zap.String("action", action),
+			zap.String("service", key))
+	}
+}
@@ -0,0 +1,113 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir holds the token and CA of the pod's service account
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeServiceList is the part of a Kubernetes ServiceList discovery reads
+type kubeServiceList struct {
+	Items []struct {
+		Metadata struct {
+			Name              string            `json:"name"`
+			Namespace         string            `json:"namespace"`
+			Labels            map[string]string `json:"labels"`
+			CreationTimestamp time.Time         `json:"creationTimestamp"`
+		} `json:"metadata"`
+		Spec struct {
+			Type      string `json:"type"`
+			ClusterIP string `json:"clusterIP"`
+			Ports     []struct {
+				Port     int    `json:"port"`
+				Protocol string `json:"protocol"`
+			} `json:"ports"`
+			Selector map[string]string `json:"selector"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// inCluster reports whether the agent runs in a Kubernetes pod
+func inCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != "" && os.Getenv("KUBERNETES_SERVICE_PORT") != ""
+}
+
+// discoverKubernetes lists the cluster's services through the API server,
+// authenticating as the pod's service account
+func (s *Service) discoverKubernetes(ctx context.Context) error {
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return fmt.Errorf("failed to read service account token: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return fmt.Errorf("no certificates in service account CA")
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	host := net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+host+"/api/v1/services", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to list services: %s", resp.Status)
+	}
+
+	var services kubeServiceList
+	if err := json.NewDecoder(resp.Body).Decode(&services); err != nil {
+		return fmt.Errorf("failed to decode services: %w", err)
+	}
+
+	for _, service := range services.Items {
+		info := &ServiceInfo{
+			Name:    service.Metadata.Namespace + "/" + service.Metadata.Name,
+			Address: service.Spec.ClusterIP,
+			Source:  "kubernetes",
+			Metadata: map[string]interface{}{
+				"namespace": service.Metadata.Namespace,
+				"type":      service.Spec.Type,
+				"labels":    service.Metadata.Labels,
+				"selector":  service.Spec.Selector,
+				"created":   service.Metadata.CreationTimestamp.UTC().Format(time.RFC3339),
+			},
+		}
+		if len(service.Spec.Ports) > 0 {
+			info.Port = service.Spec.Ports[0].Port
+			info.Protocol = strings.ToLower(service.Spec.Ports[0].Protocol)
+		}
+		s.registerService(info)
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/grandcat/zeroconf"
+	"go.uber.org/zap"
+)
+
+// AgentServiceType is the DNS-SD service type agents advertise themselves as
+const AgentServiceType = "_shh-agent._tcp"
+
+// DefaultMDNSServices lists the DNS-SD service types browsed by default
+var DefaultMDNSServices = []string{
+	AgentServiceType,
+	"_http._tcp",
+	"_https._tcp",
+	"_ssh._tcp",
+	"_smb._tcp",
+	"_ipp._tcp",
+	"_printer._tcp",
+	"_googlecast._tcp",
+	"_airplay._tcp",
+	"_hap._tcp",
+	"_workstation._tcp",
+}
+
+// AdvertiseConfig represents how the agent announces itself over DNS-SD
+type AdvertiseConfig struct {
+	Enabled  bool
+	Instance string            // instance name, defaults to the hostname
+	Port     int               // port peers should connect to
+	Text     map[string]string // TXT records, e.g. agent ID and version
+}
+
+// discoverMDNS browses each configured DNS-SD service type for both IPv4 and
+// IPv6 records
+func (s *Service) discoverMDNS(ctx context.Context) error {
+	s.mu.RLock()
+	services := s.config.MDNSServices
+	domain := s.config.MDNSDomain
+	timeout := s.config.MDNSTimeout
+	s.mu.RUnlock()
+
+	if domain == "" {
+		domain = "local."
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	for _, service := range services {
+		if err := s.browseMDNS(ctx, service, domain, timeout); err != nil {
+			s.logger.Error("mDNS query failed",
+				zap.String("service", service),
+				zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// browseMDNS collects entries for a single service type until timeout
+func (s *Service) browseMDNS(ctx context.Context, service, domain string, timeout time.Duration) error {
+	resolver, err := zeroconf.NewResolver(zeroconf.SelectIPTraffic(zeroconf.IPv4AndIPv6))
+	if err != nil {
+		return fmt.Errorf("failed to create mDNS resolver: %w", err)
+	}
+
+	browseCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The resolver closes entries once browseCtx is done
+	entries := make(chan *zeroconf.ServiceEntry, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for entry := range entries {
+			s.registerMDNSEntry(entry)
+		}
+	}()
+
+	if err := resolver.Browse(browseCtx, service, domain, entries); err != nil {
+		return fmt.Errorf("failed to browse %s: %w", service, err)
+	}
+
+	<-browseCtx.Done()
+	<-done
+	return nil
+}
+
+// registerMDNSEntry records a resolved DNS-SD instance
+func (s *Service) registerMDNSEntry(entry *zeroconf.ServiceEntry) {
+	var addresses []string
+	for _, ip := range entry.AddrIPv4 {
+		addresses = append(addresses, ip.String())
+	}
+	for _, ip := range entry.AddrIPv6 {
+		addresses = append(addresses, ip.String())
+	}
+	if len(addresses) == 0 {
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"service":   entry.Service,
+		"domain":    entry.Domain,
+		"hostname":  entry.HostName,
+		"addresses": addresses,
+	}
+	for key, value := range parseTXT(entry.Text) {
+		metadata["txt."+key] = value
+	}
+
+	s.registerService(&ServiceInfo{
+		Name:     entry.Instance,
+		Type:     strings.TrimPrefix(strings.SplitN(entry.Service, ".", 2)[0], "_"),
+		Address:  addresses[0],
+		Port:     entry.Port,
+		Protocol: serviceProtocol(entry.Service),
+		Source:   "mdns",
+		Metadata: metadata,
+	})
+}
+
+// advertise registers the agent as a DNS-SD instance until ctx is done
+func (s *Service) advertise(ctx context.Context, config AdvertiseConfig) error {
+	instance := config.Instance
+	if instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to get hostname: %w", err)
+		}
+		instance = hostname
+	}
+	if config.Port <= 0 {
+		return fmt.Errorf("advertise port required")
+	}
+
+	text := make([]string, 0, len(config.Text))
+	for key, value := range config.Text {
+		text = append(text, key+"="+value)
+	}
+
+	server, err := zeroconf.Register(instance, AgentServiceType, "local.", config.Port, text, advertiseInterfaces())
+	if err != nil {
+		return fmt.Errorf("failed to register DNS-SD service: %w", err)
+	}
+
+	s.logger.Info("Advertising agent via DNS-SD",
+		zap.String("instance", instance),
+		zap.String("service", AgentServiceType),
+		zap.Int("port", config.Port))
+
+	go func() {
+		<-ctx.Done()
+		server.Shutdown()
+	}()
+
+	return nil
+}
+
+// advertiseInterfaces returns the multicast-capable interfaces that are up,
+// or nil to let the library choose
+func advertiseInterfaces() []net.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var selected []net.Interface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		selected = append(selected, iface)
+	}
+	return selected
+}
+
+// parseTXT converts DNS-SD TXT records to key/value pairs
+func parseTXT(records []string) map[string]string {
+	fields := make(map[string]string, len(records))
+	for _, record := range records {
+		key, value, _ := strings.Cut(record, "=")
+		if key != "" {
+			fields[strings.ToLower(key)] = value
+		}
+	}
+	return fields
+}
+
+// serviceProtocol returns the transport from a service type such as "_http._tcp"
+func serviceProtocol(service string) string {
+	if strings.HasSuffix(service, "._udp") {
+		return "udp"
+	}
+	return "tcp"
+}
@@ -0,0 +1,422 @@
+package discovery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// PeerConfig represents agent mesh settings
+type PeerConfig struct {
+	AgentID  string
+	Port     int           // UDP port for mesh probes, advertised over DNS-SD
+	Interval time.Duration // time between probe rounds and topology reports
+	Timeout  time.Duration // time to wait for a probe reply
+	PeerTTL  time.Duration // peers not heard from for this long are dropped
+	MaxPeers int           // peers tracked at most, further ones are ignored
+	// Secret authenticates probes with an HMAC shared by the agents. Without
+	// it, only peers found through DNS-SD are tracked.
+	Secret string
+}
+
+// peerMessage is exchanged between agents to share identity and measure latency
+type peerMessage struct {
+	Type     string `json:"type"` // ping or pong
+	ID       string `json:"id"`
+	Hostname string `json:"hostname"`
+	Port     int    `json:"port"`
+	Seq      uint64 `json:"seq"`
+	MAC      string `json:"mac,omitempty"`
+}
+
+// peer represents another agent on the network
+type peer struct {
+	id       string
+	hostname string
+	addr     *net.UDPAddr
+	rtt      time.Duration
+	sent     int
+	received int
+	loss     float64
+	lastSeen time.Time
+}
+
+// pendingProbe is a ping awaiting its pong
+type pendingProbe struct {
+	peerID string
+	sent   time.Time
+}
+
+// PeerMesh finds other agents through DNS-SD, exchanges IDs with them over
+// UDP and reports the measured latency as a topology for the backend
+type PeerMesh struct {
+	logger   *zap.Logger
+	service  *Service
+	config   PeerConfig
+	hostname string
+	events   chan<- interface{}
+	conn     *net.UDPConn
+	peers    map[string]*peer
+	pending  map[uint64]pendingProbe
+	seq      uint64
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+}
+
+// NewPeerMesh creates a mesh that browses for peers through service and sends
+// protocol.TopologyReport values on events
+func NewPeerMesh(logger *zap.Logger, service *Service, config PeerConfig, events chan<- interface{}) *PeerMesh {
+	if config.Port <= 0 {
+		config.Port = 7946
+	}
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Second
+	}
+	if config.PeerTTL <= 0 {
+		config.PeerTTL = 5 * config.Interval
+	}
+	if config.MaxPeers <= 0 {
+		config.MaxPeers = 256
+	}
+
+	hostname, _ := os.Hostname()
+
+	return &PeerMesh{
+		logger:   logger,
+		service:  service,
+		config:   config,
+		hostname: hostname,
+		events:   events,
+		peers:    make(map[string]*peer),
+		pending:  make(map[uint64]pendingProbe),
+	}
+}
+
+// Start listens for probes, advertises the agent and begins probing peers.
+// The mesh registers its own DNS-SD record, so Config.Advertise should stay
+// disabled when it is used.
+func (m *PeerMesh) Start(ctx context.Context) error {
+	if m.config.AgentID == "" {
+		return fmt.Errorf("agent ID required for peer mesh")
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: m.config.Port})
+	if err != nil {
+		return fmt.Errorf("failed to listen for peer probes: %w", err)
+	}
+	m.conn = conn
+	ctx, m.cancel = context.WithCancel(ctx)
+
+	err = m.service.advertise(ctx, AdvertiseConfig{
+		Enabled: true,
+		Port:    m.config.Port,
+		Text: map[string]string{
+			"id":   m.config.AgentID,
+			"mesh": "udp",
+		},
+	})
+	if err != nil {
+		m.cancel()
+		conn.Close()
+		return fmt.Errorf("failed to advertise agent: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go m.readLoop()
+	go m.probeLoop(ctx)
+
+	return nil
+}
+
+// Shutdown stops probing and closes the probe socket
+func (m *PeerMesh) Shutdown(ctx context.Context) error {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	return nil
+}
+
+func (m *PeerMesh) probeLoop(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.probe(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.config.Timeout):
+		}
+		m.report()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe refreshes the peer list from DNS-SD and pings every peer
+func (m *PeerMesh) probe(ctx context.Context) {
+	m.service.mu.RLock()
+	domain := m.service.config.MDNSDomain
+	m.service.mu.RUnlock()
+	if domain == "" {
+		domain = "local."
+	}
+	if err := m.service.browseMDNS(ctx, AgentServiceType, domain, m.config.Timeout); err != nil {
+		m.logger.Debug("Peer browse failed", zap.Error(err))
+	}
+
+	for _, info := range m.service.GetServices() {
+		if info.Source != "mdns" || info.Type != "shh-agent" {
+			continue
+		}
+		id, _ := info.Metadata["txt.id"].(string)
+		if id == "" || id == m.config.AgentID {
+			continue
+		}
+		ip := net.ParseIP(info.Address)
+		if ip == nil {
+			continue
+		}
+		m.addPeer(id, "", &net.UDPAddr{IP: ip, Port: info.Port})
+	}
+
+	m.mu.Lock()
+	now := time.Now()
+	var targets []*peer
+	for id, p := range m.peers {
+		if now.Sub(p.lastSeen) > m.config.PeerTTL {
+			delete(m.peers, id)
+			continue
+		}
+		targets = append(targets, p)
+	}
+	m.mu.Unlock()
+
+	for _, p := range targets {
+		m.ping(p)
+	}
+}
+
+// addPeer records a peer, keeping an existing entry's statistics. It
+// returns nil when the peer table is full.
+func (m *PeerMesh) addPeer(id, hostname string, addr *net.UDPAddr) *peer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.peers[id]
+	if !ok {
+		if len(m.peers) >= m.config.MaxPeers {
+			m.logger.Debug("Peer table full, ignoring peer",
+				zap.String("peer", id),
+				zap.Int("max_peers", m.config.MaxPeers))
+			return nil
+		}
+		p = &peer{id: id, lastSeen: time.Now()}
+		m.peers[id] = p
+		m.logger.Info("Discovered peer agent",
+			zap.String("peer", id),
+			zap.String("address", addr.String()))
+	}
+	p.addr = addr
+	if hostname != "" {
+		p.hostname = hostname
+	}
+	return p
+}
+
+func (m *PeerMesh) ping(p *peer) {
+	m.mu.Lock()
+	m.seq++
+	seq := m.seq
+	m.pending[seq] = pendingProbe{peerID: p.id, sent: time.Now()}
+	p.sent++
+	addr := p.addr
+	m.mu.Unlock()
+
+	if err := m.send(addr, "ping", seq); err != nil {
+		m.logger.Debug("Failed to ping peer",
+			zap.String("peer", p.id),
+			zap.Error(err))
+	}
+}
+
+func (m *PeerMesh) send(addr *net.UDPAddr, msgType string, seq uint64) error {
+	msg := peerMessage{
+		Type:     msgType,
+		ID:       m.config.AgentID,
+		Hostname: m.hostname,
+		Port:     m.config.Port,
+		Seq:      seq,
+	}
+	msg.MAC = m.sign(msg)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal peer message: %w", err)
+	}
+	_, err = m.conn.WriteToUDP(data, addr)
+	return err
+}
+
+// sign returns the HMAC of a message under the mesh secret, or nothing
+// without one
+func (m *PeerMesh) sign(msg peerMessage) string {
+	if m.config.Secret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(m.config.Secret))
+	fmt.Fprintf(mac, "%s\x00%s\x00%s\x00%d\x00%d", msg.Type, msg.ID, msg.Hostname, msg.Port, msg.Seq)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authentic reports whether a message carries a valid HMAC. Without a
+// secret no message is authentic.
+func (m *PeerMesh) authentic(msg peerMessage) bool {
+	if m.config.Secret == "" || msg.MAC == "" {
+		return false
+	}
+	return hmac.Equal([]byte(msg.MAC), []byte(m.sign(msg)))
+}
+
+// readLoop answers pings and matches pongs to pending probes
+func (m *PeerMesh) readLoop() {
+	buffer := make([]byte, 2048)
+	for {
+		n, addr, err := m.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+
+		var msg peerMessage
+		if err := json.Unmarshal(buffer[:n], &msg); err != nil || msg.ID == "" || msg.ID == m.config.AgentID {
+			continue
+		}
+
+		// With a secret, probes from agents that don't share it are ignored
+		authentic := m.authentic(msg)
+		if m.config.Secret != "" && !authentic {
+			continue
+		}
+
+		switch msg.Type {
+		case "ping":
+			// Learn an authenticated sender even if multicast does not
+			// reach us; otherwise only peers found through DNS-SD are
+			// tracked, so spoofed pings can't fill the table
+			m.mu.Lock()
+			p, known := m.peers[msg.ID]
+			if known {
+				p.lastSeen = time.Now()
+			}
+			m.mu.Unlock()
+			if !known && authentic {
+				reply := &net.UDPAddr{IP: addr.IP, Port: msg.Port}
+				if msg.Port == 0 {
+					reply = addr
+				}
+				m.addPeer(msg.ID, msg.Hostname, reply)
+			}
+			if err := m.send(addr, "pong", msg.Seq); err != nil {
+				m.logger.Debug("Failed to answer peer", zap.String("peer", msg.ID), zap.Error(err))
+			}
+		case "pong":
+			m.mu.Lock()
+			probe, ok := m.pending[msg.Seq]
+			if ok && probe.peerID == msg.ID {
+				delete(m.pending, msg.Seq)
+				if p, exists := m.peers[msg.ID]; exists {
+					p.rtt = time.Since(probe.sent)
+					p.received++
+					p.lastSeen = time.Now()
+					if msg.Hostname != "" {
+						p.hostname = msg.Hostname
+					}
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// report counts the unanswered probes of the round as lost and publishes
+// the current topology
+func (m *PeerMesh) report() {
+	m.mu.Lock()
+	// Pongs arriving after the round are ignored, so they can't count
+	// toward the next one
+	for seq := range m.pending {
+		delete(m.pending, seq)
+	}
+
+	report := protocol.TopologyReport{
+		AgentID:   m.config.AgentID,
+		Hostname:  m.hostname,
+		Timestamp: time.Now(),
+	}
+	for _, p := range m.peers {
+		// Loss is measured per round
+		if p.sent > 0 {
+			p.loss = 1 - float64(p.received)/float64(p.sent)
+			if p.loss < 0 {
+				p.loss = 0
+			}
+		}
+		p.sent, p.received = 0, 0
+		report.Peers = append(report.Peers, p.link())
+	}
+	m.mu.Unlock()
+
+	if m.events == nil {
+		return
+	}
+	select {
+	case m.events <- report:
+	default:
+		m.logger.Warn("Failed to send topology report: channel full")
+	}
+}
+
+// Peers returns the latest topology
+func (m *PeerMesh) Peers() []protocol.PeerLink {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	links := make([]protocol.PeerLink, 0, len(m.peers))
+	for _, p := range m.peers {
+		links = append(links, p.link())
+	}
+	return links
+}
+
+func (p *peer) link() protocol.PeerLink {
+	return protocol.PeerLink{
+		PeerID:   p.id,
+		Hostname: p.hostname,
+		Address:  net.JoinHostPort(p.addr.IP.String(), strconv.Itoa(p.addr.Port)),
+		RTTMs:    float64(p.rtt) / float64(time.Millisecond),
+		Loss:     p.loss,
+		LastSeen: p.lastSeen,
+	}
+}
@@ -0,0 +1,416 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultPortRange covers common service ports rather than the full range,
+// which would take hours per subnet at a polite probe rate
+const DefaultPortRange = "21-23,25,53,80,110,111,143,389,443,445,465,587,631,993,995," +
+	"1433,1521,1883,2049,2375,2376,3000,3306,3389,5000,5432,5672,5900,6379,6443," +
+	"8000,8080,8081,8443,8883,9000,9090,9092,9100,9200,11211,15672,27017"
+
+// DefaultUDPPortRange covers UDP services with a known probe
+const DefaultUDPPortRange = "53,123,161"
+
+// scanTarget represents a single host:port probe
+type scanTarget struct {
+	ip       net.IP
+	port     int
+	protocol string
+}
+
+// parsePortRange parses a list of ports and ranges such as "22,80,8000-8100"
+func parsePortRange(spec string) ([]int, error) {
+	seen := make(map[int]bool)
+	var ports []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lo, hi := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			lo, hi = part[:i], part[i+1:]
+		}
+		start, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %w", lo, err)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(hi))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %w", hi, err)
+		}
+		if start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid port range %q", part)
+		}
+
+		for p := start; p <= end; p++ {
+			if !seen[p] {
+				seen[p] = true
+				ports = append(ports, p)
+			}
+		}
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// parseCIDRs parses a list of CIDRs or bare addresses
+func parseCIDRs(specs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, spec := range specs {
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", spec)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			spec = fmt.Sprintf("%s/%d", spec, bits)
+		}
+		_, n, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", spec, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// containsIP reports whether any of nets contains ip
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostsInNetwork enumerates host addresses in an IPv4 network, skipping the
+// network and broadcast addresses. IPv6 networks are too large to sweep and
+// are skipped.
+func hostsInNetwork(network *net.IPNet, max int) ([]net.IP, error) {
+	ip4 := network.IP.To4()
+	if ip4 == nil {
+		return nil, nil
+	}
+
+	ones, bits := network.Mask.Size()
+	size := uint64(1) << uint(bits-ones)
+	if size > uint64(max)+2 {
+		return nil, fmt.Errorf("network %s has %d addresses, exceeding the limit of %d", network, size, max)
+	}
+
+	base := binary.BigEndian.Uint32(ip4.Mask(network.Mask))
+	var hosts []net.IP
+	for i := uint64(0); i < size; i++ {
+		if size > 2 && (i == 0 || i == size-1) {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, base+uint32(i))
+		hosts = append(hosts, ip)
+	}
+	return hosts, nil
+}
+
+// scanNetwork probes every allowed host in network on the configured TCP and
+// UDP ports and registers the services that answer
+func (s *Service) scanNetwork(ctx context.Context, network *net.IPNet) error {
+	s.mu.RLock()
+	config := s.scanConfig
+	s.mu.RUnlock()
+
+	allow, err := parseCIDRs(config.AllowNetworks)
+	if err != nil {
+		return fmt.Errorf("invalid allowlist: %w", err)
+	}
+	exclude, err := parseCIDRs(config.ExcludeNetworks)
+	if err != nil {
+		return fmt.Errorf("invalid exclude list: %w", err)
+	}
+
+	portRange := config.PortRange
+	if portRange == "" {
+		portRange = DefaultPortRange
+	}
+	tcpPorts, err := parsePortRange(portRange)
+	if err != nil {
+		return fmt.Errorf("invalid port range: %w", err)
+	}
+	var udpPorts []int
+	if config.UDPPortRange != "" {
+		if udpPorts, err = parsePortRange(config.UDPPortRange); err != nil {
+			return fmt.Errorf("invalid UDP port range: %w", err)
+		}
+	}
+
+	maxHosts := config.MaxHosts
+	if maxHosts <= 0 {
+		maxHosts = 1024
+	}
+	hosts, err := hostsInNetwork(network, maxHosts)
+	if err != nil {
+		return err
+	}
+
+	var targets []scanTarget
+	for _, ip := range hosts {
+		if len(allow) > 0 && !containsIP(allow, ip) {
+			continue
+		}
+		if containsIP(exclude, ip) {
+			continue
+		}
+		for _, port := range tcpPorts {
+			targets = append(targets, scanTarget{ip: ip, port: port, protocol: "tcp"})
+		}
+		for _, port := range udpPorts {
+			targets = append(targets, scanTarget{ip: ip, port: port, protocol: "udp"})
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	s.logger.Debug("Scanning network",
+		zap.String("network", network.String()),
+		zap.Int("targets", len(targets)))
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	workers := config.Concurrency
+	if workers <= 0 {
+		workers = 64
+	}
+	rate := config.RateLimit
+	if rate <= 0 {
+		rate = 200
+	}
+
+	// Probes are paced by a ticker so the scan never exceeds rate per second
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+
+	work := make(chan scanTarget)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range work {
+				s.probe(ctx, target, timeout)
+			}
+		}()
+	}
+
+feed:
+	for _, target := range targets {
+		select {
+		case <-ctx.Done():
+			break feed
+		case <-ticker.C:
+		}
+		select {
+		case <-ctx.Done():
+			break feed
+		case work <- target:
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// probe checks a single target and registers it if it responds
+func (s *Service) probe(ctx context.Context, target scanTarget, timeout time.Duration) {
+	var banner string
+	var open bool
+	if target.protocol == "udp" {
+		banner, open = probeUDP(ctx, target.ip, target.port, timeout)
+	} else {
+		banner, open = probeTCP(ctx, target.ip, target.port, timeout)
+	}
+	if !open {
+		return
+	}
+
+	serviceType := s.identifyService(banner)
+	if serviceType == "Unknown" {
+		serviceType = wellKnownService(target.protocol, target.port)
+	}
+
+	metadata := map[string]interface{}{}
+	if banner != "" {
+		metadata["banner"] = truncateBanner(banner)
+	}
+
+	s.registerService(&ServiceInfo{
+		Name:     fmt.Sprintf("%s-%d", strings.ToLower(serviceType), target.port),
+		Type:     serviceType,
+		Address:  target.ip.String(),
+		Port:     target.port,
+		Protocol: target.protocol,
+		Version:  bannerVersion(serviceType, banner),
+		Source:   "scan",
+		Metadata: metadata,
+	})
+}
+
+// probeTCP connects to a port and returns whatever banner the service sends,
+// prompting with an HTTP request if it stays silent
+func probeTCP(ctx context.Context, ip net.IP, port int, timeout time.Duration) (string, bool) {
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	if err != nil {
+		return "", false
+	}
+	defer conn.Close()
+
+	buffer := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout / 2))
+	if n, err := conn.Read(buffer); err == nil && n > 0 {
+		return string(buffer[:n]), true
+	}
+
+	request := fmt.Sprintf("HEAD / HTTP/1.0\r\nHost: %s\r\n\r\n", ip)
+	_ = conn.SetWriteDeadline(time.Now().Add(timeout / 2))
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return "", true
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout / 2))
+	n, _ := conn.Read(buffer)
+	return string(buffer[:n]), true
+}
+
+// udpProbes holds payloads that elicit a response from common UDP services
+var udpProbes = map[int][]byte{
+	// DNS query for version.bind CH TXT
+	53: {0x13, 0x37, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x07, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x04, 'b', 'i', 'n', 'd', 0x00,
+		0x00, 0x10, 0x00, 0x03},
+	// NTP v3 client request
+	123: append([]byte{0x1b}, make([]byte, 47)...),
+	// SNMPv2c get sysDescr.0 with community "public"
+	161: {0x30, 0x29, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x1c, 0x02, 0x04, 0x13, 0x37, 0x13, 0x37, 0x02, 0x01, 0x00, 0x02,
+		0x01, 0x00, 0x30, 0x0e, 0x30, 0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02,
+		0x01, 0x01, 0x01, 0x00, 0x05, 0x00},
+}
+
+// probeUDP sends a protocol probe and reports the port open only if a reply
+// arrives; silence is indistinguishable from a filtered port
+func probeUDP(ctx context.Context, ip net.IP, port int, timeout time.Duration) (string, bool) {
+	payload, ok := udpProbes[port]
+	if !ok {
+		payload = []byte("\r\n")
+	}
+
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "udp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	if err != nil {
+		return "", false
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(payload); err != nil {
+		return "", false
+	}
+
+	buffer := make([]byte, 1500)
+	n, err := conn.Read(buffer)
+	if err != nil || n == 0 {
+		return "", false
+	}
+
+	switch port {
+	case 53:
+		return "DNS", true
+	case 123:
+		return "NTP", true
+	case 161:
+		return "SNMP " + printable(buffer[:n]), true
+	}
+	return printable(buffer[:n]), true
+}
+
+// wellKnownService names a service from its port when the banner is unhelpful
+func wellKnownService(protocol string, port int) string {
+	names := map[int]string{
+		21: "FTP", 22: "SSH", 23: "Telnet", 25: "SMTP", 53: "DNS", 80: "HTTP",
+		110: "POP3", 123: "NTP", 143: "IMAP", 161: "SNMP", 389: "LDAP", 443: "HTTPS",
+		445: "SMB", 1433: "MSSQL", 1883: "MQTT", 2049: "NFS", 2375: "Docker",
+		3306: "MySQL", 3389: "RDP", 5432: "PostgreSQL", 5672: "AMQP", 5900: "VNC",
+		6379: "Redis", 6443: "Kubernetes", 8443: "HTTPS", 9092: "Kafka",
+		9200: "Elasticsearch", 11211: "Memcached", 27017: "MongoDB",
+	}
+	if name, ok := names[port]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+var (
+	sshVersion    = regexp.MustCompile(`SSH-[\d.]+-(\S+)`)
+	serverHeader  = regexp.MustCompile(`(?im)^Server:\s*(.+?)\r?$`)
+	ftpSMTPBanner = regexp.MustCompile(`^2[0-9]{2}[ -](.+?)\r?$`)
+	mysqlVersion  = regexp.MustCompile(`([0-9]+\.[0-9]+\.[0-9]+[-\w.]*)`)
+)
+
+// bannerVersion extracts a version string from a service banner
+func bannerVersion(serviceType, banner string) string {
+	var m []string
+	switch serviceType {
+	case "SSH":
+		m = sshVersion.FindStringSubmatch(banner)
+	case "HTTP":
+		m = serverHeader.FindStringSubmatch(banner)
+	case "FTP", "SMTP":
+		m = ftpSMTPBanner.FindStringSubmatch(strings.SplitN(banner, "\n", 2)[0])
+	case "MySQL":
+		m = mysqlVersion.FindStringSubmatch(banner)
+	}
+	if len(m) > 1 {
+		return strings.TrimSpace(m[1])
+	}
+	return "unknown"
+}
+
+// printable strips non-printable bytes from a binary reply
+func printable(b []byte) string {
+	return string(bytes.Map(func(r rune) rune {
+		if r < 32 || r > 126 {
+			return -1
+		}
+		return r
+	}, b))
+}
+
+func truncateBanner(banner string) string {
+	banner = strings.TrimSpace(banner)
+	if len(banner) > 256 {
+		return banner[:256]
+	}
+	return banner
+}
@@ -4,14 +4,15 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
-	"strings"
-
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
 )
 
 // Service represents the service discovery component
@@ -20,67 +21,152 @@ type Service struct {
 	mu         sync.RWMutex
 	services   map[string]*ServiceInfo
 	scanConfig ScanConfig
+	config     Config
+	events     chan<- interface{}
+
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 // ServiceInfo represents information about a discovered service
 type ServiceInfo struct {
 	Name     string
 	Type     string
+	Address  string
 	Port     int
+	Protocol string
 	Version  string
 	Status   string
+	Source   string
 	LastSeen time.Time
+	Missed   int // consecutive discovery passes that did not report the service
 	Metadata map[string]interface{}
 }
 
 // ScanConfig represents service discovery scan configuration
 type ScanConfig struct {
-	Interval  time.Duration
-	PortRange string
-	Timeout   time.Duration
+	Interval        time.Duration
+	PortRange       string // TCP ports, e.g. "22,80,8000-8100"
+	UDPPortRange    string // UDP ports, empty disables UDP probing
+	Timeout         time.Duration
+	AllowNetworks   []string // CIDRs that may be scanned, empty allows all local subnets
+	ExcludeNetworks []string // CIDRs that are never scanned
+	RateLimit       int      // maximum probes per second
+	Concurrency     int      // maximum probes in flight
+	MaxHosts        int      // largest subnet size that will be swept
+	Sweep           bool     // probe the local subnets every interval, off by default
+}
+
+// Config represents DNS and mDNS discovery configuration
+type Config struct {
+	DNSServer     string
+	SearchDomains []string
+	MDNSServices  []string // DNS-SD service types to browse, e.g. "_http._tcp"
+	MDNSDomain    string
+	MDNSTimeout   time.Duration
+	Advertise     AdvertiseConfig
+	StaleAfter    int // missed discovery passes before a service is marked stale
+	RemoveAfter   int // missed discovery passes before a service is removed
 }
 
-// NewService creates a new service discovery instance
-func NewService(logger *zap.Logger) *Service {
+// DefaultConfig browses the common DNS-SD service types, marking services
+// stale after two missed passes and removing them after five
+var DefaultConfig = Config{
+	DNSServer:    "127.0.0.53:53",
+	MDNSServices: DefaultMDNSServices,
+	MDNSDomain:   "local.",
+	MDNSTimeout:  5 * time.Second,
+	StaleAfter:   2,
+	RemoveAfter:  5,
+}
+
+// DefaultScanConfig discovers services every five minutes without
+// sweeping the local subnets
+var DefaultScanConfig = ScanConfig{
+	Interval:     5 * time.Minute,
+	PortRange:    DefaultPortRange,
+	UDPPortRange: DefaultUDPPortRange,
+	Timeout:      2 * time.Second,
+	RateLimit:    200,
+	Concurrency:  64,
+	MaxHosts:     1024,
+}
+
+// NewService creates a new service discovery instance. Service changes are
+// sent as protocol.ServiceEvent values on events.
+func NewService(logger *zap.Logger, events chan<- interface{}) *Service {
 	return &Service{
-		logger:   logger,
-		services: make(map[string]*ServiceInfo),
-		scanConfig: ScanConfig{
-			Interval:  5 * time.Minute,
-			PortRange: "1-65535",
-			Timeout:   5 * time.Second,
-		},
+		logger:     logger,
+		services:   make(map[string]*ServiceInfo),
+		events:     events,
+		config:     DefaultConfig,
+		scanConfig: DefaultScanConfig,
 	}
 }
 
-// Start begins the service discovery process
+// Start discovers services every scan interval until Shutdown
 func (s *Service) Start(ctx context.Context) error {
 	s.logger.Info("Starting service discovery")
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
 
-	// Start periodic scanning
-	go func() {
-		ticker := time.NewTicker(s.scanConfig.Interval)
-		defer ticker.Stop()
+	// Advertise this agent so peers can find it
+	s.mu.RLock()
+	advertise := s.config.Advertise
+	s.mu.RUnlock()
+	if advertise.Enabled {
+		if err := s.advertise(ctx, advertise); err != nil {
+			s.logger.Error("Failed to advertise agent via DNS-SD", zap.Error(err))
+		}
+	}
 
+	crash.Go("service-discovery", func() {
+		defer close(s.done)
 		for {
+			if err := s.DiscoverServices(ctx); err != nil {
+				s.logger.Error("Service discovery failed", zap.Error(err))
+			}
+
+			s.mu.RLock()
+			sweep, interval := s.scanConfig.Sweep, s.scanConfig.Interval
+			s.mu.RUnlock()
+			if sweep {
+				if err := s.scan(ctx); err != nil {
+					s.logger.Error("Service discovery scan failed", zap.Error(err))
+				}
+			}
+
 			select {
 			case <-ctx.Done():
 				s.logger.Info("Stopping service discovery")
 				return
-			case <-ticker.C:
-				if err := s.scan(ctx); err != nil {
-					s.logger.Error("Service discovery scan failed", zap.Error(err))
-				}
+			case <-time.After(interval):
 			}
 		}
-	}()
+	})
 
 	return nil
 }
 
+// Shutdown stops discovering services and withdraws the advertisement
+func (s *Service) Shutdown(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // scan performs a single service discovery scan
 func (s *Service) scan(ctx context.Context) error {
 	s.logger.Debug("Starting service discovery scan")
+	start := time.Now()
+	complete := true
 
 	// Get list of network interfaces
 	ifaces, err := net.Interfaces()
@@ -111,6 +197,7 @@ func (s *Service) scan(ctx context.Context) error {
 
 			// Scan the network
 			if err := s.scanNetwork(ctx, ipNet); err != nil {
+				complete = false
 				s.logger.Error("Network scan failed",
 					zap.String("network", ipNet.String()),
 					zap.Error(err))
@@ -118,13 +205,11 @@ func (s *Service) scan(ctx context.Context) error {
 		}
 	}
 
-	return nil
-}
+	// Only a complete pass proves a service has gone away
+	if complete {
+		s.expire("scan", start)
+	}
 
-// scanNetwork scans a specific network for services
-func (s *Service) scanNetwork(ctx context.Context, network *net.IPNet) error {
-	// Implementation of network scanning logic
-	// This is a placeholder for actual implementation
 	return nil
 }
 
@@ -161,14 +246,60 @@ func (s *Service) RemoveService(name string, port int) {
 	delete(s.services, key)
 }
 
-// Configure updates the scan configuration
+// Configure updates the scan configuration. Zero fields take the
+// defaults.
 func (s *Service) Configure(config ScanConfig) {
+	if config.Interval <= 0 {
+		config.Interval = DefaultScanConfig.Interval
+	}
+	if config.PortRange == "" {
+		config.PortRange = DefaultScanConfig.PortRange
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultScanConfig.Timeout
+	}
+	if config.RateLimit <= 0 {
+		config.RateLimit = DefaultScanConfig.RateLimit
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = DefaultScanConfig.Concurrency
+	}
+	if config.MaxHosts <= 0 {
+		config.MaxHosts = DefaultScanConfig.MaxHosts
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.scanConfig = config
 }
 
+// ConfigureDiscovery updates the DNS and mDNS discovery configuration.
+// Zero fields take the defaults.
+func (s *Service) ConfigureDiscovery(config Config) {
+	if config.DNSServer == "" {
+		config.DNSServer = DefaultConfig.DNSServer
+	}
+	if config.MDNSServices == nil {
+		config.MDNSServices = DefaultConfig.MDNSServices
+	}
+	if config.MDNSDomain == "" {
+		config.MDNSDomain = DefaultConfig.MDNSDomain
+	}
+	if config.MDNSTimeout <= 0 {
+		config.MDNSTimeout = DefaultConfig.MDNSTimeout
+	}
+	if config.StaleAfter <= 0 {
+		config.StaleAfter = DefaultConfig.StaleAfter
+	}
+	if config.RemoveAfter <= 0 {
+		config.RemoveAfter = DefaultConfig.RemoveAfter
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.config = config
+}
+
 // detectServiceType attempts to determine the type of service
 func (s *Service) detectServiceType(host string, port int) (string, error) {
 	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", host, port), s.scanConfig.Timeout)
@@ -204,7 +335,23 @@ func (s *Service) identifyService(response string) string {
 		return "SSH"
 	case containsAny(response, "HTTP", "nginx", "Apache"):
 		return "HTTP"
-	case containsAny(response, "MySQL", "MariaDB"):
+	case containsAny(response, "ESMTP", "SMTP", "Postfix", "Exim"):
+		return "SMTP"
+	case containsAny(response, "FTP", "FileZilla", "vsFTPd"):
+		return "FTP"
+	case strings.HasPrefix(response, "+OK"):
+		return "POP3"
+	case strings.HasPrefix(response, "* OK"):
+		return "IMAP"
+	case strings.HasPrefix(response, "RFB "):
+		return "VNC"
+	case strings.HasPrefix(response, "DNS"):
+		return "DNS"
+	case strings.HasPrefix(response, "NTP"):
+		return "NTP"
+	case strings.HasPrefix(response, "SNMP"):
+		return "SNMP"
+	case containsAny(response, "MySQL", "MariaDB", "mysql_native_password"):
 		return "MySQL"
 	case containsAny(response, "Redis"):
 		return "Redis"
@@ -236,21 +383,37 @@ func (s *Service) getServiceVersion(host string, port int, serviceType string) (
 func (s *Service) DiscoverServices(ctx context.Context) error {
 	s.logger.Info("Starting service discovery")
 
-	// Discover services using different methods
+	// Discover services using different methods. Services a source did not
+	// report are expired only when that source completed successfully.
+	start := time.Now()
 	if err := s.discoverDNS(ctx); err != nil {
 		s.logger.Error("DNS discovery failed", zap.Error(err))
+	} else {
+		s.expire("dns", start)
 	}
 
+	start = time.Now()
 	if err := s.discoverMDNS(ctx); err != nil {
 		s.logger.Error("mDNS discovery failed", zap.Error(err))
+	} else {
+		s.expire("mdns", start)
 	}
 
+	start = time.Now()
 	if err := s.discoverDocker(ctx); err != nil {
 		s.logger.Error("Docker discovery failed", zap.Error(err))
+	} else {
+		s.expire("docker", start)
 	}
 
-	if err := s.discoverKubernetes(ctx); err != nil {
-		s.logger.Error("Kubernetes discovery failed", zap.Error(err))
+	// Outside a pod there is no cluster to ask
+	if inCluster() {
+		start = time.Now()
+		if err := s.discoverKubernetes(ctx); err != nil {
+			s.logger.Error("Kubernetes discovery failed", zap.Error(err))
+		} else {
+			s.expire("kubernetes", start)
+		}
 	}
 
 	return nil
@@ -290,43 +453,8 @@ func (s *Service) discoverDNS(ctx context.Context) error {
 	return nil
 }
 
-func (s *Service) discoverMDNS(ctx context.Context) error {
-	entriesCh := make(chan *mdns.ServiceEntry, 10)
-	defer close(entriesCh)
-
-	go func() {
-		for entry := range entriesCh {
-			s.registerService(&ServiceInfo{
-				Name:     entry.Name,
-				Address:  entry.AddrV4.String(),
-				Port:     entry.Port,
-				Metadata: entry.InfoFields,
-				Source:   "mdns",
-			})
-		}
-	}()
-
-	for _, service := range s.config.MDNSServices {
-		params := &mdns.QueryParam{
-			Service: service,
-			Domain:  "local",
-			Timeout: time.Second * 5,
-			Entries: entriesCh,
-		}
-
-		if err := mdns.Query(params); err != nil {
-			s.logger.Error("mDNS query failed",
-				zap.String("service", service),
-				zap.Error(err))
-			continue
-		}
-	}
-
-	return nil
-}
-
 func (s *Service) discoverDocker(ctx context.Context) error {
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return fmt.Errorf("failed to create Docker client: %w", err)
 	}
@@ -338,87 +466,45 @@ func (s *Service) discoverDocker(ctx context.Context) error {
 	}
 
 	for _, container := range containers {
-		networks := make(map[string]string)
-		for networkName, network := range container.NetworkSettings.Networks {
-			networks[networkName] = network.IPAddress
+		if len(container.Names) == 0 {
+			continue
 		}
 
-		s.registerService(&ServiceInfo{
-			Name:    container.Names[0],
-			ID:      container.ID,
-			Address: networks["bridge"],
-			Labels:  container.Labels,
-			Source:  "docker",
-			Metadata: map[string]string{
-				"image":   container.Image,
-				"state":   container.State,
-				"status":  container.Status,
-				"created": time.Unix(container.Created, 0).String(),
-			},
-		})
-	}
-
-	return nil
-}
-
-func (s *Service) discoverKubernetes(ctx context.Context) error {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return fmt.Errorf("failed to get Kubernetes config: %w", err)
-	}
-
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return fmt.Errorf("failed to create Kubernetes client: %w", err)
-	}
+		// Prefer the default bridge, falling back to any network with an address
+		var address string
+		networks := make(map[string]interface{})
+		if container.NetworkSettings != nil {
+			for networkName, network := range container.NetworkSettings.Networks {
+				if network == nil {
+					continue
+				}
+				networks[networkName] = network.IPAddress
+				if address == "" || networkName == "bridge" {
+					address = network.IPAddress
+				}
+			}
+		}
 
-	services, err := clientset.CoreV1().Services("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to list services: %w", err)
-	}
+		var port int
+		if len(container.Ports) > 0 {
+			port = int(container.Ports[0].PrivatePort)
+		}
 
-	for _, service := range services.Items {
 		s.registerService(&ServiceInfo{
-			Name:      service.Name,
-			Namespace: service.Namespace,
-			Address:   service.Spec.ClusterIP,
-			Port:      int(service.Spec.Ports[0].Port),
-			Labels:    service.Labels,
-			Source:    "kubernetes",
-			Metadata: map[string]string{
-				"type":      string(service.Spec.Type),
-				"created":   service.CreationTimestamp.String(),
-				"selectors": fmt.Sprintf("%v", service.Spec.Selector),
+			Name:    strings.TrimPrefix(container.Names[0], "/"),
+			Address: address,
+			Port:    port,
+			Source:  "docker",
+			Metadata: map[string]interface{}{
+				"id":       container.ID,
+				"image":    container.Image,
+				"state":    container.State,
+				"labels":   container.Labels,
+				"networks": networks,
+				"created":  time.Unix(container.Created, 0).UTC().Format(time.RFC3339),
 			},
 		})
 	}
 
 	return nil
 }
-
-func (s *Service) registerService(info *ServiceInfo) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	key := fmt.Sprintf("%s-%s-%s", info.Source, info.Name, info.Address)
-	if existing, exists := s.services[key]; exists {
-		// Update existing service
-		existing.LastSeen = time.Now()
-		existing.Status = "active"
-		if info.Port != 0 {
-			existing.Port = info.Port
-		}
-		if info.Metadata != nil {
-			existing.Metadata = info.Metadata
-		}
-	} else {
-		// Add new service
-		info.LastSeen = time.Now()
-		info.Status = "active"
-		s.services[key] = info
-		s.logger.Info("New service discovered",
-			zap.String("name", info.Name),
-			zap.String("source", info.Source),
-			zap.String("address", info.Address))
-	}
-}
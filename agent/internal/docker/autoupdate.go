@@ -0,0 +1,341 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// LabelAutoUpdate opts a container into automatic image updates when set
+// to true
+const LabelAutoUpdate = "shh.auto-update"
+
+// Outcomes of an image update
+const (
+	UpdateCurrent    = "current"
+	UpdateApplied    = "updated"
+	UpdateRolledBack = "rolled_back"
+	UpdateFailed     = "failed"
+)
+
+// UpdatePolicy decides how often opted-in containers are checked for
+// newer images and how long an updated container gets to become healthy
+type UpdatePolicy struct {
+	// Interval between checks; zero disables them
+	Interval      time.Duration
+	HealthTimeout time.Duration
+}
+
+// DefaultUpdatePolicy checks every 6 hours and waits 2 minutes for
+// updated containers to become healthy
+var DefaultUpdatePolicy = UpdatePolicy{
+	Interval:      6 * time.Hour,
+	HealthTimeout: 2 * time.Minute,
+}
+
+// ImageUpdate reports what an update check did to a container
+type ImageUpdate struct {
+	Container  string    `json:"container"`
+	Name       string    `json:"name"`
+	Image      string    `json:"image"`
+	Outcome    string    `json:"outcome"`
+	OldImageID string    `json:"old_image_id,omitempty"`
+	NewImageID string    `json:"new_image_id,omitempty"`
+	Digest     string    `json:"digest,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// SetUpdatePolicy changes how opted-in containers are updated. Zero
+// health timeouts take the default.
+func (p *Plugin) SetUpdatePolicy(policy UpdatePolicy) {
+	if policy.HealthTimeout <= 0 {
+		policy.HealthTimeout = DefaultUpdatePolicy.HealthTimeout
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updatePolicy = policy
+}
+
+// SetUpdates sets the channel image updates are reported to
+func (p *Plugin) SetUpdates(updates chan<- interface{}) {
+	p.updates = updates
+}
+
+// UpdateContainer recreates a container from the newest image of its
+// reference if the registry has a newer one. The container keeps its
+// config; if it doesn't become healthy within healthTimeout it is rolled
+// back to the old container.
+func (m *Manager) UpdateContainer(ctx context.Context, id string, healthTimeout time.Duration) ImageUpdate {
+	update := ImageUpdate{Container: id, Timestamp: time.Now()}
+	fail := func(err error) ImageUpdate {
+		update.Outcome = UpdateFailed
+		update.Error = err.Error()
+		return update
+	}
+
+	old, err := m.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return fail(fmt.Errorf("failed to inspect container: %w", err))
+	}
+	update.Name = strings.TrimPrefix(old.Name, "/")
+	update.Image = old.Config.Image
+	update.OldImageID = old.Image
+
+	// Compare the registry's digest with the ones the local image was
+	// pulled as
+	remote, err := m.client.DistributionInspect(ctx, old.Config.Image, "")
+	if err != nil {
+		return fail(fmt.Errorf("failed to query registry: %w", err))
+	}
+	update.Digest = remote.Descriptor.Digest.String()
+	local, _, err := m.client.ImageInspectWithRaw(ctx, old.Image)
+	if err != nil {
+		return fail(fmt.Errorf("failed to inspect image: %w", err))
+	}
+	for _, digest := range local.RepoDigests {
+		if strings.HasSuffix(digest, "@"+update.Digest) {
+			update.Outcome = UpdateCurrent
+			return update
+		}
+	}
+
+	if err := m.PullImage(ctx, old.Config.Image); err != nil {
+		return fail(err)
+	}
+	pulled, _, err := m.client.ImageInspectWithRaw(ctx, old.Config.Image)
+	if err != nil {
+		return fail(fmt.Errorf("failed to inspect image: %w", err))
+	}
+	update.NewImageID = pulled.ID
+	if pulled.ID == old.Image {
+		update.Outcome = UpdateCurrent
+		return update
+	}
+
+	// Keep the old container aside until the new one proves healthy
+	backup := fmt.Sprintf("%s-shh-old-%d", update.Name, time.Now().Unix())
+	if err := m.StopContainer(ctx, id, nil); err != nil {
+		return fail(err)
+	}
+	if err := m.client.ContainerRename(ctx, id, backup); err != nil {
+		m.restore(ctx, id, update.Name, "")
+		return fail(fmt.Errorf("failed to rename container: %w", err))
+	}
+
+	newID, err := m.recreate(ctx, old, healthTimeout)
+	if err != nil {
+		m.restore(ctx, id, update.Name, newID)
+		update.Outcome = UpdateRolledBack
+		update.Error = err.Error()
+		return update
+	}
+	if err := m.RemoveContainer(ctx, id, true); err != nil {
+		m.logger.Warn("Failed to remove replaced container",
+			zap.String("container", id),
+			zap.Error(err))
+	}
+	update.Container = newID
+	update.Outcome = UpdateApplied
+	return update
+}
+
+// recreate creates and starts a container with the config of old and
+// waits for it to become healthy. It returns the new container's ID
+// even when it fails, so that it can be removed.
+func (m *Manager) recreate(ctx context.Context, old types.ContainerJSON, healthTimeout time.Duration) (string, error) {
+	networks := make([]string, 0, len(old.NetworkSettings.Networks))
+	for name := range old.NetworkSettings.Networks {
+		networks = append(networks, name)
+	}
+	sort.Strings(networks)
+	endpoint := func(name string) *network.EndpointSettings {
+		settings := old.NetworkSettings.Networks[name]
+		return &network.EndpointSettings{
+			IPAMConfig: settings.IPAMConfig,
+			Links:      settings.Links,
+			Aliases:    settings.Aliases,
+		}
+	}
+
+	// Older daemons accept a single network on create, so the others are
+	// connected afterwards
+	var networking *network.NetworkingConfig
+	if len(networks) > 0 && !old.HostConfig.NetworkMode.IsHost() && !old.HostConfig.NetworkMode.IsNone() {
+		networking = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{networks[0]: endpoint(networks[0])},
+		}
+	} else {
+		networks = nil
+	}
+
+	created, err := m.client.ContainerCreate(ctx, old.Config, old.HostConfig, networking, nil, strings.TrimPrefix(old.Name, "/"))
+	if err != nil {
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+	for i := 1; i < len(networks); i++ {
+		if err := m.client.NetworkConnect(ctx, networks[i], created.ID, endpoint(networks[i])); err != nil {
+			return created.ID, fmt.Errorf("failed to connect network %s: %w", networks[i], err)
+		}
+	}
+	if err := m.StartContainer(ctx, created.ID); err != nil {
+		return created.ID, err
+	}
+	return created.ID, m.waitHealthy(ctx, created.ID, healthTimeout)
+}
+
+// waitHealthy waits for a container to pass its health check, or to keep
+// running for timeout if it has none
+func (m *Manager) waitHealthy(ctx context.Context, id string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		inspect, err := m.client.ContainerInspect(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to inspect container: %w", err)
+		}
+		state := inspect.State
+		if state == nil || !state.Running {
+			return fmt.Errorf("container exited after update")
+		}
+		if state.Health != nil {
+			switch state.Health.Status {
+			case types.Healthy:
+				return nil
+			case types.Unhealthy:
+				return fmt.Errorf("container unhealthy after update")
+			}
+		}
+		if time.Now().After(deadline) {
+			if state.Health != nil {
+				return fmt.Errorf("container not healthy within %s", timeout)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// restore removes a failed replacement and brings the old container back
+func (m *Manager) restore(ctx context.Context, id, name, replacement string) {
+	if replacement != "" {
+		if err := m.RemoveContainer(ctx, replacement, true); err != nil {
+			m.logger.Error("Failed to remove failed replacement",
+				zap.String("container", replacement),
+				zap.Error(err))
+		}
+	}
+	if err := m.client.ContainerRename(ctx, id, name); err != nil {
+		m.logger.Error("Failed to restore container name",
+			zap.String("container", id),
+			zap.Error(err))
+	}
+	if err := m.StartContainer(ctx, id); err != nil {
+		m.logger.Error("Failed to restart container after rollback",
+			zap.String("container", id),
+			zap.Error(err))
+	}
+}
+
+// autoUpdateContainers returns the containers opted into updates
+func (m *Manager) autoUpdateContainers(ctx context.Context) ([]types.Container, error) {
+	containers, err := m.client.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelAutoUpdate+"=true")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	return containers, nil
+}
+
+// checkUpdates updates the opted-in containers, or only id if set, and
+// reports each outcome
+func (p *Plugin) checkUpdates(ctx context.Context, id string) ([]ImageUpdate, error) {
+	p.mu.RLock()
+	policy := p.updatePolicy
+	p.mu.RUnlock()
+
+	containers, err := p.manager.autoUpdateContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	updates := make([]ImageUpdate, 0, len(containers))
+	for _, c := range containers {
+		if id != "" && c.ID != id && !strings.HasPrefix(c.ID, id) && !containsName(c.Names, id) {
+			continue
+		}
+		update := p.manager.UpdateContainer(ctx, c.ID, policy.HealthTimeout)
+		updates = append(updates, update)
+		if update.Outcome == UpdateCurrent {
+			continue
+		}
+		p.logger.Info("Container image update",
+			zap.String("container", update.Name),
+			zap.String("outcome", update.Outcome),
+			zap.String("error", update.Error))
+		p.reportUpdate(update)
+	}
+	if id != "" && len(updates) == 0 {
+		return nil, protocol.Errorf(protocol.ErrorNotFound, "no auto-update container: %s", id)
+	}
+	return updates, nil
+}
+
+// watchUpdates checks for newer images by the policy until ctx is done
+func (p *Plugin) watchUpdates(ctx context.Context) {
+	for {
+		p.mu.RLock()
+		interval := p.updatePolicy.Interval
+		p.mu.RUnlock()
+
+		wait := interval
+		if wait <= 0 {
+			// Checks are disabled; look again in case the policy changes
+			wait = time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if interval <= 0 {
+			continue
+		}
+		if _, err := p.checkUpdates(ctx, ""); err != nil {
+			p.logger.Warn("Failed to check image updates", zap.Error(err))
+		}
+	}
+}
+
+func (p *Plugin) reportUpdate(update ImageUpdate) {
+	if p.updates == nil {
+		return
+	}
+	select {
+	case p.updates <- update:
+	default:
+		p.logger.Warn("Failed to send image update: channel full")
+	}
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.TrimPrefix(n, "/") == name {
+			return true
+		}
+	}
+	return false
+}
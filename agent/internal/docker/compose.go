@@ -1,2393 +0,0 @@
-package docker
-
-import (
-	"context"
-	"fmt"
-	"io"
-	"os"
-	"path/filepath"
-
-	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/api/types/nat"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/container"
-	"
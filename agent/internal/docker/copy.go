@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/transfer"
+)
+
+// FileChange is a path of a container filesystem that differs from its
+// image
+type FileChange struct {
+	Path string `json:"path"`
+	// Kind is added, modified or deleted
+	Kind string `json:"kind"`
+}
+
+// ContainerDiff returns the paths a container changed in its image
+func (m *Manager) ContainerDiff(ctx context.Context, id string) ([]FileChange, error) {
+	diff, err := m.client.ContainerDiff(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff container: %w", err)
+	}
+
+	changes := make([]FileChange, 0, len(diff))
+	for _, change := range diff {
+		kind := "modified"
+		switch change.Kind {
+		case container.ChangeAdd:
+			kind = "added"
+		case container.ChangeDelete:
+			kind = "deleted"
+		}
+		changes = append(changes, FileChange{Path: change.Path, Kind: kind})
+	}
+	return changes, nil
+}
+
+// CopyFromContainer returns a tar archive of a file or directory of a
+// container
+func (m *Manager) CopyFromContainer(ctx context.Context, id, srcPath string) (io.ReadCloser, error) {
+	reader, _, err := m.client.CopyFromContainer(ctx, id, srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy from container: %w", err)
+	}
+	return reader, nil
+}
+
+// CopyToContainer extracts a tar archive into a directory of a container
+func (m *Manager) CopyToContainer(ctx context.Context, id, dstDir string, archive io.Reader) error {
+	err := m.client.CopyToContainer(ctx, id, dstDir, archive, types.CopyToContainerOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to copy to container: %w", err)
+	}
+	return nil
+}
+
+// SetTransfers lets docker:container:cp stage files copied out of
+// containers as downloads and copy uploads into containers
+func (p *Plugin) SetTransfers(transfers *transfer.Manager) {
+	p.transfers = transfers
+}
+
+// handleCopy copies files between containers and transfers
+func (p *Plugin) handleCopy(ctx context.Context, args []string) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, protocol.Errorf(protocol.ErrorValidation, "container ID, direction and container path required")
+	}
+	if p.transfers == nil {
+		return nil, fmt.Errorf("file transfers are not enabled")
+	}
+	id, direction, containerPath := args[0], args[1], args[2]
+
+	switch direction {
+	case "from":
+		// The transfer holds the tar archive docker produces, so that
+		// directories copy with their layout and permissions
+		reader, err := p.manager.CopyFromContainer(ctx, id, containerPath)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		transferID := fmt.Sprintf("docker-cp-%d", time.Now().UnixNano())
+		return p.transfers.Stage(transferID, id+":"+containerPath, reader)
+	case "to":
+		if len(args) < 4 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "transfer ID required")
+		}
+		f, upload, err := p.transfers.Open(args[3])
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		// Docker only accepts archives, so the upload is streamed as one
+		// tar entry named after the destination
+		archive, writer := io.Pipe()
+		crash.Go("docker-cp", func() {
+			tw := tar.NewWriter(writer)
+			err := tw.WriteHeader(&tar.Header{
+				Name:    path.Base(containerPath),
+				Mode:    0644,
+				Size:    upload.Size,
+				ModTime: time.Now(),
+			})
+			if err == nil {
+				_, err = io.Copy(tw, f)
+			}
+			if err == nil {
+				err = tw.Close()
+			}
+			writer.CloseWithError(err)
+		})
+		err = p.manager.CopyToContainer(ctx, id, path.Dir(containerPath), archive)
+		archive.Close()
+		return nil, err
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "direction must be from or to: %s", direction)
+	}
+}
@@ -0,0 +1,178 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+)
+
+// Kinds of container alerts
+const (
+	AlertOOM         = "oom"
+	AlertRestartLoop = "restart_loop"
+)
+
+// CrashPolicy decides when dying containers are alerted on
+type CrashPolicy struct {
+	// Restarts are the deaths within Window that make a restart loop
+	Restarts int
+	Window   time.Duration
+	// Cooldown is the least time between two alerts of one kind for a
+	// container
+	Cooldown time.Duration
+	// LogLines are the last log lines attached to alerts
+	LogLines int
+}
+
+// DefaultCrashPolicy alerts on 5 deaths within 5 minutes, at most every
+// 15 minutes per container
+var DefaultCrashPolicy = CrashPolicy{
+	Restarts: 5,
+	Window:   5 * time.Minute,
+	Cooldown: 15 * time.Minute,
+	LogLines: 50,
+}
+
+// ContainerAlert reports a container that was OOM killed or keeps dying
+type ContainerAlert struct {
+	Kind        string `json:"kind"`
+	ContainerID string `json:"container_id"`
+	Name        string `json:"name"`
+	Image       string `json:"image,omitempty"`
+	// Count is how often the container was OOM killed or died within
+	// the window
+	Count     int       `json:"count"`
+	Window    float64   `json:"window_seconds"`
+	ExitCode  string    `json:"exit_code,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Logs      string    `json:"logs,omitempty"`
+}
+
+// crashHistory is what happened to one container within the window
+type crashHistory struct {
+	name     string
+	image    string
+	exitCode string
+	deaths   []time.Time
+	ooms     []time.Time
+	alerted  map[string]time.Time
+}
+
+// SetCrashPolicy changes when dying containers are alerted on. Zero
+// fields take the defaults.
+func (p *Plugin) SetCrashPolicy(policy CrashPolicy) {
+	if policy.Restarts <= 0 {
+		policy.Restarts = DefaultCrashPolicy.Restarts
+	}
+	if policy.Window <= 0 {
+		policy.Window = DefaultCrashPolicy.Window
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = DefaultCrashPolicy.Cooldown
+	}
+	if policy.LogLines <= 0 {
+		policy.LogLines = DefaultCrashPolicy.LogLines
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.crashPolicy = policy
+}
+
+// SetAlerts sets the channel container alerts are published to
+func (p *Plugin) SetAlerts(alerts chan<- interface{}) {
+	p.alerts = alerts
+}
+
+// observeCrash records an OOM kill or death and alerts when a container
+// crosses the policy
+func (p *Plugin) observeCrash(ctx context.Context, histories map[string]*crashHistory, event ContainerEvent) {
+	if event.Action != "oom" && event.Action != "die" {
+		if event.Action == "destroy" {
+			delete(histories, event.ID)
+		}
+		return
+	}
+	p.mu.RLock()
+	policy := p.crashPolicy
+	p.mu.RUnlock()
+
+	now := time.Unix(0, event.TimeNano)
+	history, ok := histories[event.ID]
+	if !ok {
+		history = &crashHistory{alerted: make(map[string]time.Time)}
+		histories[event.ID] = history
+	}
+	history.name = event.Name
+	history.image = event.Labels["image"]
+	history.deaths = within(history.deaths, now, policy.Window)
+	history.ooms = within(history.ooms, now, policy.Window)
+
+	kind := AlertRestartLoop
+	times := &history.deaths
+	if event.Action == "oom" {
+		kind = AlertOOM
+		times = &history.ooms
+	} else {
+		history.exitCode = event.Labels["exitCode"]
+	}
+	*times = append(*times, now)
+	if kind == AlertRestartLoop && len(*times) < policy.Restarts {
+		return
+	}
+	if last, ok := history.alerted[kind]; ok && now.Sub(last) < policy.Cooldown {
+		return
+	}
+	history.alerted[kind] = now
+
+	alert := ContainerAlert{
+		Kind:        kind,
+		ContainerID: event.ID,
+		Name:        history.name,
+		Image:       history.image,
+		Count:       len(*times),
+		Window:      policy.Window.Seconds(),
+		ExitCode:    history.exitCode,
+		FirstSeen:   (*times)[0],
+		LastSeen:    now,
+	}
+	p.logger.Warn("Container crashing",
+		zap.String("kind", kind),
+		zap.String("container", alert.Name),
+		zap.Int("count", alert.Count))
+
+	// Fetching logs can be slow, so they don't hold up the event stream
+	crash.Go("docker-crash-alert", func() {
+		logs, err := p.manager.GetContainerLogs(ctx, event.ID, policy.LogLines)
+		if err != nil {
+			p.logger.Debug("Failed to get logs for alert", zap.String("container", event.ID), zap.Error(err))
+		}
+		alert.Logs = logs
+		p.publishAlert(alert)
+	})
+}
+
+func (p *Plugin) publishAlert(alert ContainerAlert) {
+	if p.alerts == nil {
+		return
+	}
+	select {
+	case p.alerts <- alert:
+	default:
+		p.logger.Warn("Failed to send container alert: channel full")
+	}
+}
+
+// within drops the times older than window before now
+func within(times []time.Time, now time.Time, window time.Duration) []time.Time {
+	kept := times[:0]
+	for _, t := range times {
+		if now.Sub(t) <= window {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,463 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"shh/agent/internal/protocol"
+)
+
+// Labels compose puts on the containers it creates
+const (
+	labelProject     = "com.docker.compose.project"
+	labelService     = "com.docker.compose.service"
+	labelConfigFiles = "com.docker.compose.project.config_files"
+	labelWorkingDir  = "com.docker.compose.project.working_dir"
+)
+
+// DriftPolicy decides how often compose projects are checked for drift
+// and which are converged automatically
+type DriftPolicy struct {
+	// Interval between checks; zero disables them
+	Interval time.Duration
+	// AutoConverge are the projects brought back in line with
+	// compose up -d when they drift; "*" converges every project
+	AutoConverge []string
+}
+
+// DefaultDriftPolicy checks every 10 minutes and converges nothing
+var DefaultDriftPolicy = DriftPolicy{Interval: 10 * time.Minute}
+
+// DriftReport compares the containers of a compose project with its
+// compose files
+type DriftReport struct {
+	Project     string         `json:"project"`
+	ConfigFiles []string       `json:"config_files"`
+	WorkingDir  string         `json:"working_dir,omitempty"`
+	Services    []ServiceDrift `json:"services,omitempty"`
+	// Error is set when the compose files couldn't be read
+	Error     string    `json:"error,omitempty"`
+	Converged bool      `json:"converged,omitempty"`
+	Checked   time.Time `json:"checked"`
+}
+
+// Drifted reports whether any service differs from the compose files
+func (r DriftReport) Drifted() bool {
+	return len(r.Services) > 0
+}
+
+// ServiceDrift is how a service differs from its compose definition
+type ServiceDrift struct {
+	Service   string `json:"service"`
+	Container string `json:"container,omitempty"`
+	// Missing is set when no container runs a declared service, and
+	// Orphaned when a container's service is no longer declared
+	Missing     bool         `json:"missing,omitempty"`
+	Orphaned    bool         `json:"orphaned,omitempty"`
+	Differences []Difference `json:"differences,omitempty"`
+}
+
+// Difference is a setting whose running value isn't the declared one
+type Difference struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// composeService is the part of a compose service drift is checked on
+type composeService struct {
+	Image       string        `yaml:"image"`
+	Environment interface{}   `yaml:"environment"`
+	Ports       []interface{} `yaml:"ports"`
+}
+
+// SetDriftPolicy changes how compose projects are checked for drift
+func (p *Plugin) SetDriftPolicy(policy DriftPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.driftPolicy = policy
+}
+
+// ComposeDrift checks the compose projects with containers on the host,
+// or only project if set, against their compose files
+func (m *Manager) ComposeDrift(ctx context.Context, project string) ([]DriftReport, error) {
+	args := filters.NewArgs(filters.Arg("label", labelProject))
+	if project != "" {
+		args = filters.NewArgs(filters.Arg("label", labelProject+"="+project))
+	}
+	containers, err := m.client.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	projects := make(map[string][]types.Container)
+	for _, c := range containers {
+		name := c.Labels[labelProject]
+		projects[name] = append(projects[name], c)
+	}
+	if project != "" && len(projects) == 0 {
+		return nil, protocol.Errorf(protocol.ErrorNotFound, "compose project not found: %s", project)
+	}
+
+	reports := make([]DriftReport, 0, len(projects))
+	for name, members := range projects {
+		reports = append(reports, m.projectDrift(ctx, name, members))
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Project < reports[j].Project
+	})
+	return reports, nil
+}
+
+// ConvergeProject runs compose up -d for a project from the compose files
+// its containers were created from
+func (m *Manager) ConvergeProject(ctx context.Context, report DriftReport) error {
+	if len(report.ConfigFiles) == 0 {
+		return fmt.Errorf("no compose files known for project %s", report.Project)
+	}
+	args := []string{"compose", "-p", report.Project}
+	for _, file := range report.ConfigFiles {
+		args = append(args, "-f", file)
+	}
+	args = append(args, "up", "-d")
+
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Dir = report.WorkingDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to converge project %s: %w: %s", report.Project, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// projectDrift compares the containers of one project with its files
+func (m *Manager) projectDrift(ctx context.Context, project string, containers []types.Container) DriftReport {
+	report := DriftReport{Project: project, Checked: time.Now()}
+	labels := containers[0].Labels
+	report.WorkingDir = labels[labelWorkingDir]
+	for _, file := range strings.Split(labels[labelConfigFiles], ",") {
+		if file = strings.TrimSpace(file); file == "" {
+			continue
+		}
+		if !filepath.IsAbs(file) && report.WorkingDir != "" {
+			file = filepath.Join(report.WorkingDir, file)
+		}
+		report.ConfigFiles = append(report.ConfigFiles, file)
+	}
+
+	services, err := readComposeServices(report.ConfigFiles)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	running := make(map[string]bool)
+	for _, c := range containers {
+		service := c.Labels[labelService]
+		running[service] = true
+		declared, ok := services[service]
+		if !ok {
+			report.Services = append(report.Services, ServiceDrift{Service: service, Container: c.ID, Orphaned: true})
+			continue
+		}
+
+		inspect, err := m.client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			m.logger.Warn("Failed to inspect container for drift",
+				zap.String("container", c.ID),
+				zap.Error(err))
+			continue
+		}
+		if differences := serviceDifferences(declared, inspect); len(differences) > 0 {
+			report.Services = append(report.Services, ServiceDrift{Service: service, Container: c.ID, Differences: differences})
+		}
+	}
+	for service := range services {
+		if !running[service] {
+			report.Services = append(report.Services, ServiceDrift{Service: service, Missing: true})
+		}
+	}
+	sort.Slice(report.Services, func(i, j int) bool {
+		return report.Services[i].Service < report.Services[j].Service
+	})
+	return report
+}
+
+// readComposeServices reads the services of compose files, later files
+// overriding the settings of earlier ones
+func readComposeServices(files []string) (map[string]composeService, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no compose files known")
+	}
+	services := make(map[string]composeService)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read compose file: %w", err)
+		}
+		var compose struct {
+			Services map[string]composeService `yaml:"services"`
+		}
+		if err := yaml.Unmarshal(data, &compose); err != nil {
+			return nil, fmt.Errorf("failed to parse compose file %s: %w", file, err)
+		}
+		for name, override := range compose.Services {
+			service := services[name]
+			if override.Image != "" {
+				service.Image = override.Image
+			}
+			if override.Environment != nil {
+				service.Environment = override.Environment
+			}
+			if override.Ports != nil {
+				service.Ports = override.Ports
+			}
+			services[name] = service
+		}
+	}
+	return services, nil
+}
+
+// serviceDifferences compares the image, environment and published ports
+// of a container with its service. Values compose would interpolate are
+// skipped, as the agent can't know them.
+func serviceDifferences(service composeService, inspect types.ContainerJSON) []Difference {
+	var differences []Difference
+	if inspect.Config == nil || inspect.HostConfig == nil {
+		return nil
+	}
+
+	if service.Image != "" && !strings.Contains(service.Image, "$") &&
+		normalizeImage(service.Image) != normalizeImage(inspect.Config.Image) {
+		differences = append(differences, Difference{Field: "image", Expected: service.Image, Actual: inspect.Config.Image})
+	}
+
+	actualEnv := make(map[string]string, len(inspect.Config.Env))
+	for _, entry := range inspect.Config.Env {
+		key, value, _ := strings.Cut(entry, "=")
+		actualEnv[key] = value
+	}
+	declaredEnv := composeEnvironment(service.Environment)
+	keys := make([]string, 0, len(declaredEnv))
+	for key := range declaredEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		expected := declaredEnv[key]
+		if strings.Contains(expected, "$") {
+			continue
+		}
+		if actual, ok := actualEnv[key]; !ok || actual != expected {
+			differences = append(differences, Difference{Field: "env." + key, Expected: expected, Actual: actual})
+		}
+	}
+
+	expectedPorts := composePorts(service.Ports)
+	actualPorts := make([]string, 0)
+	for port, bindings := range inspect.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			if binding.HostPort != "" {
+				actualPorts = append(actualPorts, binding.HostPort+":"+string(port))
+			}
+		}
+	}
+	sort.Strings(actualPorts)
+	if expectedPorts != nil && strings.Join(expectedPorts, ",") != strings.Join(actualPorts, ",") {
+		differences = append(differences, Difference{
+			Field:    "ports",
+			Expected: strings.Join(expectedPorts, ","),
+			Actual:   strings.Join(actualPorts, ","),
+		})
+	}
+	return differences
+}
+
+// composeEnvironment reads environment as a map or a KEY=VALUE list
+func composeEnvironment(environment interface{}) map[string]string {
+	env := make(map[string]string)
+	switch e := environment.(type) {
+	case map[string]interface{}:
+		for key, value := range e {
+			if value != nil {
+				env[key] = fmt.Sprint(value)
+			}
+		}
+	case []interface{}:
+		for _, entry := range e {
+			// Entries without a value are taken from the compose
+			// environment, so they can't be checked
+			if key, value, ok := strings.Cut(fmt.Sprint(entry), "="); ok {
+				env[key] = value
+			}
+		}
+	}
+	return env
+}
+
+// composePorts returns the published ports as hostport:port/protocol,
+// sorted, or nil if any can't be checked
+func composePorts(ports []interface{}) []string {
+	published := make([]string, 0, len(ports))
+	for _, port := range ports {
+		var hostPort, target, proto string
+		switch p := port.(type) {
+		case string:
+			spec, suffix, _ := strings.Cut(p, "/")
+			proto = suffix
+			parts := strings.Split(spec, ":")
+			if len(parts) == 1 {
+				continue
+			}
+			hostPort, target = parts[len(parts)-2], parts[len(parts)-1]
+		case int:
+			continue
+		case map[string]interface{}:
+			if p["published"] == nil {
+				continue
+			}
+			hostPort, target = fmt.Sprint(p["published"]), fmt.Sprint(p["target"])
+			if p["protocol"] != nil {
+				proto = fmt.Sprint(p["protocol"])
+			}
+		default:
+			return nil
+		}
+		if _, err := strconv.Atoi(hostPort); err != nil {
+			return nil
+		}
+		if _, err := strconv.Atoi(target); err != nil {
+			return nil
+		}
+		if proto == "" {
+			proto = "tcp"
+		}
+		published = append(published, hostPort+":"+target+"/"+proto)
+	}
+	sort.Strings(published)
+	return published
+}
+
+// normalizeImage adds the latest tag to untagged image references
+func normalizeImage(image string) string {
+	if strings.Contains(image, "@") {
+		return image
+	}
+	if strings.LastIndex(image, ":") <= strings.LastIndex(image, "/") {
+		return image + ":latest"
+	}
+	return image
+}
+
+// handleDrift runs docker:compose:drift [project]
+func (p *Plugin) handleDrift(ctx context.Context, args []string) (interface{}, error) {
+	project := ""
+	if len(args) > 0 {
+		project = args[0]
+	}
+	return p.manager.ComposeDrift(ctx, project)
+}
+
+// handleConverge runs docker:compose:converge <project>
+func (p *Plugin) handleConverge(ctx context.Context, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, protocol.Errorf(protocol.ErrorValidation, "project required")
+	}
+	reports, err := p.manager.ComposeDrift(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	report := reports[0]
+	if report.Error != "" {
+		return nil, fmt.Errorf("failed to check project %s: %s", report.Project, report.Error)
+	}
+	if err := p.manager.ConvergeProject(ctx, report); err != nil {
+		return nil, err
+	}
+	report.Converged = true
+	return report, nil
+}
+
+// watchDrift checks the compose projects for drift by the policy until
+// ctx is done, reporting drifted projects and converging the allowed ones
+func (p *Plugin) watchDrift(ctx context.Context) {
+	for {
+		p.mu.RLock()
+		policy := p.driftPolicy
+		p.mu.RUnlock()
+
+		wait := policy.Interval
+		if wait <= 0 {
+			// Checks are disabled; look again in case the policy changes
+			wait = time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if policy.Interval <= 0 {
+			continue
+		}
+
+		reports, err := p.manager.ComposeDrift(ctx, "")
+		if err != nil {
+			p.logger.Warn("Failed to check compose drift", zap.Error(err))
+			continue
+		}
+		for _, report := range reports {
+			if !report.Drifted() {
+				continue
+			}
+			p.logger.Warn("Compose project drifted",
+				zap.String("project", report.Project),
+				zap.Int("services", len(report.Services)))
+			if report.Error == "" && allowsProject(policy.AutoConverge, report.Project) {
+				if err := p.manager.ConvergeProject(ctx, report); err != nil {
+					p.logger.Error("Failed to converge compose project",
+						zap.String("project", report.Project),
+						zap.Error(err))
+				} else {
+					report.Converged = true
+				}
+			}
+			p.sendEvent(map[string]interface{}{
+				"type":  "docker:compose:drift",
+				"drift": report,
+			})
+		}
+	}
+}
+
+func allowsProject(projects []string, project string) bool {
+	for _, allowed := range projects {
+		if allowed == "*" || allowed == project {
+			return true
+		}
+	}
+	return false
+}
+
+// sendEvent publishes an event without blocking
+func (p *Plugin) sendEvent(event interface{}) {
+	if p.events == nil {
+		return
+	}
+	select {
+	case p.events <- event:
+	default:
+		p.logger.Warn("Failed to send Docker event: channel full")
+	}
+}
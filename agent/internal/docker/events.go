@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// SetEventFilter selects the container events forwarded to the server
+func (p *Plugin) SetEventFilter(filter protocol.DockerEventFilter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.eventFilter = filter
+}
+
+// EventFilter returns the filter of the forwarded container events
+func (p *Plugin) EventFilter() protocol.DockerEventFilter {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.eventFilter
+}
+
+// handleEventFilter runs docker:events:filter [filter-json], replacing the
+// filter if one is given and returning the filter in effect
+func (p *Plugin) handleEventFilter(args []string) (interface{}, error) {
+	if len(args) > 0 {
+		var filter protocol.DockerEventFilter
+		if err := json.Unmarshal([]byte(args[0]), &filter); err != nil {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "invalid event filter: %w", err)
+		}
+		p.SetEventFilter(filter)
+	}
+	return p.EventFilter(), nil
+}
+
+// watchEvents follows the container events until ctx is done, watching
+// for crashing containers and forwarding the events the filter selects
+func (p *Plugin) watchEvents(ctx context.Context) {
+	histories := make(map[string]*crashHistory)
+	events, errs := p.manager.GetEvents(ctx)
+	for events != nil {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			p.observeCrash(ctx, histories, event)
+			if e := event.payload(); p.EventFilter().Matches(e) {
+				p.sendEvent(e)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			p.logger.Warn("Docker event stream failed, resubscribing", zap.Error(err))
+		}
+	}
+}
+
+// payload converts the event for the protocol. Container labels are the
+// actor attributes docker doesn't add itself.
+func (e ContainerEvent) payload() protocol.DockerEvent {
+	labels := make(map[string]string, len(e.Labels))
+	for key, value := range e.Labels {
+		switch key {
+		case "name", "image", "exitCode", "signal", "execDuration":
+			continue
+		}
+		labels[key] = value
+	}
+	return protocol.DockerEvent{
+		Action:    e.Action,
+		ID:        e.ID,
+		Name:      e.Name,
+		Image:     e.Labels["image"],
+		ExitCode:  e.Labels["exitCode"],
+		Labels:    labels,
+		Timestamp: time.Unix(0, e.TimeNano),
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -26,6 +28,12 @@ type ContainerEvent struct {
 	TimeNano int64
 }
 
+// Backoff between resubscriptions to the Docker event stream
+const (
+	eventsMinBackoff = time.Second
+	eventsMaxBackoff = time.Minute
+)
+
 type Manager struct {
 	client  *client.Client
 	logger  *zap.Logger
@@ -176,42 +184,49 @@ func (m *Manager) GetContainerStats(ctx context.Context, id string) (*types.Stat
 	return &statsJSON, nil
 }
 
+// GetEvents streams container events until ctx is done. When the event
+// stream fails, the failure is sent on the error channel and the events
+// are subscribed to again with backoff, from where the stream left off.
 func (m *Manager) GetEvents(ctx context.Context) (<-chan ContainerEvent, <-chan error) {
 	eventsChan := make(chan ContainerEvent)
-	errChan := make(chan error)
+	errChan := make(chan error, 1)
 
 	go func() {
 		defer close(eventsChan)
 		defer close(errChan)
 
-		options := types.EventsOptions{
-			Filters: filters.NewArgs(
-				filters.Arg("type", "container"),
-			),
-		}
-
-		events, errs := m.client.Events(ctx, options)
+		// last is the time of the latest event forwarded, so that a
+		// resubscription neither misses nor repeats events
+		last := time.Now().UnixNano()
+		backoff := eventsMinBackoff
 		for {
-			select {
-			case event := <-events:
-				if event.Type == "container" {
-					eventsChan <- ContainerEvent{
-						Action:   event.Action,
-						ID:       event.Actor.ID,
-						Name:     event.Actor.Attributes["name"],
-						Type:     event.Type,
-						Status:   event.Status,
-						Labels:   event.Actor.Attributes,
-						TimeNano: event.TimeNano,
-					}
-				}
-			case err := <-errs:
-				if err != nil {
-					errChan <- fmt.Errorf("error receiving Docker events: %w", err)
-				}
+			options := types.EventsOptions{
+				Since: strconv.FormatInt(time.Unix(0, last).Unix(), 10),
+				Filters: filters.NewArgs(
+					filters.Arg("type", "container"),
+				),
+			}
+			before := last
+			err := m.streamEvents(ctx, options, eventsChan, &last)
+			if last != before {
+				// The stream worked for a while, so start backing off anew
+				backoff = eventsMinBackoff
+			}
+			if ctx.Err() != nil {
 				return
+			}
+			select {
+			case errChan <- err:
+			default:
+			}
+
+			select {
 			case <-ctx.Done():
 				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > eventsMaxBackoff {
+				backoff = eventsMaxBackoff
 			}
 		}
 	}()
@@ -219,6 +234,42 @@ func (m *Manager) GetEvents(ctx context.Context) (<-chan ContainerEvent, <-chan
 	return eventsChan, errChan
 }
 
+// streamEvents forwards the events of one subscription newer than last
+// until it fails or ctx is done
+func (m *Manager) streamEvents(ctx context.Context, options types.EventsOptions, out chan<- ContainerEvent, last *int64) error {
+	events, errs := m.client.Events(ctx, options)
+	for {
+		select {
+		case event := <-events:
+			if event.Type != "container" || event.TimeNano <= *last {
+				continue
+			}
+			e := ContainerEvent{
+				Action:   event.Action,
+				ID:       event.Actor.ID,
+				Name:     event.Actor.Attributes["name"],
+				Type:     event.Type,
+				Status:   event.Status,
+				Labels:   event.Actor.Attributes,
+				TimeNano: event.TimeNano,
+			}
+			select {
+			case out <- e:
+				*last = e.TimeNano
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case err := <-errs:
+			if err == nil {
+				err = fmt.Errorf("event stream closed")
+			}
+			return fmt.Errorf("error receiving Docker events: %w", err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 func (m *Manager) HealthCheck(ctx context.Context) error {
 	_, err := m.client.Ping(ctx)
 	if err != nil {
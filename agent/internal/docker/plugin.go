@@ -3,11 +3,15 @@ package docker
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/transfer"
 )
 
 // Plugin implements the agent.Plugin interface for Docker operations
@@ -15,6 +19,21 @@ type Plugin struct {
 	manager *Manager
 	logger  *zap.Logger
 	events  chan<- interface{} // Channel for sending events to agent
+
+	// transfers holds the files copied to and from containers
+	transfers *transfer.Manager
+
+	mu sync.RWMutex
+	// mountAllowlist are the host paths containers may bind mount
+	mountAllowlist []string
+	crashPolicy    CrashPolicy
+	driftPolicy    DriftPolicy
+	updatePolicy   UpdatePolicy
+	eventFilter    protocol.DockerEventFilter
+	// alerts receives the OOM and restart loop alerts
+	alerts chan<- interface{}
+	// updates receives the outcomes of automatic image updates
+	updates chan<- interface{}
 }
 
 // NewPlugin creates a new Docker plugin
@@ -28,6 +47,10 @@ func NewPlugin(logger *zap.Logger, events chan<- interface{}) (*Plugin, error) {
 		manager: manager,
 		logger:  logger,
 		events:  events,
+
+		crashPolicy:  DefaultCrashPolicy,
+		driftPolicy:  DefaultDriftPolicy,
+		updatePolicy: DefaultUpdatePolicy,
 	}, nil
 }
 
@@ -40,6 +63,12 @@ func (p *Plugin) Name() string {
 func (p *Plugin) Start(ctx context.Context) error {
 	// Start stats collection
 	go p.collectStats(ctx)
+	// Forward container events and watch for crashing containers
+	go p.watchEvents(ctx)
+	// Check compose projects for drift
+	go p.watchDrift(ctx)
+	// Update the images of opted-in containers
+	go p.watchUpdates(ctx)
 	return nil
 }
 
@@ -79,6 +108,34 @@ func (p *Plugin) HandleCommand(ctx context.Context, cmd string, args []string) (
 			fmt.Sscanf(args[1], "%d", &tail)
 		}
 		return p.manager.GetContainerLogs(ctx, args[0], tail)
+	case "docker:container:diff":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "container ID required")
+		}
+		return p.manager.ContainerDiff(ctx, args[0])
+	case "docker:container:run":
+		// docker:container:run <spec-json>
+		return p.handleRun(ctx, args)
+	case "docker:compose:drift":
+		// docker:compose:drift [project]
+		return p.handleDrift(ctx, args)
+	case "docker:compose:converge":
+		// docker:compose:converge <project>
+		return p.handleConverge(ctx, args)
+	case "docker:events:filter":
+		// docker:events:filter [filter-json]
+		return p.handleEventFilter(args)
+	case "docker:autoupdate:check":
+		// docker:autoupdate:check [container]
+		id := ""
+		if len(args) > 0 {
+			id = args[0]
+		}
+		return p.checkUpdates(ctx, id)
+	case "docker:container:cp":
+		// docker:container:cp <id> from <container-path>
+		// docker:container:cp <id> to <container-path> <transfer-id>
+		return p.handleCopy(ctx, args)
 	default:
 		return nil, fmt.Errorf("unknown Docker command: %s", cmd)
 	}
@@ -169,36 +226,35 @@ func (p *Plugin) collectStats(ctx context.Context) {
 	}
 }
 
-// Calculate total disk usage for all containers
+// Calculate total disk usage for all containers: their writable layers,
+// volumes and build cache
 func calculateDiskUsage(ctx context.Context, cli *client.Client) (int64, error) {
 	var totalDisk int64
 
-	// Get list of containers
-	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true})
+	// Get disk usage from system df
+	df, err := cli.DiskUsage(ctx, types.DiskUsageOptions{
+		Types: []types.DiskUsageObject{types.ContainerObject, types.VolumeObject, types.BuildCacheObject},
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to list containers: %w", err)
+		return 0, fmt.Errorf("failed to get system disk usage: %w", err)
 	}
 
-	// Calculate disk usage for each container
-	for _, container := range containers {
-		usage, err := cli.ContainerDiskUsage(ctx, container.ID)
-		if err != nil {
-			return 0, fmt.Errorf("failed to get disk usage for container %s: %w", container.ID, err)
-		}
-		totalDisk += usage.Size
+	// Add containers usage
+	for _, container := range df.Containers {
+		totalDisk += container.SizeRw
 	}
 
-	// Get disk usage from system df
-	df, err := cli.DiskUsage(ctx)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get system disk usage: %w", err)
+	// Add volumes usage; the size is -1 where Docker can't tell it
+	for _, volume := range df.Volumes {
+		if volume.UsageData != nil && volume.UsageData.Size > 0 {
+			totalDisk += volume.UsageData.Size
+		}
 	}
 
-	// Add volumes usage
-	totalDisk += df.VolumesSize
-
 	// Add build cache usage
-	totalDisk += df.BuilderSize
+	for _, cache := range df.BuildCache {
+		totalDisk += cache.Size
+	}
 
 	return totalDisk, nil
 }
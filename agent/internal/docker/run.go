@@ -0,0 +1,208 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+
+	"shh/agent/internal/protocol"
+)
+
+// ContainerSpec declares a container for docker:container:run
+type ContainerSpec struct {
+	Name    string            `json:"name,omitempty"`
+	Image   string            `json:"image"`
+	Command []string          `json:"command,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Ports   []PortSpec        `json:"ports,omitempty"`
+	Mounts  []MountSpec       `json:"mounts,omitempty"`
+	// RestartPolicy is no, always, on-failure or unless-stopped
+	RestartPolicy string            `json:"restart_policy,omitempty"`
+	MaxRetries    int               `json:"max_retries,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+}
+
+// PortSpec publishes a container port on the host
+type PortSpec struct {
+	ContainerPort int `json:"container_port"`
+	HostPort      int `json:"host_port,omitempty"`
+	// HostIP defaults to every address
+	HostIP string `json:"host_ip,omitempty"`
+	// Protocol is tcp or udp, tcp by default
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// MountSpec mounts a host path or a named volume into the container
+type MountSpec struct {
+	// Type is bind or volume, bind by default
+	Type     string `json:"type,omitempty"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// RunResult is the container docker:container:run created
+type RunResult struct {
+	ID       string   `json:"id"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// RunContainer creates and starts a container from a spec, pulling its
+// image first if it isn't present
+func (m *Manager) RunContainer(ctx context.Context, spec ContainerSpec) (*RunResult, error) {
+	config, hostConfig, err := spec.containerConfig()
+	if err != nil {
+		return nil, protocol.Errorf(protocol.ErrorValidation, "invalid container spec: %w", err)
+	}
+
+	if _, _, err := m.client.ImageInspectWithRaw(ctx, spec.Image); err != nil {
+		if !client.IsErrNotFound(err) {
+			return nil, fmt.Errorf("failed to inspect image: %w", err)
+		}
+		if err := m.PullImage(ctx, spec.Image); err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := m.client.ContainerCreate(ctx, config, hostConfig, nil, nil, spec.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container: %w", err)
+	}
+	if err := m.StartContainer(ctx, created.ID); err != nil {
+		return nil, err
+	}
+	return &RunResult{ID: created.ID, Warnings: created.Warnings}, nil
+}
+
+// containerConfig translates the spec to the docker API
+func (s ContainerSpec) containerConfig() (*container.Config, *container.HostConfig, error) {
+	if s.Image == "" {
+		return nil, nil, fmt.Errorf("image required")
+	}
+
+	config := &container.Config{
+		Image:        s.Image,
+		Cmd:          s.Command,
+		Labels:       s.Labels,
+		ExposedPorts: nat.PortSet{},
+	}
+	for key, value := range s.Env {
+		config.Env = append(config.Env, key+"="+value)
+	}
+
+	hostConfig := &container.HostConfig{PortBindings: nat.PortMap{}}
+	switch s.RestartPolicy {
+	case "", "no", "always", "on-failure", "unless-stopped":
+		hostConfig.RestartPolicy = container.RestartPolicy{Name: s.RestartPolicy}
+		if s.RestartPolicy == "on-failure" {
+			hostConfig.RestartPolicy.MaximumRetryCount = s.MaxRetries
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown restart policy: %s", s.RestartPolicy)
+	}
+
+	for _, p := range s.Ports {
+		proto := p.Protocol
+		if proto == "" {
+			proto = "tcp"
+		}
+		if proto != "tcp" && proto != "udp" {
+			return nil, nil, fmt.Errorf("unknown port protocol: %s", p.Protocol)
+		}
+		port, err := nat.NewPort(proto, strconv.Itoa(p.ContainerPort))
+		if err != nil || p.ContainerPort <= 0 {
+			return nil, nil, fmt.Errorf("invalid container port: %d", p.ContainerPort)
+		}
+		config.ExposedPorts[port] = struct{}{}
+		binding := nat.PortBinding{HostIP: p.HostIP}
+		if p.HostPort > 0 {
+			binding.HostPort = strconv.Itoa(p.HostPort)
+		}
+		hostConfig.PortBindings[port] = append(hostConfig.PortBindings[port], binding)
+	}
+
+	for _, m := range s.Mounts {
+		if !filepath.IsAbs(m.Target) {
+			return nil, nil, fmt.Errorf("mount target must be absolute: %s", m.Target)
+		}
+		mountType := mount.TypeBind
+		switch m.Type {
+		case "", "bind":
+		case "volume":
+			mountType = mount.TypeVolume
+		default:
+			return nil, nil, fmt.Errorf("unknown mount type: %s", m.Type)
+		}
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mountType,
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+	return config, hostConfig, nil
+}
+
+// SetMountAllowlist sets the host paths containers run from a spec may
+// bind mount, along with everything below them. Named volumes are always
+// allowed; an empty allowlist refuses every bind mount.
+func (p *Plugin) SetMountAllowlist(paths []string) {
+	allowed := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if path != "" {
+			allowed = append(allowed, filepath.Clean(path))
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mountAllowlist = allowed
+}
+
+// handleRun runs a container from the JSON spec in args[0]
+func (p *Plugin) handleRun(ctx context.Context, args []string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, protocol.Errorf(protocol.ErrorValidation, "container spec required")
+	}
+	var spec ContainerSpec
+	if err := json.Unmarshal([]byte(args[0]), &spec); err != nil {
+		return nil, protocol.Errorf(protocol.ErrorValidation, "invalid container spec: %w", err)
+	}
+	for _, m := range spec.Mounts {
+		if m.Type != "" && m.Type != "bind" {
+			continue
+		}
+		if err := p.allowMount(m.Source); err != nil {
+			return nil, err
+		}
+	}
+	return p.manager.RunContainer(ctx, spec)
+}
+
+// allowMount checks a bind mount source against the allowlist. Symlinks
+// are resolved first, so that a link can't point a mount elsewhere.
+func (p *Plugin) allowMount(source string) error {
+	if !filepath.IsAbs(source) {
+		return protocol.Errorf(protocol.ErrorValidation, "mount source must be absolute: %s", source)
+	}
+	resolved := filepath.Clean(source)
+	if path, err := filepath.EvalSymlinks(resolved); err == nil {
+		resolved = path
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, allowed := range p.mountAllowlist {
+		if resolved == allowed || allowed == "/" || strings.HasPrefix(resolved, allowed+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return protocol.Errorf(protocol.ErrorPermission, "mount source not allowed: %s", source)
+}
@@ -106,6 +106,33 @@ func (s *Scanner) GetContainerLogs(ctx context.Context, containerID string, sinc
 	return logBuilder.String(), nil
 }
 
+// ContainerEnvs returns the environment of running containers, keyed by
+// container name
+func (s *Scanner) ContainerEnvs(ctx context.Context) (map[string][]string, error) {
+	containers, err := s.client.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	envs := make(map[string][]string, len(containers))
+	for _, c := range containers {
+		info, err := s.client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			s.logger.Warn("Failed to inspect container", zap.String("container", c.ID), zap.Error(err))
+			continue
+		}
+		if info.Config == nil {
+			continue
+		}
+		name := strings.TrimPrefix(info.Name, "/")
+		if name == "" {
+			name = c.ID
+		}
+		envs[name] = info.Config.Env
+	}
+	return envs, nil
+}
+
 func (s *Scanner) Close() error {
 	if s.client != nil {
 		return s.client.Close()
@@ -0,0 +1,430 @@
+// Package enroll gives the agent a signed identity. On first start the
+// agent generates a key pair and submits a certificate request with a
+// one-time token; once the server approves it, the signed certificate is
+// stored next to the key and presented on every connection.
+package enroll
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Files of the identity directory
+const (
+	keyFile     = "agent.key"
+	certFile    = "agent.crt"
+	caFile      = "ca.crt"
+	pendingFile = "pending.json"
+)
+
+// Headers proving the identity on connections that don't carry the
+// client certificate, such as through TLS-terminating proxies
+const (
+	HeaderCertificate = "X-Agent-Certificate"
+	HeaderTimestamp   = "X-Agent-Timestamp"
+	HeaderSignature   = "X-Agent-Signature"
+)
+
+// DefaultPollInterval is how often a pending enrollment is polled unless
+// the server says otherwise
+const DefaultPollInterval = 30 * time.Second
+
+// requestTimeout bounds each enrollment request
+const requestTimeout = 30 * time.Second
+
+// ErrNotEnrolled is returned when the agent has no identity and no token
+// to enroll with
+var ErrNotEnrolled = errors.New("agent is not enrolled and has no enrollment token")
+
+// Config configures enrollment
+type Config struct {
+	// URL is the enrollment endpoint; empty derives it from the server URL
+	URL string
+	// Token is the one-time enrollment token
+	Token        string
+	PollInterval time.Duration
+}
+
+// Identity is the agent's key and the certificate the server signed
+type Identity struct {
+	AgentID     string
+	Certificate *x509.Certificate
+	key         ed25519.PrivateKey
+}
+
+// pending is an enrollment request waiting for approval, kept so that a
+// restart polls it instead of enrolling again
+type pending struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// DefaultURL derives the enrollment endpoint from the server's WebSocket
+// URL: ws://host/ws/agent enrolls at http://host/api/agents/enroll
+func DefaultURL(serverURL string) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL: %w", err)
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	u.Path = "/api/agents/enroll"
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// Load reads the identity stored in dir. It returns nil without an error
+// if the agent hasn't enrolled yet.
+func Load(dir string) (*Identity, error) {
+	keyPEM, err := os.ReadFile(filepath.Join(dir, keyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent key: %w", err)
+	}
+	certPEM, err := os.ReadFile(filepath.Join(dir, certFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent certificate: %w", err)
+	}
+
+	key, err := parseKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := matchKey(cert, key); err != nil {
+		return nil, err
+	}
+	if time.Now().After(cert.NotAfter) {
+		return nil, fmt.Errorf("agent certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	return &Identity{AgentID: cert.Subject.CommonName, Certificate: cert, key: key}, nil
+}
+
+// Enroll returns the identity stored in dir, enrolling with the token
+// first if there is none. A pending enrollment is polled until the
+// server approves or rejects it, or ctx is done.
+func Enroll(ctx context.Context, logger *zap.Logger, dir string, config Config, agentID string) (*Identity, error) {
+	if identity, err := Load(dir); err != nil || identity != nil {
+		return identity, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create identity directory: %w", err)
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+
+	key, err := loadOrCreateKey(dir)
+	if err != nil {
+		return nil, err
+	}
+	e := &enrollment{logger: logger, dir: dir, config: config, client: &http.Client{Timeout: requestTimeout}}
+
+	// A request submitted before a restart is polled rather than sent
+	// again, since the token is only good once
+	p, err := e.loadPending()
+	if err != nil {
+		return nil, err
+	}
+	var response *protocol.EnrollmentResponse
+	if p == nil {
+		if config.Token == "" {
+			return nil, ErrNotEnrolled
+		}
+		if response, err = e.submit(ctx, key, agentID); err != nil {
+			return nil, err
+		}
+		p = &pending{ID: response.ID, URL: config.URL}
+		if response.Status == protocol.EnrollmentPending {
+			if err := e.savePending(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for response == nil || response.Status == protocol.EnrollmentPending {
+		if response != nil {
+			wait := config.PollInterval
+			if response.RetryAfter > 0 {
+				wait = time.Duration(response.RetryAfter) * time.Second
+			}
+			logger.Info("Enrollment pending approval", zap.String("request", p.ID), zap.Duration("retry", wait))
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		if response, err = e.poll(ctx, p); err != nil {
+			logger.Warn("Failed to poll enrollment", zap.String("request", p.ID), zap.Error(err))
+			response = &protocol.EnrollmentResponse{Status: protocol.EnrollmentPending}
+		}
+	}
+
+	os.Remove(filepath.Join(dir, pendingFile))
+	if response.Status != protocol.EnrollmentApproved {
+		return nil, fmt.Errorf("enrollment %s: %s", response.Status, response.Reason)
+	}
+	identity, err := e.store(response, key)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Agent enrolled",
+		zap.String("agent_id", identity.AgentID),
+		zap.Time("expires", identity.Certificate.NotAfter))
+	return identity, nil
+}
+
+// TLSConfig presents the certificate as a TLS client certificate
+func (i *Identity) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{i.Certificate.Raw},
+			PrivateKey:  i.key,
+			Leaf:        i.Certificate,
+		}},
+	}
+}
+
+// Header carries the certificate and a signature of the agent ID and the
+// current time, which the server checks against the certificate's key
+func (i *Identity) Header() http.Header {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := ed25519.Sign(i.key, []byte(i.AgentID+"\n"+timestamp))
+	header := http.Header{}
+	header.Set(HeaderCertificate, base64.StdEncoding.EncodeToString(i.Certificate.Raw))
+	header.Set(HeaderTimestamp, timestamp)
+	header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(signature))
+	return header
+}
+
+// enrollment talks to the enrollment endpoint
+type enrollment struct {
+	logger *zap.Logger
+	dir    string
+	config Config
+	client *http.Client
+}
+
+// submit sends the certificate request
+func (e *enrollment) submit(ctx context.Context, key ed25519.PrivateKey, agentID string) (*protocol.EnrollmentResponse, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: agentID},
+		DNSNames: []string{hostname},
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	body, err := json.Marshal(protocol.EnrollmentRequest{
+		Token:    e.config.Token,
+		CSR:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		AgentID:  agentID,
+		Hostname: hostname,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal enrollment request: %w", err)
+	}
+	e.logger.Info("Submitting enrollment request", zap.String("url", e.config.URL))
+	return e.do(ctx, http.MethodPost, e.config.URL, body)
+}
+
+// poll asks for the status of a pending request
+func (e *enrollment) poll(ctx context.Context, p *pending) (*protocol.EnrollmentResponse, error) {
+	return e.do(ctx, http.MethodGet, strings.TrimSuffix(p.URL, "/")+"/"+url.PathEscape(p.ID), nil)
+}
+
+func (e *enrollment) do(ctx context.Context, method, endpoint string, body []byte) (*protocol.EnrollmentResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create enrollment request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach enrollment endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read enrollment response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("enrollment endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var response protocol.EnrollmentResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse enrollment response: %w", err)
+	}
+	if response.Status == protocol.EnrollmentPending && response.ID == "" {
+		return nil, fmt.Errorf("pending enrollment response without a request ID")
+	}
+	return &response, nil
+}
+
+// store checks the signed certificate against the key and the CA and
+// writes them next to the key
+func (e *enrollment) store(response *protocol.EnrollmentResponse, key ed25519.PrivateKey) (*Identity, error) {
+	cert, err := parseCertificate([]byte(response.Certificate))
+	if err != nil {
+		return nil, err
+	}
+	if err := matchKey(cert, key); err != nil {
+		return nil, err
+	}
+	if response.CA != "" {
+		ca, err := parseCertificate([]byte(response.CA))
+		if err != nil {
+			return nil, fmt.Errorf("invalid CA certificate: %w", err)
+		}
+		if err := cert.CheckSignatureFrom(ca); err != nil {
+			return nil, fmt.Errorf("agent certificate not signed by the CA: %w", err)
+		}
+		if err := writeFile(filepath.Join(e.dir, caFile), []byte(response.CA), 0644); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFile(filepath.Join(e.dir, certFile), []byte(response.Certificate), 0644); err != nil {
+		return nil, err
+	}
+	return &Identity{AgentID: cert.Subject.CommonName, Certificate: cert, key: key}, nil
+}
+
+func (e *enrollment) loadPending() (*pending, error) {
+	data, err := os.ReadFile(filepath.Join(e.dir, pendingFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending enrollment: %w", err)
+	}
+	var p pending
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse pending enrollment: %w", err)
+	}
+	return &p, nil
+}
+
+func (e *enrollment) savePending(p *pending) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending enrollment: %w", err)
+	}
+	return writeFile(filepath.Join(e.dir, pendingFile), data, 0600)
+}
+
+// loadOrCreateKey reads the agent key, generating it on first use
+func loadOrCreateKey(dir string) (ed25519.PrivateKey, error) {
+	path := filepath.Join(dir, keyFile)
+	if data, err := os.ReadFile(path); err == nil {
+		return parseKey(data)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read agent key: %w", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate agent key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal agent key: %w", err)
+	}
+	if err := writeFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func parseKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("agent key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse agent key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("agent key is a %T, not ed25519", parsed)
+	}
+	return key, nil
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// matchKey checks that cert certifies key
+func matchKey(cert *x509.Certificate, key ed25519.PrivateKey) error {
+	public, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok || !public.Equal(key.Public()) {
+		return fmt.Errorf("agent certificate doesn't match the agent key")
+	}
+	if cert.Subject.CommonName == "" {
+		return fmt.Errorf("agent certificate has no agent ID")
+	}
+	return nil
+}
+
+// writeFile writes a file atomically
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
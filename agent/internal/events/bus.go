@@ -0,0 +1,372 @@
+// Package events is the agent's in-process event bus. Subsystems publish
+// to topics and any number of consumers subscribe to them, each with its
+// own buffer and overflow policy, so that a slow consumer never holds up
+// a publisher or the other consumers.
+package events
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+)
+
+// Topic groups events of one kind
+type Topic string
+
+// Topics published by the agent's subsystems
+const (
+	TopicDocker      Topic = "docker"
+	TopicConfig      Topic = "config"
+	TopicConnection  Topic = "connection"
+	TopicAlert       Topic = "alert"
+	TopicLog         Topic = "log"
+	TopicSecurity    Topic = "security"
+	TopicUpdate      Topic = "update"
+	TopicPlugin      Topic = "plugin"
+	TopicFIM         Topic = "fim"
+	TopicSSHKeys     Topic = "sshkeys"
+	TopicMaintenance Topic = "maintenance"
+	TopicInventory   Topic = "inventory"
+	TopicTask        Topic = "task"
+	TopicNetwork     Topic = "network"
+	TopicOptimizer   Topic = "optimizer"
+)
+
+// All subscribes to every topic
+const All Topic = "*"
+
+// Overflow is what happens to an event when a subscriber's buffer is full
+type Overflow int
+
+const (
+	// DropNewest discards the event being published
+	DropNewest Overflow = iota
+	// DropOldest discards the oldest buffered event to make room
+	DropOldest
+	// Block waits up to the subscriber's timeout for room, then drops the
+	// event. It holds up the publisher, so it suits consumers that must
+	// not miss events, such as an audit trail.
+	Block
+)
+
+const (
+	defaultBuffer       = 100
+	defaultBlockTimeout = time.Second
+	// publisherBuffer is the buffer of the channels handed to publishers
+	publisherBuffer = 100
+)
+
+// Event is a published event
+type Event struct {
+	Topic     Topic
+	Payload   interface{}
+	Timestamp time.Time
+}
+
+// Options configure a subscription
+type Options struct {
+	Buffer   int
+	Overflow Overflow
+	// Timeout bounds how long Block waits for room
+	Timeout time.Duration
+}
+
+// Subscription receives the events of its topics
+type Subscription struct {
+	bus     *Bus
+	name    string
+	topics  map[Topic]bool
+	opts    Options
+	ch      chan Event
+	mu      sync.Mutex
+	closed  bool
+	dropped atomic.Uint64
+}
+
+// C returns the events. It is closed on Unsubscribe and when the bus shuts
+// down.
+func (s *Subscription) C() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns how many events overflowed the subscription
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Len returns how many events wait to be received
+func (s *Subscription) Len() int {
+	return len(s.ch)
+}
+
+// Unsubscribe stops delivery and closes C
+func (s *Subscription) Unsubscribe() {
+	s.bus.remove(s)
+	s.close()
+}
+
+func (s *Subscription) wants(topic Topic) bool {
+	return s.topics[All] || s.topics[topic]
+}
+
+// deliver hands an event to the subscriber according to its overflow
+// policy, reporting whether it was delivered
+func (s *Subscription) deliver(event Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+
+	select {
+	case s.ch <- event:
+		return true
+	default:
+	}
+
+	switch s.opts.Overflow {
+	case DropOldest:
+		select {
+		case <-s.ch:
+		default:
+		}
+		select {
+		case s.ch <- event:
+		default:
+			return false
+		}
+		// The oldest event was dropped instead
+		s.dropped.Add(1)
+		return true
+	case Block:
+		timer := time.NewTimer(s.opts.Timeout)
+		defer timer.Stop()
+		select {
+		case s.ch <- event:
+			return true
+		case <-timer.C:
+		}
+	}
+	s.dropped.Add(1)
+	return false
+}
+
+func (s *Subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// TopicStats counts the events of a topic
+type TopicStats struct {
+	Published uint64 `json:"published"`
+	Dropped   uint64 `json:"dropped"`
+}
+
+// Bus delivers published events to the subscribers of their topic
+type Bus struct {
+	logger      *zap.Logger
+	mu          sync.RWMutex
+	subscribers []*Subscription
+	publishers  map[Topic]chan interface{}
+	stats       map[Topic]*TopicStats
+	started     bool
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewBus creates an event bus
+func NewBus(logger *zap.Logger) *Bus {
+	return &Bus{
+		logger:     logger,
+		publishers: make(map[Topic]chan interface{}),
+		stats:      make(map[Topic]*TopicStats),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Subscribe delivers the events of topics, or of every topic with All, to
+// a new subscription. name identifies the subscriber in logs.
+func (b *Bus) Subscribe(name string, opts Options, topics ...Topic) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultBuffer
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultBlockTimeout
+	}
+	sub := &Subscription{
+		bus:    b,
+		name:   name,
+		topics: make(map[Topic]bool, len(topics)),
+		opts:   opts,
+		ch:     make(chan Event, opts.Buffer),
+	}
+	for _, t := range topics {
+		sub.topics[t] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, sub)
+	return sub
+}
+
+// On calls handle with the payload of every event on topic of type T,
+// until the bus shuts down. Events of other types are skipped.
+func On[T any](b *Bus, name string, opts Options, topic Topic, handle func(T)) *Subscription {
+	sub := b.Subscribe(name, opts, topic)
+	crash.Go("events-"+name, func() {
+		for event := range sub.C() {
+			if payload, ok := event.Payload.(T); ok {
+				handle(payload)
+			}
+		}
+	})
+	return sub
+}
+
+// Publish sends payload to the subscribers of topic
+func (b *Bus) Publish(topic Topic, payload interface{}) {
+	event := Event{Topic: topic, Payload: payload, Timestamp: time.Now()}
+
+	b.mu.Lock()
+	stats, ok := b.stats[topic]
+	if !ok {
+		stats = &TopicStats{}
+		b.stats[topic] = stats
+	}
+	stats.Published++
+	subscribers := append([]*Subscription(nil), b.subscribers...)
+	b.mu.Unlock()
+
+	var dropped uint64
+	for _, sub := range subscribers {
+		if !sub.wants(topic) {
+			continue
+		}
+		if !sub.deliver(event) {
+			dropped++
+			b.logger.Warn("Failed to deliver event: subscriber full",
+				zap.String("topic", string(topic)),
+				zap.String("subscriber", sub.name))
+		}
+	}
+	if dropped > 0 {
+		b.mu.Lock()
+		stats.Dropped += dropped
+		b.mu.Unlock()
+	}
+}
+
+// Publisher returns a channel whose values are published to topic, for
+// subsystems that report events on a channel. Sends should not block: the
+// channel is drained while the bus runs, and a full channel means the bus
+// has stopped.
+func (b *Bus) Publisher(topic Topic) chan<- interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch, ok := b.publishers[topic]; ok {
+		return ch
+	}
+	ch := make(chan interface{}, publisherBuffer)
+	b.publishers[topic] = ch
+	if b.started {
+		b.drain(topic, ch)
+	}
+	return ch
+}
+
+// Stats returns the event counts by topic
+func (b *Bus) Stats() map[Topic]TopicStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	stats := make(map[Topic]TopicStats, len(b.stats))
+	for topic, s := range b.stats {
+		stats[topic] = *s
+	}
+	return stats
+}
+
+// Dropped returns how many deliveries failed across all topics
+func (b *Bus) Dropped() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var dropped uint64
+	for _, s := range b.stats {
+		dropped += s.Dropped
+	}
+	return dropped
+}
+
+// Start publishes what is sent to the publisher channels. Events sent
+// before Start are buffered.
+func (b *Bus) Start(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.started = true
+	for topic, ch := range b.publishers {
+		b.drain(topic, ch)
+	}
+	return nil
+}
+
+// Shutdown stops publishing and closes every subscription. The publisher
+// channels are left open, so late sends from subsystems still stopping
+// don't panic.
+func (b *Bus) Shutdown(ctx context.Context) error {
+	close(b.stop)
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	b.mu.Lock()
+	subscribers := b.subscribers
+	b.subscribers = nil
+	b.mu.Unlock()
+	for _, sub := range subscribers {
+		sub.close()
+	}
+	return nil
+}
+
+// drain publishes the values sent on ch. The caller holds mu.
+func (b *Bus) drain(topic Topic, ch chan interface{}) {
+	b.wg.Add(1)
+	crash.Go("events-"+string(topic), func() {
+		defer b.wg.Done()
+		for {
+			select {
+			case <-b.stop:
+				return
+			case payload := <-ch:
+				b.Publish(topic, payload)
+			}
+		}
+	})
+}
+
+func (b *Bus) remove(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, s := range b.subscribers {
+		if s == sub {
+			b.subscribers = append(b.subscribers[:i], b.subscribers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,637 @@
+// Package fim monitors files for tampering by comparing them against a
+// baseline of their checksums, permissions and owners
+package fim
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Changes
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// watchDelay batches bursts of file events before verifying
+const watchDelay = 2 * time.Second
+
+// Config configures the monitor
+type Config struct {
+	// Paths are files and directories to monitor; directories recursively
+	Paths []string `json:"paths"`
+	// Exclude skips files whose base name matches one of these globs
+	Exclude []string `json:"exclude,omitempty"`
+	// Interval between full verifications
+	Interval time.Duration `json:"interval"`
+	// Watch verifies changed files right away using inotify
+	Watch bool `json:"watch"`
+	// BaselineFile stores the baseline between runs
+	BaselineFile string `json:"baseline_file"`
+	// MaxFileSize skips checksums of larger files, which are then
+	// compared by size and modification time only
+	MaxFileSize int64 `json:"max_file_size"`
+}
+
+// DefaultConfig watches nothing until paths are configured
+var DefaultConfig = Config{
+	Interval:     time.Hour,
+	Watch:        true,
+	BaselineFile: "/var/lib/agent/fim/baseline.json",
+	MaxFileSize:  64 * 1024 * 1024,
+}
+
+// baseline is the known-good state of the monitored files
+type baseline struct {
+	CreatedAt time.Time                     `json:"created_at"`
+	UpdatedAt time.Time                     `json:"updated_at"`
+	Paths     []string                      `json:"paths"`
+	Files     map[string]protocol.FileState `json:"files"`
+}
+
+// Monitor verifies files against their baseline and reports tampering
+type Monitor struct {
+	logger   *zap.Logger
+	config   Config
+	events   chan<- interface{}
+	baseline *baseline
+	// drift holds the unresolved changes by path
+	drift    map[string]protocol.FIMEvent
+	mu       sync.Mutex
+	verifyMu sync.Mutex
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewMonitor creates a file integrity monitor. Tamper events are sent to
+// events as protocol.FIMEvent values.
+func NewMonitor(logger *zap.Logger, config Config, events chan<- interface{}) *Monitor {
+	if config.Interval <= 0 {
+		config.Interval = DefaultConfig.Interval
+	}
+	if config.BaselineFile == "" {
+		config.BaselineFile = DefaultConfig.BaselineFile
+	}
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = DefaultConfig.MaxFileSize
+	}
+	for i, p := range config.Paths {
+		config.Paths[i] = filepath.Clean(p)
+	}
+	return &Monitor{
+		logger: logger,
+		config: config,
+		events: events,
+		drift:  make(map[string]protocol.FIMEvent),
+	}
+}
+
+// Start loads the baseline, creating it on first run or when the
+// monitored paths changed, and verifies files in the background
+func (m *Monitor) Start(ctx context.Context) error {
+	if len(m.config.Paths) == 0 {
+		return nil
+	}
+
+	b, err := loadBaseline(m.config.BaselineFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if b == nil || !samePaths(b.Paths, m.config.Paths) {
+		if _, err := m.Baseline(); err != nil {
+			return err
+		}
+	} else {
+		m.mu.Lock()
+		m.baseline = b
+		m.mu.Unlock()
+		m.Verify()
+	}
+
+	var watcher *fsnotify.Watcher
+	if m.config.Watch {
+		if watcher, err = fsnotify.NewWatcher(); err != nil {
+			m.logger.Warn("File watching unavailable, verifying periodically only", zap.Error(err))
+		} else {
+			m.watch(watcher)
+		}
+	}
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	go m.run(ctx, watcher)
+	return nil
+}
+
+// Shutdown stops the monitor
+func (m *Monitor) Shutdown(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Monitor) run(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer close(m.done)
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	var watchEvents <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if watcher != nil {
+		defer watcher.Close()
+		watchEvents, watchErrors = watcher.Events, watcher.Errors
+	}
+
+	pending := make(map[string]bool)
+	flush := time.NewTimer(watchDelay)
+	flush.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Verify()
+		case event, ok := <-watchEvents:
+			if !ok {
+				watchEvents = nil
+				continue
+			}
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Lstat(event.Name); err == nil && info.IsDir() && m.inScope(event.Name) {
+					m.addWatches(watcher, event.Name)
+				}
+			}
+			if m.inScope(event.Name) {
+				if len(pending) == 0 {
+					flush.Reset(watchDelay)
+				}
+				pending[event.Name] = true
+			}
+		case err, ok := <-watchErrors:
+			if !ok {
+				watchErrors = nil
+				continue
+			}
+			m.logger.Warn("File watcher error", zap.Error(err))
+		case <-flush.C:
+			paths := make([]string, 0, len(pending))
+			for p := range pending {
+				paths = append(paths, p)
+			}
+			pending = make(map[string]bool)
+			m.verifyPaths(paths)
+		}
+	}
+}
+
+// watch adds the monitored directories, and the parents of monitored
+// files so replaced files are noticed, to the watcher
+func (m *Monitor) watch(watcher *fsnotify.Watcher) {
+	for _, p := range m.config.Paths {
+		info, err := os.Lstat(p)
+		switch {
+		case err != nil:
+			watcher.Add(filepath.Dir(p))
+		case info.IsDir():
+			m.addWatches(watcher, p)
+		default:
+			if err := watcher.Add(filepath.Dir(p)); err != nil {
+				m.logger.Warn("Failed to watch", zap.String("path", p), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (m *Monitor) addWatches(watcher *fsnotify.Watcher, root string) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if err := watcher.Add(path); err != nil {
+			m.logger.Warn("Failed to watch", zap.String("path", path), zap.Error(err))
+		}
+		return nil
+	})
+}
+
+// Baseline records the current state of the monitored files as known
+// good and clears all drift. It returns the number of files recorded.
+func (m *Monitor) Baseline() (int, error) {
+	m.verifyMu.Lock()
+	defer m.verifyMu.Unlock()
+
+	files := m.scan()
+	now := time.Now()
+	b := &baseline{
+		CreatedAt: now,
+		UpdatedAt: now,
+		Paths:     append([]string(nil), m.config.Paths...),
+		Files:     files,
+	}
+	if err := saveBaseline(m.config.BaselineFile, b); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	m.baseline = b
+	m.drift = make(map[string]protocol.FIMEvent)
+	m.mu.Unlock()
+
+	m.logger.Info("File integrity baseline recorded", zap.Int("files", len(files)))
+	return len(files), nil
+}
+
+// Accept makes the current state of a file its baseline, resolving its
+// drift
+func (m *Monitor) Accept(path string) error {
+	m.verifyMu.Lock()
+	defer m.verifyMu.Unlock()
+
+	path = filepath.Clean(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.baseline == nil {
+		return fmt.Errorf("no baseline recorded")
+	}
+	if _, ok := m.drift[path]; !ok {
+		return fmt.Errorf("no drift for %s", path)
+	}
+
+	state, err := m.fileState(path)
+	switch {
+	case os.IsNotExist(err):
+		delete(m.baseline.Files, path)
+	case err != nil:
+		return err
+	default:
+		m.baseline.Files[path] = *state
+	}
+	m.baseline.UpdatedAt = time.Now()
+	if err := saveBaseline(m.config.BaselineFile, m.baseline); err != nil {
+		return err
+	}
+	delete(m.drift, path)
+
+	m.logger.Info("File change accepted into baseline", zap.String("path", path))
+	return nil
+}
+
+// Drift returns the files that differ from the baseline
+func (m *Monitor) Drift() []protocol.FIMEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	drift := make([]protocol.FIMEvent, 0, len(m.drift))
+	for _, e := range m.drift {
+		drift = append(drift, e)
+	}
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Path < drift[j].Path })
+	return drift
+}
+
+// Verify compares every monitored file with the baseline and returns the
+// drift. Each change is reported once until it changes again.
+func (m *Monitor) Verify() []protocol.FIMEvent {
+	m.verifyMu.Lock()
+	defer m.verifyMu.Unlock()
+
+	m.mu.Lock()
+	if m.baseline == nil {
+		m.mu.Unlock()
+		return nil
+	}
+	paths := make(map[string]bool, len(m.baseline.Files))
+	for p := range m.baseline.Files {
+		paths[p] = true
+	}
+	m.mu.Unlock()
+
+	current := m.scan()
+	for p := range current {
+		paths[p] = true
+	}
+	for p := range paths {
+		var state *protocol.FileState
+		if s, ok := current[p]; ok {
+			state = &s
+		}
+		m.check(p, state)
+	}
+	return m.Drift()
+}
+
+// verifyPaths checks single files reported by the watcher
+func (m *Monitor) verifyPaths(paths []string) {
+	m.verifyMu.Lock()
+	defer m.verifyMu.Unlock()
+
+	for _, p := range paths {
+		state, err := m.fileState(p)
+		if err != nil && !os.IsNotExist(err) {
+			m.logger.Warn("Failed to verify file", zap.String("path", p), zap.Error(err))
+			continue
+		}
+		if state != nil && os.FileMode(state.Mode).IsDir() {
+			continue
+		}
+		m.check(p, state)
+	}
+}
+
+// check compares one file's current state, nil if it is gone, with the
+// baseline and records and reports drift
+func (m *Monitor) check(path string, current *protocol.FileState) {
+	m.mu.Lock()
+	var before *protocol.FileState
+	if s, ok := m.baseline.Files[path]; ok {
+		before = &s
+	}
+	event := protocol.FIMEvent{
+		Path:      path,
+		Before:    before,
+		After:     current,
+		Timestamp: time.Now(),
+	}
+	switch {
+	case before == nil && current == nil:
+		delete(m.drift, path)
+		m.mu.Unlock()
+		return
+	case before == nil:
+		event.Change = ChangeAdded
+	case current == nil:
+		event.Change = ChangeRemoved
+	default:
+		event.Fields = changedFields(before, current)
+		if len(event.Fields) == 0 {
+			if _, ok := m.drift[path]; ok {
+				delete(m.drift, path)
+				m.logger.Info("File restored to baseline", zap.String("path", path))
+			}
+			m.mu.Unlock()
+			return
+		}
+		event.Change = ChangeModified
+	}
+
+	if prev, ok := m.drift[path]; ok && sameState(prev.After, current) {
+		m.mu.Unlock()
+		return
+	}
+	m.drift[path] = event
+	m.mu.Unlock()
+
+	m.logger.Warn("File integrity violation",
+		zap.String("path", path),
+		zap.String("change", event.Change),
+		zap.Strings("fields", event.Fields))
+	m.emit(event)
+}
+
+// scan returns the state of every monitored file
+func (m *Monitor) scan() map[string]protocol.FileState {
+	files := make(map[string]protocol.FileState)
+	for _, root := range m.config.Paths {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if !os.IsNotExist(err) {
+					m.logger.Warn("Failed to scan", zap.String("path", path), zap.Error(err))
+				}
+				return nil
+			}
+			if info.IsDir() {
+				if path != root && m.excluded(path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if m.excluded(path) {
+				return nil
+			}
+			state, err := m.stateOf(path, info)
+			if err != nil {
+				m.logger.Warn("Failed to read file", zap.String("path", path), zap.Error(err))
+				return nil
+			}
+			files[path] = *state
+			return nil
+		})
+	}
+	return files
+}
+
+func (m *Monitor) fileState(path string) (*protocol.FileState, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	return m.stateOf(path, info)
+}
+
+// stateOf records a file's metadata and, below the size limit, its
+// checksum. Symlinks are recorded by their target, not followed.
+func (m *Monitor) stateOf(path string, info os.FileInfo) (*protocol.FileState, error) {
+	uid, gid := fileOwner(info)
+	state := &protocol.FileState{
+		Size:    info.Size(),
+		Mode:    uint32(info.Mode()),
+		UID:     uid,
+		GID:     gid,
+		ModTime: info.ModTime(),
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		state.Target = target
+	case info.Mode().IsRegular() && info.Size() <= m.config.MaxFileSize:
+		sum, err := checksum(path)
+		if err != nil {
+			return nil, err
+		}
+		state.SHA256 = sum
+	}
+	return state, nil
+}
+
+// inScope reports whether path is monitored
+func (m *Monitor) inScope(path string) bool {
+	for _, p := range m.config.Paths {
+		if path == p || strings.HasPrefix(path, p+string(filepath.Separator)) {
+			return !m.excluded(path)
+		}
+	}
+	return false
+}
+
+func (m *Monitor) excluded(path string) bool {
+	base := filepath.Base(path)
+	for _, pattern := range m.config.Exclude {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Monitor) emit(event protocol.FIMEvent) {
+	if m.events == nil {
+		return
+	}
+	select {
+	case m.events <- event:
+	default:
+		m.logger.Warn("Failed to send FIM event: channel full")
+	}
+}
+
+// HandleCommand processes file integrity commands
+func (m *Monitor) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "fim:status":
+		return m.Drift(), nil
+	case "fim:verify":
+		return m.Verify(), nil
+	case "fim:baseline":
+		files, err := m.Baseline()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]int{"files": files}, nil
+	case "fim:accept":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "path required")
+		}
+		for _, path := range args {
+			if err := m.Accept(path); err != nil {
+				return nil, err
+			}
+		}
+		return m.Drift(), nil
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown fim command: %s", cmd)
+	}
+}
+
+// changedFields lists what differs between two states of a file. Files
+// too large to checksum are compared by size and modification time.
+func changedFields(before, after *protocol.FileState) []string {
+	var fields []string
+	switch {
+	case before.SHA256 != "" && after.SHA256 != "":
+		if before.SHA256 != after.SHA256 {
+			fields = append(fields, "content")
+		}
+	case before.Size != after.Size || !before.ModTime.Equal(after.ModTime):
+		fields = append(fields, "content")
+	}
+	if before.Mode != after.Mode {
+		fields = append(fields, "mode")
+	}
+	if before.UID != after.UID || before.GID != after.GID {
+		fields = append(fields, "owner")
+	}
+	if before.Target != after.Target {
+		fields = append(fields, "target")
+	}
+	return fields
+}
+
+func sameState(a, b *protocol.FileState) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.SHA256 == b.SHA256 && a.Size == b.Size && a.Mode == b.Mode &&
+		a.UID == b.UID && a.GID == b.GID && a.Target == b.Target && a.ModTime.Equal(b.ModTime)
+}
+
+func samePaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func checksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func loadBaseline(path string) (*baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline: %w", err)
+	}
+	if b.Files == nil {
+		b.Files = make(map[string]protocol.FileState)
+	}
+	return &b, nil
+}
+
+// saveBaseline writes the baseline atomically, readable by root only
+func saveBaseline(path string, b *baseline) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create baseline directory: %w", err)
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("failed to marshal baseline: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package fim
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the uid and gid owning a file
+func fileOwner(info os.FileInfo) (int, int) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return int(stat.Uid), int(stat.Gid)
+}
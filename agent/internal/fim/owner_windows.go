@@ -0,0 +1,8 @@
+package fim
+
+import "os"
+
+// fileOwner is unsupported on Windows, where ownership is not tracked
+func fileOwner(info os.FileInfo) (int, int) {
+	return 0, 0
+}
@@ -61,9 +61,15 @@ type Checker struct {
 	lastCheck   time.Time
 	logger      *zap.Logger
 	historySize int
+	maintenance MaintenanceChecker
 	mu          sync.RWMutex
 }
 
+// MaintenanceChecker reports whether a component is in planned maintenance
+type MaintenanceChecker interface {
+	Active(component string) bool
+}
+
 // NewChecker creates a new health checker
 func NewChecker(logger *zap.Logger) *Checker {
 	return &Checker{
@@ -185,10 +191,14 @@ func (c *Checker) updateStatus() {
 	defer c.mu.Unlock()
 
 	status := StatusHealthy
-	for _, check := range c.checks {
+	for name, check := range c.checks {
 		if check.LastResult == nil {
 			continue
 		}
+		// Failures during planned maintenance don't degrade the agent
+		if c.maintenance != nil && c.maintenance.Active(name) {
+			continue
+		}
 
 		if check.Required && check.LastResult.Status == StatusUnhealthy {
 			status = StatusUnhealthy
@@ -204,6 +214,16 @@ func (c *Checker) updateStatus() {
 	c.lastCheck = time.Now()
 }
 
+// SetMaintenance makes checks in maintenance, by check name, stop counting
+// towards the overall status
+func (c *Checker) SetMaintenance(maintenance MaintenanceChecker) {
+	c.mu.Lock()
+	c.maintenance = maintenance
+	c.mu.Unlock()
+
+	c.updateStatus()
+}
+
 // GetStatus returns the current health status
 func (c *Checker) GetStatus() Status {
 	c.mu.RLock()
@@ -211,6 +231,14 @@ func (c *Checker) GetStatus() Status {
 	return c.status
 }
 
+// LastCheck returns when a check last completed, or the zero time before
+// the first one
+func (c *Checker) LastCheck() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastCheck
+}
+
 // GetCheckResults returns all check results
 func (c *Checker) GetCheckResults() map[string]*CheckResult {
 	c.mu.RLock()
@@ -0,0 +1,274 @@
+// Package heartbeat sends the agent's periodic heartbeat to the server
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/metrics"
+	"shh/agent/internal/process"
+	"shh/agent/internal/protocol"
+)
+
+// StatusStaleMetrics replaces the health status while the snapshots in
+// the heartbeat are older than the stale limit
+const StatusStaleMetrics = "stale-metrics"
+
+const (
+	// DefaultInterval is how often heartbeats are sent
+	DefaultInterval = 15 * time.Second
+	// staleIntervals is how many heartbeat intervals a snapshot may age
+	// before it is reported stale
+	staleIntervals = 3
+)
+
+// Client sends heartbeats
+type Client interface {
+	SendMessage(msg protocol.Message) error
+	CompressionStats() protocol.CompressionStats
+}
+
+// MetricsSource provides the latest system metrics
+type MetricsSource interface {
+	GetMetrics() *metrics.SystemMetrics
+}
+
+// ProcessSource lists running processes
+type ProcessSource interface {
+	GetProcesses() ([]process.ProcessInfo, error)
+}
+
+// StatusSource provides the agent's health status
+type StatusSource func() string
+
+// snapshot is the last data gathered from the sources
+type snapshot struct {
+	metrics     *metrics.SystemMetrics
+	processes   int
+	processesAt time.Time
+}
+
+// Sender sends heartbeats on a fixed schedule. Metrics and processes are
+// gathered into a cached snapshot off the send path, so a source that
+// hangs delays neither heartbeats nor the next refresh; a heartbeat built
+// from a snapshot gone stale reports StatusStaleMetrics instead.
+type Sender struct {
+	logger    *zap.Logger
+	client    Client
+	metrics   MetricsSource
+	processes ProcessSource
+	status    StatusSource
+	self      func() protocol.SelfMetrics
+	interval  time.Duration
+	failures  atomic.Uint64
+
+	mu       sync.RWMutex
+	snapshot snapshot
+	started  time.Time
+	stale    bool
+
+	refreshingMetrics   atomic.Bool
+	refreshingProcesses atomic.Bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSender creates a heartbeat sender
+func NewSender(logger *zap.Logger, client Client, metrics MetricsSource, processes ProcessSource, status StatusSource) *Sender {
+	return &Sender{
+		logger:    logger,
+		client:    client,
+		metrics:   metrics,
+		processes: processes,
+		status:    status,
+		interval:  DefaultInterval,
+	}
+}
+
+// SetSelfMetrics includes the metrics of the agent itself in heartbeats
+func (s *Sender) SetSelfMetrics(self func() protocol.SelfMetrics) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.self = self
+}
+
+// Failures returns how many heartbeats failed to send
+func (s *Sender) Failures() uint64 {
+	return s.failures.Load()
+}
+
+// Start sends heartbeats until Shutdown
+func (s *Sender) Start(ctx context.Context) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	s.mu.Lock()
+	s.started = time.Now()
+	s.mu.Unlock()
+	s.refresh()
+
+	crash.Go("heartbeat", func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.refresh()
+				s.send()
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown stops sending heartbeats. A refresh stuck in a source is left
+// behind.
+func (s *Sender) Shutdown(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refresh updates the snapshot in the background. Each source is read
+// by at most one goroutine, so a hung source is skipped until it returns.
+func (s *Sender) refresh() {
+	s.gather(&s.refreshingMetrics, "metrics", func() {
+		m := s.metrics.GetMetrics()
+		s.mu.Lock()
+		s.snapshot.metrics = m
+		s.mu.Unlock()
+	})
+	s.gather(&s.refreshingProcesses, "processes", func() {
+		processes, err := s.processes.GetProcesses()
+		if err != nil {
+			s.logger.Warn("Failed to list processes for heartbeat", zap.Error(err))
+			return
+		}
+		s.mu.Lock()
+		s.snapshot.processes = len(processes)
+		s.snapshot.processesAt = time.Now()
+		s.mu.Unlock()
+	})
+}
+
+func (s *Sender) gather(running *atomic.Bool, source string, read func()) {
+	if !running.CompareAndSwap(false, true) {
+		s.logger.Warn("Heartbeat source still busy, skipping refresh", zap.String("source", source))
+		return
+	}
+	crash.Go("heartbeat-"+source, func() {
+		defer running.Store(false)
+		read()
+	})
+}
+
+// staleSources returns the stale sources. The caller holds mu.
+func (s *Sender) staleSources(now time.Time) []string {
+	limit := staleIntervals * s.interval
+	age := func(t time.Time) time.Duration {
+		if t.Before(s.started) {
+			t = s.started
+		}
+		return now.Sub(t)
+	}
+
+	var stale []string
+	var metricsAt time.Time
+	if s.snapshot.metrics != nil {
+		metricsAt = s.snapshot.metrics.Timestamp
+	}
+	if age(metricsAt) > limit {
+		stale = append(stale, "metrics")
+	}
+	if age(s.snapshot.processesAt) > limit {
+		stale = append(stale, "processes")
+	}
+	return stale
+}
+
+// send sends a heartbeat built from the snapshot
+func (s *Sender) send() {
+	s.mu.Lock()
+	snap := s.snapshot
+	stale := s.staleSources(time.Now())
+	changed := s.stale != (len(stale) > 0)
+	s.stale = len(stale) > 0
+	s.mu.Unlock()
+
+	if changed {
+		if len(stale) > 0 {
+			s.logger.Warn("Heartbeat metrics are stale", zap.Strings("sources", stale))
+		} else {
+			s.logger.Info("Heartbeat metrics are current again")
+		}
+	}
+
+	heartbeat := s.build(snap, stale)
+	payload, err := json.Marshal(heartbeat)
+	if err != nil {
+		s.failures.Add(1)
+		s.logger.Error("Failed to marshal heartbeat", zap.Error(err))
+		return
+	}
+	if err := s.client.SendMessage(protocol.Message{
+		Type:      protocol.TypeHeartbeat,
+		ID:        fmt.Sprintf("heartbeat-%d", time.Now().Unix()),
+		Timestamp: time.Now(),
+		Payload:   payload,
+	}); err != nil {
+		s.failures.Add(1)
+		s.logger.Error("Failed to send heartbeat", zap.Error(err))
+	}
+}
+
+func (s *Sender) build(snap snapshot, stale []string) protocol.AgentHeartbeat {
+	compression := s.client.CompressionStats()
+	heartbeat := protocol.AgentHeartbeat{
+		Status:    s.status(),
+		Processes: snap.processes,
+		Stale:     stale,
+		Metrics: protocol.AgentMetrics{
+			Compression: &compression,
+		},
+	}
+	if len(stale) > 0 {
+		heartbeat.Status = StatusStaleMetrics
+	}
+	s.mu.RLock()
+	self := s.self
+	s.mu.RUnlock()
+	if self != nil {
+		m := self()
+		heartbeat.Self = &m
+	}
+	if m := snap.metrics; m != nil {
+		heartbeat.Uptime = m.UptimeSeconds
+		heartbeat.LoadAvg = m.LoadAverage
+		heartbeat.Metrics.CPU = m.CPUUsage
+		if m.MemoryTotal > 0 {
+			heartbeat.Metrics.Memory = float64(m.MemoryUsed) / float64(m.MemoryTotal)
+		}
+		if m.DiskTotal > 0 {
+			heartbeat.Metrics.Disk = float64(m.DiskUsed) / float64(m.DiskTotal)
+		}
+	}
+	return heartbeat
+}
@@ -0,0 +1,170 @@
+// Package idempotency remembers the replies to recently executed commands
+// by idempotency key, so that a command the server resends after a
+// reconnect is answered from memory instead of running again
+package idempotency
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/store"
+)
+
+const (
+	// DefaultTTL is how long replies are remembered
+	DefaultTTL = time.Hour
+	// DefaultMaxEntries bounds the replies remembered; the oldest are
+	// forgotten first
+	DefaultMaxEntries = 1000
+)
+
+// Reply is the message a command was answered with
+type Reply struct {
+	Key      string               `json:"key"`
+	Type     protocol.MessageType `json:"type"`
+	Payload  json.RawMessage      `json:"payload"`
+	Executed time.Time            `json:"executed"`
+}
+
+// Cache holds the replies by key, persisted in records when set
+type Cache struct {
+	logger  *zap.Logger
+	ttl     time.Duration
+	max     int
+	mu      sync.Mutex
+	replies map[string]Reply
+	// running are closed when the command of their key completes
+	running map[string]chan struct{}
+	records *store.Bucket[Reply]
+}
+
+// NewCache creates a cache remembering up to max replies for ttl. Zero
+// values take the defaults.
+func NewCache(logger *zap.Logger, ttl time.Duration, max int) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if max <= 0 {
+		max = DefaultMaxEntries
+	}
+	return &Cache{
+		logger:  logger,
+		ttl:     ttl,
+		max:     max,
+		replies: make(map[string]Reply),
+		running: make(map[string]chan struct{}),
+	}
+}
+
+// SetStore keeps the replies in s and restores the ones still fresh, so
+// that commands executed before a restart aren't run again
+func (c *Cache) SetStore(s *store.Store) error {
+	records := store.NewBucket[Reply](s, store.BucketCommands)
+	saved, err := records.All()
+	if err != nil {
+		return fmt.Errorf("failed to load executed commands: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = records
+	for key, reply := range saved {
+		if _, ok := c.replies[key]; !ok {
+			c.replies[key] = reply
+		}
+	}
+	c.prune(time.Now())
+	c.logger.Info("Executed commands restored", zap.Int("commands", len(c.replies)))
+	return nil
+}
+
+// Do returns the reply to the command of key, running execute only if
+// the key wasn't seen within the TTL. A call for a key whose command is
+// still running waits for it. cached is set when the reply is
+// remembered; replies are not remembered when execute fails.
+func (c *Cache) Do(key string, execute func() (Reply, error)) (reply Reply, cached bool, err error) {
+	for {
+		c.mu.Lock()
+		if reply, ok := c.replies[key]; ok && time.Since(reply.Executed) < c.ttl {
+			c.mu.Unlock()
+			return reply, true, nil
+		}
+		running, ok := c.running[key]
+		if !ok {
+			done := make(chan struct{})
+			c.running[key] = done
+			c.mu.Unlock()
+			defer func() {
+				c.mu.Lock()
+				delete(c.running, key)
+				c.mu.Unlock()
+				close(done)
+			}()
+			break
+		}
+		c.mu.Unlock()
+		<-running
+	}
+
+	reply, err = execute()
+	if err != nil {
+		return reply, false, err
+	}
+	reply.Key = key
+	reply.Executed = time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replies[key] = reply
+	if c.records != nil {
+		if err := c.records.Put(key, reply); err != nil {
+			c.logger.Warn("Failed to persist command result", zap.String("key", key), zap.Error(err))
+		}
+	}
+	c.prune(reply.Executed)
+	return reply, false, nil
+}
+
+// Len returns how many replies are remembered
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.replies)
+}
+
+// prune forgets the expired replies and the oldest beyond max. The
+// caller holds mu.
+func (c *Cache) prune(now time.Time) {
+	var expired []string
+	fresh := make([]Reply, 0, len(c.replies))
+	for key, reply := range c.replies {
+		if now.Sub(reply.Executed) >= c.ttl {
+			expired = append(expired, key)
+		} else {
+			fresh = append(fresh, reply)
+		}
+	}
+	if len(fresh) > c.max {
+		sort.Slice(fresh, func(i, j int) bool {
+			return fresh[i].Executed.Before(fresh[j].Executed)
+		})
+		for _, reply := range fresh[:len(fresh)-c.max] {
+			expired = append(expired, reply.Key)
+		}
+	}
+	for _, key := range expired {
+		delete(c.replies, key)
+		if c.records == nil {
+			continue
+		}
+		if err := c.records.Delete(key); err != nil {
+			c.logger.Warn("Failed to delete command result", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
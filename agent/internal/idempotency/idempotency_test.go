@@ -0,0 +1,166 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/store"
+)
+
+func TestCacheDo(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		max  int
+		// keys are run in order; a key ending in "!" fails
+		keys []string
+		// runs is how often each key's command ran
+		runs map[string]int
+		// remembered is how many replies are left
+		remembered int
+	}{
+		{"first run", time.Hour, 10, []string{"a"}, map[string]int{"a": 1}, 1},
+		{"replayed", time.Hour, 10, []string{"a", "a", "a"}, map[string]int{"a": 1}, 1},
+		{"other keys run", time.Hour, 10, []string{"a", "b", "a"}, map[string]int{"a": 1, "b": 1}, 2},
+		{"failures aren't remembered", time.Hour, 10, []string{"a!", "a!"}, map[string]int{"a!": 2}, 0},
+		{"expired", time.Nanosecond, 10, []string{"a", "a"}, map[string]int{"a": 2}, 1},
+		{"oldest forgotten beyond max", time.Hour, 2, []string{"a", "b", "c", "a"}, map[string]int{"a": 2, "b": 1, "c": 1}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(zap.NewNop(), tt.ttl, tt.max)
+			runs := make(map[string]int)
+			for _, key := range tt.keys {
+				// Replies are ordered by execution time
+				time.Sleep(time.Millisecond)
+				reply, cached, err := c.Do(key, execute(key, runs))
+				if key[len(key)-1] == '!' {
+					if err == nil || cached {
+						t.Fatalf("%s: got %v, cached %v, want the failure", key, err, cached)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := payload(t, reply); got != key {
+					t.Errorf("%s: replied %q", key, got)
+				}
+				if reply.Key != key || reply.Executed.IsZero() {
+					t.Errorf("%s: reply key %q executed %v", key, reply.Key, reply.Executed)
+				}
+			}
+			for key, want := range tt.runs {
+				if runs[key] != want {
+					t.Errorf("%s ran %d times, want %d", key, runs[key], want)
+				}
+			}
+			if got := c.Len(); got != tt.remembered {
+				t.Errorf("%d replies remembered, want %d", got, tt.remembered)
+			}
+		})
+	}
+}
+
+func TestCacheDoWaitsForRunning(t *testing.T) {
+	c := NewCache(zap.NewNop(), time.Hour, 10)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	runs := 0
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.Do("a", func() (Reply, error) {
+			runs++
+			close(started)
+			<-release
+			return Reply{Type: protocol.TypeResult, Payload: json.RawMessage(`"a"`)}, nil
+		})
+	}()
+	<-started
+
+	done := make(chan bool)
+	go func() {
+		_, cached, _ := c.Do("a", func() (Reply, error) {
+			runs++
+			return Reply{}, nil
+		})
+		done <- cached
+	}()
+	select {
+	case <-done:
+		t.Fatal("resent command didn't wait for the running one")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if cached := <-done; !cached {
+		t.Error("resent command wasn't answered from the cache")
+	}
+	wg.Wait()
+	if runs != 1 {
+		t.Errorf("ran %d times, want 1", runs)
+	}
+}
+
+func TestCacheSetStore(t *testing.T) {
+	s, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	before := NewCache(zap.NewNop(), time.Hour, 10)
+	if err := before.SetStore(s); err != nil {
+		t.Fatal(err)
+	}
+	runs := make(map[string]int)
+	if _, _, err := before.Do("a", execute("a", runs)); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart the command is answered from the store
+	after := NewCache(zap.NewNop(), time.Hour, 10)
+	if err := after.SetStore(s); err != nil {
+		t.Fatal(err)
+	}
+	reply, cached, err := after.Do("a", execute("a", runs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached || runs["a"] != 1 {
+		t.Errorf("cached %v after %d runs, want it replayed", cached, runs["a"])
+	}
+	if got := payload(t, reply); got != "a" {
+		t.Errorf("replied %q", got)
+	}
+}
+
+// execute returns a command replying with key, counting its runs. Keys
+// ending in "!" fail.
+func execute(key string, runs map[string]int) func() (Reply, error) {
+	return func() (Reply, error) {
+		runs[key]++
+		if key[len(key)-1] == '!' {
+			return Reply{}, errors.New("command failed")
+		}
+		data, err := json.Marshal(key)
+		return Reply{Type: protocol.TypeResult, Payload: data}, err
+	}
+}
+
+func payload(t *testing.T, reply Reply) string {
+	t.Helper()
+	var s string
+	if err := json.Unmarshal(reply.Payload, &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
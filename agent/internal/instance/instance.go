@@ -0,0 +1,168 @@
+// Package instance keeps a single agent running per data directory and
+// lets the CLI query and stop it
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pidFileName is the PID file under the data directory. The running
+// agent holds a lock on it for as long as it runs.
+const pidFileName = "agent.pid"
+
+// stopPoll is how often Stop checks whether the agent has exited
+const stopPoll = 100 * time.Millisecond
+
+// ErrNotRunning is returned when no agent holds the lock
+var ErrNotRunning = errors.New("agent is not running")
+
+// RunningError is returned by Acquire when another agent holds the lock
+type RunningError struct {
+	PID int
+}
+
+func (e *RunningError) Error() string {
+	if e.PID == 0 {
+		return "another agent is already running"
+	}
+	return fmt.Sprintf("another agent is already running (pid %d)", e.PID)
+}
+
+// Lock is the single-instance lock held by the running agent
+type Lock struct {
+	file *os.File
+}
+
+// Status describes the agent running for a data directory
+type Status struct {
+	Running bool   `json:"running"`
+	PID     int    `json:"pid,omitempty"`
+	PIDFile string `json:"pid_file"`
+}
+
+// PIDFile returns the path of the PID file for a data directory
+func PIDFile(dataDir string) string {
+	return filepath.Join(dataDir, pidFileName)
+}
+
+// Acquire takes the single-instance lock for dataDir and writes the PID of
+// this process. It fails with a *RunningError if another agent holds it.
+func Acquire(dataDir string) (*Lock, error) {
+	path := PIDFile(dataDir)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PID file: %w", err)
+	}
+	locked, err := tryLock(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock PID file: %w", err)
+	}
+	if !locked {
+		pid, _ := readPID(file)
+		file.Close()
+		return nil, &RunningError{PID: pid}
+	}
+
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write PID file: %w", err)
+	}
+	if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write PID file: %w", err)
+	}
+	return &Lock{file: file}, nil
+}
+
+// Release clears the PID file and gives up the lock. The file is left in
+// place, so that an agent waiting on it can't lock a removed file.
+func (l *Lock) Release() error {
+	if err := l.file.Truncate(0); err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to clear PID file: %w", err)
+	}
+	return l.file.Close()
+}
+
+// Query reports whether an agent is running for dataDir
+func Query(dataDir string) (Status, error) {
+	status := Status{PIDFile: PIDFile(dataDir)}
+	file, err := os.OpenFile(status.PIDFile, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return status, nil
+	}
+	if err != nil {
+		return status, fmt.Errorf("failed to open PID file: %w", err)
+	}
+	defer file.Close()
+
+	locked, err := tryLock(file)
+	if err != nil {
+		return status, fmt.Errorf("failed to check PID file lock: %w", err)
+	}
+	// Closing the file releases a lock taken just to check
+	if locked {
+		return status, nil
+	}
+	status.Running = true
+	if status.PID, err = readPID(file); err != nil {
+		return status, err
+	}
+	return status, nil
+}
+
+// Stop asks the running agent to shut down and waits up to timeout for it
+// to exit
+func Stop(dataDir string, timeout time.Duration) (Status, error) {
+	status, err := Query(dataDir)
+	if err != nil {
+		return status, err
+	}
+	if !status.Running {
+		return status, ErrNotRunning
+	}
+	if status.PID == 0 {
+		return status, fmt.Errorf("PID file %s holds no PID", status.PIDFile)
+	}
+	if err := terminate(status.PID); err != nil {
+		return status, fmt.Errorf("failed to signal agent (pid %d): %w", status.PID, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(stopPoll)
+		current, err := Query(dataDir)
+		if err != nil {
+			return status, err
+		}
+		if !current.Running {
+			return current, nil
+		}
+	}
+	return status, fmt.Errorf("agent (pid %d) did not exit within %s", status.PID, timeout)
+}
+
+func readPID(file *os.File) (int, error) {
+	buf := make([]byte, 32)
+	n, err := file.ReadAt(buf, 0)
+	if n == 0 && err != nil && !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("failed to read PID file: %w", err)
+	}
+	text := strings.TrimSpace(string(buf[:n]))
+	if text == "" {
+		return 0, nil
+	}
+	pid, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PID file: %w", err)
+	}
+	return pid, nil
+}
@@ -0,0 +1,259 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/packages"
+	"shh/agent/internal/protocol"
+)
+
+// ContainerImage represents an image used by a running container
+type ContainerImage struct {
+	Image      string   `json:"image"`
+	ImageID    string   `json:"image_id"`
+	Containers []string `json:"containers"`
+}
+
+// Runtime represents an installed language runtime
+type Runtime struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Path    string `json:"path"`
+}
+
+// Inventory represents the installed software on the host
+type Inventory struct {
+	Hostname    string             `json:"hostname"`
+	CollectedAt time.Time          `json:"collected_at"`
+	Packages    []packages.Package `json:"packages"`
+	Images      []ContainerImage   `json:"images"`
+	Runtimes    []Runtime          `json:"runtimes"`
+}
+
+// ContainerLister lists containers; implemented by docker.Manager
+type ContainerLister interface {
+	ListContainers(ctx context.Context, includeAll bool) ([]types.Container, error)
+}
+
+// runtimeProbe describes how to detect a language runtime
+type runtimeProbe struct {
+	name   string
+	binary string
+	args   []string
+}
+
+var runtimeProbes = []runtimeProbe{
+	{"go", "go", []string{"version"}},
+	{"python", "python3", []string{"--version"}},
+	{"node", "node", []string{"--version"}},
+	{"java", "java", []string{"-version"}},
+	{"ruby", "ruby", []string{"--version"}},
+	{"php", "php", []string{"--version"}},
+	{"dotnet", "dotnet", []string{"--version"}},
+	{"rust", "rustc", []string{"--version"}},
+	{"perl", "perl", []string{"-e", "print $^V"}},
+}
+
+var versionPattern = regexp.MustCompile(`\d+\.\d+(?:\.\d+)?`)
+
+// Collector periodically collects the software inventory
+type Collector struct {
+	logger     *zap.Logger
+	managers   []packages.PackageManager
+	containers ContainerLister
+	interval   time.Duration
+	current    *Inventory
+	mu         sync.RWMutex
+}
+
+// NewCollector creates a new inventory collector. containers may be nil on
+// hosts without Docker.
+func NewCollector(logger *zap.Logger, containers ContainerLister, interval time.Duration) *Collector {
+	managers, err := packages.NewPackageManager(logger)
+	if err != nil {
+		logger.Warn("No package managers available for inventory", zap.Error(err))
+	}
+
+	if interval <= 0 {
+		interval = 6 * time.Hour
+	}
+
+	return &Collector{
+		logger:     logger,
+		managers:   managers,
+		containers: containers,
+		interval:   interval,
+	}
+}
+
+// Start begins periodic inventory collection
+func (c *Collector) Start(ctx context.Context) error {
+	go func() {
+		if _, err := c.Collect(ctx); err != nil {
+			c.logger.Error("Failed to collect inventory", zap.Error(err))
+		}
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := c.Collect(ctx); err != nil {
+					c.logger.Error("Failed to collect inventory", zap.Error(err))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the collector
+func (c *Collector) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Collect gathers a fresh inventory and stores it as the current snapshot
+func (c *Collector) Collect(ctx context.Context) (*Inventory, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	inv := &Inventory{
+		Hostname:    hostname,
+		CollectedAt: time.Now(),
+	}
+
+	for _, pm := range c.managers {
+		pkgs, err := pm.List(ctx)
+		if err != nil {
+			c.logger.Warn("Failed to list packages", zap.Error(err))
+			continue
+		}
+		inv.Packages = append(inv.Packages, pkgs...)
+	}
+
+	if c.containers != nil {
+		images, err := c.collectImages(ctx)
+		if err != nil {
+			c.logger.Warn("Failed to list container images", zap.Error(err))
+		}
+		inv.Images = images
+	}
+
+	inv.Runtimes = collectRuntimes(ctx)
+
+	c.mu.Lock()
+	c.current = inv
+	c.mu.Unlock()
+
+	c.logger.Debug("Inventory collected",
+		zap.Int("packages", len(inv.Packages)),
+		zap.Int("images", len(inv.Images)),
+		zap.Int("runtimes", len(inv.Runtimes)))
+
+	return inv, nil
+}
+
+// Get returns the most recent inventory, or nil if none has been collected
+func (c *Collector) Get() *Inventory {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.current
+}
+
+// collectImages groups running containers by image
+func (c *Collector) collectImages(ctx context.Context) ([]ContainerImage, error) {
+	containers, err := c.containers.ListContainers(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*ContainerImage)
+	var order []string
+	for _, ctr := range containers {
+		img, ok := byID[ctr.ImageID]
+		if !ok {
+			img = &ContainerImage{Image: ctr.Image, ImageID: ctr.ImageID}
+			byID[ctr.ImageID] = img
+			order = append(order, ctr.ImageID)
+		}
+		name := ctr.ID
+		if len(ctr.Names) > 0 {
+			name = ctr.Names[0]
+		}
+		img.Containers = append(img.Containers, name)
+	}
+
+	images := make([]ContainerImage, 0, len(order))
+	for _, id := range order {
+		images = append(images, *byID[id])
+	}
+	return images, nil
+}
+
+// collectRuntimes detects installed language runtimes
+func collectRuntimes(ctx context.Context) []Runtime {
+	var runtimes []Runtime
+	for _, probe := range runtimeProbes {
+		path, err := exec.LookPath(probe.binary)
+		if err != nil {
+			continue
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		// Some runtimes (java) print their version on stderr
+		output, err := exec.CommandContext(probeCtx, path, probe.args...).CombinedOutput()
+		cancel()
+		if err != nil {
+			continue
+		}
+
+		runtimes = append(runtimes, Runtime{
+			Name:    probe.name,
+			Version: versionPattern.FindString(string(output)),
+			Path:    path,
+		})
+	}
+	return runtimes
+}
+
+// HandleCommand processes inventory-related commands
+func (c *Collector) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "inventory:get":
+		if inv := c.Get(); inv != nil {
+			return inv, nil
+		}
+		return c.Collect(ctx)
+	case "inventory:refresh":
+		return c.Collect(ctx)
+	case "inventory:sbom":
+		format := FormatCycloneDX
+		if len(args) > 0 {
+			format = SBOMFormat(args[0])
+		}
+		inv := c.Get()
+		if inv == nil {
+			var err error
+			if inv, err = c.Collect(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return ExportSBOM(inv, format)
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown inventory command: %s", cmd)
+	}
+}
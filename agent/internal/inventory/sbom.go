@@ -0,0 +1,304 @@
+package inventory
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// SBOMFormat represents a software bill of materials document format
+type SBOMFormat string
+
+const (
+	FormatCycloneDX SBOMFormat = "cyclonedx"
+	FormatSPDX      SBOMFormat = "spdx"
+)
+
+const toolName = "dsh-agent"
+
+// ExportSBOM renders the inventory as a JSON SBOM document
+func ExportSBOM(inv *Inventory, format SBOMFormat) (json.RawMessage, error) {
+	var doc interface{}
+	switch format {
+	case FormatCycloneDX:
+		doc = buildCycloneDX(inv, components(inv, osReleaseID()))
+	case FormatSPDX:
+		doc = buildSPDX(inv, components(inv, osReleaseID()))
+	default:
+		return nil, fmt.Errorf("unsupported SBOM format: %s", format)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal SBOM: %w", err)
+	}
+	return data, nil
+}
+
+// component is a format-neutral view of an inventory item
+type component struct {
+	kind        string // CycloneDX component type
+	name        string
+	version     string
+	description string
+	purl        string
+	// source is the package manager, telling apart packages that share a
+	// purl
+	source string
+	// ref is unique within the document
+	ref string
+}
+
+// components flattens the inventory into SBOM components. Components listed
+// twice are kept once, and those that only share a purl, such as a snap and
+// a flatpak of the same name and version, get distinct refs.
+func components(inv *Inventory, distro string) []component {
+	var comps []component
+	for _, pkg := range inv.Packages {
+		comps = append(comps, component{
+			kind:        "library",
+			name:        pkg.Name,
+			version:     pkg.Version,
+			description: pkg.Description,
+			purl:        packageURL(pkg.Source, distro, pkg.Name, pkg.Version, pkg.Arch),
+			source:      pkg.Source,
+		})
+	}
+	for _, img := range inv.Images {
+		name, version := img.Image, ""
+		if idx := strings.LastIndex(name, ":"); idx > strings.LastIndex(name, "/") {
+			name, version = name[:idx], name[idx+1:]
+		}
+		purl := "pkg:oci/" + url.PathEscape(name[strings.LastIndex(name, "/")+1:])
+		if img.ImageID != "" {
+			purl += "@" + url.PathEscape(img.ImageID)
+		}
+		comps = append(comps, component{
+			kind:    "container",
+			name:    name,
+			version: version,
+			purl:    purl,
+		})
+	}
+	for _, rt := range inv.Runtimes {
+		comps = append(comps, component{
+			kind:    "platform",
+			name:    rt.Name,
+			version: rt.Version,
+			purl:    packageURL("", "", rt.Name, rt.Version, ""),
+		})
+	}
+
+	unique := comps[:0]
+	seen := make(map[component]bool)
+	refs := make(map[string]bool)
+	for _, c := range comps {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		c.ref = c.purl
+		if refs[c.ref] && c.source != "" {
+			c.ref = fmt.Sprintf("%s (%s)", c.purl, c.source)
+		}
+		for n := 2; refs[c.ref]; n++ {
+			c.ref = fmt.Sprintf("%s (%d)", c.purl, n)
+		}
+		refs[c.ref] = true
+		unique = append(unique, c)
+	}
+	return unique
+}
+
+// packageURL builds a purl for a package from the given package manager
+// source, qualified with its architecture when known
+func packageURL(source, distro, name, version, arch string) string {
+	var prefix string
+	switch source {
+	case "apt":
+		prefix = "pkg:deb/" + distro + "/"
+	case "zypper":
+		prefix = "pkg:rpm/" + distro + "/"
+	case "apk":
+		prefix = "pkg:apk/" + distro + "/"
+	case "pacman":
+		prefix = "pkg:alpm/" + distro + "/"
+	case "choco":
+		prefix = "pkg:nuget/"
+	default:
+		prefix = "pkg:generic/"
+	}
+
+	purl := prefix + url.PathEscape(name)
+	if version != "" {
+		purl += "@" + url.PathEscape(version)
+	}
+	if arch != "" {
+		purl += "?arch=" + url.QueryEscape(arch)
+	}
+	return purl
+}
+
+// osReleaseID returns the distribution ID from /etc/os-release
+func osReleaseID() string {
+	f, err := os.Open("/etc/os-release")
+	if err != nil {
+		return "unknown"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if id, ok := strings.CutPrefix(scanner.Text(), "ID="); ok {
+			return strings.Trim(id, `"`)
+		}
+	}
+	return "unknown"
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// CycloneDX 1.5 JSON document
+type cdxDocument struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     []cdxTool    `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTool struct {
+	Name string `json:"name"`
+}
+
+type cdxComponent struct {
+	Type        string `json:"type"`
+	BOMRef      string `json:"bom-ref,omitempty"`
+	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
+	PURL        string `json:"purl,omitempty"`
+}
+
+func buildCycloneDX(inv *Inventory, comps []component) cdxDocument {
+	doc := cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: inv.CollectedAt.UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Name: toolName}},
+			Component: cdxComponent{Type: "device", Name: inv.Hostname},
+		},
+		Components: []cdxComponent{},
+	}
+
+	for _, c := range comps {
+		doc.Components = append(doc.Components, cdxComponent{
+			Type:        c.kind,
+			BOMRef:      c.ref,
+			Name:        c.name,
+			Version:     c.version,
+			Description: c.description,
+			PURL:        c.purl,
+		})
+	}
+	return doc
+}
+
+// SPDX 2.3 JSON document
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Description      string            `json:"description,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func buildSPDX(inv *Inventory, comps []component) spdxDocument {
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              inv.Hostname,
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", url.PathEscape(inv.Hostname), newUUID()),
+		CreationInfo: spdxCreationInfo{
+			Created:  inv.CollectedAt.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + toolName},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+
+	for i, c := range comps {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			SPDXID:           id,
+			Name:             c.name,
+			VersionInfo:      c.version,
+			DownloadLocation: "NOASSERTION",
+			Description:      c.description,
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  c.purl,
+			}},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: id,
+		})
+	}
+	return doc
+}
@@ -0,0 +1,105 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shh/agent/internal/packages"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestSBOMGolden(t *testing.T) {
+	inv := &Inventory{
+		Hostname:    "web1",
+		CollectedAt: time.Date(2026, 3, 2, 13, 37, 0, 0, time.UTC),
+		Packages: []packages.Package{
+			{Name: "libc6", Version: "2.35-0ubuntu3.6", Description: "GNU C Library: Shared libraries", Source: "apt", Arch: "amd64"},
+			{Name: "libc6", Version: "2.35-0ubuntu3.6", Description: "GNU C Library: Shared libraries", Source: "apt", Arch: "i386"},
+			// Listed twice, e.g. by two collections
+			{Name: "openssl", Version: "3.0.2-0ubuntu1.15", Description: "Secure Sockets Layer toolkit", Source: "apt", Arch: "amd64"},
+			{Name: "openssl", Version: "3.0.2-0ubuntu1.15", Description: "Secure Sockets Layer toolkit", Source: "apt", Arch: "amd64"},
+			// Different sources sharing a generic purl
+			{Name: "firefox", Version: "124.0", Source: "snap"},
+			{Name: "firefox", Version: "124.0", Source: "flatpak"},
+		},
+		Images: []ContainerImage{
+			{Image: "registry.example.com/team/nginx:1.25", ImageID: "sha256:4f1c", Containers: []string{"web"}},
+		},
+		Runtimes: []Runtime{
+			{Name: "go", Version: "1.22.1", Path: "/usr/local/go/bin/go"},
+		},
+	}
+	comps := components(inv, "ubuntu")
+
+	tests := []struct {
+		name   string
+		golden string
+		doc    interface{}
+		scrub  []string // random fields
+	}{
+		{"cyclonedx", "sbom.cdx.json", buildCycloneDX(inv, comps), []string{"serialNumber"}},
+		{"spdx", "sbom.spdx.json", buildSPDX(inv, comps), []string{"documentNamespace"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range tt.scrub {
+				if doc[field] == "" {
+					t.Errorf("%s is empty", field)
+				}
+				doc[field] = "SCRUBBED"
+			}
+			got, err := json.MarshalIndent(doc, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s differs from %s; rerun with -update if the change is intended\n%s", tt.name, golden, got)
+			}
+		})
+	}
+}
+
+func TestCycloneDXRefsUnique(t *testing.T) {
+	inv := &Inventory{Packages: []packages.Package{
+		{Name: "tool", Version: "1", Source: "snap"},
+		{Name: "tool", Version: "1", Source: "flatpak"},
+		{Name: "tool", Version: "1", Source: "winget"},
+		{Name: "tool", Version: "1-2", Source: "snap"},
+	}}
+	refs := make(map[string]bool)
+	for _, c := range buildCycloneDX(inv, components(inv, "ubuntu")).Components {
+		if refs[c.BOMRef] {
+			t.Errorf("bom-ref %s is repeated", c.BOMRef)
+		}
+		refs[c.BOMRef] = true
+	}
+	if len(refs) != 4 {
+		t.Errorf("%d components, want 4", len(refs))
+	}
+}
@@ -0,0 +1,391 @@
+// Package journal keeps the messages the agent couldn't send the server,
+// or all of them when it runs offline, in segment files under a
+// directory, so that they can be uploaded on reconnect or exported.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".jsonl"
+	// cursorFile records how much of the journal was uploaded
+	cursorFile = "cursor.json"
+	// segmentSize is the size at which a new segment is started, so that
+	// retention trims whole segments
+	segmentSize = 8 * 1024 * 1024
+	// maxRecordSize bounds the records read back
+	maxRecordSize = 16 * 1024 * 1024
+)
+
+// DefaultConfig keeps a week of records, up to 256MB
+var DefaultConfig = Config{
+	MaxAge:  7 * 24 * time.Hour,
+	MaxSize: 256 * 1024 * 1024,
+}
+
+// Config bounds the records kept; 0 leaves a bound at its default
+type Config struct {
+	MaxAge  time.Duration
+	MaxSize int64
+}
+
+// Cursor is a position in the journal: the records of segments before
+// Segment, and those of Segment before Offset
+type Cursor struct {
+	Segment string `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// Journal appends messages to segment files and trims the oldest ones
+// beyond the retention
+type Journal struct {
+	logger *zap.Logger
+	dir    string
+	config Config
+
+	mu   sync.Mutex
+	file *os.File
+	name string
+	size int64
+
+	// uploading serializes Replay
+	uploading sync.Mutex
+}
+
+// Open opens the journal in dir, creating it if needed. Records go to a
+// new segment, so that one cut short by a crash doesn't corrupt the next.
+func Open(logger *zap.Logger, dir string, config Config) (*Journal, error) {
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultConfig.MaxAge
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultConfig.MaxSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	j := &Journal{logger: logger, dir: dir, config: config}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.prune()
+	return j, nil
+}
+
+// Append journals msg
+func (j *Journal) Append(msg protocol.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal record: %w", err)
+	}
+	data = append(data, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil || j.size+int64(len(data)) > segmentSize {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := j.file.Write(data)
+	j.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write journal record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the current segment
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// Replay sends the records not uploaded yet, oldest first, and remembers
+// how far it got. It stops at the first record that fails to send, and
+// returns right away while another Replay runs.
+func (j *Journal) Replay(send func(protocol.Message) error) (int, error) {
+	if !j.uploading.TryLock() {
+		return 0, nil
+	}
+	defer j.uploading.Unlock()
+
+	cursor, err := LoadCursor(j.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	// Records appended while replaying are left for the next Replay
+	j.mu.Lock()
+	segments, err := listSegments(j.dir)
+	current, currentSize := j.name, j.size
+	j.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, segment := range segments {
+		if segment.name < cursor.Segment {
+			continue
+		}
+		if segment.name == current {
+			segment.size = currentSize
+		}
+		from := int64(0)
+		if segment.name == cursor.Segment {
+			from = cursor.Offset
+		}
+		err := readSegment(filepath.Join(j.dir, segment.name), from, segment.size, func(msg protocol.Message, end int64) error {
+			if err := send(msg); err != nil {
+				return err
+			}
+			sent++
+			cursor = Cursor{Segment: segment.name, Offset: end}
+			return nil
+		})
+		// Malformed records are skipped
+		if err == nil || errors.Is(err, errMalformed) {
+			cursor = Cursor{Segment: segment.name, Offset: segment.size}
+		}
+		if saveErr := SaveCursor(j.dir, cursor); saveErr != nil {
+			return sent, saveErr
+		}
+		if errors.Is(err, errMalformed) {
+			j.logger.Warn("Skipped malformed journal records", zap.String("segment", segment.name), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			return sent, fmt.Errorf("failed to upload journal: %w", err)
+		}
+	}
+	return sent, nil
+}
+
+// rotate starts a new segment, then trims the journal to its retention.
+// The caller holds mu.
+func (j *Journal) rotate() error {
+	if j.file != nil {
+		if err := j.file.Close(); err != nil {
+			j.logger.Warn("Failed to close journal segment", zap.String("segment", j.name), zap.Error(err))
+		}
+		j.file = nil
+	}
+	name := fmt.Sprintf("%s%020d%s", segmentPrefix, time.Now().UnixNano(), segmentSuffix)
+	file, err := os.OpenFile(filepath.Join(j.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create journal segment: %w", err)
+	}
+	j.file, j.name, j.size = file, name, 0
+	j.prune()
+	return nil
+}
+
+// prune removes the oldest segments while they are older than MaxAge or
+// the journal is larger than MaxSize. The current segment is kept. The
+// caller holds mu.
+func (j *Journal) prune() {
+	segments, err := listSegments(j.dir)
+	if err != nil {
+		j.logger.Warn("Failed to list journal segments", zap.Error(err))
+		return
+	}
+	var total int64
+	for _, s := range segments {
+		total += s.size
+	}
+	cutoff := time.Now().Add(-j.config.MaxAge)
+	for _, s := range segments {
+		if s.name == j.name || (total <= j.config.MaxSize && !s.modified.Before(cutoff)) {
+			break
+		}
+		if err := os.Remove(filepath.Join(j.dir, s.name)); err != nil {
+			j.logger.Warn("Failed to remove journal segment", zap.String("segment", s.name), zap.Error(err))
+			return
+		}
+		total -= s.size
+		j.logger.Info("Removed journal segment beyond retention", zap.String("segment", s.name))
+	}
+}
+
+// Export writes the records journaled in dir since since as JSON lines,
+// oldest first, and returns how many it wrote and the position after the
+// last one
+func Export(dir string, w io.Writer, since time.Time) (int, Cursor, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return 0, Cursor{}, err
+	}
+	var end Cursor
+	written := 0
+	for _, segment := range segments {
+		end = Cursor{Segment: segment.name, Offset: segment.size}
+		if segment.modified.Before(since) {
+			continue
+		}
+		err := readSegment(filepath.Join(dir, segment.name), 0, segment.size, func(msg protocol.Message, _ int64) error {
+			if msg.Timestamp.Before(since) {
+				return nil
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return err
+			}
+			written++
+			return nil
+		})
+		if err != nil && !errors.Is(err, errMalformed) {
+			return written, end, fmt.Errorf("failed to export journal: %w", err)
+		}
+	}
+	return written, end, nil
+}
+
+// LoadCursor returns how much of the journal in dir was uploaded
+func LoadCursor(dir string) (Cursor, error) {
+	var cursor Cursor
+	data, err := os.ReadFile(filepath.Join(dir, cursorFile))
+	if os.IsNotExist(err) {
+		return cursor, nil
+	}
+	if err != nil {
+		return cursor, fmt.Errorf("failed to read journal cursor: %w", err)
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("failed to parse journal cursor: %w", err)
+	}
+	return cursor, nil
+}
+
+// SaveCursor records that the journal in dir was uploaded up to cursor
+func SaveCursor(dir string, cursor Cursor) error {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal cursor: %w", err)
+	}
+	path := filepath.Join(dir, cursorFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write journal cursor: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write journal cursor: %w", err)
+	}
+	return nil
+}
+
+// errMalformed is returned for a record that can't be parsed, such as one
+// cut short by a crash
+var errMalformed = errors.New("malformed journal record")
+
+type segment struct {
+	name     string
+	size     int64
+	modified time.Time
+}
+
+// listSegments returns the segments in dir, oldest first
+func listSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list journal segments: %w", err)
+	}
+	var segments []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{name: name, size: info.Size(), modified: info.ModTime()})
+	}
+	sort.Slice(segments, func(i, k int) bool { return segments[i].name < segments[k].name })
+	return segments, nil
+}
+
+// readSegment calls fn with the records of the segment at path between
+// the offsets from and to, and the offset after each record
+func readSegment(path string, from, to int64, fn func(msg protocol.Message, end int64) error) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		// Pruned since it was listed
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(from, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(io.LimitReader(file, to-from), 64*1024)
+	offset := from
+	var malformed error
+	for {
+		line, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			line, err = readLong(reader, line)
+		}
+		if len(line) == 0 && err != nil {
+			if err == io.EOF {
+				return malformed
+			}
+			return err
+		}
+		offset += int64(len(line))
+		var msg protocol.Message
+		if jsonErr := json.Unmarshal(line, &msg); jsonErr != nil {
+			malformed = fmt.Errorf("%w at offset %d", errMalformed, offset-int64(len(line)))
+			continue
+		}
+		if err := fn(msg, offset); err != nil {
+			return err
+		}
+	}
+}
+
+// readLong finishes reading a line longer than the reader's buffer
+func readLong(reader *bufio.Reader, start []byte) ([]byte, error) {
+	line := append([]byte(nil), start...)
+	for len(line) <= maxRecordSize {
+		more, err := reader.ReadSlice('\n')
+		line = append(line, more...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, err
+		}
+	}
+	return line, fmt.Errorf("%w: record exceeds %d bytes", errMalformed, maxRecordSize)
+}
@@ -0,0 +1,52 @@
+package journal
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Client sends messages to the server
+type Client interface {
+	SendMessage(msg protocol.Message) error
+}
+
+// Sender sends messages through a client and journals those that fail to
+// send, or every message while offline
+type Sender struct {
+	logger  *zap.Logger
+	journal *Journal
+	client  Client
+	offline atomic.Bool
+}
+
+// NewSender creates a sender journaling to journal what client can't send
+func NewSender(logger *zap.Logger, journal *Journal, client Client) *Sender {
+	return &Sender{logger: logger, journal: journal, client: client}
+}
+
+// SetOffline journals every message without trying the client
+func (s *Sender) SetOffline(offline bool) {
+	s.offline.Store(offline)
+}
+
+// SendMessage sends msg, or journals it. A journaled message counts as
+// sent.
+func (s *Sender) SendMessage(msg protocol.Message) error {
+	if !s.offline.Load() {
+		err := s.client.SendMessage(msg)
+		if err == nil {
+			return nil
+		}
+		s.logger.Debug("Journaling message that failed to send",
+			zap.String("type", string(msg.Type)),
+			zap.Error(err))
+	}
+	if err := s.journal.Append(msg); err != nil {
+		return fmt.Errorf("failed to journal message: %w", err)
+	}
+	return nil
+}
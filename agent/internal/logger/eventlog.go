@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+
+	"shh/agent/internal/config"
+)
+
+// defaultEventSource is the Event Log source entries are written under
+const defaultEventSource = "shh-agent"
+
+// eventID is the event ID of every entry; the level is carried by the
+// entry type
+const eventID = 1
+
+// eventLogWriter writes entries of each type to the Windows Event Log
+type eventLogWriter interface {
+	Info(eid uint32, msg string) error
+	Warning(eid uint32, msg string) error
+	Error(eid uint32, msg string) error
+	Close() error
+}
+
+// EventLogCore implements zapcore.Core for the Windows Event Log. Fields
+// are appended to the message as JSON, since Event Log entries have no
+// structured data.
+type EventLogCore struct {
+	writer eventLogWriter
+	level  zapcore.LevelEnabler
+	fields []zapcore.Field
+}
+
+// NewEventLogCore creates an EventLogCore, registering the event source
+// if it doesn't exist yet
+func NewEventLogCore(cfg *config.EventLogConfig, level zapcore.LevelEnabler) (*EventLogCore, error) {
+	source := cfg.Source
+	if source == "" {
+		source = defaultEventSource
+	}
+	writer, err := openEventLog(source)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLogCore{
+		writer: writer,
+		level:  level,
+		fields: make([]zapcore.Field, 0),
+	}, nil
+}
+
+// Enabled implements zapcore.Core
+func (c *EventLogCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level)
+}
+
+// With implements zapcore.Core
+func (c *EventLogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(append([]zapcore.Field{}, c.fields...), fields...)
+	return &clone
+}
+
+// Check implements zapcore.Core
+func (c *EventLogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (c *EventLogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	if ent.Caller.Defined {
+		enc.Fields["caller"] = ent.Caller.String()
+	}
+	if ent.Stack != "" {
+		enc.Fields["stacktrace"] = ent.Stack
+	}
+
+	msg := ent.Message
+	if len(enc.Fields) > 0 {
+		data, err := json.Marshal(enc.Fields)
+		if err != nil {
+			return fmt.Errorf("failed to marshal log entry: %w", err)
+		}
+		msg += "\n" + string(data)
+	}
+
+	switch {
+	case ent.Level >= zapcore.ErrorLevel:
+		return c.writer.Error(eventID, msg)
+	case ent.Level == zapcore.WarnLevel:
+		return c.writer.Warning(eventID, msg)
+	default:
+		return c.writer.Info(eventID, msg)
+	}
+}
+
+// Sync implements zapcore.Core. Entries are written unbuffered.
+func (c *EventLogCore) Sync() error {
+	return nil
+}
+
+// Close closes the event log handle
+func (c *EventLogCore) Close() error {
+	return c.writer.Close()
+}
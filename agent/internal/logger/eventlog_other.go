@@ -0,0 +1,10 @@
+//go:build !windows
+
+package logger
+
+import "fmt"
+
+// openEventLog fails outside Windows
+func openEventLog(source string) (eventLogWriter, error) {
+	return nil, fmt.Errorf("the event log is only available on Windows")
+}
@@ -0,0 +1,20 @@
+package logger
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// openEventLog opens source, registering it with the Event Log first if
+// needed. Registering requires administrator rights.
+func openEventLog(source string) (eventLogWriter, error) {
+	// An already registered source is left as it is
+	_ = eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info)
+
+	log, err := eventlog.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log source %s: %w", source, err)
+	}
+	return log, nil
+}
@@ -12,6 +12,10 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// level is shared by the cores of the logger built by Setup, so that it
+// can be changed while running
+var level = zap.NewAtomicLevel()
+
 // Setup initializes the logger with the given configuration
 func Setup(cfg *config.LoggingConfig) (*zap.Logger, error) {
 	// Create base encoder config
@@ -24,9 +28,8 @@ func Setup(cfg *config.LoggingConfig) (*zap.Logger, error) {
 	encoder := zapcore.NewJSONEncoder(encoderConfig)
 
 	// Setup log level
-	level, err := zapcore.ParseLevel(cfg.Level)
-	if err != nil {
-		return nil, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	if err := SetLevel(cfg.Level); err != nil {
+		return nil, err
 	}
 
 	var cores []zapcore.Core
@@ -61,6 +64,43 @@ func Setup(cfg *config.LoggingConfig) (*zap.Logger, error) {
 		))
 	}
 
+	// Add syslog output if configured. Entries are diverted to the fallback
+	// while the daemon is unreachable.
+	if cfg.Syslog.Enabled {
+		syslogCore, err := NewSyslogCore(&cfg.Syslog, level)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create syslog core: %w", err)
+		}
+
+		fallback := zapcore.AddSync(os.Stderr)
+		if cfg.Syslog.FallbackFile != "" {
+			if err := os.MkdirAll(filepath.Dir(cfg.Syslog.FallbackFile), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create syslog fallback directory: %w", err)
+			}
+			fallback = zapcore.AddSync(&lumberjack.Logger{
+				Filename:   cfg.Syslog.FallbackFile,
+				MaxSize:    cfg.MaxSize,
+				MaxBackups: cfg.MaxBackups,
+				MaxAge:     cfg.MaxAge,
+				Compress:   cfg.Compress,
+			})
+		}
+
+		cores = append(cores, &failoverCore{
+			primary:  syslogCore,
+			fallback: zapcore.NewCore(encoder, fallback, level),
+		})
+	}
+
+	// Add Windows Event Log output if configured
+	if cfg.EventLog.Enabled {
+		eventLogCore, err := NewEventLogCore(&cfg.EventLog, level)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create event log core: %w", err)
+		}
+		cores = append(cores, eventLogCore)
+	}
+
 	// Combine cores
 	core := zapcore.NewTee(cores...)
 
@@ -76,6 +116,16 @@ func Setup(cfg *config.LoggingConfig) (*zap.Logger, error) {
 	return logger, nil
 }
 
+// SetLevel changes the level of the logger built by Setup
+func SetLevel(text string) error {
+	l, err := zapcore.ParseLevel(text)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", text, err)
+	}
+	level.SetLevel(l)
+	return nil
+}
+
 // Sync flushes any buffered log entries
 func Sync(logger *zap.Logger) error {
 	if err := logger.Sync(); err != nil {
@@ -3,8 +3,11 @@ package logger
 import (
 	"encoding/json"
 	"fmt"
-	"log/syslog"
+	"net"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"shh/agent/internal/config"
@@ -13,22 +16,214 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+// Syslog message formats
+const (
+	FormatRFC3164 = "rfc3164"
+	FormatRFC5424 = "rfc5424"
+)
+
+// syslogRetryInterval is how long the writer waits before redialing a failed connection
+const syslogRetryInterval = 10 * time.Second
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogWriter sends formatted messages to a syslog daemon, redialing the
+// connection after failures
+type syslogWriter struct {
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+	format   string
+	sdID     string
+
+	conn    net.Conn
+	retryAt time.Time
+	mu      sync.Mutex
+}
+
+// write formats and sends a single message
+func (w *syslogWriter) write(severity int, ts time.Time, msg string, sd map[string]string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		if time.Now().Before(w.retryAt) {
+			return fmt.Errorf("syslog unavailable")
+		}
+		if err := w.dial(); err != nil {
+			w.retryAt = time.Now().Add(syslogRetryInterval)
+			return err
+		}
+	}
+
+	data := w.render(severity, ts, msg, sd)
+	if w.network == "tcp" || w.network == "tcp4" || w.network == "tcp6" {
+		// RFC 6587 octet counting so messages may contain newlines
+		data = fmt.Sprintf("%d %s", len(data), data)
+	}
+
+	if _, err := w.conn.Write([]byte(data)); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		w.retryAt = time.Now().Add(syslogRetryInterval)
+		return fmt.Errorf("failed to write to syslog: %w", err)
+	}
+	return nil
+}
+
+// dial connects to the configured daemon, or the local socket when no
+// network is set
+func (w *syslogWriter) dial() error {
+	if w.network != "" {
+		conn, err := net.DialTimeout(w.network, w.address, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		w.conn = conn
+		return nil
+	}
+
+	paths := []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+	if w.address != "" {
+		paths = []string{w.address}
+	}
+	for _, path := range paths {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, path); err == nil {
+				w.conn = conn
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("failed to connect to syslog: no local syslog socket")
+}
+
+// render renders a message in the configured format
+func (w *syslogWriter) render(severity int, ts time.Time, msg string, sd map[string]string) string {
+	pri := w.facility*8 + severity
+
+	if w.format == FormatRFC3164 {
+		return fmt.Sprintf("<%d>%s %s %s[%d]: %s",
+			pri, ts.Format(time.Stamp), w.hostname, w.tag, os.Getpid(), msg)
+	}
+
+	structured := "-"
+	if len(sd) > 0 {
+		var b strings.Builder
+		keys := make([]string, 0, len(sd))
+		for k := range sd {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("[" + w.sdID)
+		for _, k := range keys {
+			fmt.Fprintf(&b, " %s=\"%s\"", sdName(k), sdEscape(sd[k]))
+		}
+		b.WriteString("]")
+		structured = b.String()
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d - %s %s",
+		pri, ts.Format(time.RFC3339Nano), w.hostname, w.tag, os.Getpid(), structured, msg)
+}
+
+func (w *syslogWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// sdName sanitizes a field name for use as an RFC 5424 SD-PARAM name
+func sdName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+// sdEscape escapes an RFC 5424 SD-PARAM value
+func sdEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
 // SyslogCore implements zapcore.Core interface for syslog output
 type SyslogCore struct {
-	writer *syslog.Writer
-	level  zapcore.Level
+	writer *syslogWriter
+	level  zapcore.LevelEnabler
 	fields []zapcore.Field
 }
 
-// NewSyslogCore creates a new SyslogCore
-func NewSyslogCore(network, raddr, tag string, level zapcore.Level) (*SyslogCore, error) {
-	writer, err := syslog.Dial(network, raddr, syslog.LOG_LOCAL0|syslog.LOG_INFO, tag)
+// NewSyslogCore creates a new SyslogCore. The connection is established
+// lazily, so an unreachable daemon does not prevent startup.
+func NewSyslogCore(cfg *config.SyslogConfig, level zapcore.LevelEnabler) (*SyslogCore, error) {
+	facility, ok := syslogFacilities[strings.ToLower(cfg.Facility)]
+	if !ok {
+		return nil, fmt.Errorf("invalid syslog facility %q", cfg.Facility)
+	}
+
+	format := strings.ToLower(cfg.Format)
+	switch format {
+	case "":
+		format = FormatRFC5424
+	case FormatRFC3164, FormatRFC5424:
+	default:
+		return nil, fmt.Errorf("invalid syslog format %q", cfg.Format)
+	}
+
+	switch cfg.Network {
+	case "", "unix", "unixgram":
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+		if cfg.Address == "" {
+			return nil, fmt.Errorf("syslog address required for network %s", cfg.Network)
+		}
+	default:
+		return nil, fmt.Errorf("invalid syslog network %q", cfg.Network)
+	}
+
+	hostname, err := os.Hostname()
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		hostname = "-"
+	}
+
+	tag := cfg.Tag
+	if tag == "" {
+		tag = "shh-agent"
+	}
+	sdID := cfg.StructuredDataID
+	if sdID == "" {
+		sdID = "shh@32473"
 	}
 
 	return &SyslogCore{
-		writer: writer,
+		writer: &syslogWriter{
+			network:  cfg.Network,
+			address:  cfg.Address,
+			facility: facility,
+			tag:      tag,
+			hostname: hostname,
+			format:   format,
+			sdID:     sdID,
+		},
 		level:  level,
 		fields: make([]zapcore.Field, 0),
 	}, nil
@@ -36,13 +231,13 @@ func NewSyslogCore(network, raddr, tag string, level zapcore.Level) (*SyslogCore
 
 // Enabled implements zapcore.Core
 func (c *SyslogCore) Enabled(level zapcore.Level) bool {
-	return level >= c.level
+	return c.level.Enabled(level)
 }
 
 // With implements zapcore.Core
 func (c *SyslogCore) With(fields []zapcore.Field) zapcore.Core {
 	clone := *c
-	clone.fields = append(clone.fields, fields...)
+	clone.fields = append(append([]zapcore.Field{}, c.fields...), fields...)
 	return &clone
 }
 
@@ -56,85 +251,125 @@ func (c *SyslogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore
 
 // Write implements zapcore.Core
 func (c *SyslogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
-	// Combine entry fields
-	allFields := make([]zapcore.Field, 0, len(c.fields)+len(fields)+4)
-	allFields = append(allFields, c.fields...)
-	allFields = append(allFields, fields...)
-
-	// Add standard fields
-	allFields = append(allFields,
-		zap.String("level", ent.Level.String()),
-		zap.Time("timestamp", ent.Time),
-		zap.String("logger", ent.LoggerName),
-		zap.String("msg", ent.Message),
-	)
-
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	if ent.LoggerName != "" {
+		enc.Fields["logger"] = ent.LoggerName
+	}
 	if ent.Caller.Defined {
-		allFields = append(allFields,
-			zap.String("caller", ent.Caller.String()),
-		)
+		enc.Fields["caller"] = ent.Caller.String()
 	}
-
 	if ent.Stack != "" {
-		allFields = append(allFields,
-			zap.String("stacktrace", ent.Stack),
-		)
+		enc.Fields["stacktrace"] = ent.Stack
 	}
 
-	// Convert fields to map
-	m := make(map[string]interface{}, len(allFields))
-	enc := zapcore.NewMapObjectEncoder()
-	for _, f := range allFields {
-		f.AddTo(enc)
-	}
-	for k, v := range enc.Fields {
-		m[k] = v
+	// RFC 5424 carries fields as structured data; RFC 3164 has no such
+	// section, so the whole entry is sent as JSON
+	if c.writer.format == FormatRFC5424 {
+		sd := make(map[string]string, len(enc.Fields)+1)
+		sd["level"] = ent.Level.String()
+		for k, v := range enc.Fields {
+			if s, ok := v.(string); ok {
+				sd[k] = s
+				continue
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				data = []byte(fmt.Sprint(v))
+			}
+			sd[k] = string(data)
+		}
+		return c.writer.write(syslogSeverity(ent.Level), ent.Time, ent.Message, sd)
 	}
 
-	// Convert to JSON
-	jsonBytes, err := json.Marshal(m)
+	enc.Fields["level"] = ent.Level.String()
+	enc.Fields["msg"] = ent.Message
+	jsonBytes, err := json.Marshal(enc.Fields)
 	if err != nil {
 		return fmt.Errorf("failed to marshal log entry: %w", err)
 	}
+	return c.writer.write(syslogSeverity(ent.Level), ent.Time, string(jsonBytes), nil)
+}
+
+// Sync implements zapcore.Core. Messages are written unbuffered.
+func (c *SyslogCore) Sync() error {
+	return nil
+}
+
+// Close closes the syslog connection
+func (c *SyslogCore) Close() error {
+	return c.writer.close()
+}
 
-	// Write to syslog with appropriate level
-	msg := string(jsonBytes)
-	switch ent.Level {
+// syslogSeverity maps a zap level to a syslog severity
+func syslogSeverity(level zapcore.Level) int {
+	switch level {
 	case zapcore.DebugLevel:
-		return c.writer.Debug(msg)
+		return 7
 	case zapcore.InfoLevel:
-		return c.writer.Info(msg)
+		return 6
 	case zapcore.WarnLevel:
-		return c.writer.Warning(msg)
+		return 4
 	case zapcore.ErrorLevel:
-		return c.writer.Err(msg)
+		return 3
 	case zapcore.DPanicLevel, zapcore.PanicLevel:
-		return c.writer.Crit(msg)
+		return 2
 	case zapcore.FatalLevel:
-		return c.writer.Emerg(msg)
+		return 0
 	default:
-		return c.writer.Info(msg)
+		return 6
 	}
 }
 
-// Sync implements zapcore.Core
-func (c *SyslogCore) Sync() error {
-	return c.writer.Close()
+// failoverCore writes to primary and diverts entries to fallback whenever
+// primary fails, so log lines are not lost while syslog is down
+type failoverCore struct {
+	primary  zapcore.Core
+	fallback zapcore.Core
 }
 
-// NewSyslogLogger creates a new zap logger that writes to syslog
-func NewSyslogLogger(cfg *config.LoggingConfig) (*zap.Logger, error) {
-	// Get syslog configuration from environment
-	syslogServer := os.Getenv("SYSLOG_SERVER")
-	if syslogServer == "" {
-		syslogServer = "localhost:1514"
+// Enabled implements zapcore.Core
+func (c *failoverCore) Enabled(level zapcore.Level) bool {
+	return c.primary.Enabled(level)
+}
+
+// With implements zapcore.Core
+func (c *failoverCore) With(fields []zapcore.Field) zapcore.Core {
+	return &failoverCore{
+		primary:  c.primary.With(fields),
+		fallback: c.fallback.With(fields),
+	}
+}
+
+// Check implements zapcore.Core
+func (c *failoverCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
 	}
+	return ce
+}
 
-	syslogProtocol := os.Getenv("SYSLOG_PROTOCOL")
-	if syslogProtocol == "" {
-		syslogProtocol = "tcp"
+// Write implements zapcore.Core
+func (c *failoverCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if err := c.primary.Write(ent, fields); err != nil {
+		return c.fallback.Write(ent, fields)
 	}
+	return nil
+}
 
+// Sync implements zapcore.Core
+func (c *failoverCore) Sync() error {
+	c.primary.Sync()
+	return c.fallback.Sync()
+}
+
+// NewSyslogLogger creates a new zap logger that writes only to syslog
+func NewSyslogLogger(cfg *config.LoggingConfig) (*zap.Logger, error) {
 	// Parse log level
 	level, err := zapcore.ParseLevel(cfg.Level)
 	if err != nil {
@@ -142,7 +377,7 @@ func NewSyslogLogger(cfg *config.LoggingConfig) (*zap.Logger, error) {
 	}
 
 	// Create syslog core
-	core, err := NewSyslogCore(syslogProtocol, syslogServer, "shh-agent", level)
+	core, err := NewSyslogCore(&cfg.Syslog, level)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create syslog core: %w", err)
 	}
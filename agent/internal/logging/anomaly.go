@@ -0,0 +1,211 @@
+package logging
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AnomalyType represents the kind of rate anomaly detected
+type AnomalyType string
+
+const (
+	AnomalySpike     AnomalyType = "spike"
+	AnomalySilence   AnomalyType = "silence"
+	AnomalyRecovered AnomalyType = "recovered"
+)
+
+// AnomalyEvent is emitted when a log stream's rate departs from its baseline
+type AnomalyEvent struct {
+	Type      AnomalyType `json:"type"`
+	Source    string      `json:"source"`
+	Pattern   string      `json:"pattern,omitempty"`
+	Level     LogLevel    `json:"level"`
+	Count     int64       `json:"count"`
+	Baseline  float64     `json:"baseline"`
+	StdDev    float64     `json:"stddev"`
+	Interval  string      `json:"interval"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// AnomalyConfig represents rate anomaly detection settings
+type AnomalyConfig struct {
+	Interval         time.Duration // bucket length
+	WarmupIntervals  int           // buckets observed before alerting
+	Threshold        float64       // standard deviations above baseline for a spike
+	MinCount         int64         // minimum bucket count for a spike
+	SilenceIntervals int           // consecutive empty buckets before a silence alert
+	MinSilenceRate   float64       // minimum baseline rate for silence detection
+	Alpha            float64       // EWMA smoothing factor
+}
+
+// rateStream tracks the baseline of one source/pattern stream
+type rateStream struct {
+	source  string
+	pattern string
+	level   LogLevel
+	current int64
+	mean    float64
+	varEWMA float64
+	samples int
+	empty   int
+	silent  bool
+}
+
+// AnomalyDetector learns per source/pattern log rates and reports spikes
+// in warn/error streams and streams that go silent
+type AnomalyDetector struct {
+	logger  *zap.Logger
+	config  AnomalyConfig
+	streams map[string]*rateStream
+	events  chan<- interface{}
+	mu      sync.Mutex
+}
+
+// NewAnomalyDetector creates a detector that sends AnomalyEvent values on events
+func NewAnomalyDetector(logger *zap.Logger, config AnomalyConfig, events chan<- interface{}) *AnomalyDetector {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.WarmupIntervals <= 0 {
+		config.WarmupIntervals = 30
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = 3
+	}
+	if config.MinCount <= 0 {
+		config.MinCount = 10
+	}
+	if config.SilenceIntervals <= 0 {
+		config.SilenceIntervals = 5
+	}
+	if config.MinSilenceRate <= 0 {
+		config.MinSilenceRate = 1
+	}
+	if config.Alpha <= 0 || config.Alpha > 1 {
+		config.Alpha = 0.1
+	}
+
+	return &AnomalyDetector{
+		logger:  logger,
+		config:  config,
+		streams: make(map[string]*rateStream),
+		events:  events,
+	}
+}
+
+// Observe counts an entry towards its stream's current bucket
+func (d *AnomalyDetector) Observe(entry *LogEntry) {
+	key := entry.Source + "\x00" + entry.Pattern
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stream, ok := d.streams[key]
+	if !ok {
+		stream = &rateStream{
+			source:  entry.Source,
+			pattern: entry.Pattern,
+			level:   entry.Level,
+		}
+		d.streams[key] = stream
+	}
+	stream.current++
+}
+
+// Start begins evaluating buckets
+func (d *AnomalyDetector) Start(ctx context.Context) error {
+	go func() {
+		ticker := time.NewTicker(d.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.evaluate()
+			}
+		}
+	}()
+	return nil
+}
+
+// evaluate closes the current bucket of every stream and updates baselines
+func (d *AnomalyDetector) evaluate() {
+	d.mu.Lock()
+	var events []AnomalyEvent
+	now := time.Now()
+	for _, s := range d.streams {
+		count := s.current
+		s.current = 0
+
+		warm := s.samples >= d.config.WarmupIntervals
+		stddev := math.Sqrt(s.varEWMA)
+
+		if warm {
+			if count > 0 {
+				s.empty = 0
+				if s.silent {
+					s.silent = false
+					events = append(events, d.event(AnomalyRecovered, s, count, stddev, now))
+				}
+			} else {
+				s.empty++
+				if !s.silent && s.empty >= d.config.SilenceIntervals && s.mean >= d.config.MinSilenceRate {
+					s.silent = true
+					events = append(events, d.event(AnomalySilence, s, count, stddev, now))
+				}
+			}
+
+			if (s.level == LevelError || s.level == LevelWarn) && count >= d.config.MinCount &&
+				float64(count) > s.mean+d.config.Threshold*math.Max(stddev, 1) {
+				events = append(events, d.event(AnomalySpike, s, count, stddev, now))
+			}
+		}
+
+		// Spikes are excluded from the baseline so a sustained burst keeps alerting
+		if !warm || float64(count) <= s.mean+d.config.Threshold*math.Max(stddev, 1) {
+			diff := float64(count) - s.mean
+			s.mean += d.config.Alpha * diff
+			s.varEWMA = (1 - d.config.Alpha) * (s.varEWMA + d.config.Alpha*diff*diff)
+			s.samples++
+		}
+	}
+	d.mu.Unlock()
+
+	for _, event := range events {
+		d.logger.Warn("Log rate anomaly detected",
+			zap.String("type", string(event.Type)),
+			zap.String("source", event.Source),
+			zap.String("pattern", event.Pattern),
+			zap.Int64("count", event.Count),
+			zap.Float64("baseline", event.Baseline))
+
+		if d.events == nil {
+			continue
+		}
+		select {
+		case d.events <- event:
+		default:
+			d.logger.Warn("Failed to send anomaly event: channel full")
+		}
+	}
+}
+
+func (d *AnomalyDetector) event(t AnomalyType, s *rateStream, count int64, stddev float64, now time.Time) AnomalyEvent {
+	return AnomalyEvent{
+		Type:      t,
+		Source:    s.source,
+		Pattern:   s.pattern,
+		Level:     s.level,
+		Count:     count,
+		Baseline:  s.mean,
+		StdDev:    stddev,
+		Interval:  d.config.Interval.String(),
+		Timestamp: now,
+	}
+}
@@ -0,0 +1,165 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// grokPatterns are the built-in patterns available as %{NAME} or %{NAME:field}
+var grokPatterns = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d+)?|\.\d+)`,
+	"POSINT":            `\b[1-9]\d*\b`,
+	"IPV4":              `(?:\d{1,3}\.){3}\d{1,3}`,
+	"IPV6":              `(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}`,
+	"IP":                `%{IPV6}|%{IPV4}`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"IPORHOST":          `%{IP}|%{HOSTNAME}`,
+	"USER":              `[a-zA-Z0-9._-]+`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"PATH":              `(?:/[^\s/]*)+`,
+	"URIPATH":           `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"QS":                `"(?:[^"\\]|\\.)*"`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|severe|emerg(?:ency)?|alert)`,
+	"MONTH":             `\b(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)[a-z]*\b`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +\d{1,2} \d{2}:\d{2}:\d{2}`,
+	"HTTPDATE":          `\d{2}/%{MONTH}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+}
+
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::([\w.\-]+))?\}`)
+
+// compilePattern compiles a regular expression that may contain grok
+// references. Named references become named capture groups.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	expanded, err := expandGrok(pattern, 0)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(expanded)
+}
+
+// expandGrok replaces grok references with their regular expressions
+func expandGrok(pattern string, depth int) (string, error) {
+	if depth > 10 {
+		return "", fmt.Errorf("grok pattern nesting too deep")
+	}
+
+	var expandErr error
+	expanded := grokReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		match := grokReference.FindStringSubmatch(ref)
+		def, ok := grokPatterns[match[1]]
+		if !ok {
+			expandErr = fmt.Errorf("unknown grok pattern: %s", match[1])
+			return ref
+		}
+		inner, err := expandGrok(def, depth+1)
+		if err != nil {
+			expandErr = err
+			return ref
+		}
+		if match[2] == "" {
+			return "(?:" + inner + ")"
+		}
+		// Go group names only allow word characters
+		name := strings.NewReplacer(".", "_", "-", "_").Replace(match[2])
+		return "(?P<" + name + ">" + inner + ")"
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return expanded, nil
+}
+
+// extractFields returns the named groups of re matched against line
+func extractFields(re *regexp.Regexp, line string, into map[string]string) map[string]string {
+	match := re.FindStringSubmatch(line)
+	if match == nil {
+		return into
+	}
+	for i, name := range re.SubexpNames() {
+		if name == "" || match[i] == "" {
+			continue
+		}
+		if into == nil {
+			into = make(map[string]string)
+		}
+		into[name] = match[i]
+	}
+	return into
+}
+
+// multilineBuffer groups continuation lines, such as stack traces, with the
+// line that starts the record
+type multilineBuffer struct {
+	start    *regexp.Regexp
+	maxLines int
+	timeout  time.Duration
+	lines    []string
+	last     time.Time
+}
+
+func newMultilineBuffer(config LogConfig) (*multilineBuffer, error) {
+	if config.MultilineStart == "" {
+		return nil, nil
+	}
+
+	start, err := compilePattern(config.MultilineStart)
+	if err != nil {
+		return nil, fmt.Errorf("invalid multiline start pattern: %w", err)
+	}
+
+	buf := &multilineBuffer{
+		start:    start,
+		maxLines: config.MultilineMaxLines,
+		timeout:  config.MultilineTimeout,
+	}
+	if buf.maxLines <= 0 {
+		buf.maxLines = 500
+	}
+	if buf.timeout <= 0 {
+		buf.timeout = 2 * time.Second
+	}
+	return buf, nil
+}
+
+// add appends a line, returning a completed record when line starts a new one
+// or the record reached its line limit
+func (b *multilineBuffer) add(line string) (string, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	b.last = time.Now()
+
+	if b.start.MatchString(line) {
+		record, ok := b.flush()
+		b.lines = append(b.lines, line)
+		return record, ok
+	}
+
+	b.lines = append(b.lines, line)
+	if len(b.lines) >= b.maxLines {
+		return b.flush()
+	}
+	return "", false
+}
+
+// expired reports whether the pending record has waited longer than the timeout
+func (b *multilineBuffer) expired() bool {
+	return len(b.lines) > 0 && time.Since(b.last) > b.timeout
+}
+
+// flush returns and clears the pending record
+func (b *multilineBuffer) flush() (string, bool) {
+	if len(b.lines) == 0 {
+		return "", false
+	}
+	record := strings.Join(b.lines, "\n")
+	b.lines = b.lines[:0]
+	return record, true
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package logging
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode of a file
+func fileInode(info os.FileInfo) uint64 {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return uint64(stat.Ino)
+}
@@ -0,0 +1,252 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// JournalConfig represents a systemd journal source
+type JournalConfig struct {
+	Units       []string // systemd units to follow, empty follows everything
+	Identifiers []string // SYSLOG_IDENTIFIER values to follow
+	Priority    int      // maximum priority (0=emerg .. 7=debug), 0 means all
+	Matches     []string // additional FIELD=value journal matches
+}
+
+// journalSource represents a followed journal stream
+type journalSource struct {
+	config JournalConfig
+	cursor string
+	saved  time.Time // when the cursor was last saved
+	done   chan struct{}
+}
+
+// AddJournal adds a systemd journal source. Entries are read through
+// journalctl so the agent does not need libsystemd.
+func (m *Manager) AddJournal(name string, config JournalConfig) error {
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return fmt.Errorf("journalctl not available: %w", err)
+	}
+	for _, match := range config.Matches {
+		if !strings.Contains(match, "=") {
+			return fmt.Errorf("invalid journal match %q: expected FIELD=value", match)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.journals == nil {
+		m.journals = make(map[string]*journalSource)
+	}
+	if _, exists := m.journals[name]; exists {
+		return fmt.Errorf("journal source already monitored: %s", name)
+	}
+
+	m.journals[name] = &journalSource{
+		config: config,
+		done:   make(chan struct{}),
+	}
+	return nil
+}
+
+// RemoveJournal stops following a journal source
+func (m *Manager) RemoveJournal(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	journal, exists := m.journals[name]
+	if !exists {
+		return fmt.Errorf("journal source not monitored: %s", name)
+	}
+
+	close(journal.done)
+	delete(m.journals, name)
+	return nil
+}
+
+// monitorJournal follows a journal source, restarting journalctl from the
+// last cursor if it exits. A cursor saved by an earlier run is resumed
+// from, so entries written while the agent was down are read too.
+func (m *Manager) monitorJournal(ctx context.Context, name string, journal *journalSource) {
+	if pos, ok := m.position(journalKey(name)); ok && journal.cursor == "" {
+		journal.cursor = pos.Cursor
+	}
+	defer func() {
+		if journal.cursor != "" {
+			m.savePosition(journalKey(name), logPosition{Cursor: journal.cursor})
+		}
+	}()
+
+	for {
+		if err := m.followJournal(ctx, name, journal); err != nil {
+			m.logger.Error("Journal reader failed",
+				zap.String("journal", name),
+				zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-journal.done:
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// followJournal runs journalctl until it exits or the source is stopped
+func (m *Manager) followJournal(ctx context.Context, name string, journal *journalSource) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-journal.done:
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	args := []string{"--follow", "--output=json", "--no-pager"}
+	if journal.cursor != "" {
+		args = append(args, "--after-cursor="+journal.cursor)
+	} else {
+		args = append(args, "--lines=0")
+	}
+	for _, unit := range journal.config.Units {
+		args = append(args, "--unit="+unit)
+	}
+	for _, id := range journal.config.Identifiers {
+		args = append(args, "--identifier="+id)
+	}
+	if journal.config.Priority > 0 {
+		args = append(args, "--priority="+strconv.Itoa(journal.config.Priority))
+	}
+	args = append(args, journal.config.Matches...)
+
+	cmd := exec.CommandContext(runCtx, "journalctl", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start journalctl: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			m.logger.Debug("Failed to parse journal record", zap.Error(err))
+			continue
+		}
+
+		m.handleJournalRecord(name, record)
+		if cursor, ok := record["__CURSOR"].(string); ok {
+			journal.cursor = cursor
+			if time.Since(journal.saved) >= positionSaveInterval {
+				m.savePosition(journalKey(name), logPosition{Cursor: cursor})
+				journal.saved = time.Now()
+			}
+		}
+	}
+
+	if err := cmd.Wait(); err != nil && runCtx.Err() == nil {
+		return fmt.Errorf("journalctl exited: %w", err)
+	}
+	return nil
+}
+
+// handleJournalRecord converts a journal record to a LogEntry and forwards it
+func (m *Manager) handleJournalRecord(name string, record map[string]interface{}) {
+	message := m.redact(journalString(record["MESSAGE"]))
+	if message == "" {
+		return
+	}
+
+	source := "journald:" + name
+	if unit := journalString(record["_SYSTEMD_UNIT"]); unit != "" {
+		source = "journald:" + unit
+	}
+
+	fields := make(map[string]string)
+	for _, key := range []string{"_SYSTEMD_UNIT", "SYSLOG_IDENTIFIER", "_PID", "_HOSTNAME", "_COMM", "PRIORITY"} {
+		if value := journalString(record[key]); value != "" {
+			fields[strings.ToLower(strings.TrimPrefix(key, "_"))] = value
+		}
+	}
+
+	timestamp := time.Now()
+	if usec, err := strconv.ParseInt(journalString(record["__REALTIME_TIMESTAMP"]), 10, 64); err == nil {
+		timestamp = time.UnixMicro(usec)
+	}
+
+	entry := m.parseLine(message, source)
+	if entry != nil {
+		entry.Timestamp = timestamp
+		for k, v := range fields {
+			if _, exists := entry.Fields[k]; !exists {
+				if entry.Fields == nil {
+					entry.Fields = make(map[string]string)
+				}
+				entry.Fields[k] = v
+			}
+		}
+		m.processEntry(entry)
+		return
+	}
+
+	m.processUnmatched(&LogEntry{
+		Timestamp: timestamp,
+		Level:     journalLevel(fields["priority"]),
+		Message:   message,
+		Source:    source,
+		Fields:    fields,
+	})
+}
+
+// journalString returns a journal field as a string. journalctl encodes
+// non-UTF-8 values as byte arrays.
+func journalString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case []interface{}:
+		b := make([]byte, 0, len(value))
+		for _, c := range value {
+			if f, ok := c.(float64); ok {
+				b = append(b, byte(f))
+			}
+		}
+		return string(b)
+	default:
+		return ""
+	}
+}
+
+// journalLevel maps a syslog priority to a LogLevel
+func journalLevel(priority string) LogLevel {
+	p, err := strconv.Atoi(priority)
+	if err != nil {
+		return LevelInfo
+	}
+	switch {
+	case p <= 3:
+		return LevelError
+	case p == 4:
+		return LevelWarn
+	case p == 7:
+		return LevelDebug
+	default:
+		return LevelInfo
+	}
+}
@@ -1,11 +1,9 @@
 package logging
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -13,9 +11,10 @@ import (
 	"sync"
 	"time"
 
-	"github.com/klauspost/compress/gzip"
 	"go.uber.org/zap"
 	"gopkg.in/natefinch/lumberjack.v2"
+
+	"shh/agent/internal/store"
 )
 
 // LogLevel represents log severity level
@@ -28,7 +27,8 @@ const (
 	LevelError LogLevel = "error"
 )
 
-// LogPattern represents a log pattern to match
+// LogPattern represents a log pattern to match. Patterns may use grok
+// references such as %{IP:client}; named groups are extracted as fields.
 type LogPattern struct {
 	Pattern     string
 	Level       LogLevel
@@ -41,16 +41,23 @@ type LogConfig struct {
 	MaxAge     int  // days
 	MaxBackups int  // number of backups
 	Compress   bool // compress old files
+
+	// MultilineStart matches the first line of a record; following lines
+	// that do not match are appended to it (e.g. stack traces)
+	MultilineStart    string
+	MultilineMaxLines int
+	MultilineTimeout  time.Duration
 }
 
 // LogEntry represents a parsed log entry
 type LogEntry struct {
-	Timestamp   time.Time
-	Level       LogLevel
-	Message     string
-	Source      string
-	Pattern     string
-	Description string
+	Timestamp   time.Time         `json:"timestamp"`
+	Level       LogLevel          `json:"level"`
+	Message     string            `json:"message"`
+	Source      string            `json:"source"`
+	Pattern     string            `json:"pattern,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
 }
 
 // Manager manages log files and patterns
@@ -59,22 +66,34 @@ type Manager struct {
 	mu       sync.RWMutex
 	files    map[string]*logFile
 	patterns []LogPattern
+	compiled map[string]*regexp.Regexp
+	extract  []*regexp.Regexp
 	config   LogConfig
+	journals map[string]*journalSource
+	shipper  *Shipper
+	shipAll  bool
+	detector *AnomalyDetector
+	redactor *Redactor
+	events   chan<- interface{}
+	// positions keeps where reading of each source stopped
+	positions *store.Bucket[logPosition]
 }
 
 // logFile represents a monitored log file
 type logFile struct {
-	path   string
-	config LogConfig
-	writer *lumberjack.Logger
-	done   chan struct{}
+	path      string
+	config    LogConfig
+	writer    *lumberjack.Logger
+	multiline *multilineBuffer
+	done      chan struct{}
 }
 
 // NewManager creates a new log manager
 func NewManager(logger *zap.Logger) *Manager {
 	return &Manager{
-		logger: logger,
-		files:  make(map[string]*logFile),
+		logger:   logger,
+		files:    make(map[string]*logFile),
+		compiled: make(map[string]*regexp.Regexp),
 	}
 }
 
@@ -93,6 +112,11 @@ func (m *Manager) AddLogFile(path string, config LogConfig) error {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
+	multiline, err := newMultilineBuffer(config)
+	if err != nil {
+		return err
+	}
+
 	// Configure log rotation
 	writer := &lumberjack.Logger{
 		Filename:   path,
@@ -103,10 +127,11 @@ func (m *Manager) AddLogFile(path string, config LogConfig) error {
 	}
 
 	m.files[path] = &logFile{
-		path:   path,
-		config: config,
-		writer: writer,
-		done:   make(chan struct{}),
+		path:      path,
+		config:    config,
+		writer:    writer,
+		multiline: multiline,
+		done:      make(chan struct{}),
 	}
 
 	return nil
@@ -129,11 +154,43 @@ func (m *Manager) RemoveLogFile(path string) error {
 }
 
 // AddPattern adds a log pattern to match
-func (m *Manager) AddPattern(pattern LogPattern) {
+func (m *Manager) AddPattern(pattern LogPattern) error {
+	re, err := compilePattern(pattern.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid log pattern %q: %w", pattern.Pattern, err)
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	m.patterns = append(m.patterns, pattern)
+	m.compiled[pattern.Pattern] = re
+	return nil
+}
+
+// AddExtractor adds a pattern whose named groups are extracted as fields
+// from every processed entry, whether or not it matched a LogPattern
+func (m *Manager) AddExtractor(pattern string) error {
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid extractor %q: %w", pattern, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.extract = append(m.extract, re)
+	return nil
+}
+
+// SetShipper forwards processed entries to the given shipper. When shipAll
+// is set, lines that match no pattern are shipped too at info level.
+func (m *Manager) SetShipper(shipper *Shipper, shipAll bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.shipper = shipper
+	m.shipAll = shipAll
 }
 
 // Start starts log monitoring
@@ -143,6 +200,10 @@ func (m *Manager) Start(ctx context.Context) error {
 	for _, file := range m.files {
 		files = append(files, file)
 	}
+	journals := make(map[string]*journalSource, len(m.journals))
+	for name, journal := range m.journals {
+		journals[name] = journal
+	}
 	m.mu.RUnlock()
 
 	// Monitor each file
@@ -150,29 +211,61 @@ func (m *Manager) Start(ctx context.Context) error {
 		go m.monitorFile(ctx, file)
 	}
 
+	// Follow each journal source
+	for name, journal := range journals {
+		go m.monitorJournal(ctx, name, journal)
+	}
+
 	return nil
 }
 
-// monitorFile monitors a single log file
+// monitorFile monitors a single log file, following it across rotation and
+// truncation. A file that does not exist yet is waited for. Reading resumes
+// at the offset saved by an earlier run, if any.
 func (m *Manager) monitorFile(ctx context.Context, file *logFile) {
-	f, err := os.Open(file.path)
-	if err != nil {
-		m.logger.Error("Failed to open log file",
-			zap.String("path", file.path),
-			zap.Error(err))
-		return
+	saved, resume := m.position(fileKey(file.path))
+	var t *tailer
+	seekEnd := !resume
+	for t == nil {
+		var err error
+		t, err = openTailer(file.path, seekEnd)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				m.logger.Error("Failed to open log file",
+					zap.String("path", file.path),
+					zap.Error(err))
+				return
+			}
+			// Anything written to a file created after start is new
+			seekEnd = false
+			resume = false
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-file.done:
+				return
+			case <-time.After(time.Second):
+			}
+		}
 	}
-	defer f.Close()
-
-	// Seek to end of file
-	if _, err := f.Seek(0, 2); err != nil {
-		m.logger.Error("Failed to seek log file",
-			zap.String("path", file.path),
-			zap.Error(err))
-		return
+	defer t.close()
+	if resume {
+		if err := t.resume(saved); err != nil {
+			m.logger.Error("Failed to resume log file",
+				zap.String("path", file.path),
+				zap.Error(err))
+			return
+		}
 	}
 
-	reader := bufio.NewReader(f)
+	// Save where reading stopped now and then, and when it stops
+	var lastSaved time.Time
+	save := func() {
+		m.savePosition(fileKey(file.path), t.position())
+		lastSaved = time.Now()
+	}
+	defer save()
 
 	for {
 		select {
@@ -181,21 +274,57 @@ func (m *Manager) monitorFile(ctx context.Context, file *logFile) {
 		case <-file.done:
 			return
 		default:
-			line, err := reader.ReadString('\n')
+			if time.Since(lastSaved) >= positionSaveInterval {
+				save()
+			}
+			line, err := t.readLine()
 			if err != nil {
+				if err != io.EOF {
+					m.logger.Error("Failed to read log file",
+						zap.String("path", file.path),
+						zap.Error(err))
+				}
+				// Emit a pending multiline record once no continuation follows
+				if file.multiline != nil && file.multiline.expired() {
+					if record, ok := file.multiline.flush(); ok {
+						m.handleLine(record, file.path)
+					}
+				}
 				time.Sleep(100 * time.Millisecond)
 				continue
 			}
 
-			// Parse and match patterns
-			entry := m.parseLine(line, file.path)
-			if entry != nil {
-				m.processEntry(entry)
+			if file.multiline != nil {
+				if record, ok := file.multiline.add(line); ok {
+					m.handleLine(record, file.path)
+				}
+				continue
 			}
+
+			m.handleLine(line, file.path)
 		}
 	}
 }
 
+// handleLine parses a complete log record and forwards it
+func (m *Manager) handleLine(line, source string) {
+	line = m.redact(line)
+
+	// Parse and match patterns
+	entry := m.parseLine(line, source)
+	if entry != nil {
+		m.processEntry(entry)
+		return
+	}
+
+	m.processUnmatched(&LogEntry{
+		Timestamp: time.Now(),
+		Level:     LevelInfo,
+		Message:   strings.TrimRight(line, "\r\n"),
+		Source:    source,
+	})
+}
+
 // parseLine parses a log line into a LogEntry
 func (m *Manager) parseLine(line, source string) *LogEntry {
 	m.mu.RLock()
@@ -203,8 +332,13 @@ func (m *Manager) parseLine(line, source string) *LogEntry {
 	copy(patterns, m.patterns)
 	m.mu.RUnlock()
 
+	line = strings.TrimRight(line, "\r\n")
 	for _, pattern := range patterns {
-		if matched, _ := regexp.MatchString(pattern.Pattern, line); matched {
+		m.mu.RLock()
+		re := m.compiled[pattern.Pattern]
+		m.mu.RUnlock()
+
+		if re != nil && re.MatchString(line) {
 			return &LogEntry{
 				Timestamp:   time.Now(),
 				Level:       pattern.Level,
@@ -212,6 +346,7 @@ func (m *Manager) parseLine(line, source string) *LogEntry {
 				Source:      source,
 				Pattern:     pattern.Pattern,
 				Description: pattern.Description,
+				Fields:      m.extractFields(line, extractFields(re, line, nil)),
 			}
 		}
 	}
@@ -219,6 +354,18 @@ func (m *Manager) parseLine(line, source string) *LogEntry {
 	return nil
 }
 
+// extractFields applies the configured extractors to line
+func (m *Manager) extractFields(line string, fields map[string]string) map[string]string {
+	m.mu.RLock()
+	extractors := m.extract
+	m.mu.RUnlock()
+
+	for _, re := range extractors {
+		fields = extractFields(re, line, fields)
+	}
+	return fields
+}
+
 // processEntry processes a matched log entry
 func (m *Manager) processEntry(entry *LogEntry) {
 	// Log the entry
@@ -228,6 +375,101 @@ func (m *Manager) processEntry(entry *LogEntry) {
 		zap.String("level", string(entry.Level)),
 		zap.String("description", entry.Description),
 		zap.String("message", entry.Message))
+
+	if detector := m.anomalyDetector(); detector != nil {
+		detector.Observe(entry)
+	}
+
+	if shipper, _ := m.shipperConfig(); shipper != nil {
+		shipper.Enqueue(entry)
+	}
+
+	m.mu.RLock()
+	events := m.events
+	m.mu.RUnlock()
+	if events != nil {
+		select {
+		case events <- *entry:
+		default:
+			m.logger.Warn("Failed to send log match event: channel full")
+		}
+	}
+}
+
+// processUnmatched handles an entry that matched no pattern. It still counts
+// towards its source's rate and is shipped when shipping all lines.
+func (m *Manager) processUnmatched(entry *LogEntry) {
+	if detector := m.anomalyDetector(); detector != nil {
+		detector.Observe(entry)
+	}
+
+	if shipper, all := m.shipperConfig(); shipper != nil && all {
+		entry.Fields = m.extractFields(entry.Message, entry.Fields)
+		shipper.Enqueue(entry)
+	}
+}
+
+// SetEvents sends entries matching a pattern to events
+func (m *Manager) SetEvents(events chan<- interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = events
+}
+
+// SetRedactor masks sensitive data in lines before they are matched,
+// stored or shipped
+func (m *Manager) SetRedactor(redactor *Redactor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.redactor = redactor
+}
+
+// RedactionStats returns the number of matches masked per redaction rule
+func (m *Manager) RedactionStats() map[string]int64 {
+	m.mu.RLock()
+	redactor := m.redactor
+	m.mu.RUnlock()
+
+	if redactor == nil {
+		return nil
+	}
+	return redactor.Stats()
+}
+
+// redact applies the configured redactor to line
+func (m *Manager) redact(line string) string {
+	m.mu.RLock()
+	redactor := m.redactor
+	m.mu.RUnlock()
+
+	if redactor == nil {
+		return line
+	}
+	return redactor.Redact(line)
+}
+
+// SetAnomalyDetector feeds every processed entry to the given detector
+func (m *Manager) SetAnomalyDetector(detector *AnomalyDetector) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.detector = detector
+}
+
+// anomalyDetector returns the configured anomaly detector
+func (m *Manager) anomalyDetector() *AnomalyDetector {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.detector
+}
+
+// shipperConfig returns the configured shipper and whether to ship all lines
+func (m *Manager) shipperConfig() (*Shipper, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.shipper, m.shipAll
 }
 
 // GetEntries returns log entries matching filters
@@ -244,10 +486,16 @@ func (m *Manager) Write(p []byte) (n int, err error) {
 	for _, file := range m.files {
 		files = append(files, file)
 	}
+	redactor := m.redactor
 	m.mu.RUnlock()
 
+	data := p
+	if redactor != nil {
+		data = []byte(redactor.Redact(string(p)))
+	}
+
 	for _, file := range files {
-		if _, err := file.writer.Write(p); err != nil {
+		if _, err := file.writer.Write(data); err != nil {
 			m.logger.Error("Failed to write to log file",
 				zap.String("path", file.path),
 				zap.Error(err))
@@ -271,48 +519,58 @@ func (m *Manager) Close() error {
 		}
 	}
 
+	for name, journal := range m.journals {
+		close(journal.done)
+		delete(m.journals, name)
+	}
+
 	return nil
 }
 
-// RotateLogs rotates log files based on size and age
+// RotateLogs rotates the monitored log files that exceed their size limit
+// or were last written longer ago than their maximum age. Their writers
+// compress the rotated files and remove the old ones.
 func (m *Manager) RotateLogs(ctx context.Context) error {
 	m.logger.Info("Starting log rotation")
 
-	// Get list of log files
-	files, err := m.getLogFiles()
-	if err != nil {
-		return fmt.Errorf("failed to get log files: %w", err)
+	m.mu.RLock()
+	files := make([]*logFile, 0, len(m.files))
+	for _, file := range m.files {
+		files = append(files, file)
 	}
+	m.mu.RUnlock()
 
 	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// Check if rotation is needed
-		needsRotation, err := m.needsRotation(file)
+		info, err := os.Stat(file.path)
+		if os.IsNotExist(err) {
+			continue
+		}
 		if err != nil {
 			m.logger.Error("Failed to check rotation status",
-				zap.String("file", file.Name()),
+				zap.String("file", file.path),
 				zap.Error(err))
 			continue
 		}
 
-		if !needsRotation {
+		if !needsRotation(info, file.config) {
 			continue
 		}
 
 		// Rotate the log file
-		if err := m.rotateFile(file); err != nil {
+		if err := file.writer.Rotate(); err != nil {
 			m.logger.Error("Failed to rotate log file",
-				zap.String("file", file.Name()),
+				zap.String("file", file.path),
 				zap.Error(err))
 			continue
 		}
 
 		m.logger.Info("Successfully rotated log file",
-			zap.String("file", file.Name()))
-	}
-
-	// Clean up old rotated logs
-	if err := m.cleanupOldLogs(); err != nil {
-		m.logger.Error("Failed to clean up old logs", zap.Error(err))
+			zap.String("file", file.path))
 	}
 
 	return nil
@@ -320,112 +578,17 @@ func (m *Manager) RotateLogs(ctx context.Context) error {
 
 // Private helper methods
 
-func (m *Manager) getLogFiles() ([]os.FileInfo, error) {
-	return ioutil.ReadDir(m.config.LogDir)
-}
-
-func (m *Manager) needsRotation(file os.FileInfo) (bool, error) {
+func needsRotation(file os.FileInfo, config LogConfig) bool {
 	// Check file age
 	age := time.Since(file.ModTime())
-	if age > m.config.MaxAge {
-		return true, nil
+	if config.MaxAge > 0 && age > time.Duration(config.MaxAge)*24*time.Hour {
+		return true
 	}
 
 	// Check file size
-	if file.Size() > m.config.MaxSize {
-		return true, nil
-	}
-
-	return false, nil
-}
-
-func (m *Manager) rotateFile(file os.FileInfo) error {
-	oldPath := filepath.Join(m.config.LogDir, file.Name())
-	newPath := filepath.Join(m.config.LogDir, fmt.Sprintf("%s.%s",
-		file.Name(),
-		time.Now().Format("2006-01-02-15-04-05")))
-
-	// Rename current log file
-	if err := os.Rename(oldPath, newPath); err != nil {
-		return fmt.Errorf("failed to rename log file: %w", err)
-	}
-
-	// Create new empty log file
-	if err := m.createEmptyLogFile(oldPath); err != nil {
-		return fmt.Errorf("failed to create new log file: %w", err)
-	}
-
-	// Compress rotated log file
-	if err := m.compressLogFile(newPath); err != nil {
-		m.logger.Error("Failed to compress rotated log file",
-			zap.String("file", newPath),
-			zap.Error(err))
-	}
-
-	return nil
-}
-
-func (m *Manager) createEmptyLogFile(path string) error {
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	return file.Close()
-}
-
-func (m *Manager) compressLogFile(path string) error {
-	// Open the log file
-	input, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer input.Close()
-
-	// Create compressed file
-	output, err := os.Create(path + ".gz")
-	if err != nil {
-		return err
+	if config.MaxSize > 0 && file.Size() > int64(config.MaxSize)*1024*1024 {
+		return true
 	}
-	defer output.Close()
 
-	// Create gzip writer
-	gw := gzip.NewWriter(output)
-	defer gw.Close()
-
-	// Copy content
-	if _, err := io.Copy(gw, input); err != nil {
-		return err
-	}
-
-	// Remove original file after compression
-	return os.Remove(path)
-}
-
-func (m *Manager) cleanupOldLogs() error {
-	files, err := m.getLogFiles()
-	if err != nil {
-		return err
-	}
-
-	for _, file := range files {
-		// Skip if not a rotated log file
-		if !strings.HasSuffix(file.Name(), ".gz") {
-			continue
-		}
-
-		age := time.Since(file.ModTime())
-		if age > m.config.RetentionPeriod {
-			path := filepath.Join(m.config.LogDir, file.Name())
-			if err := os.Remove(path); err != nil {
-				m.logger.Error("Failed to remove old log file",
-					zap.String("file", file.Name()),
-					zap.Error(err))
-				continue
-			}
-			m.logger.Info("Removed old log file",
-				zap.String("file", file.Name()))
-		}
-	}
-
-	return nil
+	return false
 }
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/store"
+)
+
+// positionSaveInterval is how often a source being read saves its position
+const positionSaveInterval = 5 * time.Second
+
+// logPosition is where reading of a log source stopped: the cursor of a
+// journal source, or the inode and offset of a file
+type logPosition struct {
+	Cursor string `json:"cursor,omitempty"`
+	Inode  uint64 `json:"inode,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+}
+
+// SetStore keeps the read positions of the log sources in s, so that
+// restarts resume reading where it stopped. It must be called before
+// Start.
+func (m *Manager) SetStore(s *store.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.positions = store.NewBucket[logPosition](s, store.BucketLogPositions)
+}
+
+// position returns the saved position of a source
+func (m *Manager) position(key string) (logPosition, bool) {
+	m.mu.RLock()
+	positions := m.positions
+	m.mu.RUnlock()
+	if positions == nil {
+		return logPosition{}, false
+	}
+	pos, ok, err := positions.Get(key)
+	if err != nil {
+		m.logger.Warn("Failed to load log position", zap.String("source", key), zap.Error(err))
+		return logPosition{}, false
+	}
+	return pos, ok
+}
+
+// savePosition saves the position of a source
+func (m *Manager) savePosition(key string, pos logPosition) {
+	m.mu.RLock()
+	positions := m.positions
+	m.mu.RUnlock()
+	if positions == nil {
+		return
+	}
+	if err := positions.Put(key, pos); err != nil {
+		m.logger.Warn("Failed to save log position", zap.String("source", key), zap.Error(err))
+	}
+}
+
+// fileKey is the position key of a log file
+func fileKey(path string) string {
+	return "file:" + path
+}
+
+// journalKey is the position key of a journal source
+func journalKey(name string) string {
+	return "journal:" + name
+}
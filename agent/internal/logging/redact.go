@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+// RedactionRule represents a pattern masked out of log lines
+type RedactionRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement,omitempty"` // defaults to [REDACTED:<name>]
+	Luhn        bool   `json:"luhn,omitempty"`        // only mask matches passing the Luhn checksum
+}
+
+// DefaultRedactionRules returns rules for common secrets and personal data
+func DefaultRedactionRules() []RedactionRule {
+	return []RedactionRule{
+		{Name: "bearer_token", Pattern: `(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`},
+		{Name: "jwt", Pattern: `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+		{Name: "aws_access_key", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+		{Name: "private_key", Pattern: `-----BEGIN [A-Z ]*PRIVATE KEY-----`},
+		{Name: "credential", Pattern: `(?i)\b(password|passwd|pwd|secret|token|api[_-]?key)(["']?\s*[:=]\s*["']?)[^\s"',;&]+`, Replacement: "${1}${2}[REDACTED]"},
+		{Name: "email", Pattern: `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`},
+		{Name: "ipv4", Pattern: `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`},
+		{Name: "credit_card", Pattern: `\b(?:\d[ -]?){12,18}\d\b`, Luhn: true},
+	}
+}
+
+// compiledRule is a RedactionRule ready for matching
+type compiledRule struct {
+	rule  RedactionRule
+	re    *regexp.Regexp
+	count atomic.Int64
+}
+
+// Redactor masks sensitive data in log lines and counts masked matches per rule
+type Redactor struct {
+	rules []*compiledRule
+}
+
+// NewRedactor compiles the given rules
+func NewRedactor(rules []RedactionRule) (*Redactor, error) {
+	r := &Redactor{}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction rule %s: %w", rule.Name, err)
+		}
+		if rule.Replacement == "" {
+			rule.Replacement = "[REDACTED:" + rule.Name + "]"
+		}
+		r.rules = append(r.rules, &compiledRule{rule: rule, re: re})
+	}
+	return r, nil
+}
+
+// Redact returns line with every rule applied
+func (r *Redactor) Redact(line string) string {
+	for _, c := range r.rules {
+		if !c.re.MatchString(line) {
+			continue
+		}
+
+		if c.rule.Luhn {
+			line = c.re.ReplaceAllStringFunc(line, func(match string) string {
+				if !luhnValid(match) {
+					return match
+				}
+				c.count.Add(1)
+				return c.rule.Replacement
+			})
+			continue
+		}
+
+		n := int64(len(c.re.FindAllStringIndex(line, -1)))
+		c.count.Add(n)
+		line = c.re.ReplaceAllString(line, c.rule.Replacement)
+	}
+	return line
+}
+
+// Stats returns the number of matches masked by each rule
+func (r *Redactor) Stats() map[string]int64 {
+	stats := make(map[string]int64, len(r.rules))
+	for _, c := range r.rules {
+		stats[c.rule.Name] = c.count.Load()
+	}
+	return stats
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum
+func luhnValid(s string) bool {
+	var sum, digits int
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		digits++
+	}
+	return digits >= 13 && sum%10 == 0
+}
@@ -0,0 +1,346 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Sink receives batches of log entries from the shipper
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, entries []LogEntry) error
+	Close() error
+}
+
+// ShipperConfig represents log shipping configuration
+type ShipperConfig struct {
+	BatchSize      int           // entries per batch
+	FlushInterval  time.Duration // maximum time an entry waits before sending
+	QueueSize      int           // in-memory queue capacity
+	BufferDir      string        // directory for the disk buffer, empty disables it
+	MaxBufferBytes int64         // disk buffer size limit
+	RetryInterval  time.Duration // how often buffered entries are retried
+}
+
+// Shipper batches log entries and forwards them to sinks. When the in-memory
+// queue is full or a sink fails, entries are spooled to disk and replayed
+// once the sinks recover; entries are dropped only when the disk buffer is
+// full or disabled. Every sink has a spool of its own, so entries are
+// replayed only to the sinks that missed them.
+type Shipper struct {
+	logger  *zap.Logger
+	config  ShipperConfig
+	sinks   []Sink
+	spools  []string // spool file of each sink
+	queue   chan *LogEntry
+	dropped atomic.Int64
+	spoolMu sync.Mutex
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewShipper creates a new log shipper
+func NewShipper(logger *zap.Logger, config ShipperConfig, sinks ...Sink) (*Shipper, error) {
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("at least one sink is required")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 5 * time.Second
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 10000
+	}
+	if config.MaxBufferBytes <= 0 {
+		config.MaxBufferBytes = 100 * 1024 * 1024
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = 30 * time.Second
+	}
+
+	if config.BufferDir != "" {
+		if err := os.MkdirAll(config.BufferDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create buffer directory: %w", err)
+		}
+	}
+
+	return &Shipper{
+		logger: logger,
+		config: config,
+		sinks:  sinks,
+		spools: spoolFiles(sinks),
+		queue:  make(chan *LogEntry, config.QueueSize),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// spoolFiles names the spool of each sink after the sink, numbering sinks
+// that share a name
+func spoolFiles(sinks []Sink) []string {
+	files := make([]string, len(sinks))
+	seen := make(map[string]int)
+	for i, sink := range sinks {
+		name := sink.Name()
+		seen[name]++
+		if n := seen[name]; n > 1 {
+			name = fmt.Sprintf("%s-%d", name, n)
+		}
+		files[i] = "spool-" + name + ".jsonl"
+	}
+	return files
+}
+
+// Enqueue queues an entry for shipping without blocking the caller
+func (s *Shipper) Enqueue(entry *LogEntry) {
+	select {
+	case s.queue <- entry:
+	default:
+		// Queue is full, apply backpressure by spilling to disk
+		s.spoolAll([]LogEntry{*entry})
+	}
+}
+
+// Dropped returns the number of entries discarded since start
+func (s *Shipper) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Start begins batching and shipping entries
+func (s *Shipper) Start(ctx context.Context) error {
+	s.wg.Add(1)
+	go s.run(ctx)
+	return nil
+}
+
+// Shutdown flushes queued entries and closes all sinks
+func (s *Shipper) Shutdown(ctx context.Context) error {
+	close(s.done)
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, sink := range s.sinks {
+		if err := sink.Close(); err != nil {
+			s.logger.Error("Failed to close log sink",
+				zap.String("sink", sink.Name()),
+				zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// run collects entries into batches and sends them
+func (s *Shipper) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	flush := time.NewTicker(s.config.FlushInterval)
+	defer flush.Stop()
+	retry := time.NewTicker(s.config.RetryInterval)
+	defer retry.Stop()
+
+	batch := make([]LogEntry, 0, s.config.BatchSize)
+	send := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		s.send(ctx, batch)
+		batch = make([]LogEntry, 0, s.config.BatchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.drain(&batch)
+			s.spoolAll(batch)
+			return
+		case <-s.done:
+			s.drain(&batch)
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			send(flushCtx)
+			cancel()
+			return
+		case entry := <-s.queue:
+			batch = append(batch, *entry)
+			if len(batch) >= s.config.BatchSize {
+				send(ctx)
+			}
+		case <-flush.C:
+			send(ctx)
+		case <-retry.C:
+			for i := range s.sinks {
+				s.replay(ctx, i)
+			}
+		}
+	}
+}
+
+// drain moves all queued entries into the batch
+func (s *Shipper) drain(batch *[]LogEntry) {
+	for {
+		select {
+		case entry := <-s.queue:
+			*batch = append(*batch, *entry)
+		default:
+			return
+		}
+	}
+}
+
+// send delivers a batch to every sink, spooling it for the sinks that
+// fail
+func (s *Shipper) send(ctx context.Context, batch []LogEntry) {
+	for i := range s.sinks {
+		if err := s.sendTo(ctx, i, batch); err != nil {
+			s.spool(i, batch)
+		}
+	}
+}
+
+// sendTo delivers a batch to the sink at index i
+func (s *Shipper) sendTo(ctx context.Context, i int, batch []LogEntry) error {
+	sink := s.sinks[i]
+	err := sink.Send(ctx, batch)
+	if err != nil {
+		s.logger.Warn("Failed to ship logs",
+			zap.String("sink", sink.Name()),
+			zap.Int("entries", len(batch)),
+			zap.Error(err))
+	}
+	return err
+}
+
+// spoolAll appends entries to the disk buffer of every sink
+func (s *Shipper) spoolAll(entries []LogEntry) {
+	for i := range s.sinks {
+		s.spool(i, entries)
+	}
+}
+
+// spool appends entries to the disk buffer of the sink at index i
+func (s *Shipper) spool(i int, entries []LogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	if s.config.BufferDir == "" {
+		s.dropped.Add(int64(len(entries)))
+		return
+	}
+
+	s.spoolMu.Lock()
+	defer s.spoolMu.Unlock()
+
+	path := filepath.Join(s.config.BufferDir, s.spools[i])
+	if info, err := os.Stat(path); err == nil && info.Size() >= s.config.MaxBufferBytes {
+		s.dropped.Add(int64(len(entries)))
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		s.logger.Error("Failed to open log buffer", zap.String("sink", s.sinks[i].Name()), zap.Error(err))
+		s.dropped.Add(int64(len(entries)))
+		return
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			s.dropped.Add(1)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		s.logger.Error("Failed to write log buffer", zap.Error(err))
+	}
+}
+
+// replay resends the entries spooled for the sink at index i, removing its
+// buffer once all are delivered
+func (s *Shipper) replay(ctx context.Context, i int) {
+	if s.config.BufferDir == "" {
+		return
+	}
+
+	s.spoolMu.Lock()
+	defer s.spoolMu.Unlock()
+
+	path := filepath.Join(s.config.BufferDir, s.spools[i])
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+
+	var pending []LogEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		pending = append(pending, entry)
+	}
+	f.Close()
+
+	for start := 0; start < len(pending); start += s.config.BatchSize {
+		end := start + s.config.BatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		if err := s.sendTo(ctx, i, pending[start:end]); err != nil {
+			// Keep what has not been delivered for the next retry
+			s.rewriteSpool(path, pending[start:])
+			return
+		}
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		s.logger.Error("Failed to remove log buffer", zap.Error(err))
+	}
+	s.logger.Info("Replayed buffered log entries",
+		zap.String("sink", s.sinks[i].Name()),
+		zap.Int("entries", len(pending)))
+}
+
+// rewriteSpool replaces the buffer contents with the given entries
+func (s *Shipper) rewriteSpool(path string, entries []LogEntry) {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		s.logger.Error("Failed to rewrite log buffer", zap.Error(err))
+		return
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range entries {
+		enc.Encode(&entries[i])
+	}
+	w.Flush()
+	f.Close()
+
+	if err := os.Rename(tmp, path); err != nil {
+		s.logger.Error("Failed to rewrite log buffer", zap.Error(err))
+	}
+}
@@ -0,0 +1,162 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// flakySink refuses every batch after the first accept ones while failing
+// is set
+type flakySink struct {
+	failing bool
+	accept  int
+	got     []LogEntry
+}
+
+func (s *flakySink) Name() string { return "flaky" }
+
+func (s *flakySink) Send(ctx context.Context, entries []LogEntry) error {
+	if s.failing {
+		if s.accept == 0 {
+			return errors.New("sink unavailable")
+		}
+		s.accept--
+	}
+	s.got = append(s.got, entries...)
+	return nil
+}
+
+func (s *flakySink) Close() error { return nil }
+
+func entries(messages ...string) []LogEntry {
+	out := make([]LogEntry, len(messages))
+	for i, m := range messages {
+		out[i] = LogEntry{Message: m, Source: "/var/log/app.log", Level: LevelError}
+	}
+	return out
+}
+
+func TestShipperSpoolAndReplay(t *testing.T) {
+	tests := []struct {
+		name      string
+		buffered  bool
+		accept    int  // batches the sink takes on replay before failing again
+		recovered bool // whether the sink works again on replay
+		delivered []string
+		spooled   []string // left in the spool after replay
+		dropped   int64
+	}{
+		{
+			name:      "replayed once the sink recovers",
+			buffered:  true,
+			recovered: true,
+			delivered: []string{"a", "b", "c"},
+		},
+		{
+			name:     "kept while the sink fails",
+			buffered: true,
+			spooled:  []string{"a", "b", "c"},
+		},
+		{
+			name:      "remainder kept after a partial replay",
+			buffered:  true,
+			accept:    1,
+			delivered: []string{"a", "b"},
+			spooled:   []string{"c"},
+		},
+		{
+			name:    "dropped without a buffer",
+			dropped: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &flakySink{failing: true}
+			config := ShipperConfig{BatchSize: 2}
+			if tt.buffered {
+				config.BufferDir = t.TempDir()
+			}
+			shipper, err := NewShipper(zap.NewNop(), config, sink)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			shipper.send(ctx, entries("a", "b", "c"))
+			if len(sink.got) != 0 {
+				t.Fatalf("failing sink got %d entries", len(sink.got))
+			}
+			if tt.buffered {
+				if got := spooled(t, config.BufferDir); len(got) != 3 {
+					t.Fatalf("spooled %d entries, want 3", len(got))
+				}
+			}
+
+			sink.failing = !tt.recovered
+			sink.accept = tt.accept
+			shipper.replay(ctx, 0)
+
+			if got := messages(sink.got); !equal(got, tt.delivered) {
+				t.Errorf("delivered %v, want %v", got, tt.delivered)
+			}
+			if tt.buffered {
+				if got := messages(spooled(t, config.BufferDir)); !equal(got, tt.spooled) {
+					t.Errorf("spooled %v, want %v", got, tt.spooled)
+				}
+			}
+			if got := shipper.Dropped(); got != tt.dropped {
+				t.Errorf("dropped %d, want %d", got, tt.dropped)
+			}
+		})
+	}
+}
+
+// spooled reads back the entries spooled for the flaky sink
+func spooled(t *testing.T, dir string) []LogEntry {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "spool-flaky.jsonl"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out []LogEntry
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var entry LogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func messages(entries []LogEntry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Message)
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"shh/agent/internal/protocol"
+)
+
+// ServerSink ships entries to the server as TypeLogs messages
+type ServerSink struct {
+	send    func(protocol.Message) error
+	dropped func() int64
+}
+
+// NewServerSink creates a sink that sends batches with the given function,
+// typically websocket.Client.SendMessage. dropped, if set, reports the number
+// of entries the shipper has discarded so the server can detect gaps.
+func NewServerSink(send func(protocol.Message) error, dropped func() int64) *ServerSink {
+	return &ServerSink{send: send, dropped: dropped}
+}
+
+// Name implements Sink
+func (s *ServerSink) Name() string {
+	return "server"
+}
+
+// Send implements Sink
+func (s *ServerSink) Send(ctx context.Context, entries []LogEntry) error {
+	payload := protocol.LogsPayload{
+		Entries: make([]protocol.AgentLog, 0, len(entries)),
+	}
+	if s.dropped != nil {
+		payload.Dropped = s.dropped()
+	}
+	for _, e := range entries {
+		payload.Entries = append(payload.Entries, toAgentLog(e))
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal logs payload: %w", err)
+	}
+
+	return s.send(protocol.Message{
+		Type:      protocol.TypeLogs,
+		ID:        fmt.Sprintf("logs-%d", time.Now().UnixNano()),
+		Timestamp: time.Now(),
+		Payload:   data,
+	})
+}
+
+// Close implements Sink
+func (s *ServerSink) Close() error {
+	return nil
+}
+
+// toAgentLog converts an entry to the protocol log format
+func toAgentLog(e LogEntry) protocol.AgentLog {
+	fields := map[string]interface{}{
+		"source": e.Source,
+	}
+	if e.Pattern != "" {
+		fields["pattern"] = e.Pattern
+	}
+	if e.Description != "" {
+		fields["description"] = e.Description
+	}
+	for k, v := range e.Fields {
+		fields[k] = v
+	}
+	return protocol.AgentLog{
+		Level:     string(e.Level),
+		Message:   e.Message,
+		Timestamp: e.Timestamp,
+		Fields:    fields,
+	}
+}
+
+// LokiSink ships entries to a Grafana Loki push endpoint
+type LokiSink struct {
+	url    string
+	labels map[string]string
+	client *http.Client
+}
+
+// NewLokiSink creates a sink for the Loki push API at url, e.g.
+// http://loki:3100/loki/api/v1/push. labels are attached to every stream.
+func NewLokiSink(url string, labels map[string]string) *LokiSink {
+	return &LokiSink{
+		url:    url,
+		labels: labels,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name implements Sink
+func (s *LokiSink) Name() string {
+	return "loki"
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Send implements Sink
+func (s *LokiSink) Send(ctx context.Context, entries []LogEntry) error {
+	// Loki streams are keyed by label set, so group by source and level
+	streams := make(map[string]*lokiStream)
+	var order []string
+	for _, e := range entries {
+		key := e.Source + "\x00" + string(e.Level)
+		stream, ok := streams[key]
+		if !ok {
+			labels := make(map[string]string, len(s.labels)+2)
+			for k, v := range s.labels {
+				labels[k] = v
+			}
+			labels["source"] = e.Source
+			labels["level"] = string(e.Level)
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			order = append(order, key)
+		}
+		stream.Values = append(stream.Values, [2]string{
+			strconv.FormatInt(e.Timestamp.UnixNano(), 10),
+			e.Message,
+		})
+	}
+
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range order {
+		body.Streams = append(body.Streams, streams[key])
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal loki payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create loki request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("loki push failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("loki push failed: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close implements Sink
+func (s *LokiSink) Close() error {
+	return nil
+}
+
+// FileSink writes entries as JSON lines to a rotated file
+type FileSink struct {
+	writer *lumberjack.Logger
+}
+
+// NewFileSink creates a sink that appends to path, rotating per config
+func NewFileSink(path string, config LogConfig) *FileSink {
+	return &FileSink{
+		writer: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    config.MaxSize,
+			MaxAge:     config.MaxAge,
+			MaxBackups: config.MaxBackups,
+			Compress:   config.Compress,
+		},
+	}
+}
+
+// Name implements Sink
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+// Send implements Sink
+func (s *FileSink) Send(ctx context.Context, entries []LogEntry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			return fmt.Errorf("failed to encode log entry: %w", err)
+		}
+	}
+	if _, err := s.writer.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write log file: %w", err)
+	}
+	return nil
+}
+
+// Close implements Sink
+func (s *FileSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/syslog"
+)
+
+// SyslogSink ships entries to a local or remote syslog daemon
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogSink connects to syslog. An empty network and raddr use the local daemon.
+func NewSyslogSink(network, raddr, tag string) (*SyslogSink, error) {
+	writer, err := syslog.Dial(network, raddr, syslog.LOG_LOCAL0|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+// Name implements Sink
+func (s *SyslogSink) Name() string {
+	return "syslog"
+}
+
+// Send implements Sink
+func (s *SyslogSink) Send(ctx context.Context, entries []LogEntry) error {
+	for _, e := range entries {
+		msg := fmt.Sprintf("%s: %s", e.Source, e.Message)
+
+		var err error
+		switch e.Level {
+		case LevelDebug:
+			err = s.writer.Debug(msg)
+		case LevelWarn:
+			err = s.writer.Warning(msg)
+		case LevelError:
+			err = s.writer.Err(msg)
+		default:
+			err = s.writer.Info(msg)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write to syslog: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close implements Sink
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
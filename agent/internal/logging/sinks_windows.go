@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+)
+
+// SyslogSink is unavailable on Windows, which has no syslog daemon
+type SyslogSink struct{}
+
+// NewSyslogSink fails on Windows
+func NewSyslogSink(network, raddr, tag string) (*SyslogSink, error) {
+	return nil, fmt.Errorf("syslog is not available on Windows")
+}
+
+// Name implements Sink
+func (s *SyslogSink) Name() string {
+	return "syslog"
+}
+
+// Send implements Sink
+func (s *SyslogSink) Send(ctx context.Context, entries []LogEntry) error {
+	return fmt.Errorf("syslog is not available on Windows")
+}
+
+// Close implements Sink
+func (s *SyslogSink) Close() error {
+	return nil
+}
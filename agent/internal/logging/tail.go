@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// rotationCheckInterval is how often an idle tailer checks whether its file
+// was rotated or truncated
+const rotationCheckInterval = time.Second
+
+// tailer follows a file by identity rather than by name. When the path is
+// renamed away and recreated (logrotate create), the old file is drained and
+// the new one is read from the start; when the file shrinks (copytruncate),
+// reading restarts at offset zero.
+type tailer struct {
+	path      string
+	file      *os.File
+	info      os.FileInfo
+	reader    *bufio.Reader
+	offset    int64
+	partial   string
+	lastCheck time.Time
+}
+
+// openTailer opens path, positioned at the end when seekEnd is set
+func openTailer(path string, seekEnd bool) (*tailer, error) {
+	t := &tailer{path: path}
+	if err := t.open(seekEnd); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *tailer) open(seekEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	var offset int64
+	if seekEnd {
+		if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to seek log file: %w", err)
+		}
+	}
+
+	t.file = f
+	t.info = info
+	t.reader = bufio.NewReader(f)
+	t.offset = offset
+	t.partial = ""
+	t.lastCheck = time.Now()
+	return nil
+}
+
+// resume continues reading at the saved position if it is of the open
+// file and within it, and from the start otherwise, as the file was
+// rotated while it wasn't read
+func (t *tailer) resume(pos logPosition) error {
+	offset := pos.Offset
+	if fileInode(t.info) != pos.Inode || offset > t.info.Size() {
+		offset = 0
+	}
+	if _, err := t.file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek log file: %w", err)
+	}
+	t.reader.Reset(t.file)
+	t.offset = offset
+	t.partial = ""
+	return nil
+}
+
+// position returns where reading stopped, before any partial line
+func (t *tailer) position() logPosition {
+	return logPosition{
+		Inode:  fileInode(t.info),
+		Offset: t.offset - int64(len(t.partial)),
+	}
+}
+
+// readLine returns the next complete line. It returns io.EOF when no complete
+// line is available yet; partial lines are kept until their newline arrives.
+func (t *tailer) readLine() (string, error) {
+	data, err := t.reader.ReadString('\n')
+	t.offset += int64(len(data))
+	if err != nil {
+		t.partial += data
+		if err == io.EOF {
+			if rerr := t.checkRotation(); rerr != nil {
+				return "", rerr
+			}
+		}
+		return "", err
+	}
+
+	line := t.partial + data
+	t.partial = ""
+	return line, nil
+}
+
+// checkRotation reopens the file if it was replaced or truncated
+func (t *tailer) checkRotation() error {
+	if time.Since(t.lastCheck) < rotationCheckInterval {
+		return nil
+	}
+	t.lastCheck = time.Now()
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Rotated away and not yet recreated; keep the old handle
+			return nil
+		}
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	if !os.SameFile(t.info, info) {
+		// The old file was fully drained before EOF was reported
+		t.file.Close()
+		return t.open(false)
+	}
+
+	if info.Size() < t.offset {
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek truncated log file: %w", err)
+		}
+		t.reader.Reset(t.file)
+		t.offset = 0
+		t.partial = ""
+	}
+	return nil
+}
+
+func (t *tailer) close() error {
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
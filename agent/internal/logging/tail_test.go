@@ -0,0 +1,168 @@
+package logging
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestTailerFollows(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string
+		change  func(t *testing.T, path string)
+		renames bool // Windows can't rename open files
+		before  []string
+		after   []string
+	}{
+		{
+			name:    "appended lines",
+			initial: "a\n",
+			change:  func(t *testing.T, path string) { appendFile(t, path, "b\nc\n") },
+			before:  []string{"a\n"},
+			after:   []string{"b\n", "c\n"},
+		},
+		{
+			name:    "partial line waits for its newline",
+			initial: "a\npar",
+			change:  func(t *testing.T, path string) { appendFile(t, path, "tial\n") },
+			before:  []string{"a\n"},
+			after:   []string{"partial\n"},
+		},
+		{
+			name:    "renamed and recreated",
+			initial: "a\n",
+			change: func(t *testing.T, path string) {
+				if err := os.Rename(path, path+".1"); err != nil {
+					t.Fatal(err)
+				}
+				appendFile(t, path+".1", "late\n")
+				appendFile(t, path, "b\n")
+			},
+			renames: true,
+			before:  []string{"a\n"},
+			after:   []string{"late\n", "b\n"},
+		},
+		{
+			name:    "truncated in place",
+			initial: "aaaa\nbbbb\n",
+			change: func(t *testing.T, path string) {
+				if err := os.Truncate(path, 0); err != nil {
+					t.Fatal(err)
+				}
+				appendFile(t, path, "c\n")
+			},
+			before: []string{"aaaa\n", "bbbb\n"},
+			after:  []string{"c\n"},
+		},
+		{
+			name:    "removed and not yet recreated",
+			initial: "a\n",
+			change: func(t *testing.T, path string) {
+				if err := os.Rename(path, path+".1"); err != nil {
+					t.Fatal(err)
+				}
+				appendFile(t, path+".1", "late\n")
+			},
+			renames: true,
+			before:  []string{"a\n"},
+			after:   []string{"late\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.renames && runtime.GOOS == "windows" {
+				t.Skip("open files can't be renamed")
+			}
+			path := filepath.Join(t.TempDir(), "app.log")
+			appendFile(t, path, tt.initial)
+
+			tail, err := openTailer(path, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tail.close()
+
+			if got := readLines(t, tail); !equal(got, tt.before) {
+				t.Fatalf("read %q before the change, want %q", got, tt.before)
+			}
+			tt.change(t, path)
+			// The first EOF notices rotation, the reopened file is read next
+			tail.lastCheck = tail.lastCheck.AddDate(0, 0, -1)
+			got := append(readLines(t, tail), readLines(t, tail)...)
+			if !equal(got, tt.after) {
+				t.Errorf("read %q after the change, want %q", got, tt.after)
+			}
+		})
+	}
+}
+
+func TestTailerResume(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int64
+		other  bool // position saved for another file
+		want   []string
+	}{
+		{"at the saved offset", 2, false, []string{"b\n", "c\n"}},
+		{"at the end", 6, false, nil},
+		{"beyond the end", 100, false, []string{"a\n", "b\n", "c\n"}},
+		{"of a rotated file", 2, true, []string{"a\n", "b\n", "c\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			appendFile(t, path, "a\nb\nc\n")
+
+			tail, err := openTailer(path, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tail.close()
+
+			pos := logPosition{Inode: fileInode(tail.info), Offset: tt.offset}
+			if tt.other {
+				pos.Inode++
+			}
+			if err := tail.resume(pos); err != nil {
+				t.Fatal(err)
+			}
+			if got := readLines(t, tail); !equal(got, tt.want) {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+			if got := tail.position(); got.Offset != 6 {
+				t.Errorf("position offset = %d, want 6", got.Offset)
+			}
+		})
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readLines reads complete lines until the tailer reports EOF
+func readLines(t *testing.T, tail *tailer) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := tail.readLine()
+		if err == io.EOF {
+			return lines
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+}
@@ -0,0 +1,259 @@
+// Package maintenance tracks planned work during which the agent suppresses
+// auto-remediation, alerts and health degradation
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// AllComponents is the component of agent-wide maintenance
+const AllComponents = "*"
+
+// MaxDuration bounds a maintenance window so a forgotten one can't disable
+// remediation indefinitely
+const MaxDuration = 7 * 24 * time.Hour
+
+// Maintenance event actions
+const (
+	ActionEnabled  = "enabled"
+	ActionDisabled = "disabled"
+	ActionExpired  = "expired"
+)
+
+// Manager tracks maintenance windows. Components are free-form names shared
+// with the subsystems that check them, such as health check names, resolver
+// problem components or "alerting".
+type Manager struct {
+	logger  *zap.Logger
+	events  chan<- interface{}
+	windows map[string]protocol.MaintenanceWindow
+	mu      sync.RWMutex
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewManager creates a maintenance manager. Changes are sent on events as
+// protocol.MaintenanceEvent values.
+func NewManager(logger *zap.Logger, events chan<- interface{}) *Manager {
+	return &Manager{
+		logger:  logger,
+		events:  events,
+		windows: make(map[string]protocol.MaintenanceWindow),
+	}
+}
+
+// Start expires windows in the background
+func (m *Manager) Start(ctx context.Context) error {
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				m.expire(now)
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the manager
+func (m *Manager) Shutdown(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Enable puts component, or the whole agent for "" or "*", in maintenance
+// for duration. Enabling an active window replaces its expiry and reason.
+func (m *Manager) Enable(component string, duration time.Duration, reason string) (protocol.MaintenanceWindow, error) {
+	if duration <= 0 {
+		return protocol.MaintenanceWindow{}, fmt.Errorf("maintenance duration must be positive")
+	}
+	if duration > MaxDuration {
+		return protocol.MaintenanceWindow{}, fmt.Errorf("maintenance duration %s exceeds maximum %s", duration, MaxDuration)
+	}
+
+	now := time.Now()
+	window := protocol.MaintenanceWindow{
+		Component: normalize(component),
+		Reason:    reason,
+		StartedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+
+	m.mu.Lock()
+	if existing, ok := m.windows[window.Component]; ok && existing.ExpiresAt.After(now) {
+		window.StartedAt = existing.StartedAt
+	}
+	m.windows[window.Component] = window
+	m.mu.Unlock()
+
+	m.logger.Info("Maintenance enabled",
+		zap.String("component", window.Component),
+		zap.Time("expires", window.ExpiresAt),
+		zap.String("reason", reason))
+	m.emit(ActionEnabled, window)
+	return window, nil
+}
+
+// Disable ends maintenance of component, or agent-wide maintenance for ""
+// or "*"
+func (m *Manager) Disable(component string) error {
+	component = normalize(component)
+
+	m.mu.Lock()
+	window, ok := m.windows[component]
+	delete(m.windows, component)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%s is not in maintenance", component)
+	}
+	m.logger.Info("Maintenance disabled", zap.String("component", component))
+	m.emit(ActionDisabled, window)
+	return nil
+}
+
+// Active reports whether component is in maintenance, directly or through
+// agent-wide maintenance. An empty component only checks agent-wide
+// maintenance.
+func (m *Manager) Active(component string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	if w, ok := m.windows[AllComponents]; ok && now.Before(w.ExpiresAt) {
+		return true
+	}
+	if component == "" {
+		return false
+	}
+	w, ok := m.windows[component]
+	return ok && now.Before(w.ExpiresAt)
+}
+
+// Windows returns the active maintenance windows ordered by component
+func (m *Manager) Windows() []protocol.MaintenanceWindow {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	windows := make([]protocol.MaintenanceWindow, 0, len(m.windows))
+	for _, w := range m.windows {
+		if now.Before(w.ExpiresAt) {
+			windows = append(windows, w)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Component < windows[j].Component })
+	return windows
+}
+
+// HandleRequest applies a maintenance request received from the server
+func (m *Manager) HandleRequest(req protocol.MaintenanceRequest) ([]protocol.MaintenanceWindow, error) {
+	switch req.Action {
+	case "enable":
+		if _, err := m.Enable(req.Component, time.Duration(req.Duration)*time.Second, req.Reason); err != nil {
+			return nil, err
+		}
+	case "disable":
+		if err := m.Disable(req.Component); err != nil {
+			return nil, err
+		}
+	case "", "status":
+	default:
+		return nil, fmt.Errorf("unknown maintenance action: %s", req.Action)
+	}
+	return m.Windows(), nil
+}
+
+// HandleCommand processes maintenance commands
+func (m *Manager) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "maintenance:enable":
+		// maintenance:enable <component|*> <duration> [reason...]
+		if len(args) < 2 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "component and duration required")
+		}
+		duration, err := time.ParseDuration(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration: %w", err)
+		}
+		return m.Enable(args[0], duration, strings.Join(args[2:], " "))
+	case "maintenance:disable":
+		component := ""
+		if len(args) > 0 {
+			component = args[0]
+		}
+		return nil, m.Disable(component)
+	case "maintenance:status":
+		return m.Windows(), nil
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown maintenance command: %s", cmd)
+	}
+}
+
+// expire removes windows that ended before now
+func (m *Manager) expire(now time.Time) {
+	var expired []protocol.MaintenanceWindow
+
+	m.mu.Lock()
+	for component, w := range m.windows {
+		if !now.Before(w.ExpiresAt) {
+			expired = append(expired, w)
+			delete(m.windows, component)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, w := range expired {
+		m.logger.Info("Maintenance expired", zap.String("component", w.Component))
+		m.emit(ActionExpired, w)
+	}
+}
+
+func (m *Manager) emit(action string, window protocol.MaintenanceWindow) {
+	if m.events == nil {
+		return
+	}
+	event := protocol.MaintenanceEvent{
+		Action:    action,
+		Window:    window,
+		Timestamp: time.Now(),
+	}
+	select {
+	case m.events <- event:
+	default:
+		m.logger.Warn("Failed to send maintenance event: channel full")
+	}
+}
+
+func normalize(component string) string {
+	if component == "" {
+		return AllComponents
+	}
+	return component
+}
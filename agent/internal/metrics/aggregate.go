@@ -0,0 +1,287 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Series aggregated from each sample
+const (
+	SeriesCPU    = "cpu"
+	SeriesMemory = "memory"
+	SeriesDisk   = "disk"
+	SeriesLoad1  = "load1"
+	SeriesNetRx  = "net_rx"
+	SeriesNetTx  = "net_tx"
+	// SeriesFailedUnits and SeriesRestartLoops count systemd units
+	SeriesFailedUnits  = "failed_units"
+	SeriesRestartLoops = "restart_loops"
+	// SeriesFlows and SeriesFlowEvictions track the flow table size and
+	// the flows evicted to bound it
+	SeriesFlows         = "flows"
+	SeriesFlowEvictions = "flow_evictions"
+)
+
+// changeSeries are the usages, in percent, that are sent right away when
+// they change significantly
+var changeSeries = []string{SeriesCPU, SeriesMemory, SeriesDisk}
+
+// maxPendingSummaries bounds the summaries kept while sending fails; the
+// oldest are dropped
+const maxPendingSummaries = 500
+
+// AggregationPolicy decides how samples are summarized before upload
+type AggregationPolicy struct {
+	// Windows are the lengths samples are summarized over
+	Windows []time.Duration
+	// FlushInterval is how long summaries are batched before sending
+	FlushInterval time.Duration
+	// ChangeThreshold, in percentage points, makes a usage change since
+	// the last report sent right away; zero disables it
+	ChangeThreshold float64
+}
+
+// DefaultAggregationPolicy summarizes over 1 and 5 minutes, sends every
+// 5 minutes, and right away on usage changes of 20 points
+var DefaultAggregationPolicy = AggregationPolicy{
+	Windows:         []time.Duration{time.Minute, 5 * time.Minute},
+	FlushInterval:   5 * time.Minute,
+	ChangeThreshold: 20,
+}
+
+// Sender sends messages to the server
+type Sender interface {
+	SendMessage(msg protocol.Message) error
+}
+
+// window collects the samples of one aggregation window
+type window struct {
+	length time.Duration
+	start  time.Time
+	end    time.Time
+	values map[string][]float64
+}
+
+// Aggregator summarizes collected samples into windows and uploads them
+// in batches, so that fleets of agents don't send every raw sample
+type Aggregator struct {
+	logger *zap.Logger
+	client Sender
+
+	mu        sync.Mutex
+	policy    AggregationPolicy
+	windows   []*window
+	pending   []protocol.MetricsSummary
+	reported  map[string]float64
+	lastFlush time.Time
+	previous  *SystemMetrics
+}
+
+// NewAggregator creates an aggregator sending to client
+func NewAggregator(logger *zap.Logger, client Sender) *Aggregator {
+	a := &Aggregator{
+		logger:   logger,
+		client:   client,
+		reported: make(map[string]float64),
+	}
+	a.SetPolicy(DefaultAggregationPolicy)
+	return a
+}
+
+// SetPolicy changes how samples are summarized. The open windows are
+// discarded.
+func (a *Aggregator) SetPolicy(policy AggregationPolicy) {
+	if len(policy.Windows) == 0 {
+		policy.Windows = DefaultAggregationPolicy.Windows
+	}
+	if policy.FlushInterval <= 0 {
+		policy.FlushInterval = DefaultAggregationPolicy.FlushInterval
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policy = policy
+	a.windows = make([]*window, 0, len(policy.Windows))
+	for _, length := range policy.Windows {
+		if length > 0 {
+			a.windows = append(a.windows, &window{length: length})
+		}
+	}
+}
+
+// Start begins the flush interval
+func (a *Aggregator) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastFlush = time.Now()
+	return nil
+}
+
+// Shutdown sends the summaries still pending
+func (a *Aggregator) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flush(time.Now())
+}
+
+// Observe adds a sample. Summaries are sent when the flush interval has
+// passed, or right away when a usage changed significantly.
+func (a *Aggregator) Observe(m *SystemMetrics) {
+	if m == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sample := a.sample(m)
+	a.previous = m
+	for _, w := range a.windows {
+		if w.values != nil && m.Timestamp.Sub(w.start) >= w.length {
+			a.queue(summarize(protocol.SummaryWindow, w.length, w.start, w.end, w.values))
+			w.values = nil
+		}
+		if w.values == nil {
+			w.start = m.Timestamp
+			w.values = make(map[string][]float64)
+		}
+		w.end = m.Timestamp
+		for name, value := range sample {
+			w.values[name] = append(w.values[name], value)
+		}
+	}
+
+	flush := m.Timestamp.Sub(a.lastFlush) >= a.policy.FlushInterval
+	if threshold := a.policy.ChangeThreshold; threshold > 0 {
+		for _, name := range changeSeries {
+			value, ok := sample[name]
+			last, reported := a.reported[name]
+			if ok && reported && math.Abs(value-last) >= threshold {
+				values := make(map[string][]float64, len(sample))
+				for name, value := range sample {
+					values[name] = []float64{value}
+				}
+				a.queue(summarize(protocol.SummaryChange, 0, m.Timestamp, m.Timestamp, values))
+				flush = true
+				break
+			}
+		}
+	}
+	if !flush {
+		return
+	}
+	if err := a.flush(m.Timestamp); err != nil {
+		a.logger.Warn("Failed to send metrics", zap.Int("pending", len(a.pending)), zap.Error(err))
+	}
+}
+
+// sample returns the values of the aggregated series. The caller holds
+// mu.
+func (a *Aggregator) sample(m *SystemMetrics) map[string]float64 {
+	sample := map[string]float64{
+		SeriesCPU:   m.CPUUsage,
+		SeriesLoad1: m.LoadAverage[0],
+	}
+	if m.MemoryTotal > 0 {
+		sample[SeriesMemory] = float64(m.MemoryUsed) / float64(m.MemoryTotal) * 100
+	}
+	if m.DiskTotal > 0 {
+		sample[SeriesDisk] = float64(m.DiskUsed) / float64(m.DiskTotal) * 100
+	}
+	if m.Units != nil {
+		sample[SeriesFailedUnits] = float64(len(m.Units.Failed))
+		sample[SeriesRestartLoops] = float64(len(m.Units.RestartLoops))
+	}
+	if m.Flows != nil {
+		sample[SeriesFlows] = float64(m.Flows.Flows)
+		sample[SeriesFlowEvictions] = float64(m.Flows.EvictedIdle + m.Flows.EvictedActive + m.Flows.EvictedLRU + m.Flows.EvictedClosed)
+	}
+	// Network counters become rates against the previous sample
+	if prev := a.previous; prev != nil && prev.Network != nil && m.Network != nil {
+		elapsed := m.Timestamp.Sub(prev.Timestamp).Seconds()
+		if elapsed > 0 && m.Network.BytesRecv >= prev.Network.BytesRecv && m.Network.BytesSent >= prev.Network.BytesSent {
+			sample[SeriesNetRx] = float64(m.Network.BytesRecv-prev.Network.BytesRecv) / elapsed
+			sample[SeriesNetTx] = float64(m.Network.BytesSent-prev.Network.BytesSent) / elapsed
+		}
+	}
+	return sample
+}
+
+// queue adds a summary to the next batch. The caller holds mu.
+func (a *Aggregator) queue(summary protocol.MetricsSummary) {
+	a.pending = append(a.pending, summary)
+	if drop := len(a.pending) - maxPendingSummaries; drop > 0 {
+		a.pending = append([]protocol.MetricsSummary(nil), a.pending[drop:]...)
+	}
+}
+
+// flush sends the pending summaries as one batch, keeping them for the
+// next flush if sending fails. The caller holds mu.
+func (a *Aggregator) flush(now time.Time) error {
+	a.lastFlush = now
+	if len(a.pending) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(protocol.MetricsBatch{Summaries: a.pending})
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics: %w", err)
+	}
+	if err := a.client.SendMessage(protocol.Message{
+		Type:      protocol.TypeMetrics,
+		ID:        fmt.Sprintf("metrics-%d", now.UnixNano()),
+		Timestamp: now,
+		Payload:   payload,
+	}); err != nil {
+		return err
+	}
+
+	// Changes are measured against the latest values sent
+	for _, summary := range a.pending {
+		for name, stats := range summary.Series {
+			a.reported[name] = stats.Last
+		}
+	}
+	a.pending = nil
+	return nil
+}
+
+// summarize computes the stats of each series
+func summarize(reason string, length time.Duration, start, end time.Time, values map[string][]float64) protocol.MetricsSummary {
+	summary := protocol.MetricsSummary{
+		Reason: reason,
+		Window: length.Seconds(),
+		Start:  start,
+		End:    end,
+		Series: make(map[string]protocol.SeriesStats, len(values)),
+	}
+	for name, series := range values {
+		if len(series) == 0 {
+			continue
+		}
+		if len(series) > summary.Samples {
+			summary.Samples = len(series)
+		}
+		sorted := append([]float64(nil), series...)
+		sort.Float64s(sorted)
+		var sum float64
+		for _, v := range series {
+			sum += v
+		}
+		p95 := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+		summary.Series[name] = protocol.SeriesStats{
+			Min:  sorted[0],
+			Max:  sorted[len(sorted)-1],
+			Avg:  sum / float64(len(series)),
+			P95:  sorted[p95],
+			Last: series[len(series)-1],
+		}
+	}
+	return summary
+}
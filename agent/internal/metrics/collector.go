@@ -3,6 +3,7 @@ package metrics
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -11,6 +12,11 @@ import (
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
 	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/network"
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/systemd"
 )
 
 // Connection types from gopsutil
@@ -39,6 +45,20 @@ type SystemMetrics struct {
 	MemoryUsed   uint64        `json:"memory_used"`
 	DiskTotal    uint64        `json:"disk_total"`
 	DiskUsed     uint64        `json:"disk_used"`
+
+	// Units are the failed and restart-looping systemd units, on hosts
+	// with systemd
+	Units *systemd.UnitStatus `json:"units,omitempty"`
+
+	// Boot describes the host's current boot and its uptime
+	Boot *protocol.BootInfo `json:"boot,omitempty"`
+
+	// Devices are the latest metrics of the network devices polled over
+	// SNMP, by device name
+	Devices map[string]*DeviceMetrics `json:"devices,omitempty"`
+
+	// Flows is the occupancy of the network analyzer's flow table
+	Flows *network.FlowTableStats `json:"flows,omitempty"`
 }
 
 type CPUMetrics struct {
@@ -106,8 +126,27 @@ type Collector struct {
 	cancel context.CancelFunc
 	metrics *SystemMetrics
 	startTime time.Time
+	// intervals carries collection interval changes to Start
+	intervals chan time.Duration
+	mu        sync.Mutex
+	interval  time.Duration
+	throttle  float64
+
+	// observers receive each collected sample
+	observers []func(*SystemMetrics)
+	// units provides the systemd unit status
+	units func() *systemd.UnitStatus
+	// boot provides the current boot of the host
+	boot func() *protocol.BootInfo
+	// devices provides the metrics of the SNMP devices
+	devices func() map[string]*DeviceMetrics
+	// flows provides the flow table statistics
+	flows func() network.FlowTableStats
 }
 
+// defaultInterval is how often metrics are collected unless configured
+const defaultInterval = 5 * time.Second
+
 func NewCollector(logger *zap.Logger) *Collector {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Collector{
@@ -116,17 +155,95 @@ func NewCollector(logger *zap.Logger) *Collector {
 		cancel: cancel,
 		metrics: &SystemMetrics{},
 		startTime: time.Now(),
+		intervals: make(chan time.Duration, 1),
+		interval:  defaultInterval,
+		throttle:  1,
 	}
 }
 
+// SetInterval changes how often metrics are collected, taking effect
+// right away if the collector is running
+func (c *Collector) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interval = interval
+	c.pushInterval()
+}
+
+// SetThrottle stretches the collection interval by factor while the
+// agent is near its resource budget
+func (c *Collector) SetThrottle(factor float64) {
+	if factor < 1 {
+		factor = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.throttle = factor
+	c.pushInterval()
+}
+
+// pushInterval hands the effective interval to Start. The caller holds mu.
+func (c *Collector) pushInterval() {
+	// Only the latest change matters
+	select {
+	case <-c.intervals:
+	default:
+	}
+	c.intervals <- time.Duration(float64(c.interval) * c.throttle)
+}
+
+// OnCollect calls observe with each sample collected. It must be called
+// before Start.
+func (c *Collector) OnCollect(observe func(*SystemMetrics)) {
+	c.observers = append(c.observers, observe)
+}
+
+// SetUnits includes the systemd unit status from units in the metrics.
+// It must be called before Start.
+func (c *Collector) SetUnits(units func() *systemd.UnitStatus) {
+	c.units = units
+}
+
+// SetBoot includes the host's boot from boot in the metrics. It must be
+// called before Start.
+func (c *Collector) SetBoot(boot func() *protocol.BootInfo) {
+	c.boot = boot
+}
+
+// SetDevices includes the SNMP device metrics from devices in the
+// metrics. It must be called before Start.
+func (c *Collector) SetDevices(devices func() map[string]*DeviceMetrics) {
+	c.devices = devices
+}
+
+// Start collects metrics in the background until Shutdown
+// SetFlows includes the flow table statistics from flows in the metrics.
+// It must be called before Start.
+func (c *Collector) SetFlows(flows func() network.FlowTableStats) {
+	c.flows = flows
+}
+
 func (c *Collector) Start(ctx context.Context) error {
-	ticker := time.NewTicker(5 * time.Second)
+	crash.Go("metrics-collector", func() { c.run(ctx) })
+	return nil
+}
+
+func (c *Collector) run(ctx context.Context) {
+	ticker := time.NewTicker(defaultInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return
+		case <-c.ctx.Done():
+			return
+		case interval := <-c.intervals:
+			ticker.Reset(interval)
+			c.logger.Info("Metrics interval changed", zap.Duration("interval", interval))
 		case <-ticker.C:
 			if err := c.collect(); err != nil {
 				c.logger.Error("Failed to collect metrics", zap.Error(err))
@@ -192,7 +309,25 @@ func (c *Collector) collect() error {
 		}
 	}
 
+	// systemd units
+	if c.units != nil {
+		metrics.Units = c.units()
+	}
+	if c.boot != nil {
+		metrics.Boot = c.boot()
+	}
+	if c.devices != nil {
+		metrics.Devices = c.devices()
+	}
+	if c.flows != nil {
+		flows := c.flows()
+		metrics.Flows = &flows
+	}
+
 	c.metrics = metrics
+	for _, observe := range c.observers {
+		observe(metrics)
+	}
 	return nil
 }
 
@@ -301,10 +436,17 @@ func (c *Collector) collectStorageMetrics() (*StorageMetrics, error) {
 		Usage: float64(used) / float64(total) * 100,
 	}
 
-	// Get disk I/O statistics
+	// Get disk I/O statistics, falling back to the platform's counters
+	// where gopsutil has none
 	diskStats, err := disk.IOCounters()
-	if err != nil {
-		c.logger.Warn("Failed to get disk I/O stats", zap.Error(err))
+	if err != nil || len(diskStats) == 0 {
+		if ioStats, platformErr := platformIOStats(); platformErr == nil {
+			metrics.IOStats = ioStats
+			return metrics, nil
+		}
+		if err != nil {
+			c.logger.Warn("Failed to get disk I/O stats", zap.Error(err))
+		}
 		return metrics, nil
 	}
 
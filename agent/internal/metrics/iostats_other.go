@@ -0,0 +1,10 @@
+//go:build !windows
+
+package metrics
+
+import "fmt"
+
+// platformIOStats has nothing to add to gopsutil outside Windows
+func platformIOStats() (*IOMetrics, error) {
+	return nil, fmt.Errorf("no platform disk counters")
+}
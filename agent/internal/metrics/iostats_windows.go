@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/yusufpapurcu/wmi"
+)
+
+// win32PhysicalDisk holds the raw, cumulative physical disk counters
+type win32PhysicalDisk struct {
+	Name                 string
+	DiskReadsPersec      uint32
+	DiskWritesPersec     uint32
+	DiskReadBytesPersec  uint64
+	DiskWriteBytesPersec uint64
+	PercentDiskTime      uint64
+}
+
+// platformIOStats reads disk I/O totals from WMI. gopsutil relies on
+// IOCTL_DISK_PERFORMANCE, which returns nothing unless disk performance
+// counters were enabled with diskperf.
+func platformIOStats() (*IOMetrics, error) {
+	var disks []win32PhysicalDisk
+	query := "SELECT Name, DiskReadsPersec, DiskWritesPersec, DiskReadBytesPersec, DiskWriteBytesPersec, PercentDiskTime " +
+		"FROM Win32_PerfRawData_PerfDisk_PhysicalDisk WHERE Name = '_Total'"
+	if err := wmi.Query(query, &disks); err != nil {
+		return nil, fmt.Errorf("failed to query disk counters: %w", err)
+	}
+	if len(disks) == 0 {
+		return nil, fmt.Errorf("no disk counters found")
+	}
+	d := disks[0]
+	return &IOMetrics{
+		ReadCount:  uint64(d.DiskReadsPersec),
+		WriteCount: uint64(d.DiskWritesPersec),
+		ReadBytes:  d.DiskReadBytesPersec,
+		WriteBytes: d.DiskWriteBytesPersec,
+		// PercentDiskTime counts 100ns ticks; IOTime is in milliseconds
+		IOTime: d.PercentDiskTime / 10000,
+	}, nil
+}
@@ -0,0 +1,508 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"go.uber.org/zap"
+)
+
+// SNMP object identifiers polled from devices
+const (
+	oidSysDescr         = ".1.3.6.1.2.1.1.1.0"
+	oidSysUpTime        = ".1.3.6.1.2.1.1.3.0"
+	oidSysName          = ".1.3.6.1.2.1.1.5.0"
+	oidIfDescr          = ".1.3.6.1.2.1.2.2.1.2"
+	oidIfSpeed          = ".1.3.6.1.2.1.2.2.1.5"
+	oidIfOperStatus     = ".1.3.6.1.2.1.2.2.1.8"
+	oidIfInOctets       = ".1.3.6.1.2.1.2.2.1.10"
+	oidIfInDiscards     = ".1.3.6.1.2.1.2.2.1.13"
+	oidIfInErrors       = ".1.3.6.1.2.1.2.2.1.14"
+	oidIfOutOctets      = ".1.3.6.1.2.1.2.2.1.16"
+	oidIfOutDiscards    = ".1.3.6.1.2.1.2.2.1.19"
+	oidIfOutErrors      = ".1.3.6.1.2.1.2.2.1.20"
+	oidIfName           = ".1.3.6.1.2.1.31.1.1.1.1"
+	oidIfHCInOctets     = ".1.3.6.1.2.1.31.1.1.1.6"
+	oidIfHCOutOctets    = ".1.3.6.1.2.1.31.1.1.1.10"
+	oidIfHighSpeed      = ".1.3.6.1.2.1.31.1.1.1.15"
+	oidHrProcessorLoad  = ".1.3.6.1.2.1.25.3.3.1.2"
+	oidCiscoCPUTotal5m  = ".1.3.6.1.4.1.9.9.109.1.1.1.1.8"
+	oidJuniperCPULoad   = ".1.3.6.1.4.1.2636.3.1.13.1.8"
+	snmpDefaultPort     = 161
+	snmpDefaultTimeout  = 5 * time.Second
+	snmpDefaultInterval = time.Minute
+)
+
+// SNMPDevice represents a network device polled over SNMP
+type SNMPDevice struct {
+	Name      string        `json:"name"`
+	Address   string        `json:"address"`
+	Port      uint16        `json:"port,omitempty"`
+	Version   string        `json:"version"` // "2c" or "3"
+	Community string        `json:"community,omitempty"`
+	Timeout   time.Duration `json:"timeout,omitempty"`
+	Retries   int           `json:"retries,omitempty"`
+
+	// SNMPv3 user security model settings
+	Username       string `json:"username,omitempty"`
+	AuthProtocol   string `json:"auth_protocol,omitempty"` // MD5, SHA, SHA256, SHA512
+	AuthPassphrase string `json:"auth_passphrase,omitempty"`
+	PrivProtocol   string `json:"priv_protocol,omitempty"` // DES, AES, AES256
+	PrivPassphrase string `json:"priv_passphrase,omitempty"`
+}
+
+// InterfaceCounters represents per-interface counters and derived rates
+type InterfaceCounters struct {
+	Index       int     `json:"index"`
+	Name        string  `json:"name"`
+	OperStatus  string  `json:"oper_status"`
+	SpeedBps    uint64  `json:"speed_bps"`
+	InOctets    uint64  `json:"in_octets"`
+	OutOctets   uint64  `json:"out_octets"`
+	InErrors    uint64  `json:"in_errors"`
+	OutErrors   uint64  `json:"out_errors"`
+	InDiscards  uint64  `json:"in_discards"`
+	OutDiscards uint64  `json:"out_discards"`
+	InRate      float64 `json:"in_bytes_per_sec"`
+	OutRate     float64 `json:"out_bytes_per_sec"`
+	Utilization float64 `json:"utilization"` // percent of link speed, max of in/out
+}
+
+// DeviceMetrics represents metrics polled from one SNMP device
+type DeviceMetrics struct {
+	Device        string              `json:"device"`
+	Address       string              `json:"address"`
+	SysName       string              `json:"sys_name,omitempty"`
+	SysDescr      string              `json:"sys_descr,omitempty"`
+	UptimeSeconds int64               `json:"uptime_seconds"`
+	CPUUsage      float64             `json:"cpu_usage"` // -1 when the device exposes no CPU OID
+	Interfaces    []InterfaceCounters `json:"interfaces"`
+	Error         string              `json:"error,omitempty"`
+	Timestamp     time.Time           `json:"timestamp"`
+}
+
+// SNMPPoller periodically polls network devices and publishes their metrics
+type SNMPPoller struct {
+	logger   *zap.Logger
+	interval time.Duration
+	devices  []SNMPDevice
+	events   chan<- interface{}
+	metrics  map[string]*DeviceMetrics
+	mu       sync.RWMutex
+}
+
+// NewSNMPPoller creates a poller for the given devices. Each poll result is
+// sent as a DeviceMetrics value on events.
+func NewSNMPPoller(logger *zap.Logger, devices []SNMPDevice, interval time.Duration, events chan<- interface{}) *SNMPPoller {
+	if interval <= 0 {
+		interval = snmpDefaultInterval
+	}
+	return &SNMPPoller{
+		logger:   logger,
+		interval: interval,
+		devices:  devices,
+		events:   events,
+		metrics:  make(map[string]*DeviceMetrics),
+	}
+}
+
+// Start begins polling devices
+func (p *SNMPPoller) Start(ctx context.Context) error {
+	for _, device := range p.devices {
+		if _, err := newSNMPClient(device); err != nil {
+			return fmt.Errorf("invalid SNMP device %s: %w", device.Name, err)
+		}
+	}
+
+	go func() {
+		p.pollAll(ctx)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.pollAll(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the poller
+func (p *SNMPPoller) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// GetMetrics returns the latest metrics for every device
+func (p *SNMPPoller) GetMetrics() map[string]*DeviceMetrics {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make(map[string]*DeviceMetrics, len(p.metrics))
+	for name, m := range p.metrics {
+		copied := *m
+		copied.Interfaces = append([]InterfaceCounters(nil), m.Interfaces...)
+		result[name] = &copied
+	}
+	return result
+}
+
+func (p *SNMPPoller) pollAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, device := range p.devices {
+		wg.Add(1)
+		go func(device SNMPDevice) {
+			defer wg.Done()
+
+			metrics, err := p.Poll(ctx, device)
+			if err != nil {
+				p.logger.Warn("SNMP poll failed",
+					zap.String("device", device.Name),
+					zap.String("address", device.Address),
+					zap.Error(err))
+				metrics = &DeviceMetrics{
+					Device:    device.Name,
+					Address:   device.Address,
+					CPUUsage:  -1,
+					Error:     err.Error(),
+					Timestamp: time.Now(),
+				}
+			}
+
+			p.mu.Lock()
+			p.computeRates(metrics, p.metrics[device.Name])
+			p.metrics[device.Name] = metrics
+			p.mu.Unlock()
+
+			if p.events == nil {
+				return
+			}
+			select {
+			case p.events <- *metrics:
+			default:
+				p.logger.Warn("Failed to send SNMP metrics: channel full")
+			}
+		}(device)
+	}
+	wg.Wait()
+}
+
+// Poll queries a single device
+func (p *SNMPPoller) Poll(ctx context.Context, device SNMPDevice) (*DeviceMetrics, error) {
+	client, err := newSNMPClient(device)
+	if err != nil {
+		return nil, err
+	}
+	client.Context = ctx
+
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer client.Conn.Close()
+
+	metrics := &DeviceMetrics{
+		Device:    device.Name,
+		Address:   device.Address,
+		CPUUsage:  -1,
+		Timestamp: time.Now(),
+	}
+
+	result, err := client.Get([]string{oidSysDescr, oidSysUpTime, oidSysName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get system OIDs: %w", err)
+	}
+	for _, pdu := range result.Variables {
+		switch pdu.Name {
+		case oidSysDescr:
+			metrics.SysDescr = snmpString(pdu)
+		case oidSysName:
+			metrics.SysName = snmpString(pdu)
+		case oidSysUpTime:
+			// sysUpTime is in hundredths of a second
+			metrics.UptimeSeconds = int64(snmpUint(pdu) / 100)
+		}
+	}
+
+	metrics.CPUUsage = p.pollCPU(client)
+
+	interfaces, err := p.pollInterfaces(client)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Interfaces = interfaces
+
+	return metrics, nil
+}
+
+// pollCPU averages the standard host resources processor load, falling back
+// to vendor OIDs for gear that does not implement HOST-RESOURCES-MIB
+func (p *SNMPPoller) pollCPU(client *gosnmp.GoSNMP) float64 {
+	for _, oid := range []string{oidHrProcessorLoad, oidCiscoCPUTotal5m, oidJuniperCPULoad} {
+		values, err := walkTable(client, oid)
+		if err != nil || len(values) == 0 {
+			continue
+		}
+		var sum float64
+		for _, pdu := range values {
+			sum += float64(snmpUint(pdu))
+		}
+		return sum / float64(len(values))
+	}
+	return -1
+}
+
+// pollInterfaces reads the interface table, preferring 64-bit counters
+func (p *SNMPPoller) pollInterfaces(client *gosnmp.GoSNMP) ([]InterfaceCounters, error) {
+	descr, err := walkTable(client, oidIfDescr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk interface table: %w", err)
+	}
+
+	tables := make(map[string]map[int]gosnmp.SnmpPDU)
+	for _, oid := range []string{
+		oidIfName, oidIfSpeed, oidIfHighSpeed, oidIfOperStatus,
+		oidIfInOctets, oidIfOutOctets, oidIfHCInOctets, oidIfHCOutOctets,
+		oidIfInErrors, oidIfOutErrors, oidIfInDiscards, oidIfOutDiscards,
+	} {
+		values, err := walkTable(client, oid)
+		if err != nil {
+			p.logger.Debug("Failed to walk SNMP table", zap.String("oid", oid), zap.Error(err))
+			continue
+		}
+		tables[oid] = values
+	}
+
+	value := func(oid string, index int) (gosnmp.SnmpPDU, bool) {
+		pdu, ok := tables[oid][index]
+		return pdu, ok
+	}
+	counter := func(hc, legacy string, index int) uint64 {
+		if pdu, ok := value(hc, index); ok {
+			return snmpUint(pdu)
+		}
+		if pdu, ok := value(legacy, index); ok {
+			return snmpUint(pdu)
+		}
+		return 0
+	}
+
+	interfaces := make([]InterfaceCounters, 0, len(descr))
+	for index, pdu := range descr {
+		iface := InterfaceCounters{
+			Index:       index,
+			Name:        snmpString(pdu),
+			InOctets:    counter(oidIfHCInOctets, oidIfInOctets, index),
+			OutOctets:   counter(oidIfHCOutOctets, oidIfOutOctets, index),
+			InErrors:    counter(oidIfInErrors, "", index),
+			OutErrors:   counter(oidIfOutErrors, "", index),
+			InDiscards:  counter(oidIfInDiscards, "", index),
+			OutDiscards: counter(oidIfOutDiscards, "", index),
+		}
+		if name, ok := value(oidIfName, index); ok && snmpString(name) != "" {
+			iface.Name = snmpString(name)
+		}
+		if high, ok := value(oidIfHighSpeed, index); ok && snmpUint(high) > 0 {
+			iface.SpeedBps = snmpUint(high) * 1000000
+		} else if speed, ok := value(oidIfSpeed, index); ok {
+			iface.SpeedBps = snmpUint(speed)
+		}
+		if status, ok := value(oidIfOperStatus, index); ok {
+			iface.OperStatus = ifOperStatus(snmpUint(status))
+		}
+		interfaces = append(interfaces, iface)
+	}
+
+	return interfaces, nil
+}
+
+// computeRates derives per-second rates from the previous poll
+func (p *SNMPPoller) computeRates(current, previous *DeviceMetrics) {
+	if previous == nil || previous.Error != "" || current.Error != "" {
+		return
+	}
+	elapsed := current.Timestamp.Sub(previous.Timestamp).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	prev := make(map[int]InterfaceCounters, len(previous.Interfaces))
+	for _, iface := range previous.Interfaces {
+		prev[iface.Index] = iface
+	}
+
+	for i := range current.Interfaces {
+		iface := &current.Interfaces[i]
+		old, ok := prev[iface.Index]
+		// Counters that went backwards wrapped or the device rebooted
+		if !ok || iface.InOctets < old.InOctets || iface.OutOctets < old.OutOctets {
+			continue
+		}
+		iface.InRate = float64(iface.InOctets-old.InOctets) / elapsed
+		iface.OutRate = float64(iface.OutOctets-old.OutOctets) / elapsed
+		if iface.SpeedBps > 0 {
+			peak := iface.InRate
+			if iface.OutRate > peak {
+				peak = iface.OutRate
+			}
+			iface.Utilization = peak * 8 / float64(iface.SpeedBps) * 100
+		}
+	}
+}
+
+// newSNMPClient builds a client for a device without connecting
+func newSNMPClient(device SNMPDevice) (*gosnmp.GoSNMP, error) {
+	if device.Address == "" {
+		return nil, fmt.Errorf("address required")
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:         device.Address,
+		Port:           device.Port,
+		Timeout:        device.Timeout,
+		Retries:        device.Retries,
+		MaxRepetitions: 25,
+	}
+	if client.Port == 0 {
+		client.Port = snmpDefaultPort
+	}
+	if client.Timeout <= 0 {
+		client.Timeout = snmpDefaultTimeout
+	}
+
+	switch device.Version {
+	case "", "2c", "v2c":
+		client.Version = gosnmp.Version2c
+		client.Community = device.Community
+		if client.Community == "" {
+			client.Community = "public"
+		}
+	case "3", "v3":
+		if device.Username == "" {
+			return nil, fmt.Errorf("username required for SNMPv3")
+		}
+		params := &gosnmp.UsmSecurityParameters{
+			UserName:                 device.Username,
+			AuthenticationPassphrase: device.AuthPassphrase,
+			PrivacyPassphrase:        device.PrivPassphrase,
+		}
+
+		flags := gosnmp.NoAuthNoPriv
+		if device.AuthProtocol != "" {
+			auth, err := snmpAuthProtocol(device.AuthProtocol)
+			if err != nil {
+				return nil, err
+			}
+			params.AuthenticationProtocol = auth
+			flags = gosnmp.AuthNoPriv
+		}
+		if device.PrivProtocol != "" {
+			if flags == gosnmp.NoAuthNoPriv {
+				return nil, fmt.Errorf("privacy requires an authentication protocol")
+			}
+			priv, err := snmpPrivProtocol(device.PrivProtocol)
+			if err != nil {
+				return nil, err
+			}
+			params.PrivacyProtocol = priv
+			flags = gosnmp.AuthPriv
+		}
+
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		client.MsgFlags = flags
+		client.SecurityParameters = params
+	default:
+		return nil, fmt.Errorf("unsupported SNMP version %q", device.Version)
+	}
+
+	return client, nil
+}
+
+func snmpAuthProtocol(name string) (gosnmp.SnmpV3AuthProtocol, error) {
+	switch strings.ToUpper(name) {
+	case "MD5":
+		return gosnmp.MD5, nil
+	case "SHA", "SHA1":
+		return gosnmp.SHA, nil
+	case "SHA256":
+		return gosnmp.SHA256, nil
+	case "SHA512":
+		return gosnmp.SHA512, nil
+	default:
+		return gosnmp.NoAuth, fmt.Errorf("unsupported SNMPv3 auth protocol %q", name)
+	}
+}
+
+func snmpPrivProtocol(name string) (gosnmp.SnmpV3PrivProtocol, error) {
+	switch strings.ToUpper(name) {
+	case "DES":
+		return gosnmp.DES, nil
+	case "AES", "AES128":
+		return gosnmp.AES, nil
+	case "AES256":
+		return gosnmp.AES256, nil
+	default:
+		return gosnmp.NoPriv, fmt.Errorf("unsupported SNMPv3 privacy protocol %q", name)
+	}
+}
+
+// walkTable bulk-walks a table column and keys the results by row index
+func walkTable(client *gosnmp.GoSNMP, oid string) (map[int]gosnmp.SnmpPDU, error) {
+	values := make(map[int]gosnmp.SnmpPDU)
+	err := client.BulkWalk(oid, func(pdu gosnmp.SnmpPDU) error {
+		if pdu.Type == gosnmp.NoSuchObject || pdu.Type == gosnmp.NoSuchInstance || pdu.Type == gosnmp.EndOfMibView {
+			return nil
+		}
+		dot := strings.LastIndex(pdu.Name, ".")
+		index, err := strconv.Atoi(pdu.Name[dot+1:])
+		if err != nil {
+			return nil
+		}
+		values[index] = pdu
+		return nil
+	})
+	return values, err
+}
+
+func snmpString(pdu gosnmp.SnmpPDU) string {
+	if b, ok := pdu.Value.([]byte); ok {
+		return strings.TrimSpace(string(b))
+	}
+	if s, ok := pdu.Value.(string); ok {
+		return s
+	}
+	return ""
+}
+
+func snmpUint(pdu gosnmp.SnmpPDU) uint64 {
+	return gosnmp.ToBigInt(pdu.Value).Uint64()
+}
+
+// ifOperStatus names an IF-MIB ifOperStatus value
+func ifOperStatus(status uint64) string {
+	switch status {
+	case 1:
+		return "up"
+	case 2:
+		return "down"
+	case 3:
+		return "testing"
+	case 5:
+		return "dormant"
+	case 6:
+		return "notPresent"
+	case 7:
+		return "lowerLayerDown"
+	default:
+		return "unknown"
+	}
+}
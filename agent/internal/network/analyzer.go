@@ -2,13 +2,14 @@ package network
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcap"
 	"github.com/shirou/gopsutil/v3/net"
 	"go.uber.org/zap"
 )
@@ -39,6 +40,8 @@ type Flow struct {
 	StartTime   time.Time   `json:"start_time"`
 	LastSeen    time.Time   `json:"last_seen"`
 	State       string      `json:"state"`
+	AppProtocol ProtocolType `json:"app_protocol,omitempty"`
+	ServiceName string      `json:"service_name,omitempty"` // TLS SNI or HTTP Host
 }
 
 // Connection represents a network connection
@@ -56,36 +59,51 @@ type Connection struct {
 // Analyzer analyzes network traffic
 type Analyzer struct {
 	logger       *zap.Logger
-	handle       *pcap.Handle
+	handle       capture
 	flows        map[string]*Flow
 	connections  map[string]*Connection
 	mu           sync.RWMutex
 	snapLen      int32
 	promiscuous  bool
-	timeout      time.Duration
 	bpfFilter    string
+	mode         string
+	stats        *ProtocolStats
+	dns          *dnsTracker
+	flowTable    *flowTable
+	listeners    *listenerTracker
+	events       chan<- interface{}
 }
 
-// NewAnalyzer creates a new network analyzer
-func NewAnalyzer(logger *zap.Logger) *Analyzer {
+// NewAnalyzer creates a new network analyzer. Alerts such as DNSAlert and
+// PortChange are sent on events.
+func NewAnalyzer(logger *zap.Logger, events chan<- interface{}) *Analyzer {
 	return &Analyzer{
 		logger:      logger,
 		flows:       make(map[string]*Flow),
 		connections: make(map[string]*Connection),
+		dns:         newDNSTracker(),
+		flowTable:   newFlowTable(),
+		listeners:   newListenerTracker(),
+		events:      events,
 		snapLen:     65535,
 		promiscuous: true,
-		timeout:     pcap.BlockForever,
 	}
 }
 
-// Start begins network analysis
+// Start begins network analysis. When the interface cannot be opened for
+// capture (built without the pcap tag, no libpcap or insufficient
+// privileges) the analyzer falls back to polling the socket table.
 func (a *Analyzer) Start(ctx context.Context, iface string) error {
 	// Open device
-	handle, err := pcap.OpenLive(iface, a.snapLen, a.promiscuous, a.timeout)
+	handle, err := a.openCapture(iface)
+	go a.runEviction(ctx)
+
 	if err != nil {
-		return fmt.Errorf("failed to open interface: %w", err)
+		a.startFallback(ctx, fmt.Errorf("failed to open interface: %w", err))
+		return nil
 	}
 	a.handle = handle
+	a.mode = ModePcap
 
 	// Set BPF filter if configured
 	if a.bpfFilter != "" {
@@ -112,6 +130,10 @@ func (a *Analyzer) processPackets(ctx context.Context, source *gopacket.PacketSo
 			return
 		default:
 			packet, err := source.NextPacket()
+			if errors.Is(err, io.EOF) {
+				// The capture was closed
+				return
+			}
 			if err != nil {
 				a.logger.Error("Failed to read packet",
 					zap.Error(err))
@@ -135,13 +157,16 @@ func (a *Analyzer) analyzePacket(packet gopacket.Packet) {
 	// Get transport layer
 	var protocol ProtocolType
 	var srcPort, dstPort uint16
+	var payload []byte
+	var tcp *layers.TCP
 
 	tcpLayer := packet.Layer(layers.LayerTypeTCP)
 	if tcpLayer != nil {
 		protocol = ProtocolTCP
-		tcp, _ := tcpLayer.(*layers.TCP)
+		tcp, _ = tcpLayer.(*layers.TCP)
 		srcPort = uint16(tcp.SrcPort)
 		dstPort = uint16(tcp.DstPort)
+		payload = tcp.Payload
 	}
 
 	udpLayer := packet.Layer(layers.LayerTypeUDP)
@@ -152,30 +177,61 @@ func (a *Analyzer) analyzePacket(packet gopacket.Packet) {
 		dstPort = uint16(udp.DstPort)
 	}
 
-	// Create flow key
-	flowKey := fmt.Sprintf("%s-%s:%d-%s:%d",
-		protocol,
-		ip.SrcIP.String(), srcPort,
-		ip.DstIP.String(), dstPort)
+	if srcPort == 53 || dstPort == 53 {
+		a.analyzeDNS(packet, ip.SrcIP.String(), ip.DstIP.String())
+	}
+
+	srcIP, dstIP := ip.SrcIP.String(), ip.DstIP.String()
+	now := time.Now()
 
-	// Update flow statistics
+	// Update flow statistics. Packets in either direction belong to the same
+	// flow, oriented from the side that opened it.
 	a.mu.Lock()
-	flow, ok := a.flows[flowKey]
-	if !ok {
+	flow, key, outbound := a.lookupFlow(protocol, srcIP, srcPort, dstIP, dstPort)
+	if flow == nil {
 		flow = &Flow{
 			Protocol:  protocol,
-			SrcIP:     ip.SrcIP.String(),
-			DstIP:     ip.DstIP.String(),
+			SrcIP:     srcIP,
+			DstIP:     dstIP,
 			SrcPort:   srcPort,
 			DstPort:   dstPort,
-			StartTime: time.Now(),
+			StartTime: now,
+		}
+		// A SYN-ACK as the first packet means we missed the SYN; the
+		// sender is the responder
+		if tcp != nil && tcp.SYN && tcp.ACK {
+			flow.SrcIP, flow.DstIP = dstIP, srcIP
+			flow.SrcPort, flow.DstPort = dstPort, srcPort
+			key = flowKey(protocol, dstIP, dstPort, srcIP, srcPort)
+			outbound = false
 		}
-		a.flows[flowKey] = flow
+		a.insertFlow(key, flow)
+	} else {
+		a.touchFlow(key)
 	}
 
-	flow.LastSeen = time.Now()
-	flow.PacketsSent++
-	flow.BytesSent += uint64(len(packet.Data()))
+	flow.LastSeen = now
+	if outbound {
+		flow.PacketsSent++
+		flow.BytesSent += uint64(len(packet.Data()))
+	} else {
+		flow.PacketsRecv++
+		flow.BytesRecv += uint64(len(packet.Data()))
+	}
+	if tcp != nil {
+		flow.State = tcpState(tcp.SYN, tcp.ACK, tcp.FIN, tcp.RST, flow.State)
+	}
+
+	// The service name is sent early in the connection, so stop looking once found
+	if flow.ServiceName == "" && outbound && len(payload) > 0 {
+		if name, ok := parseTLSServerName(payload); ok {
+			flow.AppProtocol = ProtocolTLS
+			flow.ServiceName = name
+		} else if host, ok := parseHTTPHost(payload); ok {
+			flow.AppProtocol = ProtocolHTTP
+			flow.ServiceName = host
+		}
+	}
 
 	a.mu.Unlock()
 }
@@ -204,6 +260,8 @@ func (a *Analyzer) trackConnections(ctx context.Context) {
 
 // updateConnections updates connection tracking
 func (a *Analyzer) updateConnections(conns []net.ConnectionStat) {
+	a.updateListeners(conns)
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -212,7 +270,7 @@ func (a *Analyzer) updateConnections(conns []net.ConnectionStat) {
 
 	for _, conn := range conns {
 		key := fmt.Sprintf("%s-%s-%s",
-			conn.Type,
+			connProtocol(conn),
 			conn.Laddr,
 			conn.Raddr)
 
@@ -220,7 +278,7 @@ func (a *Analyzer) updateConnections(conns []net.ConnectionStat) {
 		c, ok := a.connections[key]
 		if !ok {
 			c = &Connection{
-				Protocol:   ProtocolType(conn.Type),
+				Protocol:   connProtocol(conn),
 				LocalAddr:  conn.Laddr.String(),
 				RemoteAddr: conn.Raddr.String(),
 				State:     conn.Status,
@@ -284,7 +342,7 @@ func (a *Analyzer) Shutdown(ctx context.Context) error {
 
 // HealthCheck implements the health.Checker interface
 func (a *Analyzer) HealthCheck(ctx context.Context) error {
-	if a.handle == nil {
+	if a.handle == nil && a.Mode() != ModeProc {
 		return fmt.Errorf("packet capture not initialized")
 	}
 	return nil
@@ -0,0 +1,15 @@
+package network
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// capture is a live packet source. Packet capture needs libpcap and cgo, so
+// it is only built with the pcap tag; other builds poll the socket table.
+type capture interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+	SetBPFFilter(expr string) error
+	Close()
+}
@@ -0,0 +1,13 @@
+//go:build !pcap
+
+package network
+
+import (
+	"errors"
+)
+
+// openCapture fails without the pcap build tag, leaving the socket table
+// fallback
+func (a *Analyzer) openCapture(iface string) (capture, error) {
+	return nil, errors.New("built without packet capture support, rebuild with -tags pcap")
+}
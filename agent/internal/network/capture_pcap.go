@@ -0,0 +1,16 @@
+//go:build pcap
+
+package network
+
+import (
+	"github.com/google/gopacket/pcap"
+)
+
+// openCapture opens iface for live capture with libpcap
+func (a *Analyzer) openCapture(iface string) (capture, error) {
+	handle, err := pcap.OpenLive(iface, a.snapLen, a.promiscuous, pcap.BlockForever)
+	if err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
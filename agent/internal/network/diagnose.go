@@ -0,0 +1,344 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// DNSCheck represents a resolution of the target against one resolver
+type DNSCheck struct {
+	Server    string        `json:"server"` // "system" for the OS resolver
+	Addresses []string      `json:"addresses,omitempty"`
+	CNAME     string        `json:"cname,omitempty"`
+	Latency   time.Duration `json:"latency"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// TraceHop represents one hop of a traceroute
+type TraceHop struct {
+	TTL     int           `json:"ttl"`
+	Address string        `json:"address,omitempty"` // empty when the hop did not answer
+	RTT     time.Duration `json:"rtt,omitempty"`
+}
+
+// TCPCheck represents a TCP connection attempt to the target
+type TCPCheck struct {
+	Address string        `json:"address"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// DiagnosticReport represents the result of a net:diagnose command
+type DiagnosticReport struct {
+	Target         string        `json:"target"`
+	DNS            []DNSCheck    `json:"dns"`
+	Traceroute     []TraceHop    `json:"traceroute,omitempty"`
+	TracerouteTool string        `json:"traceroute_tool,omitempty"`
+	TracerouteErr  string        `json:"traceroute_error,omitempty"`
+	PathMTU        int           `json:"path_mtu,omitempty"`
+	PathMTUErr     string        `json:"path_mtu_error,omitempty"`
+	TCP            *TCPCheck     `json:"tcp,omitempty"`
+	Duration       time.Duration `json:"duration"`
+	Timestamp      time.Time     `json:"timestamp"`
+}
+
+// Diagnostics runs connectivity checks from the agent's vantage point
+type Diagnostics struct {
+	logger  *zap.Logger
+	maxHops int
+	timeout time.Duration
+}
+
+// NewDiagnostics creates a diagnostics runner
+func NewDiagnostics(logger *zap.Logger) *Diagnostics {
+	return &Diagnostics{
+		logger:  logger,
+		maxHops: 30,
+		timeout: 2 * time.Minute,
+	}
+}
+
+// HandleCommand handles network diagnostic commands
+func (d *Diagnostics) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "net:diagnose":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "target required")
+		}
+		port := 0
+		if len(args) > 1 {
+			p, err := strconv.Atoi(args[1])
+			if err != nil || p < 1 || p > 65535 {
+				return nil, fmt.Errorf("invalid port: %s", args[1])
+			}
+			port = p
+		}
+		return d.Diagnose(ctx, args[0], port)
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown network command: %s", cmd)
+	}
+}
+
+// Diagnose resolves target, traces the route to it, discovers the path MTU
+// and, when port is non-zero, tests a TCP connection. The checks run
+// concurrently and each reports its own error.
+func (d *Diagnostics) Diagnose(ctx context.Context, target string, port int) (*DiagnosticReport, error) {
+	if target == "" || strings.ContainsAny(target, " \t;&|`$") || strings.HasPrefix(target, "-") {
+		return nil, fmt.Errorf("invalid target: %q", target)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	start := time.Now()
+	report := &DiagnosticReport{
+		Target:    target,
+		Timestamp: start,
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		report.DNS = d.checkDNS(ctx, target)
+	}()
+	go func() {
+		defer wg.Done()
+		hops, tool, err := d.traceroute(ctx, target)
+		report.Traceroute, report.TracerouteTool = hops, tool
+		if err != nil {
+			report.TracerouteErr = err.Error()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		mtu, err := d.pathMTU(ctx, target)
+		report.PathMTU = mtu
+		if err != nil {
+			report.PathMTUErr = err.Error()
+		}
+	}()
+	if port > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.TCP = checkTCP(ctx, target, port)
+		}()
+	}
+	wg.Wait()
+
+	report.Duration = time.Since(start)
+	d.logger.Info("Network diagnostics completed",
+		zap.String("target", target),
+		zap.Duration("duration", report.Duration))
+	return report, nil
+}
+
+// checkDNS resolves target with the system resolver and each configured
+// nameserver so split-horizon or broken resolvers show up
+func (d *Diagnostics) checkDNS(ctx context.Context, target string) []DNSCheck {
+	if ip := net.ParseIP(target); ip != nil {
+		start := time.Now()
+		names, err := net.DefaultResolver.LookupAddr(ctx, target)
+		check := DNSCheck{Server: "system", Addresses: names, Latency: time.Since(start)}
+		if err != nil {
+			check.Error = err.Error()
+		}
+		return []DNSCheck{check}
+	}
+
+	checks := []DNSCheck{resolveWith(ctx, net.DefaultResolver, "system", target)}
+	for _, server := range systemNameservers() {
+		server := net.JoinHostPort(server, "53")
+		resolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				dialer := net.Dialer{Timeout: 5 * time.Second}
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+		checks = append(checks, resolveWith(ctx, resolver, server, target))
+	}
+	return checks
+}
+
+func resolveWith(ctx context.Context, resolver *net.Resolver, server, target string) DNSCheck {
+	check := DNSCheck{Server: server}
+
+	start := time.Now()
+	addrs, err := resolver.LookupIPAddr(ctx, target)
+	check.Latency = time.Since(start)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	for _, addr := range addrs {
+		check.Addresses = append(check.Addresses, addr.IP.String())
+	}
+	if cname, err := resolver.LookupCNAME(ctx, target); err == nil && strings.TrimSuffix(cname, ".") != target {
+		check.CNAME = strings.TrimSuffix(cname, ".")
+	}
+	return check
+}
+
+// systemNameservers returns the nameservers in /etc/resolv.conf
+func systemNameservers() []string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+var (
+	hopLine = regexp.MustCompile(`^\s*(\d+)\??:?\s+(.*)$`)
+	hopAddr = regexp.MustCompile(`(\d{1,3}(?:\.\d{1,3}){3}|[0-9a-fA-F:]*:[0-9a-fA-F:]+)`)
+	hopRTT  = regexp.MustCompile(`<?([\d.]+)\s*ms`)
+)
+
+// traceroute runs the platform traceroute tool and parses its hops
+func (d *Diagnostics) traceroute(ctx context.Context, target string) ([]TraceHop, string, error) {
+	var tool string
+	var args []string
+	switch {
+	case runtime.GOOS == "windows":
+		tool, args = "tracert", []string{"-d", "-h", strconv.Itoa(d.maxHops), "-w", "1000", target}
+	case lookPath("traceroute"):
+		tool, args = "traceroute", []string{"-n", "-q", "1", "-w", "1", "-m", strconv.Itoa(d.maxHops), target}
+	case lookPath("tracepath"):
+		tool, args = "tracepath", []string{"-n", "-m", strconv.Itoa(d.maxHops), target}
+	default:
+		return nil, "", fmt.Errorf("no traceroute tool available")
+	}
+
+	output, err := exec.CommandContext(ctx, tool, args...).Output()
+	hops := parseTraceroute(output)
+	if err != nil && len(hops) == 0 {
+		return nil, tool, fmt.Errorf("%s failed: %w", tool, err)
+	}
+	return hops, tool, nil
+}
+
+// parseTraceroute parses traceroute, tracepath and tracert output
+func parseTraceroute(output []byte) []TraceHop {
+	var hops []TraceHop
+	seen := make(map[int]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		m := hopLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		ttl, err := strconv.Atoi(m[1])
+		if err != nil || seen[ttl] {
+			continue
+		}
+		// tracepath prints a [LOCALHOST] line before the route
+		rest := m[2]
+		if strings.Contains(rest, "[LOCALHOST]") {
+			continue
+		}
+
+		hop := TraceHop{TTL: ttl}
+		if addr := hopAddr.FindString(rest); addr != "" && !strings.Contains(rest, "no reply") {
+			hop.Address = addr
+		}
+		if rtt := hopRTT.FindStringSubmatch(rest); rtt != nil {
+			if ms, err := strconv.ParseFloat(rtt[1], 64); err == nil {
+				hop.RTT = time.Duration(ms * float64(time.Millisecond))
+			}
+		}
+		seen[ttl] = true
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// pathMTU binary searches the largest packet that reaches target with the
+// don't-fragment bit set
+func (d *Diagnostics) pathMTU(ctx context.Context, target string) (int, error) {
+	if !lookPath("ping") {
+		return 0, fmt.Errorf("ping not available")
+	}
+
+	// 28 bytes of IPv4 and ICMP headers sit on top of the ping payload
+	const overhead = 28
+	lo, hi := 576-overhead, 9000-overhead
+
+	if !pingDF(ctx, target, lo) {
+		return 0, fmt.Errorf("target did not answer a %d byte ping", lo+overhead)
+	}
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if pingDF(ctx, target, mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+	}
+	return lo + overhead, nil
+}
+
+// pingDF sends a single ping of size payload bytes with fragmentation prohibited
+func pingDF(ctx context.Context, target string, size int) bool {
+	var args []string
+	switch runtime.GOOS {
+	case "windows":
+		args = []string{"-n", "1", "-w", "1000", "-f", "-l", strconv.Itoa(size), target}
+	case "darwin", "freebsd":
+		args = []string{"-c", "1", "-t", "1", "-D", "-s", strconv.Itoa(size), target}
+	default:
+		args = []string{"-c", "1", "-W", "1", "-M", "do", "-s", strconv.Itoa(size), target}
+	}
+	return exec.CommandContext(ctx, "ping", args...).Run() == nil
+}
+
+func checkTCP(ctx context.Context, target string, port int) *TCPCheck {
+	address := net.JoinHostPort(target, strconv.Itoa(port))
+	check := &TCPCheck{Address: address}
+
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	check.Latency = time.Since(start)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	conn.Close()
+	return check
+}
+
+func lookPath(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,368 @@
+package network
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"go.uber.org/zap"
+)
+
+const (
+	dnsLogSize        = 1000
+	dnsPendingTimeout = 30 * time.Second
+	dnsTopDomains     = 20
+	dnsMaxPending     = 10000 // queries awaiting a response, further ones aren't matched
+	dnsMaxClients     = 4096  // clients with statistics, least recently seen evicted
+	dnsMaxDomains     = 512   // domains counted per client, least recently queried evicted
+)
+
+// DNSQuery represents an observed DNS lookup and its answer
+type DNSQuery struct {
+	Client       string        `json:"client"`
+	Server       string        `json:"server"`
+	Domain       string        `json:"domain"`
+	Type         string        `json:"type"`
+	ResponseCode string        `json:"response_code,omitempty"`
+	Answers      []string      `json:"answers,omitempty"`
+	Latency      time.Duration `json:"latency"`
+	Answered     bool          `json:"answered"`
+	Timestamp    time.Time     `json:"timestamp"`
+}
+
+// DNSClientStats represents lookup statistics for one client
+type DNSClientStats struct {
+	Client     string           `json:"client"`
+	Queries    uint64           `json:"queries"`
+	Failures   uint64           `json:"failures"` // any response code other than NOERROR
+	AvgLatency time.Duration    `json:"avg_latency"`
+	TopDomains map[string]int64 `json:"top_domains"`
+}
+
+// DNSWatchlist represents domains that raise alerts when looked up. Entries
+// match the domain and all of its subdomains; Allow overrides Deny.
+type DNSWatchlist struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// DNSAlert is emitted when a client looks up a denied domain
+type DNSAlert struct {
+	Client    string    `json:"client"`
+	Domain    string    `json:"domain"`
+	Rule      string    `json:"rule"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type dnsPending struct {
+	query *DNSQuery
+	sent  time.Time
+}
+
+type dnsClient struct {
+	queries      uint64
+	failures     uint64
+	answered     uint64
+	totalLatency time.Duration
+	domains      map[string]int64
+	recent       *dnsLRU // domains by recency
+}
+
+// dnsTracker matches queries to responses and keeps per-client statistics
+type dnsTracker struct {
+	pending   map[string]*dnsPending
+	clients   map[string]*dnsClient
+	recent    *dnsLRU // clients by recency
+	log       []DNSQuery
+	next      int
+	watchlist DNSWatchlist
+	mu        sync.Mutex
+}
+
+func newDNSTracker() *dnsTracker {
+	return &dnsTracker{
+		pending: make(map[string]*dnsPending),
+		clients: make(map[string]*dnsClient),
+		recent:  newDNSLRU(dnsMaxClients),
+	}
+}
+
+// dnsLRU orders keys by recency for evicting the least recent once full
+type dnsLRU struct {
+	max      int
+	order    *list.List // keys, most recent at the front
+	elements map[string]*list.Element
+}
+
+func newDNSLRU(max int) *dnsLRU {
+	return &dnsLRU{
+		max:      max,
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// touch marks key as the most recent, returning the key evicted to make
+// room for it, if any
+func (l *dnsLRU) touch(key string) (string, bool) {
+	if elem, ok := l.elements[key]; ok {
+		l.order.MoveToFront(elem)
+		return "", false
+	}
+	l.elements[key] = l.order.PushFront(key)
+	if l.order.Len() <= l.max {
+		return "", false
+	}
+	oldest := l.order.Back()
+	l.order.Remove(oldest)
+	evicted := oldest.Value.(string)
+	delete(l.elements, evicted)
+	return evicted, true
+}
+
+// analyzeDNS records DNS queries and responses carried by packet
+func (a *Analyzer) analyzeDNS(packet gopacket.Packet, srcIP, dstIP string) {
+	dnsLayer := packet.Layer(layers.LayerTypeDNS)
+	if dnsLayer == nil {
+		return
+	}
+	dns, ok := dnsLayer.(*layers.DNS)
+	if !ok || len(dns.Questions) == 0 {
+		return
+	}
+
+	now := time.Now()
+	if md := packet.Metadata(); md != nil && !md.Timestamp.IsZero() {
+		now = md.Timestamp
+	}
+
+	question := dns.Questions[0]
+	domain := strings.ToLower(strings.TrimSuffix(string(question.Name), "."))
+
+	t := a.dns
+	t.mu.Lock()
+
+	if !dns.QR {
+		// Query: remember it until the response arrives. Unanswered
+		// queries are expired by the eviction ticker.
+		key := fmt.Sprintf("%s-%s-%d", srcIP, dstIP, dns.ID)
+		if len(t.pending) < dnsMaxPending {
+			t.pending[key] = &dnsPending{
+				query: &DNSQuery{
+					Client:    srcIP,
+					Server:    dstIP,
+					Domain:    domain,
+					Type:      question.Type.String(),
+					Timestamp: now,
+				},
+				sent: now,
+			}
+		}
+
+		client := t.client(srcIP)
+		client.queries++
+		client.domains[domain]++
+		if evicted, ok := client.recent.touch(domain); ok {
+			delete(client.domains, evicted)
+		}
+
+		alert := t.check(srcIP, domain, question.Type.String(), now)
+		t.mu.Unlock()
+
+		if alert != nil {
+			a.emitDNSAlert(*alert)
+		}
+		return
+	}
+
+	// Response: the client is the destination
+	key := fmt.Sprintf("%s-%s-%d", dstIP, srcIP, dns.ID)
+	pending, ok := t.pending[key]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.pending, key)
+
+	query := pending.query
+	query.Answered = true
+	query.ResponseCode = dns.ResponseCode.String()
+	query.Latency = now.Sub(pending.sent)
+	for _, answer := range dns.Answers {
+		switch {
+		case answer.IP != nil:
+			query.Answers = append(query.Answers, answer.IP.String())
+		case len(answer.CNAME) > 0:
+			query.Answers = append(query.Answers, string(answer.CNAME))
+		}
+	}
+
+	client := t.client(query.Client)
+	client.answered++
+	client.totalLatency += query.Latency
+	if dns.ResponseCode != layers.DNSResponseCodeNoErr {
+		client.failures++
+	}
+
+	t.record(*query)
+	t.mu.Unlock()
+}
+
+// client returns the stats for ip, creating them if needed and evicting
+// the least recently seen client once there are too many. The caller
+// holds t.mu.
+func (t *dnsTracker) client(ip string) *dnsClient {
+	c, ok := t.clients[ip]
+	if !ok {
+		c = &dnsClient{
+			domains: make(map[string]int64),
+			recent:  newDNSLRU(dnsMaxDomains),
+		}
+		t.clients[ip] = c
+	}
+	if evicted, ok := t.recent.touch(ip); ok {
+		delete(t.clients, evicted)
+	}
+	return c
+}
+
+// record appends a query to the bounded log. The caller holds t.mu.
+func (t *dnsTracker) record(query DNSQuery) {
+	if len(t.log) < dnsLogSize {
+		t.log = append(t.log, query)
+		return
+	}
+	t.log[t.next] = query
+	t.next = (t.next + 1) % dnsLogSize
+}
+
+// expire logs queries that never got a response
+func (t *dnsTracker) expire(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, pending := range t.pending {
+		if now.Sub(pending.sent) > dnsPendingTimeout {
+			delete(t.pending, key)
+			t.client(pending.query.Client).failures++
+			t.record(*pending.query)
+		}
+	}
+}
+
+// check matches domain against the watchlist. The caller holds t.mu.
+func (t *dnsTracker) check(client, domain, qtype string, now time.Time) *DNSAlert {
+	for _, rule := range t.watchlist.Allow {
+		if domainMatches(domain, rule) {
+			return nil
+		}
+	}
+	for _, rule := range t.watchlist.Deny {
+		if domainMatches(domain, rule) {
+			return &DNSAlert{
+				Client:    client,
+				Domain:    domain,
+				Rule:      rule,
+				Type:      qtype,
+				Timestamp: now,
+			}
+		}
+	}
+	return nil
+}
+
+// domainMatches reports whether domain equals rule or is a subdomain of it
+func domainMatches(domain, rule string) bool {
+	rule = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(rule, "*."), "."))
+	if rule == "" {
+		return false
+	}
+	return domain == rule || strings.HasSuffix(domain, "."+rule)
+}
+
+func (a *Analyzer) emitDNSAlert(alert DNSAlert) {
+	a.logger.Warn("Lookup of watched domain",
+		zap.String("client", alert.Client),
+		zap.String("domain", alert.Domain),
+		zap.String("rule", alert.Rule))
+
+	if a.events == nil {
+		return
+	}
+	select {
+	case a.events <- alert:
+	default:
+		a.logger.Warn("Failed to send DNS alert: channel full")
+	}
+}
+
+// SetDNSWatchlist replaces the DNS watchlist
+func (a *Analyzer) SetDNSWatchlist(watchlist DNSWatchlist) {
+	a.dns.mu.Lock()
+	defer a.dns.mu.Unlock()
+
+	a.dns.watchlist = watchlist
+}
+
+// GetDNSQueries returns the most recent DNS queries, oldest first
+func (a *Analyzer) GetDNSQueries() []DNSQuery {
+	t := a.dns
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	queries := make([]DNSQuery, 0, len(t.log))
+	queries = append(queries, t.log[t.next:]...)
+	queries = append(queries, t.log[:t.next]...)
+	return queries
+}
+
+// GetDNSStats returns lookup statistics per client
+func (a *Analyzer) GetDNSStats() []DNSClientStats {
+	t := a.dns
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make([]DNSClientStats, 0, len(t.clients))
+	for ip, c := range t.clients {
+		s := DNSClientStats{
+			Client:     ip,
+			Queries:    c.queries,
+			Failures:   c.failures,
+			TopDomains: topDomains(c.domains, dnsTopDomains),
+		}
+		if c.answered > 0 {
+			s.AvgLatency = c.totalLatency / time.Duration(c.answered)
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Queries > stats[j].Queries
+	})
+	return stats
+}
+
+// topDomains returns the n most queried domains
+func topDomains(domains map[string]int64, n int) map[string]int64 {
+	names := make([]string, 0, len(domains))
+	for name := range domains {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return domains[names[i]] > domains[names[j]]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+
+	top := make(map[string]int64, len(names))
+	for _, name := range names {
+		top[name] = domains[name]
+	}
+	return top
+}
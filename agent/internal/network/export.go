@@ -0,0 +1,359 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Flow export formats
+const (
+	ExportNetFlowV9 = "netflow9"
+	ExportIPFIX     = "ipfix"
+)
+
+const (
+	exportTemplateID  = 256
+	exportMaxPacket   = 1400
+	netflowHeaderLen  = 20
+	ipfixHeaderLen    = 16
+	setHeaderLen      = 4
+	netflowRecordLen  = 37
+	ipfixRecordLen    = 45
+	ieOctetDelta      = 1
+	iePacketDelta     = 2
+	ieProtocol        = 4
+	ieSrcPort         = 7
+	ieSrcIPv4         = 8
+	ieDstPort         = 11
+	ieDstIPv4         = 12
+	ieLastSwitched    = 21
+	ieFirstSwitched   = 22
+	ieFlowStartMillis = 152
+	ieFlowEndMillis   = 153
+)
+
+// ExportConfig represents flow export settings
+type ExportConfig struct {
+	Collector        string        // host:port of the NetFlow/IPFIX collector
+	Format           string        // netflow9 or ipfix
+	Interval         time.Duration // how often the flow table is flushed
+	TemplateInterval time.Duration // how often templates are resent
+	ObservationID    uint32        // NetFlow source ID / IPFIX observation domain
+}
+
+// exportRecord represents one unidirectional flow record
+type exportRecord struct {
+	src, dst         net.IP
+	srcPort, dstPort uint16
+	protocol         uint8
+	bytes, packets   uint64
+	start, end       time.Time
+}
+
+// exportCounters holds the counters last exported for a flow
+type exportCounters struct {
+	bytesSent, bytesRecv     uint64
+	packetsSent, packetsRecv uint64
+}
+
+// FlowExporter periodically exports the analyzer's flow table to a
+// NetFlow v9 or IPFIX collector over UDP
+type FlowExporter struct {
+	logger       *zap.Logger
+	analyzer     *Analyzer
+	config       ExportConfig
+	conn         net.Conn
+	bootTime     time.Time
+	sequence     uint32
+	lastTemplate time.Time
+	exported     map[string]exportCounters
+	mu           sync.Mutex
+}
+
+// NewFlowExporter creates an exporter for analyzer's flows
+func NewFlowExporter(logger *zap.Logger, analyzer *Analyzer, config ExportConfig) (*FlowExporter, error) {
+	switch config.Format {
+	case "":
+		config.Format = ExportIPFIX
+	case ExportNetFlowV9, ExportIPFIX:
+	default:
+		return nil, fmt.Errorf("unsupported flow export format %q", config.Format)
+	}
+	if config.Collector == "" {
+		return nil, fmt.Errorf("flow collector address required")
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.TemplateInterval <= 0 {
+		config.TemplateInterval = 5 * time.Minute
+	}
+
+	return &FlowExporter{
+		logger:   logger,
+		analyzer: analyzer,
+		config:   config,
+		bootTime: time.Now(),
+		exported: make(map[string]exportCounters),
+	}, nil
+}
+
+// Start connects to the collector and begins exporting
+func (e *FlowExporter) Start(ctx context.Context) error {
+	conn, err := net.Dial("udp", e.config.Collector)
+	if err != nil {
+		return fmt.Errorf("failed to connect to flow collector: %w", err)
+	}
+	e.conn = conn
+
+	go func() {
+		ticker := time.NewTicker(e.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := e.Export(); err != nil {
+					e.logger.Error("Flow export failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown flushes remaining flows and closes the connection
+func (e *FlowExporter) Shutdown(ctx context.Context) error {
+	if e.conn == nil {
+		return nil
+	}
+	if err := e.Export(); err != nil {
+		e.logger.Warn("Final flow export failed", zap.Error(err))
+	}
+	return e.conn.Close()
+}
+
+// Export sends the counters accumulated since the previous export
+func (e *FlowExporter) Export() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	records := e.collect()
+	if len(records) == 0 {
+		return nil
+	}
+
+	recordLen := ipfixRecordLen
+	headerLen := ipfixHeaderLen
+	if e.config.Format == ExportNetFlowV9 {
+		recordLen = netflowRecordLen
+		headerLen = netflowHeaderLen
+	}
+
+	for len(records) > 0 {
+		includeTemplate := time.Since(e.lastTemplate) >= e.config.TemplateInterval
+		space := exportMaxPacket - headerLen - setHeaderLen
+		if includeTemplate {
+			space -= len(e.template())
+		}
+
+		n := space / recordLen
+		if n > len(records) {
+			n = len(records)
+		}
+
+		packet := e.encode(records[:n], includeTemplate)
+		if _, err := e.conn.Write(packet); err != nil {
+			return fmt.Errorf("failed to send flow records: %w", err)
+		}
+		if includeTemplate {
+			e.lastTemplate = time.Now()
+		}
+		records = records[n:]
+	}
+	return nil
+}
+
+// collect converts flows to delta records. The caller holds e.mu.
+func (e *FlowExporter) collect() []exportRecord {
+	var records []exportRecord
+	seen := make(map[string]bool)
+
+	for _, flow := range e.analyzer.GetFlows() {
+		src := net.ParseIP(flow.SrcIP).To4()
+		dst := net.ParseIP(flow.DstIP).To4()
+		if src == nil || dst == nil {
+			// The templates only carry IPv4 addresses
+			continue
+		}
+
+		key := fmt.Sprintf("%s-%s:%d-%s:%d", flow.Protocol, flow.SrcIP, flow.SrcPort, flow.DstIP, flow.DstPort)
+		seen[key] = true
+		last := e.exported[key]
+		// Counters that went backwards belong to a new flow reusing the key
+		if flow.BytesSent < last.bytesSent || flow.BytesRecv < last.bytesRecv {
+			last = exportCounters{}
+		}
+
+		proto := ianaProtocol(flow.Protocol)
+		if flow.BytesSent > last.bytesSent {
+			records = append(records, exportRecord{
+				src: src, dst: dst,
+				srcPort: flow.SrcPort, dstPort: flow.DstPort,
+				protocol: proto,
+				bytes:    flow.BytesSent - last.bytesSent,
+				packets:  flow.PacketsSent - last.packetsSent,
+				start:    flow.StartTime,
+				end:      flow.LastSeen,
+			})
+		}
+		if flow.BytesRecv > last.bytesRecv {
+			records = append(records, exportRecord{
+				src: dst, dst: src,
+				srcPort: flow.DstPort, dstPort: flow.SrcPort,
+				protocol: proto,
+				bytes:    flow.BytesRecv - last.bytesRecv,
+				packets:  flow.PacketsRecv - last.packetsRecv,
+				start:    flow.StartTime,
+				end:      flow.LastSeen,
+			})
+		}
+
+		e.exported[key] = exportCounters{
+			bytesSent:   flow.BytesSent,
+			bytesRecv:   flow.BytesRecv,
+			packetsSent: flow.PacketsSent,
+			packetsRecv: flow.PacketsRecv,
+		}
+	}
+
+	// Forget flows the analyzer no longer tracks
+	for key := range e.exported {
+		if !seen[key] {
+			delete(e.exported, key)
+		}
+	}
+	return records
+}
+
+// template returns the template set/flowset for the configured format
+func (e *FlowExporter) template() []byte {
+	type field struct{ id, length uint16 }
+	fields := []field{
+		{ieSrcIPv4, 4}, {ieDstIPv4, 4}, {ieSrcPort, 2}, {ieDstPort, 2},
+		{ieProtocol, 1}, {ieOctetDelta, 8}, {iePacketDelta, 8},
+	}
+	setID := uint16(2)
+	if e.config.Format == ExportNetFlowV9 {
+		setID = 0
+		fields = append(fields, field{ieFirstSwitched, 4}, field{ieLastSwitched, 4})
+	} else {
+		fields = append(fields, field{ieFlowStartMillis, 8}, field{ieFlowEndMillis, 8})
+	}
+
+	b := make([]byte, 0, 8+4*len(fields))
+	b = binary.BigEndian.AppendUint16(b, setID)
+	b = binary.BigEndian.AppendUint16(b, uint16(8+4*len(fields)))
+	b = binary.BigEndian.AppendUint16(b, exportTemplateID)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(fields)))
+	for _, f := range fields {
+		b = binary.BigEndian.AppendUint16(b, f.id)
+		b = binary.BigEndian.AppendUint16(b, f.length)
+	}
+	return b
+}
+
+// encode builds one export packet. The caller holds e.mu.
+func (e *FlowExporter) encode(records []exportRecord, includeTemplate bool) []byte {
+	now := time.Now()
+	netflow := e.config.Format == ExportNetFlowV9
+
+	var body []byte
+	count := len(records)
+	if includeTemplate {
+		body = append(body, e.template()...)
+		count++
+	}
+
+	data := make([]byte, setHeaderLen)
+	binary.BigEndian.PutUint16(data, exportTemplateID)
+	for _, r := range records {
+		data = append(data, r.src...)
+		data = append(data, r.dst...)
+		data = binary.BigEndian.AppendUint16(data, r.srcPort)
+		data = binary.BigEndian.AppendUint16(data, r.dstPort)
+		data = append(data, r.protocol)
+		data = binary.BigEndian.AppendUint64(data, r.bytes)
+		data = binary.BigEndian.AppendUint64(data, r.packets)
+		if netflow {
+			data = binary.BigEndian.AppendUint32(data, e.uptimeMillis(r.start))
+			data = binary.BigEndian.AppendUint32(data, e.uptimeMillis(r.end))
+		} else {
+			data = binary.BigEndian.AppendUint64(data, uint64(r.start.UnixMilli()))
+			data = binary.BigEndian.AppendUint64(data, uint64(r.end.UnixMilli()))
+		}
+	}
+	// NetFlow v9 flowsets are padded to a 32-bit boundary
+	if netflow {
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	binary.BigEndian.PutUint16(data[2:], uint16(len(data)))
+	body = append(body, data...)
+
+	var header []byte
+	if netflow {
+		e.sequence++
+		header = make([]byte, netflowHeaderLen)
+		binary.BigEndian.PutUint16(header[0:], 9)
+		binary.BigEndian.PutUint16(header[2:], uint16(count))
+		binary.BigEndian.PutUint32(header[4:], e.uptimeMillis(now))
+		binary.BigEndian.PutUint32(header[8:], uint32(now.Unix()))
+		binary.BigEndian.PutUint32(header[12:], e.sequence)
+		binary.BigEndian.PutUint32(header[16:], e.config.ObservationID)
+	} else {
+		// IPFIX sequence numbers count data records, not packets
+		header = make([]byte, ipfixHeaderLen)
+		binary.BigEndian.PutUint16(header[0:], 10)
+		binary.BigEndian.PutUint16(header[2:], uint16(ipfixHeaderLen+len(body)))
+		binary.BigEndian.PutUint32(header[4:], uint32(now.Unix()))
+		binary.BigEndian.PutUint32(header[8:], e.sequence)
+		binary.BigEndian.PutUint32(header[12:], e.config.ObservationID)
+		e.sequence += uint32(len(records))
+	}
+
+	return append(header, body...)
+}
+
+// uptimeMillis converts t to milliseconds since the exporter started, the
+// NetFlow v9 sysUptime clock
+func (e *FlowExporter) uptimeMillis(t time.Time) uint32 {
+	if t.Before(e.bootTime) {
+		return 0
+	}
+	return uint32(t.Sub(e.bootTime).Milliseconds())
+}
+
+// ianaProtocol returns the IP protocol number for a flow protocol
+func ianaProtocol(p ProtocolType) uint8 {
+	switch p {
+	case ProtocolTCP:
+		return 6
+	case ProtocolUDP:
+		return 17
+	case ProtocolICMP:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,217 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"go.uber.org/zap"
+)
+
+// Capture modes
+const (
+	ModePcap = "pcap" // packet capture with payload analysis
+	ModeProc = "proc" // socket table polling, no payload analysis
+)
+
+// socket types reported by gopsutil
+const (
+	sockStream uint32 = 1
+	sockDgram  uint32 = 2
+)
+
+// ProtocolStats represents kernel protocol counters, keyed by section
+// (Tcp, Udp, Ip, TcpExt, ...) and counter name
+type ProtocolStats struct {
+	Counters   map[string]map[string]int64 `json:"counters"`
+	Interfaces []net.IOCountersStat        `json:"interfaces"`
+	Timestamp  time.Time                   `json:"timestamp"`
+}
+
+// startFallback tracks flows and connections by polling the socket table
+// when packet capture is unavailable
+func (a *Analyzer) startFallback(ctx context.Context, reason error) {
+	a.mu.Lock()
+	a.mode = ModeProc
+	a.mu.Unlock()
+
+	a.logger.Warn("Packet capture unavailable, falling back to socket table polling",
+		zap.Error(reason))
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			a.pollSockets()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// pollSockets refreshes connections and derives flows from them
+func (a *Analyzer) pollSockets() {
+	conns, err := net.Connections("inet")
+	if err != nil {
+		a.logger.Error("Failed to get connections", zap.Error(err))
+		return
+	}
+	a.updateConnections(conns)
+
+	stats, err := readProtocolStats()
+	if err != nil {
+		a.logger.Debug("Failed to read protocol statistics", zap.Error(err))
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if stats != nil {
+		a.stats = stats
+	}
+
+	for _, conn := range conns {
+		// Listening and unconnected sockets are not flows
+		if conn.Raddr.IP == "" || conn.Raddr.Port == 0 {
+			continue
+		}
+
+		protocol := connProtocol(conn)
+		key := flowKey(protocol,
+			conn.Laddr.IP, uint16(conn.Laddr.Port),
+			conn.Raddr.IP, uint16(conn.Raddr.Port))
+		seen[key] = true
+
+		flow, ok := a.flows[key]
+		if ok {
+			a.touchFlow(key)
+		} else {
+			flow = &Flow{
+				Protocol:  protocol,
+				SrcIP:     conn.Laddr.IP,
+				DstIP:     conn.Raddr.IP,
+				SrcPort:   uint16(conn.Laddr.Port),
+				DstPort:   uint16(conn.Raddr.Port),
+				StartTime: now,
+			}
+			a.insertFlow(key, flow)
+		}
+		flow.LastSeen = now
+		flow.State = conn.Status
+	}
+
+	// Flows whose socket disappeared have ended
+	for key, flow := range a.flows {
+		if !seen[key] && flow.State != "CLOSED" {
+			flow.State = "CLOSED"
+		}
+	}
+}
+
+// connProtocol maps a gopsutil socket type to a ProtocolType
+func connProtocol(conn net.ConnectionStat) ProtocolType {
+	switch conn.Type {
+	case sockStream:
+		return ProtocolTCP
+	case sockDgram:
+		return ProtocolUDP
+	default:
+		return ProtocolType(strconv.FormatUint(uint64(conn.Type), 10))
+	}
+}
+
+// readProtocolStats reads kernel protocol counters from /proc/net and
+// per-interface counters from gopsutil
+func readProtocolStats() (*ProtocolStats, error) {
+	stats := &ProtocolStats{
+		Counters:  make(map[string]map[string]int64),
+		Timestamp: time.Now(),
+	}
+
+	var firstErr error
+	for _, path := range []string{"/proc/net/snmp", "/proc/net/netstat"} {
+		if err := parseProcNetTable(path, stats.Counters); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	interfaces, err := net.IOCounters(true)
+	if err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to get interface counters: %w", err)
+	}
+	stats.Interfaces = interfaces
+
+	if len(stats.Counters) == 0 && len(stats.Interfaces) == 0 {
+		return nil, firstErr
+	}
+	return stats, nil
+}
+
+// parseProcNetTable parses the paired header/value lines used by
+// /proc/net/snmp and /proc/net/netstat:
+//
+//	Tcp: RtoAlgorithm RtoMin ...
+//	Tcp: 1 200 ...
+func parseProcNetTable(path string, counters map[string]map[string]int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	var header []string
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		if header == nil || header[0] != fields[0] {
+			header = fields
+			continue
+		}
+
+		section := strings.TrimSuffix(fields[0], ":")
+		if counters[section] == nil {
+			counters[section] = make(map[string]int64)
+		}
+		for i := 1; i < len(fields) && i < len(header); i++ {
+			if v, err := strconv.ParseInt(fields[i], 10, 64); err == nil {
+				counters[section][header[i]] = v
+			}
+		}
+		header = nil
+	}
+	return scanner.Err()
+}
+
+// Mode returns the capture mode in use
+func (a *Analyzer) Mode() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.mode
+}
+
+// GetProtocolStats returns the latest kernel protocol counters. They are
+// only collected in socket polling mode.
+func (a *Analyzer) GetProtocolStats() *ProtocolStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.stats
+}
@@ -0,0 +1,222 @@
+package network
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"time"
+)
+
+// FlowTableConfig represents flow table bounds
+type FlowTableConfig struct {
+	MaxFlows      int           // flows beyond this evict the least recently seen
+	IdleTimeout   time.Duration // flows with no traffic for this long are evicted
+	ClosedTimeout time.Duration // idle timeout for flows that saw FIN/RST or were closed
+	ActiveTimeout time.Duration // flows older than this are evicted even if active
+}
+
+// FlowTableStats represents flow table occupancy and eviction counters
+type FlowTableStats struct {
+	Flows          int    `json:"flows"`
+	MaxFlows       int    `json:"max_flows"`
+	Connections    int    `json:"connections"`
+	EvictedIdle    uint64 `json:"evicted_idle"`
+	EvictedActive  uint64 `json:"evicted_active"`
+	EvictedLRU     uint64 `json:"evicted_lru"`
+	EvictedClosed  uint64 `json:"evicted_closed"`
+	PendingDNS     int    `json:"pending_dns"`
+	DNSQueryLogLen int    `json:"dns_query_log_len"`
+}
+
+// flowTable tracks recency of flows for LRU eviction
+type flowTable struct {
+	config        FlowTableConfig
+	lru           *list.List // keys, most recently seen at the front
+	elements      map[string]*list.Element
+	evictedIdle   uint64
+	evictedActive uint64
+	evictedLRU    uint64
+	evictedClosed uint64
+}
+
+func newFlowTable() *flowTable {
+	return &flowTable{
+		config: FlowTableConfig{
+			MaxFlows:      50000,
+			IdleTimeout:   2 * time.Minute,
+			ClosedTimeout: 15 * time.Second,
+			ActiveTimeout: 30 * time.Minute,
+		},
+		lru:      list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// flowKey builds the table key for a flow oriented from src to dst
+func flowKey(protocol ProtocolType, srcIP string, srcPort uint16, dstIP string, dstPort uint16) string {
+	return fmt.Sprintf("%s-%s:%d-%s:%d", protocol, srcIP, srcPort, dstIP, dstPort)
+}
+
+// lookupFlow finds the flow a packet from src to dst belongs to. outbound is
+// false when the packet travels against the flow's orientation. The caller
+// holds a.mu.
+func (a *Analyzer) lookupFlow(protocol ProtocolType, srcIP string, srcPort uint16, dstIP string, dstPort uint16) (flow *Flow, key string, outbound bool) {
+	key = flowKey(protocol, srcIP, srcPort, dstIP, dstPort)
+	if flow, ok := a.flows[key]; ok {
+		return flow, key, true
+	}
+	reverse := flowKey(protocol, dstIP, dstPort, srcIP, srcPort)
+	if flow, ok := a.flows[reverse]; ok {
+		return flow, reverse, false
+	}
+	return nil, key, true
+}
+
+// insertFlow adds a flow, evicting the least recently seen flow when the
+// table is full. The caller holds a.mu.
+func (a *Analyzer) insertFlow(key string, flow *Flow) {
+	t := a.flowTable
+	for t.config.MaxFlows > 0 && len(a.flows) >= t.config.MaxFlows {
+		oldest := t.lru.Back()
+		if oldest == nil {
+			break
+		}
+		a.removeFlow(oldest.Value.(string))
+		t.evictedLRU++
+	}
+
+	a.flows[key] = flow
+	t.elements[key] = t.lru.PushFront(key)
+}
+
+// touchFlow marks a flow as recently seen. The caller holds a.mu.
+func (a *Analyzer) touchFlow(key string) {
+	if elem, ok := a.flowTable.elements[key]; ok {
+		a.flowTable.lru.MoveToFront(elem)
+	}
+}
+
+// removeFlow deletes a flow. The caller holds a.mu.
+func (a *Analyzer) removeFlow(key string) {
+	t := a.flowTable
+	if elem, ok := t.elements[key]; ok {
+		t.lru.Remove(elem)
+		delete(t.elements, key)
+	}
+	delete(a.flows, key)
+}
+
+// evictFlows removes idle, closed and long-lived flows
+func (a *Analyzer) evictFlows(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	t := a.flowTable
+	for key, flow := range a.flows {
+		idle := now.Sub(flow.LastSeen)
+		switch {
+		case isClosedState(flow.State) && idle > t.config.ClosedTimeout:
+			a.removeFlow(key)
+			t.evictedClosed++
+		case t.config.IdleTimeout > 0 && idle > t.config.IdleTimeout:
+			a.removeFlow(key)
+			t.evictedIdle++
+		case t.config.ActiveTimeout > 0 && now.Sub(flow.StartTime) > t.config.ActiveTimeout:
+			a.removeFlow(key)
+			t.evictedActive++
+		}
+	}
+}
+
+// runEviction evicts flows and unanswered DNS queries periodically until
+// ctx is done
+func (a *Analyzer) runEviction(ctx context.Context) {
+	interval := a.flowTableConfig().ClosedTimeout
+	if interval <= 0 || interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.evictFlows(now)
+			a.dns.expire(now)
+		}
+	}
+}
+
+func isClosedState(state string) bool {
+	switch state {
+	case "FIN", "RST", "CLOSED", "CLOSE", "TIME_WAIT", "CLOSE_WAIT", "LAST_ACK":
+		return true
+	}
+	return false
+}
+
+// tcpState derives a flow state from TCP flags
+func tcpState(syn, ack, fin, rst bool, current string) string {
+	switch {
+	case rst:
+		return "RST"
+	case fin:
+		return "FIN"
+	case syn && !ack:
+		return "SYN"
+	case syn && ack:
+		return "SYN_ACK"
+	case current == "" || current == "SYN" || current == "SYN_ACK":
+		return "ESTABLISHED"
+	default:
+		return current
+	}
+}
+
+func (a *Analyzer) flowTableConfig() FlowTableConfig {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.flowTable.config
+}
+
+// ConfigureFlowTable updates the flow table bounds, evicting immediately if
+// the table is over the new limit
+func (a *Analyzer) ConfigureFlowTable(config FlowTableConfig) {
+	a.mu.Lock()
+	a.flowTable.config = config
+	for config.MaxFlows > 0 && len(a.flows) > config.MaxFlows {
+		oldest := a.flowTable.lru.Back()
+		if oldest == nil {
+			break
+		}
+		a.removeFlow(oldest.Value.(string))
+		a.flowTable.evictedLRU++
+	}
+	a.mu.Unlock()
+}
+
+// GetFlowTableStats returns flow table occupancy and eviction counters
+func (a *Analyzer) GetFlowTableStats() FlowTableStats {
+	a.mu.RLock()
+	t := a.flowTable
+	stats := FlowTableStats{
+		Flows:         len(a.flows),
+		MaxFlows:      t.config.MaxFlows,
+		Connections:   len(a.connections),
+		EvictedIdle:   t.evictedIdle,
+		EvictedActive: t.evictedActive,
+		EvictedLRU:    t.evictedLRU,
+		EvictedClosed: t.evictedClosed,
+	}
+	a.mu.RUnlock()
+
+	a.dns.mu.Lock()
+	stats.PendingDNS = len(a.dns.pending)
+	stats.DNSQueryLogLen = len(a.dns.log)
+	a.dns.mu.Unlock()
+
+	return stats
+}
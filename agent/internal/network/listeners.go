@@ -0,0 +1,205 @@
+package network
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+	"go.uber.org/zap"
+)
+
+// Listening port change actions
+const (
+	PortOpened  = "opened"
+	PortClosed  = "closed"
+	PortChanged = "changed" // same port, different process
+)
+
+// listenerMissLimit is the number of polls a port must be absent before it
+// is reported closed, so service restarts don't raise close/open pairs
+const listenerMissLimit = 2
+
+// ListeningPort represents a socket accepting connections or datagrams
+type ListeningPort struct {
+	Protocol  ProtocolType `json:"protocol"`
+	Address   string       `json:"address"`
+	Port      uint32       `json:"port"`
+	ProcessID int32        `json:"process_id"`
+	Process   string       `json:"process,omitempty"`
+	FirstSeen time.Time    `json:"first_seen"`
+	missed    int
+}
+
+// PortChange is emitted when a listening port opens, closes or changes owner
+type PortChange struct {
+	Action    string         `json:"action"`
+	Port      ListeningPort  `json:"port"`
+	Previous  *ListeningPort `json:"previous,omitempty"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// listenerTracker keeps the set of listening sockets between polls
+type listenerTracker struct {
+	ports    map[string]*ListeningPort
+	baseline bool // set once the first poll has been recorded
+	mu       sync.Mutex
+}
+
+func newListenerTracker() *listenerTracker {
+	return &listenerTracker{
+		ports: make(map[string]*ListeningPort),
+	}
+}
+
+// isListening reports whether conn is a listening TCP socket or a bound,
+// unconnected UDP socket
+func isListening(conn net.ConnectionStat) bool {
+	switch connProtocol(conn) {
+	case ProtocolTCP:
+		return conn.Status == "LISTEN"
+	case ProtocolUDP:
+		return conn.Laddr.Port != 0 && conn.Raddr.Port == 0
+	default:
+		return false
+	}
+}
+
+// updateListeners diffs the listening sockets in conns against the previous
+// poll and emits a PortChange for each difference. The first poll only
+// records the baseline.
+func (a *Analyzer) updateListeners(conns []net.ConnectionStat) {
+	now := time.Now()
+	current := make(map[string]*ListeningPort)
+	names := make(map[int32]string)
+
+	for _, conn := range conns {
+		if !isListening(conn) {
+			continue
+		}
+		protocol := connProtocol(conn)
+		key := fmt.Sprintf("%s-%s:%d", protocol, conn.Laddr.IP, conn.Laddr.Port)
+		if _, ok := current[key]; ok {
+			// SO_REUSEPORT sockets share an address
+			continue
+		}
+
+		name, ok := names[conn.Pid]
+		if !ok {
+			name = processName(conn.Pid)
+			names[conn.Pid] = name
+		}
+		current[key] = &ListeningPort{
+			Protocol:  protocol,
+			Address:   conn.Laddr.IP,
+			Port:      conn.Laddr.Port,
+			ProcessID: conn.Pid,
+			Process:   name,
+			FirstSeen: now,
+		}
+	}
+
+	t := a.listeners
+	t.mu.Lock()
+
+	var changes []PortChange
+	for key, port := range current {
+		known, ok := t.ports[key]
+		switch {
+		case !ok:
+			t.ports[key] = port
+			if t.baseline {
+				changes = append(changes, PortChange{Action: PortOpened, Port: *port, Timestamp: now})
+			}
+		case known.ProcessID != port.ProcessID && port.ProcessID != 0 && known.ProcessID != 0:
+			previous := *known
+			port.FirstSeen = known.FirstSeen
+			t.ports[key] = port
+			if previous.Process != port.Process {
+				changes = append(changes, PortChange{Action: PortChanged, Port: *port, Previous: &previous, Timestamp: now})
+			}
+		default:
+			known.missed = 0
+			if known.ProcessID == 0 {
+				known.ProcessID, known.Process = port.ProcessID, port.Process
+			}
+		}
+	}
+	for key, known := range t.ports {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		known.missed++
+		if known.missed >= listenerMissLimit {
+			delete(t.ports, key)
+			changes = append(changes, PortChange{Action: PortClosed, Port: *known, Timestamp: now})
+		}
+	}
+	t.baseline = true
+	t.mu.Unlock()
+
+	for _, change := range changes {
+		a.emitPortChange(change)
+	}
+}
+
+// processName returns the name of pid, or "" when it cannot be read (the
+// agent usually needs root to see other users' sockets and processes)
+func processName(pid int32) string {
+	if pid <= 0 {
+		return ""
+	}
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return ""
+	}
+	name, err := p.Name()
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+func (a *Analyzer) emitPortChange(change PortChange) {
+	a.logger.Info("Listening port changed",
+		zap.String("action", change.Action),
+		zap.String("protocol", string(change.Port.Protocol)),
+		zap.String("address", change.Port.Address),
+		zap.Uint32("port", change.Port.Port),
+		zap.String("process", change.Port.Process),
+		zap.Int32("pid", change.Port.ProcessID))
+
+	if a.events == nil {
+		return
+	}
+	select {
+	case a.events <- change:
+	default:
+		a.logger.Warn("Failed to send port change: channel full")
+	}
+}
+
+// GetListeningPorts returns the listening sockets seen on the last poll,
+// ordered by protocol and port
+func (a *Analyzer) GetListeningPorts() []ListeningPort {
+	t := a.listeners
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ports := make([]ListeningPort, 0, len(t.ports))
+	for _, port := range t.ports {
+		ports = append(ports, *port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Protocol != ports[j].Protocol {
+			return ports[i].Protocol < ports[j].Protocol
+		}
+		if ports[i].Port != ports[j].Port {
+			return ports[i].Port < ports[j].Port
+		}
+		return ports[i].Address < ports[j].Address
+	})
+	return ports
+}
@@ -0,0 +1,141 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+)
+
+// httpMethods are the request line prefixes recognized as plain HTTP
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("HEAD "),
+	[]byte("DELETE "), []byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "),
+}
+
+// parseTLSServerName extracts the server_name extension from a TLS
+// ClientHello at the start of payload. Hellos split across segments are
+// not reassembled.
+func parseTLSServerName(payload []byte) (string, bool) {
+	// Record header: content type 22 (handshake), version, length
+	if len(payload) < 5 || payload[0] != 0x16 || payload[1] != 0x03 {
+		return "", false
+	}
+	data := payload[5:]
+
+	// Handshake header: type 1 (ClientHello), 24-bit length
+	if len(data) < 4 || data[0] != 0x01 {
+		return "", false
+	}
+	data = data[4:]
+
+	// Client version and random
+	if len(data) < 34 {
+		return "", false
+	}
+	data = data[34:]
+
+	// Session ID
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return "", false
+	}
+	data = data[1+int(data[0]):]
+
+	// Cipher suites
+	if len(data) < 2 {
+		return "", false
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n {
+		return "", false
+	}
+	data = data[2+n:]
+
+	// Compression methods
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return "", false
+	}
+	data = data[1+int(data[0]):]
+
+	// Extensions
+	if len(data) < 2 {
+		return "", false
+	}
+	n = int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) > n {
+		data = data[:n]
+	}
+
+	for len(data) >= 4 {
+		extType := binary.BigEndian.Uint16(data)
+		extLen := int(binary.BigEndian.Uint16(data[2:]))
+		data = data[4:]
+		if len(data) < extLen {
+			return "", false
+		}
+		ext := data[:extLen]
+		data = data[extLen:]
+
+		if extType != 0 {
+			continue
+		}
+
+		// server_name: list length, then entries of type, length, name
+		if len(ext) < 2 {
+			return "", false
+		}
+		ext = ext[2:]
+		for len(ext) >= 3 {
+			nameType := ext[0]
+			nameLen := int(binary.BigEndian.Uint16(ext[1:]))
+			ext = ext[3:]
+			if len(ext) < nameLen {
+				return "", false
+			}
+			if nameType == 0 {
+				return strings.ToLower(string(ext[:nameLen])), true
+			}
+			ext = ext[nameLen:]
+		}
+		return "", false
+	}
+	return "", false
+}
+
+// parseHTTPHost extracts the Host header from an HTTP/1.x request at the
+// start of payload
+func parseHTTPHost(payload []byte) (string, bool) {
+	isRequest := false
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(payload, method) {
+			isRequest = true
+			break
+		}
+	}
+	if !isRequest {
+		return "", false
+	}
+
+	if end := bytes.Index(payload, []byte("\r\n\r\n")); end >= 0 {
+		payload = payload[:end]
+	}
+
+	lines := bytes.Split(payload, []byte("\r\n"))
+	for _, line := range lines[1:] {
+		colon := bytes.IndexByte(line, ':')
+		if colon < 0 || !strings.EqualFold(string(bytes.TrimSpace(line[:colon])), "host") {
+			continue
+		}
+
+		host := strings.TrimSpace(string(line[colon+1:]))
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			return "", false
+		}
+		return strings.ToLower(host), true
+	}
+	return "", false
+}
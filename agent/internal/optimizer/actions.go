@@ -0,0 +1,606 @@
+package optimizer
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+	"go.uber.org/zap"
+)
+
+// Measured resources
+const (
+	ResourceDiskFree     = "disk_free"     // free bytes on the filesystem holding a path
+	ResourceMemAvailable = "mem_available" // available memory in bytes
+	ResourceSwapUsed     = "swap_used"     // used swap in bytes
+	ResourceMemFree      = "mem_free"      // free memory in bytes, excluding caches
+	ResourceAgentRSS     = "agent_rss"     // resident size of the agent in bytes
+	ResourceProcessCPU   = "process_cpu"   // CPU percent of the process whose ID is the path
+)
+
+// Measurement represents a resource reading before and after an action
+type Measurement struct {
+	Resource string  `json:"resource"`
+	Path     string  `json:"path,omitempty"`
+	Before   float64 `json:"before"`
+	After    float64 `json:"after"`
+	Unit     string  `json:"unit"`
+}
+
+// Reclaimed returns how much of the resource the action freed
+func (m *Measurement) Reclaimed() float64 {
+	switch m.Resource {
+	case ResourceSwapUsed, ResourceAgentRSS, ResourceProcessCPU:
+		return m.Before - m.After
+	}
+	return m.After - m.Before
+}
+
+// Action is an executable optimization. Actions are registered with
+// RegisterAction and proposed by Analyze or the optimizer:propose command.
+type Action interface {
+	// Name identifies the action, e.g. "journal_vacuum"
+	Name() string
+	// Type is the resource the action targets: disk, memory or cpu
+	Type() string
+	Risk() RiskLevel
+	Description() string
+	// Available reports whether the action can run on this host
+	Available() bool
+	// Measure names the resource and path whose change is the action's impact
+	Measure(params map[string]string) (resource, path string)
+	// Apply runs the action and returns its output for the audit trail
+	Apply(ctx context.Context, params map[string]string) (string, error)
+}
+
+// paramValidator is implemented by actions that check their parameters
+// before a suggestion is queued
+type paramValidator interface {
+	Validate(params map[string]string) error
+}
+
+// commandAction runs an external command
+type commandAction struct {
+	name        string
+	typ         string
+	risk        RiskLevel
+	description string
+	command     string
+	args        func(params map[string]string) []string
+	resource    string
+	path        string
+}
+
+func (a *commandAction) Name() string        { return a.name }
+func (a *commandAction) Type() string        { return a.typ }
+func (a *commandAction) Risk() RiskLevel     { return a.risk }
+func (a *commandAction) Description() string { return a.description }
+
+func (a *commandAction) Available() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	_, err := exec.LookPath(a.command)
+	return err == nil
+}
+
+func (a *commandAction) Measure(params map[string]string) (string, string) {
+	return a.resource, a.path
+}
+
+func (a *commandAction) Apply(ctx context.Context, params map[string]string) (string, error) {
+	output, err := exec.CommandContext(ctx, a.command, a.args(params)...).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("%s failed: %w", a.command, err)
+	}
+	return string(output), nil
+}
+
+func noArgs(args ...string) func(map[string]string) []string {
+	return func(map[string]string) []string { return args }
+}
+
+// param returns params[key], or def when it is unset
+func param(params map[string]string, key, def string) string {
+	if v, ok := params[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// builtinActions returns the actions registered by NewOptimizer
+func builtinActions() []Action {
+	return []Action{
+		&commandAction{
+			name:        "journal_vacuum",
+			typ:         "disk",
+			risk:        RiskLow,
+			description: "Remove archived systemd journal files older than max_age (default 2weeks) or beyond max_size",
+			command:     "journalctl",
+			args: func(params map[string]string) []string {
+				args := []string{"--vacuum-time=" + param(params, "max_age", "2weeks")}
+				if size := params["max_size"]; size != "" {
+					args = append(args, "--vacuum-size="+size)
+				}
+				return args
+			},
+			resource: ResourceDiskFree,
+			path:     "/var/log/journal",
+		},
+		&commandAction{
+			name:        "apt_clean",
+			typ:         "disk",
+			risk:        RiskLow,
+			description: "Clear the apt package cache",
+			command:     "apt-get",
+			args:        noArgs("clean"),
+			resource:    ResourceDiskFree,
+			path:        "/var/cache/apt",
+		},
+		&commandAction{
+			name:        "dnf_clean",
+			typ:         "disk",
+			risk:        RiskLow,
+			description: "Clear the dnf package cache",
+			command:     "dnf",
+			args:        noArgs("clean", "all"),
+			resource:    ResourceDiskFree,
+			path:        "/var/cache/dnf",
+		},
+		&commandAction{
+			name:        "docker_prune",
+			typ:         "disk",
+			risk:        RiskMedium,
+			description: "Remove stopped containers, unused networks, dangling images and build cache; all=true also removes unused images",
+			command:     "docker",
+			args: func(params map[string]string) []string {
+				args := []string{"system", "prune", "--force"}
+				if params["all"] == "true" {
+					args = append(args, "--all")
+				}
+				return args
+			},
+			resource: ResourceDiskFree,
+			path:     "/var/lib/docker",
+		},
+		&commandAction{
+			name:        "tmpfiles_clean",
+			typ:         "disk",
+			risk:        RiskLow,
+			description: "Clean temporary directories according to systemd-tmpfiles age rules",
+			command:     "systemd-tmpfiles",
+			args:        noArgs("--clean"),
+			resource:    ResourceDiskFree,
+			path:        "/tmp",
+		},
+		&swappinessAction{},
+	}
+}
+
+// swappinessAction tunes vm.swappiness
+type swappinessAction struct{}
+
+const swappinessPath = "/proc/sys/vm/swappiness"
+
+func (a *swappinessAction) Name() string    { return "swap_tuning" }
+func (a *swappinessAction) Type() string    { return "memory" }
+func (a *swappinessAction) Risk() RiskLevel { return RiskMedium }
+func (a *swappinessAction) Description() string {
+	return "Set vm.swappiness to value (default 10) so the kernel prefers dropping cache over swapping"
+}
+
+func (a *swappinessAction) Available() bool {
+	_, err := os.Stat(swappinessPath)
+	return err == nil
+}
+
+func (a *swappinessAction) Measure(params map[string]string) (string, string) {
+	return ResourceSwapUsed, ""
+}
+
+func (a *swappinessAction) Apply(ctx context.Context, params map[string]string) (string, error) {
+	value, err := strconv.Atoi(param(params, "value", "10"))
+	if err != nil || value < 0 || value > 200 {
+		return "", fmt.Errorf("invalid swappiness: %s", params["value"])
+	}
+
+	previous, err := os.ReadFile(swappinessPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read swappiness: %w", err)
+	}
+	if err := os.WriteFile(swappinessPath, []byte(strconv.Itoa(value)), 0644); err != nil {
+		return "", fmt.Errorf("failed to set swappiness: %w", err)
+	}
+	return fmt.Sprintf("vm.swappiness %s -> %d", strings.TrimSpace(string(previous)), value), nil
+}
+
+// compressLogsRoots are the directories compress_logs may compress logs in
+var compressLogsRoots = []string{"/var/log"}
+
+// rotatedLogPattern matches the names logrotate and syslog daemons give
+// uncompressed rotated logs: app.log.1, syslog.1, app.log-20240101 and
+// messages-20240101
+var rotatedLogPattern = regexp.MustCompile(`^([^.]+|.+\.log)[.-](\d{1,3}|\d{8})$`)
+
+// compressLogsAction gzips rotated log files, skipping protected paths
+type compressLogsAction struct {
+	protected func(path string) bool
+}
+
+func (a *compressLogsAction) Name() string    { return "compress_logs" }
+func (a *compressLogsAction) Type() string    { return "disk" }
+func (a *compressLogsAction) Risk() RiskLevel { return RiskLow }
+func (a *compressLogsAction) Description() string {
+	return "Gzip rotated logs (*.log.N, *.log-DATE, syslog.N) under dir (default /var/log) older than days (default 7)"
+}
+
+// Validate checks the directory and age before the action is queued
+func (a *compressLogsAction) Validate(params map[string]string) error {
+	if _, err := a.dir(params); err != nil {
+		return err
+	}
+	if days, err := strconv.Atoi(param(params, "days", "7")); err != nil || days < 1 {
+		return fmt.Errorf("invalid days: %s", params["days"])
+	}
+	return nil
+}
+
+// dir returns the directory to compress logs in. It must be absolute and,
+// with symlinks resolved, inside one of compressLogsRoots.
+func (a *compressLogsAction) dir(params map[string]string) (string, error) {
+	dir := param(params, "dir", "/var/log")
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("dir must be an absolute path: %s", dir)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(dir))
+	if err != nil {
+		return "", fmt.Errorf("invalid dir: %w", err)
+	}
+	for _, root := range compressLogsRoots {
+		if resolved == root || strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+			if a.protected != nil && a.protected(resolved) {
+				return "", fmt.Errorf("refusing to compress logs in protected path: %s", dir)
+			}
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("dir must be inside %s: %s", strings.Join(compressLogsRoots, ", "), dir)
+}
+
+func (a *compressLogsAction) Available() bool {
+	return runtime.GOOS != "windows"
+}
+
+func (a *compressLogsAction) Measure(params map[string]string) (string, string) {
+	return ResourceDiskFree, param(params, "dir", "/var/log")
+}
+
+func (a *compressLogsAction) Apply(ctx context.Context, params map[string]string) (string, error) {
+	// The directory may have changed since the action was queued
+	dir, err := a.dir(params)
+	if err != nil {
+		return "", err
+	}
+	days, err := strconv.Atoi(param(params, "days", "7"))
+	if err != nil || days < 1 {
+		return "", fmt.Errorf("invalid days: %s", params["days"])
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	var compressed []string
+	var saved int64
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if info.IsDir() && path != dir && a.protected != nil && a.protected(path) {
+			return filepath.SkipDir
+		}
+		// Walk doesn't follow symlinks, so links are never regular files
+		if !info.Mode().IsRegular() || !isRotatedLog(info.Name()) || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		size, err := gzipFile(path, info)
+		if err != nil {
+			return fmt.Errorf("failed to compress %s: %w", path, err)
+		}
+		compressed = append(compressed, path)
+		saved += info.Size() - size
+		return nil
+	})
+
+	return fmt.Sprintf("compressed %d files, saved %d bytes", len(compressed), saved), err
+}
+
+// isRotatedLog reports whether name looks like an uncompressed rotated log.
+// Compressed logs end in .gz and the like, so they never match.
+func isRotatedLog(name string) bool {
+	return rotatedLogPattern.MatchString(name)
+}
+
+// gzipFile replaces path with path.gz, keeping its mode and times, and
+// returns the compressed size
+func gzipFile(path string, info os.FileInfo) (int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+
+	zw := gzip.NewWriter(dst)
+	zw.Name = info.Name()
+	zw.ModTime = info.ModTime()
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Remove(path); err != nil {
+		return 0, err
+	}
+
+	gz, err := os.Stat(path + ".gz")
+	if err != nil {
+		return 0, err
+	}
+	return gz.Size(), nil
+}
+
+// RegisterAction adds an executable action, replacing any with the same name
+func (o *Optimizer) RegisterAction(action Action) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.actions[action.Name()] = action
+}
+
+// ActionInfo describes a registered action
+type ActionInfo struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Risk        RiskLevel `json:"risk"`
+	Description string    `json:"description"`
+	Available   bool      `json:"available"`
+}
+
+// GetActions lists the registered actions
+func (o *Optimizer) GetActions() []ActionInfo {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	infos := make([]ActionInfo, 0, len(o.actions))
+	for _, a := range o.actions {
+		infos = append(infos, ActionInfo{
+			Name:        a.Name(),
+			Type:        a.Type(),
+			Risk:        a.Risk(),
+			Description: a.Description(),
+			Available:   a.Available(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Propose queues a registered action for approval
+func (o *Optimizer) Propose(name string, params map[string]string) (*Optimization, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	action, ok := o.actions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown action: %s", name)
+	}
+	if !action.Available() {
+		return nil, fmt.Errorf("action %s is not available on this host", name)
+	}
+	if dir := params["dir"]; dir != "" && o.isProtected(dir) {
+		return nil, fmt.Errorf("refusing to run %s on protected path: %s", name, dir)
+	}
+	if v, ok := action.(paramValidator); ok {
+		if err := v.Validate(params); err != nil {
+			return nil, err
+		}
+	}
+
+	opt := o.actionOptimization(action, params)
+	o.queue(&opt)
+	o.emit(opt)
+	if !o.safeMode && opt.Risk == RiskLow {
+		opt = o.applyPending(context.Background(), opt.ID)
+	}
+	return &opt, nil
+}
+
+// actionOptimization builds a suggestion for action
+func (o *Optimizer) actionOptimization(action Action, params map[string]string) Optimization {
+	target := action.Name()
+	if _, path := action.Measure(params); path != "" {
+		target = path
+	}
+	return Optimization{
+		Type:        action.Type(),
+		Target:      target,
+		Action:      action.Name(),
+		Params:      params,
+		TimeStamp:   time.Now(),
+		Description: action.Description(),
+	}
+}
+
+// availableActions returns the available registered actions of type typ.
+// The caller holds o.mu.
+func (o *Optimizer) availableActions(typ string) []Action {
+	var actions []Action
+	for _, a := range o.actions {
+		if a.Type() == typ && a.Available() {
+			actions = append(actions, a)
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Name() < actions[j].Name()
+	})
+	return actions
+}
+
+// runAction applies a registered action, measuring its resource before and
+// after. The caller holds o.mu.
+func (o *Optimizer) runAction(ctx context.Context, action Action, opt *Optimization) error {
+	resource, path := action.Measure(opt.Params)
+	return o.measured(opt, resource, path, func() (string, error) {
+		return action.Apply(ctx, opt.Params)
+	})
+}
+
+// measured runs fn, recording its output and the change in resource as
+// the optimization's impact. An empty resource skips measurement.
+func (o *Optimizer) measured(opt *Optimization, resource, path string, fn func() (string, error)) error {
+	if resource == "" {
+		output, err := fn()
+		opt.Output = truncateOutput(output)
+		return err
+	}
+
+	before, unit, err := measure(resource, path)
+	if err != nil {
+		return fmt.Errorf("failed to measure %s before %s: %w", resource, opt.Action, err)
+	}
+
+	output, applyErr := fn()
+	opt.Output = truncateOutput(output)
+
+	after, _, err := measure(resource, path)
+	if err != nil {
+		o.logger.Warn("Failed to measure optimization impact",
+			zap.String("action", opt.Action),
+			zap.Error(err))
+	} else {
+		opt.Measurement = &Measurement{
+			Resource: resource,
+			Path:     path,
+			Before:   before,
+			After:    after,
+			Unit:     unit,
+		}
+		opt.Impact = opt.Measurement.Reclaimed()
+	}
+	return applyErr
+}
+
+// processCPUSample is how long process CPU usage is sampled for
+const processCPUSample = 2 * time.Second
+
+// measure reads resource, for disk resources on the filesystem holding path
+func measure(resource, path string) (float64, string, error) {
+	switch resource {
+	case ResourceDiskFree:
+		// The path may not exist (no docker, no journal); use the
+		// nearest existing parent
+		for path != "/" && path != "." {
+			if _, err := os.Stat(path); err == nil {
+				break
+			}
+			path = filepath.Dir(path)
+		}
+		usage, err := disk.Usage(path)
+		if err != nil {
+			return 0, "", err
+		}
+		return float64(usage.Free), "bytes", nil
+	case ResourceMemAvailable:
+		vm, err := mem.VirtualMemory()
+		if err != nil {
+			return 0, "", err
+		}
+		return float64(vm.Available), "bytes", nil
+	case ResourceMemFree:
+		vm, err := mem.VirtualMemory()
+		if err != nil {
+			return 0, "", err
+		}
+		return float64(vm.Free), "bytes", nil
+	case ResourceAgentRSS:
+		proc, err := process.NewProcess(int32(os.Getpid()))
+		if err != nil {
+			return 0, "", err
+		}
+		info, err := proc.MemoryInfo()
+		if err != nil {
+			return 0, "", err
+		}
+		return float64(info.RSS), "bytes", nil
+	case ResourceSwapUsed:
+		swap, err := mem.SwapMemory()
+		if err != nil {
+			return 0, "", err
+		}
+		return float64(swap.Used), "bytes", nil
+	case ResourceProcessCPU:
+		pid, err := strconv.ParseInt(path, 10, 32)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid process ID: %s", path)
+		}
+		proc, err := process.NewProcess(int32(pid))
+		if err != nil {
+			return 0, "", err
+		}
+		// Percent with an interval samples the process over that period
+		percent, err := proc.Percent(processCPUSample)
+		if err != nil {
+			return 0, "", err
+		}
+		return percent, "percent", nil
+	default:
+		return 0, "", fmt.Errorf("unknown resource: %s", resource)
+	}
+}
+
+// truncateOutput keeps the tail of long command output for the audit trail
+func truncateOutput(output string) string {
+	const limit = 4096
+	output = strings.TrimSpace(output)
+	if len(output) > limit {
+		return "..." + output[len(output)-limit:]
+	}
+	return output
+}
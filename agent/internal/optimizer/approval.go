@@ -0,0 +1,370 @@
+package optimizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// RiskLevel represents how much damage an optimization can do if it is wrong
+type RiskLevel string
+
+const (
+	RiskLow    RiskLevel = "low"    // reversible or cache-only
+	RiskMedium RiskLevel = "medium" // affects running processes
+	RiskHigh   RiskLevel = "high"   // destroys data
+)
+
+// Optimization statuses
+const (
+	StatusPending  = "pending" // awaiting approval
+	StatusApplied  = "applied"
+	StatusFailed   = "failed"
+	StatusRejected = "rejected"
+	StatusExpired  = "expired" // superseded by a newer analysis or too old to trust
+	StatusManual   = "manual"  // advisory only, no automatic action exists
+)
+
+// approvalTTL is how long a suggestion stays approvable. Older analyses no
+// longer reflect the system.
+const approvalTTL = 24 * time.Hour
+
+// maxHistory bounds the decided optimizations kept for reporting
+const maxHistory = 1000
+
+// reportPeriod is the default period covered by optimizer:report
+const reportPeriod = 7 * 24 * time.Hour
+
+// DefaultProtectedPaths are never scanned or modified by the optimizer
+var DefaultProtectedPaths = []string{
+	"/bin",
+	"/boot",
+	"/dev",
+	"/etc",
+	"/lib",
+	"/lib32",
+	"/lib64",
+	"/proc",
+	"/run",
+	"/sbin",
+	"/sys",
+	"/usr",
+	"/var/lib",
+	"/snap",
+}
+
+// actionRisks maps actions to their risk level. Actions missing from the
+// map are advisory and cannot be applied.
+var actionRisks = map[string]RiskLevel{
+	"delete_large_file": RiskHigh,
+	"delete_old_file":   RiskHigh,
+	"adjust_priority":   RiskMedium,
+}
+
+// SetSafeMode controls whether optimizations require explicit approval.
+// With safe mode off, low-risk optimizations are applied as soon as they
+// are found; medium and high risk ones always wait for approval.
+func (o *Optimizer) SetSafeMode(enabled bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.safeMode = enabled
+}
+
+// SetProtectedPaths replaces the paths the optimizer must never touch
+func (o *Optimizer) SetProtectedPaths(paths []string) {
+	cleaned := make([]string, 0, len(paths))
+	for _, p := range paths {
+		cleaned = append(cleaned, filepath.Clean(p))
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.protectedPaths = cleaned
+}
+
+// isProtected reports whether path is, or is inside, a protected path
+func (o *Optimizer) isProtected(path string) bool {
+	path = filepath.Clean(path)
+	for _, protected := range o.protectedPaths {
+		if path == protected || strings.HasPrefix(path, protected+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// propose assigns IDs and risk levels to new suggestions, expires the
+// previous ones and sends them to the server for approval. The caller
+// holds o.mu.
+func (o *Optimizer) propose(optimizations []Optimization) []Optimization {
+	for id, opt := range o.pending {
+		opt.Status = StatusExpired
+		o.record(*opt)
+		delete(o.pending, id)
+	}
+
+	for i := range optimizations {
+		o.queue(&optimizations[i])
+	}
+
+	for _, opt := range optimizations {
+		o.emit(opt)
+	}
+
+	if !o.safeMode {
+		for id, opt := range o.pending {
+			if opt.Risk == RiskLow {
+				o.applyPending(context.Background(), id)
+			}
+		}
+	}
+
+	return optimizations
+}
+
+// queue assigns an ID and risk level to opt and, when it can be applied,
+// adds it to the pending optimizations. The caller holds o.mu.
+func (o *Optimizer) queue(opt *Optimization) {
+	o.nextID++
+	opt.ID = fmt.Sprintf("opt_%d_%d", time.Now().Unix(), o.nextID)
+
+	if action, ok := o.actions[opt.Action]; ok {
+		opt.Risk = action.Risk()
+	} else if risk, ok := actionRisks[opt.Action]; ok {
+		opt.Risk = risk
+	} else {
+		opt.Risk = RiskLow
+		opt.Status = StatusManual
+		return
+	}
+	opt.Status = StatusPending
+
+	pending := *opt
+	o.pending[opt.ID] = &pending
+}
+
+// Approve applies a pending optimization
+func (o *Optimizer) Approve(ctx context.Context, id string) (*Optimization, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	opt, ok := o.pending[id]
+	if !ok {
+		return nil, fmt.Errorf("optimization not pending: %s", id)
+	}
+	if time.Since(opt.TimeStamp) > approvalTTL {
+		opt.Status = StatusExpired
+		o.record(*opt)
+		delete(o.pending, id)
+		o.emit(*opt)
+		return nil, fmt.Errorf("optimization %s expired, run a new analysis", id)
+	}
+
+	o.logger.Info("Optimization approved",
+		zap.String("id", id),
+		zap.String("action", opt.Action),
+		zap.String("target", opt.Target))
+	result := o.applyPending(ctx, id)
+	if result.Status == StatusFailed {
+		return &result, fmt.Errorf("failed to apply optimization %s: %s", id, result.Error)
+	}
+	return &result, nil
+}
+
+// Reject discards a pending optimization
+func (o *Optimizer) Reject(id, reason string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	opt, ok := o.pending[id]
+	if !ok {
+		return fmt.Errorf("optimization not pending: %s", id)
+	}
+	delete(o.pending, id)
+
+	opt.Status = StatusRejected
+	opt.Error = reason
+	o.record(*opt)
+	o.emit(*opt)
+	return nil
+}
+
+// GetPending returns the optimizations awaiting approval
+func (o *Optimizer) GetPending() []Optimization {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	pending := make([]Optimization, 0, len(o.pending))
+	for _, opt := range o.pending {
+		pending = append(pending, *opt)
+	}
+	return pending
+}
+
+// applyPending executes a pending optimization and records the outcome.
+// The caller holds o.mu.
+func (o *Optimizer) applyPending(ctx context.Context, id string) Optimization {
+	opt := o.pending[id]
+	delete(o.pending, id)
+
+	if err := o.apply(ctx, opt); err != nil {
+		opt.Status = StatusFailed
+		opt.Error = err.Error()
+		o.logger.Error("Optimization failed",
+			zap.String("id", id),
+			zap.String("action", opt.Action),
+			zap.Error(err))
+	} else {
+		opt.Status = StatusApplied
+		o.logger.Info("Optimization applied",
+			zap.String("id", id),
+			zap.String("action", opt.Action),
+			zap.String("target", opt.Target))
+		o.logImpact(*opt)
+	}
+
+	o.record(*opt)
+	o.emit(*opt)
+	return *opt
+}
+
+// apply performs an optimization's action
+func (o *Optimizer) apply(ctx context.Context, opt *Optimization) error {
+	switch opt.Action {
+	case "delete_large_file", "delete_old_file":
+		return o.measured(opt, ResourceDiskFree, filepath.Dir(opt.Target), func() (string, error) {
+			return "", o.removeFile(opt.Target)
+		})
+	case "adjust_priority":
+		if opt.PID <= 0 {
+			return fmt.Errorf("no process ID for %s", opt.Target)
+		}
+		pid := strconv.Itoa(int(opt.PID))
+		return o.measured(opt, ResourceProcessCPU, pid, func() (string, error) {
+			return "", o.AdjustProcessPriority(opt.PID, 10)
+		})
+	default:
+		if action, ok := o.actions[opt.Action]; ok {
+			return o.runAction(ctx, action, opt)
+		}
+		return fmt.Errorf("action %s cannot be applied automatically", opt.Action)
+	}
+}
+
+// removeFile deletes a regular file outside the protected paths
+func (o *Optimizer) removeFile(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("refusing to remove relative path: %s", path)
+	}
+	if o.isProtected(path) {
+		return fmt.Errorf("refusing to remove protected path: %s", path)
+	}
+
+	// Lstat so a symlink swapped in after analysis is not followed
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("refusing to remove non-regular file: %s", path)
+	}
+	return os.Remove(path)
+}
+
+// record appends a decided optimization to the history and updates the
+// current suggestion list. The caller holds o.mu.
+func (o *Optimizer) record(opt Optimization) {
+	for i := range o.optimizations {
+		if o.optimizations[i].ID == opt.ID {
+			o.optimizations[i] = opt
+		}
+	}
+
+	o.history = append(o.history, opt)
+	if len(o.history) > maxHistory {
+		o.history = o.history[len(o.history)-maxHistory:]
+	}
+	if err := o.saveHistory(); err != nil {
+		o.logger.Error("Failed to save optimization history", zap.Error(err))
+	}
+}
+
+func (o *Optimizer) emit(opt Optimization) {
+	if o.events == nil {
+		return
+	}
+	select {
+	case o.events <- opt:
+	default:
+		o.logger.Warn("Failed to send optimization: channel full")
+	}
+}
+
+// HandleCommand processes optimizer commands
+func (o *Optimizer) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "optimizer:analyze":
+		if err := o.Analyze(ctx); err != nil {
+			return nil, err
+		}
+		return o.GetOptimizations(), nil
+	case "optimizer:scan":
+		return o.ScanDisk(ctx)
+	case "optimizer:pending":
+		return o.GetPending(), nil
+	case "optimizer:report", "optimizer:history":
+		// optimizer:report [period], e.g. 24h; defaults to a week
+		period := reportPeriod
+		if len(args) > 0 {
+			d, err := time.ParseDuration(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid period: %w", err)
+			}
+			period = d
+		}
+		since := time.Now().Add(-period)
+		if cmd == "optimizer:history" {
+			return o.GetHistory(since), nil
+		}
+		return o.Report(since), nil
+	case "optimizer:actions":
+		return o.GetActions(), nil
+	case "optimizer:propose":
+		// optimizer:propose <action> [key=value ...]
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "action name required")
+		}
+		params := make(map[string]string)
+		for _, arg := range args[1:] {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid parameter %q, expected key=value", arg)
+			}
+			params[key] = value
+		}
+		return o.Propose(args[0], params)
+	case "optimizer:approve":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "optimization ID required")
+		}
+		return o.Approve(ctx, args[0])
+	case "optimizer:reject":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "optimization ID required")
+		}
+		reason := strings.Join(args[1:], " ")
+		return nil, o.Reject(args[0], reason)
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown optimizer command: %s", cmd)
+	}
+}
@@ -0,0 +1,353 @@
+package optimizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DiskScanConfig bounds the optimizer's filesystem scans
+type DiskScanConfig struct {
+	Roots         []string      `json:"roots"`           // directories to scan
+	Exclude       []string      `json:"exclude"`         // filepath.Match patterns for paths or base names
+	Concurrency   int           `json:"concurrency"`     // directories read in parallel
+	LargeFileSize int64         `json:"large_file_size"` // bytes
+	MaxResults    int           `json:"max_results"`     // per category, largest or oldest first
+	CacheTTL      time.Duration `json:"cache_ttl"`       // unchanged directories are not re-read within this period
+	Idle          bool          `json:"idle"`            // scan with idle I/O and CPU priority
+	OneFilesystem bool          `json:"one_filesystem"`  // don't cross mount points below a root
+}
+
+// DefaultDiskScanConfig scans the directories where reclaimable data usually
+// accumulates instead of the whole filesystem
+var DefaultDiskScanConfig = DiskScanConfig{
+	Roots: []string{
+		"/home",
+		"/opt",
+		"/root",
+		"/srv",
+		"/tmp",
+		"/var/cache",
+		"/var/log",
+		"/var/tmp",
+	},
+	Exclude:       []string{".git", "node_modules", "*.sock"},
+	Concurrency:   2,
+	LargeFileSize: 100 * 1024 * 1024,
+	MaxResults:    100,
+	CacheTTL:      time.Hour,
+	Idle:          true,
+	OneFilesystem: true,
+}
+
+// FileEntry represents a file found by a disk scan
+type FileEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// DiskScanResult represents the outcome of a disk scan
+type DiskScanResult struct {
+	LargeFiles  []FileEntry   `json:"large_files"`
+	OldFiles    []FileEntry   `json:"old_files"`
+	Directories int           `json:"directories"`
+	Cached      int           `json:"cached"` // directories served from the cache
+	Files       int           `json:"files"`
+	Duration    time.Duration `json:"duration"`
+	Timestamp   time.Time     `json:"timestamp"`
+}
+
+// dirCacheEntry holds a directory listing. A directory's mtime changes when
+// entries are added, removed or renamed, so an unchanged mtime means the
+// listing is still valid.
+type dirCacheEntry struct {
+	modTime time.Time
+	scanned time.Time
+	files   []FileEntry
+	subdirs []string
+}
+
+// diskScanner walks directory trees with bounded concurrency and caches
+// directory listings between scans
+type diskScanner struct {
+	logger *zap.Logger
+	cache  map[string]*dirCacheEntry
+	mu     sync.Mutex
+}
+
+func newDiskScanner(logger *zap.Logger) *diskScanner {
+	return &diskScanner{
+		logger: logger,
+		cache:  make(map[string]*dirCacheEntry),
+	}
+}
+
+// SetDiskScanConfig replaces the disk scan configuration
+func (o *Optimizer) SetDiskScanConfig(config DiskScanConfig) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.scanConfig = config
+}
+
+// ScanDisk scans the configured roots for large and old files
+func (o *Optimizer) ScanDisk(ctx context.Context) (*DiskScanResult, error) {
+	o.mu.RLock()
+	config := o.scanConfig
+	cutoff := time.Now().AddDate(0, 0, -o.cleanupAgeDays)
+	o.mu.RUnlock()
+
+	return o.scanner.scan(ctx, config, cutoff, o.isProtected)
+}
+
+// scan walks config.Roots. Files modified before cutoff are old.
+func (s *diskScanner) scan(ctx context.Context, config DiskScanConfig, cutoff time.Time, protected func(string) bool) (*DiskScanResult, error) {
+	start := time.Now()
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+
+	var (
+		mu     sync.Mutex
+		result = &DiskScanResult{Timestamp: start}
+		large  []FileEntry
+		old    []FileEntry
+		queue  = newScanQueue()
+		wg     sync.WaitGroup
+	)
+
+	for _, root := range config.Roots {
+		root = filepath.Clean(root)
+		if protected(root) {
+			s.logger.Warn("Skipping protected scan root", zap.String("root", root))
+			continue
+		}
+		info, err := os.Stat(root)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		queue.push(scanDir{path: root, device: deviceOf(info)})
+	}
+
+	for i := 0; i < config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if config.Idle {
+				// The priority sticks to the OS thread, so keep this
+				// goroutine on it and let the thread exit with it
+				runtime.LockOSThread()
+				if err := setIdlePriority(); err != nil {
+					s.logger.Debug("Failed to lower scan priority", zap.Error(err))
+				}
+			}
+
+			for {
+				d, ok := queue.pop()
+				if !ok {
+					return
+				}
+				if ctx.Err() != nil {
+					queue.finish()
+					continue
+				}
+
+				files, subdirs, cached := s.readDir(d.path, config.CacheTTL)
+				mu.Lock()
+				result.Directories++
+				if cached {
+					result.Cached++
+				}
+				for _, f := range files {
+					if excluded(f.Path, config.Exclude) || protected(f.Path) {
+						continue
+					}
+					result.Files++
+					if config.LargeFileSize > 0 && f.Size >= config.LargeFileSize {
+						large = append(large, f)
+					}
+					if f.ModTime.Before(cutoff) {
+						old = append(old, f)
+					}
+				}
+				mu.Unlock()
+
+				for _, sub := range subdirs {
+					if excluded(sub, config.Exclude) || protected(sub) {
+						continue
+					}
+					if config.OneFilesystem && !sameDevice(sub, d.device) {
+						continue
+					}
+					queue.push(scanDir{path: sub, device: d.device})
+				}
+				queue.finish()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("disk scan cancelled: %w", err)
+	}
+
+	sort.Slice(large, func(i, j int) bool { return large[i].Size > large[j].Size })
+	sort.Slice(old, func(i, j int) bool { return old[i].ModTime.Before(old[j].ModTime) })
+	if config.MaxResults > 0 {
+		if len(large) > config.MaxResults {
+			large = large[:config.MaxResults]
+		}
+		if len(old) > config.MaxResults {
+			old = old[:config.MaxResults]
+		}
+	}
+	result.LargeFiles = large
+	result.OldFiles = old
+	result.Duration = time.Since(start)
+
+	s.logger.Info("Disk scan completed",
+		zap.Int("directories", result.Directories),
+		zap.Int("cached", result.Cached),
+		zap.Int("files", result.Files),
+		zap.Duration("duration", result.Duration))
+	return result, nil
+}
+
+type scanDir struct {
+	path   string
+	device uint64
+}
+
+// scanQueue is a work queue of directories that closes itself once it is
+// empty and no worker is still reading a directory that could add more
+type scanQueue struct {
+	items  []scanDir
+	active int
+	done   bool
+	mu     sync.Mutex
+	cond   *sync.Cond
+}
+
+func newScanQueue() *scanQueue {
+	q := &scanQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *scanQueue) push(d scanDir) {
+	q.mu.Lock()
+	q.items = append(q.items, d)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop returns the next directory, blocking while other workers may still
+// queue more. The caller must call finish when done with it.
+func (q *scanQueue) pop() (scanDir, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 {
+		if q.done || q.active == 0 {
+			q.done = true
+			q.cond.Broadcast()
+			return scanDir{}, false
+		}
+		q.cond.Wait()
+	}
+	// Depth first keeps the queue short
+	d := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	q.active++
+	return d, true
+}
+
+func (q *scanQueue) finish() {
+	q.mu.Lock()
+	q.active--
+	if q.active == 0 && len(q.items) == 0 {
+		q.done = true
+	}
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// readDir lists path, reusing the cached listing when the directory is
+// unchanged and the cache entry is younger than ttl
+func (s *diskScanner) readDir(path string, ttl time.Duration) (files []FileEntry, subdirs []string, cached bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	s.mu.Lock()
+	entry, ok := s.cache[path]
+	s.mu.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && time.Since(entry.scanned) < ttl {
+		return entry.files, entry.subdirs, true
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	for _, e := range entries {
+		full := filepath.Join(path, e.Name())
+		switch {
+		case e.IsDir():
+			subdirs = append(subdirs, full)
+		case e.Type().IsRegular():
+			fi, err := e.Info()
+			if err != nil {
+				continue
+			}
+			files = append(files, FileEntry{Path: full, Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+	}
+
+	if ttl > 0 {
+		s.mu.Lock()
+		s.cache[path] = &dirCacheEntry{
+			modTime: info.ModTime(),
+			scanned: time.Now(),
+			files:   files,
+			subdirs: subdirs,
+		}
+		s.mu.Unlock()
+	}
+	return files, subdirs, false
+}
+
+// excluded reports whether path or its base name matches a pattern
+func excluded(path string, patterns []string) bool {
+	base := filepath.Base(path)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sameDevice reports whether path is on device
+func sameDevice(path string, device uint64) bool {
+	if device == 0 {
+		return true
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	return deviceOf(info) == device
+}
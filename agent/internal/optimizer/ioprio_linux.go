@@ -0,0 +1,29 @@
+package optimizer
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+	ioprioWhoProcess = 1
+)
+
+// setIdlePriority puts the calling thread in the idle I/O scheduling class
+// and at the lowest CPU priority. On Linux both apply per thread.
+func setIdlePriority() error {
+	tid := syscall.Gettid()
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassIdle<<ioprioClassShift); errno != 0 {
+		return os.NewSyscallError("ioprio_set", errno)
+	}
+	return syscall.Setpriority(syscall.PRIO_PROCESS, tid, 19)
+}
+
+func deviceOf(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev)
+	}
+	return 0
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package optimizer
+
+import "os"
+
+// setIdlePriority is a no-op where per-thread I/O priorities don't exist
+func setIdlePriority() error {
+	return nil
+}
+
+// deviceOf returns 0, which disables the one-filesystem check
+func deviceOf(info os.FileInfo) uint64 {
+	return 0
+}
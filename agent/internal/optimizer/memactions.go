@@ -0,0 +1,364 @@
+package optimizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+	"go.uber.org/zap"
+)
+
+// MemoryConfig configures memory pressure remediation
+type MemoryConfig struct {
+	// LeakyServices maps systemd units known to leak memory to the resident
+	// size in bytes above which a restart is suggested. Only these units
+	// can be restarted by the optimizer.
+	LeakyServices map[string]uint64 `json:"leaky_services"`
+	// OOMScores maps process names to the oom_score_adj they should run
+	// with, e.g. -500 for critical databases or 500 for batch jobs
+	OOMScores map[string]int `json:"oom_scores"`
+	// DropCachesInterval is the minimum time between page cache drops
+	DropCachesInterval time.Duration `json:"drop_caches_interval"`
+	// DropCachesMinCached is the share of memory the page cache must hold
+	// before dropping it is suggested
+	DropCachesMinCached float64 `json:"drop_caches_min_cached"`
+}
+
+// DefaultMemoryConfig suggests dropping caches at most every 30 minutes
+// and only when they hold over a quarter of memory
+var DefaultMemoryConfig = MemoryConfig{
+	DropCachesInterval:  30 * time.Minute,
+	DropCachesMinCached: 0.25,
+}
+
+const (
+	dropCachesPath = "/proc/sys/vm/drop_caches"
+	// dropCachesMaxDirty refuses to drop caches while this much data is
+	// waiting for writeback; the sync would stall the system
+	dropCachesMaxDirty = 512 * 1024 * 1024
+)
+
+// SetMemoryConfig replaces the memory remediation configuration
+func (o *Optimizer) SetMemoryConfig(config MemoryConfig) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.memConfig = config
+}
+
+// memoryConfig returns the memory configuration. Actions call it while
+// being applied, with o.mu held.
+func (o *Optimizer) memoryConfig() MemoryConfig {
+	return o.memConfig
+}
+
+// memoryActionSet returns the memory actions registered by NewOptimizer
+func (o *Optimizer) memoryActionSet() []Action {
+	return []Action{
+		&dropCachesAction{config: o.memoryConfig},
+		&agentGCAction{},
+		&restartServiceAction{config: o.memoryConfig},
+		&oomScoreAction{},
+		&compressLogsAction{protected: o.isProtected},
+	}
+}
+
+// dropCachesAction writes to vm.drop_caches
+type dropCachesAction struct {
+	config   func() MemoryConfig
+	mu       sync.Mutex
+	lastDrop time.Time
+}
+
+func (a *dropCachesAction) Name() string    { return "drop_caches" }
+func (a *dropCachesAction) Type() string    { return "memory" }
+func (a *dropCachesAction) Risk() RiskLevel { return RiskMedium }
+func (a *dropCachesAction) Description() string {
+	return "Sync and drop the page cache (mode 1, default), reclaimable slab (2) or both (3); refused while much data is dirty or if run recently"
+}
+
+func (a *dropCachesAction) Available() bool {
+	_, err := os.Stat(dropCachesPath)
+	return err == nil && os.Geteuid() == 0
+}
+
+func (a *dropCachesAction) Measure(params map[string]string) (string, string) {
+	return ResourceMemFree, ""
+}
+
+func (a *dropCachesAction) Validate(params map[string]string) error {
+	if mode := param(params, "mode", "1"); mode != "1" && mode != "2" && mode != "3" {
+		return fmt.Errorf("invalid drop_caches mode: %s", mode)
+	}
+	return nil
+}
+
+func (a *dropCachesAction) Apply(ctx context.Context, params map[string]string) (string, error) {
+	if err := a.Validate(params); err != nil {
+		return "", err
+	}
+	mode := param(params, "mode", "1")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if interval := a.config().DropCachesInterval; time.Since(a.lastDrop) < interval {
+		return "", fmt.Errorf("caches were dropped %s ago, minimum interval is %s",
+			time.Since(a.lastDrop).Round(time.Second), interval)
+	}
+
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return "", fmt.Errorf("failed to read memory statistics: %w", err)
+	}
+	if vm.Dirty > dropCachesMaxDirty {
+		return "", fmt.Errorf("refusing to drop caches with %d MB dirty", vm.Dirty>>20)
+	}
+
+	// Only clean pages are dropped, so write dirty ones back first
+	syncFilesystems()
+	if err := os.WriteFile(dropCachesPath, []byte(mode), 0200); err != nil {
+		return "", fmt.Errorf("failed to drop caches: %w", err)
+	}
+	a.lastDrop = time.Now()
+
+	return fmt.Sprintf("dropped caches (mode %s), %d MB were cached", mode, vm.Cached>>20), nil
+}
+
+// agentGCAction runs the Go garbage collector in the agent
+type agentGCAction struct{}
+
+func (a *agentGCAction) Name() string    { return "agent_gc" }
+func (a *agentGCAction) Type() string    { return "memory" }
+func (a *agentGCAction) Risk() RiskLevel { return RiskLow }
+func (a *agentGCAction) Description() string {
+	return "Run a garbage collection in the agent and return freed memory to the OS"
+}
+func (a *agentGCAction) Available() bool { return true }
+
+func (a *agentGCAction) Measure(params map[string]string) (string, string) {
+	return ResourceAgentRSS, ""
+}
+
+func (a *agentGCAction) Apply(ctx context.Context, params map[string]string) (string, error) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	debug.FreeOSMemory()
+	runtime.ReadMemStats(&after)
+
+	return fmt.Sprintf("heap in use %d -> %d KB, released %d KB to the OS",
+		before.HeapInuse>>10, after.HeapInuse>>10,
+		(after.HeapReleased-before.HeapReleased)>>10), nil
+}
+
+// restartServiceAction restarts a systemd unit configured as leaky
+type restartServiceAction struct {
+	config func() MemoryConfig
+}
+
+func (a *restartServiceAction) Name() string    { return "restart_service" }
+func (a *restartServiceAction) Type() string    { return "memory" }
+func (a *restartServiceAction) Risk() RiskLevel { return RiskMedium }
+func (a *restartServiceAction) Description() string {
+	return "Restart a systemd service listed in leaky_services to release leaked memory"
+}
+
+func (a *restartServiceAction) Available() bool {
+	_, err := exec.LookPath("systemctl")
+	return err == nil
+}
+
+func (a *restartServiceAction) Measure(params map[string]string) (string, string) {
+	return ResourceMemAvailable, ""
+}
+
+// Validate only allows services listed in leaky_services, so the command
+// cannot be used to restart arbitrary units
+func (a *restartServiceAction) Validate(params map[string]string) error {
+	service := params["service"]
+	if _, ok := a.config().LeakyServices[service]; !ok {
+		return fmt.Errorf("service %q is not configured as a leaky service", service)
+	}
+	return nil
+}
+
+func (a *restartServiceAction) Apply(ctx context.Context, params map[string]string) (string, error) {
+	if err := a.Validate(params); err != nil {
+		return "", err
+	}
+	service := params["service"]
+
+	before, _ := serviceRSS(ctx, service)
+	output, err := exec.CommandContext(ctx, "systemctl", "restart", service).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("failed to restart %s: %w", service, err)
+	}
+	return fmt.Sprintf("restarted %s, was using %d MB", service, before>>20), nil
+}
+
+// serviceRSS returns the resident size of a systemd unit's main process
+func serviceRSS(ctx context.Context, service string) (uint64, error) {
+	output, err := exec.CommandContext(ctx, "systemctl", "show", "--property=MainPID", "--value", service).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get main PID of %s: %w", service, err)
+	}
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 32)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("service %s is not running", service)
+	}
+
+	proc, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return 0, err
+	}
+	info, err := proc.MemoryInfo()
+	if err != nil {
+		return 0, err
+	}
+	return info.RSS, nil
+}
+
+// oomScoreAction sets a process's oom_score_adj
+type oomScoreAction struct{}
+
+func (a *oomScoreAction) Name() string    { return "oom_score" }
+func (a *oomScoreAction) Type() string    { return "memory" }
+func (a *oomScoreAction) Risk() RiskLevel { return RiskMedium }
+func (a *oomScoreAction) Description() string {
+	return "Set oom_score_adj (-1000 to 1000) of pid so the OOM killer spares or prefers it"
+}
+
+func (a *oomScoreAction) Available() bool {
+	_, err := os.Stat("/proc/self/oom_score_adj")
+	return err == nil
+}
+
+// Measure returns no resource; the score changes which process the OOM
+// killer picks, not how much memory is used
+func (a *oomScoreAction) Measure(params map[string]string) (string, string) {
+	return "", ""
+}
+
+func (a *oomScoreAction) Validate(params map[string]string) error {
+	if pid, err := strconv.Atoi(params["pid"]); err != nil || pid <= 1 {
+		return fmt.Errorf("invalid pid: %s", params["pid"])
+	}
+	if score, err := strconv.Atoi(params["score"]); err != nil || score < -1000 || score > 1000 {
+		return fmt.Errorf("invalid oom score: %s", params["score"])
+	}
+	return nil
+}
+
+func (a *oomScoreAction) Apply(ctx context.Context, params map[string]string) (string, error) {
+	if err := a.Validate(params); err != nil {
+		return "", err
+	}
+	pid, _ := strconv.Atoi(params["pid"])
+	score, _ := strconv.Atoi(params["score"])
+
+	path := fmt.Sprintf("/proc/%d/oom_score_adj", pid)
+	previous, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read oom score: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(score)), 0644); err != nil {
+		return "", fmt.Errorf("failed to set oom score: %w", err)
+	}
+	return fmt.Sprintf("oom_score_adj of %d: %s -> %d", pid, strings.TrimSpace(string(previous)), score), nil
+}
+
+// oomScoreAdj reads a process's oom_score_adj
+func oomScoreAdj(pid int32) (int, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/oom_score_adj", pid))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// pressureActions suggests actions that free memory now. The caller holds
+// o.mu.
+func (o *Optimizer) pressureActions() []Optimization {
+	var optimizations []Optimization
+
+	if a, ok := o.actions["agent_gc"]; ok {
+		optimizations = append(optimizations, o.actionOptimization(a, nil))
+	}
+
+	if a, ok := o.actions["drop_caches"]; ok && a.Available() {
+		vm, err := mem.VirtualMemory()
+		if err == nil && vm.Total > 0 {
+			cached := float64(vm.Cached) / float64(vm.Total)
+			if cached >= o.memConfig.DropCachesMinCached {
+				opt := o.actionOptimization(a, map[string]string{"mode": "1"})
+				opt.Description = fmt.Sprintf("Page cache holds %d MB (%.0f%% of memory); %s",
+					vm.Cached>>20, cached*100, a.Description())
+				optimizations = append(optimizations, opt)
+			}
+		}
+	}
+
+	return optimizations
+}
+
+// configuredMemoryActions suggests restarts of leaky services over their
+// limit and OOM score corrections for configured processes, regardless of
+// current memory pressure. The caller holds o.mu.
+func (o *Optimizer) configuredMemoryActions(ctx context.Context) []Optimization {
+	var optimizations []Optimization
+	config := o.memConfig
+
+	if a, ok := o.actions["restart_service"]; ok && len(config.LeakyServices) > 0 && a.Available() {
+		for service, limit := range config.LeakyServices {
+			rss, err := serviceRSS(ctx, service)
+			if err != nil || rss <= limit {
+				continue
+			}
+			opt := o.actionOptimization(a, map[string]string{"service": service})
+			opt.Target = service
+			opt.Description = fmt.Sprintf("%s is using %d MB, above its %d MB limit", service, rss>>20, limit>>20)
+			optimizations = append(optimizations, opt)
+		}
+	}
+
+	if a, ok := o.actions["oom_score"]; ok && len(config.OOMScores) > 0 && a.Available() {
+		processes, err := process.Processes()
+		if err != nil {
+			o.logger.Error("Failed to get processes", zap.Error(err))
+			return optimizations
+		}
+		for _, p := range processes {
+			name, err := p.Name()
+			if err != nil {
+				continue
+			}
+			want, ok := config.OOMScores[name]
+			if !ok {
+				continue
+			}
+			current, err := oomScoreAdj(p.Pid)
+			if err != nil || current == want {
+				continue
+			}
+			opt := o.actionOptimization(a, map[string]string{
+				"pid":   strconv.Itoa(int(p.Pid)),
+				"score": strconv.Itoa(want),
+			})
+			opt.Target = fmt.Sprintf("%s (PID: %d)", name, p.Pid)
+			opt.PID = p.Pid
+			opt.Description = fmt.Sprintf("oom_score_adj of %s is %d, configured %d", name, current, want)
+			optimizations = append(optimizations, opt)
+		}
+	}
+
+	return optimizations
+}
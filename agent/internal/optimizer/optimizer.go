@@ -3,11 +3,8 @@ package optimizer
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 	"sort"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -21,6 +18,7 @@ import (
 type Optimizer struct {
 	logger *zap.Logger
 	mu     sync.RWMutex
+	events chan<- interface{}
 
 	// Thresholds
 	diskThreshold  float64 // percentage
@@ -31,16 +29,40 @@ type Optimizer struct {
 	// Optimization status
 	lastOptimization time.Time
 	optimizations    []Optimization
+
+	// Safe mode
+	safeMode       bool
+	protectedPaths []string
+	pending        map[string]*Optimization
+	history        []Optimization
+	historyPath    string
+	nextID         uint64
+	actions        map[string]Action
+
+	// Disk scanning
+	scanConfig DiskScanConfig
+	scanner    *diskScanner
+
+	// Memory remediation
+	memConfig MemoryConfig
 }
 
 // Optimization represents a single optimization action
 type Optimization struct {
-	Type        string
-	Target      string
-	Action      string
-	Impact      float64
-	TimeStamp   time.Time
-	Description string
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Target      string    `json:"target"`
+	PID         int32     `json:"pid,omitempty"`
+	Action      string    `json:"action"`
+	Params      map[string]string `json:"params,omitempty"`
+	Risk        RiskLevel `json:"risk"`
+	Status      string    `json:"status"`
+	Impact      float64   `json:"impact"`
+	TimeStamp   time.Time `json:"timestamp"`
+	Description string    `json:"description"`
+	Error       string    `json:"error,omitempty"`
+	Output      string    `json:"output,omitempty"`
+	Measurement *Measurement `json:"measurement,omitempty"`
 }
 
 // ResourceUsage represents current resource usage
@@ -61,15 +83,31 @@ type ProcessUsage struct {
 	Connections int
 }
 
-// NewOptimizer creates a new optimizer instance
-func NewOptimizer(logger *zap.Logger) *Optimizer {
-	return &Optimizer{
+// NewOptimizer creates a new optimizer instance. Suggestions awaiting
+// approval and status changes are sent on events.
+func NewOptimizer(logger *zap.Logger, events chan<- interface{}) *Optimizer {
+	o := &Optimizer{
 		logger:         logger,
+		events:         events,
 		diskThreshold: 90,  // 90% disk usage
 		memThreshold:  85,  // 85% memory usage
 		cpuThreshold:  80,  // 80% CPU usage
 		cleanupAgeDays: 30, // 30 days for old files
+		safeMode:       true,
+		protectedPaths: DefaultProtectedPaths,
+		pending:        make(map[string]*Optimization),
+		actions:        make(map[string]Action),
+		scanConfig:     DefaultDiskScanConfig,
+		scanner:        newDiskScanner(logger),
+		memConfig:      DefaultMemoryConfig,
+	}
+	for _, action := range builtinActions() {
+		o.actions[action.Name()] = action
+	}
+	for _, action := range o.memoryActionSet() {
+		o.actions[action.Name()] = action
 	}
+	return o
 }
 
 // SetThresholds updates optimization thresholds
@@ -92,6 +130,19 @@ func (o *Optimizer) Analyze(ctx context.Context) error {
 		return fmt.Errorf("failed to get resource usage: %w", err)
 	}
 
+	// Scan the disk without holding the lock; scans can take minutes
+	o.mu.RLock()
+	diskFull := usage.Disk >= o.diskThreshold
+	o.mu.RUnlock()
+
+	var scan *DiskScanResult
+	if diskFull {
+		scan, err = o.ScanDisk(ctx)
+		if err != nil {
+			o.logger.Error("Failed to scan disk", zap.Error(err))
+		}
+	}
+
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
@@ -99,13 +150,8 @@ func (o *Optimizer) Analyze(ctx context.Context) error {
 	var optimizations []Optimization
 
 	// Check disk usage
-	if usage.Disk >= o.diskThreshold {
-		diskOpts, err := o.analyzeDiskUsage(ctx)
-		if err != nil {
-			o.logger.Error("Failed to analyze disk usage", zap.Error(err))
-		} else {
-			optimizations = append(optimizations, diskOpts...)
-		}
+	if diskFull {
+		optimizations = append(optimizations, o.analyzeDiskUsage(scan)...)
 	}
 
 	// Check memory usage
@@ -116,7 +162,9 @@ func (o *Optimizer) Analyze(ctx context.Context) error {
 		} else {
 			optimizations = append(optimizations, memOpts...)
 		}
+		optimizations = append(optimizations, o.pressureActions()...)
 	}
+	optimizations = append(optimizations, o.configuredMemoryActions(ctx)...)
 
 	// Check CPU usage
 	if usage.CPU >= o.cpuThreshold {
@@ -128,7 +176,7 @@ func (o *Optimizer) Analyze(ctx context.Context) error {
 		}
 	}
 
-	o.optimizations = optimizations
+	o.optimizations = o.propose(optimizations)
 	o.lastOptimization = time.Now()
 
 	return nil
@@ -178,43 +226,40 @@ func (o *Optimizer) getCurrentUsage() (*ResourceUsage, error) {
 	}, nil
 }
 
-// analyzeDiskUsage analyzes disk usage and suggests optimizations
-func (o *Optimizer) analyzeDiskUsage(ctx context.Context) ([]Optimization, error) {
+// analyzeDiskUsage suggests optimizations for a full disk. scan may be nil
+// if the disk scan failed. The caller holds o.mu.
+func (o *Optimizer) analyzeDiskUsage(scan *DiskScanResult) []Optimization {
 	var optimizations []Optimization
 
-	// Find large files
-	largeFiles, err := o.findLargeFiles(ctx, "/")
-	if err != nil {
-		return nil, fmt.Errorf("failed to find large files: %w", err)
+	// Cache and log cleanup is safer than deleting files, so suggest it first
+	for _, action := range o.availableActions("disk") {
+		optimizations = append(optimizations, o.actionOptimization(action, nil))
+	}
+	if scan == nil {
+		return optimizations
 	}
 
-	for _, file := range largeFiles {
+	for _, file := range scan.LargeFiles {
 		optimizations = append(optimizations, Optimization{
 			Type:        "disk",
-			Target:      file,
+			Target:      file.Path,
 			Action:      "delete_large_file",
 			TimeStamp:   time.Now(),
-			Description: fmt.Sprintf("Large file found: %s", file),
+			Description: fmt.Sprintf("Large file found: %s (%d MB)", file.Path, file.Size>>20),
 		})
 	}
 
-	// Find old files
-	oldFiles, err := o.findOldFiles(ctx, "/", o.cleanupAgeDays)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find old files: %w", err)
-	}
-
-	for _, file := range oldFiles {
+	for _, file := range scan.OldFiles {
 		optimizations = append(optimizations, Optimization{
 			Type:        "disk",
-			Target:      file,
+			Target:      file.Path,
 			Action:      "delete_old_file",
 			TimeStamp:   time.Now(),
-			Description: fmt.Sprintf("Old file found: %s", file),
+			Description: fmt.Sprintf("Old file found: %s (modified %s)", file.Path, file.ModTime.Format("2006-01-02")),
 		})
 	}
 
-	return optimizations, nil
+	return optimizations
 }
 
 // analyzeMemoryUsage analyzes memory usage and suggests optimizations
@@ -263,6 +308,7 @@ func (o *Optimizer) analyzeMemoryUsage(ctx context.Context) ([]Optimization, err
 			optimizations = append(optimizations, Optimization{
 				Type:        "memory",
 				Target:      fmt.Sprintf("%s (PID: %d)", procs[i].name, procs[i].pid),
+				PID:         procs[i].pid,
 				Action:      "reduce_memory",
 				TimeStamp:   time.Now(),
 				Description: fmt.Sprintf("High memory usage: %.2f%%", procs[i].memPerc),
@@ -326,6 +372,7 @@ func (o *Optimizer) analyzeCPUUsage(ctx context.Context) ([]Optimization, error)
 			optimizations = append(optimizations, Optimization{
 				Type:        "cpu",
 				Target:      fmt.Sprintf("%s (PID: %d)", procs[i].name, procs[i].pid),
+				PID:         procs[i].pid,
 				Action:      "adjust_priority",
 				TimeStamp:   time.Now(),
 				Description: fmt.Sprintf("High CPU usage: %.2f%%", procs[i].cpuPerc),
@@ -336,62 +383,24 @@ func (o *Optimizer) analyzeCPUUsage(ctx context.Context) ([]Optimization, error)
 	return optimizations, nil
 }
 
-// findLargeFiles finds files larger than 100MB
-func (o *Optimizer) findLargeFiles(ctx context.Context, root string) ([]string, error) {
-	var largeFiles []string
-
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip files we can't access
-		}
-
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		if !info.IsDir() && info.Size() > 100*1024*1024 { // 100MB
-			largeFiles = append(largeFiles, path)
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to walk directory: %w", err)
-	}
-
-	return largeFiles, nil
-}
-
-// findOldFiles finds files older than specified days
+// findOldFiles finds files under root older than specified days
 func (o *Optimizer) findOldFiles(ctx context.Context, root string, days int) ([]string, error) {
-	var oldFiles []string
-	cutoff := time.Now().AddDate(0, 0, -days)
-
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip files we can't access
-		}
-
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		if !info.IsDir() && info.ModTime().Before(cutoff) {
-			oldFiles = append(oldFiles, path)
-		}
-
-		return nil
-	})
+	o.mu.RLock()
+	config := o.scanConfig
+	o.mu.RUnlock()
 
+	config.Roots = []string{root}
+	config.LargeFileSize = 0
+	config.MaxResults = 0
+	result, err := o.scanner.scan(ctx, config, time.Now().AddDate(0, 0, -days), o.isProtected)
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk directory: %w", err)
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
 	}
 
+	oldFiles := make([]string, 0, len(result.OldFiles))
+	for _, file := range result.OldFiles {
+		oldFiles = append(oldFiles, file.Path)
+	}
 	return oldFiles, nil
 }
 
@@ -422,7 +431,7 @@ func (o *Optimizer) CleanupOldFiles(ctx context.Context, path string) error {
 	}
 
 	for _, file := range oldFiles {
-		if err := os.Remove(file); err != nil {
+		if err := o.removeFile(file); err != nil {
 			o.logger.Error("Failed to remove old file",
 				zap.String("file", file),
 				zap.Error(err))
@@ -453,7 +462,7 @@ func (o *Optimizer) AdjustProcessPriority(pid int32, priority int) error {
 	}
 
 	// Set process priority using syscall
-	err = syscall.Setpriority(syscall.PRIO_PROCESS, int(pid), priority)
+	err = setPriority(int(pid), priority)
 	if err != nil {
 		return fmt.Errorf("failed to set process priority: %w", err)
 	}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package optimizer
+
+import "syscall"
+
+// setPriority sets the nice value of a process
+func setPriority(pid, priority int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, priority)
+}
+
+// syncFilesystems writes dirty pages back to disk
+func syncFilesystems() {
+	syscall.Sync()
+}
@@ -0,0 +1,11 @@
+package optimizer
+
+import "errors"
+
+// setPriority fails; Windows has priority classes rather than nice values
+func setPriority(pid, priority int) error {
+	return errors.New("process priorities are not supported on Windows")
+}
+
+// syncFilesystems is a no-op; caches are only dropped on Linux
+func syncFilesystems() {}
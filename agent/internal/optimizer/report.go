@@ -0,0 +1,207 @@
+package optimizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ImpactReport summarizes what the optimizer did over a period
+type ImpactReport struct {
+	Since     time.Time          `json:"since"`
+	Until     time.Time          `json:"until"`
+	Applied   int                `json:"applied"`
+	Failed    int                `json:"failed"`
+	Rejected  int                `json:"rejected"`
+	Expired   int                `json:"expired"`
+	Pending   int                `json:"pending"`
+	Reclaimed map[string]float64 `json:"reclaimed"` // by resource
+	Units     map[string]string  `json:"units"`     // by resource
+	Actions   []ActionImpact     `json:"actions"`
+	Daily     []DailyImpact      `json:"daily"`
+}
+
+// ActionImpact represents the outcome of one action over the report period
+type ActionImpact struct {
+	Action      string             `json:"action"`
+	Applied     int                `json:"applied"`
+	Failed      int                `json:"failed"`
+	Reclaimed   map[string]float64 `json:"reclaimed"`
+	LastApplied time.Time          `json:"last_applied,omitempty"`
+}
+
+// DailyImpact represents the resources reclaimed on one day
+type DailyImpact struct {
+	Date      string             `json:"date"` // YYYY-MM-DD, UTC
+	Applied   int                `json:"applied"`
+	Reclaimed map[string]float64 `json:"reclaimed"`
+}
+
+// SetHistoryPath persists decided optimizations at path so reports cover
+// agent restarts, loading any history already saved there
+func (o *Optimizer) SetHistoryPath(path string) error {
+	var history []Optimization
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return fmt.Errorf("failed to read optimization history: %w", err)
+	default:
+		if err := json.Unmarshal(data, &history); err != nil {
+			return fmt.Errorf("failed to parse optimization history: %w", err)
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.historyPath = path
+	o.history = append(history, o.history...)
+	if len(o.history) > maxHistory {
+		o.history = o.history[len(o.history)-maxHistory:]
+	}
+	return nil
+}
+
+// saveHistory writes the history to the history path. The caller holds o.mu.
+func (o *Optimizer) saveHistory() error {
+	if o.historyPath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(o.history)
+	if err != nil {
+		return fmt.Errorf("failed to marshal optimization history: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(o.historyPath), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	tmp := o.historyPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write optimization history: %w", err)
+	}
+	if err := os.Rename(tmp, o.historyPath); err != nil {
+		return fmt.Errorf("failed to replace optimization history: %w", err)
+	}
+	return nil
+}
+
+// GetHistory returns decided optimizations since the given time, oldest first
+func (o *Optimizer) GetHistory(since time.Time) []Optimization {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var history []Optimization
+	for _, opt := range o.history {
+		if !opt.TimeStamp.Before(since) {
+			history = append(history, opt)
+		}
+	}
+	return history
+}
+
+// Report summarizes the optimizations decided since the given time and the
+// resources their applied actions reclaimed
+func (o *Optimizer) Report(since time.Time) *ImpactReport {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	report := &ImpactReport{
+		Since:     since,
+		Until:     time.Now(),
+		Pending:   len(o.pending),
+		Reclaimed: make(map[string]float64),
+		Units:     make(map[string]string),
+	}
+	actions := make(map[string]*ActionImpact)
+	days := make(map[string]*DailyImpact)
+
+	for _, opt := range o.history {
+		if opt.TimeStamp.Before(since) {
+			continue
+		}
+
+		switch opt.Status {
+		case StatusRejected:
+			report.Rejected++
+			continue
+		case StatusExpired:
+			report.Expired++
+			continue
+		case StatusApplied, StatusFailed:
+		default:
+			continue
+		}
+
+		a, ok := actions[opt.Action]
+		if !ok {
+			a = &ActionImpact{Action: opt.Action, Reclaimed: make(map[string]float64)}
+			actions[opt.Action] = a
+		}
+		if opt.Status == StatusFailed {
+			report.Failed++
+			a.Failed++
+			continue
+		}
+		report.Applied++
+		a.Applied++
+		if opt.TimeStamp.After(a.LastApplied) {
+			a.LastApplied = opt.TimeStamp
+		}
+
+		date := opt.TimeStamp.UTC().Format("2006-01-02")
+		d, ok := days[date]
+		if !ok {
+			d = &DailyImpact{Date: date, Reclaimed: make(map[string]float64)}
+			days[date] = d
+		}
+		d.Applied++
+
+		// Failed actions may have partly run, but only successful ones
+		// count towards what the optimizer achieved
+		if m := opt.Measurement; m != nil {
+			reclaimed := m.Reclaimed()
+			report.Reclaimed[m.Resource] += reclaimed
+			report.Units[m.Resource] = m.Unit
+			a.Reclaimed[m.Resource] += reclaimed
+			d.Reclaimed[m.Resource] += reclaimed
+		}
+	}
+
+	for _, a := range actions {
+		report.Actions = append(report.Actions, *a)
+	}
+	sort.Slice(report.Actions, func(i, j int) bool {
+		return report.Actions[i].Action < report.Actions[j].Action
+	})
+	for _, d := range days {
+		report.Daily = append(report.Daily, *d)
+	}
+	sort.Slice(report.Daily, func(i, j int) bool {
+		return report.Daily[i].Date < report.Daily[j].Date
+	})
+
+	return report
+}
+
+// logImpact logs the measured impact of an applied optimization
+func (o *Optimizer) logImpact(opt Optimization) {
+	m := opt.Measurement
+	if m == nil {
+		return
+	}
+	o.logger.Info("Optimization impact measured",
+		zap.String("id", opt.ID),
+		zap.String("action", opt.Action),
+		zap.String("resource", m.Resource),
+		zap.Float64("before", m.Before),
+		zap.Float64("after", m.After),
+		zap.Float64("reclaimed", m.Reclaimed()),
+		zap.String("unit", m.Unit))
+}
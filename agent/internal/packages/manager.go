@@ -23,8 +23,11 @@ type Package struct {
 	Name        string `json:"name"`
 	Version     string `json:"version"`
 	Description string `json:"description"`
-	Source      string `json:"source"` // apt, snap, or flatpak
+	Source      string `json:"source"` // apt, snap, flatpak, pacman, apk, zypper, winget, or choco
 	Status      string `json:"status"`
+	// Arch tells apart the architectures of a multiarch package, where
+	// the package manager reports it
+	Arch string `json:"arch,omitempty"`
 }
 
 type BasePackageManager struct {
@@ -53,6 +56,26 @@ type FlatpakPackageManager struct {
 	BasePackageManager
 }
 
+type PacmanPackageManager struct {
+	BasePackageManager
+}
+
+type ApkPackageManager struct {
+	BasePackageManager
+}
+
+type ZypperPackageManager struct {
+	BasePackageManager
+}
+
+type WingetPackageManager struct {
+	BasePackageManager
+}
+
+type ChocoPackageManager struct {
+	BasePackageManager
+}
+
 func NewPackageManager(logger *zap.Logger) ([]PackageManager, error) {
 	var managers []PackageManager
 
@@ -71,6 +94,28 @@ func NewPackageManager(logger *zap.Logger) ([]PackageManager, error) {
 		managers = append(managers, &FlatpakPackageManager{BasePackageManager{logger}})
 	}
 
+	// Check for pacman
+	if _, err := exec.LookPath("pacman"); err == nil {
+		managers = append(managers, &PacmanPackageManager{BasePackageManager{logger}})
+	}
+
+	// Check for apk
+	if _, err := exec.LookPath("apk"); err == nil {
+		managers = append(managers, &ApkPackageManager{BasePackageManager{logger}})
+	}
+
+	// Check for zypper
+	if _, err := exec.LookPath("zypper"); err == nil {
+		managers = append(managers, &ZypperPackageManager{BasePackageManager{logger}})
+	}
+
+	// Check for winget, falling back to chocolatey on Windows hosts without it
+	if _, err := exec.LookPath("winget"); err == nil {
+		managers = append(managers, &WingetPackageManager{BasePackageManager{logger}})
+	} else if _, err := exec.LookPath("choco"); err == nil {
+		managers = append(managers, &ChocoPackageManager{BasePackageManager{logger}})
+	}
+
 	if len(managers) == 0 {
 		return nil, fmt.Errorf("no supported package managers found")
 	}
@@ -147,7 +192,7 @@ func (pm *AptPackageManager) Search(ctx context.Context, query string) ([]Packag
 }
 
 func (pm *AptPackageManager) List(ctx context.Context) ([]Package, error) {
-	cmd := exec.CommandContext(ctx, "dpkg-query", "-W", "-f=${Package}\t${Version}\t${Status}\t${binary:Summary}\n")
+	cmd := exec.CommandContext(ctx, "dpkg-query", "-W", "-f=${Package}\t${Version}\t${Status}\t${binary:Summary}\t${Architecture}\n")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("apt list failed: %w", err)
@@ -159,7 +204,7 @@ func (pm *AptPackageManager) List(ctx context.Context) ([]Package, error) {
 			continue
 		}
 		parts := strings.Split(line, "\t")
-		if len(parts) != 4 {
+		if len(parts) != 5 {
 			continue
 		}
 		packages = append(packages, Package{
@@ -167,6 +212,7 @@ func (pm *AptPackageManager) List(ctx context.Context) ([]Package, error) {
 			Version:     parts[1],
 			Status:      parts[2],
 			Description: parts[3],
+			Arch:        parts[4],
 			Source:      "apt",
 		})
 	}
@@ -362,3 +408,554 @@ func (pm *FlatpakPackageManager) List(ctx context.Context) ([]Package, error) {
 	}
 	return packages, nil
 }
+
+// PacmanPackageManager implementation
+func (pm *PacmanPackageManager) Install(ctx context.Context, packages []string) error {
+	if err := pm.validatePackageNames(packages); err != nil {
+		return err
+	}
+
+	args := append([]string{"-S", "--noconfirm", "--needed"}, packages...)
+	cmd := exec.CommandContext(ctx, "pacman", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pacman install failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *PacmanPackageManager) Remove(ctx context.Context, packages []string) error {
+	if err := pm.validatePackageNames(packages); err != nil {
+		return err
+	}
+
+	args := append([]string{"-R", "--noconfirm"}, packages...)
+	cmd := exec.CommandContext(ctx, "pacman", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pacman remove failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *PacmanPackageManager) Update(ctx context.Context) error {
+	// Syncing the databases without upgrading (-Sy) would make the next
+	// install a partial upgrade, which Arch doesn't support, so they are
+	// only synced along with a full upgrade. Installs then use -S alone.
+	return pm.Upgrade(ctx)
+}
+
+func (pm *PacmanPackageManager) Upgrade(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "pacman", "-Syu", "--noconfirm")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pacman upgrade failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *PacmanPackageManager) Search(ctx context.Context, query string) ([]Package, error) {
+	cmd := exec.CommandContext(ctx, "pacman", "-Ss", query)
+	output, err := cmd.Output()
+	if err != nil {
+		// pacman exits 1 when nothing matches
+		if cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("pacman search failed: %w", err)
+	}
+
+	// Results come in pairs: "repo/name version [installed]" followed by an
+	// indented description line
+	var packages []Package
+	lines := strings.Split(string(output), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" || strings.HasPrefix(line, " ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[0]
+		if idx := strings.Index(name, "/"); idx >= 0 {
+			name = name[idx+1:]
+		}
+		pkg := Package{
+			Name:    name,
+			Version: fields[1],
+			Source:  "pacman",
+		}
+		if strings.Contains(line, "[installed") {
+			pkg.Status = "installed"
+		}
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], " ") {
+			pkg.Description = strings.TrimSpace(lines[i+1])
+			i++
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+func (pm *PacmanPackageManager) List(ctx context.Context) ([]Package, error) {
+	cmd := exec.CommandContext(ctx, "pacman", "-Q")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pacman list failed: %w", err)
+	}
+
+	var packages []Package
+	for _, line := range strings.Split(string(output), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		packages = append(packages, Package{
+			Name:    fields[0],
+			Version: fields[1],
+			Status:  "installed",
+			Source:  "pacman",
+		})
+	}
+	return packages, nil
+}
+
+// ApkPackageManager implementation
+func (pm *ApkPackageManager) Install(ctx context.Context, packages []string) error {
+	if err := pm.validatePackageNames(packages); err != nil {
+		return err
+	}
+
+	args := append([]string{"add"}, packages...)
+	cmd := exec.CommandContext(ctx, "apk", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("apk install failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ApkPackageManager) Remove(ctx context.Context, packages []string) error {
+	if err := pm.validatePackageNames(packages); err != nil {
+		return err
+	}
+
+	args := append([]string{"del"}, packages...)
+	cmd := exec.CommandContext(ctx, "apk", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("apk remove failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ApkPackageManager) Update(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "apk", "update")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("apk update failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ApkPackageManager) Upgrade(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "apk", "upgrade")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("apk upgrade failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ApkPackageManager) Search(ctx context.Context, query string) ([]Package, error) {
+	cmd := exec.CommandContext(ctx, "apk", "search", "-v", "-d", query)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("apk search failed: %w", err)
+	}
+
+	var packages []Package
+	for _, line := range strings.Split(string(output), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, " - ", 2)
+		name, version := splitApkNameVersion(parts[0])
+		pkg := Package{
+			Name:    name,
+			Version: version,
+			Source:  "apk",
+		}
+		if len(parts) == 2 {
+			pkg.Description = parts[1]
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+func (pm *ApkPackageManager) List(ctx context.Context) ([]Package, error) {
+	cmd := exec.CommandContext(ctx, "apk", "info", "-v")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("apk list failed: %w", err)
+	}
+
+	var packages []Package
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, version := splitApkNameVersion(line)
+		packages = append(packages, Package{
+			Name:    name,
+			Version: version,
+			Status:  "installed",
+			Source:  "apk",
+		})
+	}
+	return packages, nil
+}
+
+// splitApkNameVersion splits an apk "name-version-rN" string. Package names
+// may contain hyphens, so the version starts at the first hyphen followed by
+// a digit.
+func splitApkNameVersion(s string) (string, string) {
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] == '-' && s[i+1] >= '0' && s[i+1] <= '9' {
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// ZypperPackageManager implementation
+func (pm *ZypperPackageManager) Install(ctx context.Context, packages []string) error {
+	if err := pm.validatePackageNames(packages); err != nil {
+		return err
+	}
+
+	args := append([]string{"--non-interactive", "install"}, packages...)
+	cmd := exec.CommandContext(ctx, "zypper", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("zypper install failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ZypperPackageManager) Remove(ctx context.Context, packages []string) error {
+	if err := pm.validatePackageNames(packages); err != nil {
+		return err
+	}
+
+	args := append([]string{"--non-interactive", "remove"}, packages...)
+	cmd := exec.CommandContext(ctx, "zypper", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("zypper remove failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ZypperPackageManager) Update(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "zypper", "--non-interactive", "refresh")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("zypper refresh failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ZypperPackageManager) Upgrade(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "zypper", "--non-interactive", "update")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("zypper update failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ZypperPackageManager) Search(ctx context.Context, query string) ([]Package, error) {
+	cmd := exec.CommandContext(ctx, "zypper", "--non-interactive", "search", query)
+	output, err := cmd.Output()
+	if err != nil {
+		// zypper exits 104 when nothing matches
+		if cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == 104 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("zypper search failed: %w", err)
+	}
+
+	// Output is a table: "S | Name | Summary | Type"
+	var packages []Package
+	for _, line := range strings.Split(string(output), "\n") {
+		columns := strings.Split(line, "|")
+		if len(columns) < 4 {
+			continue
+		}
+		name := strings.TrimSpace(columns[1])
+		if name == "" || name == "Name" {
+			continue
+		}
+		pkg := Package{
+			Name:        name,
+			Description: strings.TrimSpace(columns[2]),
+			Source:      "zypper",
+		}
+		if strings.TrimSpace(columns[0]) == "i" || strings.TrimSpace(columns[0]) == "i+" {
+			pkg.Status = "installed"
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+func (pm *ZypperPackageManager) List(ctx context.Context) ([]Package, error) {
+	cmd := exec.CommandContext(ctx, "rpm", "-qa", "--queryformat", "%{NAME}\t%{VERSION}-%{RELEASE}\t%{SUMMARY}\t%{ARCH}\n")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("zypper list failed: %w", err)
+	}
+
+	var packages []Package
+	for _, line := range strings.Split(string(output), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) != 4 {
+			continue
+		}
+		packages = append(packages, Package{
+			Name:        parts[0],
+			Version:     parts[1],
+			Description: parts[2],
+			Arch:        parts[3],
+			Status:      "installed",
+			Source:      "zypper",
+		})
+	}
+	return packages, nil
+}
+
+// WingetPackageManager implementation
+func (pm *WingetPackageManager) Install(ctx context.Context, packages []string) error {
+	if err := pm.validatePackageNames(packages); err != nil {
+		return err
+	}
+
+	for _, pkg := range packages {
+		cmd := exec.CommandContext(ctx, "winget", "install", "--id", pkg, "--exact", "--silent",
+			"--accept-package-agreements", "--accept-source-agreements")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("winget install failed for %s: %w (output: %s)", pkg, err, string(output))
+		}
+	}
+	return nil
+}
+
+func (pm *WingetPackageManager) Remove(ctx context.Context, packages []string) error {
+	if err := pm.validatePackageNames(packages); err != nil {
+		return err
+	}
+
+	for _, pkg := range packages {
+		cmd := exec.CommandContext(ctx, "winget", "uninstall", "--id", pkg, "--exact", "--silent")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("winget uninstall failed for %s: %w (output: %s)", pkg, err, string(output))
+		}
+	}
+	return nil
+}
+
+func (pm *WingetPackageManager) Update(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "winget", "source", "update")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("winget source update failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *WingetPackageManager) Upgrade(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "winget", "upgrade", "--all", "--silent",
+		"--accept-package-agreements", "--accept-source-agreements")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("winget upgrade failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *WingetPackageManager) Search(ctx context.Context, query string) ([]Package, error) {
+	cmd := exec.CommandContext(ctx, "winget", "search", query, "--accept-source-agreements")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("winget search failed: %w", err)
+	}
+
+	var packages []Package
+	for _, row := range parseWingetTable(string(output)) {
+		packages = append(packages, Package{
+			Name:        row["Id"],
+			Version:     row["Version"],
+			Description: row["Name"],
+			Source:      "winget",
+		})
+	}
+	return packages, nil
+}
+
+func (pm *WingetPackageManager) List(ctx context.Context) ([]Package, error) {
+	cmd := exec.CommandContext(ctx, "winget", "list", "--accept-source-agreements")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("winget list failed: %w", err)
+	}
+
+	var packages []Package
+	for _, row := range parseWingetTable(string(output)) {
+		status := "installed"
+		if row["Available"] != "" {
+			status = "upgradable"
+		}
+		packages = append(packages, Package{
+			Name:        row["Id"],
+			Version:     row["Version"],
+			Description: row["Name"],
+			Status:      status,
+			Source:      "winget",
+		})
+	}
+	return packages, nil
+}
+
+// parseWingetTable parses winget's fixed-width table output into rows keyed by
+// column header. Column boundaries are taken from the header line, since
+// display names may contain spaces.
+func parseWingetTable(output string) []map[string]string {
+	lines := strings.Split(strings.ReplaceAll(output, "\r", ""), "\n")
+
+	// Locate the header, which is immediately followed by a dashed separator
+	header := -1
+	for i := 0; i+1 < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i+1]), "---") && strings.Contains(lines[i], "Id") {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil
+	}
+
+	headerRunes := []rune(lines[header])
+	var names []string
+	var starts []int
+	for i := 0; i < len(headerRunes); i++ {
+		if headerRunes[i] != ' ' && (i == 0 || headerRunes[i-1] == ' ') {
+			end := i
+			for end < len(headerRunes) && headerRunes[end] != ' ' {
+				end++
+			}
+			names = append(names, string(headerRunes[i:end]))
+			starts = append(starts, i)
+		}
+	}
+
+	var rows []map[string]string
+	for _, line := range lines[header+2:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		runes := []rune(line)
+		row := make(map[string]string, len(names))
+		for i, name := range names {
+			start := starts[i]
+			if start >= len(runes) {
+				break
+			}
+			end := len(runes)
+			if i+1 < len(starts) && starts[i+1] < end {
+				end = starts[i+1]
+			}
+			row[name] = strings.TrimSpace(string(runes[start:end]))
+		}
+		if row["Id"] == "" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// ChocoPackageManager implementation
+func (pm *ChocoPackageManager) Install(ctx context.Context, packages []string) error {
+	if err := pm.validatePackageNames(packages); err != nil {
+		return err
+	}
+
+	args := append([]string{"install", "-y", "--no-progress"}, packages...)
+	cmd := exec.CommandContext(ctx, "choco", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("choco install failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ChocoPackageManager) Remove(ctx context.Context, packages []string) error {
+	if err := pm.validatePackageNames(packages); err != nil {
+		return err
+	}
+
+	args := append([]string{"uninstall", "-y"}, packages...)
+	cmd := exec.CommandContext(ctx, "choco", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("choco uninstall failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ChocoPackageManager) Update(ctx context.Context) error {
+	// chocolatey queries its sources directly, there is no local index to refresh
+	return nil
+}
+
+func (pm *ChocoPackageManager) Upgrade(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "choco", "upgrade", "all", "-y", "--no-progress")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("choco upgrade failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+func (pm *ChocoPackageManager) Search(ctx context.Context, query string) ([]Package, error) {
+	cmd := exec.CommandContext(ctx, "choco", "search", query, "-r")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("choco search failed: %w", err)
+	}
+
+	return parseChocoOutput(string(output), ""), nil
+}
+
+func (pm *ChocoPackageManager) List(ctx context.Context) ([]Package, error) {
+	cmd := exec.CommandContext(ctx, "choco", "list", "-r")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("choco list failed: %w", err)
+	}
+
+	return parseChocoOutput(string(output), "installed"), nil
+}
+
+// parseChocoOutput parses chocolatey's "name|version" limit-output format
+func parseChocoOutput(output, status string) []Package {
+	var packages []Package
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r", ""), "\n") {
+		parts := strings.Split(line, "|")
+		if len(parts) < 2 || parts[0] == "" {
+			continue
+		}
+		packages = append(packages, Package{
+			Name:    parts[0],
+			Version: parts[1],
+			Status:  status,
+			Source:  "choco",
+		})
+	}
+	return packages
+}
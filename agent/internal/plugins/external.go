@@ -0,0 +1,338 @@
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	initializeTimeout = 10 * time.Second
+	shutdownTimeout   = 5 * time.Second
+	healthTimeout     = 5 * time.Second
+)
+
+// errMethodNotFound is the JSON-RPC code for an unimplemented method
+const errMethodNotFound = -32601
+
+// Manifest describes a plugin. Plugins return it from initialize.
+type Manifest struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+	// Capabilities are feature names the plugin adds to the agent
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Commands are the command prefixes the plugin handles, e.g. "backup:"
+	Commands []string `json:"commands,omitempty"`
+}
+
+// Event is a notification emitted by a plugin
+type Event struct {
+	Plugin    string          `json:"plugin"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// initializeParams is sent to a plugin when it starts
+type initializeParams struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	AgentVersion    string `json:"agent_version,omitempty"`
+}
+
+// executeParams is sent to run a plugin command
+type executeParams struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// ExternalPlugin is a plugin running as a separate executable that speaks
+// newline-delimited JSON-RPC 2.0 on stdin and stdout. The agent calls
+// initialize, execute and shutdown; the plugin may send event and log
+// notifications. Anything the plugin writes to stderr is logged.
+type ExternalPlugin struct {
+	path      string
+	manifest  Manifest
+	startedAt time.Time
+	mu        sync.RWMutex
+
+	cmd     *exec.Cmd
+	sandbox *sandbox
+	limits  Limits
+	stdin   io.WriteCloser
+	rpc     *rpcClient
+	logger  *zap.Logger
+	events  chan<- interface{}
+
+	exited  chan struct{}
+	exitErr error
+	stopped sync.Once
+}
+
+// startExternal launches the plugin at path under limits and performs the
+// handshake
+func startExternal(ctx context.Context, logger *zap.Logger, path, agentVersion string, limits Limits, events chan<- interface{}) (*ExternalPlugin, error) {
+	p := &ExternalPlugin{
+		path:   path,
+		limits: limits,
+		logger: logger.With(zap.String("plugin", filepath.Base(path))),
+		events: events,
+		exited: make(chan struct{}),
+	}
+
+	var err error
+	if p.cmd, err = sandboxCommand(path, limits); err != nil {
+		return nil, err
+	}
+	p.cmd.Dir = filepath.Dir(path)
+	p.cmd.Env = pluginEnv()
+
+	if p.stdin, err = p.cmd.StdinPipe(); err != nil {
+		return nil, fmt.Errorf("failed to create plugin stdin: %w", err)
+	}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plugin stdout: %w", err)
+	}
+	stderr, err := p.cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plugin stderr: %w", err)
+	}
+
+	// The plugin starts inside its cgroup, so it never runs unlimited
+	if p.sandbox, err = newSandbox(filepath.Base(path), limits); err != nil {
+		p.logger.Warn("Plugin runs with reduced limits", zap.Error(err))
+	}
+	p.sandbox.attach(p.cmd)
+	if err := p.cmd.Start(); err != nil {
+		p.sandbox.release()
+		return nil, fmt.Errorf("failed to start plugin: %w", err)
+	}
+	p.startedAt = time.Now()
+
+	if err := p.sandbox.applyLimits(p.cmd.Process.Pid, limits); err != nil {
+		p.logger.Warn("Plugin runs with reduced limits", zap.Error(err))
+	}
+
+	go p.logStderr(stderr)
+	p.rpc = newRPCClient(stdout, p.stdin, p.handleNotification)
+	go func() {
+		p.exitErr = p.cmd.Wait()
+		p.sandbox.release()
+		close(p.exited)
+	}()
+
+	initCtx, cancel := context.WithTimeout(ctx, initializeTimeout)
+	defer cancel()
+	params := initializeParams{ProtocolVersion: ProtocolVersion, AgentVersion: agentVersion}
+	var manifest Manifest
+	if err := p.rpc.Call(initCtx, "initialize", params, &manifest); err != nil {
+		p.Kill()
+		return nil, fmt.Errorf("plugin %s failed to initialize: %w", path, err)
+	}
+	p.mu.Lock()
+	p.manifest = manifest
+	p.mu.Unlock()
+	if manifest.Name == "" {
+		p.Kill()
+		return nil, fmt.Errorf("plugin %s did not report a name", path)
+	}
+
+	return p, nil
+}
+
+// pluginEnv returns the environment for plugins. The agent's environment
+// may hold credentials, so only basic variables are passed on.
+func pluginEnv() []string {
+	env := []string{fmt.Sprintf("AGENT_PLUGIN_PROTOCOL=%d", ProtocolVersion)}
+	for _, key := range []string{"PATH", "HOME", "LANG", "TZ"} {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+// Name returns the plugin name
+func (p *ExternalPlugin) Name() string {
+	return p.Manifest().Name
+}
+
+// Manifest returns the plugin manifest
+func (p *ExternalPlugin) Manifest() Manifest {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.manifest
+}
+
+// Path returns the plugin executable
+func (p *ExternalPlugin) Path() string {
+	return p.path
+}
+
+// Execute runs a command in the plugin
+func (p *ExternalPlugin) Execute(ctx context.Context, command string, args []string) (json.RawMessage, error) {
+	var result json.RawMessage
+	if err := p.rpc.Call(ctx, "execute", executeParams{Command: command, Args: args}, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Running reports whether the plugin process is still alive
+func (p *ExternalPlugin) Running() bool {
+	select {
+	case <-p.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// Stop asks the plugin to shut down and kills it if it doesn't exit in time
+func (p *ExternalPlugin) Stop(ctx context.Context) error {
+	p.stopped.Do(func() {
+		if !p.Running() {
+			return
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+		defer cancel()
+		if callErr := p.rpc.Call(shutdownCtx, "shutdown", nil, nil); callErr != nil {
+			p.logger.Debug("Plugin shutdown call failed", zap.Error(callErr))
+		}
+		p.stdin.Close()
+
+		select {
+		case <-p.exited:
+		case <-shutdownCtx.Done():
+			p.logger.Warn("Plugin did not exit, killing it")
+			p.Kill()
+			<-p.exited
+		}
+	})
+	return nil
+}
+
+// Kill kills the plugin process without asking it to shut down
+func (p *ExternalPlugin) Kill() {
+	if p.cmd.Process != nil {
+		killProcess(p.cmd.Process)
+	}
+}
+
+// StartedAt returns when the plugin process started
+func (p *ExternalPlugin) StartedAt() time.Time {
+	return p.startedAt
+}
+
+// Done is closed when the plugin process has exited
+func (p *ExternalPlugin) Done() <-chan struct{} {
+	return p.exited
+}
+
+// Err returns how the plugin process exited once Done is closed
+func (p *ExternalPlugin) Err() error {
+	return p.exitErr
+}
+
+// Health asks the plugin whether it is healthy and checks it against its
+// memory limit. Plugins that don't implement health are healthy while they
+// answer.
+func (p *ExternalPlugin) Health(ctx context.Context) error {
+	if limit := p.limits.memoryBytes(); limit > 0 {
+		if used, err := p.MemoryUsage(); err == nil && used > limit {
+			return fmt.Errorf("%w: using %d MB of %d MB", errLimitExceeded, used/1024/1024, p.limits.MemoryMB)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	err := p.rpc.Call(ctx, "health", nil, nil)
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == errMethodNotFound {
+		return nil
+	}
+	return err
+}
+
+// MemoryUsage returns the memory used by the plugin
+func (p *ExternalPlugin) MemoryUsage() (uint64, error) {
+	return p.sandbox.memoryUsage(p.cmd.Process.Pid)
+}
+
+// handleNotification processes notifications sent by the plugin
+func (p *ExternalPlugin) handleNotification(method string, params json.RawMessage) {
+	switch method {
+	case "event":
+		var event struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(params, &event); err != nil || event.Type == "" {
+			p.logger.Warn("Invalid plugin event", zap.Error(err))
+			return
+		}
+		name := p.Name()
+		if name == "" {
+			// Sent before initialize returned the manifest
+			name = filepath.Base(p.path)
+		}
+		p.emit(Event{
+			Plugin:    name,
+			Type:      event.Type,
+			Data:      event.Data,
+			Timestamp: time.Now(),
+		})
+	case "log":
+		var entry struct {
+			Level   string `json:"level"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(params, &entry); err != nil {
+			return
+		}
+		switch strings.ToLower(entry.Level) {
+		case "error":
+			p.logger.Error(entry.Message)
+		case "warn", "warning":
+			p.logger.Warn(entry.Message)
+		case "debug":
+			p.logger.Debug(entry.Message)
+		default:
+			p.logger.Info(entry.Message)
+		}
+	default:
+		p.logger.Debug("Ignoring unknown plugin notification", zap.String("method", method))
+	}
+}
+
+func (p *ExternalPlugin) emit(event Event) {
+	if p.events == nil {
+		return
+	}
+	select {
+	case p.events <- event:
+	default:
+		p.logger.Warn("Failed to send plugin event: channel full")
+	}
+}
+
+// logStderr logs the plugin's stderr line by line
+func (p *ExternalPlugin) logStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.logger.Info("Plugin output", zap.String("stderr", scanner.Text()))
+	}
+}
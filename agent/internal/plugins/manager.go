@@ -0,0 +1,506 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Plugin is an extension built into the agent
+type Plugin interface {
+	Name() string
+	Start()
+}
+
+// DefaultScanInterval is how often the plugin directory is checked for
+// added, changed and removed plugins
+const DefaultScanInterval = 10 * time.Second
+
+// Info describes a loaded external plugin
+type Info struct {
+	Manifest
+	Path        string    `json:"path"`
+	StartedAt   time.Time `json:"started_at"`
+	State       string    `json:"state"`
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"last_error,omitempty"`
+	MemoryBytes uint64    `json:"memory_bytes,omitempty"`
+	Limits      Limits    `json:"limits"`
+}
+
+// Manager discovers executables and WASM modules in a plugin directory,
+// runs them as plugins and routes commands to them. Plugins dropped into the
+// directory are loaded, replaced executables are reloaded and removed ones
+// are stopped, all without restarting the agent. Each plugin runs under
+// resource limits and is restarted when it crashes or stops responding.
+type Manager struct {
+	logger       *zap.Logger
+	dir          string
+	agentVersion string
+	events       chan<- interface{}
+	interval     time.Duration
+
+	plugins      map[string]*supervisor // by path
+	limits       Limits
+	pluginLimits map[string]Limits // by executable name
+	policy       RestartPolicy
+	host         HostConfig
+	reserved     []string
+	mu           sync.RWMutex
+
+	onRegistration   func(Registration)
+	lastRegistration Registration
+	regMu            sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewManager creates a plugin manager for dir. Plugin events are sent on
+// events as Event values.
+func NewManager(logger *zap.Logger, dir, agentVersion string, events chan<- interface{}) *Manager {
+	return &Manager{
+		logger:       logger,
+		dir:          dir,
+		agentVersion: agentVersion,
+		events:       events,
+		interval:     DefaultScanInterval,
+		plugins:      make(map[string]*supervisor),
+		limits:       DefaultLimits,
+		pluginLimits: make(map[string]Limits),
+		policy:       DefaultRestartPolicy,
+		host:         DefaultHostConfig,
+		ctx:          context.Background(),
+	}
+}
+
+// SetLimits sets the limits for the plugin executable named file, or the
+// default limits for an empty file. They apply from the next start.
+func (m *Manager) SetLimits(file string, limits Limits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if file == "" {
+		m.limits = limits
+	} else {
+		m.pluginLimits[file] = limits
+	}
+	return nil
+}
+
+// SetRestartPolicy replaces the restart policy
+func (m *Manager) SetRestartPolicy(policy RestartPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy = policy
+}
+
+// SetHostConfig sets what WASM plugins can reach through the host API.
+// It applies from the next start.
+func (m *Manager) SetHostConfig(host HostConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.host = host
+}
+
+func (m *Manager) hostConfig() HostConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.host
+}
+
+func (m *Manager) restartPolicy() RestartPolicy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.policy
+}
+
+func (m *Manager) limitsFor(path string) Limits {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if limits, ok := m.pluginLimits[filepath.Base(path)]; ok {
+		return limits
+	}
+	return m.limits
+}
+
+// Start loads the plugins in the directory and keeps watching it
+func (m *Manager) Start(ctx context.Context) error {
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	if err := m.Sync(ctx); err != nil {
+		m.logger.Warn("Failed to load plugins", zap.String("dir", m.dir), zap.Error(err))
+	}
+
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.Sync(ctx); err != nil {
+					m.logger.Debug("Failed to scan plugin directory", zap.Error(err))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops watching the directory and stops all plugins
+func (m *Manager) Shutdown(ctx context.Context) error {
+	if m.cancel != nil {
+		m.cancel()
+		<-m.done
+	}
+
+	m.mu.Lock()
+	plugins := m.plugins
+	m.plugins = make(map[string]*supervisor)
+	m.mu.Unlock()
+
+	for _, s := range plugins {
+		s.stop(ctx)
+	}
+	return nil
+}
+
+// Sync brings the loaded plugins in line with the directory
+func (m *Manager) Sync(ctx context.Context) error {
+	found, err := m.discover()
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	var unload, reload []*supervisor
+	for path, s := range m.plugins {
+		modTime, ok := found[path]
+		switch {
+		case !ok:
+			unload = append(unload, s)
+		case !modTime.Equal(s.modTime):
+			reload = append(reload, s)
+		}
+	}
+	var load []string
+	for path := range found {
+		if _, ok := m.plugins[path]; !ok {
+			load = append(load, path)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, s := range unload {
+		m.logger.Info("Plugin removed, unloading", zap.String("plugin", s.current().Name()))
+		m.unload(ctx, s)
+	}
+	for _, s := range reload {
+		m.logger.Info("Plugin changed, reloading", zap.String("plugin", s.current().Name()))
+		m.unload(ctx, s)
+		load = append(load, s.path)
+	}
+
+	sort.Strings(load)
+	for _, path := range load {
+		if _, err := m.Load(ctx, path); err != nil {
+			m.logger.Error("Failed to load plugin", zap.String("path", path), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// start runs the plugin at path: WASM modules in the agent's runtime,
+// anything else as an external process
+func (m *Manager) start(ctx context.Context, path string, limits Limits) (instance, error) {
+	if isWASM(path) {
+		p, err := startWASM(ctx, m.logger, path, limits, m.hostConfig(), m.events)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	p, err := startExternal(ctx, m.logger, path, m.agentVersion, limits, m.events)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// discover returns the plugin executables and WASM modules in the
+// directory and their modification times
+func (m *Manager) discover() (map[string]time.Time, error) {
+	if err := checkPermissions(m.dir, true); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	found := make(map[string]time.Time)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || (!isWASM(entry.Name()) && info.Mode().Perm()&0111 == 0) {
+			continue
+		}
+		path := filepath.Join(m.dir, entry.Name())
+		if err := checkPermissions(path, false); err != nil {
+			m.logger.Warn("Skipping plugin", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		found[path] = info.ModTime()
+	}
+	return found, nil
+}
+
+// checkPermissions refuses plugin files and directories that users other
+// than root and the agent's own user could modify
+func checkPermissions(path string, dir bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if dir && !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s is writable by group or others", path)
+	}
+	if uid, ok := fileOwner(info); ok && uid != 0 && uid != os.Getuid() {
+		return fmt.Errorf("%s is owned by uid %d", path, uid)
+	}
+	return nil
+}
+
+// pluginPath resolves path, which may be relative to the plugin
+// directory, and refuses anything but a regular file directly in it, also
+// once symlinks in the directory's own path are resolved
+func (m *Manager) pluginPath(path string) (string, error) {
+	dir := filepath.Clean(m.dir)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if filepath.Dir(path) != dir {
+		return "", protocol.Errorf(protocol.ErrorValidation, "plugin %s is not in %s", path, dir)
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat plugin: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", protocol.Errorf(protocol.ErrorValidation, "plugin %s is not a regular file", path)
+	}
+
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve plugin directory: %w", err)
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve plugin: %w", err)
+	}
+	if filepath.Dir(realPath) != realDir {
+		return "", protocol.Errorf(protocol.ErrorValidation, "plugin %s resolves outside %s", path, dir)
+	}
+	if err := checkPermissions(dir, true); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Load starts the plugin executable at path, which must be in the plugin
+// directory, and supervises it
+func (m *Manager) Load(ctx context.Context, path string) (*Info, error) {
+	path, err := m.pluginPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPermissions(path, false); err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat plugin: %w", err)
+	}
+	limits := m.limitsFor(path)
+	p, err := m.start(ctx, path, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSupervisor(m, path, stat.ModTime(), limits, p)
+	m.mu.Lock()
+	for otherPath, other := range m.plugins {
+		if other.current().Name() == p.Name() && otherPath != path {
+			m.mu.Unlock()
+			p.Stop(ctx)
+			return nil, fmt.Errorf("plugin %s is already loaded from %s", p.Name(), otherPath)
+		}
+	}
+	if err := m.checkCommands(path, p.Manifest()); err != nil {
+		m.mu.Unlock()
+		p.Stop(ctx)
+		return nil, err
+	}
+	if old, ok := m.plugins[path]; ok {
+		defer old.stop(ctx)
+	}
+	m.plugins[path] = s
+	s.start(m.ctx)
+	m.mu.Unlock()
+
+	manifest := p.Manifest()
+	m.logger.Info("Plugin loaded",
+		zap.String("plugin", manifest.Name),
+		zap.String("version", manifest.Version),
+		zap.Strings("capabilities", manifest.Capabilities),
+		zap.Strings("commands", manifest.Commands))
+	m.registrationChanged()
+	info := s.info()
+	return &info, nil
+}
+
+// Unload stops the plugin with the given name
+func (m *Manager) Unload(ctx context.Context, name string) error {
+	s := m.byName(name)
+	if s == nil {
+		return fmt.Errorf("plugin not loaded: %s", name)
+	}
+	m.unload(ctx, s)
+	return nil
+}
+
+// Restart stops the plugin with the given name and loads it again, which
+// also clears a plugin that gave up after repeated failures
+func (m *Manager) Restart(ctx context.Context, name string) (*Info, error) {
+	s := m.byName(name)
+	if s == nil {
+		return nil, fmt.Errorf("plugin not loaded: %s", name)
+	}
+	m.unload(ctx, s)
+	return m.Load(ctx, s.path)
+}
+
+func (m *Manager) unload(ctx context.Context, s *supervisor) {
+	m.mu.Lock()
+	if m.plugins[s.path] == s {
+		delete(m.plugins, s.path)
+	}
+	m.mu.Unlock()
+
+	s.stop(ctx)
+	m.logger.Info("Plugin unloaded", zap.String("plugin", s.current().Name()))
+	m.registrationChanged()
+}
+
+func (m *Manager) byName(name string) *supervisor {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, s := range m.plugins {
+		if s.current().Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Plugins returns the loaded plugins ordered by name
+func (m *Manager) Plugins() []Info {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	infos := make([]Info, 0, len(m.plugins))
+	for _, s := range m.plugins {
+		infos = append(infos, s.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// pluginFor returns the supervisor of the plugin handling cmd by the
+// longest matching command prefix
+func (m *Manager) pluginFor(cmd string) *supervisor {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var match *supervisor
+	longest := 0
+	for _, s := range m.plugins {
+		for _, prefix := range s.current().Manifest().Commands {
+			if strings.HasPrefix(cmd, prefix) && len(prefix) > longest {
+				match, longest = s, len(prefix)
+			}
+		}
+	}
+	return match
+}
+
+// HandleCommand processes plugin management commands and routes other
+// commands to the plugin that registered their prefix
+func (m *Manager) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "plugins:list":
+		return m.Plugins(), nil
+	case "plugins:reload":
+		if err := m.Sync(ctx); err != nil {
+			return nil, err
+		}
+		return m.Plugins(), nil
+	case "plugins:load":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "plugin path required")
+		}
+		return m.Load(ctx, args[0])
+	case "plugins:unload":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "plugin name required")
+		}
+		return nil, m.Unload(ctx, args[0])
+	case "plugins:restart":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "plugin name required")
+		}
+		return m.Restart(ctx, args[0])
+	default:
+		s := m.pluginFor(cmd)
+		if s == nil {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "unknown plugin command: %s", cmd)
+		}
+		p := s.running()
+		if p == nil {
+			return nil, fmt.Errorf("plugin %s is %s", s.current().Name(), s.info().State)
+		}
+		return p.Execute(ctx, cmd, args)
+	}
+}
@@ -0,0 +1,8 @@
+package plugins
+
+import "os"
+
+// fileOwner is unsupported on Windows, which disables the owner check
+func fileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,122 @@
+package plugins
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Registration is what loaded plugins add to the agent
+type Registration struct {
+	Capabilities []string `json:"capabilities"`
+	Commands     []string `json:"commands"`
+}
+
+// OnRegistration sets fn to be called with the plugins' registration
+// whenever plugins are loaded, unloaded or give up
+func (m *Manager) OnRegistration(fn func(Registration)) {
+	m.regMu.Lock()
+	defer m.regMu.Unlock()
+	m.onRegistration = fn
+}
+
+// Reserve keeps plugins from registering command prefixes that overlap
+// prefixes handled by the agent itself
+func (m *Manager) Reserve(prefixes ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reserved = append(m.reserved, prefixes...)
+}
+
+// Registration returns the capabilities and command prefixes of the
+// plugins that are running or being restarted
+func (m *Manager) Registration() Registration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	capabilities := make(map[string]bool)
+	commands := make(map[string]bool)
+	for _, s := range m.plugins {
+		if s.info().State == StateFailed {
+			continue
+		}
+		manifest := s.current().Manifest()
+		for _, c := range manifest.Capabilities {
+			capabilities[c] = true
+		}
+		for _, c := range manifest.Commands {
+			commands[c] = true
+		}
+	}
+	return Registration{
+		Capabilities: sortedKeys(capabilities),
+		Commands:     sortedKeys(commands),
+	}
+}
+
+// Handles reports whether cmd is a plugin management command or belongs to
+// a loaded plugin
+func (m *Manager) Handles(cmd string) bool {
+	return strings.HasPrefix(cmd, "plugins:") || m.pluginFor(cmd) != nil
+}
+
+// registrationChanged calls the registration callback if the registration
+// differs from the last one reported
+func (m *Manager) registrationChanged() {
+	reg := m.Registration()
+
+	m.regMu.Lock()
+	defer m.regMu.Unlock()
+	if m.onRegistration == nil || reflect.DeepEqual(reg, m.lastRegistration) {
+		return
+	}
+	m.lastRegistration = reg
+	m.logger.Info("Plugin registration changed",
+		zap.Strings("capabilities", reg.Capabilities),
+		zap.Strings("commands", reg.Commands))
+	m.onRegistration(reg)
+}
+
+// checkCommands refuses command prefixes that are empty or overlap a
+// reserved prefix or one registered by another plugin, since the owner of
+// a command would then be ambiguous. The caller holds m.mu.
+func (m *Manager) checkCommands(path string, manifest Manifest) error {
+	for _, prefix := range manifest.Commands {
+		if strings.TrimSpace(prefix) == "" || strings.ContainsAny(prefix, " \t\n") {
+			return fmt.Errorf("plugin %s registers invalid command prefix %q", manifest.Name, prefix)
+		}
+		for _, reserved := range append([]string{"plugins:"}, m.reserved...) {
+			if overlaps(prefix, reserved) {
+				return fmt.Errorf("plugin %s command prefix %q overlaps agent commands %q", manifest.Name, prefix, reserved)
+			}
+		}
+		for otherPath, other := range m.plugins {
+			if otherPath == path {
+				continue
+			}
+			for _, taken := range other.current().Manifest().Commands {
+				if overlaps(prefix, taken) {
+					return fmt.Errorf("plugin %s command prefix %q overlaps %q of plugin %s",
+						manifest.Name, prefix, taken, other.current().Name())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func overlaps(a, b string) bool {
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,196 @@
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ProtocolVersion is the version of the plugin protocol the agent speaks
+const ProtocolVersion = 1
+
+// maxMessageSize bounds a single JSON-RPC message from a plugin
+const maxMessageSize = 4 * 1024 * 1024
+
+// rpcRequest is a JSON-RPC 2.0 request or, without an ID, a notification
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcMessage is anything a plugin may write: a response to an agent
+// request or a notification
+type rpcMessage struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// RPCError is a JSON-RPC error returned by a plugin
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("plugin error %d: %s", e.Code, e.Message)
+}
+
+// rpcClient speaks newline-delimited JSON-RPC 2.0 over a plugin's stdin
+// and stdout
+type rpcClient struct {
+	w       io.Writer
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan rpcMessage
+	closed  bool
+	err     error
+
+	// notify receives notifications sent by the plugin
+	notify func(method string, params json.RawMessage)
+	done   chan struct{}
+}
+
+func newRPCClient(r io.Reader, w io.Writer, notify func(string, json.RawMessage)) *rpcClient {
+	c := &rpcClient{
+		w:       w,
+		pending: make(map[int64]chan rpcMessage),
+		notify:  notify,
+		done:    make(chan struct{}),
+	}
+	go c.read(r)
+	return c
+}
+
+// read dispatches messages until the plugin closes stdout
+func (c *rpcClient) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+
+		if msg.ID == nil {
+			if msg.Method != "" && c.notify != nil {
+				c.notify(msg.Method, msg.Params)
+			}
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[*msg.ID]
+		delete(c.pending, *msg.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	c.mu.Lock()
+	c.closed = true
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// Call invokes method and decodes the result into result, which may be nil
+func (c *rpcClient) Call(ctx context.Context, method string, params, result interface{}) error {
+	var raw json.RawMessage
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal params: %w", err)
+		}
+		raw = data
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		err := c.err
+		c.mu.Unlock()
+		return fmt.Errorf("plugin connection closed: %w", err)
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan rpcMessage, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.send(rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: raw}); err != nil {
+		c.forget(id)
+		return err
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return fmt.Errorf("plugin connection closed during %s", method)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil && len(msg.Result) > 0 {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				return fmt.Errorf("failed to decode %s result: %w", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		c.forget(id)
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notification, which has no response
+func (c *rpcClient) Notify(method string, params interface{}) error {
+	var raw json.RawMessage
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal params: %w", err)
+		}
+		raw = data
+	}
+	return c.send(rpcRequest{JSONRPC: "2.0", Method: method, Params: raw})
+}
+
+func (c *rpcClient) send(req rpcRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	data = append(data, '\n')
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.w.Write(data); err != nil {
+		return fmt.Errorf("failed to write to plugin: %w", err)
+	}
+	return nil
+}
+
+func (c *rpcClient) forget(id int64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
@@ -0,0 +1,59 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// Limits bound what a plugin process may use. Zero values mean unlimited.
+type Limits struct {
+	// MemoryMB caps the plugin's memory. It is enforced by a cgroup where
+	// one can be created and by the supervisor's watchdog otherwise.
+	MemoryMB int `json:"memory_mb,omitempty"`
+	// CPUPercent caps CPU time as a percentage of one core
+	CPUPercent int `json:"cpu_percent,omitempty"`
+	// MaxOpenFiles caps open file descriptors
+	MaxOpenFiles uint64 `json:"max_open_files,omitempty"`
+	// User runs the plugin as this user instead of the agent's user
+	User string `json:"user,omitempty"`
+	// IsolateFiles gives the plugin a private filesystem view with system
+	// directories read-only, its own executable and the paths below. WASM
+	// plugins are always isolated and only see the paths below.
+	IsolateFiles bool `json:"isolate_files,omitempty"`
+	// AllowedPaths are writable inside an isolated plugin
+	AllowedPaths []string `json:"allowed_paths,omitempty"`
+	// ReadOnlyPaths are readable inside an isolated plugin
+	ReadOnlyPaths []string `json:"read_only_paths,omitempty"`
+}
+
+// DefaultLimits keep a plugin from starving the agent and the host
+var DefaultLimits = Limits{
+	MemoryMB:     256,
+	CPUPercent:   50,
+	MaxOpenFiles: 256,
+}
+
+// errLimitExceeded is returned by the watchdog for a plugin over its limits
+var errLimitExceeded = errors.New("resource limit exceeded")
+
+// Validate checks that the limits are usable
+func (l Limits) Validate() error {
+	if l.MemoryMB < 0 || l.CPUPercent < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	for _, path := range append(append([]string{}, l.AllowedPaths...), l.ReadOnlyPaths...) {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("sandbox path must be absolute: %s", path)
+		}
+	}
+	if !l.IsolateFiles && (len(l.AllowedPaths) > 0 || len(l.ReadOnlyPaths) > 0) {
+		return fmt.Errorf("sandbox paths require isolate_files")
+	}
+	return nil
+}
+
+// memoryBytes returns the memory limit in bytes
+func (l Limits) memoryBytes() uint64 {
+	return uint64(l.MemoryMB) * 1024 * 1024
+}
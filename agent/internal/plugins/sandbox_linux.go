@@ -0,0 +1,332 @@
+package plugins
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+	// cgroupParent holds the plugins' cgroups and cgroupAgentLeaf the
+	// agent, both below the agent's own cgroup
+	cgroupParent    = "plugins"
+	cgroupAgentLeaf = "agent"
+	cpuPeriod       = 100000
+)
+
+// systemPaths are mounted read-only into isolated plugins when present
+var systemPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64",
+	"/etc/ssl", "/etc/pki", "/etc/ca-certificates",
+	"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf",
+	"/etc/localtime", "/etc/passwd", "/etc/group",
+}
+
+// sandbox holds the limits applied to a running plugin
+type sandbox struct {
+	cgroup   string
+	cgroupFD *os.File
+}
+
+// sandboxCommand builds the command for the plugin at path. With file
+// isolation the plugin runs under bubblewrap in its own mount, PID and IPC
+// namespaces.
+func sandboxCommand(path string, limits Limits) (*exec.Cmd, error) {
+	cmd := exec.Command(path)
+	if limits.IsolateFiles {
+		bwrap, err := exec.LookPath("bwrap")
+		if err != nil {
+			return nil, fmt.Errorf("file isolation requires bubblewrap: %w", err)
+		}
+		args := []string{
+			"--die-with-parent", "--new-session",
+			"--unshare-pid", "--unshare-ipc", "--unshare-uts",
+			"--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp",
+		}
+		for _, p := range systemPaths {
+			args = append(args, "--ro-bind-try", p, p)
+		}
+		for _, p := range limits.ReadOnlyPaths {
+			args = append(args, "--ro-bind", p, p)
+		}
+		for _, p := range limits.AllowedPaths {
+			args = append(args, "--bind", p, p)
+		}
+		args = append(args, "--ro-bind", path, path, "--chdir", filepath.Dir(path), "--", path)
+		cmd = exec.Command(bwrap, args...)
+	}
+
+	// A process group of its own lets the whole plugin tree be killed
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if limits.User != "" {
+		credential, err := lookupCredential(limits.User)
+		if err != nil {
+			return nil, err
+		}
+		cmd.SysProcAttr.Credential = credential
+	}
+	return cmd, nil
+}
+
+func lookupCredential(name string) (*syscall.Credential, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up plugin user: %w", err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid for %s: %w", name, err)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid for %s: %w", name, err)
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
+// newSandbox creates the cgroup holding the plugin's memory and CPU limits,
+// which the plugin is started in. The returned error lists limits that
+// could not be set up; the sandbox is usable regardless.
+func newSandbox(name string, limits Limits) (*sandbox, error) {
+	s := &sandbox{}
+	if limits.MemoryMB == 0 && limits.CPUPercent == 0 {
+		return s, nil
+	}
+
+	dir, err := createCgroup(name, limits)
+	if err != nil {
+		return s, fmt.Errorf("failed to create plugin cgroup: %w", err)
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		os.Remove(dir)
+		return s, fmt.Errorf("failed to open plugin cgroup: %w", err)
+	}
+	s.cgroup = dir
+	s.cgroupFD = fd
+	return s, nil
+}
+
+// attach makes cmd start inside the sandbox's cgroup. This needs clone3,
+// Linux 5.7 or later.
+func (s *sandbox) attach(cmd *exec.Cmd) {
+	if s.cgroupFD == nil {
+		return
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(s.cgroupFD.Fd())
+}
+
+// applyLimits caps the open files of the started plugin. Without a cgroup
+// it lowers the plugin's CPU priority and leaves memory to the watchdog.
+func (s *sandbox) applyLimits(pid int, limits Limits) error {
+	s.closeCgroupFD()
+
+	var errs []error
+	if limits.MaxOpenFiles > 0 {
+		if err := prlimit(pid, syscall.RLIMIT_NOFILE, limits.MaxOpenFiles); err != nil {
+			errs = append(errs, fmt.Errorf("failed to limit open files: %w", err))
+		}
+	}
+	if s.cgroup == "" && limits.CPUPercent > 0 {
+		syscall.Setpriority(syscall.PRIO_PGRP, pid, 10)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *sandbox) closeCgroupFD() {
+	if s.cgroupFD != nil {
+		s.cgroupFD.Close()
+		s.cgroupFD = nil
+	}
+}
+
+var (
+	pluginCgroupsOnce sync.Once
+	pluginCgroups     string
+	pluginCgroupsErr  error
+)
+
+// pluginCgroupParent returns the cgroup the plugins' cgroups are created
+// in, a child of the agent's own cgroup so that plugins stay within the
+// agent service's limits and delegation
+func pluginCgroupParent() (string, error) {
+	pluginCgroupsOnce.Do(func() {
+		pluginCgroups, pluginCgroupsErr = setupPluginCgroups()
+	})
+	return pluginCgroups, pluginCgroupsErr
+}
+
+// setupPluginCgroups enables the memory and CPU controllers below the
+// agent's cgroup. Cgroup v2 only lets cgroups without processes of their
+// own do that, so the agent first moves itself and its children into a
+// leaf cgroup next to the plugins.
+func setupPluginCgroups() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 not available")
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		return "", err
+	}
+	base := filepath.Join(cgroupRoot, own)
+
+	data, err := os.ReadFile(filepath.Join(base, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+	available := strings.Fields(string(data))
+	for _, controller := range []string{"memory", "cpu"} {
+		if !slices.Contains(available, controller) {
+			return "", fmt.Errorf("%s controller is not delegated to %s", controller, base)
+		}
+	}
+
+	leaf := filepath.Join(base, cgroupAgentLeaf)
+	if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	if err := joinCgroup(leaf, os.Getpid()); err != nil {
+		return "", fmt.Errorf("failed to move the agent into %s: %w", leaf, err)
+	}
+
+	parent := filepath.Join(base, cgroupParent)
+	if err := os.Mkdir(parent, 0755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	// Controllers have to be enabled on every level above the plugin
+	for _, dir := range []string{base, parent} {
+		if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+memory +cpu"), 0644); err != nil {
+			return "", fmt.Errorf("failed to enable controllers in %s: %w", dir, err)
+		}
+	}
+	return parent, nil
+}
+
+// ownCgroup returns the agent's cgroup v2 path from /proc/self/cgroup
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Clean("/" + path), nil
+		}
+	}
+	return "", fmt.Errorf("agent is not in a cgroup v2 hierarchy")
+}
+
+func createCgroup(name string, limits Limits) (string, error) {
+	parent, err := pluginCgroupParent()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(parent, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if limits.MemoryMB > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.FormatUint(limits.memoryBytes(), 10)), 0644); err != nil {
+			return "", err
+		}
+		// Keep the plugin from escaping the limit into swap
+		os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0644)
+	}
+	if limits.CPUPercent > 0 {
+		quota := fmt.Sprintf("%d %d", limits.CPUPercent*cpuPeriod/100, cpuPeriod)
+		if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(quota), 0644); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// joinCgroup moves pid and any children it already forked into dir
+func joinCgroup(dir string, pid int) error {
+	for _, p := range processTree(pid) {
+		if err := os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(p)), 0644); err != nil && p == pid {
+			return err
+		}
+	}
+	return nil
+}
+
+// processTree returns pid and its descendants
+func processTree(pid int) []int {
+	pids := []int{pid}
+	for i := 0; i < len(pids); i++ {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/task/%d/children", pids[i], pids[i]))
+		if err != nil {
+			continue
+		}
+		for _, field := range strings.Fields(string(data)) {
+			if child, err := strconv.Atoi(field); err == nil {
+				pids = append(pids, child)
+			}
+		}
+	}
+	return pids
+}
+
+// memoryUsage returns the memory used by the plugin
+func (s *sandbox) memoryUsage(pid int) (uint64, error) {
+	if s.cgroup != "" {
+		data, err := os.ReadFile(filepath.Join(s.cgroup, "memory.current"))
+		if err == nil {
+			return strconv.ParseUint(string(bytes.TrimSpace(data)), 10, 64)
+		}
+	}
+
+	var total uint64
+	pageSize := uint64(os.Getpagesize())
+	for _, p := range processTree(pid) {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", p))
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) < 2 {
+			continue
+		}
+		if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			total += pages * pageSize
+		}
+	}
+	return total, nil
+}
+
+// release removes the plugin's cgroup once its processes are gone
+func (s *sandbox) release() {
+	s.closeCgroupFD()
+	if s.cgroup != "" {
+		os.Remove(s.cgroup)
+	}
+}
+
+// killProcess kills the plugin's whole process group
+func killProcess(proc *os.Process) {
+	syscall.Kill(-proc.Pid, syscall.SIGKILL)
+	proc.Kill()
+}
+
+// prlimit sets a resource limit of another process
+func prlimit(pid, resource int, value uint64) error {
+	limit := syscall.Rlimit{Cur: value, Max: value}
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(&limit)), 0, 0, 0); errno != 0 {
+		return os.NewSyscallError("prlimit", errno)
+	}
+	return nil
+}
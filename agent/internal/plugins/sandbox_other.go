@@ -0,0 +1,58 @@
+//go:build !linux
+
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// sandbox holds the limits applied to a running plugin. Outside Linux only
+// the watchdog's memory limit applies.
+type sandbox struct{}
+
+// sandboxCommand builds the command for the plugin at path
+func sandboxCommand(path string, limits Limits) (*exec.Cmd, error) {
+	if limits.IsolateFiles {
+		return nil, fmt.Errorf("file isolation is only supported on Linux")
+	}
+	if limits.User != "" {
+		return nil, fmt.Errorf("running plugins as another user is only supported on Linux")
+	}
+	return exec.Command(path), nil
+}
+
+// newSandbox returns an empty sandbox where cgroups don't exist
+func newSandbox(name string, limits Limits) (*sandbox, error) {
+	return &sandbox{}, nil
+}
+
+func (s *sandbox) attach(cmd *exec.Cmd) {}
+
+// applyLimits is a no-op where prlimit doesn't exist
+func (s *sandbox) applyLimits(pid int, limits Limits) error {
+	return nil
+}
+
+// memoryUsage returns the resident memory of the plugin process
+func (s *sandbox) memoryUsage(pid int) (uint64, error) {
+	proc, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return 0, err
+	}
+	mem, err := proc.MemoryInfo()
+	if err != nil {
+		return 0, err
+	}
+	return mem.RSS, nil
+}
+
+func (s *sandbox) release() {}
+
+// killProcess kills the plugin process
+func killProcess(proc *os.Process) {
+	proc.Kill()
+}
@@ -0,0 +1,262 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Plugin states
+const (
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateFailed     = "failed"
+	StateStopped    = "stopped"
+)
+
+// RestartPolicy controls how crashed and unhealthy plugins are restarted
+type RestartPolicy struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxRestarts gives up on a plugin after this many restarts without a
+	// stable run; 0 restarts forever
+	MaxRestarts int
+	// StableAfter resets the backoff once a plugin has run this long
+	StableAfter time.Duration
+	// HealthInterval is how often plugins are health checked
+	HealthInterval time.Duration
+	// HealthFailures restarts a plugin after this many failed health checks
+	// in a row
+	HealthFailures int
+}
+
+// DefaultRestartPolicy restarts after 1s, doubling up to 5m, and gives up
+// after 10 restarts in quick succession
+var DefaultRestartPolicy = RestartPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     5 * time.Minute,
+	MaxRestarts:    10,
+	StableAfter:    10 * time.Minute,
+	HealthInterval: 30 * time.Second,
+	HealthFailures: 3,
+}
+
+// backoff returns the delay before the given restart
+func (p RestartPolicy) backoff(restarts int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 0; i < restarts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// instance is a running plugin, either an external process or a WASM
+// module
+type instance interface {
+	Name() string
+	Manifest() Manifest
+	Execute(ctx context.Context, command string, args []string) (json.RawMessage, error)
+	Health(ctx context.Context) error
+	MemoryUsage() (uint64, error)
+	StartedAt() time.Time
+	Stop(ctx context.Context) error
+	Kill()
+	// Done is closed when the instance has exited; Err then reports why
+	Done() <-chan struct{}
+	Err() error
+}
+
+// supervisor keeps one plugin executable running: it health checks the
+// plugin and restarts it with backoff when it crashes, hangs or exceeds
+// its limits
+type supervisor struct {
+	manager *Manager
+	path    string
+	modTime time.Time
+	limits  Limits
+	logger  *zap.Logger
+
+	plugin    instance
+	state     string
+	restarts  int
+	lastError string
+	mu        sync.RWMutex
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newSupervisor(m *Manager, path string, modTime time.Time, limits Limits, p instance) *supervisor {
+	return &supervisor{
+		manager: m,
+		path:    path,
+		modTime: modTime,
+		limits:  limits,
+		logger:  m.logger.With(zap.String("plugin", p.Manifest().Name)),
+		plugin:  p,
+		state:   StateRunning,
+	}
+}
+
+// start supervises the plugin until stop is called
+func (s *supervisor) start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	go s.run(ctx)
+}
+
+// stop ends supervision and stops the plugin
+func (s *supervisor) stop(ctx context.Context) {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+	s.current().Stop(ctx)
+
+	s.mu.Lock()
+	s.state = StateStopped
+	s.mu.Unlock()
+}
+
+func (s *supervisor) current() instance {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.plugin
+}
+
+// running returns the plugin if it is up
+func (s *supervisor) running() instance {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.state != StateRunning {
+		return nil
+	}
+	return s.plugin
+}
+
+func (s *supervisor) run(ctx context.Context) {
+	defer close(s.done)
+	policy := s.manager.restartPolicy()
+	ticker := time.NewTicker(policy.HealthInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		p := s.current()
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.Done():
+			s.failed(p, fmt.Errorf("plugin exited: %v", p.Err()))
+		case <-ticker.C:
+			err := p.Health(ctx)
+			if err == nil {
+				failures = 0
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			failures++
+			s.logger.Warn("Plugin health check failed", zap.Int("failures", failures), zap.Error(err))
+			if failures < policy.HealthFailures && !errors.Is(err, errLimitExceeded) {
+				continue
+			}
+			s.failed(p, err)
+			p.Kill()
+			<-p.Done()
+		}
+
+		failures = 0
+		if !s.restart(ctx, policy) {
+			return
+		}
+	}
+}
+
+// failed records why the plugin went down. A plugin that ran long enough
+// to count as stable starts over with the initial backoff.
+func (s *supervisor) failed(p instance, err error) {
+	uptime := time.Since(p.StartedAt())
+	s.logger.Error("Plugin failed", zap.Duration("uptime", uptime), zap.Error(err))
+	stableAfter := s.manager.restartPolicy().StableAfter
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+	if uptime >= stableAfter {
+		s.restarts = 0
+	}
+}
+
+// restart starts the plugin again after the backoff, retrying until it
+// comes up or the restart budget is spent
+func (s *supervisor) restart(ctx context.Context, policy RestartPolicy) bool {
+	for {
+		s.mu.Lock()
+		if policy.MaxRestarts > 0 && s.restarts >= policy.MaxRestarts {
+			s.state = StateFailed
+			s.mu.Unlock()
+			s.logger.Error("Plugin keeps failing, giving up", zap.Int("restarts", s.restarts))
+			s.manager.registrationChanged()
+			return false
+		}
+		delay := policy.backoff(s.restarts)
+		s.restarts++
+		s.state = StateRestarting
+		s.mu.Unlock()
+
+		s.logger.Info("Restarting plugin", zap.Duration("backoff", delay))
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		p, err := s.manager.start(ctx, s.path, s.limits)
+		if err != nil {
+			s.logger.Error("Failed to restart plugin", zap.Error(err))
+			s.mu.Lock()
+			s.lastError = err.Error()
+			s.mu.Unlock()
+			continue
+		}
+
+		s.mu.Lock()
+		s.plugin = p
+		s.state = StateRunning
+		s.mu.Unlock()
+		s.manager.registrationChanged()
+		return true
+	}
+}
+
+// info describes the supervised plugin
+func (s *supervisor) info() Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info := Info{
+		Manifest:  s.plugin.Manifest(),
+		Path:      s.path,
+		StartedAt: s.plugin.StartedAt(),
+		State:     s.state,
+		Restarts:  s.restarts,
+		LastError: s.lastError,
+		Limits:    s.limits,
+	}
+	if s.state == StateRunning {
+		if used, err := s.plugin.MemoryUsage(); err == nil {
+			info.MemoryBytes = used
+		}
+	}
+	return info
+}
@@ -0,0 +1,553 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/metrics"
+)
+
+const (
+	wasmExt      = ".wasm"
+	wasmPageSize = 64 * 1024
+	// hostModule is the import module name of the host API
+	hostModule = "agent"
+	// maxExecOutput bounds the output of a command run for a plugin
+	maxExecOutput = 1024 * 1024
+)
+
+// MetricsSource provides the metrics WASM plugins may read
+type MetricsSource interface {
+	GetMetrics() *metrics.SystemMetrics
+}
+
+// HostConfig is what WASM plugins can reach through the host API
+type HostConfig struct {
+	Metrics MetricsSource
+	// AllowedCommands are executables plugins may run by name; empty
+	// disables exec
+	AllowedCommands []string
+	ExecTimeout     time.Duration
+	// CallTimeout bounds a single call into a plugin
+	CallTimeout time.Duration
+}
+
+// DefaultHostConfig allows no commands
+var DefaultHostConfig = HostConfig{
+	ExecTimeout: 30 * time.Second,
+	CallTimeout: 30 * time.Second,
+}
+
+// WASMPlugin is a plugin compiled to WebAssembly and run in-process by
+// wazero. It gets no filesystem beyond its limits' paths, no environment
+// and no network; everything else goes through the host API, imported from
+// the "agent" module:
+//
+//	log(level, ptr, len)                        levels 0 debug .. 3 error
+//	event_emit(type_ptr, type_len, data_ptr, data_len) -> 0 on success
+//	metrics_read() -> packed JSON of the system metrics
+//	exec(ptr, len) -> packed JSON {exit_code, stdout, stderr, error} for a
+//	                  JSON {command, args} request
+//
+// The module exports alloc(size) -> ptr, describe() -> packed JSON Manifest
+// and execute(ptr, len) -> packed JSON {result, error}, and optionally
+// health() -> packed JSON {error}. Packed values hold a pointer in the high
+// and a length in the low 32 bits. The module owns buffers the host writes
+// through alloc.
+type WASMPlugin struct {
+	path      string
+	manifest  Manifest
+	startedAt time.Time
+	limits    Limits
+	host      HostConfig
+	logger    *zap.Logger
+	events    chan<- interface{}
+
+	runtime wazero.Runtime
+	module  api.Module
+	// mu serializes calls; a module instance is not safe for concurrent use
+	mu sync.Mutex
+
+	exited  chan struct{}
+	exitErr error
+	closed  sync.Once
+}
+
+// wasmResult is what execute and health return
+type wasmResult struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// execRequest is a command a plugin asks the host to run
+type execRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// execResult is the outcome of an execRequest
+type execResult struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	Error    string `json:"error,omitempty"`
+}
+
+func isWASM(path string) bool {
+	return strings.HasSuffix(path, wasmExt)
+}
+
+// startWASM compiles and instantiates the module at path and reads its
+// manifest
+func startWASM(ctx context.Context, logger *zap.Logger, path string, limits Limits, host HostConfig, events chan<- interface{}) (*WASMPlugin, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin: %w", err)
+	}
+
+	p := &WASMPlugin{
+		path:   path,
+		limits: limits,
+		host:   host,
+		logger: logger.With(zap.String("plugin", filepath.Base(path))),
+		events: events,
+		exited: make(chan struct{}),
+	}
+
+	// Closing on context done is what makes call timeouts stop runaway code
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if limits.MemoryMB > 0 {
+		config = config.WithMemoryLimitPages(uint32(limits.memoryBytes() / wasmPageSize))
+	}
+	p.runtime = wazero.NewRuntimeWithConfig(ctx, config)
+
+	if err := p.instantiate(ctx, code); err != nil {
+		p.runtime.Close(ctx)
+		return nil, err
+	}
+	p.startedAt = time.Now()
+
+	out, err := p.call(ctx, "describe", nil)
+	if err != nil {
+		p.close(ctx, err)
+		return nil, fmt.Errorf("plugin %s failed to describe itself: %w", path, err)
+	}
+	if err := json.Unmarshal(out, &p.manifest); err != nil || p.manifest.Name == "" {
+		p.close(ctx, err)
+		return nil, fmt.Errorf("plugin %s returned an invalid manifest", path)
+	}
+	return p, nil
+}
+
+func (p *WASMPlugin) instantiate(ctx context.Context, code []byte) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.runtime); err != nil {
+		return fmt.Errorf("failed to instantiate WASI: %w", err)
+	}
+
+	_, err := p.runtime.NewHostModuleBuilder(hostModule).
+		NewFunctionBuilder().WithFunc(p.hostLog).Export("log").
+		NewFunctionBuilder().WithFunc(p.hostEmit).Export("event_emit").
+		NewFunctionBuilder().WithFunc(p.hostMetrics).Export("metrics_read").
+		NewFunctionBuilder().WithFunc(p.hostExec).Export("exec").
+		Instantiate(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to instantiate host module: %w", err)
+	}
+
+	compiled, err := p.runtime.CompileModule(ctx, code)
+	if err != nil {
+		return fmt.Errorf("failed to compile plugin: %w", err)
+	}
+
+	fsConfig := wazero.NewFSConfig()
+	for _, dir := range p.limits.ReadOnlyPaths {
+		fsConfig = fsConfig.WithReadOnlyDirMount(dir, dir)
+	}
+	for _, dir := range p.limits.AllowedPaths {
+		fsConfig = fsConfig.WithDirMount(dir, dir)
+	}
+	output := &logWriter{logger: p.logger}
+	moduleConfig := wazero.NewModuleConfig().
+		WithName(filepath.Base(p.path)).
+		WithFSConfig(fsConfig).
+		WithStdout(output).
+		WithStderr(output).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader).
+		// Plugins are reactors: initialized once, then called repeatedly
+		WithStartFunctions("_initialize")
+
+	if p.module, err = p.runtime.InstantiateModule(ctx, compiled, moduleConfig); err != nil {
+		return fmt.Errorf("failed to instantiate plugin: %w", err)
+	}
+	for _, export := range []string{"alloc", "describe", "execute"} {
+		if p.module.ExportedFunction(export) == nil {
+			return fmt.Errorf("plugin does not export %s", export)
+		}
+	}
+	return nil
+}
+
+// call invokes an export with an optional JSON input and returns its
+// packed JSON output. A trap or timeout leaves the module unusable, so it
+// closes the plugin.
+func (p *WASMPlugin) call(ctx context.Context, name string, input []byte) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.exited:
+		return nil, fmt.Errorf("plugin has exited: %v", p.exitErr)
+	default:
+	}
+
+	fn := p.module.ExportedFunction(name)
+	if fn == nil {
+		return nil, fmt.Errorf("plugin does not export %s", name)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, p.host.CallTimeout)
+	defer cancel()
+
+	var params []uint64
+	if input != nil {
+		ptr, err := writeGuest(callCtx, p.module, input)
+		if err != nil {
+			return nil, err
+		}
+		params = []uint64{uint64(ptr), uint64(len(input))}
+	}
+
+	results, err := fn.Call(callCtx, params...)
+	if err != nil {
+		if callCtx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("%s timed out after %s", name, p.host.CallTimeout)
+		}
+		p.close(context.Background(), err)
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return readPacked(p.module, results[0])
+}
+
+// Name returns the plugin name
+func (p *WASMPlugin) Name() string {
+	return p.manifest.Name
+}
+
+// Manifest returns the plugin manifest
+func (p *WASMPlugin) Manifest() Manifest {
+	return p.manifest
+}
+
+// Execute runs a command in the plugin
+func (p *WASMPlugin) Execute(ctx context.Context, command string, args []string) (json.RawMessage, error) {
+	input, err := json.Marshal(executeParams{Command: command, Args: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal params: %w", err)
+	}
+	out, err := p.call(ctx, "execute", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var result wasmResult
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode execute result: %w", err)
+	}
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+	return result.Result, nil
+}
+
+// Health calls the plugin's health export if it has one
+func (p *WASMPlugin) Health(ctx context.Context) error {
+	select {
+	case <-p.exited:
+		return fmt.Errorf("plugin has exited: %v", p.exitErr)
+	default:
+	}
+	if p.module.ExportedFunction("health") == nil {
+		return nil
+	}
+
+	out, err := p.call(ctx, "health", nil)
+	if err != nil {
+		return err
+	}
+	var result wasmResult
+	if len(out) > 0 {
+		if err := json.Unmarshal(out, &result); err != nil {
+			return fmt.Errorf("failed to decode health result: %w", err)
+		}
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+	return nil
+}
+
+// MemoryUsage returns the size of the module's linear memory. The runtime
+// caps it at the memory limit, so the watchdog never has to.
+func (p *WASMPlugin) MemoryUsage() (uint64, error) {
+	if mem := p.module.Memory(); mem != nil {
+		return uint64(mem.Size()), nil
+	}
+	return 0, nil
+}
+
+// StartedAt returns when the module was instantiated
+func (p *WASMPlugin) StartedAt() time.Time {
+	return p.startedAt
+}
+
+// Stop closes the module
+func (p *WASMPlugin) Stop(ctx context.Context) error {
+	p.close(ctx, nil)
+	return nil
+}
+
+// Kill closes the module, interrupting any running call
+func (p *WASMPlugin) Kill() {
+	p.close(context.Background(), errors.New("killed"))
+}
+
+// Done is closed when the module has been closed
+func (p *WASMPlugin) Done() <-chan struct{} {
+	return p.exited
+}
+
+// Err returns why the module was closed once Done is closed
+func (p *WASMPlugin) Err() error {
+	return p.exitErr
+}
+
+func (p *WASMPlugin) close(ctx context.Context, err error) {
+	p.closed.Do(func() {
+		p.exitErr = err
+		if closeErr := p.runtime.Close(ctx); closeErr != nil {
+			p.logger.Debug("Failed to close WASM runtime", zap.Error(closeErr))
+		}
+		close(p.exited)
+	})
+}
+
+// hostLog logs a message from the plugin
+func (p *WASMPlugin) hostLog(ctx context.Context, m api.Module, level, ptr, size uint32) {
+	data, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		return
+	}
+	message := string(data)
+	switch level {
+	case 0:
+		p.logger.Debug(message)
+	case 2:
+		p.logger.Warn(message)
+	case 3:
+		p.logger.Error(message)
+	default:
+		p.logger.Info(message)
+	}
+}
+
+// hostEmit sends an event from the plugin
+func (p *WASMPlugin) hostEmit(ctx context.Context, m api.Module, typePtr, typeLen, dataPtr, dataLen uint32) uint32 {
+	eventType, ok := m.Memory().Read(typePtr, typeLen)
+	if !ok || len(eventType) == 0 {
+		return 1
+	}
+	data, ok := m.Memory().Read(dataPtr, dataLen)
+	if !ok || (len(data) > 0 && !json.Valid(data)) {
+		return 1
+	}
+	if p.events == nil {
+		return 0
+	}
+
+	event := Event{
+		Plugin:    p.Name(),
+		Type:      string(eventType),
+		Data:      append(json.RawMessage(nil), data...),
+		Timestamp: time.Now(),
+	}
+	select {
+	case p.events <- event:
+		return 0
+	default:
+		p.logger.Warn("Failed to send plugin event: channel full")
+		return 1
+	}
+}
+
+// hostMetrics returns the current system metrics to the plugin
+func (p *WASMPlugin) hostMetrics(ctx context.Context, m api.Module) uint64 {
+	if p.host.Metrics == nil {
+		return 0
+	}
+	data, err := json.Marshal(p.host.Metrics.GetMetrics())
+	if err != nil {
+		return 0
+	}
+	packed, err := writePacked(ctx, m, data)
+	if err != nil {
+		p.logger.Debug("Failed to return metrics to plugin", zap.Error(err))
+		return 0
+	}
+	return packed
+}
+
+// hostExec runs an allowed command for the plugin. Commands are looked up
+// by name without a shell and run with the plugin environment and a
+// timeout.
+func (p *WASMPlugin) hostExec(ctx context.Context, m api.Module, ptr, size uint32) uint64 {
+	result := p.exec(ctx, m, ptr, size)
+	data, err := json.Marshal(result)
+	if err != nil {
+		return 0
+	}
+	packed, err := writePacked(ctx, m, data)
+	if err != nil {
+		p.logger.Debug("Failed to return exec result to plugin", zap.Error(err))
+		return 0
+	}
+	return packed
+}
+
+func (p *WASMPlugin) exec(ctx context.Context, m api.Module, ptr, size uint32) execResult {
+	data, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		return execResult{ExitCode: -1, Error: "request out of range"}
+	}
+	var req execRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return execResult{ExitCode: -1, Error: "invalid request"}
+	}
+	if !p.commandAllowed(req.Command) {
+		p.logger.Warn("Plugin tried to run a command that is not allowed", zap.String("command", req.Command))
+		return execResult{ExitCode: -1, Error: fmt.Sprintf("command not allowed: %s", req.Command)}
+	}
+
+	path, err := exec.LookPath(req.Command)
+	if err != nil {
+		return execResult{ExitCode: -1, Error: err.Error()}
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.host.ExecTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, req.Args...)
+	cmd.Env = pluginEnv()
+	stdout := &limitedBuffer{limit: maxExecOutput}
+	stderr := &limitedBuffer{limit: maxExecOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	result := execResult{}
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		} else {
+			result.ExitCode = -1
+			result.Error = err.Error()
+		}
+	}
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	return result
+}
+
+func (p *WASMPlugin) commandAllowed(command string) bool {
+	if command == "" || strings.ContainsRune(command, '/') {
+		return false
+	}
+	for _, allowed := range p.host.AllowedCommands {
+		if command == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// writeGuest copies data into memory allocated by the module
+func writeGuest(ctx context.Context, m api.Module, data []byte) (uint32, error) {
+	results, err := m.ExportedFunction("alloc").Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("alloc failed: %w", err)
+	}
+	ptr := uint32(results[0])
+	if !m.Memory().Write(ptr, data) {
+		return 0, fmt.Errorf("alloc returned out of range memory")
+	}
+	return ptr, nil
+}
+
+// writePacked copies data into the module and returns it packed
+func writePacked(ctx context.Context, m api.Module, data []byte) (uint64, error) {
+	ptr, err := writeGuest(ctx, m, data)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(ptr)<<32 | uint64(len(data)), nil
+}
+
+// readPacked copies out the data a packed value points at
+func readPacked(m api.Module, packed uint64) ([]byte, error) {
+	ptr, size := uint32(packed>>32), uint32(packed)
+	if size == 0 {
+		return nil, nil
+	}
+	data, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		return nil, fmt.Errorf("plugin returned out of range memory")
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// logWriter logs what a module writes to stdout and stderr
+type logWriter struct {
+	logger *zap.Logger
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		w.logger.Info("Plugin output", zap.String("output", line))
+	}
+	return len(data), nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(data) > room {
+			b.Buffer.Write(data[:room])
+		} else {
+			b.Buffer.Write(data)
+		}
+	}
+	return len(data), nil
+}
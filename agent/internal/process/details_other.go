@@ -0,0 +1,13 @@
+//go:build !windows
+
+package process
+
+// platformDetail is empty where gopsutil covers everything
+type platformDetail struct{}
+
+// platformDetails has nothing to add to gopsutil outside Windows
+func platformDetails() (map[int32]platformDetail, error) {
+	return nil, nil
+}
+
+func fillDetails(info *ProcessInfo, d platformDetail) {}
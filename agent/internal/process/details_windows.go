@@ -0,0 +1,54 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/yusufpapurcu/wmi"
+)
+
+// platformDetail holds the Win32_Process properties gopsutil doesn't
+// provide on Windows
+type platformDetail struct {
+	ProcessId      uint32
+	HandleCount    uint32
+	ExecutablePath *string
+	CommandLine    *string
+	Priority       uint32
+	PageFaults     uint32
+}
+
+// platformDetails reads details of all processes from WMI in one query,
+// by PID
+func platformDetails() (map[int32]platformDetail, error) {
+	var procs []platformDetail
+	query := "SELECT ProcessId, HandleCount, ExecutablePath, CommandLine, Priority, PageFaults FROM Win32_Process"
+	if err := wmi.Query(query, &procs); err != nil {
+		return nil, fmt.Errorf("failed to query processes: %w", err)
+	}
+	details := make(map[int32]platformDetail, len(procs))
+	for _, p := range procs {
+		details[int32(p.ProcessId)] = p
+	}
+	return details, nil
+}
+
+// fillDetails completes info with what WMI knows. Handles stand in for
+// file descriptors.
+func fillDetails(info *ProcessInfo, d platformDetail) {
+	if info.FDs == 0 {
+		info.FDs = int32(d.HandleCount)
+	}
+	if info.ExePath == "" && d.ExecutablePath != nil {
+		info.ExePath = *d.ExecutablePath
+	}
+	if info.CmdLine == "" && d.CommandLine != nil {
+		info.CmdLine = *d.CommandLine
+	}
+	if info.Priority == 0 {
+		info.Priority = int32(d.Priority)
+	}
+	if info.PageFault == nil {
+		// Windows doesn't split soft and hard faults per process
+		info.PageFault = &PageFaultStats{MinorFaults: uint64(d.PageFaults)}
+	}
+}
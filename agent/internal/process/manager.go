@@ -9,6 +9,8 @@ import (
 
 	"github.com/shirou/gopsutil/v3/process"
 	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
 )
 
 type ProcessState string
@@ -67,26 +69,43 @@ type Manager struct {
 	procs  map[int32]*process.Process
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// throttles carries throttle changes to Start
+	throttles chan float64
 }
 
+// refreshInterval is how often the process list is refreshed unthrottled
+const refreshInterval = 5 * time.Second
+
 func NewManager(logger *zap.Logger) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Manager{
-		logger: logger,
-		procs:  make(map[int32]*process.Process),
-		ctx:    ctx,
-		cancel: cancel,
+		logger:    logger,
+		procs:     make(map[int32]*process.Process),
+		ctx:       ctx,
+		cancel:    cancel,
+		throttles: make(chan float64, 1),
 	}
 }
 
+// Start refreshes the process list in the background until Shutdown
 func (m *Manager) Start(ctx context.Context) error {
-	ticker := time.NewTicker(5 * time.Second)
+	crash.Go("process-manager", func() { m.run(ctx) })
+	return nil
+}
+
+func (m *Manager) run(ctx context.Context) {
+	ticker := time.NewTicker(refreshInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return
+		case <-m.ctx.Done():
+			return
+		case factor := <-m.throttles:
+			ticker.Reset(time.Duration(float64(refreshInterval) * factor))
 		case <-ticker.C:
 			if err := m.updateProcessList(); err != nil {
 				m.logger.Error("Failed to update process list", zap.Error(err))
@@ -95,6 +114,20 @@ func (m *Manager) Start(ctx context.Context) error {
 	}
 }
 
+// SetThrottle stretches the refresh interval by factor while the agent
+// is near its resource budget
+func (m *Manager) SetThrottle(factor float64) {
+	if factor < 1 {
+		factor = 1
+	}
+	// Only the latest change matters
+	select {
+	case <-m.throttles:
+	default:
+	}
+	m.throttles <- factor
+}
+
 func (m *Manager) Shutdown(ctx context.Context) error {
 	m.cancel()
 	return nil
@@ -148,6 +181,11 @@ func (m *Manager) GetProcesses() ([]ProcessInfo, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	details, err := platformDetails()
+	if err != nil {
+		m.logger.Warn("Failed to get platform process details", zap.Error(err))
+	}
+
 	var processes []ProcessInfo
 	for _, p := range m.procs {
 		info, err := m.getProcessInfo(p)
@@ -157,6 +195,9 @@ func (m *Manager) GetProcesses() ([]ProcessInfo, error) {
 				zap.Error(err))
 			continue
 		}
+		if d, ok := details[p.Pid]; ok {
+			fillDetails(&info, d)
+		}
 		processes = append(processes, info)
 	}
 
@@ -0,0 +1,215 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Baseline metrics
+const (
+	MetricCPU    = "cpu"    // percent of one core
+	MetricMemory = "memory" // resident bytes
+	MetricIO     = "io"     // bytes read and written per second
+)
+
+const (
+	baselineMinSamples = 30   // samples before a baseline is trusted
+	baselineWindow     = 1000 // older samples decay out after roughly this many
+	baselineSigma      = 3.0  // z-score that counts as significant
+	baselineRatio      = 2.0  // and the value must be at least this multiple of the mean
+)
+
+// Baseline represents the typical value of a metric for a process, kept as
+// an exponentially weighted mean and variance
+type Baseline struct {
+	Process  string    `json:"process"`
+	Metric   string    `json:"metric"`
+	Samples  int64     `json:"samples"`
+	Mean     float64   `json:"mean"`
+	Variance float64   `json:"variance"`
+	Updated  time.Time `json:"updated"`
+}
+
+// StdDev returns the baseline's standard deviation
+func (b *Baseline) StdDev() float64 {
+	return math.Sqrt(b.Variance)
+}
+
+// Deviation represents a value significantly above a process's baseline
+type Deviation struct {
+	Process  string  `json:"process"`
+	Metric   string  `json:"metric"`
+	Value    float64 `json:"value"`
+	Baseline float64 `json:"baseline"`
+	StdDev   float64 `json:"std_dev"`
+	ZScore   float64 `json:"z_score"`
+	Ratio    float64 `json:"ratio"`
+}
+
+// BaselineStore learns per-process baselines and detects regressions
+// against them
+type BaselineStore struct {
+	path      string
+	baselines map[string]*Baseline
+	mu        sync.Mutex
+}
+
+// NewBaselineStore creates a baseline store persisted at path, loading any
+// baselines already saved there. An empty path keeps baselines in memory.
+func NewBaselineStore(path string) (*BaselineStore, error) {
+	s := &BaselineStore{
+		path:      path,
+		baselines: make(map[string]*Baseline),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baselines: %w", err)
+	}
+
+	var baselines []*Baseline
+	if err := json.Unmarshal(data, &baselines); err != nil {
+		return nil, fmt.Errorf("failed to parse baselines: %w", err)
+	}
+	for _, b := range baselines {
+		s.baselines[baselineKey(b.Process, b.Metric)] = b
+	}
+	return s, nil
+}
+
+func baselineKey(process, metric string) string {
+	return process + "\x00" + metric
+}
+
+// Observe checks value against the process's baseline and then folds it in.
+// It returns a Deviation when the baseline is established and value is both
+// several standard deviations and a multiple above the mean.
+func (s *BaselineStore) Observe(process, metric string, value float64, now time.Time) *Deviation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := baselineKey(process, metric)
+	b, ok := s.baselines[key]
+	if !ok {
+		b = &Baseline{Process: process, Metric: metric}
+		s.baselines[key] = b
+	}
+
+	var deviation *Deviation
+	if b.Samples >= baselineMinSamples {
+		stddev := b.StdDev()
+		// A floor on the spread keeps near-constant baselines from
+		// flagging tiny absolute changes
+		spread := math.Max(stddev, b.Mean*0.1)
+		if spread > 0 {
+			z := (value - b.Mean) / spread
+			ratio := math.Inf(1)
+			if b.Mean > 0 {
+				ratio = value / b.Mean
+			}
+			if z >= baselineSigma && ratio >= baselineRatio {
+				deviation = &Deviation{
+					Process:  process,
+					Metric:   metric,
+					Value:    value,
+					Baseline: b.Mean,
+					StdDev:   stddev,
+					ZScore:   z,
+					Ratio:    ratio,
+				}
+			}
+		}
+	}
+
+	// Welford's update, switching to exponential weighting once the window
+	// is full so baselines follow long-term drift
+	b.Samples++
+	weight := 1 / float64(b.Samples)
+	if b.Samples > baselineWindow {
+		weight = 1.0 / baselineWindow
+	}
+	delta := value - b.Mean
+	b.Mean += weight * delta
+	b.Variance = (1 - weight) * (b.Variance + weight*delta*delta)
+	b.Updated = now
+
+	return deviation
+}
+
+// Baselines returns all baselines ordered by process and metric
+func (s *BaselineStore) Baselines() []Baseline {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	baselines := make([]Baseline, 0, len(s.baselines))
+	for _, b := range s.baselines {
+		baselines = append(baselines, *b)
+	}
+	sort.Slice(baselines, func(i, j int) bool {
+		if baselines[i].Process != baselines[j].Process {
+			return baselines[i].Process < baselines[j].Process
+		}
+		return baselines[i].Metric < baselines[j].Metric
+	})
+	return baselines
+}
+
+// Reset forgets the baselines of process, or all baselines if process is empty
+func (s *BaselineStore) Reset(process string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.baselines {
+		if process == "" || b.Process == process {
+			delete(s.baselines, key)
+		}
+	}
+}
+
+// Save writes the baselines to the store's path
+func (s *BaselineStore) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.Baselines())
+	if err != nil {
+		return fmt.Errorf("failed to marshal baselines: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create baseline directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write baselines: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace baselines: %w", err)
+	}
+	return nil
+}
+
+// deviationHotspot converts a deviation to a hotspot
+func deviationHotspot(d *Deviation, suggestion string) Hotspot {
+	return Hotspot{
+		Resource:   d.Process,
+		Usage:      d.Value,
+		Impact:     math.Min(d.Ratio/10, 1),
+		Bottleneck: true,
+		Suggestion: fmt.Sprintf("%s is %.1fx its baseline %s (%.1f vs %.1f); %s",
+			d.Process, d.Ratio, d.Metric, d.Value, d.Baseline, suggestion),
+	}
+}
@@ -0,0 +1,278 @@
+package profiler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eBPF profile types. They trace the kernel with bpftrace instead of
+// polling gopsutil and are only available when enabled with EnableEBPF.
+const (
+	TypeOffCPU  ProfileType = "offcpu"  // time processes spend blocked or waiting for a CPU
+	TypeSyscall ProfileType = "syscall" // syscall count and latency
+	TypeFileIO  ProfileType = "fileio"  // vfs read/write count, latency and bytes
+)
+
+const ebpfTopProcesses = 10
+
+// ProcessProfile represents per-process kernel tracing results
+type ProcessProfile struct {
+	PID         int           `json:"pid"`
+	Command     string        `json:"command"`
+	OffCPU      time.Duration `json:"off_cpu,omitempty"`
+	Syscalls    int64         `json:"syscalls,omitempty"`
+	SyscallTime time.Duration `json:"syscall_time,omitempty"`
+	SyscallMax  time.Duration `json:"syscall_max,omitempty"`
+	FileIOs     int64         `json:"file_ios,omitempty"`
+	FileIOTime  time.Duration `json:"file_io_time,omitempty"`
+	FileIOMax   time.Duration `json:"file_io_max,omitempty"`
+	FileIOBytes int64         `json:"file_io_bytes,omitempty"`
+}
+
+// bpftrace programs for each eBPF profile type. Maps are keyed by PID so
+// bpftrace's exit-time map dump can be parsed one line per entry.
+var ebpfPrograms = map[ProfileType]string{
+	TypeOffCPU: `
+tracepoint:sched:sched_switch {
+	@offcpu_start[args->prev_pid] = nsecs;
+	$s = @offcpu_start[args->next_pid];
+	if ($s) {
+		@offcpu_ns[args->next_pid] = sum(nsecs - $s);
+		@comm[args->next_pid] = args->next_comm;
+		delete(@offcpu_start[args->next_pid]);
+	}
+}`,
+	TypeSyscall: `
+tracepoint:raw_syscalls:sys_enter { @sys_start[tid] = nsecs; }
+tracepoint:raw_syscalls:sys_exit /@sys_start[tid]/ {
+	$d = nsecs - @sys_start[tid];
+	@sys_count[pid] = count();
+	@sys_ns[pid] = sum($d);
+	@sys_max[pid] = max($d);
+	@comm[pid] = comm;
+	delete(@sys_start[tid]);
+}`,
+	TypeFileIO: `
+kprobe:vfs_read, kprobe:vfs_write { @io_start[tid] = nsecs; }
+kretprobe:vfs_read, kretprobe:vfs_write /@io_start[tid]/ {
+	$d = nsecs - @io_start[tid];
+	@io_count[pid] = count();
+	@io_ns[pid] = sum($d);
+	@io_max[pid] = max($d);
+	if (retval > 0) { @io_bytes[pid] = sum(retval); }
+	@comm[pid] = comm;
+	delete(@io_start[tid]);
+}`,
+}
+
+// ebpfScratchMaps hold in-flight timestamps and are cleared before exit
+var ebpfScratchMaps = map[ProfileType]string{
+	TypeOffCPU:  "@offcpu_start",
+	TypeSyscall: "@sys_start",
+	TypeFileIO:  "@io_start",
+}
+
+// ebpfResult carries a finished trace back to the sampling goroutine
+type ebpfResult struct {
+	procs    []ProcessProfile
+	duration time.Duration
+	err      error
+}
+
+var bpftraceMapLine = regexp.MustCompile(`^@(\w+)\[(\d+)\]: (.*)$`)
+
+// EnableEBPF turns the eBPF profile types on or off. It is wired to the
+// features.ebpf_profiling flag, and takes effect for profiles started
+// afterwards.
+func (p *Profiler) EnableEBPF(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ebpfEnabled = enabled
+}
+
+// isEBPFType reports whether t is traced with eBPF
+func isEBPFType(t ProfileType) bool {
+	_, ok := ebpfPrograms[t]
+	return ok
+}
+
+// ebpfAvailable reports why eBPF profiling cannot run, or nil if it can
+func (p *Profiler) ebpfAvailable() error {
+	p.mu.RLock()
+	enabled := p.ebpfEnabled
+	p.mu.RUnlock()
+
+	if !enabled {
+		return fmt.Errorf("eBPF profiling is disabled")
+	}
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("eBPF profiling is only supported on Linux")
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("eBPF profiling requires root")
+	}
+	if _, err := os.Stat("/sys/kernel/btf/vmlinux"); err != nil {
+		return fmt.Errorf("kernel does not expose BTF type information")
+	}
+	if _, err := exec.LookPath("bpftrace"); err != nil {
+		return fmt.Errorf("bpftrace not found: %w", err)
+	}
+	return nil
+}
+
+// traceEBPF runs one bpftrace program covering types for duration and
+// returns per-process results
+func (p *Profiler) traceEBPF(ctx context.Context, types []ProfileType, duration time.Duration) ([]ProcessProfile, error) {
+	var script strings.Builder
+	var scratch []string
+	for _, t := range types {
+		script.WriteString(ebpfPrograms[t])
+		script.WriteString("\n")
+		scratch = append(scratch, ebpfScratchMaps[t])
+	}
+	secs := int(duration.Seconds())
+	if secs < 1 {
+		secs = 1
+	}
+	fmt.Fprintf(&script, "interval:s:%d { exit(); }\n", secs)
+	script.WriteString("END {")
+	for _, m := range scratch {
+		fmt.Fprintf(&script, " clear(%s);", m)
+	}
+	script.WriteString(" }\n")
+
+	// Give bpftrace time to attach probes and dump its maps
+	ctx, cancel := context.WithTimeout(ctx, duration+30*time.Second)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "bpftrace", "-e", script.String())
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("bpftrace failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseBPFTrace(output), nil
+}
+
+// parseBPFTrace parses bpftrace's map dump into per-process results
+func parseBPFTrace(output []byte) []ProcessProfile {
+	procs := make(map[int]*ProcessProfile)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		m := bpftraceMapLine.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+		pid, err := strconv.Atoi(m[2])
+		if err != nil || pid == 0 {
+			continue
+		}
+		proc, ok := procs[pid]
+		if !ok {
+			proc = &ProcessProfile{PID: pid}
+			procs[pid] = proc
+		}
+
+		if m[1] == "comm" {
+			proc.Command = m[3]
+			continue
+		}
+		v, err := strconv.ParseInt(m[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch m[1] {
+		case "offcpu_ns":
+			proc.OffCPU = time.Duration(v)
+		case "sys_count":
+			proc.Syscalls = v
+		case "sys_ns":
+			proc.SyscallTime = time.Duration(v)
+		case "sys_max":
+			proc.SyscallMax = time.Duration(v)
+		case "io_count":
+			proc.FileIOs = v
+		case "io_ns":
+			proc.FileIOTime = time.Duration(v)
+		case "io_max":
+			proc.FileIOMax = time.Duration(v)
+		case "io_bytes":
+			proc.FileIOBytes = v
+		}
+	}
+
+	result := make([]ProcessProfile, 0, len(procs))
+	for _, proc := range procs {
+		result = append(result, *proc)
+	}
+	return result
+}
+
+// mergeEBPF adds eBPF results to profile, keeping the top processes for
+// each measurement
+func (p *Profiler) mergeEBPF(profile *Profile, procs []ProcessProfile, duration time.Duration) {
+	type measure struct {
+		key        string
+		value      func(ProcessProfile) time.Duration
+		suggestion string
+	}
+	measures := []measure{
+		{"offcpu", func(pp ProcessProfile) time.Duration { return pp.OffCPU },
+			"Process spends most of its time blocked; check locks, I/O waits and CPU contention"},
+		{"syscall", func(pp ProcessProfile) time.Duration { return pp.SyscallTime },
+			"High syscall time; consider batching calls or reducing polling"},
+		{"fileio", func(pp ProcessProfile) time.Duration { return pp.FileIOTime },
+			"Slow file I/O; check disk latency or add buffering"},
+	}
+
+	top := make(map[int]bool)
+	for _, m := range measures {
+		sort.Slice(procs, func(i, j int) bool {
+			return m.value(procs[i]) > m.value(procs[j])
+		})
+
+		var total time.Duration
+		for i, proc := range procs {
+			v := m.value(proc)
+			total += v
+			if v == 0 || i >= ebpfTopProcesses {
+				continue
+			}
+			top[proc.PID] = true
+			profile.Data[fmt.Sprintf("%s_ns:%s[%d]", m.key, proc.Command, proc.PID)] = float64(v)
+
+			// Share of the profiling window, per process
+			share := float64(v) / float64(duration)
+			if i < 3 && share > 0.1 {
+				profile.Hotspots = append(profile.Hotspots, Hotspot{
+					Resource:   fmt.Sprintf("%s[%d] %s", proc.Command, proc.PID, m.key),
+					Usage:      share * 100,
+					Impact:     share,
+					Bottleneck: share > 0.5,
+					Suggestion: m.suggestion,
+				})
+			}
+		}
+		profile.Data[m.key+"_ns_total"] = float64(total)
+	}
+
+	for _, proc := range procs {
+		if top[proc.PID] {
+			profile.Processes = append(profile.Processes, proc)
+		}
+	}
+	profile.Metadata["ebpf"] = "bpftrace"
+}
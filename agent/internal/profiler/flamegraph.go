@@ -0,0 +1,139 @@
+package profiler
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	flameWidth     = 1200.0
+	flameRowHeight = 16.0
+	flameMinWidth  = 0.5 // frames narrower than this many pixels are dropped
+	flameHeaderPad = 24.0
+)
+
+// flameNode represents a frame in the merged call tree
+type flameNode struct {
+	name     string
+	value    int64
+	children map[string]*flameNode
+}
+
+func (n *flameNode) child(name string) *flameNode {
+	c, ok := n.children[name]
+	if !ok {
+		c = &flameNode{name: name, children: make(map[string]*flameNode)}
+		n.children[name] = c
+	}
+	return c
+}
+
+func (n *flameNode) depth() int {
+	deepest := 0
+	for _, c := range n.children {
+		if d := c.depth(); d > deepest {
+			deepest = d
+		}
+	}
+	return deepest + 1
+}
+
+// flameGraph renders a gzipped pprof profile as an SVG flame graph. The last
+// sample type is used as the frame weight (CPU time, in-use bytes, delay).
+func flameGraph(data []byte, title string) ([]byte, error) {
+	prof, err := profile.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profile: %w", err)
+	}
+	if len(prof.SampleType) == 0 {
+		return nil, fmt.Errorf("profile has no sample types")
+	}
+	valueIndex := len(prof.SampleType) - 1
+	unit := prof.SampleType[valueIndex].Unit
+
+	root := &flameNode{name: "all", children: make(map[string]*flameNode)}
+	for _, sample := range prof.Sample {
+		value := sample.Value[valueIndex]
+		if value <= 0 {
+			continue
+		}
+		root.value += value
+
+		// Locations run leaf to root, and inlined lines within a location
+		// run callee to caller
+		node := root
+		for i := len(sample.Location) - 1; i >= 0; i-- {
+			lines := sample.Location[i].Line
+			for j := len(lines) - 1; j >= 0; j-- {
+				name := "?"
+				if lines[j].Function != nil {
+					name = lines[j].Function.Name
+				}
+				node = node.child(name)
+				node.value += value
+			}
+		}
+	}
+
+	height := float64(root.depth())*flameRowHeight + flameHeaderPad
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<?xml version="1.0" standalone="no"?>`+"\n")
+	fmt.Fprintf(&b, `<svg version="1.1" width="%.0f" height="%.0f" xmlns="http://www.w3.org/2000/svg" font-family="Verdana" font-size="11">`+"\n", flameWidth, height)
+	fmt.Fprintf(&b, `<text x="%.0f" y="16" text-anchor="middle" font-size="14">%s</text>`+"\n", flameWidth/2, html.EscapeString(title))
+	if root.value > 0 {
+		renderFlameNode(&b, root, 0, flameWidth/float64(root.value), height, 0, root.value, unit)
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes(), nil
+}
+
+// renderFlameNode draws n and its children, widest first, with the root at
+// the bottom of the graph
+func renderFlameNode(b *bytes.Buffer, n *flameNode, x, scale, height float64, depth int, total int64, unit string) {
+	width := float64(n.value) * scale
+	if width < flameMinWidth {
+		return
+	}
+
+	y := height - float64(depth+1)*flameRowHeight
+	name := html.EscapeString(n.name)
+	fmt.Fprintf(b, `<g><title>%s (%d %s, %.2f%%)</title>`, name, n.value, unit, float64(n.value)*100/float64(total))
+	fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" rx="2"/>`, x, y, width, flameRowHeight-1, flameColor(n.name))
+	// Roughly 7px per character at 11px Verdana
+	if chars := int((width - 6) / 7); chars > 2 {
+		label := n.name
+		if len(label) > chars {
+			label = label[:chars-2] + ".."
+		}
+		fmt.Fprintf(b, `<text x="%.1f" y="%.1f">%s</text>`, x+3, y+flameRowHeight-4, html.EscapeString(label))
+	}
+	b.WriteString("</g>\n")
+
+	children := make([]*flameNode, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].value != children[j].value {
+			return children[i].value > children[j].value
+		}
+		return children[i].name < children[j].name
+	})
+	for _, c := range children {
+		renderFlameNode(b, c, x, scale, height, depth+1, total, unit)
+		x += float64(c.value) * scale
+	}
+}
+
+// flameColor picks a stable warm color for a function name
+func flameColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+v%50, 80+(v>>8)%130, (v>>16)%55)
+}
@@ -0,0 +1,269 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/systemd"
+)
+
+// Runtime profiles of the agent process
+const (
+	RuntimeCPU       = "cpu"
+	RuntimeHeap      = "heap"
+	RuntimeGoroutine = "goroutine"
+	RuntimeBlock     = "block"
+	RuntimeMutex     = "mutex"
+)
+
+// Capture formats
+const (
+	FormatPprof = "pprof"
+	FormatSVG   = "svg"
+)
+
+const (
+	defaultCaptureDuration = 10 * time.Second
+	defaultProfileDuration = 30 * time.Second
+	maxCaptureDuration     = 5 * time.Minute
+)
+
+// Capture represents a runtime profile of the agent, ready for download
+type Capture struct {
+	Profile     string        `json:"profile"`
+	Format      string        `json:"format"`
+	ContentType string        `json:"content_type"`
+	Filename    string        `json:"filename"`
+	Data        []byte        `json:"data"`
+	Duration    time.Duration `json:"duration,omitempty"`
+	Timestamp   time.Time     `json:"timestamp"`
+}
+
+// HandleCommand processes profiler commands
+func (p *Profiler) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "profiler:capture":
+		// profiler:capture <profile> [seconds] [pprof|svg]
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "profile type required")
+		}
+		duration := defaultCaptureDuration
+		if len(args) > 1 {
+			secs, err := strconv.Atoi(args[1])
+			if err != nil || secs < 1 {
+				return nil, fmt.Errorf("invalid duration: %s", args[1])
+			}
+			duration = time.Duration(secs) * time.Second
+		}
+		format := FormatPprof
+		if len(args) > 2 {
+			format = args[2]
+		}
+		return p.Capture(ctx, args[0], duration, format)
+	case "profiler:start":
+		// profiler:start <type>[,<type>...] [seconds]
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "profile types required")
+		}
+		var types []ProfileType
+		for _, name := range strings.Split(args[0], ",") {
+			t := ProfileType(strings.TrimSpace(name))
+			switch t {
+			case TypeCPU, TypeMemory, TypeIO, TypeNetwork, TypeLock, TypeOffCPU, TypeSyscall, TypeFileIO:
+				types = append(types, t)
+			default:
+				return nil, protocol.Errorf(protocol.ErrorValidation, "unknown profile type: %s", name)
+			}
+		}
+		duration := defaultProfileDuration
+		if len(args) > 1 {
+			secs, err := strconv.Atoi(args[1])
+			if err != nil || secs < 1 || time.Duration(secs)*time.Second > maxCaptureDuration {
+				return nil, protocol.Errorf(protocol.ErrorValidation, "invalid duration: %s", args[1])
+			}
+			duration = time.Duration(secs) * time.Second
+		}
+		// Sampling outlives the command, ending after duration
+		return p.Start(context.WithoutCancel(ctx), ProfileConfig{
+			Types:      types,
+			Duration:   duration,
+			Interval:   time.Second,
+			MaxSamples: int(duration / time.Second),
+		})
+	case "profiler:list":
+		return p.GetProfiles(), nil
+	case "profiler:get":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "profile ID required")
+		}
+		profile, ok := p.GetProfile(args[0])
+		if !ok {
+			return nil, protocol.Errorf(protocol.ErrorNotFound, "profile not found: %s", args[0])
+		}
+		return profile, nil
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown profiler command: %s", cmd)
+	}
+}
+
+// Capture records a runtime profile of the agent. CPU, block and mutex
+// profiles are collected over duration; heap and goroutine profiles are
+// snapshots.
+func (p *Profiler) Capture(ctx context.Context, profile string, duration time.Duration, format string) (*Capture, error) {
+	if format != FormatPprof && format != FormatSVG {
+		return nil, fmt.Errorf("unsupported capture format: %s", format)
+	}
+	if duration <= 0 {
+		duration = defaultCaptureDuration
+	}
+	if duration > maxCaptureDuration {
+		duration = maxCaptureDuration
+	}
+
+	p.mu.Lock()
+	if p.capturing {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("capture already in progress")
+	}
+	p.capturing = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.capturing = false
+		p.mu.Unlock()
+	}()
+
+	start := time.Now()
+	var buf bytes.Buffer
+	var err error
+	switch profile {
+	case RuntimeCPU:
+		err = captureCPU(ctx, &buf, duration)
+	case RuntimeHeap, RuntimeGoroutine:
+		duration = 0
+		err = rpprof.Lookup(profile).WriteTo(&buf, 0)
+	case RuntimeBlock:
+		runtime.SetBlockProfileRate(1)
+		err = captureOver(ctx, &buf, profile, duration)
+		runtime.SetBlockProfileRate(0)
+	case RuntimeMutex:
+		prev := runtime.SetMutexProfileFraction(1)
+		err = captureOver(ctx, &buf, profile, duration)
+		runtime.SetMutexProfileFraction(prev)
+	default:
+		return nil, fmt.Errorf("unsupported profile: %s", profile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture %s profile: %w", profile, err)
+	}
+
+	capture := &Capture{
+		Profile:     profile,
+		Format:      format,
+		ContentType: "application/octet-stream",
+		Filename:    fmt.Sprintf("%s-%s.pb.gz", profile, start.Format("20060102-150405")),
+		Data:        buf.Bytes(),
+		Duration:    duration,
+		Timestamp:   start,
+	}
+	if format == FormatSVG {
+		svg, err := flameGraph(buf.Bytes(), fmt.Sprintf("%s profile, %s", profile, start.Format(time.RFC3339)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to render flame graph: %w", err)
+		}
+		capture.ContentType = "image/svg+xml"
+		capture.Filename = fmt.Sprintf("%s-%s.svg", profile, start.Format("20060102-150405"))
+		capture.Data = svg
+	}
+
+	p.logger.Info("Captured runtime profile",
+		zap.String("profile", profile),
+		zap.String("format", format),
+		zap.Duration("duration", duration),
+		zap.Int("bytes", len(capture.Data)))
+	return capture, nil
+}
+
+// captureCPU records a CPU profile for duration or until ctx is done
+func captureCPU(ctx context.Context, buf *bytes.Buffer, duration time.Duration) error {
+	if err := rpprof.StartCPUProfile(buf); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(duration):
+	}
+	rpprof.StopCPUProfile()
+	return nil
+}
+
+// captureOver waits for duration so events accumulate, then writes profile
+func captureOver(ctx context.Context, buf *bytes.Buffer, profile string, duration time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+	}
+	return rpprof.Lookup(profile).WriteTo(buf, 0)
+}
+
+// ServePprof serves the net/http/pprof endpoints on addr until ctx is done.
+// The handlers are registered on a private mux so they are never exposed by
+// other HTTP servers in the agent; addr should be a loopback address.
+func (p *Profiler) ServePprof(ctx context.Context, addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid pprof address: %w", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		p.logger.Warn("pprof endpoint is not bound to loopback", zap.String("address", addr))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// A socket named "pprof" passed by systemd socket activation is used
+	// instead of addr
+	listener := systemd.Listener("pprof")
+	if listener == nil {
+		if listener, err = net.Listen("tcp", addr); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+	}
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			p.logger.Error("pprof server failed", zap.Error(err))
+		}
+	}()
+
+	p.logger.Info("Serving pprof endpoints", zap.String("address", listener.Addr().String()))
+	return nil
+}
@@ -35,6 +35,8 @@ type Profile struct {
 	Data      map[string]float64    `json:"data"`
 	Metadata  map[string]string     `json:"metadata"`
 	Hotspots  []Hotspot            `json:"hotspots"`
+	Processes []ProcessProfile     `json:"processes,omitempty"`
+	Deviations []Deviation         `json:"deviations,omitempty"`
 }
 
 // Hotspot represents a performance hotspot
@@ -61,22 +63,66 @@ type Profiler struct {
 	profiles  map[string]*Profile
 	mu        sync.RWMutex
 	sampling  bool
+	capturing bool
+	ebpfEnabled bool
+	baselines *BaselineStore
+	lastIO    map[int32]ioSample
 }
 
-// NewProfiler creates a new profiler
+// ioSample is a process's cumulative I/O at a point in time
+type ioSample struct {
+	bytes uint64
+	at    time.Time
+}
+
+// NewProfiler creates a new profiler. Baselines are kept in memory until
+// SetBaselineStore supplies a persistent store.
 func NewProfiler(logger *zap.Logger) *Profiler {
+	baselines, _ := NewBaselineStore("")
 	return &Profiler{
-		logger:   logger,
-		profiles: make(map[string]*Profile),
+		logger:    logger,
+		profiles:  make(map[string]*Profile),
+		baselines: baselines,
+		lastIO:    make(map[int32]ioSample),
 	}
 }
 
+// SetBaselineStore replaces the store used for regression detection
+func (p *Profiler) SetBaselineStore(store *BaselineStore) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.baselines = store
+}
+
+// GetBaselines returns the learned per-process baselines
+func (p *Profiler) GetBaselines() []Baseline {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.baselines.Baselines()
+}
+
 // Start begins profiling
 func (p *Profiler) Start(ctx context.Context, config ProfileConfig) (*Profile, error) {
 	if p.sampling {
 		return nil, fmt.Errorf("profiling already in progress")
 	}
 
+	var pollTypes, ebpfTypes []ProfileType
+	for _, t := range config.Types {
+		if isEBPFType(t) {
+			ebpfTypes = append(ebpfTypes, t)
+		} else {
+			pollTypes = append(pollTypes, t)
+		}
+	}
+	if len(ebpfTypes) > 0 {
+		if err := p.ebpfAvailable(); err != nil {
+			return nil, err
+		}
+	}
+
 	profile := &Profile{
 		ID:        fmt.Sprintf("prof_%d", time.Now().UnixNano()),
 		StartTime: time.Now(),
@@ -94,23 +140,59 @@ func (p *Profiler) Start(ctx context.Context, config ProfileConfig) (*Profile, e
 		defer func() {
 			p.mu.Lock()
 			p.sampling = false
+			baselines := p.baselines
 			p.mu.Unlock()
+
+			if err := baselines.Save(); err != nil {
+				p.logger.Error("Failed to save baselines", zap.Error(err))
+			}
 		}()
 
+		// eBPF tracing runs once for the whole profile, alongside polling
+		var ebpfResults chan ebpfResult
+		if len(ebpfTypes) > 0 {
+			duration := config.Duration
+			if duration <= 0 {
+				duration = config.Interval * time.Duration(config.MaxSamples)
+			}
+			ebpfResults = make(chan ebpfResult, 1)
+			go func() {
+				procs, err := p.traceEBPF(ctx, ebpfTypes, duration)
+				ebpfResults <- ebpfResult{procs: procs, duration: duration, err: err}
+			}()
+		}
+
 		ticker := time.NewTicker(config.Interval)
 		defer ticker.Stop()
 
 		samples := 0
+		polling := len(pollTypes) > 0
 		for {
+			if !polling && ebpfResults == nil {
+				return
+			}
+
 			select {
 			case <-ctx.Done():
 				return
+			case res := <-ebpfResults:
+				ebpfResults = nil
+				if res.err != nil {
+					p.logger.Error("eBPF profiling failed", zap.Error(res.err))
+					profile.Metadata["ebpf_error"] = res.err.Error()
+					continue
+				}
+				p.mergeEBPF(profile, res.procs, res.duration)
 			case <-ticker.C:
+				if !polling {
+					continue
+				}
 				if samples >= config.MaxSamples {
-					return
+					polling = false
+					continue
 				}
 
-				for _, profType := range config.Types {
+				for _, profType := range pollTypes {
 					if err := p.sample(profile, profType); err != nil {
 						p.logger.Error("Sampling failed",
 							zap.String("type", string(profType)),
@@ -158,11 +240,8 @@ func (p *Profiler) sampleCPU(profile *Profile) error {
 		return fmt.Errorf("failed to get processes: %w", err)
 	}
 
-	var topProcs []struct {
-		name    string
-		cpu     float64
-	}
-
+	// Processes sharing a name (worker pools) share a baseline
+	usage := make(map[string]float64)
 	for _, proc := range processes {
 		cpu, err := proc.CPUPercent()
 		if err != nil {
@@ -174,28 +253,19 @@ func (p *Profiler) sampleCPU(profile *Profile) error {
 			continue
 		}
 
-		topProcs = append(topProcs, struct {
-			name    string
-			cpu     float64
-		}{name, cpu})
+		usage[name] += cpu
 	}
 
-	// Sort by CPU usage
-	sort.Slice(topProcs, func(i, j int) bool {
-		return topProcs[i].cpu > topProcs[j].cpu
-	})
-
-	// Add hotspots
-	for i := 0; i < min(3, len(topProcs)); i++ {
-		proc := topProcs[i]
-		profile.Hotspots = append(profile.Hotspots, Hotspot{
-			Resource:   proc.name,
-			Usage:     proc.cpu,
-			Impact:    proc.cpu / 100,
-			Bottleneck: proc.cpu > 80,
-			Suggestion: "Consider optimizing or scaling this process",
-		})
-	}
+	p.addHotspots(profile, MetricCPU, usage,
+		func(name string, cpu float64) Hotspot {
+			return Hotspot{
+				Resource:   name,
+				Usage:      cpu,
+				Impact:     cpu / 100,
+				Suggestion: "Consider optimizing or scaling this process",
+			}
+		},
+		"check for runaway loops or increased load")
 
 	// Update profile data
 	for i, pct := range percentages {
@@ -220,6 +290,41 @@ func (p *Profiler) sampleMemory(profile *Profile) error {
 	profile.Data["heap_released"] = float64(m.HeapReleased)
 	profile.Data["heap_objects"] = float64(m.HeapObjects)
 
+	processes, err := process.Processes()
+	if err != nil {
+		return fmt.Errorf("failed to get processes: %w", err)
+	}
+
+	usage := make(map[string]float64)
+	for _, proc := range processes {
+		mem, err := proc.MemoryInfo()
+		if err != nil {
+			continue
+		}
+
+		name, err := proc.Name()
+		if err != nil {
+			continue
+		}
+
+		usage[name] += float64(mem.RSS)
+	}
+
+	var totalRSS float64
+	for _, rss := range usage {
+		totalRSS += rss
+	}
+	p.addHotspots(profile, MetricMemory, usage,
+		func(name string, rss float64) Hotspot {
+			return Hotspot{
+				Resource:   name,
+				Usage:      rss / totalRSS * 100,
+				Impact:     rss / totalRSS,
+				Suggestion: "Large resident set; check for leaks or tune caches",
+			}
+		},
+		"it may be leaking memory")
+
 	// Add memory hotspots
 	if float64(m.HeapInuse)/float64(m.HeapSys) > 0.9 {
 		profile.Hotspots = append(profile.Hotspots, Hotspot{
@@ -241,11 +346,10 @@ func (p *Profiler) sampleIO(profile *Profile) error {
 		return fmt.Errorf("failed to get processes: %w", err)
 	}
 
+	now := time.Now()
 	var totalRead, totalWrite uint64
-	var topIO []struct {
-		name     string
-		ioTotal  uint64
-	}
+	rates := make(map[string]float64)
+	seen := make(map[int32]bool)
 
 	for _, proc := range processes {
 		io, err := proc.IOCounters()
@@ -261,28 +365,36 @@ func (p *Profiler) sampleIO(profile *Profile) error {
 		totalRead += io.ReadBytes
 		totalWrite += io.WriteBytes
 
-		topIO = append(topIO, struct {
-			name     string
-			ioTotal  uint64
-		}{name, io.ReadBytes + io.WriteBytes})
+		// Counters are cumulative, so baselines use the rate since the last sample
+		total := io.ReadBytes + io.WriteBytes
+		seen[proc.Pid] = true
+		if last, ok := p.lastIO[proc.Pid]; ok && total >= last.bytes {
+			if elapsed := now.Sub(last.at).Seconds(); elapsed > 0 {
+				rates[name] += float64(total-last.bytes) / elapsed
+			}
+		}
+		p.lastIO[proc.Pid] = ioSample{bytes: total, at: now}
+	}
+	for pid := range p.lastIO {
+		if !seen[pid] {
+			delete(p.lastIO, pid)
+		}
 	}
 
-	// Sort by IO usage
-	sort.Slice(topIO, func(i, j int) bool {
-		return topIO[i].ioTotal > topIO[j].ioTotal
-	})
-
-	// Add IO hotspots
-	for i := 0; i < min(3, len(topIO)); i++ {
-		proc := topIO[i]
-		profile.Hotspots = append(profile.Hotspots, Hotspot{
-			Resource:   proc.name,
-			Usage:     float64(proc.ioTotal) / float64(totalRead+totalWrite) * 100,
-			Impact:    float64(proc.ioTotal) / float64(1<<30), // Impact in GB
-			Bottleneck: proc.ioTotal > 1<<30, // More than 1GB
-			Suggestion: "High I/O usage, consider optimizing I/O operations or using buffering",
-		})
+	var totalRate float64
+	for _, rate := range rates {
+		totalRate += rate
 	}
+	p.addHotspots(profile, MetricIO, rates,
+		func(name string, rate float64) Hotspot {
+			return Hotspot{
+				Resource:   name,
+				Usage:      rate / totalRate * 100,
+				Impact:     rate / float64(100<<20), // relative to 100MB/s
+				Suggestion: "High I/O usage, consider optimizing I/O operations or using buffering",
+			}
+		},
+		"check for unexpected scans, logging or swapping")
 
 	profile.Data["total_read"] = float64(totalRead)
 	profile.Data["total_write"] = float64(totalWrite)
@@ -290,6 +402,48 @@ func (p *Profiler) sampleIO(profile *Profile) error {
 	return nil
 }
 
+// addHotspots adds the top three processes by value as hotspots and checks
+// every process against its baseline. Processes significantly above their
+// baseline are marked as bottlenecks; those outside the top three are added
+// as hotspots of their own.
+func (p *Profiler) addHotspots(profile *Profile, metric string, values map[string]float64, hotspot func(string, float64) Hotspot, suggestion string) {
+	p.mu.RLock()
+	baselines := p.baselines
+	p.mu.RUnlock()
+
+	now := time.Now()
+	deviations := make(map[string]*Deviation)
+	for name, value := range values {
+		if d := baselines.Observe(name, metric, value, now); d != nil {
+			deviations[name] = d
+			profile.Deviations = append(profile.Deviations, *d)
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return values[names[i]] > values[names[j]]
+	})
+
+	for i, name := range names {
+		d := deviations[name]
+		switch {
+		case i < 3:
+			h := hotspot(name, values[name])
+			if d != nil {
+				h.Bottleneck = true
+				h.Suggestion = deviationHotspot(d, suggestion).Suggestion
+			}
+			profile.Hotspots = append(profile.Hotspots, h)
+		case d != nil:
+			profile.Hotspots = append(profile.Hotspots, deviationHotspot(d, suggestion))
+		}
+	}
+}
+
 // sampleNetwork samples network usage
 func (p *Profiler) sampleNetwork(profile *Profile) error {
 	// Implement network usage sampling
@@ -345,11 +499,3 @@ func (p *Profiler) ClearProfiles() {
 	defer p.mu.Unlock()
 	p.profiles = make(map[string]*Profile)
 }
-
-// min returns the minimum of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
@@ -0,0 +1,31 @@
+package protocol
+
+import "time"
+
+// BootInfo describes the current boot of the host
+type BootInfo struct {
+	BootID   string    `json:"boot_id"`
+	BootTime time.Time `json:"boot_time"`
+	Kernel   string    `json:"kernel"`
+	// Uptime of the host in seconds
+	Uptime float64 `json:"uptime_seconds"`
+}
+
+// Reboot is sent as an Event of kind reboot when the agent starts on a
+// new boot of the host. Unexpected reboots happened while the agent was
+// running, without it shutting down cleanly.
+type Reboot struct {
+	BootID         string    `json:"boot_id"`
+	PreviousBootID string    `json:"previous_boot_id"`
+	BootTime       time.Time `json:"boot_time"`
+	// LastSeen is the last time the agent was known running on the
+	// previous boot
+	LastSeen time.Time `json:"last_seen"`
+	// Downtime from LastSeen to the boot, in seconds
+	Downtime       float64   `json:"downtime_seconds"`
+	Unexpected     bool      `json:"unexpected"`
+	Kernel         string    `json:"kernel"`
+	PreviousKernel string    `json:"previous_kernel,omitempty"`
+	KernelChanged  bool      `json:"kernel_changed"`
+	Timestamp      time.Time `json:"timestamp"`
+}
@@ -0,0 +1,17 @@
+package protocol
+
+import "time"
+
+// ClockDrift is the offset of the agent's clock against NTP servers,
+// sent as an Event of kind clock_drift when it crosses the threshold.
+// Durations are in seconds; a positive offset means the agent's clock
+// is behind.
+type ClockDrift struct {
+	Offset    float64 `json:"offset_seconds"`
+	Delay     float64 `json:"delay_seconds"`
+	Threshold float64 `json:"threshold_seconds"`
+	Exceeded  bool    `json:"exceeded"`
+	// Servers are the servers that answered
+	Servers   []string  `json:"servers"`
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Codecs encode messages on the wire. JSON is always supported; agents
+// offer binary codecs when registering and the server picks one in its
+// Registered reply.
+const (
+	CodecJSON = "json"
+	CodecCBOR = "cbor"
+)
+
+// Codec encodes and decodes messages
+type Codec interface {
+	Name() string
+	// Binary reports whether messages are sent as binary frames
+	Binary() bool
+	Marshal(msg Message) ([]byte, error)
+	Unmarshal(data []byte, msg *Message) error
+}
+
+// Registered is the server's reply to a registration
+type Registered struct {
+	// Codec is the codec the server accepted, one of those the agent
+	// offered; empty keeps JSON
+	Codec string `json:"codec,omitempty"`
+}
+
+// NewCodec returns the codec called name
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case CodecJSON:
+		return jsonCodec{}, nil
+	case CodecCBOR:
+		return cborCodec, nil
+	default:
+		return nil, fmt.Errorf("unsupported codec: %s", name)
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return CodecJSON }
+func (jsonCodec) Binary() bool { return false }
+
+func (jsonCodec) Marshal(msg Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec) Unmarshal(data []byte, msg *Message) error {
+	return json.Unmarshal(data, msg)
+}
+
+// cborMessage is the CBOR form of a Message. Fields are keyed by small
+// integers and the timestamp is sent as Unix time. The payload is carried as a
+// byte string, so it is neither escaped nor rescanned.
+type cborMessage struct {
+	Type      MessageType `cbor:"1,keyasint"`
+	ID        string      `cbor:"2,keyasint"`
+	Timestamp time.Time   `cbor:"3,keyasint"`
+	Payload   []byte      `cbor:"4,keyasint,omitempty"`
+	Encoding  string      `cbor:"5,keyasint,omitempty"`
+}
+
+type cborMessageCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+var cborCodec = newCBORCodec()
+
+func newCBORCodec() cborMessageCodec {
+	enc, err := cbor.EncOptions{Time: cbor.TimeUnixDynamic}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	dec, err := cbor.DecOptions{}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return cborMessageCodec{enc: enc, dec: dec}
+}
+
+func (cborMessageCodec) Name() string { return CodecCBOR }
+func (cborMessageCodec) Binary() bool { return true }
+
+func (c cborMessageCodec) Marshal(msg Message) ([]byte, error) {
+	return c.enc.Marshal(cborMessage{
+		Type:      msg.Type,
+		ID:        msg.ID,
+		Timestamp: msg.Timestamp,
+		Payload:   msg.Payload,
+		Encoding:  msg.Encoding,
+	})
+}
+
+func (c cborMessageCodec) Unmarshal(data []byte, msg *Message) error {
+	var m cborMessage
+	if err := c.dec.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*msg = Message{
+		Type:      m.Type,
+		ID:        m.ID,
+		Timestamp: m.Timestamp,
+		Payload:   m.Payload,
+		Encoding:  m.Encoding,
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// EncodingGzip marks a payload that is a JSON string holding the base64 of
+// the gzipped payload
+const EncodingGzip = "gzip"
+
+// maxDecodedPayload bounds decompressed payloads
+const maxDecodedPayload = 64 << 20
+
+// CompressionStats counts the bytes saved by compressing messages
+type CompressionStats struct {
+	// Deflate is set when the connection negotiated permessage-deflate
+	Deflate bool `json:"deflate"`
+	// Messages counts the payloads sent gzipped
+	Messages   uint64 `json:"messages"`
+	BytesIn    uint64 `json:"bytes_in"`
+	BytesOut   uint64 `json:"bytes_out"`
+	BytesSaved int64  `json:"bytes_saved"`
+}
+
+// EncodePayload gzips the payload of msg if that makes it smaller. It
+// reports whether the payload was replaced.
+func EncodePayload(msg *Message) (bool, error) {
+	if msg.Encoding != "" || len(msg.Payload) == 0 {
+		return false, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(msg.Payload); err != nil {
+		return false, fmt.Errorf("failed to compress payload: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return false, fmt.Errorf("failed to compress payload: %w", err)
+	}
+	encoded, err := json.Marshal(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if err != nil {
+		return false, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	if len(encoded) >= len(msg.Payload) {
+		return false, nil
+	}
+	msg.Payload = encoded
+	msg.Encoding = EncodingGzip
+	return true, nil
+}
+
+// DecodePayload restores the payload of a message encoded by
+// EncodePayload
+func DecodePayload(msg *Message) error {
+	switch msg.Encoding {
+	case "":
+		return nil
+	case EncodingGzip:
+	default:
+		return fmt.Errorf("unsupported payload encoding: %s", msg.Encoding)
+	}
+
+	var encoded string
+	if err := json.Unmarshal(msg.Payload, &encoded); err != nil {
+		return fmt.Errorf("invalid gzip payload: %w", err)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid gzip payload: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return fmt.Errorf("invalid gzip payload: %w", err)
+	}
+	defer zr.Close()
+	payload, err := io.ReadAll(io.LimitReader(zr, maxDecodedPayload+1))
+	if err != nil {
+		return fmt.Errorf("failed to decompress payload: %w", err)
+	}
+	if len(payload) > maxDecodedPayload {
+		return fmt.Errorf("decompressed payload exceeds %d bytes", maxDecodedPayload)
+	}
+	msg.Payload = payload
+	msg.Encoding = ""
+	return nil
+}
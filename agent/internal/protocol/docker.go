@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"path"
+	"time"
+)
+
+// DockerEvent reports a change to a container, sent as an Event of kind
+// docker_event
+type DockerEvent struct {
+	// Action is what happened, such as start, die, oom or destroy
+	Action string `json:"action"`
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Image  string `json:"image,omitempty"`
+	// ExitCode is set for die events
+	ExitCode string `json:"exit_code,omitempty"`
+	// Labels are the labels of the container
+	Labels    map[string]string `json:"labels,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// DockerEventFilter selects the Docker events forwarded to the server.
+// Empty fields match every event.
+type DockerEventFilter struct {
+	Actions []string `json:"actions,omitempty"`
+	// Names are globs matching container names
+	Names []string `json:"names,omitempty"`
+	// Labels must all be set on the container; an empty value matches
+	// any value
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Matches reports whether the filter selects e
+func (f DockerEventFilter) Matches(e DockerEvent) bool {
+	if len(f.Actions) > 0 && !matchAny(f.Actions, e.Action, false) {
+		return false
+	}
+	if len(f.Names) > 0 && !matchAny(f.Names, e.Name, true) {
+		return false
+	}
+	for key, value := range f.Labels {
+		actual, ok := e.Labels[key]
+		if !ok || (value != "" && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(patterns []string, s string, glob bool) bool {
+	for _, pattern := range patterns {
+		if pattern == s {
+			return true
+		}
+		if ok, _ := path.Match(pattern, s); glob && ok {
+			return true
+		}
+	}
+	return false
+}
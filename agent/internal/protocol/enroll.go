@@ -0,0 +1,34 @@
+package protocol
+
+// Enrollment statuses
+const (
+	EnrollmentPending  = "pending"
+	EnrollmentApproved = "approved"
+	EnrollmentRejected = "rejected"
+)
+
+// EnrollmentRequest asks the server to sign the agent's key. Token is the
+// one-time enrollment token issued to the host; CSR is a PEM certificate
+// request for the agent's key.
+type EnrollmentRequest struct {
+	Token    string `json:"token"`
+	CSR      string `json:"csr"`
+	AgentID  string `json:"agent_id,omitempty"`
+	Hostname string `json:"hostname"`
+}
+
+// EnrollmentResponse is the server's answer to an enrollment request and
+// to polls of a pending one. Approved requests carry the signed PEM
+// certificate, whose common name is the agent ID the server assigned,
+// and the PEM certificate of the CA that signed it.
+type EnrollmentResponse struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"`
+	AgentID     string `json:"agent_id,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+	CA          string `json:"ca,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	// RetryAfter is how many seconds to wait before polling a pending
+	// request again
+	RetryAfter int `json:"retry_after,omitempty"`
+}
@@ -0,0 +1,87 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+)
+
+// ErrorCode classifies a failed command, so that the server can branch
+// on failures without parsing error messages
+type ErrorCode string
+
+// Error codes of results and responses
+const (
+	// ErrorValidation rejects a malformed command or bad arguments
+	ErrorValidation ErrorCode = "validation"
+	// ErrorNotFound means the command or what it refers to doesn't exist
+	ErrorNotFound ErrorCode = "not_found"
+	// ErrorPermission means the command isn't allowed, by the agent's
+	// policy or by the host
+	ErrorPermission ErrorCode = "permission"
+	// ErrorTimeout means the command ran out of time
+	ErrorTimeout ErrorCode = "timeout"
+	// ErrorThrottled means the command exceeded the agent's rate limits
+	ErrorThrottled ErrorCode = "throttled"
+	// ErrorInternal is any other failure
+	ErrorInternal ErrorCode = "internal"
+)
+
+// Error is an error with its code
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errorf formats an error with code. %w wraps as with fmt.Errorf.
+func Errorf(code ErrorCode, format string, args ...interface{}) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// CodeOf classifies err. Errors carry their code as an *Error or with an
+// ErrorCode method; well-known errors of the standard library are
+// classified by kind, and the rest are internal. A nil error has no code.
+func CodeOf(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	var carrier interface{ ErrorCode() ErrorCode }
+	if errors.As(err, &carrier) {
+		return carrier.ErrorCode()
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.Code {
+		case ErrCodeInvalidParams:
+			return ErrorValidation
+		case ErrCodeMethodNotFound:
+			return ErrorNotFound
+		case ErrCodeThrottled:
+			return ErrorThrottled
+		}
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ErrorTimeout
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, exec.ErrNotFound):
+		return ErrorNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorPermission
+	}
+	return ErrorInternal
+}
@@ -0,0 +1,13 @@
+package protocol
+
+import "time"
+
+// HardwareChange lists the parts added, removed or replaced since the
+// previous hardware inventory, sent as an Event of kind hardware_change.
+// Parts read "kind:name: description".
+type HardwareChange struct {
+	Added     []string  `json:"added,omitempty"`
+	Removed   []string  `json:"removed,omitempty"`
+	Changed   []string  `json:"changed,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
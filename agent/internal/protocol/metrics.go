@@ -0,0 +1,37 @@
+package protocol
+
+import "time"
+
+// MetricsBatch carries aggregated metrics, sent as TypeMetrics
+type MetricsBatch struct {
+	Summaries []MetricsSummary `json:"summaries"`
+}
+
+// Reasons a metrics summary was sent
+const (
+	// SummaryWindow summarizes a full aggregation window
+	SummaryWindow = "window"
+	// SummaryChange is a single sample sent right away because a value
+	// changed significantly
+	SummaryChange = "change"
+)
+
+// MetricsSummary aggregates the samples of one window. Usages are in
+// percent and network rates in bytes per second.
+type MetricsSummary struct {
+	Reason  string                 `json:"reason"`
+	Window  float64                `json:"window_seconds"`
+	Start   time.Time              `json:"start"`
+	End     time.Time              `json:"end"`
+	Samples int                    `json:"samples"`
+	Series  map[string]SeriesStats `json:"series"`
+}
+
+// SeriesStats summarizes the values of one metric within a window
+type SeriesStats struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Avg  float64 `json:"avg"`
+	P95  float64 `json:"p95"`
+	Last float64 `json:"last"`
+}
@@ -20,10 +20,41 @@ const (
 	TypeLogs     MessageType = "logs"
 	TypeResponse MessageType = "response"
 
+	// TypeMaintenance carries a MaintenanceRequest
+	TypeMaintenance MessageType = "maintenance"
+	// TypeSSHKeys carries an SSHKeyRequest
+	TypeSSHKeys MessageType = "ssh_keys"
+	// TypeConfigTemplate carries a ConfigTemplate
+	TypeConfigTemplate MessageType = "config_template"
+	// TypeConfigState carries a ConfigStateRequest
+	TypeConfigState MessageType = "config_state"
+	// TypeConfigAction carries a ConfigActionRequest
+	TypeConfigAction MessageType = "config_action"
+	// TypeRegistered carries the server's Registered reply
+	TypeRegistered MessageType = "registered"
+
+	// Either direction
+	// TypeRequest carries a Request awaiting a TypeReply with the same ID
+	TypeRequest MessageType = "request"
+	// TypeReply carries the Reply to a TypeRequest
+	TypeReply MessageType = "reply"
+
 	// Agent -> Server messages
 	TypeRegister  MessageType = "register"
 	TypeHeartbeat MessageType = "heartbeat"
 	TypeResult    MessageType = "result"
+	TypeProgress  MessageType = "progress" // carries a TaskProgress
+	TypeDiscovery MessageType = "discovery"
+	TypeTopology  MessageType = "topology"
+
+	// TypeFeatures carries a FeatureUpdate when the agent's capabilities
+	// change after registration
+	TypeFeatures MessageType = "features"
+	// TypeEvent carries an Event raised by an agent component
+	TypeEvent MessageType = "event"
+	// TypeDispatchFailed carries a DispatchFailure, sent with the ID of
+	// the message whose handler kept failing
+	TypeDispatchFailed MessageType = "dispatch_failed"
 )
 
 // Message represents a protocol message between agent and server
@@ -32,6 +63,8 @@ type Message struct {
 	ID        string         `json:"id"`
 	Timestamp time.Time      `json:"timestamp"`
 	Payload   json.RawMessage `json:"payload"`
+	// Encoding is set when Payload is compressed; see EncodePayload
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // MessageHandler is a function that handles a specific type of message
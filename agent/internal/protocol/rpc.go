@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Error codes in replies, following JSON-RPC
+const (
+	ErrCodeInvalidParams  = -32602
+	ErrCodeMethodNotFound = -32601
+	ErrCodeInternal       = -32603
+	// ErrCodeThrottled refuses a request over the agent's rate limits;
+	// the error data is a Throttled
+	ErrCodeThrottled = -32029
+)
+
+// Request calls a method on the other side of the connection
+type Request struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Reply is the outcome of a Request. It is sent with the ID of the
+// request message.
+type Reply struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RPCError       `json:"error,omitempty"`
+}
+
+// RPCError is a failed request
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("request failed (%d): %s", e.Code, e.Message)
+}
+
+// Throttled describes a message the agent refused for exceeding a rate
+// limit. Requests are refused with ErrCodeThrottled, other messages with
+// a failed AgentResponse carrying it as data.
+type Throttled struct {
+	Type   MessageType `json:"type"`
+	Method string      `json:"method,omitempty"`
+	// Limit is the limit exceeded: the message type, request:<method>
+	// or global
+	Limit      string  `json:"limit"`
+	RetryAfter float64 `json:"retry_after_seconds"`
+}
@@ -0,0 +1,29 @@
+package protocol
+
+// SelfMetrics describes the agent process itself. Durations are in
+// seconds.
+type SelfMetrics struct {
+	Goroutines   int     `json:"goroutines"`
+	HeapAlloc    uint64  `json:"heap_alloc"`
+	HeapInuse    uint64  `json:"heap_inuse"`
+	HeapObjects  uint64  `json:"heap_objects"`
+	GCRuns       uint32  `json:"gc_runs"`
+	GCPauseTotal float64 `json:"gc_pause_total"`
+	GCPauseLast  float64 `json:"gc_pause_last"`
+	// GCPauseMax is the longest of the recent pauses
+	GCPauseMax float64 `json:"gc_pause_max"`
+	// Queues are the depths of the agent's internal queues by name
+	Queues map[string]int `json:"queues,omitempty"`
+	// Handlers are the latencies of message and request handlers by name
+	Handlers map[string]HandlerStats `json:"handlers,omitempty"`
+	// Errors counts errors by component
+	Errors map[string]uint64 `json:"errors,omitempty"`
+}
+
+// HandlerStats summarizes the calls of a handler
+type HandlerStats struct {
+	Calls        uint64  `json:"calls"`
+	Errors       uint64  `json:"errors"`
+	TotalSeconds float64 `json:"total_seconds"`
+	MaxSeconds   float64 `json:"max_seconds"`
+}
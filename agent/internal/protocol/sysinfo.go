@@ -0,0 +1,16 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SystemInfoChange is sent as an Event of kind system_info when the OS,
+// CPUs or memory of the host differ from the info the agent registered
+// with, such as after an upgrade
+type SystemInfoChange struct {
+	// Changes read "field: old -> new"
+	Changes   []string        `json:"changes"`
+	Info      json.RawMessage `json:"info"`
+	Timestamp time.Time       `json:"timestamp"`
+}
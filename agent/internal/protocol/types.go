@@ -14,13 +14,52 @@ type AgentInfo struct {
 	OS          string            `json:"os"`
 	Arch        string            `json:"arch"`
 	Labels      map[string]string `json:"labels,omitempty"`
+	// Tenant is the tenant the agent belongs to, if any
+	Tenant      string            `json:"tenant,omitempty"`
 	Features    []string          `json:"features,omitempty"`
+	// Commands are command prefixes handled by plugins
+	Commands    []string          `json:"commands,omitempty"`
+	// Codecs are the binary codecs the agent accepts, in order of
+	// preference
+	Codecs      []string          `json:"codecs,omitempty"`
+	// System is the system.SystemInfo of the host: OS, CPUs and memory
+	System      json.RawMessage   `json:"system,omitempty"`
+}
+
+// FeatureUpdate replaces the features and command prefixes the agent
+// registered with
+type FeatureUpdate struct {
+	AgentID   string    `json:"agent_id"`
+	Features  []string  `json:"features"`
+	Commands  []string  `json:"commands,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 // AgentCommand represents a command to be executed by the agent
 type AgentCommand struct {
 	Command string   `json:"command"`
 	Args    []string `json:"args,omitempty"`
+	// Tenant and Roles are the claims of the user the command runs for,
+	// checked against the agent's authorization policy
+	Tenant string   `json:"tenant,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+	// IdempotencyKey identifies the command across resends; a command
+	// whose key was executed recently is answered with the earlier
+	// result. The message ID is used when empty.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// Claims are the tenant and roles of the user a request runs for. They
+// are checked against the agent's authorization policy like those of
+// commands.
+type Claims struct {
+	Tenant string   `json:"tenant,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+// RequestClaims returns the claims of a request embedding Claims
+func (c Claims) RequestClaims() Claims {
+	return c
 }
 
 // AgentResponse represents a response from the agent
@@ -28,6 +67,21 @@ type AgentResponse struct {
 	Success bool            `json:"success"`
 	Data    json.RawMessage `json:"data,omitempty"`
 	Error   string         `json:"error,omitempty"`
+	// ErrorCode classifies Error
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+// DispatchFailure tells the server that the agent gave up handling a
+// message after its handler failed every attempt. The message is kept as
+// a dead letter until retried or purged.
+type DispatchFailure struct {
+	MessageID    string      `json:"message_id"`
+	MessageType  MessageType `json:"message_type"`
+	Error        string      `json:"error"`
+	ErrorCode    ErrorCode   `json:"error_code,omitempty"`
+	Attempts     int         `json:"attempts"`
+	FirstFailure time.Time   `json:"first_failure"`
+	LastFailure  time.Time   `json:"last_failure"`
 }
 
 // ResultPayload represents the result of a command execution
@@ -37,6 +91,9 @@ type ResultPayload struct {
 	Stdout    string `json:"stdout"`
 	Stderr    string `json:"stderr"`
 	Error     string `json:"error,omitempty"`
+	// ErrorCode classifies Error when the command could not run; a
+	// command that ran and failed only has its exit code
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
 }
 
 // AgentMetrics represents system metrics collected by the agent
@@ -48,6 +105,7 @@ type AgentMetrics struct {
 		RxBytes int64 `json:"rx_bytes"`
 		TxBytes int64 `json:"tx_bytes"`
 	} `json:"network"`
+	Compression *CompressionStats `json:"compression,omitempty"`
 }
 
 // AgentLog represents a log entry from the agent
@@ -77,6 +135,10 @@ type AgentHeartbeat struct {
 	LoadAvg   [3]float64  `json:"load_avg"`
 	Processes int         `json:"processes"`
 	Metrics   AgentMetrics `json:"metrics"`
+	// Stale names the sources whose data is out of date, when Status is
+	// "stale-metrics"
+	Stale     []string     `json:"stale,omitempty"`
+	Self      *SelfMetrics `json:"self,omitempty"`
 }
 
 // CommandResult represents the result of executing a command
@@ -85,3 +147,353 @@ type CommandResult struct {
 	Stdout   string `json:"stdout"`
 	Stderr   string `json:"stderr"`
 }
+
+// UpdateProgress represents streamed output from a running package operation
+type UpdateProgress struct {
+	UpdateID  string    `json:"update_id"`
+	Package   string    `json:"package"`
+	Stream    string    `json:"stream"` // stdout or stderr
+	Line      string    `json:"line,omitempty"`
+	Percent   float64   `json:"percent"` // -1 when unknown
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ServiceEvent represents a change in the set of discovered services
+type ServiceEvent struct {
+	Action    string                 `json:"action"` // added, changed, stale or removed
+	Key       string                 `json:"key"`
+	Name      string                 `json:"name"`
+	Type      string                 `json:"type,omitempty"`
+	Address   string                 `json:"address,omitempty"`
+	Port      int                    `json:"port,omitempty"`
+	Protocol  string                 `json:"protocol,omitempty"`
+	Version   string                 `json:"version,omitempty"`
+	Status    string                 `json:"status"`
+	Source    string                 `json:"source"`
+	LastSeen  time.Time              `json:"last_seen"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// TopologyReport represents the agents an agent can reach and their latency
+type TopologyReport struct {
+	AgentID   string     `json:"agent_id"`
+	Hostname  string     `json:"hostname"`
+	Peers     []PeerLink `json:"peers"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// PeerLink represents the measured link to a peer agent
+type PeerLink struct {
+	PeerID   string    `json:"peer_id"`
+	Hostname string    `json:"hostname,omitempty"`
+	Address  string    `json:"address"`
+	RTTMs    float64   `json:"rtt_ms"`
+	Loss     float64   `json:"loss"` // fraction of probes unanswered in the last round
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// LogsPayload represents a batch of log entries shipped by the agent
+type LogsPayload struct {
+	Entries []AgentLog `json:"entries"`
+	Dropped int64      `json:"dropped,omitempty"`
+}
+
+// MaintenanceRequest enables or disables maintenance mode for a component
+// or, with an empty component, the whole agent
+type MaintenanceRequest struct {
+	Claims
+	Action    string `json:"action"` // enable or disable
+	Component string `json:"component,omitempty"`
+	Duration  int64  `json:"duration_seconds,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// MaintenanceWindow represents an active maintenance period
+type MaintenanceWindow struct {
+	Component string    `json:"component"` // "*" for the whole agent
+	Reason    string    `json:"reason,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MaintenanceEvent reports a maintenance mode change
+type MaintenanceEvent struct {
+	Action    string            `json:"action"` // enabled, disabled or expired
+	Window    MaintenanceWindow `json:"window"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// SSHKey describes an SSH key found on the host. Private key material is
+// never included, only what can be derived from the public half.
+type SSHKey struct {
+	User        string    `json:"user,omitempty"`
+	Path        string    `json:"path"`
+	Kind        string    `json:"kind"` // authorized, public, private or host
+	Type        string    `json:"type"`
+	Bits        int       `json:"bits,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	Comment     string    `json:"comment,omitempty"`
+	Options     string    `json:"options,omitempty"`
+	Encrypted   bool      `json:"encrypted,omitempty"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// SSHKeyInventory lists the SSH keys on the host
+type SSHKeyInventory struct {
+	Keys        []SSHKey  `json:"keys"`
+	Errors      []string  `json:"errors,omitempty"`
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+// SSHKeyRequest asks the agent to report or change SSH keys
+type SSHKeyRequest struct {
+	Claims
+	// Action is inventory, rotate, approve, reject, rotations, authorize,
+	// revoke, policy, drift, issue_cert, install_cert, trust_ca or
+	// renew_host_certs
+	Action      string `json:"action"`
+	User        string `json:"user,omitempty"`
+	Path        string `json:"path,omitempty"`
+	RotationID  string `json:"rotation_id,omitempty"`
+	PublicKey   string `json:"public_key,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Policies replace the desired authorized keys for the policy action
+	Policies []SSHKeyPolicy `json:"policies,omitempty"`
+	// Certificate is an OpenSSH certificate to install
+	Certificate string `json:"certificate,omitempty"`
+	// Principals and ValiditySeconds shape certificates issued by the
+	// agent's CA
+	Principals      []string `json:"principals,omitempty"`
+	ValiditySeconds int64    `json:"validity_seconds,omitempty"`
+	// CAKeys are the CA public keys sshd trusts for user certificates
+	CAKeys []string `json:"ca_keys,omitempty"`
+}
+
+// SSHCertificate describes an OpenSSH certificate
+type SSHCertificate struct {
+	Path        string    `json:"path,omitempty"`
+	Type        string    `json:"type"` // user or host
+	KeyID       string    `json:"key_id"`
+	Serial      uint64    `json:"serial"`
+	Principals  []string  `json:"principals,omitempty"`
+	ValidAfter  time.Time `json:"valid_after"`
+	ValidBefore time.Time `json:"valid_before"`
+	// Certificate is the certificate line, set when the agent issued it
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// SSHKeyPolicy is the desired authorized_keys content of a user
+type SSHKeyPolicy struct {
+	User string `json:"user"`
+	// Keys are authorized_keys lines, options included
+	Keys []string `json:"keys"`
+	// Enforce rewrites the file to match; otherwise drift is only reported
+	Enforce bool `json:"enforce"`
+}
+
+// SSHKeyDrift is the difference between a user's authorized_keys and its
+// policy. Keys are listed by fingerprint.
+type SSHKeyDrift struct {
+	User       string    `json:"user"`
+	Path       string    `json:"path"`
+	Missing    []string  `json:"missing,omitempty"`
+	Unexpected []string  `json:"unexpected,omitempty"`
+	Changed    []string  `json:"changed,omitempty"`   // options differ
+	Protected  []string  `json:"protected,omitempty"` // break-glass keys kept
+	Reconciled bool      `json:"reconciled"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// SSHKeyRotation is a key pair replacement. The agent stages the new key
+// and only puts it in place once the server approves.
+type SSHKeyRotation struct {
+	ID             string     `json:"id"`
+	User           string     `json:"user"`
+	Path           string     `json:"path"`
+	OldFingerprint string     `json:"old_fingerprint"`
+	NewFingerprint string     `json:"new_fingerprint"`
+	PublicKey      string     `json:"public_key"`
+	Status         string     `json:"status"` // pending, applied, rejected, expired or failed
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+// TaskProgress is the state of a long-running operation, such as a
+// backup, an update, a transfer or a scan. It is sent as a TypeProgress
+// message whenever the task starts, progresses or finishes.
+
+type TaskProgress struct {
+	ID      string            `json:"id"`
+	Kind    string            `json:"kind"`
+	Name    string            `json:"name"`
+	State   string            `json:"state"`   // running, succeeded, failed or canceled
+	Percent float64           `json:"percent"` // -1 when unknown
+	Message string            `json:"message,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	Started time.Time         `json:"started"`
+	Updated time.Time         `json:"updated"`
+	Ended   *time.Time        `json:"ended,omitempty"`
+}
+
+// Event is a notification raised by an agent component, such as a
+// maintenance change or a tampered file
+type Event struct {
+	AgentID   string          `json:"agent_id"`
+	Kind      string          `json:"kind"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// FileState is the integrity-relevant state of a file
+type FileState struct {
+	Size    int64     `json:"size"`
+	Mode    uint32    `json:"mode"`
+	UID     int       `json:"uid"`
+	GID     int       `json:"gid"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256,omitempty"`
+	// Target is the destination of a symlink
+	Target string `json:"target,omitempty"`
+}
+
+// FIMEvent reports a file that no longer matches the integrity baseline
+type FIMEvent struct {
+	Path   string `json:"path"`
+	Change string `json:"change"` // added, removed or modified
+	// Fields lists what changed: content, mode, owner or target
+	Fields    []string   `json:"fields,omitempty"`
+	Before    *FileState `json:"before,omitempty"`
+	After     *FileState `json:"after,omitempty"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// ConfigTemplate asks the agent to render a Go template with its host
+// facts and write the result to Path
+type ConfigTemplate struct {
+	Claims
+	Path     string            `json:"path"`
+	Template string            `json:"template"`
+	Vars     map[string]string `json:"vars,omitempty"`
+	// Mode is the permission to write the file with; 0 keeps an existing
+	// file's and gives a new one 0644
+	Mode uint32 `json:"mode,omitempty"`
+	// Reason is recorded in the config history
+	Reason string `json:"reason,omitempty"`
+	User   string `json:"user,omitempty"`
+	// DryRun returns the rendered content without writing it
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// RenderedConfig reports a rendered config template
+type RenderedConfig struct {
+	Path     string `json:"path"`
+	Checksum string `json:"checksum"` // sha256 of the rendered content
+	Size     int    `json:"size"`
+	// Changed is set when the file on disk differed from the rendering
+	Changed bool `json:"changed"`
+	// Content is the rendering, returned for dry runs
+	Content    string    `json:"content,omitempty"`
+	RenderedAt time.Time `json:"rendered_at"`
+}
+
+// DesiredConfig is the state the server declares for a config file
+type DesiredConfig struct {
+	Path string `json:"path"`
+	// Content is the desired file content; nil leaves the content alone
+	Content *string `json:"content,omitempty"`
+	// Mode is the desired permission bits; 0 leaves them alone
+	Mode  uint32 `json:"mode,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	// Policy is enforce, which reverts drift, or monitor, which only
+	// reports it
+	Policy string `json:"policy"`
+}
+
+// ConfigStateRequest asks the agent to change or check desired config state
+type ConfigStateRequest struct {
+	Claims
+	// Action is set, which replaces the desired state of all files, drift
+	// or list
+	Action  string          `json:"action"`
+	Configs []DesiredConfig `json:"configs,omitempty"`
+}
+
+// ConfigDrift is the difference between a config file and its desired
+// state
+type ConfigDrift struct {
+	Path    string `json:"path"`
+	Policy  string `json:"policy"`
+	Missing bool   `json:"missing,omitempty"`
+	// Fields lists what drifted: content, mode, owner or group
+	Fields   []string `json:"fields,omitempty"`
+	Expected string   `json:"expected_checksum,omitempty"`
+	Actual   string   `json:"actual_checksum,omitempty"`
+	// Diff is the unified diff from the desired content
+	Diff       string    `json:"diff,omitempty"`
+	Reconciled bool      `json:"reconciled"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// ConfigAction runs after a managed config changes. Commands are argument
+// lists, e.g. ["systemctl", "reload", "nginx"].
+type ConfigAction struct {
+	// Validate checks the changed config before it is applied, e.g.
+	// ["nginx", "-t"]
+	Validate []string `json:"validate,omitempty"`
+	// Apply reloads or restarts the service using the config
+	Apply []string `json:"apply"`
+	// Check verifies the service is healthy after Apply, e.g.
+	// ["systemctl", "is-active", "nginx"]
+	Check []string `json:"check,omitempty"`
+	// SettleSeconds is how long to wait before Check
+	SettleSeconds  int64 `json:"settle_seconds,omitempty"`
+	TimeoutSeconds int64 `json:"timeout_seconds,omitempty"`
+}
+
+// ConfigActionRequest asks the agent to change or list config actions
+type ConfigActionRequest struct {
+	Claims
+	// Action is set, remove, list or results
+	Action string        `json:"action"`
+	Path   string        `json:"path,omitempty"`
+	Config *ConfigAction `json:"config,omitempty"`
+}
+
+// ConfigActionResult reports a config action run after a change. A config
+// that fails validation, Apply or Check is rolled back to the previous
+// version and Apply is run again.
+type ConfigActionResult struct {
+	Path   string `json:"path"`
+	Commit string `json:"commit,omitempty"`
+	// Stage is where the run stopped: validate, apply, check or done
+	Stage      string    `json:"stage"`
+	Success    bool      `json:"success"`
+	Output     string    `json:"output,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	RolledBack bool      `json:"rolled_back"`
+	RollbackTo string    `json:"rollback_to,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	Duration   float64   `json:"duration_seconds"`
+}
+
+// ConnectionEvent reports a change in the agent's server connection
+type ConnectionEvent struct {
+	// State is connected, disconnected, failover or failback
+	State    string `json:"state"`
+	URL      string `json:"url"`
+	Previous string `json:"previous,omitempty"`
+	// Error explains why more preferred servers were skipped or the
+	// connection was lost
+	Error string `json:"error,omitempty"`
+	// Downtime is how long the agent was disconnected before connecting
+	Downtime  float64   `json:"downtime_seconds,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -0,0 +1,229 @@
+package resolver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/store"
+)
+
+// SeverityInfo is below SeverityWarning and SeverityCritical
+const SeverityInfo = "info"
+
+// EscalationPolicy controls when problems are handed to a human and how
+// long resolved problems are kept
+type EscalationPolicy struct {
+	// AfterFailures escalates a problem once this many resolution attempts
+	// in a row have failed; 0 disables escalation
+	AfterFailures int
+	// ResolvedRetention is how long resolved problems are kept, so their
+	// recurrence is counted against the same problem
+	ResolvedRetention time.Duration
+}
+
+// DefaultEscalationPolicy escalates after three failed attempts and keeps
+// resolved problems for a day
+var DefaultEscalationPolicy = EscalationPolicy{
+	AfterFailures:     3,
+	ResolvedRetention: 24 * time.Hour,
+}
+
+var severityWeights = map[string]float64{
+	SeverityInfo:     1,
+	SeverityWarning:  2,
+	SeverityCritical: 4,
+}
+
+// Fingerprint identifies a problem across detections. Descriptions and
+// details carry current values, so only what is wrong and where counts.
+func Fingerprint(problemType, component string) string {
+	sum := sha256.Sum256([]byte(problemType + "\x00" + component))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Score rates how urgent a problem is from its severity, how often it has
+// recurred, how long it has been open and how many fixes have failed
+func Score(problem *Problem, now time.Time) float64 {
+	weight, ok := severityWeights[problem.Severity]
+	if !ok {
+		weight = severityWeights[SeverityWarning]
+	}
+	score := weight
+	score += math.Log2(float64(max(problem.Occurrences, 1)))
+	score += math.Min(now.Sub(problem.DetectedAt).Hours(), 24) / 8
+	score += float64(problem.FailedAttempts)
+	if problem.Escalated {
+		score *= 2
+	}
+	return math.Round(score*100) / 100
+}
+
+// SetEscalationPolicy replaces the escalation policy
+func (r *Resolver) SetEscalationPolicy(policy EscalationPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.escalation = policy
+}
+
+// trackProblems merges a detection round into the known problems. New
+// problems are added, recurring ones update the existing record, open
+// problems that are no longer detected are resolved and old resolved
+// problems are dropped. It returns the open problems.
+func (r *Resolver) trackProblems(detected []Problem, now time.Time) []Problem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]bool, len(detected))
+	for _, d := range detected {
+		seen[d.ID] = true
+
+		p, ok := r.problems[d.ID]
+		if !ok {
+			stored := d
+			stored.Occurrences = 1
+			stored.LastSeen = now
+			r.problems[d.ID] = &stored
+			continue
+		}
+
+		if p.Status == StatusResolved {
+			// Recurrence: reopen the same problem instead of a duplicate
+			p.Occurrences++
+			p.DetectedAt = d.DetectedAt
+			p.ResolvedAt = nil
+			p.Resolution = ""
+			p.FailedAttempts = 0
+			p.Escalated = false
+			p.EscalatedAt = nil
+		}
+		p.Status = StatusOpen
+		p.Source = d.Source
+		p.Description = d.Description
+		p.Severity = d.Severity
+		p.Details = d.Details
+		p.LastSeen = now
+	}
+
+	for id, p := range r.problems {
+		if !seen[id] && p.Status != StatusResolved {
+			p.Status = StatusResolved
+			p.Resolution = "no longer detected"
+			resolvedAt := now
+			p.ResolvedAt = &resolvedAt
+		}
+		if p.Status == StatusResolved && p.ResolvedAt != nil &&
+			now.Sub(*p.ResolvedAt) > r.escalation.ResolvedRetention {
+			delete(r.problems, id)
+		}
+	}
+
+	var open []Problem
+	for _, p := range r.problems {
+		p.Score = Score(p, now)
+		if p.Status != StatusResolved {
+			open = append(open, *p)
+		}
+	}
+	r.persistLocked()
+	sortProblems(open)
+	return open
+}
+
+// recordFailure counts a failed resolution attempt and reports whether the
+// problem has just reached the escalation threshold
+func (r *Resolver) recordFailure(id, reason string) (Problem, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.problems[id]
+	if !ok {
+		return Problem{}, false
+	}
+	p.Status = StatusFailed
+	p.Resolution = reason
+	p.FailedAttempts++
+
+	escalate := r.escalation.AfterFailures > 0 && !p.Escalated &&
+		p.FailedAttempts >= r.escalation.AfterFailures
+	if escalate {
+		now := time.Now()
+		p.Escalated = true
+		p.EscalatedAt = &now
+	}
+	p.Score = Score(p, time.Now())
+	r.persistLocked()
+	return *p, escalate
+}
+
+// SetStore keeps problem records in s and restores them, so that
+// occurrences, failed attempts and escalations survive a restart
+func (r *Resolver) SetStore(s *store.Store) error {
+	records := store.NewBucket[Problem](s, store.BucketProblems)
+	saved, err := records.All()
+	if err != nil {
+		return fmt.Errorf("failed to load problems: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = records
+	for id, p := range saved {
+		if _, ok := r.problems[id]; !ok {
+			p := p
+			r.problems[id] = &p
+		}
+	}
+	r.logger.Info("Problem records restored", zap.Int("problems", len(saved)))
+	return nil
+}
+
+// persistLocked writes the problem records, if they are kept. The caller
+// holds mu.
+func (r *Resolver) persistLocked() {
+	if r.records == nil {
+		return
+	}
+	records := make(map[string]Problem, len(r.problems))
+	for id, p := range r.problems {
+		records[id] = *p
+	}
+	if err := r.records.Replace(records); err != nil {
+		r.logger.Warn("Failed to save problem records", zap.Error(err))
+	}
+}
+
+// escalate notifies about a problem auto-resolution could not fix
+func (r *Resolver) escalate(ctx context.Context, problem Problem) {
+	r.logger.Warn("Escalating problem",
+		zap.String("id", problem.ID),
+		zap.String("type", problem.Type),
+		zap.String("component", problem.Component),
+		zap.Int("failed_attempts", problem.FailedAttempts),
+		zap.String("last_error", problem.Resolution))
+
+	if r.deps.Notifier == nil || r.inMaintenance(problem) {
+		return
+	}
+	message := fmt.Sprintf("auto-resolution failed %d times: %s", problem.FailedAttempts, problem.Description)
+	if err := r.deps.Notifier.Notify(ctx, problem, message); err != nil {
+		r.logger.Error("Failed to send escalation", zap.String("id", problem.ID), zap.Error(err))
+	}
+}
+
+// sortProblems orders problems by descending score, then ID
+func sortProblems(problems []Problem) {
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Score != problems[j].Score {
+			return problems[i].Score > problems[j].Score
+		}
+		return problems[i].ID < problems[j].ID
+	})
+}
@@ -2,25 +2,44 @@ package resolver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/store"
 )
 
 // Problem represents a detected problem
 type Problem struct {
 	ID          string
+	Fingerprint string
 	Type        string
-	Source      string
+	Source      string // rule that detected the problem
+	Component   string
 	Description string
 	Severity    string
+	Score       float64
 	Status      string
-	DetectedAt  time.Time
+	Details     map[string]interface{}
+	DetectedAt  time.Time // start of the current occurrence
+	LastSeen    time.Time
 	ResolvedAt  *time.Time
 	Resolution  string
+
+	// Occurrences counts how often the problem appeared after having been
+	// resolved, plus the first time
+	Occurrences int
+	// FailedAttempts counts failed resolution attempts since the problem
+	// last opened
+	FailedAttempts int
+	Escalated      bool
+	EscalatedAt    *time.Time
 }
 
 // Pattern represents a problem pattern
@@ -30,25 +49,215 @@ type Pattern struct {
 	Description string
 }
 
+// Resolution actions. A pattern's action overrides the default action for
+// the problem type.
+const (
+	ActionOptimize         = "optimize"
+	ActionRestartService   = "restart_service"
+	ActionRepairConnection = "repair_connection"
+	ActionIgnore           = "ignore"
+)
+
+// MetricsProvider reports current resource usage as percentages
+type MetricsProvider interface {
+	GetCPUUsage(ctx context.Context) (float64, error)
+	GetMemoryUsage(ctx context.Context) (float64, error)
+	GetDiskUsage(ctx context.Context) (float64, error)
+}
+
+// ServiceHealth represents the result of a service health check
+type ServiceHealth struct {
+	Healthy bool
+	Status  string
+}
+
+// HealthChecker checks the health of discovered services
+type HealthChecker interface {
+	CheckService(ctx context.Context, id string) (*ServiceHealth, error)
+}
+
+// ServiceRef identifies a discovered service
+type ServiceRef struct {
+	ID   string
+	Name string
+}
+
+// Endpoint represents a network endpoint the host depends on
+type Endpoint struct {
+	Name    string
+	Address string
+}
+
+// Discoverer lists the services and endpoints to check
+type Discoverer interface {
+	GetServices(ctx context.Context) ([]ServiceRef, error)
+	GetEndpoints(ctx context.Context) ([]Endpoint, error)
+}
+
+// NetworkChecker checks and repairs connectivity to endpoints
+type NetworkChecker interface {
+	CheckConnectivity(ctx context.Context, endpoint Endpoint) error
+	RepairConnection(ctx context.Context, name string) error
+}
+
+// Optimizer frees exhausted resources
+type Optimizer interface {
+	OptimizeCPU(ctx context.Context) error
+	OptimizeMemory(ctx context.Context) error
+	OptimizeDisk(ctx context.Context) error
+}
+
+// ServiceManager restarts failed services
+type ServiceManager interface {
+	RestartService(ctx context.Context, name string) error
+}
+
+// MaintenanceChecker reports whether a component is in planned maintenance
+type MaintenanceChecker interface {
+	Active(component string) bool
+}
+
+// Dependencies are the subsystems the resolver detects and resolves problems
+// with. Nil dependencies disable the checks and resolutions that need them.
+type Dependencies struct {
+	Metrics     MetricsProvider
+	Health      HealthChecker
+	Discovery   Discoverer
+	Network     NetworkChecker
+	Optimizer   Optimizer
+	Services    ServiceManager
+	Notifier    Notifier
+	Maintenance MaintenanceChecker
+}
+
+// Config sets how often problems are detected and whether they are
+// resolved without waiting for the server
+type Config struct {
+	Interval    time.Duration
+	AutoResolve bool
+}
+
+// DefaultConfig detects problems every minute and leaves resolving them to
+// the server
+var DefaultConfig = Config{Interval: time.Minute}
+
 // Resolver handles problem detection and resolution
 type Resolver struct {
 	logger   *zap.Logger
 	mu       sync.RWMutex
+	config   Config
+	cancel   context.CancelFunc
+	done     chan struct{}
+	deps     Dependencies
+	rules    []Rule
 	patterns []Pattern
 	problems map[string]*Problem
+	records  *store.Bucket[Problem]
+
+	// Escalation
+	escalation EscalationPolicy
+
+	// Runbooks
+	runbooks      []*Runbook
+	runbookStates map[string]*runbookState
 }
 
-// NewResolver creates a new resolver
-func NewResolver(logger *zap.Logger) *Resolver {
+// NewResolver creates a new resolver using the default rules
+func NewResolver(logger *zap.Logger, deps Dependencies) *Resolver {
 	return &Resolver{
 		logger:   logger,
+		config:   DefaultConfig,
+		deps:     deps,
+		rules:    DefaultRules(),
 		patterns: make([]Pattern, 0),
 		problems: make(map[string]*Problem),
+
+		escalation: DefaultEscalationPolicy,
+
+		runbookStates: make(map[string]*runbookState),
 	}
 }
 
-// AddPattern adds a problem pattern
-func (r *Resolver) AddPattern(pattern, action string) {
+// Configure sets the detection interval and whether problems are resolved
+// automatically. A zero interval keeps the default.
+func (r *Resolver) Configure(config Config) {
+	if config.Interval <= 0 {
+		config.Interval = DefaultConfig.Interval
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.config = config
+}
+
+// Start detects problems every interval until Shutdown, resolving them
+// when auto-resolution is on
+func (r *Resolver) Start(ctx context.Context) error {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+	crash.Go("resolver", func() {
+		defer close(r.done)
+		for {
+			r.mu.RLock()
+			config := r.config
+			r.mu.RUnlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(config.Interval):
+			}
+
+			var err error
+			if config.AutoResolve {
+				err = r.AutoResolve(ctx)
+			} else {
+				_, err = r.DetectProblems(ctx)
+			}
+			if err != nil && ctx.Err() == nil {
+				r.logger.Warn("Problem detection failed", zap.Error(err))
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown stops detecting problems
+func (r *Resolver) Shutdown(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AddRule adds a problem detection rule
+func (r *Resolver) AddRule(rule Rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules = append(r.rules, rule)
+}
+
+// SetRules replaces the problem detection rules
+func (r *Resolver) SetRules(rules []Rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules = rules
+}
+
+// AddPattern adds a problem pattern. Problems whose description matches the
+// pattern are resolved with action instead of their type's default.
+func (r *Resolver) AddPattern(pattern, action string) error {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -57,51 +266,77 @@ func (r *Resolver) AddPattern(pattern, action string) {
 		Action:      action,
 		Description: fmt.Sprintf("Match pattern: %s", pattern),
 	})
+	return nil
 }
 
-// DetectProblems analyzes system state and returns detected problems
+// DetectProblems collects the system state, evaluates the rules against it
+// and returns the open problems, most urgent first
 func (r *Resolver) DetectProblems(ctx context.Context) ([]Problem, error) {
-	var problems []Problem
-
-	// Check system resources
-	if err := r.checkSystemResources(ctx, &problems); err != nil {
-		return nil, fmt.Errorf("failed to check system resources: %w", err)
-	}
-
-	// Check service health
-	if err := r.checkServiceHealth(ctx, &problems); err != nil {
-		return nil, fmt.Errorf("failed to check service health: %w", err)
+	state, err := r.collectState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect system state: %w", err)
 	}
 
-	// Check network connectivity
-	if err := r.checkNetworkConnectivity(ctx, &problems); err != nil {
-		return nil, fmt.Errorf("failed to check network connectivity: %w", err)
-	}
+	r.mu.RLock()
+	rules := make([]Rule, len(r.rules))
+	copy(rules, r.rules)
+	r.mu.RUnlock()
 
-	return problems, nil
+	return r.trackProblems(EvaluateRules(state, rules), state.Timestamp), nil
 }
 
-// ResolveProblem attempts to resolve a specific problem
+// ResolveProblem attempts to resolve a specific problem, using the first
+// matching runbook if there is one
 func (r *Resolver) ResolveProblem(ctx context.Context, problem Problem) error {
+	if rb := r.matchRunbook(problem); rb != nil {
+		r.logger.Info("Running runbook",
+			zap.String("runbook", rb.Name),
+			zap.String("problem", problem.ID))
+		if _, err := r.runRunbook(ctx, rb, problem); err != nil {
+			r.failProblem(ctx, problem.ID, err)
+			return err
+		}
+		r.updateProblem(problem.ID, StatusResolved, "runbook "+rb.Name)
+		return nil
+	}
+
+	action := defaultAction(problem.Type)
+	if pattern, ok := r.matchPattern(problem.Description); ok {
+		action = pattern.Action
+	}
+
 	r.logger.Info("Attempting to resolve problem",
 		zap.String("type", problem.Type),
 		zap.String("component", problem.Component),
+		zap.String("action", action),
 		zap.Any("details", problem.Details),
 	)
 
-	switch problem.Type {
-	case "resource_exhaustion":
-		return r.resolveResourceExhaustion(ctx, problem)
-	case "service_failure":
-		return r.resolveServiceFailure(ctx, problem)
-	case "network_issue":
-		return r.resolveNetworkIssue(ctx, problem)
+	var err error
+	switch action {
+	case ActionOptimize:
+		err = r.resolveResourceExhaustion(ctx, problem)
+	case ActionRestartService:
+		err = r.resolveServiceFailure(ctx, problem)
+	case ActionRepairConnection:
+		err = r.resolveNetworkIssue(ctx, problem)
+	case ActionIgnore:
+		return nil
 	default:
-		return fmt.Errorf("unsupported problem type: %s", problem.Type)
+		err = fmt.Errorf("unsupported action %q for problem type %s", action, problem.Type)
+	}
+
+	if err != nil {
+		r.failProblem(ctx, problem.ID, err)
+		return err
 	}
+	r.updateProblem(problem.ID, StatusResolved, action)
+	return nil
 }
 
-// AutoResolve attempts to automatically resolve detected problems
+// AutoResolve attempts to automatically resolve detected problems.
+// Escalated problems are left for a human and problems in components under
+// maintenance are left alone.
 func (r *Resolver) AutoResolve(ctx context.Context) error {
 	problems, err := r.DetectProblems(ctx)
 	if err != nil {
@@ -109,6 +344,9 @@ func (r *Resolver) AutoResolve(ctx context.Context) error {
 	}
 
 	for _, problem := range problems {
+		if problem.Escalated || r.inMaintenance(problem) {
+			continue
+		}
 		if err := r.ResolveProblem(ctx, problem); err != nil {
 			r.logger.Error("Failed to resolve problem",
 				zap.String("type", problem.Type),
@@ -128,134 +366,165 @@ func (r *Resolver) AutoResolve(ctx context.Context) error {
 
 // Private helper methods
 
-func (r *Resolver) checkSystemResources(ctx context.Context, problems *[]Problem) error {
-	// Check CPU usage
-	cpuUsage, err := r.metrics.GetCPUUsage(ctx)
-	if err != nil {
-		return err
+func defaultAction(problemType string) string {
+	switch problemType {
+	case TypeResourceExhaustion:
+		return ActionOptimize
+	case TypeServiceFailure:
+		return ActionRestartService
+	case TypeNetworkIssue:
+		return ActionRepairConnection
+	default:
+		return ""
 	}
-	if cpuUsage > 90 {
-		*problems = append(*problems, Problem{
-			Type:      "resource_exhaustion",
-			Component: "cpu",
-			Details:   map[string]interface{}{"usage": cpuUsage},
-		})
+}
+
+// collectState gathers a state snapshot from the dependencies. Failing
+// sources leave their part of the state empty rather than failing the
+// whole detection.
+func (r *Resolver) collectState(ctx context.Context) (*State, error) {
+	state := &State{
+		Timestamp: time.Now(),
+		Metrics:   make(map[string]float64),
 	}
 
-	// Check memory usage
-	memUsage, err := r.metrics.GetMemoryUsage(ctx)
-	if err != nil {
-		return err
+	if err := r.checkSystemResources(ctx, state); err != nil {
+		r.logger.Warn("Failed to check system resources", zap.Error(err))
+	}
+	if err := r.checkServiceHealth(ctx, state); err != nil {
+		r.logger.Warn("Failed to check service health", zap.Error(err))
 	}
-	if memUsage > 90 {
-		*problems = append(*problems, Problem{
-			Type:      "resource_exhaustion",
-			Component: "memory",
-			Details:   map[string]interface{}{"usage": memUsage},
-		})
+	if err := r.checkNetworkConnectivity(ctx, state); err != nil {
+		r.logger.Warn("Failed to check network connectivity", zap.Error(err))
 	}
 
-	// Check disk usage
-	diskUsage, err := r.metrics.GetDiskUsage(ctx)
-	if err != nil {
-		return err
+	return state, ctx.Err()
+}
+
+func (r *Resolver) checkSystemResources(ctx context.Context, state *State) error {
+	if r.deps.Metrics == nil {
+		return nil
 	}
-	if diskUsage > 90 {
-		*problems = append(*problems, Problem{
-			Type:      "resource_exhaustion",
-			Component: "disk",
-			Details:   map[string]interface{}{"usage": diskUsage},
-		})
+
+	sources := []struct {
+		metric string
+		get    func(context.Context) (float64, error)
+	}{
+		{MetricCPU, r.deps.Metrics.GetCPUUsage},
+		{MetricMemory, r.deps.Metrics.GetMemoryUsage},
+		{MetricDisk, r.deps.Metrics.GetDiskUsage},
 	}
 
-	return nil
+	var errs []error
+	for _, source := range sources {
+		usage, err := source.get(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source.metric, err))
+			continue
+		}
+		state.Metrics[source.metric] = usage
+	}
+	return errors.Join(errs...)
 }
 
-func (r *Resolver) checkServiceHealth(ctx context.Context, problems *[]Problem) error {
-	services, err := r.discovery.GetServices(ctx)
+func (r *Resolver) checkServiceHealth(ctx context.Context, state *State) error {
+	if r.deps.Discovery == nil || r.deps.Health == nil {
+		return nil
+	}
+
+	services, err := r.deps.Discovery.GetServices(ctx)
 	if err != nil {
 		return err
 	}
 
 	for _, service := range services {
-		health, err := r.health.CheckService(ctx, service.ID)
+		status := ServiceStatus{ID: service.ID, Name: service.Name}
+		health, err := r.deps.Health.CheckService(ctx, service.ID)
 		if err != nil {
-			*problems = append(*problems, Problem{
-				Type:      "service_failure",
-				Component: service.Name,
-				Details:   map[string]interface{}{"error": err.Error()},
-			})
-			continue
-		}
-		if !health.Healthy {
-			*problems = append(*problems, Problem{
-				Type:      "service_failure",
-				Component: service.Name,
-				Details:   map[string]interface{}{"status": health.Status},
-			})
+			status.Error = err.Error()
+		} else {
+			status.Healthy = health.Healthy
+			status.Status = health.Status
 		}
+		state.Services = append(state.Services, status)
 	}
 
 	return nil
 }
 
-func (r *Resolver) checkNetworkConnectivity(ctx context.Context, problems *[]Problem) error {
-	endpoints, err := r.discovery.GetEndpoints(ctx)
+func (r *Resolver) checkNetworkConnectivity(ctx context.Context, state *State) error {
+	if r.deps.Discovery == nil || r.deps.Network == nil {
+		return nil
+	}
+
+	endpoints, err := r.deps.Discovery.GetEndpoints(ctx)
 	if err != nil {
 		return err
 	}
 
 	for _, endpoint := range endpoints {
-		if err := r.network.CheckConnectivity(ctx, endpoint); err != nil {
-			*problems = append(*problems, Problem{
-				Type:      "network_issue",
-				Component: endpoint.Name,
-				Details:   map[string]interface{}{"error": err.Error()},
-			})
+		status := EndpointStatus{Name: endpoint.Name, Address: endpoint.Address, Reachable: true}
+		if err := r.deps.Network.CheckConnectivity(ctx, endpoint); err != nil {
+			status.Reachable = false
+			status.Error = err.Error()
 		}
+		state.Endpoints = append(state.Endpoints, status)
 	}
 
 	return nil
 }
 
 func (r *Resolver) resolveResourceExhaustion(ctx context.Context, problem Problem) error {
+	if r.deps.Optimizer == nil {
+		return fmt.Errorf("no optimizer configured")
+	}
+
 	switch problem.Component {
-	case "cpu":
-		return r.optimizer.OptimizeCPU(ctx)
-	case "memory":
-		return r.optimizer.OptimizeMemory(ctx)
-	case "disk":
-		return r.optimizer.OptimizeDisk(ctx)
+	case MetricCPU:
+		return r.deps.Optimizer.OptimizeCPU(ctx)
+	case MetricMemory:
+		return r.deps.Optimizer.OptimizeMemory(ctx)
+	case MetricDisk:
+		return r.deps.Optimizer.OptimizeDisk(ctx)
 	default:
 		return fmt.Errorf("unsupported resource type: %s", problem.Component)
 	}
 }
 
 func (r *Resolver) resolveServiceFailure(ctx context.Context, problem Problem) error {
+	if r.deps.Services == nil {
+		return fmt.Errorf("no service manager configured")
+	}
+
 	service := problem.Component
-	if err := r.manager.RestartService(ctx, service); err != nil {
+	if err := r.deps.Services.RestartService(ctx, service); err != nil {
 		return fmt.Errorf("failed to restart service %s: %w", service, err)
 	}
 	return nil
 }
 
 func (r *Resolver) resolveNetworkIssue(ctx context.Context, problem Problem) error {
+	if r.deps.Network == nil {
+		return fmt.Errorf("no network checker configured")
+	}
+
 	endpoint := problem.Component
-	if err := r.network.RepairConnection(ctx, endpoint); err != nil {
+	if err := r.deps.Network.RepairConnection(ctx, endpoint); err != nil {
 		return fmt.Errorf("failed to repair connection to %s: %w", endpoint, err)
 	}
 	return nil
 }
 
-// GetProblems returns all detected problems
-func (r *Resolver) GetProblems() []*Problem {
+// GetProblems returns all known problems, most urgent first
+func (r *Resolver) GetProblems() []Problem {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	problems := make([]*Problem, 0, len(r.problems))
+	problems := make([]Problem, 0, len(r.problems))
 	for _, problem := range r.problems {
-		problems = append(problems, problem)
+		problems = append(problems, *problem)
 	}
+	sortProblems(problems)
 
 	return problems
 }
@@ -266,7 +535,11 @@ func (r *Resolver) GetProblem(id string) (*Problem, bool) {
 	defer r.mu.RUnlock()
 
 	problem, exists := r.problems[id]
-	return problem, exists
+	if !exists {
+		return nil, false
+	}
+	copied := *problem
+	return &copied, true
 }
 
 // ClearResolved removes resolved problems
@@ -275,10 +548,11 @@ func (r *Resolver) ClearResolved() {
 	defer r.mu.Unlock()
 
 	for id, problem := range r.problems {
-		if problem.Status == "resolved" {
+		if problem.Status == StatusResolved {
 			delete(r.problems, id)
 		}
 	}
+	r.persistLocked()
 }
 
 // matchPattern checks if a string matches any pattern
@@ -304,12 +578,17 @@ func (r *Resolver) matchPattern(input string) (Pattern, bool) {
 	return Pattern{}, false
 }
 
-// addProblem adds a new problem
-func (r *Resolver) addProblem(problem *Problem) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// inMaintenance reports whether problem's component is in maintenance
+func (r *Resolver) inMaintenance(problem Problem) bool {
+	return r.deps.Maintenance != nil && r.deps.Maintenance.Active(problem.Component)
+}
 
-	r.problems[problem.ID] = problem
+// failProblem records a failed resolution and escalates when the policy
+// says so
+func (r *Resolver) failProblem(ctx context.Context, id string, err error) {
+	if problem, escalate := r.recordFailure(id, err.Error()); escalate {
+		r.escalate(ctx, problem)
+	}
 }
 
 // updateProblem updates an existing problem
@@ -320,9 +599,45 @@ func (r *Resolver) updateProblem(id string, status, resolution string) {
 	if problem, exists := r.problems[id]; exists {
 		problem.Status = status
 		problem.Resolution = resolution
-		if status == "resolved" {
+		if status == StatusResolved {
 			now := time.Now()
 			problem.ResolvedAt = &now
 		}
+		r.persistLocked()
+	}
+}
+
+// HandleCommand processes resolver commands
+func (r *Resolver) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "resolver:detect":
+		return r.DetectProblems(ctx)
+	case "resolver:problems":
+		return r.GetProblems(), nil
+	case "resolver:runbooks":
+		return r.GetRunbooks(), nil
+	case "resolver:load-runbooks":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "runbook path required")
+		}
+		if err := r.LoadRunbooks(args[0]); err != nil {
+			return nil, err
+		}
+		return r.GetRunbooks(), nil
+	case "resolver:resolve":
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "problem ID required")
+		}
+		problem, ok := r.GetProblem(args[0])
+		if !ok {
+			return nil, protocol.Errorf(protocol.ErrorNotFound, "problem not found: %s", args[0])
+		}
+		if err := r.ResolveProblem(ctx, *problem); err != nil {
+			return nil, err
+		}
+		problem, _ = r.GetProblem(args[0])
+		return problem, nil
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown resolver command: %s", cmd)
 	}
 }
@@ -0,0 +1,188 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Problem types
+const (
+	TypeResourceExhaustion = "resource_exhaustion"
+	TypeServiceFailure     = "service_failure"
+	TypeNetworkIssue       = "network_issue"
+)
+
+// Problem severities
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Problem statuses
+const (
+	StatusOpen     = "open"
+	StatusResolved = "resolved"
+	StatusFailed   = "failed"
+)
+
+// Resource metrics in State.Metrics, as percentages
+const (
+	MetricCPU    = "cpu"
+	MetricMemory = "memory"
+	MetricDisk   = "disk"
+)
+
+// State is a snapshot of the system that rules are evaluated against. It is
+// plain data so rules can be tested without a running system.
+type State struct {
+	Timestamp time.Time
+	Metrics   map[string]float64 // missing metrics are unknown
+	Services  []ServiceStatus
+	Endpoints []EndpointStatus
+}
+
+// ServiceStatus represents the health of a discovered service
+type ServiceStatus struct {
+	ID      string
+	Name    string
+	Healthy bool
+	Status  string
+	Error   string // set when the health check itself failed
+}
+
+// EndpointStatus represents the reachability of an endpoint
+type EndpointStatus struct {
+	Name      string
+	Address   string
+	Reachable bool
+	Error     string
+}
+
+// Rule detects problems in a state snapshot
+type Rule interface {
+	Name() string
+	Evaluate(state *State) []Problem
+}
+
+// ThresholdRule reports resource exhaustion when a metric reaches a threshold
+type ThresholdRule struct {
+	RuleName  string
+	Metric    string
+	Threshold float64
+	Severity  string
+}
+
+// Name returns the rule name
+func (r ThresholdRule) Name() string { return r.RuleName }
+
+// Evaluate checks the rule's metric against its threshold
+func (r ThresholdRule) Evaluate(state *State) []Problem {
+	usage, ok := state.Metrics[r.Metric]
+	if !ok || usage < r.Threshold {
+		return nil
+	}
+	return []Problem{{
+		Type:        TypeResourceExhaustion,
+		Component:   r.Metric,
+		Severity:    r.Severity,
+		Description: fmt.Sprintf("%s usage %.1f%% is above %.1f%%", r.Metric, usage, r.Threshold),
+		Details:     map[string]interface{}{"usage": usage, "threshold": r.Threshold},
+	}}
+}
+
+// ServiceHealthRule reports services that are unhealthy or can't be checked
+type ServiceHealthRule struct{}
+
+// Name returns the rule name
+func (ServiceHealthRule) Name() string { return "service_health" }
+
+// Evaluate reports each unhealthy service
+func (ServiceHealthRule) Evaluate(state *State) []Problem {
+	var problems []Problem
+	for _, service := range state.Services {
+		switch {
+		case service.Error != "":
+			problems = append(problems, Problem{
+				Type:        TypeServiceFailure,
+				Component:   service.Name,
+				Severity:    SeverityCritical,
+				Description: fmt.Sprintf("health check of %s failed: %s", service.Name, service.Error),
+				Details:     map[string]interface{}{"id": service.ID, "error": service.Error},
+			})
+		case !service.Healthy:
+			problems = append(problems, Problem{
+				Type:        TypeServiceFailure,
+				Component:   service.Name,
+				Severity:    SeverityCritical,
+				Description: fmt.Sprintf("%s is %s", service.Name, service.Status),
+				Details:     map[string]interface{}{"id": service.ID, "status": service.Status},
+			})
+		}
+	}
+	return problems
+}
+
+// ConnectivityRule reports unreachable endpoints
+type ConnectivityRule struct{}
+
+// Name returns the rule name
+func (ConnectivityRule) Name() string { return "connectivity" }
+
+// Evaluate reports each unreachable endpoint
+func (ConnectivityRule) Evaluate(state *State) []Problem {
+	var problems []Problem
+	for _, endpoint := range state.Endpoints {
+		if endpoint.Reachable {
+			continue
+		}
+		problems = append(problems, Problem{
+			Type:        TypeNetworkIssue,
+			Component:   endpoint.Name,
+			Severity:    SeverityWarning,
+			Description: fmt.Sprintf("%s (%s) is unreachable: %s", endpoint.Name, endpoint.Address, endpoint.Error),
+			Details:     map[string]interface{}{"address": endpoint.Address, "error": endpoint.Error},
+		})
+	}
+	return problems
+}
+
+// DefaultRules returns the rules a new resolver starts with
+func DefaultRules() []Rule {
+	return []Rule{
+		ThresholdRule{RuleName: "cpu_exhaustion", Metric: MetricCPU, Threshold: 90, Severity: SeverityWarning},
+		ThresholdRule{RuleName: "memory_exhaustion", Metric: MetricMemory, Threshold: 90, Severity: SeverityCritical},
+		ThresholdRule{RuleName: "disk_exhaustion", Metric: MetricDisk, Threshold: 90, Severity: SeverityCritical},
+		ServiceHealthRule{},
+		ConnectivityRule{},
+	}
+}
+
+// EvaluateRules runs rules against state. Problem IDs are fingerprints of
+// their type and component, so the same problem detected twice has the
+// same ID; when several rules report it the first one wins.
+func EvaluateRules(state *State, rules []Rule) []Problem {
+	seen := make(map[string]bool)
+	var problems []Problem
+	for _, rule := range rules {
+		for _, problem := range rule.Evaluate(state) {
+			problem.Fingerprint = Fingerprint(problem.Type, problem.Component)
+			problem.ID = problemID(problem.Type, problem.Component)
+			if seen[problem.ID] {
+				continue
+			}
+			seen[problem.ID] = true
+
+			problem.Source = rule.Name()
+			problem.Status = StatusOpen
+			problem.DetectedAt = state.Timestamp
+			problems = append(problems, problem)
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].ID < problems[j].ID })
+	return problems
+}
+
+func problemID(typ, component string) string {
+	return "prob_" + Fingerprint(typ, component)
+}
@@ -0,0 +1,208 @@
+package resolver
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThresholdRule(t *testing.T) {
+	rule := ThresholdRule{RuleName: "disk_exhaustion", Metric: MetricDisk, Threshold: 90, Severity: SeverityCritical}
+
+	tests := []struct {
+		name    string
+		metrics map[string]float64
+		want    bool
+	}{
+		{"unknown metric", map[string]float64{MetricCPU: 99}, false},
+		{"below threshold", map[string]float64{MetricDisk: 89.9}, false},
+		{"at threshold", map[string]float64{MetricDisk: 90}, true},
+		{"above threshold", map[string]float64{MetricDisk: 97.5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := rule.Evaluate(&State{Metrics: tt.metrics})
+			if got := len(problems) == 1; got != tt.want {
+				t.Fatalf("got %d problems, want problem %v", len(problems), tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			p := problems[0]
+			if p.Type != TypeResourceExhaustion || p.Component != MetricDisk || p.Severity != SeverityCritical {
+				t.Errorf("got %s/%s/%s, want %s/%s/%s", p.Type, p.Component, p.Severity,
+					TypeResourceExhaustion, MetricDisk, SeverityCritical)
+			}
+			if p.Details["usage"] != tt.metrics[MetricDisk] {
+				t.Errorf("usage detail = %v, want %v", p.Details["usage"], tt.metrics[MetricDisk])
+			}
+		})
+	}
+}
+
+func TestServiceHealthRule(t *testing.T) {
+	tests := []struct {
+		name       string
+		services   []ServiceStatus
+		components []string
+		details    []string // substring expected in each description
+	}{
+		{
+			name:     "all healthy",
+			services: []ServiceStatus{{ID: "a", Name: "web", Healthy: true, Status: "active"}},
+		},
+		{
+			name:       "unhealthy",
+			services:   []ServiceStatus{{ID: "a", Name: "web", Status: "stale"}},
+			components: []string{"web"},
+			details:    []string{"web is stale"},
+		},
+		{
+			name:       "check failed",
+			services:   []ServiceStatus{{ID: "a", Name: "db", Healthy: true, Error: "timeout"}},
+			components: []string{"db"},
+			details:    []string{"timeout"},
+		},
+		{
+			name: "mixed",
+			services: []ServiceStatus{
+				{ID: "a", Name: "web", Healthy: true},
+				{ID: "b", Name: "db", Status: "stale"},
+				{ID: "c", Name: "cache", Error: "refused"},
+			},
+			components: []string{"db", "cache"},
+			details:    []string{"db is stale", "refused"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := ServiceHealthRule{}.Evaluate(&State{Services: tt.services})
+			if len(problems) != len(tt.components) {
+				t.Fatalf("got %d problems, want %d", len(problems), len(tt.components))
+			}
+			for i, p := range problems {
+				if p.Type != TypeServiceFailure || p.Severity != SeverityCritical {
+					t.Errorf("problem %d is %s/%s, want %s/%s", i, p.Type, p.Severity, TypeServiceFailure, SeverityCritical)
+				}
+				if p.Component != tt.components[i] {
+					t.Errorf("problem %d component = %q, want %q", i, p.Component, tt.components[i])
+				}
+				if !strings.Contains(p.Description, tt.details[i]) {
+					t.Errorf("problem %d description %q lacks %q", i, p.Description, tt.details[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConnectivityRule(t *testing.T) {
+	tests := []struct {
+		name       string
+		endpoints  []EndpointStatus
+		components []string
+	}{
+		{"none", nil, nil},
+		{"reachable", []EndpointStatus{{Name: "server", Address: "10.0.0.1:443", Reachable: true}}, nil},
+		{
+			name: "unreachable",
+			endpoints: []EndpointStatus{
+				{Name: "server", Address: "10.0.0.1:443", Reachable: true},
+				{Name: "dns", Address: "10.0.0.53:53", Error: "i/o timeout"},
+			},
+			components: []string{"dns"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := ConnectivityRule{}.Evaluate(&State{Endpoints: tt.endpoints})
+			if len(problems) != len(tt.components) {
+				t.Fatalf("got %d problems, want %d", len(problems), len(tt.components))
+			}
+			for i, p := range problems {
+				if p.Type != TypeNetworkIssue || p.Severity != SeverityWarning || p.Component != tt.components[i] {
+					t.Errorf("problem %d is %s/%s/%s, want %s/%s/%s", i, p.Type, p.Severity, p.Component,
+						TypeNetworkIssue, SeverityWarning, tt.components[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateRules(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		state   State
+		rules   []Rule
+		sources map[string]string // component -> rule expected to report it
+	}{
+		{
+			name:    "healthy host",
+			state:   State{Metrics: map[string]float64{MetricCPU: 10, MetricMemory: 20, MetricDisk: 30}},
+			rules:   DefaultRules(),
+			sources: map[string]string{},
+		},
+		{
+			name: "default rules",
+			state: State{
+				Metrics:   map[string]float64{MetricCPU: 95, MetricMemory: 20, MetricDisk: 91},
+				Services:  []ServiceStatus{{ID: "a", Name: "web", Status: "stale"}},
+				Endpoints: []EndpointStatus{{Name: "server", Address: "10.0.0.1:443"}},
+			},
+			rules: DefaultRules(),
+			sources: map[string]string{
+				MetricCPU:  "cpu_exhaustion",
+				MetricDisk: "disk_exhaustion",
+				"web":      "service_health",
+				"server":   "connectivity",
+			},
+		},
+		{
+			name:  "first rule wins",
+			state: State{Metrics: map[string]float64{MetricMemory: 96}},
+			rules: []Rule{
+				ThresholdRule{RuleName: "memory_critical", Metric: MetricMemory, Threshold: 95, Severity: SeverityCritical},
+				ThresholdRule{RuleName: "memory_warning", Metric: MetricMemory, Threshold: 80, Severity: SeverityWarning},
+			},
+			sources: map[string]string{MetricMemory: "memory_critical"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.state.Timestamp = now
+			problems := EvaluateRules(&tt.state, tt.rules)
+			if len(problems) != len(tt.sources) {
+				t.Fatalf("got %d problems, want %d: %+v", len(problems), len(tt.sources), problems)
+			}
+			for i, p := range problems {
+				if want := tt.sources[p.Component]; p.Source != want {
+					t.Errorf("%s reported by %q, want %q", p.Component, p.Source, want)
+				}
+				if p.ID != problemID(p.Type, p.Component) || p.Fingerprint != Fingerprint(p.Type, p.Component) {
+					t.Errorf("%s has ID %s and fingerprint %s, not derived from its type and component", p.Component, p.ID, p.Fingerprint)
+				}
+				if p.Status != StatusOpen || !p.DetectedAt.Equal(now) {
+					t.Errorf("%s is %s since %s, want open since %s", p.Component, p.Status, p.DetectedAt, now)
+				}
+				if i > 0 && problems[i-1].ID >= p.ID {
+					t.Errorf("problems not ordered by ID: %s before %s", problems[i-1].ID, p.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestFingerprintIgnoresValues(t *testing.T) {
+	first := EvaluateRules(&State{Metrics: map[string]float64{MetricDisk: 91}}, DefaultRules())
+	second := EvaluateRules(&State{Metrics: map[string]float64{MetricDisk: 99}}, DefaultRules())
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("got %d and %d problems, want one each", len(first), len(second))
+	}
+	if first[0].ID != second[0].ID {
+		t.Errorf("same problem got IDs %s and %s", first[0].ID, second[0].ID)
+	}
+	if first[0].Description == second[0].Description {
+		t.Errorf("descriptions should carry the current usage")
+	}
+}
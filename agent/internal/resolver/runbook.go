@@ -0,0 +1,546 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"shh/agent/internal/optimizer"
+)
+
+// Runbook step actions
+const (
+	StepRestartService = "restart_service"
+	StepClearPath      = "clear_path"
+	StepRunCommand     = "run_command"
+	StepNotify         = "notify"
+)
+
+const (
+	defaultStepTimeout = time.Minute
+	defaultCooldown    = 10 * time.Minute
+	defaultMaxAttempts = 3
+)
+
+// Runbook maps a problem pattern to ordered remediation steps. Runbooks are
+// YAML documents, for example:
+//
+//	name: nginx-down
+//	match:
+//	  type: service_failure
+//	  component: ^nginx$
+//	max_attempts: 3
+//	cooldown: 10m
+//	steps:
+//	  - action: restart_service
+//	    timeout: 30s
+//	    retries: 1
+//	    check:
+//	      command: [systemctl, is-active, --quiet, nginx]
+//	  - action: notify
+//	    message: "{{component}} restarted by runbook"
+type Runbook struct {
+	Name        string        `yaml:"name" json:"name"`
+	Description string        `yaml:"description" json:"description,omitempty"`
+	Match       RunbookMatch  `yaml:"match" json:"match"`
+	Steps       []RunbookStep `yaml:"steps" json:"steps"`
+	// MaxAttempts is how often the runbook may run for one problem before
+	// the problem is left for a human; 0 uses the default
+	MaxAttempts int `yaml:"max_attempts" json:"max_attempts"`
+	// Cooldown is the minimum time between runs for one problem
+	Cooldown time.Duration `yaml:"cooldown" json:"cooldown"`
+
+	component   *regexp.Regexp
+	description *regexp.Regexp
+}
+
+// RunbookMatch selects the problems a runbook handles. Empty fields match
+// anything; Component and Description are regular expressions.
+type RunbookMatch struct {
+	Type        string `yaml:"type" json:"type,omitempty"`
+	Component   string `yaml:"component" json:"component,omitempty"`
+	Description string `yaml:"description" json:"description,omitempty"`
+	Severity    string `yaml:"severity" json:"severity,omitempty"`
+}
+
+// RunbookStep represents one remediation step
+type RunbookStep struct {
+	Name       string        `yaml:"name" json:"name,omitempty"`
+	Action     string        `yaml:"action" json:"action"`
+	Service    string        `yaml:"service" json:"service,omitempty"`       // restart_service, defaults to the problem component
+	Path       string        `yaml:"path" json:"path,omitempty"`             // clear_path
+	OlderThan  time.Duration `yaml:"older_than" json:"older_than,omitempty"` // clear_path, 0 clears everything
+	Command    []string      `yaml:"command" json:"command,omitempty"`       // run_command
+	Message    string        `yaml:"message" json:"message,omitempty"`       // notify
+	Timeout    time.Duration `yaml:"timeout" json:"timeout,omitempty"`       // per attempt
+	Retries    int           `yaml:"retries" json:"retries,omitempty"`       // extra attempts after a failure
+	RetryDelay time.Duration `yaml:"retry_delay" json:"retry_delay,omitempty"`
+	Check      *StepCheck    `yaml:"check" json:"check,omitempty"`
+	// ContinueOnFailure runs the following steps even if this one fails
+	ContinueOnFailure bool `yaml:"continue_on_failure" json:"continue_on_failure,omitempty"`
+}
+
+// StepCheck verifies that a step worked. All set fields must pass.
+type StepCheck struct {
+	Command []string      `yaml:"command" json:"command,omitempty"` // must exit 0
+	URL     string        `yaml:"url" json:"url,omitempty"`         // must answer 2xx
+	Delay   time.Duration `yaml:"delay" json:"delay,omitempty"`     // wait before checking
+}
+
+// RunbookRun represents the outcome of running a runbook for a problem
+type RunbookRun struct {
+	Runbook   string        `json:"runbook"`
+	ProblemID string        `json:"problem_id"`
+	Attempt   int           `json:"attempt"`
+	Steps     []StepResult  `json:"steps"`
+	Success   bool          `json:"success"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// StepResult represents the outcome of one runbook step
+type StepResult struct {
+	Name     string `json:"name"`
+	Action   string `json:"action"`
+	Attempts int    `json:"attempts"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// runbookState tracks a runbook's runs for one problem
+type runbookState struct {
+	attempts int
+	lastRun  time.Time
+}
+
+// Notifier delivers runbook notifications and escalations
+type Notifier interface {
+	Notify(ctx context.Context, problem Problem, message string) error
+}
+
+// Notification is a message about a problem, published by an
+// EventNotifier
+type Notification struct {
+	Problem   Problem   `json:"problem"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// EventNotifier publishes notifications as events
+type EventNotifier struct {
+	events chan<- interface{}
+}
+
+// NewEventNotifier creates a notifier publishing to events
+func NewEventNotifier(events chan<- interface{}) *EventNotifier {
+	return &EventNotifier{events: events}
+}
+
+// Notify publishes a Notification, failing rather than blocking when the
+// channel is full
+func (n *EventNotifier) Notify(ctx context.Context, problem Problem, message string) error {
+	select {
+	case n.events <- Notification{Problem: problem, Message: message, Timestamp: time.Now()}:
+		return nil
+	default:
+		return fmt.Errorf("failed to send notification: channel full")
+	}
+}
+
+// LoadRunbooks parses runbooks from a YAML file, which may hold several
+// documents, or from every .yaml and .yml file in a directory
+func LoadRunbooks(path string) ([]*Runbook, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat runbooks: %w", err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+	}
+
+	var runbooks []*Runbook
+	names := make(map[string]string)
+	for _, file := range files {
+		parsed, err := parseRunbooks(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, rb := range parsed {
+			if other, ok := names[rb.Name]; ok {
+				return nil, fmt.Errorf("runbook %s in %s is already defined in %s", rb.Name, file, other)
+			}
+			names[rb.Name] = file
+		}
+		runbooks = append(runbooks, parsed...)
+	}
+	return runbooks, nil
+}
+
+func parseRunbooks(file string) ([]*Runbook, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runbook file: %w", err)
+	}
+
+	var runbooks []*Runbook
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var rb Runbook
+		if err := decoder.Decode(&rb); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		if err := rb.validate(); err != nil {
+			return nil, fmt.Errorf("invalid runbook in %s: %w", file, err)
+		}
+		runbooks = append(runbooks, &rb)
+	}
+	return runbooks, nil
+}
+
+// validate checks the runbook, compiles its patterns and fills in defaults
+func (rb *Runbook) validate() error {
+	if rb.Name == "" {
+		return fmt.Errorf("runbook name required")
+	}
+	if len(rb.Steps) == 0 {
+		return fmt.Errorf("runbook %s has no steps", rb.Name)
+	}
+
+	var err error
+	if rb.Match.Component != "" {
+		if rb.component, err = regexp.Compile(rb.Match.Component); err != nil {
+			return fmt.Errorf("runbook %s: invalid component pattern: %w", rb.Name, err)
+		}
+	}
+	if rb.Match.Description != "" {
+		if rb.description, err = regexp.Compile(rb.Match.Description); err != nil {
+			return fmt.Errorf("runbook %s: invalid description pattern: %w", rb.Name, err)
+		}
+	}
+	if rb.MaxAttempts == 0 {
+		rb.MaxAttempts = defaultMaxAttempts
+	}
+	if rb.Cooldown == 0 {
+		rb.Cooldown = defaultCooldown
+	}
+
+	for i := range rb.Steps {
+		step := &rb.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("%d-%s", i+1, step.Action)
+		}
+		if step.Timeout == 0 {
+			step.Timeout = defaultStepTimeout
+		}
+		switch step.Action {
+		case StepRestartService, StepNotify:
+		case StepClearPath:
+			if !filepath.IsAbs(step.Path) {
+				return fmt.Errorf("runbook %s step %s: absolute path required", rb.Name, step.Name)
+			}
+		case StepRunCommand:
+			if len(step.Command) == 0 {
+				return fmt.Errorf("runbook %s step %s: command required", rb.Name, step.Name)
+			}
+		default:
+			return fmt.Errorf("runbook %s step %s: unknown action %q", rb.Name, step.Name, step.Action)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the runbook handles problem
+func (rb *Runbook) Matches(problem Problem) bool {
+	if rb.Match.Type != "" && rb.Match.Type != problem.Type {
+		return false
+	}
+	if rb.Match.Severity != "" && rb.Match.Severity != problem.Severity {
+		return false
+	}
+	if rb.component != nil && !rb.component.MatchString(problem.Component) {
+		return false
+	}
+	if rb.description != nil && !rb.description.MatchString(problem.Description) {
+		return false
+	}
+	return true
+}
+
+// LoadRunbooks replaces the resolver's runbooks with those at path
+func (r *Resolver) LoadRunbooks(path string) error {
+	runbooks, err := LoadRunbooks(path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.runbooks = runbooks
+	r.logger.Info("Loaded runbooks", zap.String("path", path), zap.Int("count", len(runbooks)))
+	return nil
+}
+
+// GetRunbooks returns the loaded runbooks
+func (r *Resolver) GetRunbooks() []Runbook {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	runbooks := make([]Runbook, 0, len(r.runbooks))
+	for _, rb := range r.runbooks {
+		runbooks = append(runbooks, *rb)
+	}
+	return runbooks
+}
+
+// matchRunbook returns the first runbook handling problem
+func (r *Resolver) matchRunbook(problem Problem) *Runbook {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, rb := range r.runbooks {
+		if rb.Matches(problem) {
+			return rb
+		}
+	}
+	return nil
+}
+
+// runRunbook runs rb's steps for problem, enforcing its attempt limit and
+// cooldown
+func (r *Resolver) runRunbook(ctx context.Context, rb *Runbook, problem Problem) (*RunbookRun, error) {
+	key := rb.Name + "\x00" + problem.ID
+
+	r.mu.Lock()
+	state, ok := r.runbookStates[key]
+	if !ok {
+		state = &runbookState{}
+		r.runbookStates[key] = state
+	}
+	if state.attempts >= rb.MaxAttempts {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("runbook %s gave up on %s after %d attempts", rb.Name, problem.ID, state.attempts)
+	}
+	if since := time.Since(state.lastRun); since < rb.Cooldown {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("runbook %s is cooling down for %s", rb.Name, (rb.Cooldown - since).Round(time.Second))
+	}
+	state.attempts++
+	state.lastRun = time.Now()
+	attempt := state.attempts
+	r.mu.Unlock()
+
+	run := &RunbookRun{
+		Runbook:   rb.Name,
+		ProblemID: problem.ID,
+		Attempt:   attempt,
+		StartedAt: time.Now(),
+		Success:   true,
+	}
+	vars := strings.NewReplacer(
+		"{{id}}", problem.ID,
+		"{{type}}", problem.Type,
+		"{{component}}", problem.Component,
+		"{{severity}}", problem.Severity,
+		"{{description}}", problem.Description,
+	)
+
+	for _, step := range rb.Steps {
+		result := r.runStep(ctx, step, problem, vars)
+		run.Steps = append(run.Steps, result)
+		if result.Error != "" {
+			r.logger.Warn("Runbook step failed",
+				zap.String("runbook", rb.Name),
+				zap.String("step", step.Name),
+				zap.String("problem", problem.ID),
+				zap.String("error", result.Error))
+			if !step.ContinueOnFailure {
+				run.Success = false
+				break
+			}
+		}
+	}
+	run.Duration = time.Since(run.StartedAt)
+
+	if run.Success {
+		// A later recurrence starts with a fresh attempt budget
+		r.mu.Lock()
+		state.attempts = 0
+		r.mu.Unlock()
+		return run, nil
+	}
+	return run, fmt.Errorf("runbook %s failed at step %s", rb.Name, run.Steps[len(run.Steps)-1].Name)
+}
+
+// runStep runs a step with its timeout and retries, then its check
+func (r *Resolver) runStep(ctx context.Context, step RunbookStep, problem Problem, vars *strings.Replacer) StepResult {
+	result := StepResult{Name: step.Name, Action: step.Action}
+
+	var err error
+	for attempt := 0; attempt <= step.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				result.Error = ctx.Err().Error()
+				return result
+			case <-time.After(step.RetryDelay):
+			}
+		}
+		result.Attempts++
+
+		stepCtx, cancel := context.WithTimeout(ctx, step.Timeout)
+		result.Output, err = r.execStep(stepCtx, step, problem, vars)
+		if err == nil && step.Check != nil {
+			err = runCheck(stepCtx, step.Check, vars)
+		}
+		cancel()
+		if err == nil {
+			result.Error = ""
+			return result
+		}
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// execStep performs a step's action
+func (r *Resolver) execStep(ctx context.Context, step RunbookStep, problem Problem, vars *strings.Replacer) (string, error) {
+	switch step.Action {
+	case StepRestartService:
+		if r.deps.Services == nil {
+			return "", fmt.Errorf("no service manager configured")
+		}
+		service := vars.Replace(step.Service)
+		if service == "" {
+			service = problem.Component
+		}
+		if err := r.deps.Services.RestartService(ctx, service); err != nil {
+			return "", fmt.Errorf("failed to restart service %s: %w", service, err)
+		}
+		return fmt.Sprintf("restarted %s", service), nil
+	case StepClearPath:
+		return clearPath(ctx, vars.Replace(step.Path), step.OlderThan)
+	case StepRunCommand:
+		args := make([]string, len(step.Command))
+		for i, arg := range step.Command {
+			args[i] = vars.Replace(arg)
+		}
+		output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		if err != nil {
+			return string(output), fmt.Errorf("command failed: %w", err)
+		}
+		return string(output), nil
+	case StepNotify:
+		message := vars.Replace(step.Message)
+		if message == "" {
+			message = problem.Description
+		}
+		if r.deps.Notifier == nil {
+			r.logger.Warn("Runbook notification", zap.String("problem", problem.ID), zap.String("message", message))
+			return message, nil
+		}
+		return message, r.deps.Notifier.Notify(ctx, problem, message)
+	default:
+		return "", fmt.Errorf("unknown step action: %s", step.Action)
+	}
+}
+
+// clearPath removes the entries of dir older than olderThan, refusing the
+// optimizer's protected paths
+func clearPath(ctx context.Context, dir string, olderThan time.Duration) (string, error) {
+	dir = filepath.Clean(dir)
+	if !filepath.IsAbs(dir) || dir == "/" {
+		return "", fmt.Errorf("refusing to clear path: %s", dir)
+	}
+	for _, protected := range optimizer.DefaultProtectedPaths {
+		if dir == protected || strings.HasPrefix(dir, protected+string(filepath.Separator)) {
+			return "", fmt.Errorf("refusing to clear protected path: %s", dir)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	removed := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return fmt.Sprintf("removed %d entries from %s", removed, dir), err
+		}
+		info, err := entry.Info()
+		if err != nil || (olderThan > 0 && info.ModTime().After(cutoff)) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return fmt.Sprintf("removed %d entries from %s", removed, dir), fmt.Errorf("failed to remove %s: %w", entry.Name(), err)
+		}
+		removed++
+	}
+	return fmt.Sprintf("removed %d entries from %s", removed, dir), nil
+}
+
+// runCheck verifies a step's success
+func runCheck(ctx context.Context, check *StepCheck, vars *strings.Replacer) error {
+	if check.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(check.Delay):
+		}
+	}
+
+	if len(check.Command) > 0 {
+		args := make([]string, len(check.Command))
+		for i, arg := range check.Command {
+			args[i] = vars.Replace(arg)
+		}
+		if output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("check command failed: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if check.URL != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, vars.Replace(check.URL), nil)
+		if err != nil {
+			return fmt.Errorf("invalid check URL: %w", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("check request failed: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("check returned status %d", resp.StatusCode)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Check statuses
+const (
+	CheckPass  = "pass"
+	CheckFail  = "fail"
+	CheckError = "error"
+	CheckSkip  = "skip"
+)
+
+// Benchmark profiles. Level 2 holds every level 1 check plus stricter ones
+// that may get in the way of some workloads.
+const (
+	ProfileLevel1 = "level1"
+	ProfileLevel2 = "level2"
+)
+
+// DefaultProfile is benchmarked when no profile is given
+const DefaultProfile = ProfileLevel1
+
+// maxEvidence bounds the evidence lines kept per check
+const maxEvidence = 20
+
+// severityWeights weight checks in the score
+var severityWeights = map[string]int{
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
+
+// Check is a compliance check
+type Check struct {
+	ID       string
+	Title    string
+	Severity string
+	// Profiles the check belongs to
+	Profiles []string
+	// Run returns whether the host passes and the evidence for it. A
+	// check that doesn't apply to the host returns errNotApplicable.
+	Run func(ctx context.Context, env *benchEnv) (bool, []string, error)
+}
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Severity string   `json:"severity"`
+	Status   string   `json:"status"`
+	Evidence []string `json:"evidence,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// BenchmarkReport is the scored result of a profile. Score is the
+// severity-weighted share of passed checks, in percent; skipped and
+// errored checks don't count.
+type BenchmarkReport struct {
+	Profile   string        `json:"profile"`
+	Score     float64       `json:"score"`
+	Passed    int           `json:"passed"`
+	Failed    int           `json:"failed"`
+	Errors    int           `json:"errors"`
+	Skipped   int           `json:"skipped"`
+	Results   []CheckResult `json:"results"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// Benchmark runs compliance checks grouped into profiles
+type Benchmark struct {
+	logger *zap.Logger
+	checks []Check
+}
+
+// NewBenchmark creates a benchmark with the built-in checks
+func NewBenchmark(logger *zap.Logger) *Benchmark {
+	return &Benchmark{
+		logger: logger,
+		checks: builtinChecks(),
+	}
+}
+
+// Profiles returns the known profile names
+func (b *Benchmark) Profiles() []string {
+	seen := make(map[string]bool)
+	var profiles []string
+	for _, c := range b.checks {
+		for _, p := range c.Profiles {
+			if !seen[p] {
+				seen[p] = true
+				profiles = append(profiles, p)
+			}
+		}
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// Run runs the checks of a profile and scores the host
+func (b *Benchmark) Run(ctx context.Context, profile string) (*BenchmarkReport, error) {
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	var checks []Check
+	for _, c := range b.checks {
+		if containsProfile(c.Profiles, profile) {
+			checks = append(checks, c)
+		}
+	}
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("unknown benchmark profile: %s", profile)
+	}
+
+	report := &BenchmarkReport{Profile: profile, StartedAt: time.Now()}
+	env := &benchEnv{}
+	var earned, possible int
+	for _, c := range checks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result := runCheck(ctx, c, env)
+		report.Results = append(report.Results, result)
+
+		weight := severityWeights[c.Severity]
+		switch result.Status {
+		case CheckPass:
+			report.Passed++
+			earned += weight
+			possible += weight
+		case CheckFail:
+			report.Failed++
+			possible += weight
+		case CheckError:
+			report.Errors++
+		case CheckSkip:
+			report.Skipped++
+		}
+	}
+	if possible > 0 {
+		report.Score = float64(earned*1000/possible) / 10
+	}
+	report.Duration = time.Since(report.StartedAt)
+
+	b.logger.Info("Benchmark completed",
+		zap.String("profile", profile),
+		zap.Float64("score", report.Score),
+		zap.Int("passed", report.Passed),
+		zap.Int("failed", report.Failed))
+	return report, nil
+}
+
+func runCheck(ctx context.Context, c Check, env *benchEnv) (result CheckResult) {
+	result = CheckResult{ID: c.ID, Title: c.Title, Severity: c.Severity}
+	defer func() {
+		if r := recover(); r != nil {
+			result.Status = CheckError
+			result.Error = fmt.Sprintf("check panicked: %v", r)
+		}
+	}()
+
+	pass, evidence, err := c.Run(ctx, env)
+	if len(evidence) > maxEvidence {
+		more := len(evidence) - maxEvidence
+		evidence = append(evidence[:maxEvidence:maxEvidence], fmt.Sprintf("... and %d more", more))
+	}
+	result.Evidence = evidence
+	switch {
+	case err == errNotApplicable:
+		result.Status = CheckSkip
+	case err != nil:
+		result.Status = CheckError
+		result.Error = err.Error()
+	case pass:
+		result.Status = CheckPass
+	default:
+		result.Status = CheckFail
+	}
+	return result
+}
+
+// HandleCommand processes security commands
+func (b *Benchmark) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "security:benchmark":
+		profile := ""
+		if len(args) > 0 {
+			profile = args[0]
+		}
+		return b.Run(ctx, profile)
+	case "security:profiles":
+		return b.Profiles(), nil
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown security command: %s", cmd)
+	}
+}
+
+func containsProfile(profiles []string, profile string) bool {
+	for _, p := range profiles {
+		if strings.EqualFold(p, profile) {
+			return true
+		}
+	}
+	return false
+}
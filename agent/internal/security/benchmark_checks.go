@@ -0,0 +1,442 @@
+package security
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errNotApplicable marks a check that doesn't apply to the host, such as an
+// sshd check without sshd installed
+var errNotApplicable = errors.New("not applicable")
+
+const (
+	sshdConfigPath = "/etc/ssh/sshd_config"
+	loginDefsPath  = "/etc/login.defs"
+	sudoersPath    = "/etc/sudoers"
+	sudoersDir     = "/etc/sudoers.d"
+	procSysPath    = "/proc/sys"
+)
+
+// worldWritableRoots are searched for world-writable files
+var worldWritableRoots = []string{"/etc", "/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/local/bin", "/usr/local/sbin"}
+
+// sshdDefaults are OpenSSH's defaults for options a config may leave out
+var sshdDefaults = map[string]string{
+	"permitrootlogin":         "prohibit-password",
+	"passwordauthentication":  "yes",
+	"permitemptypasswords":    "no",
+	"x11forwarding":           "no",
+	"maxauthtries":            "6",
+	"clientaliveinterval":     "0",
+	"loglevel":                "INFO",
+	"hostbasedauthentication": "no",
+	"ignorerhosts":            "yes",
+}
+
+// benchEnv caches what several checks read during one benchmark run
+type benchEnv struct {
+	sshdOnce sync.Once
+	sshd     map[string]string
+	sshdErr  error
+}
+
+// sshdOption returns the effective value of an sshd option. It asks sshd
+// itself where possible and falls back to parsing the global section of
+// sshd_config.
+func (e *benchEnv) sshdOption(ctx context.Context, name string) (string, error) {
+	e.sshdOnce.Do(func() { e.sshd, e.sshdErr = loadSSHDConfig(ctx) })
+	if e.sshdErr != nil {
+		return "", e.sshdErr
+	}
+	name = strings.ToLower(name)
+	if v, ok := e.sshd[name]; ok {
+		return v, nil
+	}
+	return sshdDefaults[name], nil
+}
+
+func loadSSHDConfig(ctx context.Context) (map[string]string, error) {
+	if _, err := os.Stat(sshdConfigPath); os.IsNotExist(err) {
+		return nil, errNotApplicable
+	}
+
+	config := make(map[string]string)
+	if output, err := exec.CommandContext(ctx, "sshd", "-T").Output(); err == nil {
+		for _, line := range strings.Split(string(output), "\n") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+				if _, seen := config[k]; !seen {
+					config[k] = v
+				}
+			}
+		}
+		return config, nil
+	}
+
+	file, err := os.Open(sshdConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sshd config: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.Replace(line, "=", " ", 1))
+		key := strings.ToLower(fields[0])
+		if key == "match" {
+			break
+		}
+		// The first value of an option wins
+		if _, seen := config[key]; !seen && len(fields) > 1 {
+			config[key] = strings.Join(fields[1:], " ")
+		}
+	}
+	return config, scanner.Err()
+}
+
+// builtinChecks returns the check library
+func builtinChecks() []Check {
+	both := []string{ProfileLevel1, ProfileLevel2}
+	strict := []string{ProfileLevel2}
+
+	return []Check{
+		// sshd hardening
+		sshdCheck("ssh-root-login", "SSH root login is restricted", SeverityHigh, both, "PermitRootLogin",
+			func(v string) bool { return v != "yes" }),
+		sshdCheck("ssh-root-login-disabled", "SSH root login is disabled", SeverityMedium, strict, "PermitRootLogin",
+			func(v string) bool { return v == "no" }),
+		sshdCheck("ssh-password-auth", "SSH password authentication is disabled", SeverityHigh, both, "PasswordAuthentication",
+			func(v string) bool { return v == "no" }),
+		sshdCheck("ssh-empty-passwords", "SSH refuses empty passwords", SeverityCritical, both, "PermitEmptyPasswords",
+			func(v string) bool { return v == "no" }),
+		sshdCheck("ssh-hostbased-auth", "SSH host-based authentication is disabled", SeverityMedium, both, "HostbasedAuthentication",
+			func(v string) bool { return v == "no" }),
+		sshdCheck("ssh-max-auth-tries", "SSH allows at most 4 authentication attempts", SeverityMedium, both, "MaxAuthTries",
+			func(v string) bool { n, err := strconv.Atoi(v); return err == nil && n <= 4 }),
+		sshdCheck("ssh-x11-forwarding", "SSH X11 forwarding is disabled", SeverityLow, strict, "X11Forwarding",
+			func(v string) bool { return v == "no" }),
+		sshdCheck("ssh-idle-timeout", "SSH disconnects idle sessions", SeverityLow, strict, "ClientAliveInterval",
+			func(v string) bool { n, err := strconv.Atoi(v); return err == nil && n > 0 && n <= 900 }),
+		sshdCheck("ssh-log-level", "SSH logs at INFO or VERBOSE", SeverityLow, strict, "LogLevel",
+			func(v string) bool { return v == "info" || v == "verbose" }),
+
+		// Kernel parameters
+		sysctlCheck("sysctl-aslr", SeverityHigh, both, "kernel.randomize_va_space", "2"),
+		sysctlCheck("sysctl-syncookies", SeverityMedium, both, "net.ipv4.tcp_syncookies", "1"),
+		sysctlCheck("sysctl-accept-redirects", SeverityMedium, both, "net.ipv4.conf.all.accept_redirects", "0"),
+		sysctlCheck("sysctl-send-redirects", SeverityMedium, both, "net.ipv4.conf.all.send_redirects", "0"),
+		sysctlCheck("sysctl-source-route", SeverityMedium, both, "net.ipv4.conf.all.accept_source_route", "0"),
+		sysctlCheck("sysctl-icmp-broadcasts", SeverityLow, both, "net.ipv4.icmp_echo_ignore_broadcasts", "1"),
+		sysctlCheck("sysctl-suid-dumpable", SeverityMedium, both, "fs.suid_dumpable", "0"),
+		sysctlCheck("sysctl-ip-forward", SeverityMedium, strict, "net.ipv4.ip_forward", "0"),
+		sysctlCheck("sysctl-dmesg-restrict", SeverityLow, strict, "kernel.dmesg_restrict", "1"),
+
+		// Files
+		fileModeCheck("file-passwd", SeverityHigh, both, "/etc/passwd", 0644),
+		fileModeCheck("file-shadow", SeverityCritical, both, "/etc/shadow", 0640),
+		fileModeCheck("file-group", SeverityHigh, both, "/etc/group", 0644),
+		fileModeCheck("file-sshd-config", SeverityHigh, both, sshdConfigPath, 0644),
+		fileModeCheck("file-sudoers", SeverityHigh, both, sudoersPath, 0440),
+		{
+			ID:       "world-writable-files",
+			Title:    "No world-writable files in system directories",
+			Severity: SeverityHigh,
+			Profiles: both,
+			Run:      checkWorldWritable,
+		},
+
+		// sudo
+		{
+			ID:       "sudo-no-authenticate",
+			Title:    "sudo never skips authentication via !authenticate",
+			Severity: SeverityHigh,
+			Profiles: both,
+			Run: sudoersCheck(func(line string) bool {
+				return strings.Contains(line, "!authenticate")
+			}),
+		},
+		{
+			ID:       "sudo-nopasswd-all",
+			Title:    "sudo requires a password to run any command",
+			Severity: SeverityMedium,
+			Profiles: strict,
+			Run: sudoersCheck(func(line string) bool {
+				return strings.Contains(line, "NOPASSWD") && strings.HasSuffix(strings.TrimSpace(line), "ALL")
+			}),
+		},
+		{
+			ID:       "sudo-use-pty",
+			Title:    "sudo runs commands in a pseudo terminal",
+			Severity: SeverityLow,
+			Profiles: strict,
+			Run:      checkSudoUsePty,
+		},
+
+		// Password policy
+		{
+			ID:       "password-empty",
+			Title:    "No account has an empty password",
+			Severity: SeverityCritical,
+			Profiles: both,
+			Run:      checkEmptyPasswords,
+		},
+		{
+			ID:       "password-uid0",
+			Title:    "root is the only account with uid 0",
+			Severity: SeverityCritical,
+			Profiles: both,
+			Run:      checkUID0,
+		},
+		loginDefsCheck("password-max-days", "Passwords expire within 365 days", SeverityMedium, both, "PASS_MAX_DAYS",
+			func(n int) bool { return n > 0 && n <= 365 }),
+		loginDefsCheck("password-warn-age", "Users are warned 7 days before passwords expire", SeverityLow, both, "PASS_WARN_AGE",
+			func(n int) bool { return n >= 7 }),
+		loginDefsCheck("password-min-days", "Passwords can't be changed again within a day", SeverityLow, strict, "PASS_MIN_DAYS",
+			func(n int) bool { return n >= 1 }),
+	}
+}
+
+func sshdCheck(id, title, severity string, profiles []string, option string, ok func(string) bool) Check {
+	return Check{
+		ID:       id,
+		Title:    title,
+		Severity: severity,
+		Profiles: profiles,
+		Run: func(ctx context.Context, env *benchEnv) (bool, []string, error) {
+			v, err := env.sshdOption(ctx, option)
+			if err != nil {
+				return false, nil, err
+			}
+			return ok(strings.ToLower(v)), []string{option + " " + v}, nil
+		},
+	}
+}
+
+func sysctlCheck(id, severity string, profiles []string, key, want string) Check {
+	return Check{
+		ID:       id,
+		Title:    fmt.Sprintf("%s is %s", key, want),
+		Severity: severity,
+		Profiles: profiles,
+		Run: func(ctx context.Context, env *benchEnv) (bool, []string, error) {
+			path := filepath.Join(procSysPath, strings.ReplaceAll(key, ".", "/"))
+			data, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				return false, nil, errNotApplicable
+			}
+			if err != nil {
+				return false, nil, err
+			}
+			v := strings.TrimSpace(string(data))
+			return v == want, []string{key + " = " + v}, nil
+		},
+	}
+}
+
+// fileModeCheck checks that a file is owned by root and grants no more
+// than maxPerm
+func fileModeCheck(id, severity string, profiles []string, path string, maxPerm os.FileMode) Check {
+	return Check{
+		ID:       id,
+		Title:    fmt.Sprintf("%s is owned by root with mode %v or stricter", path, maxPerm),
+		Severity: severity,
+		Profiles: profiles,
+		Run: func(ctx context.Context, env *benchEnv) (bool, []string, error) {
+			info, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				return false, nil, errNotApplicable
+			}
+			if err != nil {
+				return false, nil, err
+			}
+			evidence := fmt.Sprintf("%s mode %v", path, info.Mode().Perm())
+			pass := info.Mode().Perm()&^maxPerm == 0
+			if uid, gid, ok := fileOwner(info); ok {
+				evidence += fmt.Sprintf(" owner %s:%s", userName(uid), groupName(gid))
+				pass = pass && uid == 0
+			}
+			return pass, []string{evidence}, nil
+		},
+	}
+}
+
+// checkWorldWritable looks for world-writable files and directories
+// without the sticky bit in system directories
+func checkWorldWritable(ctx context.Context, env *benchEnv) (bool, []string, error) {
+	var found []string
+	for _, root := range worldWritableRoots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.Type()&fs.ModeSymlink != 0 {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			mode := info.Mode()
+			if mode.Perm()&0002 != 0 && !(mode.IsDir() && mode&os.ModeSticky != 0) {
+				found = append(found, fmt.Sprintf("%s mode %v", path, mode))
+			}
+			return nil
+		})
+		if err != nil {
+			return false, nil, err
+		}
+	}
+	return len(found) == 0, found, nil
+}
+
+// sudoersLines returns the active lines of sudoers and its drop-ins,
+// prefixed with their file
+func sudoersLines() ([]string, error) {
+	paths := []string{sudoersPath}
+	dropIns, _ := filepath.Glob(filepath.Join(sudoersDir, "*"))
+	paths = append(paths, dropIns...)
+
+	var lines []string
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) && i == 0 {
+			return nil, errNotApplicable
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			// #include directives look like comments
+			if line == "" || (strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "#include")) {
+				continue
+			}
+			lines = append(lines, path+": "+line)
+		}
+	}
+	return lines, nil
+}
+
+// sudoersCheck fails for every sudoers line that bad matches
+func sudoersCheck(bad func(line string) bool) func(context.Context, *benchEnv) (bool, []string, error) {
+	return func(ctx context.Context, env *benchEnv) (bool, []string, error) {
+		lines, err := sudoersLines()
+		if err != nil {
+			return false, nil, err
+		}
+		var found []string
+		for _, line := range lines {
+			_, content, _ := strings.Cut(line, ": ")
+			if bad(content) {
+				found = append(found, line)
+			}
+		}
+		return len(found) == 0, found, nil
+	}
+}
+
+func checkSudoUsePty(ctx context.Context, env *benchEnv) (bool, []string, error) {
+	lines, err := sudoersLines()
+	if err != nil {
+		return false, nil, err
+	}
+	for _, line := range lines {
+		_, content, _ := strings.Cut(line, ": ")
+		if strings.HasPrefix(content, "Defaults") && strings.Contains(content, "use_pty") && !strings.Contains(content, "!use_pty") {
+			return true, []string{line}, nil
+		}
+	}
+	return false, []string{"Defaults use_pty not set"}, nil
+}
+
+// readColonFile returns the fields of each line of a passwd-style file
+func readColonFile(path string) ([][]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errNotApplicable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var entries [][]string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, strings.Split(line, ":"))
+	}
+	return entries, nil
+}
+
+func checkEmptyPasswords(ctx context.Context, env *benchEnv) (bool, []string, error) {
+	entries, err := readColonFile("/etc/shadow")
+	if err != nil {
+		return false, nil, err
+	}
+	var found []string
+	for _, fields := range entries {
+		if len(fields) > 1 && fields[1] == "" {
+			found = append(found, fields[0]+" has an empty password")
+		}
+	}
+	return len(found) == 0, found, nil
+}
+
+func checkUID0(ctx context.Context, env *benchEnv) (bool, []string, error) {
+	entries, err := readColonFile("/etc/passwd")
+	if err != nil {
+		return false, nil, err
+	}
+	var found []string
+	for _, fields := range entries {
+		if len(fields) > 2 && fields[2] == "0" && fields[0] != "root" {
+			found = append(found, fields[0]+" has uid 0")
+		}
+	}
+	return len(found) == 0, found, nil
+}
+
+func loginDefsCheck(id, title, severity string, profiles []string, key string, ok func(int) bool) Check {
+	return Check{
+		ID:       id,
+		Title:    title,
+		Severity: severity,
+		Profiles: profiles,
+		Run: func(ctx context.Context, env *benchEnv) (bool, []string, error) {
+			data, err := os.ReadFile(loginDefsPath)
+			if os.IsNotExist(err) {
+				return false, nil, errNotApplicable
+			}
+			if err != nil {
+				return false, nil, err
+			}
+			for _, line := range strings.Split(string(data), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) < 2 || fields[0] != key {
+					continue
+				}
+				n, err := strconv.Atoi(fields[1])
+				if err != nil {
+					return false, nil, fmt.Errorf("invalid %s: %s", key, fields[1])
+				}
+				return ok(n), []string{key + " " + fields[1]}, nil
+			}
+			return false, []string{key + " not set"}, nil
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// RuleTypeIndicator marks scan results raised by the indicator scanner
+const RuleTypeIndicator RuleType = "indicator"
+
+// Indicator kinds
+const (
+	IndicatorDeletedExecutable = "deleted_executable"
+	IndicatorHiddenPID         = "hidden_pid"
+	IndicatorPsMismatch        = "ps_mismatch"
+	IndicatorPreload           = "ld_preload"
+	IndicatorUnknownListener   = "unknown_listener"
+)
+
+// IndicatorConfig tunes the rootkit and suspicious-process heuristics
+type IndicatorConfig struct {
+	// Interval between scheduled scans; 0 only scans on demand
+	Interval time.Duration `json:"interval"`
+	// TrustedPaths are directories whose binaries may listen on sockets
+	TrustedPaths []string `json:"trusted_paths"`
+	// AllowedListeners are executables allowed to listen outside the
+	// trusted paths
+	AllowedListeners []string `json:"allowed_listeners,omitempty"`
+	// AllowedPreloads are libraries processes may preload
+	AllowedPreloads []string `json:"allowed_preloads,omitempty"`
+	// MaxPID bounds the PIDs probed for hidden processes; 0 uses the
+	// kernel's pid_max
+	MaxPID int `json:"max_pid,omitempty"`
+}
+
+// DefaultIndicatorConfig scans hourly and trusts the system directories
+var DefaultIndicatorConfig = IndicatorConfig{
+	Interval:     time.Hour,
+	TrustedPaths: []string{"/usr/", "/bin/", "/sbin/", "/lib/", "/lib64/", "/opt/", "/snap/"},
+}
+
+// Indicator is a sign of a rootkit or a suspicious process
+type Indicator struct {
+	Kind     string    `json:"kind"`
+	PID      int       `json:"pid,omitempty"`
+	Process  string    `json:"process,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Detail   string    `json:"detail"`
+	Severity string    `json:"severity"`
+	Found    time.Time `json:"found"`
+}
+
+// ScanResult converts the indicator to the scanner result format
+func (i Indicator) ScanResult() ScanResult {
+	path := i.Path
+	if path == "" && i.PID > 0 {
+		path = fmt.Sprintf("pid:%d", i.PID)
+	}
+	return ScanResult{
+		Path:     path,
+		RuleType: RuleTypeIndicator,
+		Message:  fmt.Sprintf("%s: %s", i.Kind, i.Detail),
+		Severity: i.Severity,
+	}
+}
+
+// key identifies an indicator across scans
+func (i Indicator) key() string {
+	return fmt.Sprintf("%s|%d|%s|%s", i.Kind, i.PID, i.Path, i.Detail)
+}
+
+// IndicatorScanner looks for classic signs of compromise: processes
+// running deleted executables, PIDs hidden from /proc or ps, unexpected
+// LD_PRELOAD libraries and listeners bound by unknown binaries
+type IndicatorScanner struct {
+	logger *zap.Logger
+	config IndicatorConfig
+}
+
+// NewIndicatorScanner creates an indicator scanner
+func NewIndicatorScanner(logger *zap.Logger, config IndicatorConfig) *IndicatorScanner {
+	if config.TrustedPaths == nil {
+		config.TrustedPaths = DefaultIndicatorConfig.TrustedPaths
+	}
+	return &IndicatorScanner{
+		logger: logger,
+		config: config,
+	}
+}
+
+// Scan runs every heuristic
+func (s *IndicatorScanner) Scan(ctx context.Context) ([]Indicator, error) {
+	indicators, err := s.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(indicators, func(i, j int) bool { return indicators[i].key() < indicators[j].key() })
+	for _, ind := range indicators {
+		s.logger.Debug("Suspicious indicator found",
+			zap.String("kind", ind.Kind),
+			zap.Int("pid", ind.PID),
+			zap.String("path", ind.Path),
+			zap.String("detail", ind.Detail))
+	}
+	return indicators, nil
+}
+
+// Results runs a scan and returns its indicators as scan results
+func (s *IndicatorScanner) Results(ctx context.Context) ([]ScanResult, error) {
+	indicators, err := s.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ScanResult, len(indicators))
+	for i, ind := range indicators {
+		results[i] = ind.ScanResult()
+	}
+	return results, nil
+}
+
+// HandleCommand processes indicator commands
+func (s *IndicatorScanner) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "security:indicators":
+		return s.Scan(ctx)
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown security command: %s", cmd)
+	}
+}
@@ -0,0 +1,411 @@
+package security
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	procRoot      = "/proc"
+	ldPreloadFile = "/etc/ld.so.preload"
+	// defaultMaxPID is probed when pid_max can't be read
+	defaultMaxPID = 32768
+)
+
+// suspiciousDirs hold binaries that are a red flag wherever they run from
+var suspiciousDirs = []string{"/tmp/", "/var/tmp/", "/dev/shm/", "/run/user/"}
+
+func (s *IndicatorScanner) scan(ctx context.Context) ([]Indicator, error) {
+	listed, err := listPIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var indicators []Indicator
+	indicators = append(indicators, s.deletedExecutables(listed)...)
+	indicators = append(indicators, s.preloads(listed)...)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	indicators = append(indicators, s.hiddenPIDs(ctx, listed)...)
+	indicators = append(indicators, s.psMismatch(ctx, listed)...)
+	listeners, err := s.listeners(listed)
+	if err != nil {
+		return nil, err
+	}
+	return append(indicators, listeners...), nil
+}
+
+// listPIDs returns the PIDs /proc lists
+func listPIDs() (map[int]bool, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	pids := make(map[int]bool, len(entries))
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil {
+			pids[pid] = true
+		}
+	}
+	return pids, nil
+}
+
+func procPath(pid int, name string) string {
+	return filepath.Join(procRoot, strconv.Itoa(pid), name)
+}
+
+// processName returns the command name of a process
+func processName(pid int) string {
+	data, err := os.ReadFile(procPath(pid, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// deletedExecutables finds processes whose executable was deleted or only
+// exists in memory. Package upgrades leave these behind too, so only
+// executables in suspicious places rate high.
+func (s *IndicatorScanner) deletedExecutables(pids map[int]bool) []Indicator {
+	var indicators []Indicator
+	for pid := range pids {
+		exe, err := os.Readlink(procPath(pid, "exe"))
+		if err != nil || !strings.HasSuffix(exe, " (deleted)") && !strings.HasPrefix(exe, "/memfd:") {
+			continue
+		}
+		path := strings.TrimSuffix(exe, " (deleted)")
+		severity := SeverityMedium
+		if strings.HasPrefix(path, "/memfd:") || inDirs(path, suspiciousDirs) {
+			severity = SeverityHigh
+		}
+		indicators = append(indicators, Indicator{
+			Kind:     IndicatorDeletedExecutable,
+			PID:      pid,
+			Process:  processName(pid),
+			Path:     path,
+			Detail:   "process runs an executable that no longer exists on disk",
+			Severity: severity,
+			Found:    time.Now(),
+		})
+	}
+	return indicators
+}
+
+// hiddenPIDs probes every PID directly. A process that can be opened but
+// isn't listed in /proc is being hidden, typically by a kernel rootkit.
+func (s *IndicatorScanner) hiddenPIDs(ctx context.Context, listed map[int]bool) []Indicator {
+	maxPID := s.config.MaxPID
+	if maxPID <= 0 {
+		maxPID = defaultMaxPID
+		if data, err := os.ReadFile("/proc/sys/kernel/pid_max"); err == nil {
+			if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+				maxPID = n
+			}
+		}
+	}
+
+	var candidates []int
+	for pid := 1; pid <= maxPID; pid++ {
+		if pid%65536 == 0 && ctx.Err() != nil {
+			return nil
+		}
+		if listed[pid] {
+			continue
+		}
+		if _, err := os.Stat(procPath(pid, "")); err == nil && isProcess(pid) {
+			candidates = append(candidates, pid)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Processes started during the probe aren't hidden; list again
+	relisted, err := listPIDs()
+	if err != nil {
+		return nil
+	}
+	var indicators []Indicator
+	for _, pid := range candidates {
+		if relisted[pid] {
+			continue
+		}
+		if _, err := os.Stat(procPath(pid, "")); err != nil {
+			continue
+		}
+		indicators = append(indicators, Indicator{
+			Kind:     IndicatorHiddenPID,
+			PID:      pid,
+			Process:  processName(pid),
+			Detail:   "process exists but is hidden from the /proc listing",
+			Severity: SeverityCritical,
+			Found:    time.Now(),
+		})
+	}
+	return indicators
+}
+
+// isProcess tells processes from threads, which /proc doesn't list but
+// lets you open by thread ID
+func isProcess(pid int) bool {
+	data, err := os.ReadFile(procPath(pid, "status"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "Tgid:"); ok {
+			return strings.TrimSpace(v) == strconv.Itoa(pid)
+		}
+	}
+	return false
+}
+
+// psMismatch finds processes /proc lists but ps doesn't show, a sign of a
+// replaced ps binary or a preload hook filtering its output
+func (s *IndicatorScanner) psMismatch(ctx context.Context, listed map[int]bool) []Indicator {
+	output, err := exec.CommandContext(ctx, "ps", "-eo", "pid=").Output()
+	if err != nil {
+		return nil
+	}
+	shown := make(map[int]bool)
+	for _, field := range strings.Fields(string(output)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			shown[pid] = true
+		}
+	}
+
+	// Processes that exited while ps ran aren't hidden; list again
+	relisted, err := listPIDs()
+	if err != nil {
+		return nil
+	}
+	var indicators []Indicator
+	for pid := range listed {
+		if shown[pid] || !relisted[pid] {
+			continue
+		}
+		indicators = append(indicators, Indicator{
+			Kind:     IndicatorPsMismatch,
+			PID:      pid,
+			Process:  processName(pid),
+			Detail:   "process is listed in /proc but hidden from ps",
+			Severity: SeverityHigh,
+			Found:    time.Now(),
+		})
+	}
+	return indicators
+}
+
+// preloads reports the system-wide preload file and processes started
+// with LD_PRELOAD set to a library that isn't allowed
+func (s *IndicatorScanner) preloads(pids map[int]bool) []Indicator {
+	var indicators []Indicator
+	if data, err := os.ReadFile(ldPreloadFile); err == nil {
+		for _, lib := range strings.Fields(string(data)) {
+			if strings.HasPrefix(lib, "#") || s.allowedPreload(lib) {
+				continue
+			}
+			indicators = append(indicators, Indicator{
+				Kind:     IndicatorPreload,
+				Path:     ldPreloadFile,
+				Detail:   fmt.Sprintf("%s is preloaded into every process", lib),
+				Severity: SeverityCritical,
+				Found:    time.Now(),
+			})
+		}
+	}
+
+	for pid := range pids {
+		data, err := os.ReadFile(procPath(pid, "environ"))
+		if err != nil {
+			continue
+		}
+		for _, env := range strings.Split(string(data), "\x00") {
+			value, ok := strings.CutPrefix(env, "LD_PRELOAD=")
+			if !ok || value == "" {
+				continue
+			}
+			for _, lib := range strings.FieldsFunc(value, func(r rune) bool { return r == ':' || r == ' ' }) {
+				if s.allowedPreload(lib) {
+					continue
+				}
+				indicators = append(indicators, Indicator{
+					Kind:     IndicatorPreload,
+					PID:      pid,
+					Process:  processName(pid),
+					Path:     lib,
+					Detail:   fmt.Sprintf("process was started with LD_PRELOAD=%s", lib),
+					Severity: SeverityHigh,
+					Found:    time.Now(),
+				})
+			}
+		}
+	}
+	return indicators
+}
+
+func (s *IndicatorScanner) allowedPreload(lib string) bool {
+	for _, allowed := range s.config.AllowedPreloads {
+		if lib == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// listeners maps listening sockets to the processes owning them and
+// reports those bound by binaries outside the trusted paths. Sockets no
+// process owns are reported when running as root, since then every
+// process' descriptors are visible.
+func (s *IndicatorScanner) listeners(pids map[int]bool) ([]Indicator, error) {
+	sockets := make(map[string]string) // inode -> protocol and address
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		if err := readListeners(proto, sockets); err != nil {
+			return nil, err
+		}
+	}
+	if len(sockets) == 0 {
+		return nil, nil
+	}
+
+	owners := make(map[string]int)
+	for pid := range pids {
+		fds, err := os.ReadDir(procPath(pid, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(procPath(pid, "fd"), fd.Name()))
+			if err != nil {
+				continue
+			}
+			if inode, ok := strings.CutPrefix(link, "socket:["); ok {
+				inode = strings.TrimSuffix(inode, "]")
+				if _, listening := sockets[inode]; listening {
+					owners[inode] = pid
+				}
+			}
+		}
+	}
+
+	var indicators []Indicator
+	for inode, addr := range sockets {
+		pid, ok := owners[inode]
+		if !ok {
+			if os.Geteuid() == 0 && inode != "0" {
+				indicators = append(indicators, Indicator{
+					Kind:     IndicatorUnknownListener,
+					Path:     addr,
+					Detail:   fmt.Sprintf("%s is bound by no visible process", addr),
+					Severity: SeverityHigh,
+					Found:    time.Now(),
+				})
+			}
+			continue
+		}
+
+		exe, err := os.Readlink(procPath(pid, "exe"))
+		if err != nil {
+			continue
+		}
+		exe = strings.TrimSuffix(exe, " (deleted)")
+		if s.trustedListener(exe) {
+			continue
+		}
+		severity := SeverityMedium
+		if inDirs(exe, suspiciousDirs) || strings.HasPrefix(exe, "/memfd:") {
+			severity = SeverityHigh
+		}
+		indicators = append(indicators, Indicator{
+			Kind:     IndicatorUnknownListener,
+			PID:      pid,
+			Process:  processName(pid),
+			Path:     exe,
+			Detail:   fmt.Sprintf("%s is bound by an untrusted binary", addr),
+			Severity: severity,
+			Found:    time.Now(),
+		})
+	}
+	return indicators, nil
+}
+
+func (s *IndicatorScanner) trustedListener(exe string) bool {
+	for _, allowed := range s.config.AllowedListeners {
+		if exe == allowed {
+			return true
+		}
+	}
+	return inDirs(exe, s.config.TrustedPaths)
+}
+
+// readListeners adds the listening sockets of /proc/net/<proto> to
+// sockets. TCP sockets listen in state 0A; UDP sockets count when
+// unconnected.
+func readListeners(proto string, sockets map[string]string) error {
+	file, err := os.Open(filepath.Join(procRoot, "net", proto))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read sockets: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, remote, state, inode := fields[1], fields[2], fields[3], fields[9]
+		listening := state == "0A"
+		if strings.HasPrefix(proto, "udp") {
+			listening = state == "07" && strings.Trim(remote, "0:") == ""
+		}
+		if listening {
+			sockets[inode] = proto + " " + decodeAddr(local)
+		}
+	}
+	return scanner.Err()
+}
+
+// decodeAddr turns a /proc/net address into host:port
+func decodeAddr(addr string) string {
+	host, port, ok := strings.Cut(addr, ":")
+	if !ok {
+		return addr
+	}
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return addr
+	}
+	if len(host) == 8 {
+		n, err := strconv.ParseUint(host, 16, 32)
+		if err == nil {
+			// Little-endian IPv4
+			return fmt.Sprintf("%d.%d.%d.%d:%d", byte(n), byte(n>>8), byte(n>>16), byte(n>>24), p)
+		}
+	}
+	if strings.Trim(host, "0") == "" {
+		return fmt.Sprintf("[::]:%d", p)
+	}
+	return fmt.Sprintf("[%s]:%d", host, p)
+}
+
+func inDirs(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(path, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package security
+
+import (
+	"context"
+	"fmt"
+)
+
+func (s *IndicatorScanner) scan(ctx context.Context) ([]Indicator, error) {
+	return nil, fmt.Errorf("indicator scans are only supported on Linux")
+}
@@ -0,0 +1,352 @@
+package security
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// RuleTypeAuth marks scan results raised from login telemetry
+const RuleTypeAuth RuleType = "auth"
+
+// maxAuthFailures bounds the failures kept within the window; the oldest
+// are dropped
+const maxAuthFailures = 10000
+
+// maxAuthLogTail is how much of an auth log is read the first time, so
+// that failures from before a restart still count
+const maxAuthLogTail = 1024 * 1024
+
+// LoginConfig tunes login telemetry and brute-force detection
+type LoginConfig struct {
+	// Interval between scheduled checks; 0 only checks on demand
+	Interval time.Duration `json:"interval"`
+	// Window is how far back authentication failures are counted
+	Window time.Duration `json:"window"`
+	// Threshold is the failures from one source within the window that
+	// make a brute-force attempt
+	Threshold int `json:"threshold"`
+	// AuthLogs are the syslog files sshd logs to. The btmp file is read
+	// instead when none of them exists.
+	AuthLogs []string `json:"auth_logs"`
+	// RecentLogins is how many of the latest logins are reported
+	RecentLogins int `json:"recent_logins"`
+}
+
+// DefaultLoginConfig checks every minute and flags sources failing 20
+// times within 10 minutes
+var DefaultLoginConfig = LoginConfig{
+	Interval:     time.Minute,
+	Window:       10 * time.Minute,
+	Threshold:    20,
+	AuthLogs:     []string{"/var/log/auth.log", "/var/log/secure"},
+	RecentLogins: 20,
+}
+
+// Session is a user logged in now, as who would list
+type Session struct {
+	User    string    `json:"user"`
+	Line    string    `json:"line"`
+	Host    string    `json:"host,omitempty"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// Login is a past login, as last would list
+type Login struct {
+	User string    `json:"user"`
+	Line string    `json:"line"`
+	Host string    `json:"host,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// FailureSource sums the authentication failures of one remote address
+type FailureSource struct {
+	Source   string    `json:"source"`
+	Failures int       `json:"failures"`
+	Users    []string  `json:"users"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+}
+
+// LoginReport is the login activity of the host
+type LoginReport struct {
+	Sessions     []Session `json:"sessions"`
+	RecentLogins []Login   `json:"recent_logins"`
+	// Failures are the authentication failures within Window, and
+	// FailureRate their rate per minute
+	Failures    int             `json:"failures"`
+	FailureRate float64         `json:"failure_rate"`
+	Window      time.Duration   `json:"window"`
+	Sources     []FailureSource `json:"sources,omitempty"`
+	// BruteForce are the sources at or over the threshold
+	BruteForce []string  `json:"brute_force,omitempty"`
+	Checked    time.Time `json:"checked"`
+}
+
+// authFailure is one failed authentication
+type authFailure struct {
+	time   time.Time
+	user   string
+	source string
+}
+
+// authFailurePattern matches the failures sshd logs
+var authFailurePattern = regexp.MustCompile(`sshd\[\d+\]: Failed \S+ for (?:invalid user )?(\S*) from (\S+)`)
+
+// LoginMonitor reports sessions, recent logins and SSH authentication
+// failures, and flags the sources brute-forcing the host
+type LoginMonitor struct {
+	logger *zap.Logger
+	config LoginConfig
+
+	mu       sync.Mutex
+	failures []authFailure
+	// offsets are how far each auth log was read
+	offsets map[string]int64
+	// btmpSeen is the time of the latest btmp record read
+	btmpSeen time.Time
+}
+
+// NewLoginMonitor creates a login monitor
+func NewLoginMonitor(logger *zap.Logger, config LoginConfig) *LoginMonitor {
+	if config.Window <= 0 {
+		config.Window = DefaultLoginConfig.Window
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultLoginConfig.Threshold
+	}
+	if config.AuthLogs == nil {
+		config.AuthLogs = DefaultLoginConfig.AuthLogs
+	}
+	if config.RecentLogins <= 0 {
+		config.RecentLogins = DefaultLoginConfig.RecentLogins
+	}
+	return &LoginMonitor{
+		logger:  logger,
+		config:  config,
+		offsets: make(map[string]int64),
+	}
+}
+
+// Report reads the new authentication failures and returns the login
+// activity
+func (m *LoginMonitor) Report(ctx context.Context) (*LoginReport, error) {
+	now := time.Now()
+	report := &LoginReport{Window: m.config.Window, Checked: now}
+
+	var err error
+	if report.Sessions, err = sessions(); err != nil {
+		return nil, err
+	}
+	if report.RecentLogins, err = recentLogins(m.config.RecentLogins); err != nil {
+		m.logger.Debug("Failed to read recent logins", zap.Error(err))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readFailures(now)
+
+	bySource := make(map[string]*FailureSource)
+	for _, f := range m.failures {
+		source := bySource[f.source]
+		if source == nil {
+			source = &FailureSource{Source: f.source, First: f.time}
+			bySource[f.source] = source
+		}
+		source.Failures++
+		source.Last = f.time
+		if f.user != "" && !containsString(source.Users, f.user) {
+			source.Users = append(source.Users, f.user)
+		}
+	}
+	report.Failures = len(m.failures)
+	report.FailureRate = float64(report.Failures) / m.config.Window.Minutes()
+	for _, source := range bySource {
+		sort.Strings(source.Users)
+		report.Sources = append(report.Sources, *source)
+		if source.Failures >= m.config.Threshold {
+			report.BruteForce = append(report.BruteForce, source.Source)
+		}
+	}
+	sort.Slice(report.Sources, func(i, j int) bool {
+		if report.Sources[i].Failures != report.Sources[j].Failures {
+			return report.Sources[i].Failures > report.Sources[j].Failures
+		}
+		return report.Sources[i].Source < report.Sources[j].Source
+	})
+	sort.Strings(report.BruteForce)
+	return report, nil
+}
+
+// Results checks the login activity and returns the brute-force sources
+// as scan results. A source that also logged in successfully is critical.
+func (m *LoginMonitor) Results(ctx context.Context) ([]ScanResult, error) {
+	report, err := m.Report(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ScanResult, 0, len(report.BruteForce))
+	for _, source := range report.BruteForce {
+		result := ScanResult{
+			Path:     "ssh:" + source,
+			RuleType: RuleTypeAuth,
+			Message:  "SSH brute force: repeated authentication failures",
+			Severity: SeverityHigh,
+		}
+		for _, login := range report.RecentLogins {
+			if login.Host == source && !login.Time.Before(report.Checked.Add(-report.Window)) {
+				result.Message = fmt.Sprintf("SSH brute force followed by a login as %s", login.User)
+				result.Severity = SeverityCritical
+				break
+			}
+		}
+		m.logger.Warn("SSH brute force detected",
+			zap.String("source", source),
+			zap.String("severity", result.Severity))
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// HandleCommand processes login commands
+func (m *LoginMonitor) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "security:logins":
+		return m.Report(ctx)
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown security command: %s", cmd)
+	}
+}
+
+// readFailures adds the failures logged since the last read and drops
+// those outside the window. The caller holds mu.
+func (m *LoginMonitor) readFailures(now time.Time) {
+	read := false
+	for _, path := range m.config.AuthLogs {
+		failures, err := m.readAuthLog(path, now)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			m.logger.Warn("Failed to read auth log", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		read = true
+		m.failures = append(m.failures, failures...)
+	}
+	if !read {
+		// Hosts logging to the journal only still record failures in btmp
+		failures, err := failedLogins(m.btmpSeen)
+		if err != nil {
+			m.logger.Debug("Failed to read failed logins", zap.Error(err))
+		}
+		for _, f := range failures {
+			if f.time.After(m.btmpSeen) {
+				m.btmpSeen = f.time
+			}
+		}
+		m.failures = append(m.failures, failures...)
+	}
+
+	sort.SliceStable(m.failures, func(i, j int) bool { return m.failures[i].time.Before(m.failures[j].time) })
+	cutoff := now.Add(-m.config.Window)
+	first := sort.Search(len(m.failures), func(i int) bool { return !m.failures[i].time.Before(cutoff) })
+	if drop := len(m.failures) - maxAuthFailures; drop > first {
+		first = drop
+	}
+	m.failures = append([]authFailure(nil), m.failures[first:]...)
+}
+
+// readAuthLog returns the failures logged to path since the last read.
+// A log smaller than the last offset was rotated and is read again from
+// the start.
+func (m *LoginMonitor) readAuthLog(path string, now time.Time) ([]authFailure, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset, seen := m.offsets[path]
+	if !seen {
+		offset = max(0, info.Size()-maxAuthLogTail)
+	} else if info.Size() < offset {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var failures []authFailure
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// A partial last line is read again once complete
+			break
+		}
+		offset += int64(len(line))
+		match := authFailurePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		failures = append(failures, authFailure{
+			time:   syslogTime(line, now),
+			user:   match[1],
+			source: match[2],
+		})
+	}
+	m.offsets[path] = offset
+	return failures, nil
+}
+
+// syslogTime parses the timestamp a syslog line starts with, either
+// RFC 3339 or the classic format without a year. Lines without one are
+// taken as logged now.
+func syslogTime(line string, now time.Time) time.Time {
+	if len(line) >= 25 {
+		if i := strings.IndexByte(line, ' '); i > 0 {
+			if t, err := time.Parse(time.RFC3339Nano, line[:i]); err == nil {
+				return t
+			}
+		}
+	}
+	if len(line) < 15 {
+		return now
+	}
+	t, err := time.ParseInLocation(time.Stamp, line[:15], now.Location())
+	if err != nil {
+		return now
+	}
+	t = t.AddDate(now.Year(), 0, 0)
+	// Lines from December read in January belong to the last year
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
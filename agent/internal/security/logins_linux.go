@@ -0,0 +1,157 @@
+package security
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Login accounting files
+const (
+	utmpPath = "/var/run/utmp"
+	wtmpPath = "/var/log/wtmp"
+	btmpPath = "/var/log/btmp"
+)
+
+// utmp record layout, the same on every Linux architecture glibc
+// supports with 32-bit times
+const (
+	utmpSize        = 384
+	utmpUserProcess = 7
+)
+
+// utmpRecord is a decoded login record
+type utmpRecord struct {
+	kind int16
+	pid  int32
+	line string
+	user string
+	host string
+	time time.Time
+}
+
+// sessions lists the user processes recorded in utmp that still run
+func sessions() ([]Session, error) {
+	records, err := readUtmp(utmpPath, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read sessions: %w", err)
+	}
+	var result []Session
+	for _, r := range records {
+		if r.kind != utmpUserProcess || !processAlive(int(r.pid)) {
+			continue
+		}
+		result = append(result, Session{User: r.user, Line: r.line, Host: r.host, PID: int(r.pid), Started: r.time})
+	}
+	return result, nil
+}
+
+// recentLogins returns the latest logins recorded in wtmp, newest first
+func recentLogins(limit int) ([]Login, error) {
+	records, err := readUtmp(wtmpPath, limit*4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wtmp: %w", err)
+	}
+	var logins []Login
+	for i := len(records) - 1; i >= 0 && len(logins) < limit; i-- {
+		if r := records[i]; r.kind == utmpUserProcess {
+			logins = append(logins, Login{User: r.user, Line: r.line, Host: r.host, Time: r.time})
+		}
+	}
+	return logins, nil
+}
+
+// failedLogins returns the failures recorded in btmp after since
+func failedLogins(since time.Time) ([]authFailure, error) {
+	records, err := readUtmp(btmpPath, maxAuthFailures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read btmp: %w", err)
+	}
+	var failures []authFailure
+	for _, r := range records {
+		if r.time.After(since) && r.host != "" {
+			failures = append(failures, authFailure{time: r.time, user: r.user, source: r.host})
+		}
+	}
+	return failures, nil
+}
+
+// readUtmp decodes the records of a utmp file, only the last limit of
+// them if limit is positive
+func readUtmp(path string, limit int) ([]utmpRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := int64(0)
+	if size := info.Size() - info.Size()%utmpSize; limit > 0 && size > int64(limit)*utmpSize {
+		offset = size - int64(limit)*utmpSize
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var records []utmpRecord
+	buf := make([]byte, utmpSize)
+	for {
+		if _, err := io.ReadFull(f, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return records, nil
+			}
+			return nil, err
+		}
+		records = append(records, decodeUtmp(buf))
+	}
+}
+
+// decodeUtmp decodes a record: type, pid, line[32], id[4], user[32],
+// host[256], exit, session, tv and the address
+func decodeUtmp(buf []byte) utmpRecord {
+	r := utmpRecord{
+		kind: int16(binary.LittleEndian.Uint16(buf[0:])),
+		pid:  int32(binary.LittleEndian.Uint32(buf[4:])),
+		line: cString(buf[8:40]),
+		user: cString(buf[44:76]),
+		host: cString(buf[76:332]),
+		time: time.Unix(int64(int32(binary.LittleEndian.Uint32(buf[340:]))), int64(int32(binary.LittleEndian.Uint32(buf[344:])))*1000),
+	}
+	// Records may hold only the address of the remote host
+	if addr := buf[348:364]; r.host == "" && !bytes.Equal(addr, make([]byte, 16)) {
+		if bytes.Equal(addr[4:], make([]byte, 12)) {
+			r.host = net.IP(addr[:4]).String()
+		} else {
+			r.host = net.IP(addr).String()
+		}
+	}
+	return r
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// processAlive reports whether pid is a running process
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	_, err := os.Stat("/proc/" + strconv.Itoa(pid))
+	return err == nil
+}
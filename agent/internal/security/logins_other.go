@@ -0,0 +1,20 @@
+//go:build !linux
+
+package security
+
+import (
+	"fmt"
+	"time"
+)
+
+func sessions() ([]Session, error) {
+	return nil, fmt.Errorf("login sessions are only supported on Linux")
+}
+
+func recentLogins(limit int) ([]Login, error) {
+	return nil, fmt.Errorf("recent logins are only supported on Linux")
+}
+
+func failedLogins(since time.Time) ([]authFailure, error) {
+	return nil, fmt.Errorf("failed logins are only supported on Linux")
+}
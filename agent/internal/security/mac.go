@@ -0,0 +1,402 @@
+package security
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Mandatory access control systems
+const (
+	MACSELinux  = "selinux"
+	MACAppArmor = "apparmor"
+	MACNone     = "none"
+)
+
+const (
+	selinuxFS    = "/sys/fs/selinux"
+	selinuxConf  = "/etc/selinux/config"
+	apparmorFS   = "/sys/kernel/security/apparmor"
+	apparmorFlag = "/sys/module/apparmor/parameters/enabled"
+)
+
+// MAC modes
+const (
+	MACEnforcing  = "enforcing"
+	MACPermissive = "permissive"
+	MACDisabled   = "disabled"
+	// AppArmor calls permissive mode complain
+	MACComplain = "complain"
+)
+
+// maxAuditRead bounds how much of the end of an audit log is searched for
+// denials
+const maxAuditRead = 8 * 1024 * 1024
+
+// MACConfig configures MAC reporting
+type MACConfig struct {
+	// AllowToggle permits switching between enforcing and permissive
+	AllowToggle bool `json:"allow_toggle"`
+	// AuditLogs are searched for denials; the first one that exists is used
+	AuditLogs []string `json:"audit_logs"`
+	// DenialWindow is how far back denials are reported
+	DenialWindow time.Duration `json:"denial_window"`
+	// MaxDenials bounds the denials reported, keeping the most recent
+	MaxDenials int `json:"max_denials"`
+}
+
+// DefaultMACConfig reports the last day of denials and doesn't allow
+// toggling enforcement
+var DefaultMACConfig = MACConfig{
+	AuditLogs:    []string{"/var/log/audit/audit.log", "/var/log/kern.log", "/var/log/syslog", "/var/log/messages"},
+	DenialWindow: 24 * time.Hour,
+	MaxDenials:   50,
+}
+
+// MACProfile is a loaded AppArmor profile
+type MACProfile struct {
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+}
+
+// MACDenial is an access the MAC policy denied
+type MACDenial struct {
+	Time      time.Time `json:"time"`
+	System    string    `json:"system"`
+	Operation string    `json:"operation"`
+	// Subject is the SELinux source context or the AppArmor profile
+	Subject string `json:"subject"`
+	Target  string `json:"target,omitempty"`
+	Class   string `json:"class,omitempty"`
+	Process string `json:"process,omitempty"`
+	PID     int    `json:"pid,omitempty"`
+	// Permissive is set when the access was only logged, not denied
+	Permissive bool `json:"permissive,omitempty"`
+}
+
+// MACStatus is the state of mandatory access control on the host
+type MACStatus struct {
+	System string `json:"system"`
+	// Mode is the current mode; for AppArmor it's per profile
+	Mode string `json:"mode"`
+	// ConfiguredMode is the mode applied at boot, if it differs from the
+	// running one
+	ConfiguredMode string       `json:"configured_mode,omitempty"`
+	Policy         string       `json:"policy,omitempty"`
+	Profiles       []MACProfile `json:"profiles,omitempty"`
+	// ProfileModes counts the loaded profiles by mode
+	ProfileModes map[string]int `json:"profile_modes,omitempty"`
+	Denials      []MACDenial    `json:"denials,omitempty"`
+	DenialSource string         `json:"denial_source,omitempty"`
+	CollectedAt  time.Time      `json:"collected_at"`
+}
+
+// MACReporter reports SELinux and AppArmor status and recent denials
+type MACReporter struct {
+	logger *zap.Logger
+	config MACConfig
+}
+
+// NewMACReporter creates a MAC reporter
+func NewMACReporter(logger *zap.Logger, config MACConfig) *MACReporter {
+	if len(config.AuditLogs) == 0 {
+		config.AuditLogs = DefaultMACConfig.AuditLogs
+	}
+	if config.DenialWindow <= 0 {
+		config.DenialWindow = DefaultMACConfig.DenialWindow
+	}
+	if config.MaxDenials <= 0 {
+		config.MaxDenials = DefaultMACConfig.MaxDenials
+	}
+	return &MACReporter{
+		logger: logger,
+		config: config,
+	}
+}
+
+// Status collects the MAC status of the host
+func (r *MACReporter) Status(ctx context.Context) (*MACStatus, error) {
+	status := &MACStatus{System: MACNone, Mode: MACDisabled, CollectedAt: time.Now()}
+	switch {
+	case selinuxMounted():
+		if err := selinuxStatus(status); err != nil {
+			return nil, err
+		}
+	case apparmorEnabled():
+		if err := apparmorStatus(status); err != nil {
+			return nil, err
+		}
+	default:
+		// SELinux configured but disabled at boot
+		if mode := selinuxConfigValue("SELINUX"); mode != "" {
+			status.System = MACSELinux
+			status.ConfiguredMode = mode
+			status.Policy = selinuxConfigValue("SELINUXTYPE")
+		}
+		return status, nil
+	}
+
+	denials, source, err := r.denials(ctx, status.System)
+	if err != nil {
+		r.logger.Warn("Failed to read MAC denials", zap.Error(err))
+	}
+	status.Denials = denials
+	status.DenialSource = source
+	return status, nil
+}
+
+// SetMode switches SELinux between enforcing and permissive, or an
+// AppArmor profile between enforce and complain. SELinux changes only
+// last until reboot; a disabled SELinux can't be enabled at runtime.
+func (r *MACReporter) SetMode(ctx context.Context, mode, profile string) error {
+	if !r.config.AllowToggle {
+		return fmt.Errorf("changing the MAC mode is not permitted by the agent configuration")
+	}
+	switch mode {
+	case MACEnforcing, "enforce":
+		mode = MACEnforcing
+	case MACPermissive, MACComplain:
+		mode = MACPermissive
+	default:
+		return fmt.Errorf("unknown MAC mode: %s", mode)
+	}
+
+	switch {
+	case selinuxMounted():
+		value := "0"
+		if mode == MACEnforcing {
+			value = "1"
+		}
+		if err := os.WriteFile(selinuxFS+"/enforce", []byte(value), 0644); err != nil {
+			return fmt.Errorf("failed to set SELinux mode: %w", err)
+		}
+	case apparmorEnabled():
+		if profile == "" {
+			return fmt.Errorf("an AppArmor profile is required")
+		}
+		tool := "aa-complain"
+		if mode == MACEnforcing {
+			tool = "aa-enforce"
+		}
+		if output, err := exec.CommandContext(ctx, tool, profile).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set AppArmor mode: %s: %w", strings.TrimSpace(string(output)), err)
+		}
+	default:
+		if selinuxConfigValue("SELINUX") != "" {
+			return fmt.Errorf("SELinux is disabled; enabling it requires a reboot")
+		}
+		return fmt.Errorf("no MAC system is enabled")
+	}
+
+	r.logger.Warn("MAC mode changed", zap.String("mode", mode), zap.String("profile", profile))
+	return nil
+}
+
+// HandleCommand processes MAC commands
+func (r *MACReporter) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "security:mac":
+		return r.Status(ctx)
+	case "security:mac_mode":
+		if len(args) < 1 {
+			return nil, fmt.Errorf("usage: security:mac_mode <enforcing|permissive> [profile]")
+		}
+		profile := ""
+		if len(args) > 1 {
+			profile = args[1]
+		}
+		if err := r.SetMode(ctx, args[0], profile); err != nil {
+			return nil, err
+		}
+		return r.Status(ctx)
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown security command: %s", cmd)
+	}
+}
+
+func selinuxMounted() bool {
+	_, err := os.Stat(selinuxFS + "/enforce")
+	return err == nil
+}
+
+func apparmorEnabled() bool {
+	data, err := os.ReadFile(apparmorFlag)
+	return err == nil && strings.TrimSpace(string(data)) == "Y"
+}
+
+func selinuxStatus(status *MACStatus) error {
+	data, err := os.ReadFile(selinuxFS + "/enforce")
+	if err != nil {
+		return fmt.Errorf("failed to read SELinux mode: %w", err)
+	}
+	status.System = MACSELinux
+	status.Mode = MACPermissive
+	if strings.TrimSpace(string(data)) == "1" {
+		status.Mode = MACEnforcing
+	}
+	if mode := selinuxConfigValue("SELINUX"); mode != "" && mode != status.Mode {
+		status.ConfiguredMode = mode
+	}
+	status.Policy = selinuxConfigValue("SELINUXTYPE")
+	if version, err := os.ReadFile(selinuxFS + "/policyvers"); err == nil {
+		status.Policy = strings.TrimSpace(status.Policy + " v" + strings.TrimSpace(string(version)))
+	}
+	return nil
+}
+
+// selinuxConfigValue reads a setting of the SELinux boot configuration
+func selinuxConfigValue(key string) string {
+	lines, err := os.ReadFile(selinuxConf)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(lines), "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), key+"="); ok {
+			return strings.ToLower(strings.Trim(value, `"'`))
+		}
+	}
+	return ""
+}
+
+func apparmorStatus(status *MACStatus) error {
+	status.System = MACAppArmor
+	status.Mode = "enabled"
+	data, err := os.ReadFile(apparmorFS + "/profiles")
+	if err != nil {
+		return fmt.Errorf("failed to read AppArmor profiles: %w", err)
+	}
+	status.ProfileModes = make(map[string]int)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// Lines look like "/usr/sbin/cupsd (enforce)"
+		name, mode := line, ""
+		if i := strings.LastIndex(line, " ("); i >= 0 && strings.HasSuffix(line, ")") {
+			name, mode = line[:i], line[i+2:len(line)-1]
+		}
+		status.Profiles = append(status.Profiles, MACProfile{Name: name, Mode: mode})
+		status.ProfileModes[mode]++
+	}
+	sort.Slice(status.Profiles, func(i, j int) bool { return status.Profiles[i].Name < status.Profiles[j].Name })
+	return nil
+}
+
+var (
+	auditFieldPattern = regexp.MustCompile(`(\w+)=("[^"]*"|\S+)`)
+	auditTimePattern  = regexp.MustCompile(`audit\((\d+)\.(\d+):\d+\)`)
+	avcPermsPattern   = regexp.MustCompile(`denied\s+\{([^}]*)\}`)
+)
+
+// denials returns the recent denials from the first audit log found,
+// newest last
+func (r *MACReporter) denials(ctx context.Context, system string) ([]MACDenial, string, error) {
+	for _, path := range r.config.AuditLogs {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, path, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer file.Close()
+
+		if info, err := file.Stat(); err == nil && info.Size() > maxAuditRead {
+			if _, err := file.Seek(-maxAuditRead, io.SeekEnd); err != nil {
+				return nil, path, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+		}
+
+		since := time.Now().Add(-r.config.DenialWindow)
+		var denials []MACDenial
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if ctx.Err() != nil {
+				return nil, path, ctx.Err()
+			}
+			d, ok := parseDenial(scanner.Text(), system)
+			if !ok || (!d.Time.IsZero() && d.Time.Before(since)) {
+				continue
+			}
+			denials = append(denials, d)
+		}
+		if len(denials) > r.config.MaxDenials {
+			denials = denials[len(denials)-r.config.MaxDenials:]
+		}
+		return denials, path, scanner.Err()
+	}
+	return nil, "", nil
+}
+
+// parseDenial parses an SELinux AVC or AppArmor denial from an audit or
+// kernel log line
+func parseDenial(line, system string) (MACDenial, bool) {
+	var d MACDenial
+	switch {
+	case system == MACSELinux && strings.Contains(line, "avc:") && strings.Contains(line, "denied"):
+		fields := auditFields(line)
+		d = MACDenial{
+			System:     MACSELinux,
+			Subject:    fields["scontext"],
+			Target:     firstNonEmpty(fields["path"], fields["name"], fields["tcontext"]),
+			Class:      fields["tclass"],
+			Process:    fields["comm"],
+			Permissive: fields["permissive"] == "1",
+		}
+		if m := avcPermsPattern.FindStringSubmatch(line); m != nil {
+			d.Operation = strings.TrimSpace(m[1])
+		}
+		d.PID, _ = strconv.Atoi(fields["pid"])
+	case system == MACAppArmor && (strings.Contains(line, `apparmor="DENIED"`) || strings.Contains(line, `apparmor="ALLOWED"`)):
+		fields := auditFields(line)
+		d = MACDenial{
+			System:     MACAppArmor,
+			Operation:  fields["operation"],
+			Subject:    fields["profile"],
+			Target:     fields["name"],
+			Class:      fields["denied_mask"],
+			Process:    fields["comm"],
+			Permissive: fields["apparmor"] == "ALLOWED",
+		}
+		d.PID, _ = strconv.Atoi(fields["pid"])
+	default:
+		return d, false
+	}
+	if m := auditTimePattern.FindStringSubmatch(line); m != nil {
+		sec, _ := strconv.ParseInt(m[1], 10, 64)
+		msec, _ := strconv.ParseInt(m[2], 10, 64)
+		d.Time = time.Unix(sec, msec*int64(time.Millisecond))
+	}
+	return d, true
+}
+
+func auditFields(line string) map[string]string {
+	fields := make(map[string]string)
+	for _, m := range auditFieldPattern.FindAllStringSubmatch(line, -1) {
+		fields[m[1]] = strings.Trim(m[2], `"`)
+	}
+	return fields
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package security
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the uid and gid owning a file
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// chmodNoFollow changes the mode of the file walked as info. Regular files
+// and directories are changed through a descriptor opened without
+// following symlinks, in case path was replaced by one since.
+func chmodNoFollow(path string, info os.FileInfo, mode os.FileMode) error {
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return os.Chmod(path, mode)
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Chmod(mode)
+}
@@ -0,0 +1,13 @@
+package security
+
+import "os"
+
+// fileOwner is unsupported on Windows, where ownership rules never match
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
+
+// chmodNoFollow changes the mode of path
+func chmodNoFollow(path string, info os.FileInfo, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
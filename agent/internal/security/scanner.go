@@ -1,10 +1,16 @@
 package security
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -12,30 +18,62 @@ import (
 type RuleType string
 
 const (
-	RuleTypePermission RuleType = "permission"
-	RuleTypeOwnership RuleType = "ownership"
-	RuleTypeContent   RuleType = "content"
+	RuleTypePermission    RuleType = "permission"
+	RuleTypeOwnership     RuleType = "ownership"
+	RuleTypeContent       RuleType = "content"
+	RuleTypeVulnerability RuleType = "vulnerability"
 )
 
+// Severities
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// defaultMaxContentSize bounds the files content rules read
+const defaultMaxContentSize = 1024 * 1024
+
 type Rule struct {
-	Type        RuleType `json:"type"`
-	Target      string   `json:"target"`
-	Permission  os.FileMode `json:"permission,omitempty"`
-	Owner       string   `json:"owner,omitempty"`
-	Group       string   `json:"group,omitempty"`
-	Pattern     string   `json:"pattern,omitempty"`
+	Type       RuleType    `json:"type"`
+	Target     string      `json:"target"`
+	Permission os.FileMode `json:"permission,omitempty"`
+	// Owner and Group are names or numeric ids
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	// Pattern is a regular expression that content rules report matches of
+	Pattern string `json:"pattern,omitempty"`
+	// MaxSize skips larger files in content rules; 0 means 1MB
+	MaxSize int64 `json:"max_size,omitempty"`
+	// Severity of findings; defaults to high, or medium for content rules
+	Severity string `json:"severity,omitempty"`
+	// Remediate fixes permission and ownership findings instead of only
+	// reporting them
+	Remediate bool `json:"remediate,omitempty"`
 }
 
 type ScanConfig struct {
 	Paths []string `json:"paths"`
 	Rules []Rule   `json:"rules"`
+	// Interval between scheduled scans; 0 only scans on demand
+	Interval time.Duration `json:"interval,omitempty"`
 }
 
 type ScanResult struct {
-	Path     string `json:"path"`
-	RuleType RuleType `json:"rule_type"`
-	Message  string `json:"message"`
-	Severity string `json:"severity"`
+	Path       string   `json:"path"`
+	RuleType   RuleType `json:"rule_type"`
+	Message    string   `json:"message"`
+	Severity   string   `json:"severity"`
+	Remediated bool     `json:"remediated,omitempty"`
+}
+
+// compiledRule is a rule with its names resolved and pattern compiled
+type compiledRule struct {
+	Rule
+	uid     int
+	gid     int
+	pattern *regexp.Regexp
 }
 
 type Scanner struct {
@@ -53,7 +91,17 @@ func (s *Scanner) Configure(config ScanConfig) {
 	s.config = config
 }
 
+// Scan walks the paths and checks every file against the rules. Rules
+// default to the configured ones.
 func (s *Scanner) Scan(ctx context.Context, config ScanConfig) ([]ScanResult, error) {
+	if len(config.Rules) == 0 {
+		config.Rules = s.config.Rules
+	}
+	rules, err := compileRules(config.Rules)
+	if err != nil {
+		return nil, err
+	}
+
 	var results []ScanResult
 
 	for _, path := range config.Paths {
@@ -61,8 +109,11 @@ func (s *Scanner) Scan(ctx context.Context, config ScanConfig) ([]ScanResult, er
 			if err != nil {
 				return err
 			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-			for _, rule := range config.Rules {
+			for _, rule := range rules {
 				matched, err := filepath.Match(rule.Target, filepath.Base(path))
 				if err != nil {
 					s.logger.Error("Invalid pattern", zap.String("pattern", rule.Target), zap.Error(err))
@@ -73,23 +124,17 @@ func (s *Scanner) Scan(ctx context.Context, config ScanConfig) ([]ScanResult, er
 					continue
 				}
 
+				var result *ScanResult
 				switch rule.Type {
 				case RuleTypePermission:
-					if info.Mode().Perm() != rule.Permission {
-						results = append(results, ScanResult{
-							Path:     path,
-							RuleType: RuleTypePermission,
-							Message:  fmt.Sprintf("Invalid permissions: %v (expected %v)", info.Mode().Perm(), rule.Permission),
-							Severity: "high",
-						})
-					}
+					result = s.checkPermission(path, info, rule)
 				case RuleTypeOwnership:
-					// Ownership checks would go here
-					// This would require platform-specific implementations
-					continue
+					result = s.checkOwnership(path, info, rule)
 				case RuleTypeContent:
-					// Content pattern matching would go here
-					continue
+					result = s.checkContent(path, info, rule)
+				}
+				if result != nil {
+					results = append(results, *result)
 				}
 			}
 
@@ -104,6 +149,186 @@ func (s *Scanner) Scan(ctx context.Context, config ScanConfig) ([]ScanResult, er
 	return results, nil
 }
 
+// checkPermission reports a file whose mode differs from the rule's.
+// Symlinks are skipped: their own mode means nothing and chmod would
+// change the file they point to.
+func (s *Scanner) checkPermission(path string, info os.FileInfo, rule compiledRule) *ScanResult {
+	if info.Mode()&os.ModeSymlink != 0 || info.Mode().Perm() == rule.Permission {
+		return nil
+	}
+	result := &ScanResult{
+		Path:     path,
+		RuleType: RuleTypePermission,
+		Message:  fmt.Sprintf("Invalid permissions: %v (expected %v)", info.Mode().Perm(), rule.Permission),
+		Severity: rule.Severity,
+	}
+	if rule.Remediate {
+		if err := chmodNoFollow(path, info, rule.Permission); err != nil {
+			s.logger.Error("Failed to fix permissions", zap.String("path", path), zap.Error(err))
+		} else {
+			result.Remediated = true
+			s.logger.Info("Fixed permissions", zap.String("path", path), zap.Stringer("mode", rule.Permission))
+		}
+	}
+	return result
+}
+
+func (s *Scanner) checkOwnership(path string, info os.FileInfo, rule compiledRule) *ScanResult {
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return nil
+	}
+	wantUID, wantGID := uid, gid
+	if rule.Owner != "" {
+		wantUID = rule.uid
+	}
+	if rule.Group != "" {
+		wantGID = rule.gid
+	}
+	if uid == wantUID && gid == wantGID {
+		return nil
+	}
+
+	result := &ScanResult{
+		Path:     path,
+		RuleType: RuleTypeOwnership,
+		Message: fmt.Sprintf("Invalid ownership: %s:%s (expected %s:%s)",
+			userName(uid), groupName(gid), userName(wantUID), groupName(wantGID)),
+		Severity: rule.Severity,
+	}
+	if rule.Remediate {
+		if err := os.Lchown(path, wantUID, wantGID); err != nil {
+			s.logger.Error("Failed to fix ownership", zap.String("path", path), zap.Error(err))
+		} else {
+			result.Remediated = true
+			s.logger.Info("Fixed ownership", zap.String("path", path),
+				zap.Int("uid", wantUID), zap.Int("gid", wantGID))
+		}
+	}
+	return result
+}
+
+// checkContent reports the first line of a file matching the rule's
+// pattern. Files over the size limit and binary files are skipped.
+func (s *Scanner) checkContent(path string, info os.FileInfo, rule compiledRule) *ScanResult {
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	if info.Size() > rule.MaxSize {
+		s.logger.Debug("Skipping large file", zap.String("path", path), zap.Int64("size", info.Size()))
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.logger.Warn("Failed to read file", zap.String("path", path), zap.Error(err))
+		return nil
+	}
+	if bytes.IndexByte(data[:min(len(data), 512)], 0) >= 0 {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if rule.pattern.Match(scanner.Bytes()) {
+			return &ScanResult{
+				Path:     path,
+				RuleType: RuleTypeContent,
+				Message:  fmt.Sprintf("Content matches %q at line %d", rule.Pattern, line),
+				Severity: rule.Severity,
+			}
+		}
+	}
+	return nil
+}
+
+// compileRules checks the rules, resolves owner and group names and
+// compiles content patterns
+func compileRules(rules []Rule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c := compiledRule{Rule: rule}
+		if c.Severity == "" {
+			c.Severity = SeverityHigh
+			if rule.Type == RuleTypeContent {
+				c.Severity = SeverityMedium
+			}
+		}
+
+		var err error
+		switch rule.Type {
+		case RuleTypeOwnership:
+			if rule.Owner == "" && rule.Group == "" {
+				return nil, fmt.Errorf("ownership rule for %s needs an owner or group", rule.Target)
+			}
+			if rule.Owner != "" {
+				if c.uid, err = lookupUID(rule.Owner); err != nil {
+					return nil, err
+				}
+			}
+			if rule.Group != "" {
+				if c.gid, err = lookupGID(rule.Group); err != nil {
+					return nil, err
+				}
+			}
+		case RuleTypeContent:
+			if rule.Pattern == "" {
+				return nil, fmt.Errorf("content rule for %s needs a pattern", rule.Target)
+			}
+			if c.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+				return nil, fmt.Errorf("invalid content pattern %q: %w", rule.Pattern, err)
+			}
+			if c.MaxSize <= 0 {
+				c.MaxSize = defaultMaxContentSize
+			}
+			if rule.Remediate {
+				return nil, fmt.Errorf("content rule for %s cannot be remediated", rule.Target)
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+func lookupUID(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve user %s: %w", name, err)
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+func lookupGID(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve group %s: %w", name, err)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// userName returns the name of a uid, or the uid if it has none
+func userName(uid int) string {
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return u.Username
+	}
+	return strconv.Itoa(uid)
+}
+
+// groupName returns the name of a gid, or the gid if it has none
+func groupName(gid int) string {
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		return g.Name
+	}
+	return strconv.Itoa(gid)
+}
+
 func (s *Scanner) HealthCheck(ctx context.Context) error {
 	return nil
 }
@@ -0,0 +1,460 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/store"
+	"shh/agent/internal/tasks"
+)
+
+// ScheduleConfig configures scheduled scans
+type ScheduleConfig struct {
+	// HistoryDir stores the findings and reports of every job
+	HistoryDir string `json:"history_dir"`
+	// Keep is how many reports are kept per job
+	Keep int `json:"keep"`
+}
+
+// DefaultScheduleConfig keeps the last 50 reports of every job
+var DefaultScheduleConfig = ScheduleConfig{
+	HistoryDir: "/var/lib/agent/security",
+	Keep:       50,
+}
+
+// ScanJob is a scan run on a schedule
+type ScanJob struct {
+	Name string
+	// Interval between runs; 0 only runs the job on demand
+	Interval time.Duration
+	Run      func(ctx context.Context) ([]ScanResult, error)
+}
+
+// ScanReport is the difference between a scan and the one before it.
+// The first scan of a job reports every finding as new.
+type ScanReport struct {
+	ID        string        `json:"id"`
+	Job       string        `json:"job"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Total     int           `json:"total"`
+	New       []ScanResult  `json:"new,omitempty"`
+	Resolved  []ScanResult  `json:"resolved,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// ScanStatus describes a scheduled job
+type ScanStatus struct {
+	Job      string        `json:"job"`
+	Interval time.Duration `json:"interval"`
+	LastRun  time.Time     `json:"last_run,omitempty"`
+	NextRun  time.Time     `json:"next_run,omitempty"`
+	Findings int           `json:"findings"`
+}
+
+// scanHistory is the persisted state of a job
+type scanHistory struct {
+	LastRun  time.Time    `json:"last_run"`
+	Findings []ScanResult `json:"findings"`
+	Reports  []ScanReport `json:"reports"`
+}
+
+// Scheduler runs scans periodically, keeps their history and reports only
+// new and resolved findings
+type Scheduler struct {
+	logger *zap.Logger
+	config ScheduleConfig
+	events chan<- interface{}
+	jobs   map[string]ScanJob
+	next   map[string]time.Time
+	store  *store.Bucket[scanHistory]
+	tasks  *tasks.Registry
+	mu     sync.Mutex
+	runMu  sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a scan scheduler. Reports with changes are sent on
+// events; events may be nil.
+func NewScheduler(logger *zap.Logger, config ScheduleConfig, events chan<- interface{}) *Scheduler {
+	if config.HistoryDir == "" {
+		config.HistoryDir = DefaultScheduleConfig.HistoryDir
+	}
+	if config.Keep <= 0 {
+		config.Keep = DefaultScheduleConfig.Keep
+	}
+	return &Scheduler{
+		logger: logger,
+		config: config,
+		events: events,
+		jobs:   make(map[string]ScanJob),
+		next:   make(map[string]time.Time),
+	}
+}
+
+// Add registers a job. Jobs must be added before Start.
+func (s *Scheduler) Add(job ScanJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.Name] = job
+}
+
+// Start runs every job with an interval in the background. A job that ran
+// recently, possibly before a restart, waits for the rest of its interval.
+func (s *Scheduler) Start(ctx context.Context) error {
+	if err := os.MkdirAll(s.config.HistoryDir, 0700); err != nil {
+		return fmt.Errorf("failed to create scan history directory: %w", err)
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.Interval <= 0 {
+			continue
+		}
+		s.wg.Add(1)
+		go s.schedule(ctx, job)
+	}
+	return nil
+}
+
+// Shutdown stops scheduled scans
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) schedule(ctx context.Context, job ScanJob) {
+	defer s.wg.Done()
+
+	delay := time.Duration(0)
+	if h, err := s.loadHistory(job.Name); err != nil {
+		s.logger.Warn("Failed to load scan history", zap.String("job", job.Name), zap.Error(err))
+	} else if !h.LastRun.IsZero() {
+		delay = max(0, time.Until(h.LastRun.Add(job.Interval)))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		s.setNext(job.Name, time.Now().Add(delay))
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		if _, err := s.Run(ctx, job.Name); err != nil && ctx.Err() == nil {
+			s.logger.Warn("Scheduled scan failed", zap.String("job", job.Name), zap.Error(err))
+		}
+		delay = job.Interval
+		timer.Reset(delay)
+	}
+}
+
+func (s *Scheduler) setNext(name string, next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next[name] = next
+}
+
+// Run runs a job now, records its findings and returns the difference
+// with the previous run. Scans run one at a time.
+func (s *Scheduler) Run(ctx context.Context, name string) (*ScanReport, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown scan job: %s", name)
+	}
+
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	s.mu.Lock()
+	task := s.tasks.Start("", "scan", name)
+	s.mu.Unlock()
+	report, err := s.run(ctx, job)
+	switch {
+	case err != nil:
+		task.Finish(err)
+	case report.Error != "":
+		task.Finish(errors.New(report.Error))
+	default:
+		task.Done(fmt.Sprintf("%d findings, %d new, %d resolved", report.Total, len(report.New), len(report.Resolved)))
+	}
+	return report, err
+}
+
+// run runs job and records its findings. The caller holds runMu.
+func (s *Scheduler) run(ctx context.Context, job ScanJob) (*ScanReport, error) {
+	name := job.Name
+	history, err := s.loadHistory(name)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ScanReport{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		Job:       name,
+		StartedAt: time.Now(),
+	}
+	findings, err := job.Run(ctx)
+	report.Duration = time.Since(report.StartedAt)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Keep the previous findings so the next scan diffs against them
+		report.Error = err.Error()
+		report.Total = len(history.Findings)
+	} else {
+		report.New, report.Resolved = diffFindings(history.Findings, findings)
+		report.Total = len(findings)
+		history.Findings = findings
+	}
+	history.LastRun = report.StartedAt
+	history.Reports = append(history.Reports, *report)
+	if len(history.Reports) > s.config.Keep {
+		history.Reports = history.Reports[len(history.Reports)-s.config.Keep:]
+	}
+	if err := s.saveHistory(name, history); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Security scan completed",
+		zap.String("job", name),
+		zap.Int("total", report.Total),
+		zap.Int("new", len(report.New)),
+		zap.Int("resolved", len(report.Resolved)),
+		zap.String("error", report.Error))
+	if len(report.New) > 0 || len(report.Resolved) > 0 || report.Error != "" {
+		s.report(*report)
+	}
+	return report, nil
+}
+
+// report forwards a scan report without blocking
+func (s *Scheduler) report(r ScanReport) {
+	if s.events == nil {
+		return
+	}
+	select {
+	case s.events <- r:
+	default:
+		s.logger.Warn("Failed to send scan report: channel full", zap.String("job", r.Job))
+	}
+}
+
+// History returns the most recent reports of a job, newest first
+func (s *Scheduler) History(name string, limit int) ([]ScanReport, error) {
+	s.mu.Lock()
+	_, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown scan job: %s", name)
+	}
+
+	history, err := s.loadHistory(name)
+	if err != nil {
+		return nil, err
+	}
+	reports := history.Reports
+	if limit > 0 && len(reports) > limit {
+		reports = reports[len(reports)-limit:]
+	}
+	result := make([]ScanReport, len(reports))
+	for i, r := range reports {
+		result[len(reports)-1-i] = r
+	}
+	return result, nil
+}
+
+// Status describes every job
+func (s *Scheduler) Status() []ScanStatus {
+	s.mu.Lock()
+	jobs := make([]ScanJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	next := make(map[string]time.Time, len(s.next))
+	for name, t := range s.next {
+		next[name] = t
+	}
+	s.mu.Unlock()
+
+	statuses := make([]ScanStatus, 0, len(jobs))
+	for _, job := range jobs {
+		status := ScanStatus{Job: job.Name, Interval: job.Interval, NextRun: next[job.Name]}
+		if h, err := s.loadHistory(job.Name); err == nil {
+			status.LastRun = h.LastRun
+			status.Findings = len(h.Findings)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Job < statuses[j].Job })
+	return statuses
+}
+
+// HandleCommand processes scan scheduling commands
+func (s *Scheduler) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "security:scan":
+		if len(args) < 1 {
+			return nil, fmt.Errorf("usage: security:scan <job>")
+		}
+		return s.Run(ctx, args[0])
+	case "security:scan_history":
+		if len(args) < 1 {
+			return nil, fmt.Errorf("usage: security:scan_history <job> [limit]")
+		}
+		limit := 10
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid limit: %w", err)
+			}
+			limit = n
+		}
+		return s.History(args[0], limit)
+	case "security:scan_jobs":
+		return s.Status(), nil
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown security command: %s", cmd)
+	}
+}
+
+// SetTasks reports the progress of scans as tasks in registry
+func (s *Scheduler) SetTasks(registry *tasks.Registry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = registry
+}
+
+// SetStore keeps the job histories in st instead of HistoryDir. Histories
+// still in HistoryDir are read from there until the job next runs.
+func (s *Scheduler) SetStore(st *store.Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store.NewBucket[scanHistory](st, store.BucketScanJobs)
+}
+
+func (s *Scheduler) historyStore() *store.Bucket[scanHistory] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store
+}
+
+func (s *Scheduler) historyPath(name string) string {
+	return filepath.Join(s.config.HistoryDir, name+".json")
+}
+
+// loadHistory reads the history of a job; a job that never ran has an
+// empty one
+func (s *Scheduler) loadHistory(name string) (*scanHistory, error) {
+	if st := s.historyStore(); st != nil {
+		h, ok, err := st.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read scan history: %w", err)
+		}
+		if ok {
+			return &h, nil
+		}
+	}
+	data, err := os.ReadFile(s.historyPath(name))
+	if os.IsNotExist(err) {
+		return &scanHistory{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scan history: %w", err)
+	}
+	var h scanHistory
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("failed to parse scan history: %w", err)
+	}
+	return &h, nil
+}
+
+// saveHistory writes the history of a job atomically, readable by root
+// only
+func (s *Scheduler) saveHistory(name string, h *scanHistory) error {
+	if st := s.historyStore(); st != nil {
+		if err := st.Put(name, *h); err != nil {
+			return fmt.Errorf("failed to write scan history: %w", err)
+		}
+		// The store supersedes a history file left from before it
+		if err := os.Remove(s.historyPath(name)); err != nil && !os.IsNotExist(err) {
+			s.logger.Warn("Failed to remove migrated scan history", zap.String("job", name), zap.Error(err))
+		}
+		return nil
+	}
+	if err := os.MkdirAll(s.config.HistoryDir, 0700); err != nil {
+		return fmt.Errorf("failed to create scan history directory: %w", err)
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scan history: %w", err)
+	}
+	path := s.historyPath(name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write scan history: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write scan history: %w", err)
+	}
+	return nil
+}
+
+// diffFindings returns the findings only in current and only in previous
+func diffFindings(previous, current []ScanResult) (added, resolved []ScanResult) {
+	before := make(map[string]bool, len(previous))
+	for _, r := range previous {
+		before[findingKey(r)] = true
+	}
+	after := make(map[string]bool, len(current))
+	for _, r := range current {
+		key := findingKey(r)
+		if !after[key] && !before[key] {
+			added = append(added, r)
+		}
+		after[key] = true
+	}
+	for _, r := range previous {
+		if !after[findingKey(r)] {
+			resolved = append(resolved, r)
+		}
+	}
+	return added, resolved
+}
+
+// findingKey identifies a finding across scans
+func findingKey(r ScanResult) string {
+	return string(r.RuleType) + "|" + r.Path + "|" + r.Message
+}
@@ -0,0 +1,463 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// RuleTypeSecret marks scan results raised by the secret scanner
+const RuleTypeSecret RuleType = "secret"
+
+// Secret sources
+const (
+	SecretSourceFile      = "file"
+	SecretSourceHistory   = "history"
+	SecretSourceContainer = "container"
+)
+
+// maxSecretsPerSource bounds the findings kept per file or container
+const maxSecretsPerSource = 20
+
+// historyFiles are the shell and client histories searched in home
+// directories
+var historyFiles = []string{
+	".bash_history", ".zsh_history", ".sh_history", ".history",
+	".mysql_history", ".psql_history", ".python_history", ".node_repl_history",
+}
+
+// SecretRule is a pattern for a kind of credential. If the pattern has a
+// group named "secret" only that part is the credential; otherwise the
+// whole match is.
+type SecretRule struct {
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern"`
+	Severity string `json:"severity"`
+	// MinEntropy drops matches whose secret has fewer bits of Shannon
+	// entropy per character, filtering out placeholders and examples
+	MinEntropy float64 `json:"min_entropy,omitempty"`
+}
+
+// SecretConfig configures secret scanning
+type SecretConfig struct {
+	// Interval between scheduled scans; 0 only scans on demand
+	Interval time.Duration `json:"interval"`
+	// Paths are the directories searched for secrets in files
+	Paths []string `json:"paths"`
+	// Exclude are filepath.Match patterns for paths or base names
+	Exclude []string `json:"exclude,omitempty"`
+	// MaxFileSize skips larger files; 0 means 1MB
+	MaxFileSize int64 `json:"max_file_size,omitempty"`
+	// History searches shell histories in home directories
+	History bool `json:"history"`
+	// Containers searches the environment of running containers
+	Containers bool `json:"containers"`
+	// Rules replace the built-in rules when set
+	Rules []SecretRule `json:"rules,omitempty"`
+}
+
+// DefaultSecretConfig scans daily. Key files kept in their usual places
+// are excluded; they are expected to hold private keys.
+var DefaultSecretConfig = SecretConfig{
+	Interval: 24 * time.Hour,
+	Paths:    []string{"/etc", "/opt", "/srv", "/var/www", "/root", "/home"},
+	Exclude: []string{
+		"/etc/ssl/private/*", "/etc/ssh/ssh_host_*", "/etc/pki/*",
+		"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519", "*.pub",
+		".git", "node_modules", ".cache", "shadow", "shadow-", "gshadow", "gshadow-",
+	},
+	History:    true,
+	Containers: true,
+}
+
+// DefaultSecretRules are the built-in credential patterns
+var DefaultSecretRules = []SecretRule{
+	{Name: "private_key", Pattern: `-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----`, Severity: SeverityCritical},
+	{Name: "aws_access_key", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`, Severity: SeverityCritical},
+	{Name: "aws_secret_key", Pattern: `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+]{40})\b`, Severity: SeverityCritical},
+	{Name: "github_token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})\b`, Severity: SeverityHigh},
+	{Name: "gitlab_token", Pattern: `\bglpat-[A-Za-z0-9_-]{20,}\b`, Severity: SeverityHigh},
+	{Name: "slack_token", Pattern: `\bxox[abprs]-[A-Za-z0-9-]{10,}`, Severity: SeverityHigh},
+	{Name: "stripe_key", Pattern: `\b[sr]k_live_[A-Za-z0-9]{24,}\b`, Severity: SeverityHigh},
+	{Name: "google_api_key", Pattern: `\bAIza[0-9A-Za-z_-]{35}\b`, Severity: SeverityHigh},
+	{Name: "jwt", Pattern: `\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`, Severity: SeverityMedium},
+	{Name: "url_credentials", Pattern: `\b[a-z][a-z0-9+.-]*://[^/\s:@"']+:(?P<secret>[^/\s@"']{4,})@`, Severity: SeverityHigh, MinEntropy: 2.5},
+	{Name: "cli_password", Pattern: `(?:--password[= ]|\s-p)(?P<secret>[^\s"'$-][^\s"']{5,})`, Severity: SeverityMedium, MinEntropy: 3},
+	{Name: "password_assignment", Pattern: `(?i)[a-z0-9_.-]*(?:password|passwd|secret|api[_-]?key|token|access[_-]?key|credentials?)[a-z0-9_.-]*["']?\s*[:=]\s*["']?(?P<secret>[^\s"'#,;$<{%][^\s"'#,;]{7,})`, Severity: SeverityMedium, MinEntropy: 3},
+}
+
+// SecretFinding is a credential found on the host. The secret itself is
+// never kept: Redacted shows enough to recognize it and Fingerprint
+// identifies it across scans, so it can be tracked until rotated.
+type SecretFinding struct {
+	Source      string    `json:"source"`
+	Location    string    `json:"location"`
+	Line        int       `json:"line,omitempty"`
+	Rule        string    `json:"rule"`
+	Severity    string    `json:"severity"`
+	Redacted    string    `json:"redacted"`
+	Fingerprint string    `json:"fingerprint"`
+	Found       time.Time `json:"found"`
+}
+
+// ScanResult converts the finding to the scanner result format
+func (f SecretFinding) ScanResult() ScanResult {
+	path := f.Location
+	if f.Source != SecretSourceFile && f.Source != SecretSourceHistory {
+		path = f.Source + ":" + f.Location
+	}
+	// The line is left out so that edits elsewhere in a file don't make
+	// the finding look new
+	return ScanResult{
+		Path:     path,
+		RuleType: RuleTypeSecret,
+		Message:  fmt.Sprintf("%s exposed: %s (fingerprint %s)", f.Rule, f.Redacted, f.Fingerprint),
+		Severity: f.Severity,
+	}
+}
+
+// key identifies a finding across scans
+func (f SecretFinding) key() string {
+	return f.Source + "|" + f.Location + "|" + f.Fingerprint
+}
+
+// ContainerEnvFunc returns the environment of running containers, keyed
+// by container name
+type ContainerEnvFunc func(ctx context.Context) (map[string][]string, error)
+
+type compiledSecretRule struct {
+	SecretRule
+	pattern *regexp.Regexp
+	group   int
+}
+
+// SecretScanner looks for credentials left in files, shell histories
+// and container environments
+type SecretScanner struct {
+	logger     *zap.Logger
+	config     SecretConfig
+	rules      []compiledSecretRule
+	containers ContainerEnvFunc
+	mu         sync.Mutex
+}
+
+// NewSecretScanner creates a secret scanner
+func NewSecretScanner(logger *zap.Logger, config SecretConfig) (*SecretScanner, error) {
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = defaultMaxContentSize
+	}
+	rules := config.Rules
+	if len(rules) == 0 {
+		rules = DefaultSecretRules
+	}
+	compiled, err := compileSecretRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretScanner{
+		logger: logger,
+		config: config,
+		rules:  compiled,
+	}, nil
+}
+
+// SetContainerSource sets where container environments are read from
+func (s *SecretScanner) SetContainerSource(fn ContainerEnvFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.containers = fn
+}
+
+// Scan searches every configured source
+func (s *SecretScanner) Scan(ctx context.Context) ([]SecretFinding, error) {
+	var findings []SecretFinding
+	for _, path := range s.config.Paths {
+		found, err := s.scanPath(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, found...)
+	}
+	if s.config.History {
+		findings = append(findings, s.scanHistories(ctx)...)
+	}
+	if s.config.Containers {
+		found, err := s.scanContainers(ctx)
+		if err != nil {
+			s.logger.Warn("Failed to scan container environments", zap.Error(err))
+		}
+		findings = append(findings, found...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].key() < findings[j].key() })
+	return findings, nil
+}
+
+// Results runs a scan and returns its findings as scan results
+func (s *SecretScanner) Results(ctx context.Context) ([]ScanResult, error) {
+	findings, err := s.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ScanResult, len(findings))
+	for i, f := range findings {
+		results[i] = f.ScanResult()
+	}
+	return results, nil
+}
+
+// scanPath searches the files below path. Unreadable files and
+// directories are skipped.
+func (s *SecretScanner) scanPath(ctx context.Context, root string) ([]SecretFinding, error) {
+	var findings []SecretFinding
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if matchesAny(path, s.config.Exclude) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() > s.config.MaxFileSize {
+			return nil
+		}
+		source := SecretSourceFile
+		if isHistoryFile(path) {
+			// Histories are searched separately when enabled
+			if s.config.History {
+				return nil
+			}
+			source = SecretSourceHistory
+		}
+		findings = append(findings, s.scanFile(path, source)...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("secret scan failed for path %s: %w", root, err)
+	}
+	return findings, nil
+}
+
+// scanHistories searches the shell histories of root and every home
+// directory
+func (s *SecretScanner) scanHistories(ctx context.Context) []SecretFinding {
+	homes := []string{"/root"}
+	if entries, err := os.ReadDir("/home"); err == nil {
+		for _, e := range entries {
+			if e.IsDir() {
+				homes = append(homes, filepath.Join("/home", e.Name()))
+			}
+		}
+	}
+
+	var findings []SecretFinding
+	for _, home := range homes {
+		if ctx.Err() != nil {
+			return findings
+		}
+		for _, name := range historyFiles {
+			path := filepath.Join(home, name)
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			findings = append(findings, s.scanFile(path, SecretSourceHistory)...)
+		}
+	}
+	return findings
+}
+
+// scanContainers searches the environment of running containers
+func (s *SecretScanner) scanContainers(ctx context.Context) ([]SecretFinding, error) {
+	s.mu.Lock()
+	source := s.containers
+	s.mu.Unlock()
+	if source == nil {
+		return nil, nil
+	}
+
+	envs, err := source(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var findings []SecretFinding
+	for name, env := range envs {
+		var found []SecretFinding
+		for _, v := range env {
+			found = append(found, s.match(v, SecretSourceContainer, name, 0)...)
+		}
+		findings = append(findings, limitFindings(found)...)
+	}
+	return findings, nil
+}
+
+// scanFile searches a text file line by line. Binary files are skipped.
+func (s *SecretScanner) scanFile(path, source string) []SecretFinding {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.logger.Debug("Failed to read file", zap.String("path", path), zap.Error(err))
+		return nil
+	}
+	if bytes.IndexByte(data[:min(len(data), 512)], 0) >= 0 {
+		return nil
+	}
+
+	var findings []SecretFinding
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		findings = append(findings, s.match(scanner.Text(), source, path, line)...)
+	}
+	return limitFindings(findings)
+}
+
+// match returns the findings of every rule in text. A secret matched by
+// several rules is reported once, by the first rule.
+func (s *SecretScanner) match(text, source, location string, line int) []SecretFinding {
+	var findings []SecretFinding
+	seen := make(map[string]bool)
+	for _, rule := range s.rules {
+		for _, m := range rule.pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if rule.group > 0 && m[2*rule.group] >= 0 {
+				start, end = m[2*rule.group], m[2*rule.group+1]
+			}
+			secret := text[start:end]
+			if rule.MinEntropy > 0 && entropy(secret) < rule.MinEntropy {
+				continue
+			}
+			fingerprint := secretFingerprint(secret)
+			if seen[fingerprint] {
+				continue
+			}
+			seen[fingerprint] = true
+			findings = append(findings, SecretFinding{
+				Source:      source,
+				Location:    location,
+				Line:        line,
+				Rule:        rule.Name,
+				Severity:    rule.Severity,
+				Redacted:    redact(secret),
+				Fingerprint: fingerprint,
+				Found:       time.Now(),
+			})
+		}
+	}
+	return findings
+}
+
+// HandleCommand processes secret scanning commands
+func (s *SecretScanner) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "security:secrets":
+		return s.Scan(ctx)
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown security command: %s", cmd)
+	}
+}
+
+func compileSecretRules(rules []SecretRule) ([]compiledSecretRule, error) {
+	compiled := make([]compiledSecretRule, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for secret rule %s: %w", rule.Name, err)
+		}
+		c := compiledSecretRule{SecretRule: rule, pattern: pattern}
+		if c.Severity == "" {
+			c.Severity = SeverityHigh
+		}
+		if i := pattern.SubexpIndex("secret"); i > 0 {
+			c.group = i
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var bits float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
+
+// redact keeps a short prefix of a secret, enough to recognize it
+func redact(secret string) string {
+	keep := min(4, len(secret)/4)
+	return secret[:keep] + strings.Repeat("*", 8)
+}
+
+// secretFingerprint identifies a secret without revealing it
+func secretFingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+func limitFindings(findings []SecretFinding) []SecretFinding {
+	if len(findings) > maxSecretsPerSource {
+		return findings[:maxSecretsPerSource]
+	}
+	return findings
+}
+
+func isHistoryFile(path string) bool {
+	base := filepath.Base(path)
+	for _, name := range historyFiles {
+		if base == name {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether path or its base name matches a pattern
+func matchesAny(path string, patterns []string) bool {
+	base := filepath.Base(path)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
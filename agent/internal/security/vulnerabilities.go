@@ -0,0 +1,635 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/inventory"
+)
+
+const (
+	defaultOSVURL = "https://api.osv.dev/v1"
+	// osvBatchSize is the maximum number of queries per querybatch request
+	osvBatchSize = 1000
+	// vulnerabilityJob is the job advisory matches are reported as
+	vulnerabilityJob = "vulnerabilities"
+)
+
+// Advisory represents a published vulnerability affecting a package
+type Advisory struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Summary  string   `json:"summary"`
+	Severity string   `json:"severity"`
+}
+
+// PackageQuery identifies an installed package version within an ecosystem
+type PackageQuery struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+}
+
+// AdvisoryFeed looks up advisories for package versions. The returned slice
+// is parallel to queries.
+type AdvisoryFeed interface {
+	Query(ctx context.Context, queries []PackageQuery) ([][]Advisory, error)
+}
+
+// VulnerabilityFinding represents an installed package with a known
+// advisory. Debian and Ubuntu advisories are keyed by source package, so
+// Package is the source package there and Binaries the installed packages
+// built from it.
+type VulnerabilityFinding struct {
+	Package  string    `json:"package"`
+	Version  string    `json:"version"`
+	Binaries []string  `json:"binaries,omitempty"`
+	Source   string    `json:"source"`
+	Advisory Advisory  `json:"advisory"`
+	CVEs     []string  `json:"cves,omitempty"`
+	Found    time.Time `json:"found"`
+}
+
+// sourcePackage is the source package an installed binary package was
+// built from
+type sourcePackage struct {
+	Name    string
+	Version string
+}
+
+// VulnerabilityMatcher matches the software inventory against an advisory feed
+type VulnerabilityMatcher struct {
+	logger *zap.Logger
+	feed   AdvisoryFeed
+	events chan<- interface{} // Channel for reporting findings
+
+	// osRelease identifies the distribution
+	osRelease string
+	// sourcePackages maps installed dpkg packages, by name and version, to
+	// their source packages
+	sourcePackages func(ctx context.Context) (map[string]sourcePackage, error)
+
+	mu sync.Mutex
+	// previous are the findings of the last match
+	previous []ScanResult
+}
+
+// NewVulnerabilityMatcher creates a matcher. The findings that are new or
+// resolved since the last match are reported on events as a ScanReport;
+// events may be nil.
+func NewVulnerabilityMatcher(logger *zap.Logger, feed AdvisoryFeed, events chan<- interface{}) *VulnerabilityMatcher {
+	if feed == nil {
+		feed = NewOSVFeed("")
+	}
+	return &VulnerabilityMatcher{
+		logger:         logger,
+		feed:           feed,
+		events:         events,
+		osRelease:      "/etc/os-release",
+		sourcePackages: dpkgSourcePackages,
+	}
+}
+
+// Match checks every installed package in the inventory for known
+// advisories and returns the findings
+func (m *VulnerabilityMatcher) Match(ctx context.Context, inv *inventory.Inventory) ([]VulnerabilityFinding, error) {
+	dist := readOSRelease(m.osRelease)
+
+	var sources map[string]sourcePackage
+	for _, pkg := range inv.Packages {
+		if pkg.Source == "apt" {
+			var err error
+			if sources, err = m.sourcePackages(ctx); err != nil {
+				m.logger.Warn("Failed to resolve source packages, matching binary packages", zap.Error(err))
+			}
+			break
+		}
+	}
+
+	var queries []PackageQuery
+	var binaries [][]string
+	var pkgSources []string
+	seen := make(map[PackageQuery]int)
+	for _, pkg := range inv.Packages {
+		ecosystem := osvEcosystem(pkg.Source, dist)
+		if ecosystem == "" || pkg.Version == "" {
+			continue
+		}
+		query := PackageQuery{
+			Ecosystem: ecosystem,
+			Name:      pkg.Name,
+			Version:   pkg.Version,
+		}
+		if src, ok := sources[pkg.Name+"\t"+pkg.Version]; ok && pkg.Source == "apt" {
+			query.Name, query.Version = src.Name, src.Version
+		}
+		// Binary packages built from the same source share its query
+		if i, ok := seen[query]; ok {
+			binaries[i] = append(binaries[i], pkg.Name)
+			continue
+		}
+		seen[query] = len(queries)
+		queries = append(queries, query)
+		binaries = append(binaries, []string{pkg.Name})
+		pkgSources = append(pkgSources, pkg.Source)
+	}
+
+	if len(queries) == 0 {
+		m.logger.Debug("No packages in a supported advisory ecosystem",
+			zap.String("distro", dist.ID))
+		return nil, nil
+	}
+
+	results, err := m.feed.Query(ctx, queries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query advisories: %w", err)
+	}
+
+	started := time.Now()
+	var findings []VulnerabilityFinding
+	for i, advisories := range results {
+		for _, adv := range advisories {
+			finding := VulnerabilityFinding{
+				Package:  queries[i].Name,
+				Version:  queries[i].Version,
+				Source:   pkgSources[i],
+				Advisory: adv,
+				Found:    started,
+			}
+			if len(binaries[i]) > 1 || binaries[i][0] != queries[i].Name {
+				finding.Binaries = binaries[i]
+			}
+			for _, id := range append([]string{adv.ID}, adv.Aliases...) {
+				if strings.HasPrefix(id, "CVE-") && !containsString(finding.CVEs, id) {
+					finding.CVEs = append(finding.CVEs, id)
+				}
+			}
+			findings = append(findings, finding)
+		}
+	}
+
+	current := make([]ScanResult, len(findings))
+	for i, f := range findings {
+		current[i] = f.ScanResult()
+	}
+	m.mu.Lock()
+	report := ScanReport{
+		ID:        strconv.FormatInt(started.UnixNano(), 36),
+		Job:       vulnerabilityJob,
+		StartedAt: started,
+		Duration:  time.Since(started),
+		Total:     len(current),
+	}
+	report.New, report.Resolved = diffFindings(m.previous, current)
+	m.previous = current
+	m.mu.Unlock()
+	if len(report.New) > 0 || len(report.Resolved) > 0 {
+		m.report(report)
+	}
+
+	return findings, nil
+}
+
+// report forwards a report of new and resolved findings without blocking
+func (m *VulnerabilityMatcher) report(r ScanReport) {
+	if m.events == nil {
+		return
+	}
+
+	select {
+	case m.events <- r:
+	default:
+		m.logger.Warn("Failed to send vulnerability findings: channel full",
+			zap.Int("new", len(r.New)), zap.Int("resolved", len(r.Resolved)))
+	}
+}
+
+// ScanResult converts the finding to the scanner result format
+func (f VulnerabilityFinding) ScanResult() ScanResult {
+	ids := f.Advisory.ID
+	if len(f.CVEs) > 0 {
+		ids = strings.Join(f.CVEs, ", ")
+	}
+	return ScanResult{
+		Path:     fmt.Sprintf("%s@%s", f.Package, f.Version),
+		RuleType: RuleTypeVulnerability,
+		Message:  fmt.Sprintf("%s: %s", ids, f.Advisory.Summary),
+		Severity: f.Advisory.Severity,
+	}
+}
+
+// dpkgSourcePackages asks dpkg for the source package of every installed
+// package, keyed by the package's name and version separated by a tab
+func dpkgSourcePackages(ctx context.Context) (map[string]sourcePackage, error) {
+	output, err := exec.CommandContext(ctx, "dpkg-query", "-W",
+		"-f=${Package}\t${Version}\t${source:Package}\t${source:Version}\n").Output()
+	if err != nil {
+		return nil, fmt.Errorf("dpkg-query failed: %w", err)
+	}
+
+	sources := make(map[string]sourcePackage)
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.Split(line, "\t")
+		if len(parts) != 4 || parts[2] == "" || parts[3] == "" {
+			continue
+		}
+		sources[parts[0]+"\t"+parts[1]] = sourcePackage{Name: parts[2], Version: parts[3]}
+	}
+	return sources, nil
+}
+
+// distribution is what os-release says about the running distribution
+type distribution struct {
+	ID        string
+	VersionID string
+	// LTS is set for Ubuntu's long-term support releases
+	LTS bool
+}
+
+// readOSRelease reads the distribution from an os-release file
+func readOSRelease(path string) distribution {
+	f, err := os.Open(path)
+	if err != nil {
+		return distribution{}
+	}
+	defer f.Close()
+	return parseOSRelease(f)
+}
+
+func parseOSRelease(r io.Reader) distribution {
+	var dist distribution
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		switch key {
+		case "ID":
+			dist.ID = value
+		case "VERSION_ID":
+			dist.VersionID = value
+		case "VERSION":
+			// e.g. "22.04.4 LTS (Jammy Jellyfish)"
+			dist.LTS = strings.Contains(value, " LTS")
+		}
+	}
+	return dist
+}
+
+// osvEcosystem maps a package source and distribution to an OSV ecosystem
+// name, or "" if OSV has no advisories for it
+func osvEcosystem(source string, dist distribution) string {
+	if dist.VersionID == "" {
+		return ""
+	}
+	switch source {
+	case "apt":
+		switch dist.ID {
+		case "debian":
+			// OSV uses the major version, e.g. "Debian:12"
+			major, _, _ := strings.Cut(dist.VersionID, ".")
+			return "Debian:" + major
+		case "ubuntu":
+			// LTS releases are suffixed, e.g. "Ubuntu:22.04:LTS"
+			if dist.LTS {
+				return "Ubuntu:" + dist.VersionID + ":LTS"
+			}
+			return "Ubuntu:" + dist.VersionID
+		}
+	case "apk":
+		if dist.ID == "alpine" {
+			// OSV uses major.minor with a v prefix, e.g. "Alpine:v3.19"
+			parts := strings.SplitN(dist.VersionID, ".", 3)
+			if len(parts) >= 2 {
+				return "Alpine:v" + parts[0] + "." + parts[1]
+			}
+		}
+	case "zypper":
+		switch dist.ID {
+		case "opensuse-leap":
+			return "openSUSE:Leap " + dist.VersionID
+		case "sles":
+			// OSV names service packs, e.g. "SUSE:Linux Enterprise Server 15 SP5"
+			major, sp, ok := strings.Cut(dist.VersionID, ".")
+			if !ok || sp == "0" {
+				return "SUSE:Linux Enterprise Server " + major
+			}
+			return "SUSE:Linux Enterprise Server " + major + " SP" + sp
+		}
+	}
+	return ""
+}
+
+// OSVFeed queries the OSV.dev vulnerability database
+type OSVFeed struct {
+	baseURL string
+	client  *http.Client
+	cache   map[string]Advisory
+	mu      sync.Mutex
+}
+
+// NewOSVFeed creates an OSV feed client. An empty baseURL uses api.osv.dev.
+func NewOSVFeed(baseURL string) *OSVFeed {
+	if baseURL == "" {
+		baseURL = defaultOSVURL
+	}
+	return &OSVFeed{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+		cache:   make(map[string]Advisory),
+	}
+}
+
+type osvQuery struct {
+	Version string `json:"version"`
+	Package struct {
+		Name      string `json:"name"`
+		Ecosystem string `json:"ecosystem"`
+	} `json:"package"`
+	// PageToken asks for the next page of a query's vulnerabilities
+	PageToken string `json:"page_token,omitempty"`
+}
+
+type osvVuln struct {
+	ID      string   `json:"id"`
+	Aliases []string `json:"aliases"`
+	// Upstream are the advisories a distribution's record derives from
+	Upstream []string `json:"upstream"`
+	Summary  string   `json:"summary"`
+	Details  string   `json:"details"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// Query implements AdvisoryFeed using the OSV querybatch API. Batch results
+// only carry IDs, so advisory details are fetched individually and cached.
+// Queries with more vulnerabilities than fit a page are asked again with
+// their next_page_token until every page is read.
+func (f *OSVFeed) Query(ctx context.Context, queries []PackageQuery) ([][]Advisory, error) {
+	results := make([][]Advisory, len(queries))
+
+	// pending are the indexes of the queries with pages left to read
+	pending := make([]int, len(queries))
+	for i := range pending {
+		pending[i] = i
+	}
+	tokens := make(map[int]string)
+
+	for len(pending) > 0 {
+		end := osvBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		indexes := pending[:end]
+
+		batch := make([]osvQuery, 0, len(indexes))
+		for _, i := range indexes {
+			var oq osvQuery
+			oq.Version = queries[i].Version
+			oq.Package.Name = queries[i].Name
+			oq.Package.Ecosystem = queries[i].Ecosystem
+			oq.PageToken = tokens[i]
+			batch = append(batch, oq)
+		}
+
+		var resp struct {
+			Results []struct {
+				Vulns []struct {
+					ID string `json:"id"`
+				} `json:"vulns"`
+				NextPageToken string `json:"next_page_token"`
+			} `json:"results"`
+		}
+		if err := f.post(ctx, "/querybatch", map[string]interface{}{"queries": batch}, &resp); err != nil {
+			return nil, err
+		}
+
+		var next []int
+		for j, r := range resp.Results {
+			if j >= len(indexes) {
+				break
+			}
+			i := indexes[j]
+			for _, v := range r.Vulns {
+				adv, err := f.advisory(ctx, v.ID)
+				if err != nil {
+					return nil, err
+				}
+				results[i] = append(results[i], adv)
+			}
+			if r.NextPageToken != "" {
+				tokens[i] = r.NextPageToken
+				next = append(next, i)
+			}
+		}
+		pending = append(next, pending[end:]...)
+	}
+
+	return results, nil
+}
+
+// advisory fetches and caches the details of a single vulnerability
+func (f *OSVFeed) advisory(ctx context.Context, id string) (Advisory, error) {
+	f.mu.Lock()
+	adv, ok := f.cache[id]
+	f.mu.Unlock()
+	if ok {
+		return adv, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseURL+"/vulns/"+id, nil)
+	if err != nil {
+		return Advisory{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Advisory{}, fmt.Errorf("failed to fetch advisory %s: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Advisory{}, fmt.Errorf("failed to fetch advisory %s: status %d", id, resp.StatusCode)
+	}
+
+	var vuln osvVuln
+	if err := json.NewDecoder(resp.Body).Decode(&vuln); err != nil {
+		return Advisory{}, fmt.Errorf("failed to decode advisory %s: %w", id, err)
+	}
+
+	summary := vuln.Summary
+	if summary == "" {
+		summary, _, _ = strings.Cut(vuln.Details, "\n")
+	}
+
+	adv = Advisory{
+		ID:       vuln.ID,
+		Aliases:  append(vuln.Aliases, vuln.Upstream...),
+		Summary:  summary,
+		Severity: osvSeverity(vuln),
+	}
+
+	f.mu.Lock()
+	f.cache[id] = adv
+	f.mu.Unlock()
+
+	return adv, nil
+}
+
+func (f *OSVFeed) post(ctx context.Context, path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("osv request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("osv request failed: status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode osv response: %w", err)
+	}
+	return nil
+}
+
+// osvSeverity derives a low/medium/high/critical rating for a vulnerability,
+// preferring the database's own rating over a computed CVSS v3 score
+func osvSeverity(v osvVuln) string {
+	switch strings.ToLower(v.DatabaseSpecific.Severity) {
+	case "critical":
+		return "critical"
+	case "high", "important":
+		return "high"
+	case "medium", "moderate":
+		return "medium"
+	case "low", "negligible":
+		return "low"
+	}
+
+	for _, s := range v.Severity {
+		if s.Type != "CVSS_V3" {
+			continue
+		}
+		if score, ok := cvss3BaseScore(s.Score); ok {
+			return severityFromScore(score)
+		}
+	}
+	return "unknown"
+}
+
+// severityFromScore maps a CVSS score to its qualitative rating
+func severityFromScore(score float64) string {
+	switch {
+	case score >= 9.0:
+		return "critical"
+	case score >= 7.0:
+		return "high"
+	case score >= 4.0:
+		return "medium"
+	case score > 0:
+		return "low"
+	default:
+		return "none"
+	}
+}
+
+// cvss3BaseScore computes the base score of a CVSS v3.x vector string
+func cvss3BaseScore(vector string) (float64, bool) {
+	metrics := make(map[string]string)
+	for _, part := range strings.Split(vector, "/") {
+		if key, value, ok := strings.Cut(part, ":"); ok {
+			metrics[key] = value
+		}
+	}
+
+	weights := map[string]map[string]float64{
+		"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+		"AC": {"L": 0.77, "H": 0.44},
+		"UI": {"N": 0.85, "R": 0.62},
+		"C":  {"H": 0.56, "L": 0.22, "N": 0},
+		"I":  {"H": 0.56, "L": 0.22, "N": 0},
+		"A":  {"H": 0.56, "L": 0.22, "N": 0},
+	}
+	values := make(map[string]float64)
+	for key, table := range weights {
+		w, ok := table[metrics[key]]
+		if !ok {
+			return 0, false
+		}
+		values[key] = w
+	}
+
+	scopeChanged := metrics["S"] == "C"
+	var pr float64
+	switch metrics["PR"] {
+	case "N":
+		pr = 0.85
+	case "L":
+		pr = 0.62
+		if scopeChanged {
+			pr = 0.68
+		}
+	case "H":
+		pr = 0.27
+		if scopeChanged {
+			pr = 0.5
+		}
+	default:
+		return 0, false
+	}
+
+	iss := 1 - (1-values["C"])*(1-values["I"])*(1-values["A"])
+	var impact float64
+	if scopeChanged {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	} else {
+		impact = 6.42 * iss
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+
+	exploitability := 8.22 * values["AV"] * values["AC"] * pr * values["UI"]
+	var score float64
+	if scopeChanged {
+		score = math.Min(1.08*(impact+exploitability), 10)
+	} else {
+		score = math.Min(impact+exploitability, 10)
+	}
+
+	// CVSS rounds up to one decimal place
+	rounded, _ := strconv.ParseFloat(fmt.Sprintf("%.1f", math.Ceil(score*10)/10), 64)
+	return rounded, true
+}
@@ -0,0 +1,181 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/inventory"
+	"shh/agent/internal/packages"
+)
+
+const jammy = `PRETTY_NAME="Ubuntu 22.04.4 LTS"
+NAME="Ubuntu"
+VERSION_ID="22.04"
+VERSION="22.04.4 LTS (Jammy Jellyfish)"
+ID=ubuntu
+`
+
+func TestVulnerabilityMatcherMatch(t *testing.T) {
+	// openssl builds libssl3 and the openssl binary; zlib1g is built from
+	// zlib
+	sources := map[string]sourcePackage{
+		"libssl3\t3.0.2-0ubuntu1.9":  {"openssl", "3.0.2-0ubuntu1.9"},
+		"openssl\t3.0.2-0ubuntu1.9":  {"openssl", "3.0.2-0ubuntu1.9"},
+		"libssl3\t3.0.2-0ubuntu1.10": {"openssl", "3.0.2-0ubuntu1.10"},
+		"openssl\t3.0.2-0ubuntu1.10": {"openssl", "3.0.2-0ubuntu1.10"},
+		"zlib1g\t1:1.2.11.dfsg-2":    {"zlib", "1:1.2.11.dfsg-2"},
+	}
+	installed := func(openssl string) *inventory.Inventory {
+		return &inventory.Inventory{Packages: []packages.Package{
+			{Name: "libssl3", Version: openssl, Source: "apt"},
+			{Name: "openssl", Version: openssl, Source: "apt"},
+			{Name: "zlib1g", Version: "1:1.2.11.dfsg-2", Source: "apt"},
+			{Name: "firefox", Version: "124.0", Source: "snap"},
+		}}
+	}
+
+	// Each step matches again, against what the one before found
+	steps := []struct {
+		name     string
+		openssl  string
+		fixture  string
+		queries  []string
+		findings []string
+		new      []string
+		resolved []string
+	}{
+		{
+			name:     "vulnerable",
+			openssl:  "3.0.2-0ubuntu1.9",
+			fixture:  "querybatch-vulnerable.json",
+			queries:  []string{"Ubuntu:22.04:LTS/openssl@3.0.2-0ubuntu1.9", "Ubuntu:22.04:LTS/zlib@1:1.2.11.dfsg-2"},
+			findings: []string{"openssl UBUNTU-CVE-2023-2650 high [CVE-2023-2650]", "openssl UBUNTU-CVE-2023-0464 low [CVE-2023-0464]"},
+			new:      []string{"openssl@3.0.2-0ubuntu1.9 CVE-2023-2650", "openssl@3.0.2-0ubuntu1.9 CVE-2023-0464"},
+		},
+		{
+			name:     "unchanged",
+			openssl:  "3.0.2-0ubuntu1.9",
+			fixture:  "querybatch-vulnerable.json",
+			queries:  []string{"Ubuntu:22.04:LTS/openssl@3.0.2-0ubuntu1.9", "Ubuntu:22.04:LTS/zlib@1:1.2.11.dfsg-2"},
+			findings: []string{"openssl UBUNTU-CVE-2023-2650 high [CVE-2023-2650]", "openssl UBUNTU-CVE-2023-0464 low [CVE-2023-0464]"},
+		},
+		{
+			name:     "partly fixed",
+			openssl:  "3.0.2-0ubuntu1.10",
+			fixture:  "querybatch-fixed.json",
+			queries:  []string{"Ubuntu:22.04:LTS/openssl@3.0.2-0ubuntu1.10", "Ubuntu:22.04:LTS/zlib@1:1.2.11.dfsg-2"},
+			findings: []string{"openssl UBUNTU-CVE-2023-0464 low [CVE-2023-0464]"},
+			new:      []string{"openssl@3.0.2-0ubuntu1.10 CVE-2023-0464"},
+			resolved: []string{"openssl@3.0.2-0ubuntu1.9 CVE-2023-2650", "openssl@3.0.2-0ubuntu1.9 CVE-2023-0464"},
+		},
+	}
+
+	var fixture string
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/querybatch" {
+			var req struct {
+				Queries []osvQuery `json:"queries"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			queries = nil
+			for _, q := range req.Queries {
+				queries = append(queries, q.Package.Ecosystem+"/"+q.Package.Name+"@"+q.Version)
+			}
+			http.ServeFile(w, r, filepath.Join("testdata", "osv", fixture))
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/vulns/")
+		http.ServeFile(w, r, filepath.Join("testdata", "osv", "vulns", id+".json"))
+	}))
+	defer server.Close()
+
+	release := filepath.Join(t.TempDir(), "os-release")
+	if err := os.WriteFile(release, []byte(jammy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan interface{}, 10)
+	m := NewVulnerabilityMatcher(zap.NewNop(), NewOSVFeed(server.URL), events)
+	m.osRelease = release
+	m.sourcePackages = func(context.Context) (map[string]sourcePackage, error) { return sources, nil }
+
+	for _, step := range steps {
+		fixture = step.fixture
+		findings, err := m.Match(context.Background(), installed(step.openssl))
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if !reflect.DeepEqual(queries, step.queries) {
+			t.Errorf("%s: queried %q, want %q", step.name, queries, step.queries)
+		}
+		var got []string
+		for _, f := range findings {
+			got = append(got, f.Package+" "+f.Advisory.ID+" "+f.Advisory.Severity+" ["+strings.Join(f.CVEs, " ")+"]")
+			if want := []string{"libssl3", "openssl"}; !reflect.DeepEqual(f.Binaries, want) {
+				t.Errorf("%s: binaries = %q, want %q", step.name, f.Binaries, want)
+			}
+		}
+		if !reflect.DeepEqual(got, step.findings) {
+			t.Errorf("%s: found %q, want %q", step.name, got, step.findings)
+		}
+
+		var report ScanReport
+		select {
+		case event := <-events:
+			report = event.(ScanReport)
+		default:
+		}
+		if got := reported(report.New); !reflect.DeepEqual(got, step.new) {
+			t.Errorf("%s: reported %q as new, want %q", step.name, got, step.new)
+		}
+		if got := reported(report.Resolved); !reflect.DeepEqual(got, step.resolved) {
+			t.Errorf("%s: reported %q as resolved, want %q", step.name, got, step.resolved)
+		}
+	}
+}
+
+func TestOSVEcosystem(t *testing.T) {
+	tests := []struct {
+		source  string
+		release string
+		want    string
+	}{
+		{"apt", jammy, "Ubuntu:22.04:LTS"},
+		{"apt", "ID=ubuntu\nVERSION_ID=\"23.10\"\nVERSION=\"23.10 (Mantic Minotaur)\"\n", "Ubuntu:23.10"},
+		{"apt", "ID=debian\nVERSION_ID=\"12\"\nVERSION=\"12 (bookworm)\"\n", "Debian:12"},
+		{"apt", "ID=debian\nPRETTY_NAME=\"Debian GNU/Linux trixie/sid\"\n", ""},
+		{"apk", "ID=alpine\nVERSION_ID=3.19.1\n", "Alpine:v3.19"},
+		{"zypper", "ID=\"opensuse-leap\"\nVERSION_ID=\"15.5\"\n", "openSUSE:Leap 15.5"},
+		{"zypper", "ID=\"sles\"\nVERSION_ID=\"15.5\"\n", "SUSE:Linux Enterprise Server 15 SP5"},
+		{"zypper", "ID=\"sles\"\nVERSION_ID=\"15\"\n", "SUSE:Linux Enterprise Server 15"},
+		{"snap", jammy, ""},
+	}
+	for _, tt := range tests {
+		dist := parseOSRelease(strings.NewReader(tt.release))
+		if got := osvEcosystem(tt.source, dist); got != tt.want {
+			t.Errorf("osvEcosystem(%s, %+v) = %q, want %q", tt.source, dist, got, tt.want)
+		}
+	}
+}
+
+// reported summarizes reported findings by path and CVE
+func reported(results []ScanResult) []string {
+	var summary []string
+	for _, r := range results {
+		cves, _, _ := strings.Cut(r.Message, ":")
+		summary = append(summary, r.Path+" "+cves)
+	}
+	return summary
+}
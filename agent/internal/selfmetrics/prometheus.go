@@ -0,0 +1,135 @@
+package selfmetrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/systemd"
+)
+
+// namespace prefixes every metric name
+const namespace = "shh_agent_"
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WritePrometheus(w)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition
+// format
+func (r *Registry) WritePrometheus(w io.Writer) {
+	m := r.Snapshot()
+
+	gauge(w, "goroutines", "Number of goroutines.", float64(m.Goroutines))
+	gauge(w, "heap_alloc_bytes", "Bytes of allocated heap objects.", float64(m.HeapAlloc))
+	gauge(w, "heap_inuse_bytes", "Bytes in in-use heap spans.", float64(m.HeapInuse))
+	gauge(w, "heap_objects", "Number of allocated heap objects.", float64(m.HeapObjects))
+	counter(w, "gc_runs_total", "Completed GC cycles.", float64(m.GCRuns))
+	counter(w, "gc_pause_seconds_total", "Total GC stop-the-world pause time.", m.GCPauseTotal)
+	gauge(w, "gc_pause_last_seconds", "Duration of the last GC pause.", m.GCPauseLast)
+	gauge(w, "gc_pause_max_seconds", "Longest of the recent GC pauses.", m.GCPauseMax)
+
+	header(w, "queue_depth", "Items waiting in an internal queue.", "gauge")
+	for _, name := range sortedKeys(m.Queues) {
+		sample(w, "queue_depth", "queue", name, float64(m.Queues[name]))
+	}
+
+	header(w, "handler_calls_total", "Calls of a message or request handler.", "counter")
+	for _, name := range sortedKeys(m.Handlers) {
+		sample(w, "handler_calls_total", "handler", name, float64(m.Handlers[name].Calls))
+	}
+	header(w, "handler_errors_total", "Failed calls of a message or request handler.", "counter")
+	for _, name := range sortedKeys(m.Handlers) {
+		sample(w, "handler_errors_total", "handler", name, float64(m.Handlers[name].Errors))
+	}
+	header(w, "handler_seconds_total", "Time spent in a message or request handler.", "counter")
+	for _, name := range sortedKeys(m.Handlers) {
+		sample(w, "handler_seconds_total", "handler", name, m.Handlers[name].TotalSeconds)
+	}
+	header(w, "handler_max_seconds", "Longest call of a message or request handler.", "gauge")
+	for _, name := range sortedKeys(m.Handlers) {
+		sample(w, "handler_max_seconds", "handler", name, m.Handlers[name].MaxSeconds)
+	}
+
+	header(w, "component_errors_total", "Errors by agent component.", "counter")
+	for _, name := range sortedKeys(m.Errors) {
+		sample(w, "component_errors_total", "component", name, float64(m.Errors[name]))
+	}
+}
+
+func header(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", namespace, name, help, namespace, name, kind)
+}
+
+func gauge(w io.Writer, name, help string, value float64) {
+	header(w, name, help, "gauge")
+	fmt.Fprintf(w, "%s%s %g\n", namespace, name, value)
+}
+
+func counter(w io.Writer, name, help string, value float64) {
+	header(w, name, help, "counter")
+	fmt.Fprintf(w, "%s%s %g\n", namespace, name, value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func sample(w io.Writer, name, label, value string, v float64) {
+	fmt.Fprintf(w, "%s%s{%s=\"%s\"} %g\n", namespace, name, label, labelEscaper.Replace(value), v)
+}
+
+// Server serves the metrics at /metrics
+type Server struct {
+	logger   *zap.Logger
+	registry *Registry
+	addr     string
+	server   *http.Server
+}
+
+// NewServer creates a server for registry listening on addr. A socket
+// named "metrics" passed by systemd socket activation is used instead.
+func NewServer(logger *zap.Logger, registry *Registry, addr string) *Server {
+	return &Server{logger: logger, registry: registry, addr: addr}
+}
+
+// Start serves the metrics until Shutdown
+func (s *Server) Start(ctx context.Context) error {
+	listener := systemd.Listener("metrics")
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", s.addr); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.registry)
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Metrics server failed", zap.Error(err))
+		}
+	}()
+
+	s.logger.Info("Serving agent metrics", zap.String("address", listener.Addr().String()))
+	return nil
+}
+
+// Shutdown stops serving
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
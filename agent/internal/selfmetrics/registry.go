@@ -0,0 +1,142 @@
+// Package selfmetrics measures the agent itself: the Go runtime, the depth
+// of internal queues, handler latencies and errors by component. They are
+// sent in heartbeats and served in the Prometheus text format.
+package selfmetrics
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shh/agent/internal/protocol"
+)
+
+// Registry collects the agent's self-metrics
+type Registry struct {
+	mu       sync.RWMutex
+	queues   map[string]func() int
+	counters map[string]func() uint64
+	handlers map[string]*protocol.HandlerStats
+	errors   map[string]*atomic.Uint64
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		queues:   make(map[string]func() int),
+		counters: make(map[string]func() uint64),
+		handlers: make(map[string]*protocol.HandlerStats),
+		errors:   make(map[string]*atomic.Uint64),
+	}
+}
+
+// Queue reports the depth of a queue, read by depth when sampled
+func (r *Registry) Queue(name string, depth func() int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queues[name] = depth
+}
+
+// Counter reports the errors a component counts itself, read by count
+// when sampled. They add to the errors recorded with Error.
+func (r *Registry) Counter(component string, count func() uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[component] = count
+}
+
+// Error counts an error of component
+func (r *Registry) Error(component string) {
+	r.mu.RLock()
+	counter, ok := r.errors[component]
+	r.mu.RUnlock()
+	if !ok {
+		r.mu.Lock()
+		if counter, ok = r.errors[component]; !ok {
+			counter = &atomic.Uint64{}
+			r.errors[component] = counter
+		}
+		r.mu.Unlock()
+	}
+	counter.Add(1)
+}
+
+// ObserveHandler records a call of handler that took d and failed with
+// err, if not nil
+func (r *Registry) ObserveHandler(handler string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats, ok := r.handlers[handler]
+	if !ok {
+		stats = &protocol.HandlerStats{}
+		r.handlers[handler] = stats
+	}
+	stats.Calls++
+	stats.TotalSeconds += d.Seconds()
+	stats.MaxSeconds = max(stats.MaxSeconds, d.Seconds())
+	if err != nil {
+		stats.Errors++
+	}
+}
+
+// Snapshot samples every metric
+func (r *Registry) Snapshot() protocol.SelfMetrics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	m := protocol.SelfMetrics{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    mem.HeapAlloc,
+		HeapInuse:    mem.HeapInuse,
+		HeapObjects:  mem.HeapObjects,
+		GCRuns:       mem.NumGC,
+		GCPauseTotal: time.Duration(mem.PauseTotalNs).Seconds(),
+	}
+	if mem.NumGC > 0 {
+		m.GCPauseLast = time.Duration(mem.PauseNs[(mem.NumGC+255)%256]).Seconds()
+		for i := 0; i < int(min(mem.NumGC, 256)); i++ {
+			m.GCPauseMax = max(m.GCPauseMax, time.Duration(mem.PauseNs[i]).Seconds())
+		}
+	}
+
+	r.mu.RLock()
+	queues := make(map[string]func() int, len(r.queues))
+	for name, depth := range r.queues {
+		queues[name] = depth
+	}
+	counters := make(map[string]func() uint64, len(r.counters))
+	for name, count := range r.counters {
+		counters[name] = count
+	}
+	m.Handlers = make(map[string]protocol.HandlerStats, len(r.handlers))
+	for name, stats := range r.handlers {
+		m.Handlers[name] = *stats
+	}
+	m.Errors = make(map[string]uint64, len(r.errors)+len(counters))
+	for component, counter := range r.errors {
+		m.Errors[component] = counter.Load()
+	}
+	r.mu.RUnlock()
+
+	// Sources are read outside the lock, as they take locks of their own
+	m.Queues = make(map[string]int, len(queues))
+	for name, depth := range queues {
+		m.Queues[name] = depth()
+	}
+	for component, count := range counters {
+		m.Errors[component] += count()
+	}
+	return m
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,581 @@
+package sshkeys
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+const (
+	// sshdConfigFile is the sshd configuration edited for certificates
+	sshdConfigFile = "/etc/ssh/sshd_config"
+	// trustedCAFile lists the CAs sshd trusts to sign user certificates
+	trustedCAFile = "/etc/ssh/trusted_user_ca_keys"
+	// certSuffix names a certificate after its key, as OpenSSH does
+	certSuffix = "-cert.pub"
+	// clockSkew backdates certificates for hosts with slow clocks
+	clockSkew = 5 * time.Minute
+)
+
+// Certificate types
+const (
+	CertUser = "user"
+	CertHost = "host"
+)
+
+// CAConfig configures the certificate authority the agent signs with
+type CAConfig struct {
+	// KeyPath is the CA private key. Without it the agent only installs
+	// certificates issued by the server.
+	KeyPath string
+	// UserValidity is the lifetime, and the maximum requestable lifetime,
+	// of issued user certificates
+	UserValidity time.Duration
+	// HostValidity is the lifetime of host certificates
+	HostValidity time.Duration
+	// RenewBefore renews host certificates this long before they expire
+	RenewBefore time.Duration
+}
+
+// DefaultCAConfig keeps user certificates short-lived and renews host
+// certificates a day ahead
+var DefaultCAConfig = CAConfig{
+	UserValidity: time.Hour,
+	HostValidity: 7 * 24 * time.Hour,
+	RenewBefore:  24 * time.Hour,
+}
+
+// certKeyFields is the number of key fields before the serial of each
+// certificate type
+var certKeyFields = map[string]int{
+	"ssh-rsa-cert-v01@openssh.com":                2,
+	"ssh-dss-cert-v01@openssh.com":                4,
+	"ssh-ed25519-cert-v01@openssh.com":            1,
+	"ecdsa-sha2-nistp256-cert-v01@openssh.com":    2,
+	"ecdsa-sha2-nistp384-cert-v01@openssh.com":    2,
+	"ecdsa-sha2-nistp521-cert-v01@openssh.com":    2,
+	"sk-ssh-ed25519-cert-v01@openssh.com":         2,
+	"sk-ecdsa-sha2-nistp256-cert-v01@openssh.com": 3,
+}
+
+// Certificate is a parsed OpenSSH certificate
+type Certificate struct {
+	Type        string
+	KeyID       string
+	Serial      uint64
+	Principals  []string
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	// KeyFingerprint is the fingerprint of the certified public key
+	KeyFingerprint string
+}
+
+// ParseCertificate parses a -cert.pub line
+func ParseCertificate(line string) (*Certificate, error) {
+	keyType, rest := nextField(strings.TrimSpace(line))
+	fields, ok := certKeyFields[keyType]
+	if !ok {
+		return nil, fmt.Errorf("not a certificate: %s", keyType)
+	}
+	encoded, _ := nextField(rest)
+	blob, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate data: %w", err)
+	}
+
+	// string type, string nonce, key fields, uint64 serial, uint32 type,
+	// string key id, string principals, uint64 valid after, uint64 valid
+	// before
+	blobType, buf, err := readString(blob)
+	if err != nil || string(blobType) != keyType {
+		return nil, fmt.Errorf("certificate data does not match type %s", keyType)
+	}
+	if _, buf, err = readString(buf); err != nil {
+		return nil, err
+	}
+	keyStart := buf
+	for i := 0; i < fields; i++ {
+		if _, buf, err = readString(buf); err != nil {
+			return nil, err
+		}
+	}
+	var pub bytes.Buffer
+	baseType := strings.TrimSuffix(keyType, "-cert-v01@openssh.com")
+	binary.Write(&pub, binary.BigEndian, uint32(len(baseType)))
+	pub.WriteString(baseType)
+	pub.Write(keyStart[:len(keyStart)-len(buf)])
+
+	if len(buf) < 12 {
+		return nil, errors.New("short certificate data")
+	}
+	cert := &Certificate{
+		Serial:         binary.BigEndian.Uint64(buf),
+		Type:           CertUser,
+		KeyFingerprint: Fingerprint(pub.Bytes()),
+	}
+	if binary.BigEndian.Uint32(buf[8:]) == 2 {
+		cert.Type = CertHost
+	}
+	keyID, buf, err := readString(buf[12:])
+	if err != nil {
+		return nil, err
+	}
+	cert.KeyID = string(keyID)
+	principals, buf, err := readString(buf)
+	if err != nil {
+		return nil, err
+	}
+	for len(principals) > 0 {
+		var p []byte
+		if p, principals, err = readString(principals); err != nil {
+			return nil, err
+		}
+		cert.Principals = append(cert.Principals, string(p))
+	}
+	if len(buf) < 16 {
+		return nil, errors.New("short certificate data")
+	}
+	cert.ValidAfter = certTime(binary.BigEndian.Uint64(buf))
+	cert.ValidBefore = certTime(binary.BigEndian.Uint64(buf[8:]))
+	return cert, nil
+}
+
+// certTime converts a certificate timestamp, where the maximum means
+// forever
+func certTime(t uint64) time.Time {
+	if t > math.MaxInt64/2 {
+		return time.Unix(math.MaxInt64/2, 0)
+	}
+	return time.Unix(int64(t), 0)
+}
+
+func (c *Certificate) info(path, line string) *protocol.SSHCertificate {
+	return &protocol.SSHCertificate{
+		Path:        path,
+		Type:        c.Type,
+		KeyID:       c.KeyID,
+		Serial:      c.Serial,
+		Principals:  c.Principals,
+		ValidAfter:  c.ValidAfter,
+		ValidBefore: c.ValidBefore,
+		Certificate: line,
+	}
+}
+
+// SetCA configures the certificate authority
+func (m *Manager) SetCA(ca CAConfig) error {
+	if ca.KeyPath != "" {
+		if _, err := os.Stat(ca.KeyPath); err != nil {
+			return fmt.Errorf("failed to read CA key: %w", err)
+		}
+	}
+	if ca.UserValidity <= 0 {
+		ca.UserValidity = DefaultCAConfig.UserValidity
+	}
+	if ca.HostValidity <= 0 {
+		ca.HostValidity = DefaultCAConfig.HostValidity
+	}
+	if ca.RenewBefore <= 0 || ca.RenewBefore >= ca.HostValidity {
+		ca.RenewBefore = ca.HostValidity / 7
+	}
+
+	m.mu.Lock()
+	m.ca = ca
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Manager) caConfig() CAConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ca
+}
+
+// IssueUserCert signs a user public key with the agent's CA. The
+// certificate is valid for the principals and at most the CA's user
+// validity.
+func (m *Manager) IssueUserCert(ctx context.Context, publicKey string, principals []string, validity time.Duration) (*protocol.SSHCertificate, error) {
+	ca := m.caConfig()
+	if ca.KeyPath == "" {
+		return nil, fmt.Errorf("no CA key configured")
+	}
+	if len(principals) == 0 {
+		return nil, fmt.Errorf("at least one principal required")
+	}
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if validity <= 0 || validity > ca.UserValidity {
+		validity = ca.UserValidity
+	}
+
+	keyID := principals[0] + "@" + hostname()
+	line, cert, err := signKey(ctx, ca.KeyPath, key, keyID, principals, validity, false)
+	if err != nil {
+		return nil, err
+	}
+	m.logger.Info("Issued SSH user certificate",
+		zap.String("key_id", keyID),
+		zap.Strings("principals", principals),
+		zap.String("fingerprint", key.Fingerprint),
+		zap.Time("valid_before", cert.ValidBefore))
+	return cert.info("", line), nil
+}
+
+// InstallCert installs a certificate for the user's private key at path
+func (m *Manager) InstallCert(userName, path, line string) (*protocol.SSHCertificate, error) {
+	u, err := LookupUser(userName)
+	if err != nil {
+		return nil, err
+	}
+	path, err = keyPath(u, path)
+	if err != nil {
+		return nil, err
+	}
+	// The user owns the key and its directory, which must not lead the
+	// agent to another user's key
+	for _, p := range []string{filepath.Dir(path), path} {
+		if info, err := os.Lstat(p); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return nil, fmt.Errorf("refusing to install a certificate for %s: %s is a symlink", path, p)
+		}
+	}
+	key, err := readPrivateKey(path)
+	if err != nil || key == nil {
+		return nil, fmt.Errorf("%s is not a private key", path)
+	}
+	cert, err := checkCert(line, key.Fingerprint, CertUser)
+	if err != nil {
+		return nil, err
+	}
+
+	certPath := path + certSuffix
+	if err := writeFile(certPath, []string{strings.TrimSpace(line)}, 0644, u.UID, u.GID); err != nil {
+		return nil, err
+	}
+	m.logger.Info("Installed SSH user certificate",
+		zap.String("user", u.Name),
+		zap.String("path", certPath),
+		zap.Time("valid_before", cert.ValidBefore))
+	return cert.info(certPath, ""), nil
+}
+
+// InstallHostCert installs a host certificate issued by the server next to
+// the host key it certifies and points sshd at it
+func (m *Manager) InstallHostCert(ctx context.Context, line string) (*protocol.SSHCertificate, error) {
+	keys, errs := discoverHostKeys()
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to read host keys: %s", strings.Join(errs, "; "))
+	}
+	cert, err := ParseCertificate(line)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Fingerprint != cert.KeyFingerprint {
+			continue
+		}
+		if _, err := checkCert(line, key.Fingerprint, CertHost); err != nil {
+			return nil, err
+		}
+		certPath := strings.TrimSuffix(key.Path, ".pub") + certSuffix
+		if err := m.installHostCerts(ctx, map[string]string{certPath: line}); err != nil {
+			return nil, err
+		}
+		return cert.info(certPath, ""), nil
+	}
+	return nil, fmt.Errorf("certificate does not match a host key")
+}
+
+// RenewHostCerts signs every host key with the agent's CA whose
+// certificate is missing or about to expire
+func (m *Manager) RenewHostCerts(ctx context.Context) ([]protocol.SSHCertificate, error) {
+	ca := m.caConfig()
+	if ca.KeyPath == "" {
+		return nil, fmt.Errorf("no CA key configured")
+	}
+	keys, errs := discoverHostKeys()
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to read host keys: %s", strings.Join(errs, "; "))
+	}
+
+	name := hostname()
+	renewed := make(map[string]string)
+	var certs []protocol.SSHCertificate
+	for _, key := range keys {
+		certPath := strings.TrimSuffix(key.Path, ".pub") + certSuffix
+		if lines, _ := readLines(certPath); len(lines) > 0 {
+			cert, err := ParseCertificate(lines[0])
+			if err == nil && cert.KeyFingerprint == key.Fingerprint && time.Until(cert.ValidBefore) > ca.RenewBefore {
+				continue
+			}
+		}
+
+		data, err := os.ReadFile(key.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read host key: %w", err)
+		}
+		pub, err := ParsePublicKey(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", key.Path, err)
+		}
+		line, cert, err := signKey(ctx, ca.KeyPath, pub, name, []string{name}, ca.HostValidity, true)
+		if err != nil {
+			return nil, err
+		}
+		renewed[certPath] = line
+		certs = append(certs, *cert.info(certPath, ""))
+	}
+	if len(renewed) == 0 {
+		return nil, nil
+	}
+
+	if err := m.installHostCerts(ctx, renewed); err != nil {
+		return nil, err
+	}
+	for _, c := range certs {
+		m.logger.Info("Renewed SSH host certificate",
+			zap.String("path", c.Path),
+			zap.Time("valid_before", c.ValidBefore))
+	}
+	return certs, nil
+}
+
+// renewHostCerts renews host certificates in the background when the
+// agent has a CA
+func (m *Manager) renewHostCerts(ctx context.Context) {
+	if m.caConfig().KeyPath == "" {
+		return
+	}
+	if _, err := m.RenewHostCerts(ctx); err != nil {
+		m.logger.Error("Failed to renew SSH host certificates", zap.Error(err))
+	}
+}
+
+// installHostCerts writes host certificates, adds a HostCertificate line
+// for each to sshd_config and reloads sshd
+func (m *Manager) installHostCerts(ctx context.Context, certs map[string]string) error {
+	for path, line := range certs {
+		if err := writeFile(path, []string{strings.TrimSpace(line)}, 0644, 0, 0); err != nil {
+			return err
+		}
+	}
+
+	config, err := readLines(sshdConfigFile)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for path := range certs {
+		var added bool
+		config, added = addSSHDOption(config, "HostCertificate", path)
+		changed = changed || added
+	}
+	if changed {
+		if err := writeSSHDConfig(ctx, config); err != nil {
+			return err
+		}
+	}
+	return reloadSSHD(ctx)
+}
+
+// TrustUserCA makes sshd accept user certificates signed by the given CA
+// keys. An empty list revokes trust in all CAs.
+func (m *Manager) TrustUserCA(ctx context.Context, caKeys []string) error {
+	lines := make([]string, 0, len(caKeys))
+	for _, k := range caKeys {
+		key, err := ParsePublicKey(k)
+		if err != nil {
+			return fmt.Errorf("invalid CA key: %w", err)
+		}
+		key.Options = ""
+		lines = append(lines, key.String())
+	}
+	if err := writeFile(trustedCAFile, lines, 0644, 0, 0); err != nil {
+		return err
+	}
+
+	config, err := readLines(sshdConfigFile)
+	if err != nil {
+		return err
+	}
+	if config, changed := setSSHDOption(config, "TrustedUserCAKeys", trustedCAFile); changed {
+		if err := writeSSHDConfig(ctx, config); err != nil {
+			return err
+		}
+	}
+	if err := reloadSSHD(ctx); err != nil {
+		return err
+	}
+	m.logger.Info("Updated trusted SSH user CAs", zap.Int("keys", len(lines)))
+	return nil
+}
+
+// checkCert parses a certificate and checks that it certifies the key
+// with the given fingerprint, is of the expected type and hasn't expired
+func checkCert(line, fingerprint, certType string) (*Certificate, error) {
+	cert, err := ParseCertificate(line)
+	if err != nil {
+		return nil, err
+	}
+	if cert.KeyFingerprint != fingerprint {
+		return nil, fmt.Errorf("certificate is for key %s, not %s", cert.KeyFingerprint, fingerprint)
+	}
+	if cert.Type != certType {
+		return nil, fmt.Errorf("expected a %s certificate, got a %s certificate", certType, cert.Type)
+	}
+	if !time.Now().Before(cert.ValidBefore) {
+		return nil, fmt.Errorf("certificate expired at %s", cert.ValidBefore)
+	}
+	return cert, nil
+}
+
+// signKey signs a public key with ssh-keygen in a scratch directory and
+// returns the certificate line
+func signKey(ctx context.Context, caKey string, key PublicKey, keyID string, principals []string, validity time.Duration, host bool) (string, *Certificate, error) {
+	dir, err := os.MkdirTemp("", "sshcert")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key.Options = ""
+	pubPath := filepath.Join(dir, "key.pub")
+	if err := os.WriteFile(pubPath, []byte(key.String()+"\n"), 0600); err != nil {
+		return "", nil, fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	args := []string{"-q", "-s", caKey, "-I", keyID,
+		"-n", strings.Join(principals, ","),
+		"-V", fmt.Sprintf("-%ds:+%ds", int64(clockSkew.Seconds()), int64(validity.Seconds())),
+		"-z", strconv.FormatUint(serial(), 10)}
+	if host {
+		args = append(args, "-h")
+	}
+	cmd := exec.CommandContext(ctx, "ssh-keygen", append(args, pubPath)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", nil, fmt.Errorf("failed to sign key: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "key"+certSuffix))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	line := strings.TrimSpace(string(data))
+	cert, err := ParseCertificate(line)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return line, cert, nil
+}
+
+func serial() uint64 {
+	var b [8]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// setSSHDOption sets a single-valued global sshd option, replacing its
+// first global occurrence or adding it before any Match block
+func setSSHDOption(lines []string, keyword, value string) ([]string, bool) {
+	want := keyword + " " + value
+	end := globalEnd(lines)
+	for i := 0; i < end; i++ {
+		if k, v := sshdOption(lines[i]); strings.EqualFold(k, keyword) {
+			if v == value {
+				return lines, false
+			}
+			result := append([]string(nil), lines...)
+			result[i] = want
+			return result, true
+		}
+	}
+	return insertLine(lines, end, want), true
+}
+
+// addSSHDOption adds a value of a multi-valued global sshd option unless
+// it is already present
+func addSSHDOption(lines []string, keyword, value string) ([]string, bool) {
+	end := globalEnd(lines)
+	for i := 0; i < end; i++ {
+		if k, v := sshdOption(lines[i]); strings.EqualFold(k, keyword) && v == value {
+			return lines, false
+		}
+	}
+	return insertLine(lines, end, keyword+" "+value), true
+}
+
+// globalEnd returns the index of the first Match block, after which
+// options only apply conditionally
+func globalEnd(lines []string) int {
+	for i, line := range lines {
+		if k, _ := sshdOption(line); strings.EqualFold(k, "Match") {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+func sshdOption(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	k, v := nextField(strings.Replace(line, "=", " ", 1))
+	return k, strings.TrimSpace(v)
+}
+
+func insertLine(lines []string, i int, line string) []string {
+	result := make([]string, 0, len(lines)+1)
+	result = append(result, lines[:i]...)
+	result = append(result, line)
+	return append(result, lines[i:]...)
+}
+
+// writeSSHDConfig validates a new sshd_config with sshd -t before putting
+// it in place, so a bad edit can't lock everyone out
+func writeSSHDConfig(ctx context.Context, lines []string) error {
+	check := sshdConfigFile + ".check"
+	if err := os.WriteFile(check, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", check, err)
+	}
+	defer os.Remove(check)
+
+	if output, err := exec.CommandContext(ctx, "sshd", "-t", "-f", check).CombinedOutput(); err != nil {
+		return fmt.Errorf("sshd rejected the new configuration: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+	return writeFile(sshdConfigFile, lines, 0644, 0, 0)
+}
+
+// reloadSSHD asks the ssh service to reload its configuration, which
+// leaves existing sessions alone
+func reloadSSHD(ctx context.Context) error {
+	var errs []error
+	for _, args := range [][]string{
+		{"systemctl", "reload", "sshd"},
+		{"systemctl", "reload", "ssh"},
+		{"service", "ssh", "reload"},
+	} {
+		output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %s", strings.Join(args, " "), strings.TrimSpace(string(output))))
+	}
+	return fmt.Errorf("failed to reload sshd: %w", errors.Join(errs...))
+}
@@ -0,0 +1,23 @@
+package sshkeys
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readLines returns the lines of a file, or nothing if it doesn't exist
+func readLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
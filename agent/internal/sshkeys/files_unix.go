@@ -0,0 +1,292 @@
+//go:build !windows
+
+package sshkeys
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// maxBackups bounds the backups of one file made within the same second
+	maxBackups = 10
+	// keepBackups is how many backups of a file are kept; older ones are
+	// removed as new ones are made
+	keepBackups = 5
+)
+
+// writeAuthorizedKeys replaces an authorized_keys file of u. The current
+// file is backed up first and the new one is written atomically with the
+// ownership and modes sshd's StrictModes expects.
+func writeAuthorizedKeys(u User, path string, lines []string) error {
+	dir := filepath.Dir(path)
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	d, err := openDir(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Chown(u.UID, u.GID); err != nil {
+		return fmt.Errorf("failed to set owner of %s: %w", dir, err)
+	}
+	return writeFile(path, lines, 0600, u.UID, u.GID)
+}
+
+// writeFile backs up path and atomically replaces it with lines, owned by
+// uid and gid. The agent runs as root in directories users own, so all
+// file operations are relative to the directory opened without following
+// symlinks, and path must not be a symlink either.
+func writeFile(path string, lines []string, perm os.FileMode, uid, gid int) error {
+	dir, err := openDir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	name := filepath.Base(path)
+
+	var stat unix.Stat_t
+	err = unix.Fstatat(int(dir.Fd()), name, &stat, unix.AT_SYMLINK_NOFOLLOW)
+	switch {
+	case err == nil:
+		if stat.Mode&unix.S_IFMT != unix.S_IFREG {
+			return fmt.Errorf("refusing to replace %s: not a regular file", path)
+		}
+		if _, err := backupFile(dir, name); err != nil {
+			return err
+		}
+	case !errors.Is(err, unix.ENOENT):
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	content := strings.Join(lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	tmpName := fmt.Sprintf(".%s.tmp-%d", name, time.Now().UnixNano())
+	if err := writeAt(dir, tmpName, []byte(content), perm, uid, gid); err != nil {
+		return err
+	}
+	if err := unix.Renameat(int(dir.Fd()), tmpName, int(dir.Fd()), name); err != nil {
+		unix.Unlinkat(int(dir.Fd()), tmpName, 0)
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeAt creates the file name in dir with data, owned by uid and gid.
+// Nothing is left behind when it fails.
+func writeAt(dir *os.File, name string, data []byte, perm os.FileMode, uid, gid int) error {
+	f, err := createAt(dir, name, perm)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Join(dir.Name(), name), err)
+	}
+	remove := func() { unix.Unlinkat(int(dir.Fd()), name, 0) }
+	if err := f.Chown(uid, gid); err != nil {
+		f.Close()
+		remove()
+		return fmt.Errorf("failed to set owner of %s: %w", f.Name(), err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		remove()
+		return fmt.Errorf("failed to write %s: %w", f.Name(), err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		remove()
+		return fmt.Errorf("failed to write %s: %w", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		remove()
+		return fmt.Errorf("failed to write %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// stageKey puts a generated key pair next to the key it replaces, as
+// staged and staged.pub owned by uid and gid, replacing an earlier staged
+// pair
+func stageKey(staged string, private, public []byte, uid, gid int) error {
+	dir, err := openDir(filepath.Dir(staged))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	name := filepath.Base(staged)
+
+	unstage(dir, name)
+	if err := writeAt(dir, name, private, 0600, uid, gid); err != nil {
+		return err
+	}
+	if err := writeAt(dir, name+".pub", public, 0644, uid, gid); err != nil {
+		unstage(dir, name)
+		return err
+	}
+	return nil
+}
+
+// swapKey backs up the key pair at path with backupSuffix and moves the
+// staged pair in its place. If the move fails the backup is restored.
+// Renames are relative to the opened key directory, so symlinks can't
+// redirect them.
+func swapKey(path, staged, backupSuffix string) error {
+	dir, err := openDir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	fd := int(dir.Fd())
+	name, stagedName := filepath.Base(path), filepath.Base(staged)
+	rename := func(from, to string) error { return unix.Renameat(fd, from, fd, to) }
+
+	var stat unix.Stat_t
+	if err := unix.Fstatat(fd, stagedName, &stat, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return fmt.Errorf("staged key missing: %w", err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFREG {
+		return fmt.Errorf("staged key %s is not a regular file", staged)
+	}
+
+	if err := rename(name, name+backupSuffix); err != nil {
+		return fmt.Errorf("failed to back up key: %w", err)
+	}
+	hasPub := rename(name+".pub", name+".pub"+backupSuffix) == nil
+
+	if err := rename(stagedName, name); err != nil {
+		rename(name+backupSuffix, name)
+		if hasPub {
+			rename(name+".pub"+backupSuffix, name+".pub")
+		}
+		return fmt.Errorf("failed to install key: %w", err)
+	}
+	if err := rename(stagedName+".pub", name+".pub"); err != nil {
+		return fmt.Errorf("failed to install public key: %w", err)
+	}
+	return nil
+}
+
+// removeStaged removes a staged key pair
+func removeStaged(staged string) {
+	dir, err := openDir(filepath.Dir(staged))
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+	unstage(dir, filepath.Base(staged))
+}
+
+func unstage(dir *os.File, name string) {
+	unix.Unlinkat(int(dir.Fd()), name, 0)
+	unix.Unlinkat(int(dir.Fd()), name+".pub", 0)
+}
+
+// backupFile copies the file name in dir next to itself with a timestamped
+// .bak suffix, keeping its owner and mode, and returns the backup's path
+func backupFile(dir *os.File, name string) (string, error) {
+	path := filepath.Join(dir.Name(), name)
+	fd, err := unix.Openat(int(dir.Fd()), name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	src := os.NewFile(uintptr(fd), path)
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+
+	// A backup never replaces an existing file, so several backups within
+	// a second get a counter
+	backup := fmt.Sprintf("%s.bak-%d", name, time.Now().Unix())
+	dst, err := createAt(dir, backup, info.Mode().Perm())
+	for i := 1; errors.Is(err, unix.EEXIST) && i < maxBackups; i++ {
+		backup = fmt.Sprintf("%s.bak-%d.%d", name, time.Now().Unix(), i)
+		dst, err = createAt(dir, backup, info.Mode().Perm())
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := dst.Chown(int(stat.Uid), int(stat.Gid)); err != nil {
+			dst.Close()
+			return "", fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	pruneBackups(dir, name)
+	return dst.Name(), nil
+}
+
+// pruneBackups removes all but the newest keepBackups backups of the file
+// name in dir
+func pruneBackups(dir *os.File, name string) {
+	entries, err := os.ReadDir(dir.Name())
+	if err != nil {
+		return
+	}
+	// Pruned names are reused within a second, so backups are ordered by
+	// when they were written
+	var backups []os.FileInfo
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), name+".bak-") || !e.Type().IsRegular() {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			backups = append(backups, info)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ModTime().Before(backups[j].ModTime()) })
+	for len(backups) > keepBackups {
+		unix.Unlinkat(int(dir.Fd()), backups[0].Name(), 0)
+		backups = backups[1:]
+	}
+}
+
+// openDir opens the directory at path, refusing a symlink
+func openDir(path string) (*os.File, error) {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if errors.Is(err, unix.ELOOP) || errors.Is(err, unix.ENOTDIR) {
+		return nil, fmt.Errorf("refusing to write in %s: not a directory", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// createAt creates the file name in dir with perm. It fails if name
+// exists, even as a symlink.
+func createAt(dir *os.File, name string, perm os.FileMode) (*os.File, error) {
+	fd, err := unix.Openat(int(dir.Fd()), name, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_NOFOLLOW|unix.O_CLOEXEC, uint32(perm))
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), filepath.Join(dir.Name(), name))
+	// The umask may have dropped permission bits
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		unix.Unlinkat(int(dir.Fd()), name, 0)
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,110 @@
+//go:build !windows
+
+package sshkeys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSwapKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		staged func(t *testing.T, staged string)
+		ok     bool
+	}{
+		{
+			name: "staged pair",
+			staged: func(t *testing.T, staged string) {
+				if err := stageKey(staged, []byte("new"), []byte("new.pub"), os.Getuid(), os.Getgid()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			ok: true,
+		},
+		{
+			name:   "nothing staged",
+			staged: func(t *testing.T, staged string) {},
+		},
+		{
+			name: "staged symlink",
+			staged: func(t *testing.T, staged string) {
+				if err := os.Symlink("/etc/hostname", staged); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "id_ed25519")
+			writeTestFile(t, path, "old")
+			writeTestFile(t, path+".pub", "old.pub")
+			tt.staged(t, path+stagedSuffix)
+
+			err := swapKey(path, path+stagedSuffix, ".bak-1")
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("swapped")
+				}
+				if got := readTestFile(t, path); got != "old" {
+					t.Errorf("key = %q after a failed swap, want old", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for file, want := range map[string]string{
+				path: "new", path + ".pub": "new.pub",
+				path + ".bak-1": "old", path + ".pub.bak-1": "old.pub",
+			} {
+				if got := readTestFile(t, file); got != want {
+					t.Errorf("%s = %q, want %q", filepath.Base(file), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFileKeepsBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "authorized_keys")
+	for i := 0; i < keepBackups+3; i++ {
+		if err := writeFile(path, []string{strings.Repeat("x", i)}, 0600, os.Getuid(), os.Getgid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := filepath.Glob(path + ".bak-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != keepBackups {
+		t.Fatalf("kept %d backups, want %d", len(backups), keepBackups)
+	}
+	// The oldest backups went first
+	for _, b := range backups {
+		if got := readTestFile(t, b); len(got) < 3 {
+			t.Errorf("kept the early backup %s", filepath.Base(b))
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,35 @@
+package sshkeys
+
+import (
+	"fmt"
+	"os"
+)
+
+// writeAuthorizedKeys is unsupported on Windows, where files can't be
+// given to a uid and gid
+func writeAuthorizedKeys(u User, path string, lines []string) error {
+	return fmt.Errorf("writing %s is not supported on Windows", path)
+}
+
+// writeFile is unsupported on Windows, where files can't be given to a
+// uid and gid
+func writeFile(path string, lines []string, perm os.FileMode, uid, gid int) error {
+	return fmt.Errorf("writing %s is not supported on Windows", path)
+}
+
+// stageKey is unsupported on Windows, where files can't be given to a uid
+// and gid
+func stageKey(staged string, private, public []byte, uid, gid int) error {
+	return fmt.Errorf("staging %s is not supported on Windows", staged)
+}
+
+// swapKey is unsupported on Windows, where keys are never staged
+func swapKey(path, staged, backupSuffix string) error {
+	return fmt.Errorf("replacing %s is not supported on Windows", path)
+}
+
+// removeStaged removes a staged key pair
+func removeStaged(staged string) {
+	os.Remove(staged)
+	os.Remove(staged + ".pub")
+}
@@ -0,0 +1,472 @@
+package sshkeys
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Rotation statuses
+const (
+	RotationPending  = "pending"
+	RotationApplied  = "applied"
+	RotationRejected = "rejected"
+	RotationExpired  = "expired"
+	RotationFailed   = "failed"
+)
+
+const (
+	// RotationTTL is how long a staged key waits for approval
+	RotationTTL = 24 * time.Hour
+	// rotationRetention is how long finished rotations are listed
+	rotationRetention = 7 * 24 * time.Hour
+	// stagedSuffix marks a generated key awaiting approval
+	stagedSuffix = ".rotating"
+	// policyInterval is how often authorized_keys are checked for drift
+	policyInterval = 5 * time.Minute
+)
+
+// Manager reports the host's SSH keys and changes them on the server's
+// request. Key rotation is two-phase: the agent stages a new key pair and
+// returns its public half, and only swaps it in once the server approves.
+type Manager struct {
+	logger     *zap.Logger
+	events     chan<- interface{}
+	rotations  map[string]*protocol.SSHKeyRotation
+	policies   map[string]protocol.SSHKeyPolicy
+	breakGlass map[string]bool
+	ca         CAConfig
+	mu         sync.Mutex
+	policyMu   sync.Mutex
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// NewManager creates an SSH key manager. Drift found by policy checks is
+// sent to events.
+func NewManager(logger *zap.Logger, events chan<- interface{}) *Manager {
+	return &Manager{
+		logger:     logger,
+		events:     events,
+		rotations:  make(map[string]*protocol.SSHKeyRotation),
+		policies:   make(map[string]protocol.SSHKeyPolicy),
+		breakGlass: make(map[string]bool),
+		ca:         DefaultCAConfig,
+	}
+}
+
+// Start expires unapproved rotations, enforces authorized_keys policies
+// and renews host certificates in the background
+func (m *Manager) Start(ctx context.Context) error {
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+		m.renewHostCerts(ctx)
+		expireTicker := time.NewTicker(time.Hour)
+		defer expireTicker.Stop()
+		policyTicker := time.NewTicker(policyInterval)
+		defer policyTicker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-expireTicker.C:
+				m.expire(now)
+				m.renewHostCerts(ctx)
+			case <-policyTicker.C:
+				m.Reconcile()
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the manager. Staged keys stay on disk until they expire
+// at the next start.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Inventory discovers the host's SSH keys
+func (m *Manager) Inventory() (*protocol.SSHKeyInventory, error) {
+	return Discover()
+}
+
+// Rotate stages a new ed25519 key pair to replace the private key at path
+// of user. The current key stays in use until Approve is called with the
+// rotation's ID.
+func (m *Manager) Rotate(ctx context.Context, userName, path string) (*protocol.SSHKeyRotation, error) {
+	u, err := LookupUser(userName)
+	if err != nil {
+		return nil, err
+	}
+	path, err = keyPath(u, path)
+	if err != nil {
+		return nil, err
+	}
+	current, err := readPrivateKey(path)
+	if err != nil || current == nil {
+		return nil, fmt.Errorf("%s is not a private key", path)
+	}
+
+	m.mu.Lock()
+	for _, r := range m.rotations {
+		if r.Path == path && r.Status == RotationPending {
+			m.mu.Unlock()
+			return nil, fmt.Errorf("rotation %s of %s is already pending", r.ID, path)
+		}
+	}
+	m.mu.Unlock()
+
+	// The key is generated where the user can't interfere, and only then
+	// written to their directory
+	scratch, err := os.MkdirTemp("", "sshkey")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(scratch)
+	comment := current.Comment
+	if comment == "" {
+		comment = u.Name + "@" + hostname()
+	}
+	generated := filepath.Join(scratch, "key")
+	cmd := exec.CommandContext(ctx, "ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", comment, "-f", generated)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+	private, err := os.ReadFile(generated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generated key: %w", err)
+	}
+	data, err := os.ReadFile(generated + ".pub")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generated key: %w", err)
+	}
+	pub, err := ParsePublicKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generated key: %w", err)
+	}
+	if err := stageKey(path+stagedSuffix, private, data, u.UID, u.GID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rotation := &protocol.SSHKeyRotation{
+		ID:             newID(),
+		User:           u.Name,
+		Path:           path,
+		OldFingerprint: current.Fingerprint,
+		NewFingerprint: pub.Fingerprint,
+		PublicKey:      pub.String(),
+		Status:         RotationPending,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(RotationTTL),
+	}
+	m.mu.Lock()
+	m.rotations[rotation.ID] = rotation
+	m.mu.Unlock()
+
+	m.logger.Info("SSH key rotation staged, awaiting approval",
+		zap.String("id", rotation.ID),
+		zap.String("user", u.Name),
+		zap.String("path", path),
+		zap.String("fingerprint", pub.Fingerprint))
+	result := *rotation
+	return &result, nil
+}
+
+// Approve puts a staged key in place. The replaced key pair is kept next
+// to it with a .bak suffix.
+func (m *Manager) Approve(id string) (*protocol.SSHKeyRotation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rotation, err := m.pending(id)
+	if err != nil {
+		return nil, err
+	}
+
+	staged := rotation.Path + stagedSuffix
+	suffix := fmt.Sprintf(".bak-%d", time.Now().Unix())
+	err = swapKey(rotation.Path, staged, suffix)
+	now := time.Now()
+	rotation.CompletedAt = &now
+	if err != nil {
+		rotation.Status = RotationFailed
+		rotation.Error = err.Error()
+		removeStaged(staged)
+		m.logger.Error("SSH key rotation failed", zap.String("id", id), zap.Error(err))
+		return nil, err
+	}
+
+	rotation.Status = RotationApplied
+	m.logger.Info("SSH key rotated",
+		zap.String("id", id),
+		zap.String("path", rotation.Path),
+		zap.String("old_fingerprint", rotation.OldFingerprint),
+		zap.String("new_fingerprint", rotation.NewFingerprint))
+	result := *rotation
+	return &result, nil
+}
+
+// Reject discards a staged key
+func (m *Manager) Reject(id string) (*protocol.SSHKeyRotation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rotation, err := m.pending(id)
+	if err != nil {
+		return nil, err
+	}
+	removeStaged(rotation.Path + stagedSuffix)
+	now := time.Now()
+	rotation.Status = RotationRejected
+	rotation.CompletedAt = &now
+
+	m.logger.Info("SSH key rotation rejected", zap.String("id", id))
+	result := *rotation
+	return &result, nil
+}
+
+// Rotations returns the pending and recently finished rotations, newest
+// first
+func (m *Manager) Rotations() []protocol.SSHKeyRotation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rotations := make([]protocol.SSHKeyRotation, 0, len(m.rotations))
+	for _, r := range m.rotations {
+		rotations = append(rotations, *r)
+	}
+	sort.Slice(rotations, func(i, j int) bool { return rotations[i].CreatedAt.After(rotations[j].CreatedAt) })
+	return rotations
+}
+
+// pending returns a rotation awaiting approval. The caller holds m.mu.
+func (m *Manager) pending(id string) (*protocol.SSHKeyRotation, error) {
+	rotation, ok := m.rotations[id]
+	if !ok {
+		return nil, protocol.Errorf(protocol.ErrorNotFound, "rotation not found: %s", id)
+	}
+	if rotation.Status != RotationPending {
+		return nil, fmt.Errorf("rotation %s is %s", id, rotation.Status)
+	}
+	if time.Now().After(rotation.ExpiresAt) {
+		return nil, fmt.Errorf("rotation %s has expired", id)
+	}
+	return rotation, nil
+}
+
+// expire discards staged keys that were not approved in time and drops
+// old finished rotations
+func (m *Manager) expire(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, r := range m.rotations {
+		switch {
+		case r.Status == RotationPending && now.After(r.ExpiresAt):
+			removeStaged(r.Path + stagedSuffix)
+			r.Status = RotationExpired
+			r.CompletedAt = &now
+			m.logger.Info("SSH key rotation expired", zap.String("id", id))
+		case r.CompletedAt != nil && now.Sub(*r.CompletedAt) > rotationRetention:
+			delete(m.rotations, id)
+		}
+	}
+}
+
+// Authorize adds a public key to the user's authorized_keys. Keys already
+// present are left alone.
+func (m *Manager) Authorize(userName, publicKey string) (*protocol.SSHKey, error) {
+	u, err := LookupUser(userName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	path := filepath.Join(u.SSHDir(), "authorized_keys")
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if existing, err := ParsePublicKey(line); err == nil && existing.Fingerprint == key.Fingerprint {
+			return publicKeyInfo(u, path, key), nil
+		}
+	}
+
+	if err := writeAuthorizedKeys(u, path, append(lines, key.String())); err != nil {
+		return nil, err
+	}
+	m.logger.Info("Authorized SSH key",
+		zap.String("user", u.Name),
+		zap.String("fingerprint", key.Fingerprint))
+	return publicKeyInfo(u, path, key), nil
+}
+
+// Revoke removes the key with the given fingerprint from the user's
+// authorized_keys
+func (m *Manager) Revoke(userName, fingerprint string) error {
+	if m.isBreakGlass(fingerprint) {
+		return fmt.Errorf("key %s is a break-glass key and cannot be revoked", fingerprint)
+	}
+	u, err := LookupUser(userName)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(u.SSHDir(), "authorized_keys")
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+	kept := lines[:0:0]
+	removed := 0
+	for _, line := range lines {
+		if key, err := ParsePublicKey(line); err == nil && key.Fingerprint == fingerprint {
+			removed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if removed == 0 {
+		return fmt.Errorf("key %s is not authorized for %s", fingerprint, u.Name)
+	}
+
+	if err := writeAuthorizedKeys(u, path, kept); err != nil {
+		return err
+	}
+	m.logger.Info("Revoked SSH key",
+		zap.String("user", u.Name),
+		zap.String("fingerprint", fingerprint))
+	return nil
+}
+
+// HandleRequest applies an SSH key request received from the server
+func (m *Manager) HandleRequest(ctx context.Context, req protocol.SSHKeyRequest) (interface{}, error) {
+	switch req.Action {
+	case "", "inventory":
+		return m.Inventory()
+	case "rotate":
+		return m.Rotate(ctx, req.User, req.Path)
+	case "approve":
+		return m.Approve(req.RotationID)
+	case "reject":
+		return m.Reject(req.RotationID)
+	case "rotations":
+		return m.Rotations(), nil
+	case "authorize":
+		return m.Authorize(req.User, req.PublicKey)
+	case "revoke":
+		return nil, m.Revoke(req.User, req.Fingerprint)
+	case "policy":
+		return m.SetPolicies(req.Policies)
+	case "drift":
+		return m.Reconcile(), nil
+	case "issue_cert":
+		return m.IssueUserCert(ctx, req.PublicKey, req.Principals, time.Duration(req.ValiditySeconds)*time.Second)
+	case "install_cert":
+		if req.User == "" {
+			return m.InstallHostCert(ctx, req.Certificate)
+		}
+		return m.InstallCert(req.User, req.Path, req.Certificate)
+	case "trust_ca":
+		return nil, m.TrustUserCA(ctx, req.CAKeys)
+	case "renew_host_certs":
+		return m.RenewHostCerts(ctx)
+	default:
+		return nil, fmt.Errorf("unknown ssh key action: %s", req.Action)
+	}
+}
+
+// HandleCommand processes SSH key commands
+func (m *Manager) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "sshkeys:inventory":
+		return m.Inventory()
+	case "sshkeys:rotations":
+		return m.Rotations(), nil
+	case "sshkeys:drift":
+		return m.Reconcile(), nil
+	case "sshkeys:rotate":
+		if len(args) < 2 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "user and key path required")
+		}
+		return m.Rotate(ctx, args[0], args[1])
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown sshkeys command: %s", cmd)
+	}
+}
+
+// keyPath resolves path relative to the user's .ssh directory and refuses
+// paths outside it
+func keyPath(u User, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("key path required")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(u.SSHDir(), path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(u.SSHDir(), path)
+	if err != nil || strings.HasPrefix(rel, "..") || strings.ContainsRune(rel, filepath.Separator) {
+		return "", fmt.Errorf("%s is not in %s", path, u.SSHDir())
+	}
+	return path, nil
+}
+
+func publicKeyInfo(u User, path string, key PublicKey) *protocol.SSHKey {
+	return &protocol.SSHKey{
+		User:        u.Name,
+		Path:        path,
+		Kind:        KindAuthorized,
+		Type:        key.Type,
+		Bits:        key.Bits,
+		Fingerprint: key.Fingerprint,
+		Comment:     key.Comment,
+		Options:     key.Options,
+		ModTime:     time.Now(),
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "rot_" + hex.EncodeToString(b)
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return name
+}
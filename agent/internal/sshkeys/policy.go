@@ -0,0 +1,193 @@
+package sshkeys
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// SetBreakGlass sets the fingerprints of keys that policies may never
+// remove. They are kept in every authorized_keys file they are found in.
+func (m *Manager) SetBreakGlass(fingerprints []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.breakGlass = make(map[string]bool, len(fingerprints))
+	for _, f := range fingerprints {
+		m.breakGlass[f] = true
+	}
+}
+
+func (m *Manager) isBreakGlass(fingerprint string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.breakGlass[fingerprint]
+}
+
+// SetPolicies replaces the desired authorized keys of all users and
+// reconciles them right away. Users without a policy are left alone.
+func (m *Manager) SetPolicies(policies []protocol.SSHKeyPolicy) ([]protocol.SSHKeyDrift, error) {
+	desired := make(map[string]protocol.SSHKeyPolicy, len(policies))
+	for _, p := range policies {
+		if _, ok := desired[p.User]; ok {
+			return nil, fmt.Errorf("duplicate policy for user %s", p.User)
+		}
+		if _, err := LookupUser(p.User); err != nil {
+			return nil, err
+		}
+		for _, line := range p.Keys {
+			if _, err := ParsePublicKey(line); err != nil {
+				return nil, fmt.Errorf("invalid key in policy for %s: %w", p.User, err)
+			}
+		}
+		desired[p.User] = p
+	}
+
+	m.mu.Lock()
+	m.policies = desired
+	m.mu.Unlock()
+
+	m.logger.Info("SSH key policies updated", zap.Int("users", len(desired)))
+	return m.Reconcile(), nil
+}
+
+// Reconcile compares every user's authorized_keys with its policy and
+// rewrites the files of enforced policies that drifted. It returns the
+// drift found, including for policies that were fixed.
+func (m *Manager) Reconcile() []protocol.SSHKeyDrift {
+	m.policyMu.Lock()
+	defer m.policyMu.Unlock()
+
+	m.mu.Lock()
+	policies := make([]protocol.SSHKeyPolicy, 0, len(m.policies))
+	for _, p := range m.policies {
+		policies = append(policies, p)
+	}
+	breakGlass := make(map[string]bool, len(m.breakGlass))
+	for f := range m.breakGlass {
+		breakGlass[f] = true
+	}
+	m.mu.Unlock()
+	sort.Slice(policies, func(i, j int) bool { return policies[i].User < policies[j].User })
+
+	var drifts []protocol.SSHKeyDrift
+	for _, p := range policies {
+		drift := m.reconcileUser(p, breakGlass)
+		if !hasDrift(drift) && drift.Error == "" {
+			continue
+		}
+		m.logger.Warn("SSH authorized keys drifted from policy",
+			zap.String("user", drift.User),
+			zap.Int("missing", len(drift.Missing)),
+			zap.Int("unexpected", len(drift.Unexpected)),
+			zap.Int("changed", len(drift.Changed)),
+			zap.Bool("reconciled", drift.Reconciled),
+			zap.String("error", drift.Error))
+		m.emit(drift)
+		drifts = append(drifts, drift)
+	}
+	return drifts
+}
+
+// reconcileUser diffs one user's authorized_keys against the policy. Keys
+// are matched by fingerprint; comments and blank lines are kept, duplicate
+// keys dropped. Break-glass keys missing from the policy are kept and
+// reported as protected.
+func (m *Manager) reconcileUser(p protocol.SSHKeyPolicy, breakGlass map[string]bool) protocol.SSHKeyDrift {
+	drift := protocol.SSHKeyDrift{User: p.User, CheckedAt: time.Now()}
+	u, err := LookupUser(p.User)
+	if err != nil {
+		drift.Error = err.Error()
+		return drift
+	}
+	drift.Path = filepath.Join(u.SSHDir(), "authorized_keys")
+
+	desired := make(map[string]PublicKey, len(p.Keys))
+	var order []string
+	for _, line := range p.Keys {
+		key, err := ParsePublicKey(line)
+		if err != nil {
+			drift.Error = err.Error()
+			return drift
+		}
+		if _, ok := desired[key.Fingerprint]; !ok {
+			order = append(order, key.Fingerprint)
+		}
+		desired[key.Fingerprint] = key
+	}
+
+	lines, err := readLines(drift.Path)
+	if err != nil {
+		drift.Error = err.Error()
+		return drift
+	}
+
+	var result []string
+	present := make(map[string]bool)
+	duplicates := false
+	for _, line := range lines {
+		key, err := ParsePublicKey(line)
+		if err != nil {
+			result = append(result, line)
+			continue
+		}
+		if present[key.Fingerprint] {
+			duplicates = true
+			continue
+		}
+		present[key.Fingerprint] = true
+
+		want, ok := desired[key.Fingerprint]
+		switch {
+		case !ok && breakGlass[key.Fingerprint]:
+			drift.Protected = append(drift.Protected, key.Fingerprint)
+			result = append(result, line)
+		case !ok:
+			drift.Unexpected = append(drift.Unexpected, key.Fingerprint)
+		case key.Options != want.Options:
+			drift.Changed = append(drift.Changed, key.Fingerprint)
+			result = append(result, want.String())
+		default:
+			result = append(result, line)
+		}
+	}
+	for _, f := range order {
+		if !present[f] {
+			drift.Missing = append(drift.Missing, f)
+			result = append(result, desired[f].String())
+		}
+	}
+
+	if !p.Enforce || (!hasDrift(drift) && !duplicates) {
+		return drift
+	}
+	if err := writeAuthorizedKeys(u, drift.Path, result); err != nil {
+		drift.Error = err.Error()
+		return drift
+	}
+	drift.Reconciled = true
+	m.logger.Info("Reconciled SSH authorized keys",
+		zap.String("user", u.Name),
+		zap.String("path", drift.Path))
+	return drift
+}
+
+func hasDrift(d protocol.SSHKeyDrift) bool {
+	return len(d.Missing) > 0 || len(d.Unexpected) > 0 || len(d.Changed) > 0
+}
+
+func (m *Manager) emit(drift protocol.SSHKeyDrift) {
+	if m.events == nil {
+		return
+	}
+	select {
+	case m.events <- drift:
+	default:
+		m.logger.Warn("Failed to send SSH key drift: channel full")
+	}
+}
@@ -0,0 +1,145 @@
+//go:build !windows
+
+package sshkeys
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+func TestReconcileUser(t *testing.T) {
+	a, b, c, glass := testKey(1, "a@laptop"), testKey(2, "b@laptop"), testKey(3, "c@old"), testKey(4, "break-glass")
+	fp := func(line string) string {
+		key, err := ParsePublicKey(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key.Fingerprint
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		file    []string // nil when there is none
+		keys    []string
+		enforce bool
+		// drift expected, by fingerprint
+		missing, unexpected, changed, protected []string
+		reconciled                              bool
+		error                                   bool
+		want                                    []string // file afterwards
+	}{
+		{
+			name: "in sync", file: []string{a, b}, keys: []string{a, b}, enforce: true,
+			want: []string{a, b},
+		},
+		{
+			name: "missing key", file: []string{a}, keys: []string{a, b}, enforce: true,
+			missing: []string{fp(b)}, reconciled: true, want: []string{a, b},
+		},
+		{
+			name: "unexpected key", file: []string{a, c}, keys: []string{a}, enforce: true,
+			unexpected: []string{fp(c)}, reconciled: true, want: []string{a},
+		},
+		{
+			name: "changed options", file: []string{a}, keys: []string{"no-pty " + a}, enforce: true,
+			changed: []string{fp(a)}, reconciled: true, want: []string{"no-pty " + a},
+		},
+		{
+			name: "break-glass key kept", file: []string{a, glass}, keys: []string{a}, enforce: true,
+			protected: []string{fp(glass)}, want: []string{a, glass},
+		},
+		{
+			name: "only reported", file: []string{a, c}, keys: []string{a, b},
+			missing: []string{fp(b)}, unexpected: []string{fp(c)}, want: []string{a, c},
+		},
+		{
+			name: "comments kept, duplicates dropped", file: []string{"# deploy keys", a, "", a}, keys: []string{a}, enforce: true,
+			reconciled: true, want: []string{"# deploy keys", a, ""},
+		},
+		{
+			name: "no file yet", keys: []string{a}, enforce: true,
+			missing: []string{fp(a)}, reconciled: true, want: []string{a},
+		},
+		{
+			name: "unknown user", user: "mallory", keys: []string{a}, enforce: true,
+			error: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			passwd := filepath.Join(t.TempDir(), "passwd")
+			entry := fmt.Sprintf("alice:x:%d:%d::%s:/bin/sh\n", os.Getuid(), os.Getgid(), home)
+			if err := os.WriteFile(passwd, []byte(entry), 0644); err != nil {
+				t.Fatal(err)
+			}
+			defer func(previous string) { passwdFile = previous }(passwdFile)
+			passwdFile = passwd
+
+			path := filepath.Join(home, ".ssh", "authorized_keys")
+			if tt.file != nil {
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					t.Fatal(err)
+				}
+				writeTestFile(t, path, strings.Join(tt.file, "\n")+"\n")
+			}
+			user := tt.user
+			if user == "" {
+				user = "alice"
+			}
+
+			m := NewManager(zap.NewNop(), nil)
+			drift := m.reconcileUser(protocol.SSHKeyPolicy{User: user, Keys: tt.keys, Enforce: tt.enforce}, map[string]bool{fp(glass): true})
+			if tt.error {
+				if drift.Error == "" {
+					t.Error("no error")
+				}
+				return
+			}
+			if drift.Error != "" {
+				t.Fatal(drift.Error)
+			}
+			for _, f := range []struct {
+				field     string
+				got, want []string
+			}{
+				{"missing", drift.Missing, tt.missing},
+				{"unexpected", drift.Unexpected, tt.unexpected},
+				{"changed", drift.Changed, tt.changed},
+				{"protected", drift.Protected, tt.protected},
+			} {
+				if !reflect.DeepEqual(f.got, f.want) {
+					t.Errorf("%s = %q, want %q", f.field, f.got, f.want)
+				}
+			}
+			if drift.Reconciled != tt.reconciled {
+				t.Errorf("reconciled = %v, want %v", drift.Reconciled, tt.reconciled)
+			}
+			if got, want := readTestFile(t, path), strings.Join(tt.want, "\n")+"\n"; got != want {
+				t.Errorf("authorized_keys =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+// testKey returns an ed25519 authorized_keys line whose key bytes are all
+// seed
+func testKey(seed byte, comment string) string {
+	var blob []byte
+	for _, field := range [][]byte{[]byte("ssh-ed25519"), []byte(strings.Repeat(string(seed), 32))} {
+		blob = binary.BigEndian.AppendUint32(blob, uint32(len(field)))
+		blob = append(blob, field...)
+	}
+	return "ssh-ed25519 " + base64.StdEncoding.EncodeToString(blob) + " " + comment
+}
@@ -1,25 +1,277 @@
+// Package sshkeys inventories SSH keys on the host and changes them on the
+// server's behalf. Only public key material leaves the host.
 package sshkeys
 
 import (
-	"io/ioutil"
+	"bufio"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"shh/agent/internal/protocol"
 )
 
-// DiscoverKeys finds SSH keys in the user's .ssh directory.
-func DiscoverKeys() ([]string, error) {
-	var keys []string
-	sshDir := filepath.Join(os.Getenv("HOME"), ".ssh")
+// passwdFile lists the local users; tests point it elsewhere
+var passwdFile = "/etc/passwd"
+
+// hostKeyDir holds the sshd host keys
+const hostKeyDir = "/etc/ssh"
+
+// maxKeyFileSize bounds key files read during discovery
+const maxKeyFileSize = 1024 * 1024
+
+// authorizedKeysFiles are the default AuthorizedKeysFile entries of sshd
+var authorizedKeysFiles = []string{"authorized_keys", "authorized_keys2"}
+
+// User is a local account
+type User struct {
+	Name  string
+	UID   int
+	GID   int
+	Home  string
+	Shell string
+}
+
+// SSHDir returns the user's .ssh directory
+func (u User) SSHDir() string {
+	return filepath.Join(u.Home, ".ssh")
+}
+
+// Users returns the local accounts from /etc/passwd
+func Users() ([]User, error) {
+	file, err := os.Open(passwdFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	defer file.Close()
+
+	var users []User
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 7 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		uid, err1 := strconv.Atoi(fields[2])
+		gid, err2 := strconv.Atoi(fields[3])
+		if err1 != nil || err2 != nil || fields[5] == "" {
+			continue
+		}
+		users = append(users, User{
+			Name:  fields[0],
+			UID:   uid,
+			GID:   gid,
+			Home:  fields[5],
+			Shell: fields[6],
+		})
+	}
+	return users, scanner.Err()
+}
+
+// LookupUser returns the local account called name
+func LookupUser(name string) (User, error) {
+	users, err := Users()
+	if err != nil {
+		return User{}, err
+	}
+	for _, u := range users {
+		if u.Name == name {
+			return u, nil
+		}
+	}
+	return User{}, fmt.Errorf("unknown user: %s", name)
+}
 
-	files, err := ioutil.ReadDir(sshDir)
+// Discover inventories the authorized keys and key pairs of every user
+// with a .ssh directory, and the host keys. Problems with single files are
+// reported in the inventory rather than failing it.
+func Discover() (*protocol.SSHKeyInventory, error) {
+	users, err := Users()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, file := range files {
-		if file.Mode().Perm() == 0400 || file.Mode().Perm() == 0600 {
-			keys = append(keys, filepath.Join(sshDir, file.Name()))
+	inventory := &protocol.SSHKeyInventory{CollectedAt: time.Now()}
+	seen := make(map[string]bool)
+	for _, u := range users {
+		// Several accounts may share a home directory
+		if seen[u.SSHDir()] {
+			continue
+		}
+		seen[u.SSHDir()] = true
+
+		keys, errs := discoverUser(u)
+		inventory.Keys = append(inventory.Keys, keys...)
+		inventory.Errors = append(inventory.Errors, errs...)
+	}
+
+	keys, errs := discoverHostKeys()
+	inventory.Keys = append(inventory.Keys, keys...)
+	inventory.Errors = append(inventory.Errors, errs...)
+
+	sort.Slice(inventory.Keys, func(i, j int) bool {
+		if inventory.Keys[i].Path != inventory.Keys[j].Path {
+			return inventory.Keys[i].Path < inventory.Keys[j].Path
+		}
+		return inventory.Keys[i].Fingerprint < inventory.Keys[j].Fingerprint
+	})
+	return inventory, nil
+}
+
+// discoverUser lists the keys in one user's .ssh directory
+func discoverUser(u User) ([]protocol.SSHKey, []string) {
+	entries, err := os.ReadDir(u.SSHDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, []string{fmt.Sprintf("%s: %v", u.SSHDir(), err)}
+	}
+
+	var keys []protocol.SSHKey
+	var errs []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(u.SSHDir(), entry.Name())
+		var found []protocol.SSHKey
+		var err error
+
+		switch {
+		case isAuthorizedKeysFile(entry.Name()):
+			found, err = readPublicKeys(path, KindAuthorized)
+		case strings.HasSuffix(entry.Name(), ".pub"):
+			found, err = readPublicKeys(path, KindPublic)
+		case isCandidatePrivateKey(entry.Name()):
+			var key *protocol.SSHKey
+			if key, err = readPrivateKey(path); key != nil {
+				found = []protocol.SSHKey{*key}
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", path, err))
+		}
+		for i := range found {
+			found[i].User = u.Name
 		}
+		keys = append(keys, found...)
+	}
+	return keys, errs
+}
+
+// discoverHostKeys lists the sshd host keys by their public halves
+func discoverHostKeys() ([]protocol.SSHKey, []string) {
+	paths, _ := filepath.Glob(filepath.Join(hostKeyDir, "ssh_host_*_key.pub"))
+	var keys []protocol.SSHKey
+	var errs []string
+	for _, path := range paths {
+		found, err := readPublicKeys(path, KindHost)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", path, err))
+		}
+		keys = append(keys, found...)
+	}
+	return keys, errs
+}
+
+func isAuthorizedKeysFile(name string) bool {
+	for _, f := range authorizedKeysFiles {
+		if name == f {
+			return true
+		}
+	}
+	return false
+}
+
+// isCandidatePrivateKey filters out files in .ssh that are known not to
+// be private keys
+func isCandidatePrivateKey(name string) bool {
+	switch name {
+	case "known_hosts", "known_hosts.old", "config", "environment", "rc":
+		return false
+	}
+	return !strings.Contains(name, ".bak") && !strings.HasSuffix(name, ".old")
+}
+
+// readPublicKeys parses every key line of an authorized_keys or .pub file
+func readPublicKeys(path, kind string) ([]protocol.SSHKey, error) {
+	info, data, err := readKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []protocol.SSHKey
+	for _, line := range strings.Split(string(data), "\n") {
+		key, err := ParsePublicKey(line)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, protocol.SSHKey{
+			Path:        path,
+			Kind:        kind,
+			Type:        key.Type,
+			Bits:        key.Bits,
+			Fingerprint: key.Fingerprint,
+			Comment:     key.Comment,
+			Options:     key.Options,
+			ModTime:     info.ModTime(),
+		})
 	}
 	return keys, nil
 }
+
+// readPrivateKey describes a private key by its public half, taken from
+// the key itself or from the matching .pub file. Files that aren't private
+// keys return nil.
+func readPrivateKey(path string) (*protocol.SSHKey, error) {
+	info, data, err := readKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	blob, encrypted, err := privateKeyInfo(data)
+	if err != nil {
+		return nil, nil
+	}
+
+	key := &protocol.SSHKey{
+		Path:      path,
+		Kind:      KindPrivate,
+		Encrypted: encrypted,
+		ModTime:   info.ModTime(),
+	}
+	if pub, err := readPublicKeys(path+".pub", KindPublic); err == nil && len(pub) > 0 {
+		key.Type = pub[0].Type
+		key.Bits = pub[0].Bits
+		key.Fingerprint = pub[0].Fingerprint
+		key.Comment = pub[0].Comment
+	} else if blob != nil {
+		keyType, _, err := readString(blob)
+		if err != nil {
+			return nil, fmt.Errorf("malformed public key in private key")
+		}
+		key.Type = string(keyType)
+		key.Bits = keyBits(key.Type, blob)
+		key.Fingerprint = Fingerprint(blob)
+	}
+	return key, nil
+}
+
+func readKeyFile(path string) (os.FileInfo, []byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() > maxKeyFileSize {
+		return nil, nil, fmt.Errorf("file too large")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, data, nil
+}
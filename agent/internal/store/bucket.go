@@ -0,0 +1,151 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket holds records of type T by key, stored as JSON
+type Bucket[T any] struct {
+	store *Store
+	name  []byte
+}
+
+// NewBucket returns the bucket name of s. The bucket is created by a
+// migration.
+func NewBucket[T any](s *Store, name string) *Bucket[T] {
+	return &Bucket[T]{store: s, name: []byte(name)}
+}
+
+// Get returns the record stored under key
+func (b *Bucket[T]) Get(key string) (T, bool, error) {
+	var value T
+	var found bool
+	err := b.store.db.View(func(tx *bolt.Tx) error {
+		bucket, err := b.bucket(tx)
+		if err != nil {
+			return err
+		}
+		data := bucket.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &value)
+	})
+	if err != nil {
+		return value, false, fmt.Errorf("failed to read %s/%s: %w", b.name, key, err)
+	}
+	return value, found, nil
+}
+
+// Put stores value under key
+func (b *Bucket[T]) Put(key string, value T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s/%s: %w", b.name, key, err)
+	}
+	err = b.store.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := b.bucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", b.name, key, err)
+	}
+	return nil
+}
+
+// Delete removes the record under key
+func (b *Bucket[T]) Delete(key string) error {
+	err := b.store.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := b.bucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", b.name, key, err)
+	}
+	return nil
+}
+
+// All returns every record by key
+func (b *Bucket[T]) All() (map[string]T, error) {
+	values := make(map[string]T)
+	err := b.store.db.View(func(tx *bolt.Tx) error {
+		bucket, err := b.bucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, data []byte) error {
+			var value T
+			if err := json.Unmarshal(data, &value); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			values[string(k)] = value
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", b.name, err)
+	}
+	return values, nil
+}
+
+// Replace stores exactly values, removing records not among them, in one
+// transaction
+func (b *Bucket[T]) Replace(values map[string]T) error {
+	encoded := make(map[string][]byte, len(values))
+	for key, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s/%s: %w", b.name, key, err)
+		}
+		encoded[key] = data
+	}
+	err := b.store.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := b.bucket(tx)
+		if err != nil {
+			return err
+		}
+		var stale [][]byte
+		err = bucket.ForEach(func(k, _ []byte) error {
+			if _, ok := encoded[string(k)]; !ok {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		for key, data := range encoded {
+			if err := bucket.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", b.name, err)
+	}
+	return nil
+}
+
+func (b *Bucket[T]) bucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	bucket := tx.Bucket(b.name)
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket %s does not exist", b.name)
+	}
+	return bucket, nil
+}
@@ -0,0 +1,178 @@
+// Package store is the agent's persistent local state: an embedded bbolt
+// database under the data directory, holding typed buckets of JSON
+// records. The schema is versioned and upgraded by migrations when the
+// store is opened.
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// FileName is the name of the database in the data directory
+const FileName = "state.db"
+
+// Buckets of the agent's managers
+const (
+	BucketUpdates   = "updates"
+	BucketTransfers = "transfers"
+	BucketProblems  = "problems"
+	BucketScanJobs  = "scan_jobs"
+	// BucketDeadLetters holds the messages whose handlers kept failing
+	BucketDeadLetters = "dead_letters"
+	// BucketCommands holds the replies to executed commands by
+	// idempotency key
+	BucketCommands = "commands"
+	// BucketConfigChanges holds the change history of managed configs
+	BucketConfigChanges = "config_changes"
+	// BucketLogPositions holds where reading of each log source stopped
+	BucketLogPositions = "log_positions"
+)
+
+const (
+	// metaBucket holds the schema version
+	metaBucket = "meta"
+	versionKey = "schema_version"
+	// openTimeout bounds waiting for another process holding the database
+	openTimeout = 5 * time.Second
+)
+
+// Migration upgrades the store to Version. Migrations run in order inside
+// one transaction each, and only once.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(tx *bolt.Tx) error
+}
+
+// migrations are the schema changes of the store, oldest first. Append
+// new ones; never change or reorder released ones.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create the manager buckets",
+		Apply:       createBuckets(BucketUpdates, BucketTransfers, BucketProblems, BucketScanJobs),
+	},
+	{
+		Version:     2,
+		Description: "create the dead letter bucket",
+		Apply:       createBuckets(BucketDeadLetters),
+	},
+	{
+		Version:     3,
+		Description: "create the executed command bucket",
+		Apply:       createBuckets(BucketCommands),
+	},
+	{
+		Version:     4,
+		Description: "create the config change bucket",
+		Apply:       createBuckets(BucketConfigChanges),
+	},
+	{
+		Version:     5,
+		Description: "create the log position bucket",
+		Apply:       createBuckets(BucketLogPositions),
+	},
+}
+
+// Store is the agent's local state database
+type Store struct {
+	db   *bolt.DB
+	path string
+}
+
+// Open opens the store in dataDir, creating it if needed, and migrates it
+// to the current schema
+func Open(dataDir string) (*Store, error) {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	path := filepath.Join(dataDir, FileName)
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store %s: %w", path, err)
+	}
+	s := &Store{db: db, path: path}
+	if err := s.migrate(migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the database file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Close closes the store
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Version returns the schema version of the store
+func (s *Store) Version() (int, error) {
+	var version int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+		return nil
+	})
+	return version, err
+}
+
+// migrate applies the migrations newer than the store's schema
+func (s *Store) migrate(migrations []Migration) error {
+	current, err := s.Version()
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			if err := m.Apply(tx); err != nil {
+				return err
+			}
+			meta, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+			if err != nil {
+				return err
+			}
+			return meta.Put([]byte(versionKey), binary.BigEndian.AppendUint64(nil, uint64(m.Version)))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate state store to version %d (%s): %w", m.Version, m.Description, err)
+		}
+		current = m.Version
+	}
+	return nil
+}
+
+func schemaVersion(tx *bolt.Tx) int {
+	meta := tx.Bucket([]byte(metaBucket))
+	if meta == nil {
+		return 0
+	}
+	v := meta.Get([]byte(versionKey))
+	if len(v) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+// createBuckets is a migration creating buckets
+func createBuckets(names ...string) func(tx *bolt.Tx) error {
+	return func(tx *bolt.Tx) error {
+		for _, name := range names {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+}
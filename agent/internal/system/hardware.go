@@ -0,0 +1,321 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/protocol"
+)
+
+// hardwareFile caches the last inventory in the data directory, so that
+// parts swapped while the host was down are detected
+const hardwareFile = "hardware.json"
+
+// DefaultHardwareInterval is how often the hardware is inventoried
+const DefaultHardwareInterval = 6 * time.Hour
+
+// Hardware is the inventory of the host's hardware. Serial numbers are
+// only readable by root.
+type Hardware struct {
+	System      DMI         `json:"system"`
+	DIMMs       []DIMM      `json:"dimms,omitempty"`
+	Disks       []Disk      `json:"disks,omitempty"`
+	NICs        []NIC       `json:"nics,omitempty"`
+	PCI         []PCIDevice `json:"pci,omitempty"`
+	CollectedAt time.Time   `json:"collected_at"`
+	// ChangedAt is when the hardware last differed from the inventory
+	// before it
+	ChangedAt time.Time `json:"changed_at,omitempty"`
+}
+
+// DMI is the system identity reported by the firmware
+type DMI struct {
+	Vendor      string `json:"vendor,omitempty"`
+	Model       string `json:"model,omitempty"`
+	Serial      string `json:"serial,omitempty"`
+	UUID        string `json:"uuid,omitempty"`
+	BoardVendor string `json:"board_vendor,omitempty"`
+	BoardModel  string `json:"board_model,omitempty"`
+	BoardSerial string `json:"board_serial,omitempty"`
+	BIOSVendor  string `json:"bios_vendor,omitempty"`
+	BIOSVersion string `json:"bios_version,omitempty"`
+	BIOSDate    string `json:"bios_date,omitempty"`
+	ChassisType string `json:"chassis_type,omitempty"`
+}
+
+// DIMM is an installed memory module
+type DIMM struct {
+	Locator      string `json:"locator"`
+	Size         uint64 `json:"size"`
+	Type         string `json:"type,omitempty"`
+	Speed        string `json:"speed,omitempty"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	PartNumber   string `json:"part_number,omitempty"`
+}
+
+// Disk is a physical block device
+type Disk struct {
+	Name       string `json:"name"`
+	Model      string `json:"model,omitempty"`
+	Vendor     string `json:"vendor,omitempty"`
+	Serial     string `json:"serial,omitempty"`
+	Size       uint64 `json:"size"`
+	Rotational bool   `json:"rotational"`
+}
+
+// NIC is a physical network interface
+type NIC struct {
+	Name   string `json:"name"`
+	MAC    string `json:"mac"`
+	Driver string `json:"driver,omitempty"`
+	// Speed in Mbit/s, 0 when the link is down
+	Speed int `json:"speed,omitempty"`
+}
+
+// PCIDevice is a device on the PCI bus
+type PCIDevice struct {
+	Slot     string `json:"slot"`
+	Class    string `json:"class"`
+	VendorID string `json:"vendor_id"`
+	DeviceID string `json:"device_id"`
+	Vendor   string `json:"vendor,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Driver   string `json:"driver,omitempty"`
+}
+
+// components identifies the parts of the inventory, so that inventories
+// can be compared part by part
+func (h *Hardware) components() map[string]string {
+	c := map[string]string{
+		"system": fmt.Sprintf("%s %s serial %s", h.System.Vendor, h.System.Model, h.System.Serial),
+		"board":  fmt.Sprintf("%s %s serial %s", h.System.BoardVendor, h.System.BoardModel, h.System.BoardSerial),
+		"bios":   fmt.Sprintf("%s %s", h.System.BIOSVendor, h.System.BIOSVersion),
+	}
+	for _, d := range h.DIMMs {
+		c["dimm:"+d.Locator] = fmt.Sprintf("%d bytes %s %s serial %s", d.Size, d.Type, d.Manufacturer, d.Serial)
+	}
+	for _, d := range h.Disks {
+		c["disk:"+d.Name] = fmt.Sprintf("%s %d bytes serial %s", d.Model, d.Size, d.Serial)
+	}
+	for _, n := range h.NICs {
+		c["nic:"+n.Name] = n.MAC
+	}
+	for _, p := range h.PCI {
+		c["pci:"+p.Slot] = p.VendorID + ":" + p.DeviceID
+	}
+	return c
+}
+
+// diffHardware returns the change from previous to current, nil if
+// nothing changed
+func diffHardware(previous, current *Hardware) *protocol.HardwareChange {
+	before, after := previous.components(), current.components()
+	change := &protocol.HardwareChange{Timestamp: current.CollectedAt}
+	for key, desc := range after {
+		old, ok := before[key]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, key+": "+desc)
+		case old != desc:
+			change.Changed = append(change.Changed, fmt.Sprintf("%s: %s -> %s", key, old, desc))
+		}
+	}
+	for key, desc := range before {
+		if _, ok := after[key]; !ok {
+			change.Removed = append(change.Removed, key+": "+desc)
+		}
+	}
+	if len(change.Added)+len(change.Removed)+len(change.Changed) == 0 {
+		return nil
+	}
+	sort.Strings(change.Added)
+	sort.Strings(change.Removed)
+	sort.Strings(change.Changed)
+	return change
+}
+
+// HardwareCollector inventories the hardware periodically and reports
+// parts that were added, removed or replaced
+type HardwareCollector struct {
+	logger   *zap.Logger
+	path     string
+	events   chan<- interface{}
+	interval time.Duration
+
+	mu      sync.RWMutex
+	current *Hardware
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewHardwareCollector creates a collector caching its inventory in
+// dataDir and publishing changes to events
+func NewHardwareCollector(logger *zap.Logger, dataDir string, events chan<- interface{}) *HardwareCollector {
+	return &HardwareCollector{
+		logger:   logger,
+		path:     filepath.Join(dataDir, hardwareFile),
+		events:   events,
+		interval: DefaultHardwareInterval,
+	}
+}
+
+// Start loads the cached inventory and collects a new one periodically
+// until Shutdown
+func (c *HardwareCollector) Start(ctx context.Context) error {
+	if cached, err := c.load(); err != nil {
+		c.logger.Warn("Failed to read cached hardware inventory", zap.Error(err))
+	} else {
+		c.mu.Lock()
+		c.current = cached
+		c.mu.Unlock()
+	}
+
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	crash.Go("hardware", func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			if _, err := c.Collect(ctx); err != nil && ctx.Err() == nil {
+				c.logger.Warn("Failed to collect hardware inventory", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown stops collecting
+func (c *HardwareCollector) Shutdown(ctx context.Context) error {
+	if c.cancel == nil {
+		return nil
+	}
+	c.cancel()
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get returns the cached inventory, nil before the first one
+func (c *HardwareCollector) Get() *Hardware {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.current
+}
+
+// Collect inventories the hardware, reports the changes since the cached
+// inventory and caches the new one
+func (c *HardwareCollector) Collect(ctx context.Context) (*Hardware, error) {
+	hw, err := collectHardware(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hw.CollectedAt = time.Now()
+
+	c.mu.Lock()
+	previous := c.current
+	var change *protocol.HardwareChange
+	if previous != nil {
+		hw.ChangedAt = previous.ChangedAt
+		if change = diffHardware(previous, hw); change != nil {
+			hw.ChangedAt = hw.CollectedAt
+		}
+	} else {
+		hw.ChangedAt = hw.CollectedAt
+	}
+	c.current = hw
+	c.mu.Unlock()
+
+	if err := c.save(hw); err != nil {
+		c.logger.Warn("Failed to cache hardware inventory", zap.Error(err))
+	}
+	if change != nil {
+		c.logger.Info("Hardware changed",
+			zap.Strings("added", change.Added),
+			zap.Strings("removed", change.Removed),
+			zap.Strings("changed", change.Changed))
+		c.publish(*change)
+	}
+	return hw, nil
+}
+
+// HandleCommand processes hardware inventory commands
+func (c *HardwareCollector) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "system:inventory":
+		// system:inventory [refresh]
+		if len(args) > 0 && args[0] == "refresh" {
+			return c.Collect(ctx)
+		}
+		if hw := c.Get(); hw != nil {
+			return hw, nil
+		}
+		return c.Collect(ctx)
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown system command: %s", cmd)
+	}
+}
+
+func (c *HardwareCollector) publish(change protocol.HardwareChange) {
+	if c.events == nil {
+		return
+	}
+	select {
+	case c.events <- change:
+	default:
+		c.logger.Warn("Failed to send hardware change: channel full")
+	}
+}
+
+// load reads the cached inventory, nil if there is none
+func (c *HardwareCollector) load() (*Hardware, error) {
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hardware inventory: %w", err)
+	}
+	var hw Hardware
+	if err := json.Unmarshal(data, &hw); err != nil {
+		return nil, fmt.Errorf("failed to parse hardware inventory: %w", err)
+	}
+	return &hw, nil
+}
+
+// save caches the inventory atomically, readable by root only since it
+// holds serial numbers
+func (c *HardwareCollector) save(hw *Hardware) error {
+	data, err := json.Marshal(hw)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hardware inventory: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write hardware inventory: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write hardware inventory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Where the kernel exposes the hardware
+const (
+	dmiDir      = "/sys/class/dmi/id"
+	blockDir    = "/sys/block"
+	netDir      = "/sys/class/net"
+	pciDir      = "/sys/bus/pci/devices"
+	udevDataDir = "/run/udev/data"
+)
+
+// noDIMMSerial is what dmidecode reports for modules without a serial
+const noDIMMSerial = "Not Specified"
+
+// virtualDisks are the prefixes of block devices with no hardware behind
+// them
+var virtualDisks = []string{"loop", "ram", "zram", "dm-", "md", "nbd", "sr", "fd"}
+
+// collectHardware reads the hardware from sysfs. DIMMs need dmidecode
+// and PCI names lspci; without them those are left out or unnamed.
+func collectHardware(ctx context.Context) (*Hardware, error) {
+	hw := &Hardware{
+		System: DMI{
+			Vendor:      readSysfs(dmiDir, "sys_vendor"),
+			Model:       readSysfs(dmiDir, "product_name"),
+			Serial:      readSysfs(dmiDir, "product_serial"),
+			UUID:        readSysfs(dmiDir, "product_uuid"),
+			BoardVendor: readSysfs(dmiDir, "board_vendor"),
+			BoardModel:  readSysfs(dmiDir, "board_name"),
+			BoardSerial: readSysfs(dmiDir, "board_serial"),
+			BIOSVendor:  readSysfs(dmiDir, "bios_vendor"),
+			BIOSVersion: readSysfs(dmiDir, "bios_version"),
+			BIOSDate:    readSysfs(dmiDir, "bios_date"),
+			ChassisType: readSysfs(dmiDir, "chassis_type"),
+		},
+		DIMMs: dimms(ctx),
+		Disks: disks(),
+		NICs:  nics(),
+		PCI:   pciDevices(ctx),
+	}
+	return hw, nil
+}
+
+// readSysfs returns the trimmed content of a sysfs attribute, empty if
+// it can't be read
+func readSysfs(elem ...string) string {
+	data, err := os.ReadFile(filepath.Join(elem...))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// dimms parses the memory devices dmidecode reports from SMBIOS
+func dimms(ctx context.Context) []DIMM {
+	output, err := exec.CommandContext(ctx, "dmidecode", "-t", "17").Output()
+	if err != nil {
+		return nil
+	}
+
+	var result []DIMM
+	var current *DIMM
+	flush := func() {
+		if current != nil && current.Size > 0 {
+			result = append(result, *current)
+		}
+		current = nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "Memory Device" {
+			flush()
+			current = &DIMM{}
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if current == nil || !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Size":
+			current.Size = dimmSize(value)
+		case "Locator":
+			current.Locator = value
+		case "Type":
+			current.Type = value
+		case "Speed":
+			current.Speed = value
+		case "Manufacturer":
+			current.Manufacturer = value
+		case "Serial Number":
+			if value != noDIMMSerial {
+				current.Serial = value
+			}
+		case "Part Number":
+			current.PartNumber = value
+		}
+	}
+	flush()
+	return result
+}
+
+// dimmSize parses sizes such as "16 GB" or "16384 MB"; empty slots read
+// "No Module Installed" and have none
+func dimmSize(value string) uint64 {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return 0
+	}
+	n, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0
+	}
+	switch fields[1] {
+	case "kB", "KB":
+		return n << 10
+	case "MB":
+		return n << 20
+	case "GB":
+		return n << 30
+	case "TB":
+		return n << 40
+	}
+	return 0
+}
+
+// disks lists the block devices backed by hardware
+func disks() []Disk {
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil
+	}
+	var result []Disk
+	for _, entry := range entries {
+		name := entry.Name()
+		if isVirtualDisk(name) {
+			continue
+		}
+		dev := filepath.Join(blockDir, name)
+		sectors, _ := strconv.ParseUint(readSysfs(dev, "size"), 10, 64)
+		disk := Disk{
+			Name:       name,
+			Model:      readSysfs(dev, "device", "model"),
+			Vendor:     readSysfs(dev, "device", "vendor"),
+			Serial:     readSysfs(dev, "device", "serial"),
+			Size:       sectors * 512,
+			Rotational: readSysfs(dev, "queue", "rotational") == "1",
+		}
+		if disk.Serial == "" {
+			disk.Serial = udevProperty(readSysfs(dev, "dev"), "ID_SERIAL_SHORT")
+		}
+		result = append(result, disk)
+	}
+	return result
+}
+
+func isVirtualDisk(name string) bool {
+	for _, prefix := range virtualDisks {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// udevProperty returns a property udev recorded for the block device
+// numbered dev ("major:minor")
+func udevProperty(dev, key string) string {
+	if dev == "" {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(udevDataDir, "b"+dev))
+	if err != nil {
+		return ""
+	}
+	prefix := "E:" + key + "="
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimPrefix(line, prefix)
+		}
+	}
+	return ""
+}
+
+// nics lists the network interfaces backed by a device
+func nics() []NIC {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var result []NIC
+	for _, iface := range interfaces {
+		dev := filepath.Join(netDir, iface.Name)
+		if _, err := os.Stat(filepath.Join(dev, "device")); err != nil {
+			continue
+		}
+		nic := NIC{Name: iface.Name, MAC: iface.HardwareAddr.String()}
+		if driver, err := os.Readlink(filepath.Join(dev, "device", "driver")); err == nil {
+			nic.Driver = filepath.Base(driver)
+		}
+		if speed, err := strconv.Atoi(readSysfs(dev, "speed")); err == nil && speed > 0 {
+			nic.Speed = speed
+		}
+		result = append(result, nic)
+	}
+	return result
+}
+
+// pciDevices lists the PCI devices, named by lspci when it is installed
+func pciDevices(ctx context.Context) []PCIDevice {
+	entries, err := os.ReadDir(pciDir)
+	if err != nil {
+		return nil
+	}
+	names := pciNames(ctx)
+	result := make([]PCIDevice, 0, len(entries))
+	for _, entry := range entries {
+		dev := filepath.Join(pciDir, entry.Name())
+		device := PCIDevice{
+			Slot:     entry.Name(),
+			Class:    strings.TrimPrefix(readSysfs(dev, "class"), "0x"),
+			VendorID: strings.TrimPrefix(readSysfs(dev, "vendor"), "0x"),
+			DeviceID: strings.TrimPrefix(readSysfs(dev, "device"), "0x"),
+		}
+		if name, ok := names[device.Slot]; ok {
+			device.Vendor, device.Device = name[0], name[1]
+		}
+		if driver, err := os.Readlink(filepath.Join(dev, "driver")); err == nil {
+			device.Driver = filepath.Base(driver)
+		}
+		result = append(result, device)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Slot < result[j].Slot })
+	return result
+}
+
+// pciNames returns the vendor and device names lspci knows by slot
+func pciNames(ctx context.Context) map[string][2]string {
+	names := make(map[string][2]string)
+	output, err := exec.CommandContext(ctx, "lspci", "-mm", "-D").Output()
+	if err != nil {
+		return names
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// slot "class" "vendor" "device" ...
+		fields := quotedFields(scanner.Text())
+		if len(fields) >= 4 {
+			names[fields[0]] = [2]string{fields[2], fields[3]}
+		}
+	}
+	return names
+}
+
+// quotedFields splits a line of space-separated, optionally quoted
+// fields
+func quotedFields(line string) []string {
+	var fields []string
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return append(fields, line[1:])
+			}
+			fields = append(fields, line[1:end+1])
+			line = line[end+2:]
+			continue
+		}
+		end := strings.IndexByte(line, ' ')
+		if end < 0 {
+			return append(fields, line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+	return fields
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package system
+
+import (
+	"context"
+	"fmt"
+)
+
+func collectHardware(ctx context.Context) (*Hardware, error) {
+	return nil, fmt.Errorf("hardware inventory is only supported on Linux")
+}
@@ -0,0 +1,182 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/protocol"
+)
+
+// DefaultInfoInterval is how often the system info is refreshed
+const DefaultInfoInterval = time.Hour
+
+// InfoCollector caches the system info and reports when it changes
+type InfoCollector struct {
+	logger   *zap.Logger
+	events   chan<- interface{}
+	interval time.Duration
+
+	mu       sync.RWMutex
+	current  *SystemInfo
+	observer func(*SystemInfo)
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewInfoCollector creates a collector publishing changes to events
+func NewInfoCollector(logger *zap.Logger, events chan<- interface{}) *InfoCollector {
+	return &InfoCollector{
+		logger:   logger,
+		events:   events,
+		interval: DefaultInfoInterval,
+	}
+}
+
+// OnChange calls observe with the first info and every changed one. It
+// must be called before Start.
+func (c *InfoCollector) OnChange(observe func(*SystemInfo)) {
+	c.observer = observe
+}
+
+// Start collects the info right away, so that it is known when the agent
+// registers, then refreshes it until Shutdown
+func (c *InfoCollector) Start(ctx context.Context) error {
+	if _, err := c.Refresh(); err != nil {
+		c.logger.Warn("Failed to collect system info", zap.Error(err))
+	}
+
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	crash.Go("system-info", func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := c.Refresh(); err != nil {
+				c.logger.Warn("Failed to collect system info", zap.Error(err))
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown stops refreshing
+func (c *InfoCollector) Shutdown(ctx context.Context) error {
+	if c.cancel == nil {
+		return nil
+	}
+	c.cancel()
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get returns the cached info, nil before the first one
+func (c *InfoCollector) Get() *SystemInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.current
+}
+
+// Refresh collects the info and reports it if it changed. Memory usage
+// changes all the time and is not compared.
+func (c *InfoCollector) Refresh() (*SystemInfo, error) {
+	info, err := GetSystemInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	previous := c.current
+	c.current = info
+	c.mu.Unlock()
+
+	if previous == nil {
+		c.notify(info)
+		return info, nil
+	}
+	changes := infoChanges(previous, info)
+	if len(changes) == 0 {
+		return info, nil
+	}
+	c.logger.Info("System info changed", zap.Strings("changes", changes))
+	c.notify(info)
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal system info: %w", err)
+	}
+	if c.events != nil {
+		select {
+		case c.events <- protocol.SystemInfoChange{Changes: changes, Info: data, Timestamp: time.Now()}:
+		default:
+			c.logger.Warn("Failed to send system info change: channel full")
+		}
+	}
+	return info, nil
+}
+
+// HandleCommand processes system info commands
+func (c *InfoCollector) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "system:info":
+		// system:info [refresh]
+		if info := c.Get(); info != nil && (len(args) == 0 || args[0] != "refresh") {
+			return info, nil
+		}
+		return c.Refresh()
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown system command: %s", cmd)
+	}
+}
+
+func (c *InfoCollector) notify(info *SystemInfo) {
+	if c.observer != nil {
+		c.observer(info)
+	}
+}
+
+// infoChanges lists the fields that differ between two infos
+func infoChanges(previous, current *SystemInfo) []string {
+	var changes []string
+	compare := func(field string, old, cur interface{}) {
+		if o, n := fmt.Sprint(old), fmt.Sprint(cur); o != n {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", field, o, n))
+		}
+	}
+	compare("hostname", previous.Hostname, current.Hostname)
+	compare("platform", previous.Platform, current.Platform)
+	compare("os", previous.OS, current.OS)
+	compare("version", previous.Version, current.Version)
+	compare("architecture", previous.Architecture, current.Architecture)
+	compare("cpu_info", cpuModels(previous.CPUInfo), cpuModels(current.CPUInfo))
+	compare("memory_total", previous.MemoryInfo.Total, current.MemoryInfo.Total)
+	compare("swap_total", previous.MemoryInfo.SwapTotal, current.MemoryInfo.SwapTotal)
+	compare("capabilities", previous.Capabilities, current.Capabilities)
+	return changes
+}
+
+// cpuModels summarizes the CPUs without their frequency, which scales
+// with the load
+func cpuModels(cpus []CPU) []string {
+	models := make([]string, len(cpus))
+	for i, cpu := range cpus {
+		models[i] = fmt.Sprintf("%s (%d cores)", cpu.Model, cpu.Cores)
+	}
+	return models
+}
@@ -0,0 +1,77 @@
+//go:build !windows
+
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd
+const listenFDsStart = 3
+
+var (
+	activationOnce sync.Once
+	activated      map[string][]net.Listener
+	activationErr  error
+)
+
+// Listeners returns the sockets passed by systemd socket activation, by
+// the FileDescriptorName of their socket unit ("unknown" when unnamed).
+// The sockets are taken from the environment once; later calls return the
+// same listeners.
+func Listeners() (map[string][]net.Listener, error) {
+	activationOnce.Do(func() {
+		activated, activationErr = listeners()
+	})
+	return activated, activationErr
+}
+
+// Listener returns the first activated socket called name, or nil
+func Listener(name string) net.Listener {
+	all, err := Listeners()
+	if err != nil || len(all[name]) == 0 {
+		return nil
+	}
+	return all[name][0]
+}
+
+func listeners() (map[string][]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	result := make(map[string][]net.Listener)
+	for i := 0; i < count; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return result, fmt.Errorf("activated socket %d (%s) is not a listener: %w", fd, name, err)
+		}
+		result[name] = append(result[name], listener)
+	}
+	return result, nil
+}
@@ -0,0 +1,13 @@
+package systemd
+
+import "net"
+
+// Listeners returns nothing on Windows, which has no socket activation
+func Listeners() (map[string][]net.Listener, error) {
+	return nil, nil
+}
+
+// Listener returns nil on Windows
+func Listener(name string) net.Listener {
+	return nil
+}
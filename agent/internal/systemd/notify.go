@@ -0,0 +1,175 @@
+// Package systemd integrates the agent with systemd: readiness and
+// shutdown notifications, the service watchdog and socket activation
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+)
+
+// Notification states, see sd_notify(3)
+const (
+	StateReady     = "READY=1"
+	StateStopping  = "STOPPING=1"
+	StateReloading = "RELOADING=1"
+	StateWatchdog  = "WATCHDOG=1"
+)
+
+// Notifier sends notifications to systemd and keeps its watchdog fed. It
+// does nothing when the agent isn't run by systemd as a Type=notify
+// service.
+type Notifier struct {
+	logger   *zap.Logger
+	addr     *net.UnixAddr
+	watchdog time.Duration
+	// check decides whether the watchdog is fed; an error lets systemd
+	// restart the agent once the watchdog timeout passes
+	check  func() error
+	status func() string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewNotifier creates a notifier from the environment systemd sets
+func NewNotifier(logger *zap.Logger) *Notifier {
+	n := &Notifier{logger: logger}
+	if socket := os.Getenv("NOTIFY_SOCKET"); socket != "" {
+		// A leading @ names a socket in the abstract namespace
+		if socket[0] == '@' {
+			socket = "\x00" + socket[1:]
+		}
+		n.addr = &net.UnixAddr{Name: socket, Net: "unixgram"}
+	}
+	n.watchdog = watchdogInterval()
+	return n
+}
+
+// watchdogInterval returns the watchdog timeout systemd set for this
+// process, or 0 if there is none
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Enabled reports whether the agent runs under systemd supervision
+func (n *Notifier) Enabled() bool {
+	return n.addr != nil
+}
+
+// SetWatchdogCheck sets what decides whether the watchdog is fed, and
+// what status is shown by systemctl status
+func (n *Notifier) SetWatchdogCheck(check func() error, status func() string) {
+	n.check = check
+	n.status = status
+}
+
+// Notify sends states, such as StateReady, to systemd
+func (n *Notifier) Notify(states ...string) error {
+	if n.addr == nil {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, n.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	var msg []byte
+	for _, s := range states {
+		msg = append(msg, s...)
+		msg = append(msg, '\n')
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// Ready tells systemd the agent has started
+func (n *Notifier) Ready() {
+	if err := n.Notify(StateReady, n.statusLine()); err != nil {
+		n.logger.Warn("Failed to notify systemd", zap.Error(err))
+	}
+}
+
+// Stopping tells systemd the agent is shutting down
+func (n *Notifier) Stopping() {
+	if err := n.Notify(StateStopping, "STATUS=Shutting down"); err != nil {
+		n.logger.Warn("Failed to notify systemd", zap.Error(err))
+	}
+}
+
+// Start feeds the watchdog at half its timeout while the watchdog check
+// passes
+func (n *Notifier) Start(ctx context.Context) error {
+	if n.addr == nil || n.watchdog == 0 {
+		return nil
+	}
+	ctx, n.cancel = context.WithCancel(ctx)
+	n.done = make(chan struct{})
+	n.logger.Info("systemd watchdog enabled", zap.Duration("timeout", n.watchdog))
+
+	crash.Go("systemd-watchdog", func() {
+		defer close(n.done)
+		ticker := time.NewTicker(n.watchdog / 2)
+		defer ticker.Stop()
+		failing := false
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n.check != nil {
+					if err := n.check(); err != nil {
+						if !failing {
+							n.logger.Error("Withholding systemd watchdog keepalive", zap.Error(err))
+						}
+						failing = true
+						continue
+					}
+				}
+				failing = false
+				if err := n.Notify(StateWatchdog, n.statusLine()); err != nil {
+					n.logger.Warn("Failed to feed systemd watchdog", zap.Error(err))
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown stops feeding the watchdog
+func (n *Notifier) Shutdown(ctx context.Context) error {
+	if n.cancel == nil {
+		return nil
+	}
+	n.cancel()
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (n *Notifier) statusLine() string {
+	if n.status == nil {
+		return "STATUS=Running"
+	}
+	return "STATUS=" + n.status()
+}
@@ -0,0 +1,271 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/health"
+)
+
+const (
+	// DefaultUnitInterval is how often units are listed
+	DefaultUnitInterval = time.Minute
+	// restartLoopRestarts are the restarts between two listings that make
+	// a restart loop
+	restartLoopRestarts = 3
+)
+
+// Unit is a systemd unit in trouble
+type Unit struct {
+	Name        string `json:"name"`
+	ActiveState string `json:"active_state"`
+	SubState    string `json:"sub_state"`
+	Description string `json:"description,omitempty"`
+	// Restarts is the count of automatic restarts systemd made
+	Restarts int `json:"restarts,omitempty"`
+}
+
+// UnitStatus lists the failed units and those in restart loops, as
+// systemctl --failed would
+type UnitStatus struct {
+	Failed       []Unit    `json:"failed"`
+	RestartLoops []Unit    `json:"restart_loops"`
+	Checked      time.Time `json:"checked"`
+}
+
+// UnitMonitor lists the failed and restarting units periodically
+type UnitMonitor struct {
+	logger   *zap.Logger
+	interval time.Duration
+
+	mu     sync.RWMutex
+	status *UnitStatus
+	err    error
+	// restarts are the restart counts of the previous listing by unit
+	restarts map[string]int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewUnitMonitor creates a unit monitor
+func NewUnitMonitor(logger *zap.Logger) *UnitMonitor {
+	return &UnitMonitor{
+		logger:   logger,
+		interval: DefaultUnitInterval,
+		restarts: make(map[string]int),
+	}
+}
+
+// Start lists the units until Shutdown. Hosts without systemd are left
+// alone.
+func (m *UnitMonitor) Start(ctx context.Context) error {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		m.logger.Debug("systemctl not found, not monitoring units")
+		return nil
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	crash.Go("systemd-units", func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			m.refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown stops listing units
+func (m *UnitMonitor) Shutdown(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the latest listing, nil before the first one or without
+// systemd
+func (m *UnitMonitor) Status() *UnitStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// Check reports the host degraded while units have failed or are
+// restarting in a loop
+func (m *UnitMonitor) Check(ctx context.Context) *health.CheckResult {
+	m.mu.RLock()
+	status, err := m.status, m.err
+	m.mu.RUnlock()
+
+	result := &health.CheckResult{Status: health.StatusHealthy, Timestamp: time.Now()}
+	if status == nil {
+		if err != nil {
+			result.Message = fmt.Sprintf("units unknown: %v", err)
+		}
+		return result
+	}
+	result.Metadata = map[string]interface{}{
+		"failed":        unitNames(status.Failed),
+		"restart_loops": unitNames(status.RestartLoops),
+	}
+	if len(status.Failed) > 0 || len(status.RestartLoops) > 0 {
+		result.Status = health.StatusDegraded
+		result.Message = fmt.Sprintf("%d failed units, %d in restart loops", len(status.Failed), len(status.RestartLoops))
+	}
+	return result
+}
+
+func (m *UnitMonitor) refresh(ctx context.Context) {
+	status, err := m.list(ctx)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.logger.Warn("Failed to list systemd units", zap.Error(err))
+		m.err = err
+		return
+	}
+	m.status, m.err = status, nil
+}
+
+// list lists the failed units and the services systemd restarted at
+// least restartLoopRestarts times since the previous listing, or that
+// are waiting to be restarted again
+func (m *UnitMonitor) list(ctx context.Context) (*UnitStatus, error) {
+	status := &UnitStatus{Checked: time.Now()}
+	failed, err := listUnits(ctx, "--failed")
+	if err != nil {
+		return nil, err
+	}
+	status.Failed = failed
+
+	services, err := listUnits(ctx, "--type=service", "--state=active,activating,failed")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(services))
+	for _, unit := range services {
+		names = append(names, unit.Name)
+	}
+	restarts, err := restartCounts(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	previous := m.restarts
+	m.mu.RUnlock()
+	for _, unit := range services {
+		unit.Restarts = restarts[unit.Name]
+		grown := unit.Restarts - previous[unit.Name]
+		if unit.SubState == "auto-restart" || (len(previous) > 0 && grown >= restartLoopRestarts) {
+			status.RestartLoops = append(status.RestartLoops, unit)
+		}
+	}
+	m.mu.Lock()
+	m.restarts = restarts
+	m.mu.Unlock()
+	return status, nil
+}
+
+// listUnits runs systemctl list-units with args
+func listUnits(ctx context.Context, args ...string) ([]Unit, error) {
+	args = append([]string{"list-units", "--all", "--plain", "--no-legend", "--no-pager"}, args...)
+	output, err := systemctl(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var units []Unit
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// UNIT LOAD ACTIVE SUB DESCRIPTION, failed units possibly marked
+		// with a leading bullet
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "●"))
+		if len(fields) < 4 {
+			continue
+		}
+		units = append(units, Unit{
+			Name:        fields[0],
+			ActiveState: fields[2],
+			SubState:    fields[3],
+			Description: strings.Join(fields[4:], " "),
+		})
+	}
+	return units, scanner.Err()
+}
+
+// restartCounts returns the automatic restarts of units by name
+func restartCounts(ctx context.Context, units []string) (map[string]int, error) {
+	counts := make(map[string]int, len(units))
+	if len(units) == 0 {
+		return counts, nil
+	}
+	output, err := systemctl(ctx, append([]string{"show", "--property=Id,NRestarts"}, units...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Units are separated by blank lines
+	var id string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Id":
+			id = value
+		case "NRestarts":
+			if n, err := strconv.Atoi(value); err == nil && id != "" {
+				counts[id] = n
+			}
+		}
+	}
+	return counts, scanner.Err()
+}
+
+func systemctl(ctx context.Context, args ...string) ([]byte, error) {
+	output, err := exec.CommandContext(ctx, "systemctl", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("systemctl %s failed: %w: %s", args[0], err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("failed to run systemctl: %w", err)
+	}
+	return output, nil
+}
+
+func unitNames(units []Unit) []string {
+	names := make([]string, 0, len(units))
+	for _, unit := range units {
+		names = append(names, unit.Name)
+	}
+	return names
+}
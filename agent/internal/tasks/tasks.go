@@ -0,0 +1,255 @@
+// Package tasks tracks the progress of long-running operations, such as
+// backups, updates, transfers and scans, for the local API and the server
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"shh/agent/internal/protocol"
+)
+
+// Task states
+const (
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	StateCanceled  = "canceled"
+)
+
+const (
+	// DefaultHistory is how many finished tasks are kept
+	DefaultHistory = 100
+	// progressInterval is how often observers are told of progress; state
+	// changes are reported at once
+	progressInterval = time.Second
+)
+
+// Registry keeps the running tasks and the most recent finished ones, and
+// tells observers of their changes. A nil Registry ignores its tasks, so
+// that components can report progress without one.
+type Registry struct {
+	mu        sync.Mutex
+	tasks     map[string]*entry
+	finished  []string
+	history   int
+	observers []func(protocol.TaskProgress)
+	next      uint64
+}
+
+// entry is a task and when its observers were last told of it
+type entry struct {
+	progress protocol.TaskProgress
+	notified time.Time
+}
+
+// NewRegistry creates a registry keeping the last history finished tasks
+func NewRegistry(history int) *Registry {
+	if history <= 0 {
+		history = DefaultHistory
+	}
+	return &Registry{tasks: make(map[string]*entry), history: history}
+}
+
+// OnChange calls observe with a task whenever it starts, progresses or
+// finishes. Progress is reported at most once a second per task.
+func (r *Registry) OnChange(observe func(protocol.TaskProgress)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observers = append(r.observers, observe)
+}
+
+// Start records a running task of kind. id identifies the operation, such
+// as a transfer ID; empty generates one. Starting a task with the ID of
+// another replaces it.
+func (r *Registry) Start(id, kind, name string) *Task {
+	if r == nil {
+		return nil
+	}
+	now := time.Now()
+	r.mu.Lock()
+	if id == "" {
+		r.next++
+		id = kind + "-" + strconv.FormatInt(now.UnixNano(), 36) + "-" + strconv.FormatUint(r.next, 10)
+	}
+	for i, finished := range r.finished {
+		if finished == id {
+			r.finished = append(r.finished[:i], r.finished[i+1:]...)
+			break
+		}
+	}
+	r.tasks[id] = &entry{progress: protocol.TaskProgress{
+		ID:      id,
+		Kind:    kind,
+		Name:    name,
+		State:   StateRunning,
+		Percent: -1,
+		Started: now,
+		Updated: now,
+	}}
+	r.mu.Unlock()
+	r.update(id, true, func(*protocol.TaskProgress) {})
+	return &Task{registry: r, id: id}
+}
+
+// List returns the running tasks, then the finished ones, newest first
+func (r *Registry) List() []protocol.TaskProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]protocol.TaskProgress, 0, len(r.tasks))
+	for _, e := range r.tasks {
+		list = append(list, snapshot(e.progress))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if running := list[i].State == StateRunning; running != (list[j].State == StateRunning) {
+			return running
+		}
+		return list[i].Started.After(list[j].Started)
+	})
+	return list
+}
+
+// Get returns the task with id
+func (r *Registry) Get(id string) (protocol.TaskProgress, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.tasks[id]
+	if !ok {
+		return protocol.TaskProgress{}, false
+	}
+	return snapshot(e.progress), true
+}
+
+// update changes a running task and tells the observers, immediately if
+// force is set and otherwise once progressInterval has passed. Finished
+// tasks don't change.
+func (r *Registry) update(id string, force bool, change func(*protocol.TaskProgress)) {
+	r.mu.Lock()
+	e, ok := r.tasks[id]
+	if !ok || e.progress.State != StateRunning {
+		r.mu.Unlock()
+		return
+	}
+	change(&e.progress)
+	now := time.Now()
+	e.progress.Updated = now
+	if e.progress.State != StateRunning {
+		r.finish(id)
+	}
+	if !force && now.Sub(e.notified) < progressInterval {
+		r.mu.Unlock()
+		return
+	}
+	e.notified = now
+	progress, observers := snapshot(e.progress), r.observers
+	r.mu.Unlock()
+
+	for _, observe := range observers {
+		observe(progress)
+	}
+}
+
+// finish moves a task to the finished ones, dropping the oldest beyond
+// the history. The caller holds mu.
+func (r *Registry) finish(id string) {
+	r.finished = append(r.finished, id)
+	for len(r.finished) > r.history {
+		if e, ok := r.tasks[r.finished[0]]; ok && e.progress.State != StateRunning {
+			delete(r.tasks, r.finished[0])
+		}
+		r.finished = r.finished[1:]
+	}
+}
+
+// snapshot copies a task for use outside the registry
+func snapshot(p protocol.TaskProgress) protocol.TaskProgress {
+	if p.Details != nil {
+		details := make(map[string]string, len(p.Details))
+		for k, v := range p.Details {
+			details[k] = v
+		}
+		p.Details = details
+	}
+	return p
+}
+
+// Task reports the progress of one operation. The methods of a nil Task do
+// nothing, and those of a finished task are ignored.
+type Task struct {
+	registry *Registry
+	id       string
+}
+
+// ID returns the ID of the task
+func (t *Task) ID() string {
+	if t == nil {
+		return ""
+	}
+	return t.id
+}
+
+// Progress sets how far the task is, in percent or -1 when unknown, and
+// what it is doing
+func (t *Task) Progress(percent float64, message string) {
+	if t == nil {
+		return
+	}
+	t.registry.update(t.id, false, func(p *protocol.TaskProgress) {
+		p.Percent = percent
+		if message != "" {
+			p.Message = message
+		}
+	})
+}
+
+// SetDetail records a detail of the task, such as the file being backed up
+func (t *Task) SetDetail(key, value string) {
+	if t == nil {
+		return
+	}
+	t.registry.update(t.id, false, func(p *protocol.TaskProgress) {
+		if p.Details == nil {
+			p.Details = make(map[string]string)
+		}
+		p.Details[key] = value
+	})
+}
+
+// Done finishes the task successfully
+func (t *Task) Done(message string) {
+	t.end(nil, message)
+}
+
+// Finish finishes the task with err, or successfully if err is nil. A
+// canceled context cancels the task.
+func (t *Task) Finish(err error) {
+	t.end(err, "")
+}
+
+func (t *Task) end(err error, message string) {
+	if t == nil {
+		return
+	}
+	t.registry.update(t.id, true, func(p *protocol.TaskProgress) {
+		ended := time.Now()
+		p.Ended = &ended
+		switch {
+		case err == nil:
+			p.State = StateSucceeded
+			p.Percent = 100
+		case errors.Is(err, context.Canceled):
+			p.State = StateCanceled
+			p.Error = err.Error()
+		default:
+			p.State = StateFailed
+			p.Error = err.Error()
+		}
+		if message != "" {
+			p.Message = message
+		}
+	})
+}
@@ -8,10 +8,14 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
+
+	"shh/agent/internal/store"
+	"shh/agent/internal/tasks"
 )
 
 // TransferType represents the type of transfer
@@ -55,6 +59,7 @@ type Transfer struct {
 	Checksum      string       `json:"checksum,omitempty"`
 	cancel        context.CancelFunc
 	progressChan  chan int64
+	task          *tasks.Task
 }
 
 // Manager handles file transfers
@@ -65,6 +70,8 @@ type Manager struct {
 	uploadDir  string
 	maxSize    int64
 	bufferSize int
+	records    *store.Bucket[Transfer]
+	tasks      *tasks.Registry
 }
 
 // NewManager creates a new transfer manager
@@ -101,11 +108,13 @@ func (m *Manager) StartUpload(parentCtx context.Context, id, filename string, si
 		StartTime:    time.Now(),
 		cancel:       cancel,
 		progressChan: make(chan int64, 100),
+		task:         m.tasks.Start(id, "transfer", "upload "+filename),
 	}
 
 	m.mu.Lock()
 	m.transfers[id] = transfer
 	m.mu.Unlock()
+	m.save(transfer)
 
 	// Monitor context cancellation
 	go func() {
@@ -117,6 +126,7 @@ func (m *Manager) StartUpload(parentCtx context.Context, id, filename string, si
 			transfer.State = StateFailed
 			transfer.Error = "cancelled by context"
 			transfer.EndTime = time.Now()
+			transfer.task.Finish(ctx.Err())
 		}
 	}()
 
@@ -154,6 +164,9 @@ func (m *Manager) WriteChunk(id string, data []byte, offset int64) error {
 	transfer.State = StateTransferring
 	transfer.Transferred += int64(len(data))
 	transfer.progressChan <- transfer.Transferred
+	if transfer.Size > 0 {
+		transfer.task.Progress(float64(transfer.Transferred)*100/float64(transfer.Size), "")
+	}
 
 	return nil
 }
@@ -177,21 +190,28 @@ func (m *Manager) FinishTransfer(id string) error {
 	if info.Size() != transfer.Size {
 		transfer.State = StateFailed
 		transfer.Error = "size mismatch"
+		m.save(transfer)
+		transfer.task.Finish(fmt.Errorf("size mismatch"))
 		return fmt.Errorf("size mismatch")
 	}
 
 	// Calculate checksum
 	transfer.State = StateVerifying
+	transfer.task.Progress(100, "verifying")
 	checksum, err := m.calculateChecksum(transfer.DestPath)
 	if err != nil {
 		transfer.State = StateFailed
 		transfer.Error = fmt.Sprintf("checksum failed: %v", err)
+		m.save(transfer)
+		transfer.task.Finish(fmt.Errorf("checksum failed: %w", err))
 		return fmt.Errorf("checksum failed: %w", err)
 	}
 
 	transfer.State = StateComplete
 	transfer.EndTime = time.Now()
 	transfer.Checksum = checksum
+	m.save(transfer)
+	transfer.task.Done("")
 
 	return nil
 }
@@ -210,6 +230,8 @@ func (m *Manager) CancelTransfer(id string) error {
 	transfer.State = StateFailed
 	transfer.Error = "cancelled"
 	transfer.EndTime = time.Now()
+	m.saveLocked(transfer)
+	transfer.task.Finish(context.Canceled)
 
 	// Cleanup file
 	if err := os.Remove(transfer.DestPath); err != nil {
@@ -234,6 +256,21 @@ func (m *Manager) GetTransfer(id string) (*Transfer, error) {
 	return transfer, nil
 }
 
+// ListTransfers returns the transfers, most recent first
+func (m *Manager) ListTransfers() []Transfer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transfers := make([]Transfer, 0, len(m.transfers))
+	for _, transfer := range m.transfers {
+		transfers = append(transfers, *transfer)
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].StartTime.After(transfers[j].StartTime)
+	})
+	return transfers
+}
+
 // calculateChecksum calculates SHA-256 checksum of a file
 func (m *Manager) calculateChecksum(path string) (string, error) {
 	f, err := os.Open(path)
@@ -268,6 +305,11 @@ func (m *Manager) Cleanup(maxAge time.Duration) error {
 					zap.Error(err))
 			}
 			delete(m.transfers, id)
+			if m.records != nil {
+				if err := m.records.Delete(id); err != nil {
+					m.logger.Warn("Failed to remove transfer record", zap.String("id", id), zap.Error(err))
+				}
+			}
 		}
 	}
 
@@ -296,7 +338,69 @@ func (m *Manager) Start(ctx context.Context) error {
 	return nil
 }
 
-// Shutdown stops the transfer manager
+// SetTasks reports the progress of uploads as tasks in registry
+func (m *Manager) SetTasks(registry *tasks.Registry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks = registry
+}
+
+// SetStore keeps transfer state in s and restores it. Uploads that were
+// in progress when the agent stopped resume from the bytes already on
+// disk.
+func (m *Manager) SetStore(s *store.Store) error {
+	records := store.NewBucket[Transfer](s, store.BucketTransfers)
+	saved, err := records.All()
+	if err != nil {
+		return fmt.Errorf("failed to load transfers: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = records
+	for id, transfer := range saved {
+		if _, ok := m.transfers[id]; ok {
+			continue
+		}
+		transfer := transfer
+		transfer.cancel = func() {}
+		transfer.progressChan = make(chan int64, 100)
+		if transfer.State == StateStarting || transfer.State == StateTransferring || transfer.State == StateVerifying {
+			if info, err := os.Stat(transfer.DestPath); err == nil {
+				transfer.State = StateTransferring
+				transfer.Transferred = info.Size()
+			} else {
+				transfer.State = StateFailed
+				transfer.Error = "interrupted by agent restart"
+				transfer.EndTime = time.Now()
+				m.saveLocked(&transfer)
+			}
+		}
+		m.transfers[id] = &transfer
+	}
+	m.logger.Info("Transfers restored", zap.Int("transfers", len(saved)))
+	return nil
+}
+
+// save records the state of a transfer, if state is kept
+func (m *Manager) save(transfer *Transfer) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.saveLocked(transfer)
+}
+
+// saveLocked is save for callers holding mu
+func (m *Manager) saveLocked(transfer *Transfer) {
+	if m.records == nil {
+		return
+	}
+	if err := m.records.Put(transfer.ID, *transfer); err != nil {
+		m.logger.Warn("Failed to save transfer", zap.String("id", transfer.ID), zap.Error(err))
+	}
+}
+
+// Shutdown stops the transfer manager. With a store, active uploads stay
+// recorded as in progress so that they resume after a restart.
 func (m *Manager) Shutdown() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -308,6 +412,7 @@ func (m *Manager) Shutdown() error {
 			transfer.State = StateFailed
 			transfer.Error = "shutdown"
 			transfer.EndTime = time.Now()
+			transfer.task.Finish(context.Canceled)
 			m.logger.Info("Transfer cancelled due to shutdown",
 				zap.String("id", id),
 				zap.String("state", string(transfer.State)))
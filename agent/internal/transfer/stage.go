@@ -0,0 +1,101 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultMaxSize bounds transfers when no limit is configured
+const DefaultMaxSize = 1 << 30
+
+// Stage writes r to a new download transfer, so that data produced on
+// the agent, such as files copied out of a container, can be fetched by
+// the server like any other transfer
+func (m *Manager) Stage(id, source string, r io.Reader) (*Transfer, error) {
+	destPath := filepath.Join(m.uploadDir, id)
+	transfer := &Transfer{
+		ID:           id,
+		Type:         TypeDownload,
+		State:        StateTransferring,
+		SourcePath:   source,
+		DestPath:     destPath,
+		StartTime:    time.Now(),
+		cancel:       func() {},
+		progressChan: make(chan int64, 100),
+	}
+	m.mu.Lock()
+	if _, exists := m.transfers[id]; exists {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("transfer already exists: %s", id)
+	}
+	m.transfers[id] = transfer
+	transfer.task = m.tasks.Start(id, "transfer", "stage "+source)
+	m.mu.Unlock()
+	m.save(transfer)
+
+	size, checksum, err := m.writeStaged(destPath, r)
+	transfer.EndTime = time.Now()
+	transfer.task.Finish(err)
+	if err != nil {
+		transfer.State = StateFailed
+		transfer.Error = err.Error()
+		m.save(transfer)
+		if err := os.Remove(destPath); err != nil && !os.IsNotExist(err) {
+			m.logger.Warn("Failed to remove failed transfer", zap.String("id", id), zap.Error(err))
+		}
+		return nil, err
+	}
+
+	transfer.State = StateComplete
+	transfer.Size = size
+	transfer.Transferred = size
+	transfer.Checksum = checksum
+	m.save(transfer)
+	return transfer, nil
+}
+
+// Open returns the file of a completed upload
+func (m *Manager) Open(id string) (*os.File, *Transfer, error) {
+	transfer, err := m.GetTransfer(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if transfer.Type != TypeUpload || transfer.State != StateComplete {
+		return nil, nil, fmt.Errorf("transfer %s is not a completed upload", id)
+	}
+	f, err := os.Open(transfer.DestPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return f, transfer, nil
+}
+
+// writeStaged copies r to path, refusing data beyond the maximum size,
+// and returns its size and checksum
+func (m *Manager) writeStaged(path string, r io.Reader) (int64, string, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(r, m.maxSize+1))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to write: %w", err)
+	}
+	if size > m.maxSize {
+		return 0, "", fmt.Errorf("file size exceeds maximum allowed size")
+	}
+	if err := f.Close(); err != nil {
+		return 0, "", fmt.Errorf("failed to write: %w", err)
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -2,13 +2,20 @@ package updates
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/store"
+	"shh/agent/internal/tasks"
 )
 
 // PackageType represents a package type
@@ -41,31 +48,72 @@ type Update struct {
 	Type        PackageType `json:"type"`
 	FromVersion string      `json:"from_version"`
 	ToVersion   string      `json:"to_version"`
+	Security    bool        `json:"security"`
 	Status      string      `json:"status"`
 	Error       string      `json:"error,omitempty"`
 	StartTime   time.Time   `json:"start_time"`
 	EndTime     time.Time   `json:"end_time,omitempty"`
 }
 
+// RebootStatus reports whether the system needs a reboot to finish applying updates
+type RebootStatus struct {
+	Required  bool      `json:"required"`
+	Packages  []string  `json:"packages,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+const (
+	rebootRequiredFile     = "/var/run/reboot-required"
+	rebootRequiredPkgsFile = "/var/run/reboot-required.pkgs"
+)
+
 // Manager manages software updates
 type Manager struct {
 	logger       *zap.Logger
 	packages     map[string]*Package
 	updates      map[string]*Update
 	packageMgr   string
-	mu           sync.RWMutex
+	maintenance  *MaintenanceConfig
+	events       chan<- interface{} // Channel for streaming progress events
+	history      *store.Bucket[Update]
+	// registry receives the running package operations as tasks
+	registry *tasks.Registry
+	running  map[string]*tasks.Task
+	// checked runs after every successful update check
+	checked  func(ctx context.Context)
+	// verify checks health settle after each package of a staged rollout
+	verify VerifyFunc
+	settle time.Duration
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu       sync.RWMutex
 }
 
-// NewManager creates a new update manager
-func NewManager(logger *zap.Logger) *Manager {
+// VerifyFunc checks system health between staged updates
+type VerifyFunc func(ctx context.Context) error
+
+// NewManager creates a new update manager. Output and progress of running
+// package operations are sent on events as protocol.UpdateProgress values;
+// events may be nil.
+func NewManager(logger *zap.Logger, events chan<- interface{}) *Manager {
 	return &Manager{
 		logger:     logger,
 		packages:   make(map[string]*Package),
 		updates:    make(map[string]*Update),
 		packageMgr: detectPackageManager(),
+		events:     events,
+		running:    make(map[string]*tasks.Task),
 	}
 }
 
+// SetTasks reports the progress of package operations as tasks in
+// registry
+func (m *Manager) SetTasks(registry *tasks.Registry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.registry = registry
+}
+
 // detectPackageManager detects the system package manager
 func detectPackageManager() string {
 	// Try apt-get
@@ -91,18 +139,33 @@ func detectPackageManager() string {
 	return ""
 }
 
+// OnCheck calls checked after every successful update check, e.g. to
+// match the installed packages against advisories. It must be called
+// before the first check.
+func (m *Manager) OnCheck(checked func(ctx context.Context)) {
+	m.checked = checked
+}
+
 // CheckUpdates checks for available updates
 func (m *Manager) CheckUpdates(ctx context.Context) error {
+	var err error
 	switch m.packageMgr {
 	case "apt":
-		return m.checkAptUpdates(ctx)
+		err = m.checkAptUpdates(ctx)
 	case "yum", "dnf":
-		return m.checkYumUpdates(ctx)
+		err = m.checkYumUpdates(ctx)
 	case "brew":
-		return m.checkBrewUpdates(ctx)
+		err = m.checkBrewUpdates(ctx)
 	default:
-		return fmt.Errorf("unsupported package manager")
+		err = fmt.Errorf("unsupported package manager")
 	}
+	if err != nil {
+		return err
+	}
+	if m.checked != nil {
+		m.checked(ctx)
+	}
+	return nil
 }
 
 // checkAptUpdates checks for apt updates
@@ -126,8 +189,8 @@ func (m *Manager) checkAptUpdates(ctx context.Context) error {
 			parts := strings.Fields(line)
 			if len(parts) >= 4 {
 				pkg := parts[1]
-				fromVersion := parts[2]
-				toVersion := parts[3]
+				fromVersion := strings.Trim(parts[2], "[]")
+				toVersion := strings.Trim(parts[3], "()")
 
 				update := &Update{
 					ID:          fmt.Sprintf("upd_%d", time.Now().UnixNano()),
@@ -135,6 +198,7 @@ func (m *Manager) checkAptUpdates(ctx context.Context) error {
 					Type:        TypeDeb,
 					FromVersion: fromVersion,
 					ToVersion:   toVersion,
+					Security:    isAptSecurityOrigin(line),
 					Status:      "pending",
 					StartTime:   time.Now(),
 				}
@@ -142,6 +206,7 @@ func (m *Manager) checkAptUpdates(ctx context.Context) error {
 				m.mu.Lock()
 				m.updates[update.ID] = update
 				m.mu.Unlock()
+				m.save(update)
 			}
 		}
 	}
@@ -149,6 +214,17 @@ func (m *Manager) checkAptUpdates(ctx context.Context) error {
 	return nil
 }
 
+// isAptSecurityOrigin reports whether a simulated "Inst" line pulls the new
+// version from a security pocket, the same origin match unattended-upgrades
+// uses by default (e.g. "Ubuntu:22.04/jammy-security", "Debian-Security:12/stable-security")
+func isAptSecurityOrigin(line string) bool {
+	start := strings.Index(line, "(")
+	if start < 0 {
+		return false
+	}
+	return strings.Contains(strings.ToLower(line[start:]), "-security")
+}
+
 // checkYumUpdates checks for yum/dnf updates
 func (m *Manager) checkYumUpdates(ctx context.Context) error {
 	cmd := exec.CommandContext(ctx, m.packageMgr, "check-update")
@@ -159,6 +235,11 @@ func (m *Manager) checkYumUpdates(ctx context.Context) error {
 		return fmt.Errorf("failed to check updates: %w", err)
 	}
 
+	security, err := m.yumSecurityPackages(ctx)
+	if err != nil {
+		m.logger.Warn("Failed to query security advisories", zap.Error(err))
+	}
+
 	// Parse output
 	for _, line := range strings.Split(string(output), "\n") {
 		parts := strings.Fields(line)
@@ -179,6 +260,7 @@ func (m *Manager) checkYumUpdates(ctx context.Context) error {
 				Type:        TypeRPM,
 				FromVersion: strings.TrimSpace(string(curr)),
 				ToVersion:   newVersion,
+				Security:    security[rpmBaseName(pkg)],
 				Status:      "pending",
 				StartTime:   time.Now(),
 			}
@@ -186,12 +268,55 @@ func (m *Manager) checkYumUpdates(ctx context.Context) error {
 			m.mu.Lock()
 			m.updates[update.ID] = update
 			m.mu.Unlock()
+			m.save(update)
 		}
 	}
 
 	return nil
 }
 
+// yumSecurityPackages returns the names of packages with pending security
+// advisories, as reported by "updateinfo list --security"
+func (m *Manager) yumSecurityPackages(ctx context.Context) (map[string]bool, error) {
+	cmd := exec.CommandContext(ctx, m.packageMgr, "-q", "updateinfo", "list", "--security")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list security advisories: %w", err)
+	}
+
+	// Lines look like: "FEDORA-2024-1a2b3c Important/Sec. openssl-libs-1:3.1.1-4.fc39.x86_64"
+	packages := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		packages[nevraName(fields[len(fields)-1])] = true
+	}
+	return packages, nil
+}
+
+// rpmBaseName strips the architecture suffix from a check-update package column
+func rpmBaseName(pkg string) string {
+	if idx := strings.LastIndex(pkg, "."); idx > 0 {
+		return pkg[:idx]
+	}
+	return pkg
+}
+
+// nevraName extracts the package name from a name-[epoch:]version-release.arch string
+func nevraName(nevra string) string {
+	name := rpmBaseName(nevra)
+	for i := 0; i < 2; i++ {
+		idx := strings.LastIndex(name, "-")
+		if idx <= 0 {
+			return name
+		}
+		name = name[:idx]
+	}
+	return name
+}
+
 // checkBrewUpdates checks for Homebrew updates
 func (m *Manager) checkBrewUpdates(ctx context.Context) error {
 	// Update Homebrew itself
@@ -228,14 +353,209 @@ func (m *Manager) checkBrewUpdates(ctx context.Context) error {
 			m.mu.Lock()
 			m.updates[update.ID] = update
 			m.mu.Unlock()
+			m.save(update)
 		}
 	}
 
 	return nil
 }
 
-// ApplyUpdates applies pending updates
+// SetMaintenanceConfig sets the maintenance windows updates are restricted to.
+// A nil config removes all restrictions.
+func (m *Manager) SetMaintenanceConfig(cfg *MaintenanceConfig) error {
+	if cfg != nil {
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid maintenance config: %w", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maintenance = cfg
+	return nil
+}
+
+// InMaintenanceWindow reports whether updates may run at t
+func (m *Manager) InMaintenanceWindow(t time.Time) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.maintenance == nil || m.maintenance.Allows(t)
+}
+
+// ApplyUpdates applies pending updates. Outside a maintenance window the
+// updates are either refused or, when deferral is enabled, marked deferred
+// until ProcessDeferred runs inside a window.
 func (m *Manager) ApplyUpdates(ctx context.Context, updateIDs []string) error {
+	m.mu.Lock()
+	if m.maintenance != nil && !m.maintenance.Allows(time.Now()) {
+		if !m.maintenance.Defer {
+			m.mu.Unlock()
+			return ErrOutsideMaintenanceWindow
+		}
+		var deferred []*Update
+		for _, id := range updateIDs {
+			if update, ok := m.updates[id]; ok {
+				update.Status = "deferred"
+				deferred = append(deferred, update)
+			}
+		}
+		m.mu.Unlock()
+		for _, update := range deferred {
+			m.save(update)
+		}
+		m.logger.Info("Deferring updates until next maintenance window",
+			zap.Int("count", len(updateIDs)))
+		return nil
+	}
+	m.mu.Unlock()
+
+	return m.applyUpdates(ctx, updateIDs)
+}
+
+// ProcessDeferred applies deferred updates if the current time is inside a
+// maintenance window. It returns the IDs that were applied.
+func (m *Manager) ProcessDeferred(ctx context.Context) ([]string, error) {
+	if !m.InMaintenanceWindow(time.Now()) {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	var ids []string
+	for id, update := range m.updates {
+		if update.Status == "deferred" {
+			update.Status = "pending"
+			ids = append(ids, id)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	if err := m.applyUpdates(ctx, ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// deferredCheckInterval is how often deferred updates are checked for an
+// open maintenance window
+const deferredCheckInterval = time.Minute
+
+// Start applies deferred updates once a maintenance window opens
+func (m *Manager) Start(ctx context.Context) error {
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.done = make(chan struct{})
+	crash.Go("updates-deferred", func() {
+		defer close(m.done)
+		ticker := time.NewTicker(deferredCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			applied, err := m.ProcessDeferred(ctx)
+			if err != nil {
+				m.logger.Error("Failed to apply deferred updates", zap.Error(err))
+				continue
+			}
+			if len(applied) > 0 {
+				m.logger.Info("Applied deferred updates", zap.Strings("updates", applied))
+			}
+		}
+	})
+	return nil
+}
+
+// Shutdown stops applying deferred updates
+func (m *Manager) Shutdown(ctx context.Context) error {
+	if m.cancel == nil {
+		return nil
+	}
+	m.cancel()
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetStaging makes staged rollouts wait settle after each package and then
+// run verify, halting when it fails
+func (m *Manager) SetStaging(verify VerifyFunc, settle time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.verify = verify
+	m.settle = settle
+}
+
+// Window reports whether the maintenance window is open, when it opens
+// next and how many updates wait for it
+func (m *Manager) Window(t time.Time) WindowStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := WindowStatus{Open: m.maintenance == nil || m.maintenance.Allows(t)}
+	if !status.Open {
+		if next, ok := m.maintenance.NextWindow(t); ok {
+			status.Next = &next
+		}
+	}
+	for _, update := range m.updates {
+		if update.Status == "deferred" {
+			status.Deferred++
+		}
+	}
+	return status
+}
+
+// ApplyStaged applies updates one package at a time, waiting settle and then
+// running verify after each. The rollout stops at the first failed update or
+// verification, leaving the remaining updates pending.
+func (m *Manager) ApplyStaged(ctx context.Context, updateIDs []string, verify VerifyFunc, settle time.Duration) error {
+	if !m.InMaintenanceWindow(time.Now()) {
+		return ErrOutsideMaintenanceWindow
+	}
+
+	for i, id := range updateIDs {
+		m.mu.RLock()
+		update, ok := m.updates[id]
+		m.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		if err := m.applyUpdates(ctx, []string{id}); err != nil {
+			return fmt.Errorf("staged update failed: %w", err)
+		}
+
+		if settle > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(settle):
+			}
+		}
+
+		if verify != nil {
+			if err := verify(ctx); err != nil {
+				m.logger.Error("Health verification failed, halting staged rollout",
+					zap.String("package", update.Package),
+					zap.Int("remaining", len(updateIDs)-i-1),
+					zap.Error(err))
+				return fmt.Errorf("health verification failed after updating %s: %w", update.Package, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyUpdates dispatches updates to the detected package manager
+func (m *Manager) applyUpdates(ctx context.Context, updateIDs []string) error {
 	switch m.packageMgr {
 	case "apt":
 		return m.applyAptUpdates(ctx, updateIDs)
@@ -248,62 +568,122 @@ func (m *Manager) ApplyUpdates(ctx context.Context, updateIDs []string) error {
 	}
 }
 
-// applyAptUpdates applies apt updates
-func (m *Manager) applyAptUpdates(ctx context.Context, updateIDs []string) error {
-	for _, id := range updateIDs {
-		m.mu.RLock()
-		update, ok := m.updates[id]
-		m.mu.RUnlock()
-		if !ok {
-			continue
-		}
-
-		update.Status = "updating"
-
-		cmd := exec.CommandContext(ctx, "apt-get", "install", "-y", update.Package)
-		if err := cmd.Run(); err != nil {
-			update.Status = "failed"
-			update.Error = err.Error()
-			update.EndTime = time.Now()
-			continue
+// ApplySecurityUpdates applies only the pending updates flagged as security fixes
+func (m *Manager) ApplySecurityUpdates(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	var ids []string
+	for id, update := range m.updates {
+		if update.Security && update.Status == "pending" {
+			ids = append(ids, id)
 		}
+	}
+	m.mu.RUnlock()
 
-		update.Status = "completed"
-		update.EndTime = time.Now()
+	if len(ids) == 0 {
+		return nil, nil
 	}
 
-	return nil
+	if err := m.ApplyUpdates(ctx, ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
 
-// applyYumUpdates applies yum/dnf updates
-func (m *Manager) applyYumUpdates(ctx context.Context, updateIDs []string) error {
-	for _, id := range updateIDs {
-		m.mu.RLock()
-		update, ok := m.updates[id]
-		m.mu.RUnlock()
-		if !ok {
-			continue
+// GetSecurityUpdates returns the updates flagged as security fixes
+func (m *Manager) GetSecurityUpdates() []Update {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var updates []Update
+	for _, update := range m.updates {
+		if update.Security {
+			updates = append(updates, *update)
 		}
+	}
+	return updates
+}
 
-		update.Status = "updating"
+// CheckReboot reports whether a reboot is required to complete applied updates
+func (m *Manager) CheckReboot(ctx context.Context) (*RebootStatus, error) {
+	status := &RebootStatus{CheckedAt: time.Now()}
 
-		cmd := exec.CommandContext(ctx, m.packageMgr, "update", "-y", update.Package)
-		if err := cmd.Run(); err != nil {
-			update.Status = "failed"
-			update.Error = err.Error()
-			update.EndTime = time.Now()
-			continue
+	switch m.packageMgr {
+	case "apt":
+		if _, err := os.Stat(rebootRequiredFile); err != nil {
+			if os.IsNotExist(err) {
+				return status, nil
+			}
+			return nil, fmt.Errorf("failed to check %s: %w", rebootRequiredFile, err)
 		}
+		status.Required = true
 
-		update.Status = "completed"
-		update.EndTime = time.Now()
+		if data, err := os.ReadFile(rebootRequiredPkgsFile); err == nil {
+			for _, pkg := range strings.Split(string(data), "\n") {
+				if pkg = strings.TrimSpace(pkg); pkg != "" {
+					status.Packages = append(status.Packages, pkg)
+				}
+			}
+		}
+	case "yum", "dnf":
+		// needs-restarting -r exits 1 when a reboot is required
+		var cmd *exec.Cmd
+		if _, err := exec.LookPath("needs-restarting"); err == nil {
+			cmd = exec.CommandContext(ctx, "needs-restarting", "-r")
+		} else {
+			cmd = exec.CommandContext(ctx, m.packageMgr, "needs-restarting", "-r")
+		}
+		output, err := cmd.Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+				return nil, fmt.Errorf("failed to run needs-restarting: %w", err)
+			}
+			status.Required = true
+		}
+
+		// Core packages are listed as " * kernel" in the output
+		for _, line := range strings.Split(string(output), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "* ") {
+				status.Packages = append(status.Packages, strings.TrimSpace(strings.TrimPrefix(line, "* ")))
+			}
+		}
+	case "brew":
+		// Homebrew packages never require a reboot
+	default:
+		return nil, fmt.Errorf("unsupported package manager")
 	}
 
-	return nil
+	return status, nil
+}
+
+// applyAptUpdates applies apt updates
+func (m *Manager) applyAptUpdates(ctx context.Context, updateIDs []string) error {
+	return m.applyEach(updateIDs, func(update *Update) error {
+		return m.runStreaming(ctx, update, "apt-get", "install", "-y",
+			"-o", "APT::Status-Fd=1", "-o", "Dpkg::Use-Pty=0", update.Package)
+	})
+}
+
+// applyYumUpdates applies yum/dnf updates
+func (m *Manager) applyYumUpdates(ctx context.Context, updateIDs []string) error {
+	return m.applyEach(updateIDs, func(update *Update) error {
+		return m.runStreaming(ctx, update, m.packageMgr, "update", "-y", update.Package)
+	})
 }
 
 // applyBrewUpdates applies Homebrew updates
 func (m *Manager) applyBrewUpdates(ctx context.Context, updateIDs []string) error {
+	return m.applyEach(updateIDs, func(update *Update) error {
+		return m.runStreaming(ctx, update, "brew", "upgrade", update.Package)
+	})
+}
+
+// applyEach applies the known updates one at a time with apply, recording
+// the outcome of each. The failures are returned joined, after the others
+// were tried.
+func (m *Manager) applyEach(updateIDs []string, apply func(update *Update) error) error {
+	var errs []error
 	for _, id := range updateIDs {
 		m.mu.RLock()
 		update, ok := m.updates[id]
@@ -312,21 +692,38 @@ func (m *Manager) applyBrewUpdates(ctx context.Context, updateIDs []string) erro
 			continue
 		}
 
-		update.Status = "updating"
-
-		cmd := exec.CommandContext(ctx, "brew", "upgrade", update.Package)
-		if err := cmd.Run(); err != nil {
-			update.Status = "failed"
-			update.Error = err.Error()
-			update.EndTime = time.Now()
+		m.setStatus(update, "updating", nil)
+		if err := apply(update); err != nil {
+			m.setStatus(update, "failed", err)
+			m.emitProgress(update, "status", err.Error(), -1)
+			errs = append(errs, fmt.Errorf("%s: %w", update.Package, err))
 			continue
 		}
 
-		update.Status = "completed"
+		m.setStatus(update, "completed", nil)
+		m.emitProgress(update, "status", "", 100)
+	}
+
+	return errors.Join(errs...)
+}
+
+// setStatus records the status of update, with err when it failed, saving
+// finished updates in the history
+func (m *Manager) setStatus(update *Update, status string, err error) {
+	m.mu.Lock()
+	update.Status = status
+	if err != nil {
+		update.Error = err.Error()
+	}
+	finished := status != "updating"
+	if finished {
 		update.EndTime = time.Now()
 	}
+	m.mu.Unlock()
 
-	return nil
+	if finished {
+		m.save(update)
+	}
 }
 
 // GetUpdates returns all updates
@@ -341,13 +738,17 @@ func (m *Manager) GetUpdates() []Update {
 	return updates
 }
 
-// GetUpdate returns a specific update
+// GetUpdate returns a copy of a specific update
 func (m *Manager) GetUpdate(id string) (*Update, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	update, ok := m.updates[id]
-	return update, ok
+	if !ok {
+		return nil, false
+	}
+	copied := *update
+	return &copied, true
 }
 
 // ClearCompleted clears completed updates
@@ -358,10 +759,99 @@ func (m *Manager) ClearCompleted() {
 	for id, update := range m.updates {
 		if update.Status == "completed" {
 			delete(m.updates, id)
+			if m.history != nil {
+				if err := m.history.Delete(id); err != nil {
+					m.logger.Warn("Failed to remove update from history", zap.String("id", id), zap.Error(err))
+				}
+			}
 		}
 	}
 }
 
+// SetStore keeps the update history in s and restores it. Updates that
+// were being applied when the agent stopped are marked failed.
+func (m *Manager) SetStore(s *store.Store) error {
+	history := store.NewBucket[Update](s, store.BucketUpdates)
+	saved, err := history.All()
+	if err != nil {
+		return fmt.Errorf("failed to load update history: %w", err)
+	}
+
+	var interrupted []*Update
+	m.mu.Lock()
+	m.history = history
+	for id, update := range saved {
+		if _, ok := m.updates[id]; ok {
+			continue
+		}
+		update := update
+		if update.Status == "updating" {
+			update.Status = "failed"
+			update.Error = "interrupted by agent restart"
+			update.EndTime = time.Now()
+			interrupted = append(interrupted, &update)
+		}
+		m.updates[id] = &update
+	}
+	m.mu.Unlock()
+
+	for _, update := range interrupted {
+		m.save(update)
+	}
+	m.logger.Info("Update history restored", zap.Int("updates", len(saved)))
+	return nil
+}
+
+// save records an update in the history, if one is kept
+func (m *Manager) save(update *Update) {
+	m.mu.RLock()
+	history := m.history
+	saved := *update
+	m.mu.RUnlock()
+	if history == nil {
+		return
+	}
+	if err := history.Put(update.ID, saved); err != nil {
+		m.logger.Warn("Failed to save update history", zap.String("id", update.ID), zap.Error(err))
+	}
+}
+
+// HandleCommand processes update commands
+func (m *Manager) HandleCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "updates:check":
+		if err := m.CheckUpdates(ctx); err != nil {
+			return nil, err
+		}
+		return m.GetUpdates(), nil
+	case "updates:list":
+		return m.GetUpdates(), nil
+	case "updates:apply":
+		// updates:apply <id>...
+		if len(args) == 0 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "update IDs required")
+		}
+		return nil, m.ApplyUpdates(ctx, args)
+	case "updates:staged":
+		// updates:staged <id>...
+		if len(args) == 0 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "update IDs required")
+		}
+		m.mu.RLock()
+		verify, settle := m.verify, m.settle
+		m.mu.RUnlock()
+		return nil, m.ApplyStaged(ctx, args, verify, settle)
+	case "updates:window":
+		return m.Window(time.Now()), nil
+	case "updates:security":
+		return m.ApplySecurityUpdates(ctx)
+	case "updates:reboot":
+		return m.CheckReboot(ctx)
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown updates command: %s", cmd)
+	}
+}
+
 // HealthCheck implements the health.Checker interface
 func (m *Manager) HealthCheck(ctx context.Context) error {
 	if m.packageMgr == "" {
@@ -0,0 +1,140 @@
+package updates
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestApplyUpdatesDeferral(t *testing.T) {
+	// Updates are never really applied: without a package manager, those
+	// that get past the window fail as unsupported
+	today := time.Now().Format("2006-01-02")
+	closed := &MaintenanceConfig{Blackouts: []string{today}}
+	deferring := &MaintenanceConfig{Blackouts: []string{today}, Defer: true}
+
+	tests := []struct {
+		name    string
+		config  *MaintenanceConfig
+		refused bool   // ErrOutsideMaintenanceWindow
+		applied bool   // got past the window
+		status  string // of the update afterwards
+	}{
+		{"no windows", nil, false, true, "pending"},
+		{"open window", &MaintenanceConfig{Blackouts: []string{"2000-01-01"}, Defer: true}, false, true, "pending"},
+		{"closed window", closed, true, false, "pending"},
+		{"deferred", deferring, false, false, "deferred"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, tt.config, "pending")
+
+			err := m.ApplyUpdates(context.Background(), []string{"u1"})
+			switch {
+			case tt.refused:
+				if !errors.Is(err, ErrOutsideMaintenanceWindow) {
+					t.Fatalf("got %v, want %v", err, ErrOutsideMaintenanceWindow)
+				}
+			case tt.applied:
+				if err == nil {
+					t.Fatal("applied without a package manager")
+				}
+			case err != nil:
+				t.Fatal(err)
+			}
+			if got := status(t, m); got != tt.status {
+				t.Errorf("status = %q, want %q", got, tt.status)
+			}
+			want := 0
+			if tt.status == "deferred" {
+				want = 1
+			}
+			if got := m.Window(time.Now()).Deferred; got != want {
+				t.Errorf("%d updates deferred, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestProcessDeferred(t *testing.T) {
+	today := time.Now().Format("2006-01-02")
+
+	tests := []struct {
+		name   string
+		config *MaintenanceConfig
+		status string // of the update afterwards
+	}{
+		{"window still closed", &MaintenanceConfig{Blackouts: []string{today}, Defer: true}, "deferred"},
+		{"window open", &MaintenanceConfig{Defer: true}, "pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, tt.config, "deferred")
+
+			applied, err := m.ProcessDeferred(context.Background())
+			if tt.status == "deferred" {
+				if err != nil || len(applied) != 0 {
+					t.Fatalf("got %v, %v; want nothing applied", applied, err)
+				}
+			} else if err == nil {
+				t.Fatal("applied without a package manager")
+			}
+			if got := status(t, m); got != tt.status {
+				t.Errorf("status = %q, want %q", got, tt.status)
+			}
+		})
+	}
+}
+
+func TestApplyEach(t *testing.T) {
+	m := NewManager(zap.NewNop(), nil)
+	for _, id := range []string{"ok", "broken", "missing-deps"} {
+		m.updates[id] = &Update{ID: id, Package: id, Status: "pending"}
+	}
+
+	err := m.applyEach([]string{"ok", "broken", "unknown", "missing-deps"}, func(update *Update) error {
+		if update.ID == "ok" {
+			return nil
+		}
+		return errors.New("exit status 100")
+	})
+	if err == nil {
+		t.Fatal("failures not returned")
+	}
+	if got, want := err.Error(), "broken: exit status 100\nmissing-deps: exit status 100"; got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+
+	for id, want := range map[string]string{"ok": "completed", "broken": "failed", "missing-deps": "failed"} {
+		update, _ := m.GetUpdate(id)
+		if update.Status != want {
+			t.Errorf("%s status = %q, want %q", id, update.Status, want)
+		}
+		if update.EndTime.IsZero() {
+			t.Errorf("%s has no end time", id)
+		}
+	}
+}
+
+func newTestManager(t *testing.T, config *MaintenanceConfig, status string) *Manager {
+	t.Helper()
+	m := NewManager(zap.NewNop(), nil)
+	m.packageMgr = ""
+	if err := m.SetMaintenanceConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	m.updates["u1"] = &Update{ID: "u1", Package: "openssl", Status: status}
+	return m
+}
+
+func status(t *testing.T, m *Manager) string {
+	t.Helper()
+	update, ok := m.GetUpdate("u1")
+	if !ok {
+		t.Fatal("update u1 is gone")
+	}
+	return update.Status
+}
@@ -0,0 +1,184 @@
+package updates
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// maxOutputTail is the number of trailing output lines kept for error reports
+const maxOutputTail = 20
+
+var (
+	// apt with APT::Status-Fd=1 reports "pmstatus:<pkg>:<percent>:<message>"
+	aptStatusPattern = regexp.MustCompile(`^(?:pm|dl)status:[^:]*:([0-9.]+):`)
+	// apt/dpkg "Progress: [ 45%]" and generic "45%" style output
+	percentPattern = regexp.MustCompile(`(\d{1,3}(?:\.\d+)?)%`)
+	// dnf/yum transaction steps such as "Upgrading : openssl 3/10"
+	stepPattern = regexp.MustCompile(`\s(\d+)/(\d+)\s*$`)
+)
+
+// runStreaming runs a package manager command for an update, forwarding each
+// output line and parsed progress to the event channel. Output is split on
+// carriage returns as well as newlines so progress bars are streamed too.
+func (m *Manager) runStreaming(ctx context.Context, update *Update, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		tail []string
+	)
+	collect := func(stream string, r io.Reader) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Split(scanLinesOrCR)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			mu.Lock()
+			tail = append(tail, line)
+			if len(tail) > maxOutputTail {
+				tail = tail[1:]
+			}
+			mu.Unlock()
+
+			m.emitProgress(update, stream, line, parseProgress(line))
+		}
+	}
+
+	wg.Add(2)
+	go collect("stdout", stdout)
+	go collect("stderr", stderr)
+	wg.Wait()
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%w (output: %s)", err, strings.Join(tail, "\n"))
+	}
+	return nil
+}
+
+// emitProgress sends a progress event without blocking the package operation
+func (m *Manager) emitProgress(update *Update, stream, line string, percent float64) {
+	m.mu.RLock()
+	status := update.Status
+	m.mu.RUnlock()
+
+	m.reportTask(update, status, line, percent)
+	if m.events == nil {
+		return
+	}
+
+	event := protocol.UpdateProgress{
+		UpdateID:  update.ID,
+		Package:   update.Package,
+		Stream:    stream,
+		Line:      line,
+		Percent:   percent,
+		Status:    status,
+		Timestamp: time.Now(),
+	}
+
+	select {
+	case m.events <- event:
+	default:
+		m.logger.Warn("Failed to send update progress event: channel full",
+			zap.String("update", update.ID))
+	}
+}
+
+// parseProgress extracts a completion percentage from a line of package
+// manager output, returning -1 if the line carries no progress information
+func parseProgress(line string) float64 {
+	if match := aptStatusPattern.FindStringSubmatch(line); match != nil {
+		if pct, err := strconv.ParseFloat(match[1], 64); err == nil {
+			return pct
+		}
+	}
+
+	if match := percentPattern.FindStringSubmatch(line); match != nil {
+		if pct, err := strconv.ParseFloat(match[1], 64); err == nil && pct <= 100 {
+			return pct
+		}
+	}
+
+	if match := stepPattern.FindStringSubmatch(line); match != nil {
+		done, _ := strconv.Atoi(match[1])
+		total, _ := strconv.Atoi(match[2])
+		if total > 0 && done <= total {
+			return float64(done) / float64(total) * 100
+		}
+	}
+
+	return -1
+}
+
+// scanLinesOrCR is a bufio.SplitFunc that splits on '\n' or '\r'
+func scanLinesOrCR(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// reportTask reports the progress of a package operation as a task, which
+// finishes when the update completes, or fails with line as its error
+func (m *Manager) reportTask(update *Update, status, line string, percent float64) {
+	m.mu.Lock()
+	task, ok := m.running[update.ID]
+	if !ok {
+		if m.registry == nil {
+			m.mu.Unlock()
+			return
+		}
+		task = m.registry.Start(update.ID, "update", update.Package)
+		m.running[update.ID] = task
+	}
+	if status == "completed" || status == "failed" {
+		delete(m.running, update.ID)
+	}
+	m.mu.Unlock()
+
+	switch status {
+	case "completed":
+		task.Done("")
+	case "failed":
+		task.Finish(errors.New(line))
+	default:
+		task.Progress(percent, line)
+	}
+}
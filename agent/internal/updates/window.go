@@ -0,0 +1,145 @@
+package updates
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrOutsideMaintenanceWindow is returned when updates are requested outside
+// a configured maintenance window and deferral is disabled
+var ErrOutsideMaintenanceWindow = errors.New("outside maintenance window")
+
+// MaintenanceWindow represents a recurring time range in which updates may run
+type MaintenanceWindow struct {
+	Days  []time.Weekday `json:"days,omitempty"` // empty means every day
+	Start string         `json:"start"`          // HH:MM
+	End   string         `json:"end"`            // HH:MM, may wrap past midnight
+}
+
+// MaintenanceConfig represents update scheduling constraints
+type MaintenanceConfig struct {
+	Windows   []MaintenanceWindow `json:"windows"`
+	Blackouts []string            `json:"blackouts,omitempty"` // YYYY-MM-DD
+	Location  string              `json:"location,omitempty"`  // IANA zone, defaults to local
+	Defer     bool                `json:"defer"`               // queue instead of refusing
+}
+
+// WindowStatus reports the maintenance window and the updates deferred
+// until it opens
+type WindowStatus struct {
+	Open     bool       `json:"open"`
+	Next     *time.Time `json:"next,omitempty"` // while closed, if it opens within a week
+	Deferred int        `json:"deferred"`
+}
+
+// Validate checks the maintenance configuration
+func (c *MaintenanceConfig) Validate() error {
+	for i, w := range c.Windows {
+		if _, err := parseClock(w.Start); err != nil {
+			return fmt.Errorf("window %d: invalid start: %w", i, err)
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return fmt.Errorf("window %d: invalid end: %w", i, err)
+		}
+	}
+	for _, d := range c.Blackouts {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return fmt.Errorf("invalid blackout date %q: %w", d, err)
+		}
+	}
+	if c.Location != "" {
+		if _, err := time.LoadLocation(c.Location); err != nil {
+			return fmt.Errorf("invalid location: %w", err)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether updates may run at t. A config without windows
+// allows any time that is not a blackout date.
+func (c *MaintenanceConfig) Allows(t time.Time) bool {
+	if c.Location != "" {
+		if loc, err := time.LoadLocation(c.Location); err == nil {
+			t = t.In(loc)
+		}
+	}
+
+	day := t.Format("2006-01-02")
+	for _, d := range c.Blackouts {
+		if d == day {
+			return false
+		}
+	}
+
+	if len(c.Windows) == 0 {
+		return true
+	}
+
+	for _, w := range c.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextWindow returns the start of the next allowed period after t, searching
+// up to a week ahead
+func (c *MaintenanceConfig) NextWindow(t time.Time) (time.Time, bool) {
+	// Windows are minute-granular, so stepping by minute finds the exact start
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.Add(8 * 24 * time.Hour); next.Before(end); next = next.Add(time.Minute) {
+		if c.Allows(next) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// contains reports whether t falls inside the window
+func (w MaintenanceWindow) contains(t time.Time) bool {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+
+	if start <= end {
+		return w.matchesDay(t.Weekday()) && now >= start && now < end
+	}
+
+	// Window wraps past midnight; the early-morning part belongs to the previous day
+	if now >= start {
+		return w.matchesDay(t.Weekday())
+	}
+	if now < end {
+		return w.matchesDay((t.Weekday() + 6) % 7)
+	}
+	return false
+}
+
+func (w MaintenanceWindow) matchesDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses an HH:MM string into an offset from midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,86 @@
+package updates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceConfigAllows(t *testing.T) {
+	// 2026-03-02 is a Monday
+	at := func(day int, clock string) time.Time {
+		c, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2026, 3, day, c.Hour(), c.Minute(), 0, 0, time.UTC)
+	}
+	weekdays := MaintenanceWindow{Days: []time.Weekday{time.Monday}, Start: "02:00", End: "04:00"}
+	overnight := MaintenanceWindow{Days: []time.Weekday{time.Monday}, Start: "22:00", End: "02:00"}
+
+	tests := []struct {
+		name   string
+		config MaintenanceConfig
+		t      time.Time
+		want   bool
+	}{
+		{"no windows", MaintenanceConfig{}, at(2, "13:37"), true},
+		{"at the start", MaintenanceConfig{Windows: []MaintenanceWindow{weekdays}}, at(2, "02:00"), true},
+		{"before the start", MaintenanceConfig{Windows: []MaintenanceWindow{weekdays}}, at(2, "01:59"), false},
+		{"last minute", MaintenanceConfig{Windows: []MaintenanceWindow{weekdays}}, at(2, "03:59"), true},
+		{"at the end", MaintenanceConfig{Windows: []MaintenanceWindow{weekdays}}, at(2, "04:00"), false},
+		{"other day", MaintenanceConfig{Windows: []MaintenanceWindow{weekdays}}, at(3, "02:30"), false},
+		{"overnight before midnight", MaintenanceConfig{Windows: []MaintenanceWindow{overnight}}, at(2, "23:00"), true},
+		{"overnight after midnight", MaintenanceConfig{Windows: []MaintenanceWindow{overnight}}, at(3, "01:59"), true},
+		{"overnight end", MaintenanceConfig{Windows: []MaintenanceWindow{overnight}}, at(3, "02:00"), false},
+		{"overnight of the day before", MaintenanceConfig{Windows: []MaintenanceWindow{overnight}}, at(2, "01:00"), false},
+		{"blackout", MaintenanceConfig{Blackouts: []string{"2026-03-02"}}, at(2, "13:37"), false},
+		{"blackout inside window", MaintenanceConfig{Windows: []MaintenanceWindow{weekdays}, Blackouts: []string{"2026-03-02"}}, at(2, "03:00"), false},
+		{"location", MaintenanceConfig{Windows: []MaintenanceWindow{weekdays}, Location: "Asia/Tokyo"}, at(1, "18:00"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.config.Allows(tt.t); got != tt.want {
+				t.Errorf("Allows(%s) = %v, want %v", tt.t.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaintenanceConfigNextWindow(t *testing.T) {
+	config := MaintenanceConfig{Windows: []MaintenanceWindow{{Days: []time.Weekday{time.Wednesday}, Start: "02:00", End: "04:00"}}}
+	from := time.Date(2026, 3, 2, 13, 37, 30, 0, time.UTC)
+
+	next, ok := config.NextWindow(from)
+	if want := time.Date(2026, 3, 4, 2, 0, 0, 0, time.UTC); !ok || !next.Equal(want) {
+		t.Errorf("NextWindow = %s, %v, want %s", next, ok, want)
+	}
+
+	closed := MaintenanceConfig{Windows: []MaintenanceWindow{{Start: "02:00", End: "04:00"}}, Blackouts: []string{
+		"2026-03-02", "2026-03-03", "2026-03-04", "2026-03-05", "2026-03-06", "2026-03-07", "2026-03-08", "2026-03-09", "2026-03-10",
+	}}
+	if next, ok := closed.NextWindow(from); ok {
+		t.Errorf("NextWindow = %s, want none within a week", next)
+	}
+}
+
+func TestMaintenanceConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MaintenanceConfig
+	}{
+		{"start", MaintenanceConfig{Windows: []MaintenanceWindow{{Start: "2am", End: "04:00"}}}},
+		{"end", MaintenanceConfig{Windows: []MaintenanceWindow{{Start: "02:00", End: "25:00"}}}},
+		{"blackout", MaintenanceConfig{Blackouts: []string{"03/02/2026"}}},
+		{"location", MaintenanceConfig{Location: "Mars/Olympus"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); err == nil {
+				t.Error("invalid config accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role is what a client of the local API may do
+type Role int
+
+const (
+	// RoleNone is an unauthenticated client
+	RoleNone Role = iota
+	// RoleRead may read the API and the dashboard
+	RoleRead
+	// RoleAdmin may also use the admin actions
+	RoleAdmin
+)
+
+const (
+	// sessionCookie holds the token a browser logged in with
+	sessionCookie = "shh_session"
+	// csrfHeader carries the CSRF token of mutating requests from browsers
+	csrfHeader = "X-CSRF-Token"
+)
+
+// DefaultAllowedNetworks are the networks clients may connect from unless
+// configured otherwise: loopback only
+var DefaultAllowedNetworks = []string{"127.0.0.0/8", "::1/128"}
+
+// Token is a bearer token accepted by the API
+type Token struct {
+	Value string
+	Admin bool
+}
+
+// User is a basic-auth user; PasswordHash is a bcrypt hash
+type User struct {
+	Username     string
+	PasswordHash string
+	Admin        bool
+}
+
+// AuthConfig configures who may use the API
+type AuthConfig struct {
+	Tokens []Token
+	Users  []User
+	// AdminClients are the common names of client certificates with the
+	// admin role; other verified certificates may only read
+	AdminClients []string
+	// AllowedNetworks are the CIDRs clients may connect from
+	AllowedNetworks []string
+}
+
+// Auth authenticates the requests to the API. A client authenticates with
+// a bearer token, basic auth, a session cookie set by logging in with a
+// token, or a verified client certificate.
+type Auth struct {
+	tokens       []Token
+	users        []User
+	adminClients map[string]bool
+	networks     []*net.IPNet
+	// csrfKey derives the CSRF token of each credential
+	csrfKey []byte
+}
+
+// identity is who a request was authenticated as
+type identity struct {
+	id   string
+	role Role
+	// ambient is set when the browser sends the credential by itself, so
+	// that a cross-site request would carry it too
+	ambient bool
+}
+
+type identityKey struct{}
+
+// NewAuth creates an Auth from config
+func NewAuth(config AuthConfig) (*Auth, error) {
+	a := &Auth{adminClients: make(map[string]bool), csrfKey: make([]byte, 32)}
+	if _, err := rand.Read(a.csrfKey); err != nil {
+		return nil, fmt.Errorf("failed to generate CSRF key: %w", err)
+	}
+	for _, token := range config.Tokens {
+		if token.Value == "" {
+			return nil, fmt.Errorf("empty API token")
+		}
+		a.tokens = append(a.tokens, token)
+	}
+	for _, user := range config.Users {
+		if user.Username == "" {
+			return nil, fmt.Errorf("API user without a username")
+		}
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("invalid password hash of API user %s: %w", user.Username, err)
+		}
+		a.users = append(a.users, user)
+	}
+	for _, name := range config.AdminClients {
+		a.adminClients[name] = true
+	}
+	networks := config.AllowedNetworks
+	if len(networks) == 0 {
+		networks = DefaultAllowedNetworks
+	}
+	for _, cidr := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network %q: %w", cidr, err)
+		}
+		a.networks = append(a.networks, network)
+	}
+	return a, nil
+}
+
+// LoadOrCreateToken reads the token at path, generating one readable only
+// by the agent's user if there is none. Local tools like top read it to
+// use the API.
+func LoadOrCreateToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read API token: %w", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create API token directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write API token: %w", err)
+	}
+	return token, nil
+}
+
+// ReadToken reads the token LoadOrCreateToken wrote at path
+func ReadToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// RoleOf returns the role the request was authenticated with
+func RoleOf(r *http.Request) Role {
+	if id, ok := r.Context().Value(identityKey{}).(identity); ok {
+		return id.role
+	}
+	return RoleNone
+}
+
+// CSRFToken returns the token mutating requests authenticated like r must
+// send in the X-CSRF-Token header
+func (a *Auth) CSRFToken(r *http.Request) string {
+	id, ok := r.Context().Value(identityKey{}).(identity)
+	if !ok {
+		return ""
+	}
+	return a.csrfToken(id.id)
+}
+
+func (a *Auth) csrfToken(id string) string {
+	mac := hmac.New(sha256.New, a.csrfKey)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Middleware rejects requests from outside the allowed networks, without
+// credentials, or that may be forged by another site
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.allowed(r.RemoteAddr) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		// Logging in with ?token= keeps the token in a cookie, so that the
+		// dashboard and its event stream work without it in the URL
+		if token := r.URL.Query().Get("token"); token != "" && r.Method == http.MethodGet {
+			if _, ok := a.token(token); !ok {
+				a.unauthorized(w)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+			query := r.URL.Query()
+			query.Del("token")
+			target := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+			http.Redirect(w, r, target.String(), http.StatusSeeOther)
+			return
+		}
+
+		id, ok := a.authenticate(r)
+		if !ok {
+			a.unauthorized(w)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && id.ambient {
+			if !sameOrigin(r) || !hmac.Equal([]byte(r.Header.Get(csrfHeader)), []byte(a.csrfToken(id.id))) {
+				http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+// authenticate finds the credential of r
+func (a *Auth) authenticate(r *http.Request) (identity, bool) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token := strings.TrimPrefix(header, "Bearer ")
+		if role, ok := a.token(token); ok {
+			return identity{id: "token:" + token, role: role}, true
+		}
+		return identity{}, false
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		for _, user := range a.users {
+			if subtle.ConstantTimeCompare([]byte(user.Username), []byte(username)) == 1 &&
+				bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil {
+				return identity{id: "user:" + user.Username, role: roleFor(user.Admin), ambient: true}, true
+			}
+		}
+		return identity{}, false
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if role, ok := a.token(cookie.Value); ok {
+			return identity{id: "token:" + cookie.Value, role: role, ambient: true}, true
+		}
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		return identity{id: "client:" + name, role: roleFor(a.adminClients[name]), ambient: true}, true
+	}
+	return identity{}, false
+}
+
+// token returns the role of token, comparing in constant time
+func (a *Auth) token(token string) (Role, bool) {
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Value), []byte(token)) == 1 {
+			return roleFor(t.Admin), true
+		}
+	}
+	return RoleNone, false
+}
+
+// allowed reports whether a client at remoteAddr may connect
+func (a *Auth) allowed(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Auth) unauthorized(w http.ResponseWriter) {
+	if len(a.users) > 0 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="shh-agent"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="shh-agent"`)
+	}
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+// sameOrigin reports whether a browser request comes from the API's own
+// pages. Requests without Origin or Referer aren't from a browser page.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func roleFor(admin bool) Role {
+	if admin {
+		return RoleAdmin
+	}
+	return RoleRead
+}
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewAuth(AuthConfig{
+		Tokens:          []Token{{Value: "reader"}, {Value: "admin", Admin: true}},
+		Users:           []User{{Username: "ops", PasswordHash: string(hash), Admin: true}},
+		AllowedNetworks: []string{"127.0.0.0/8", "10.1.0.0/16"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrf := func(id string) string { return auth.csrfToken(id) }
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		remote  string
+		headers map[string]string
+		cookie  string // session cookie
+		user    string // basic auth as ops
+		status  int
+		role    Role
+		// location of a redirect, and the session cookie it sets
+		location string
+		session  string
+	}{
+		{name: "outside the allowed networks", target: "/api/status", remote: "192.0.2.1:4000", headers: map[string]string{"Authorization": "Bearer admin"}, status: http.StatusForbidden},
+		{name: "allowed network", target: "/api/status", remote: "10.1.2.3:4000", headers: map[string]string{"Authorization": "Bearer reader"}, status: http.StatusOK, role: RoleRead},
+		{name: "unparsable address", target: "/api/status", remote: "@", headers: map[string]string{"Authorization": "Bearer admin"}, status: http.StatusForbidden},
+		{name: "no credentials", target: "/api/status", status: http.StatusUnauthorized},
+		{name: "wrong token", target: "/api/status", headers: map[string]string{"Authorization": "Bearer nope"}, status: http.StatusUnauthorized},
+		{name: "admin token", target: "/api/status", headers: map[string]string{"Authorization": "Bearer admin"}, status: http.StatusOK, role: RoleAdmin},
+		{name: "basic auth", target: "/api/status", user: "hunter2", status: http.StatusOK, role: RoleAdmin},
+		{name: "wrong password", target: "/api/status", user: "letmein", status: http.StatusUnauthorized},
+		{
+			name: "login", target: "/?token=reader&view=host", status: http.StatusSeeOther,
+			location: "/?view=host", session: "reader",
+		},
+		{name: "login with a wrong token", target: "/?token=nope", status: http.StatusUnauthorized},
+		{name: "cookie", target: "/api/status", cookie: "reader", status: http.StatusOK, role: RoleRead},
+		{name: "stale cookie", target: "/api/status", cookie: "revoked", status: http.StatusUnauthorized},
+		{name: "cookie post without CSRF token", method: http.MethodPost, target: "/api/actions", cookie: "admin", status: http.StatusForbidden},
+		{name: "cookie post with wrong CSRF token", method: http.MethodPost, target: "/api/actions", cookie: "admin", headers: map[string]string{csrfHeader: csrf("token:reader")}, status: http.StatusForbidden},
+		{name: "cookie post with CSRF token", method: http.MethodPost, target: "/api/actions", cookie: "admin", headers: map[string]string{csrfHeader: csrf("token:admin"), "Origin": "http://agent.local"}, status: http.StatusOK, role: RoleAdmin},
+		{name: "cross-site cookie post", method: http.MethodPost, target: "/api/actions", cookie: "admin", headers: map[string]string{csrfHeader: csrf("token:admin"), "Origin": "http://evil.example"}, status: http.StatusForbidden},
+		{name: "cross-site referer", method: http.MethodPost, target: "/api/actions", cookie: "admin", headers: map[string]string{csrfHeader: csrf("token:admin"), "Referer": "http://evil.example/page"}, status: http.StatusForbidden},
+		{name: "basic auth post without CSRF token", method: http.MethodPost, target: "/api/actions", user: "hunter2", status: http.StatusForbidden},
+		{name: "basic auth post with CSRF token", method: http.MethodPost, target: "/api/actions", user: "hunter2", headers: map[string]string{csrfHeader: csrf("user:ops")}, status: http.StatusOK, role: RoleAdmin},
+		{name: "bearer post needs no CSRF token", method: http.MethodPost, target: "/api/actions", headers: map[string]string{"Authorization": "Bearer admin", "Origin": "http://evil.example"}, status: http.StatusOK, role: RoleAdmin},
+		{name: "post doesn't log in", method: http.MethodPost, target: "/api/actions?token=admin", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var role Role
+			handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				role = RoleOf(r)
+			}))
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "http://agent.local"+tt.target, nil)
+			r.RemoteAddr = "127.0.0.1:4000"
+			if tt.remote != "" {
+				r.RemoteAddr = tt.remote
+			}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.cookie})
+			}
+			if tt.user != "" {
+				r.SetBasicAuth("ops", tt.user)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if role != tt.role {
+				t.Errorf("role %v, want %v", role, tt.role)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("no WWW-Authenticate challenge")
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("redirected to %q, want %q", got, tt.location)
+			}
+			var session *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == sessionCookie {
+					session = c
+				}
+			}
+			switch {
+			case tt.session == "" && session != nil:
+				t.Errorf("session cookie set: %v", session)
+			case tt.session != "" && session == nil:
+				t.Error("no session cookie set")
+			case session != nil:
+				if session.Value != tt.session || !session.HttpOnly || session.SameSite != http.SameSiteStrictMode {
+					t.Errorf("session cookie %v, want an HttpOnly strict cookie of %q", session, tt.session)
+				}
+			}
+		})
+	}
+}
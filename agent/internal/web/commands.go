@@ -0,0 +1,43 @@
+package web
+
+import "time"
+
+// DefaultCommandLogSize is how many recent commands are kept
+const DefaultCommandLogSize = 100
+
+// Command is a command the agent ran, or refused
+type Command struct {
+	ID       string        `json:"id"`
+	Command  string        `json:"command"`
+	Args     []string      `json:"args,omitempty"`
+	Roles    []string      `json:"roles,omitempty"`
+	Success  bool          `json:"success"`
+	Error    string        `json:"error,omitempty"`
+	Cached   bool          `json:"cached,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Timestamp is when the command was received
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// CommandLog keeps the most recent commands
+type CommandLog struct {
+	commands *ring[Command]
+}
+
+// NewCommandLog creates a log keeping the last size commands
+func NewCommandLog(size int) *CommandLog {
+	if size <= 0 {
+		size = DefaultCommandLogSize
+	}
+	return &CommandLog{commands: newRing[Command](size)}
+}
+
+// Add records c
+func (l *CommandLog) Add(c Command) {
+	l.commands.add(c)
+}
+
+// Recent returns the commands, newest first
+func (l *CommandLog) Recent() []Command {
+	return l.commands.recent()
+}
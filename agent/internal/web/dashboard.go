@@ -0,0 +1,46 @@
+package web
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var dashboardPage = template.Must(template.ParseFS(templates, "templates/dashboard.html"))
+
+// Dashboard serves the agent's health dashboard. It reads the local API;
+// in admin mode it also offers admins the actions of the admin endpoints.
+type Dashboard struct {
+	logger *zap.Logger
+	title  string
+	admin  bool
+	auth   *Auth
+}
+
+// NewDashboard creates a dashboard titled title, for the users auth lets
+// in
+func NewDashboard(logger *zap.Logger, title string, admin bool, auth *Auth) *Dashboard {
+	return &Dashboard{logger: logger, title: title, admin: admin, auth: auth}
+}
+
+// ServeHTTP renders the dashboard at the root of the server
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardPage.Execute(w, struct {
+		Title string
+		Admin bool
+		CSRF  string
+	}{d.title, d.admin && RoleOf(r) == RoleAdmin, d.auth.CSRFToken(r)})
+	if err != nil {
+		d.logger.Debug("Failed to render dashboard", zap.Error(err))
+	}
+}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"time"
+
+	"shh/agent/internal/events"
+)
+
+// DefaultEventLogSize is how many recent events are kept
+const DefaultEventLogSize = 200
+
+// Event is an event published on the agent's bus
+type Event struct {
+	Topic     string      `json:"topic"`
+	Data      interface{} `json:"data"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// EventLog keeps the most recent events
+type EventLog struct {
+	events *ring[Event]
+}
+
+// NewEventLog creates a log keeping the last size events
+func NewEventLog(size int) *EventLog {
+	if size <= 0 {
+		size = DefaultEventLogSize
+	}
+	return &EventLog{events: newRing[Event](size)}
+}
+
+// Add records e, replacing the oldest event once the log is full
+func (l *EventLog) Add(e events.Event) {
+	l.events.add(Event{Topic: string(e.Topic), Data: e.Payload, Timestamp: e.Timestamp})
+}
+
+// Recent returns the events, newest first
+func (l *EventLog) Recent() []Event {
+	return l.events.recent()
+}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"time"
+
+	"shh/agent/internal/metrics"
+)
+
+// DefaultHistorySize is how many metric samples are kept for the
+// sparklines, half an hour at the default interval
+const DefaultHistorySize = 120
+
+// Sample is a summary of one metrics collection, in percent except for the
+// load
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	CPU       float64   `json:"cpu"`
+	Memory    float64   `json:"memory"`
+	Disk      float64   `json:"disk"`
+	Load      float64   `json:"load"`
+}
+
+// MetricsHistory keeps the most recent metric samples
+type MetricsHistory struct {
+	samples *ring[Sample]
+}
+
+// NewMetricsHistory creates a history keeping the last size samples
+func NewMetricsHistory(size int) *MetricsHistory {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &MetricsHistory{samples: newRing[Sample](size)}
+}
+
+// Observe records a sample of m; it suits metrics.Collector.OnCollect
+func (h *MetricsHistory) Observe(m *metrics.SystemMetrics) {
+	if m == nil {
+		return
+	}
+	h.samples.add(Sample{
+		Timestamp: m.Timestamp,
+		CPU:       m.CPUUsage,
+		Memory:    percent(m.MemoryUsed, m.MemoryTotal),
+		Disk:      percent(m.DiskUsed, m.DiskTotal),
+		Load:      m.LoadAverage[0],
+	})
+}
+
+// Samples returns the samples, oldest first
+func (h *MetricsHistory) Samples() []Sample {
+	samples := h.samples.recent()
+	for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+		samples[i], samples[j] = samples[j], samples[i]
+	}
+	return samples
+}
+
+func percent(used, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(used) / float64(total) * 100
+}
@@ -0,0 +1,41 @@
+package web
+
+import "sync"
+
+// ring keeps the last items added to it
+type ring[T any] struct {
+	mu    sync.RWMutex
+	items []T
+	next  int
+	full  bool
+}
+
+func newRing[T any](size int) *ring[T] {
+	return &ring[T]{items: make([]T, size)}
+}
+
+// add records item, replacing the oldest once the ring is full
+func (r *ring[T]) add(item T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[r.next] = item
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// recent returns the items, newest first
+func (r *ring[T]) recent() []T {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := r.next
+	if r.full {
+		n = len(r.items)
+	}
+	recent := make([]T, 0, n)
+	for i := 1; i <= n; i++ {
+		recent = append(recent, r.items[(r.next-i+len(r.items))%len(r.items)])
+	}
+	return recent
+}
@@ -0,0 +1,193 @@
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/systemd"
+	"shh/agent/internal/tasks"
+)
+
+// Status describes the running agent
+type Status struct {
+	AgentID  string    `json:"agent_id"`
+	Version  string    `json:"version"`
+	Hostname string    `json:"hostname"`
+	Started  time.Time `json:"started"`
+	Health   string    `json:"health"`
+	// Connected is set while the agent is connected to the server;
+	// Offline when it runs without one
+	Connected bool `json:"connected"`
+	Offline   bool `json:"offline,omitempty"`
+}
+
+// HealthCheck is the last result of a health check
+type HealthCheck struct {
+	Name      string        `json:"name"`
+	Status    string        `json:"status"`
+	Message   string        `json:"message,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// Server serves the agent's local API, for the dashboard and the top
+// command
+type Server struct {
+	logger *zap.Logger
+	addr   string
+	mux    *http.ServeMux
+	server *http.Server
+	stream *Stream
+	auth   *Auth
+	tls    *tls.Config
+}
+
+// NewServer creates a server listening on addr, which must be a loopback
+// address unless the server uses TLS. A socket named "api" passed by
+// systemd socket activation is used instead. Every request is checked by
+// auth. The tasks of registry are served at /api/tasks. Updates are
+// streamed at /api/stream, task progress among them.
+func NewServer(logger *zap.Logger, addr string, auth *Auth, registry *tasks.Registry) *Server {
+	s := &Server{logger: logger, addr: addr, mux: http.NewServeMux(), stream: NewStream(logger), auth: auth}
+	SetupRoutes(s.mux, registry)
+	s.mux.Handle("/api/stream", s.stream)
+	registry.OnChange(func(task protocol.TaskProgress) {
+		s.stream.Publish("task", task)
+	})
+	return s
+}
+
+// SetTLS serves the API over TLS. It must be called before Start.
+func (s *Server) SetTLS(config *tls.Config) {
+	s.tls = config
+}
+
+// Publish streams data to the dashboard as an update of kind
+func (s *Server) Publish(kind string, data interface{}) {
+	s.stream.Publish(kind, data)
+}
+
+// Handle serves handler at pattern. It must be called before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// JSON serves the value get returns at path, for GET requests
+func (s *Server) JSON(path string, get func(ctx context.Context) (interface{}, error)) {
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		value, err := get(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(value); err != nil {
+			s.logger.Debug("Failed to write API response", zap.String("path", path), zap.Error(err))
+		}
+	})
+}
+
+// Action runs do for POST requests to path by admins and answers with
+// its result
+func (s *Server) Action(path string, do func(r *http.Request) (interface{}, error)) {
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if RoleOf(r) != RoleAdmin {
+			http.Error(w, "admin role required", http.StatusForbidden)
+			return
+		}
+		result, err := do(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			s.logger.Debug("Failed to write API response", zap.String("path", path), zap.Error(err))
+		}
+	})
+}
+
+// Start serves the API until Shutdown
+func (s *Server) Start(ctx context.Context) error {
+	listener := systemd.Listener("api")
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", s.addr); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+		}
+	}
+	// Tokens and cookies must not cross the network in the clear
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() && s.tls == nil {
+		listener.Close()
+		return fmt.Errorf("local API on %s is not bound to loopback and has no TLS", listener.Addr())
+	}
+	if s.tls != nil {
+		listener = tls.NewListener(listener, s.tls)
+	}
+
+	s.server = &http.Server{
+		Handler:           s.auth.Middleware(s.mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Local API server failed", zap.Error(err))
+		}
+	}()
+
+	s.logger.Info("Serving local API", zap.String("address", listener.Addr().String()))
+	return nil
+}
+
+// Shutdown stops serving. Streams are ended first, since the server waits
+// for its requests to finish.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stream.Close()
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
+
+// LoadTLS loads the certificate the API serves. With clientCA, clients
+// must present a certificate it signed.
+func LoadTLS(certFile, keyFile, clientCA string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API certificate: %w", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCA != "" {
+		data, err := os.ReadFile(clientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in API client CA %s", clientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
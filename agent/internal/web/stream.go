@@ -0,0 +1,137 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// streamBuffer is how many updates wait for a slow client before
+	// its oldest are dropped
+	streamBuffer = 32
+	// streamKeepAlive is how often an idle stream sends a comment, so
+	// that proxies don't close it
+	streamKeepAlive = 30 * time.Second
+)
+
+// update is a server-sent event
+type update struct {
+	kind string
+	data []byte
+}
+
+// Stream pushes updates to the dashboard as server-sent events. A new
+// client first receives the last update of every kind.
+type Stream struct {
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	clients map[chan update]struct{}
+	last    map[string]update
+	order   []string
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// NewStream creates a stream without clients
+func NewStream(logger *zap.Logger) *Stream {
+	return &Stream{
+		logger:  logger,
+		clients: make(map[chan update]struct{}),
+		last:    make(map[string]update),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Publish sends data to the clients as an event of kind
+func (s *Stream) Publish(kind string, data interface{}) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		s.logger.Debug("Failed to marshal stream update", zap.String("kind", kind), zap.Error(err))
+		return
+	}
+	u := update{kind: kind, data: encoded}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.last[kind]; !ok {
+		s.order = append(s.order, kind)
+	}
+	s.last[kind] = u
+	for client := range s.clients {
+		select {
+		case client <- u:
+		default:
+			// Make room by dropping the oldest update
+			select {
+			case <-client:
+			default:
+			}
+			select {
+			case client <- u:
+			default:
+			}
+		}
+	}
+}
+
+// Close ends the streams of every client
+func (s *Stream) Close() {
+	s.once.Do(func() { close(s.closed) })
+}
+
+// ServeHTTP streams the updates to a client until it goes away
+func (s *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client := make(chan update, streamBuffer)
+	s.mu.Lock()
+	for _, kind := range s.order {
+		select {
+		case client <- s.last[kind]:
+		default:
+		}
+	}
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case u := <-client:
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", u.kind, u.data)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -3,63 +3,45 @@ package web
 import (
 	"encoding/json"
 	"net/http"
-	"sync"
 
-	"github.com/gorilla/mux"
+	"shh/agent/internal/tasks"
 )
 
-// KeyDistributionStatus represents the current status of key distribution
-type KeyDistributionStatus struct {
-	Status    string            `json:"status"`
-	Details   string            `json:"details"`
-	Progress  int               `json:"progress"`
-	AgentKeys map[string]string `json:"agent_keys"` // Map of agent IDs to their key status
-}
-
-var (
-	currentStatus = KeyDistributionStatus{
-		Status:    "Not started",
-		Details:   "",
-		Progress:  0,
-		AgentKeys: make(map[string]string),
+// TasksHandler returns the tasks of registry, running first, or the task
+// named by the id parameter
+func TasksHandler(registry *tasks.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var value interface{} = registry.List()
+		if id := r.URL.Query().Get("id"); id != "" {
+			task, ok := registry.Get(id)
+			if !ok {
+				http.Error(w, "task not found", http.StatusNotFound)
+				return
+			}
+			value = task
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(value)
 	}
-	statusMutex sync.RWMutex
-)
-
-// UpdateStatus updates the current key distribution status
-func UpdateStatus(status string, details string, progress int) {
-	statusMutex.Lock()
-	defer statusMutex.Unlock()
-	
-	currentStatus.Status = status
-	currentStatus.Details = details
-	currentStatus.Progress = progress
-}
-
-// UpdateAgentKeyStatus updates the key status for a specific agent
-func UpdateAgentKeyStatus(agentID, status string) {
-	statusMutex.Lock()
-	defer statusMutex.Unlock()
-	
-	currentStatus.AgentKeys[agentID] = status
 }
 
-// StatusHandler returns the current status of SSH key distribution
-func StatusHandler(w http.ResponseWriter, r *http.Request) {
-	statusMutex.RLock()
-	defer statusMutex.RUnlock()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(currentStatus)
-}
-
-// StatusPageHandler serves the status page template
+// StatusPageHandler serves the task status page
 func StatusPageHandler(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "internal/web/templates/status.html")
+	page, err := templates.ReadFile("templates/status.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
 }
 
-// SetupRoutes sets up the web routes for key distribution status
-func SetupRoutes(r *mux.Router) {
-	r.HandleFunc("/api/keys/status", StatusHandler).Methods("GET")
-	r.HandleFunc("/status", StatusPageHandler).Methods("GET")
+// SetupRoutes sets up the web routes for the tasks of registry
+func SetupRoutes(mux *http.ServeMux, registry *tasks.Registry) {
+	mux.HandleFunc("/api/tasks", TasksHandler(registry))
+	mux.HandleFunc("/status", StatusPageHandler)
 }
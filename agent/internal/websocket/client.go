@@ -2,14 +2,18 @@ package websocket
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 
+	"shh/agent/internal/crash"
 	"shh/agent/internal/protocol"
 )
 
@@ -21,30 +25,116 @@ type Client struct {
 	handlers  map[protocol.MessageType]protocol.MessageHandler
 	done      chan struct{}
 	mu        sync.RWMutex
+	// endpoints are the servers to fail over between; url is the one in
+	// use
+	endpoints      []Endpoint
+	reconnectDelay time.Duration
+	failback       time.Duration
+	events         chan<- interface{}
+	// stop ends supervision; closed refuses new connections after Close
+	stop   chan struct{}
+	closed bool
+	// deflate is set when the connection negotiated permessage-deflate
+	compression CompressionConfig
+	deflate     bool
+	stats       compressionStats
+	// codecs are offered when registering; codec is the one in use
+	codecs []string
+	codec  protocol.Codec
+	// methods answer server requests; pending await replies to ours
+	methods     map[string]RequestHandler
+	pending     map[string]pendingRequest
+	nextRequest atomic.Uint64
+	// observer times handlers; sending counts the messages waiting to be
+	// written
+	observer HandlerObserver
+	sending  atomic.Int64
+	// limiter refuses messages from the server beyond the rate limits
+	limiter *rateLimiter
+	// dead holds the messages whose handlers kept failing
+	dead *deadLetters
+	// identity authenticates the connections; nil connects anonymously
+	identity Identity
+}
+
+// Identity authenticates the agent when it connects; implemented by
+// enroll.Identity
+type Identity interface {
+	// Header is sent with the handshake
+	Header() http.Header
+	// TLSConfig presents the client certificate on wss connections
+	TLSConfig() *tls.Config
 }
 
 func NewClient(url string, agentInfo protocol.AgentInfo, logger *zap.Logger) *Client {
 	return &Client{
-		url:       url,
-		agentInfo: agentInfo,
-		logger:    logger,
-		handlers:  make(map[protocol.MessageType]protocol.MessageHandler),
-		done:      make(chan struct{}),
+		url:            url,
+		agentInfo:      agentInfo,
+		logger:         logger,
+		handlers:       make(map[protocol.MessageType]protocol.MessageHandler),
+		done:           make(chan struct{}),
+		endpoints:      []Endpoint{{URL: url}},
+		reconnectDelay: defaultReconnectDelay,
+		compression:    DefaultCompressionConfig,
+		codecs:         defaultCodecs,
+		codec:          jsonCodec,
+		methods:        make(map[string]RequestHandler),
+		pending:        make(map[string]pendingRequest),
+		limiter:        newRateLimiter(DefaultRateLimits),
+		dead:           newDeadLetters(),
 	}
 }
 
+// Connect connects to the most preferred reachable server. The connection
+// is then kept up until Close: when it is lost the client reconnects,
+// failing over between servers.
 func (c *Client) Connect(ctx context.Context) error {
-	dialer := websocket.Dialer{
-		HandshakeTimeout: 10 * time.Second,
+	c.mu.Lock()
+	c.closed = false
+	c.mu.Unlock()
+
+	if err := c.connectAny(ctx, time.Time{}); err != nil {
+		return err
 	}
 
-	conn, _, err := dialer.DialContext(ctx, c.url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to connect to websocket: %w", err)
+	c.mu.Lock()
+	start := c.stop == nil
+	if start {
+		c.stop = make(chan struct{})
+	}
+	stop := c.stop
+	c.mu.Unlock()
+	if start {
+		crash.Go("websocket-supervise", func() { c.supervise(stop) })
 	}
+	return nil
+}
 
+// attach makes conn the client's connection and registers with the
+// server over it
+func (c *Client) attach(conn *websocket.Conn, url string, deflate bool) error {
+	// Each connection gets its own done channel, so that the client can
+	// reconnect after Close
+	done := make(chan struct{})
 	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return fmt.Errorf("client closed")
+	}
 	c.conn = conn
+	c.done = done
+	c.url = url
+	c.deflate = deflate
+	// Every connection starts on JSON until the server accepts a codec
+	c.codec = jsonCodec
+	info := c.agentInfo
+	info.Codecs = c.codecs
+	if deflate {
+		if err := conn.SetCompressionLevel(c.compression.Level); err != nil {
+			c.logger.Warn("Failed to set compression level", zap.Error(err))
+		}
+	}
 	c.mu.Unlock()
 
 	// Send registration message with agent info
@@ -54,19 +144,78 @@ func (c *Client) Connect(ctx context.Context) error {
 		Timestamp: time.Now(),
 	}
 
-	regPayload, err := json.Marshal(c.agentInfo)
+	regPayload, err := json.Marshal(info)
 	if err != nil {
 		return fmt.Errorf("failed to marshal agent info: %w", err)
 	}
 	regMsg.Payload = regPayload
 
+	crash.Go("websocket-read", func() { c.readPump(conn, done) })
+
 	if err := c.SendMessage(regMsg); err != nil {
+		conn.Close()
 		return fmt.Errorf("failed to send registration message: %w", err)
 	}
+	return nil
+}
 
-	go c.readPump()
+// SetURL points the client at a single server. A connected client closes
+// its connection and reconnects right away.
+func (c *Client) SetURL(ctx context.Context, url string) error {
+	return c.SetEndpoints(ctx, []Endpoint{{URL: url}})
+}
 
-	return nil
+// AgentInfo returns the info the agent registers with
+func (c *Client) AgentInfo() protocol.AgentInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.agentInfo
+}
+
+// UpdateFeatures replaces the registered features and command prefixes and
+// tells the server when connected. Reconnects register with the new values.
+func (c *Client) UpdateFeatures(features, commands []string) error {
+	c.mu.Lock()
+	c.agentInfo.Features = features
+	c.agentInfo.Commands = commands
+	agentID := c.agentInfo.ID
+	connected := c.conn != nil
+	c.mu.Unlock()
+
+	if !connected {
+		return nil
+	}
+
+	payload, err := json.Marshal(protocol.FeatureUpdate{
+		AgentID:   agentID,
+		Features:  features,
+		Commands:  commands,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal feature update: %w", err)
+	}
+	return c.SendMessage(protocol.Message{
+		Type:      protocol.TypeFeatures,
+		ID:        fmt.Sprintf("features-%d", time.Now().UnixNano()),
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+}
+
+// SetIdentity authenticates the next connections with identity
+func (c *Client) SetIdentity(identity Identity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.identity = identity
+}
+
+// SetSystemInfo sets the system info the agent registers with. It takes
+// effect on the next registration.
+func (c *Client) SetSystemInfo(info json.RawMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.agentInfo.System = info
 }
 
 func (c *Client) RegisterHandler(messageType protocol.MessageType, handler protocol.MessageHandler) {
@@ -75,19 +224,20 @@ func (c *Client) RegisterHandler(messageType protocol.MessageType, handler proto
 	c.handlers[messageType] = handler
 }
 
-func (c *Client) readPump() {
+func (c *Client) readPump(conn *websocket.Conn, done chan struct{}) {
 	defer func() {
 		c.mu.Lock()
-		if c.conn != nil {
+		if c.conn == conn {
 			c.conn.Close()
 			c.conn = nil
 		}
+		c.failPending(conn)
 		c.mu.Unlock()
-		close(c.done)
+		close(done)
 	}()
 
 	for {
-		messageType, data, err := c.conn.ReadMessage()
+		messageType, data, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				c.logger.Error("Unexpected websocket close", zap.Error(err))
@@ -95,15 +245,40 @@ func (c *Client) readPump() {
 			return
 		}
 
-		if messageType != websocket.TextMessage {
+		if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
 			continue
 		}
 
 		var msg protocol.Message
-		if err := json.Unmarshal(data, &msg); err != nil {
+		if err := c.decode(messageType, data, &msg); err != nil {
 			c.logger.Error("Failed to unmarshal message", zap.Error(err))
 			continue
 		}
+		if err := protocol.DecodePayload(&msg); err != nil {
+			c.logger.Error("Failed to decode message payload",
+				zap.String("type", string(msg.Type)),
+				zap.Error(err))
+			continue
+		}
+		if msg.Type == protocol.TypeRegistered {
+			if err := c.handleRegistered(conn, msg); err != nil {
+				c.logger.Error("Failed to handle registration reply", zap.Error(err))
+			}
+			continue
+		}
+		if msg.Type == protocol.TypeReply {
+			c.handleReply(msg)
+			continue
+		}
+		if !c.admit(msg) {
+			continue
+		}
+		if msg.Type == protocol.TypeRequest {
+			// Handlers may make requests of their own, whose replies
+			// this loop has to read
+			crash.Go("websocket-request", func() { c.handleRequest(context.Background(), msg) })
+			continue
+		}
 
 		c.mu.RLock()
 		handler, exists := c.handlers[msg.Type]
@@ -115,32 +290,41 @@ func (c *Client) readPump() {
 			continue
 		}
 
-		if err := handler(context.Background(), msg); err != nil {
-			c.logger.Error("Handler failed",
-				zap.String("type", string(msg.Type)),
-				zap.Error(err))
-		}
+		c.dispatch(handler, msg)
 	}
 }
 
 func (c *Client) SendMessage(msg protocol.Message) error {
 	c.mu.RLock()
 	conn := c.conn
+	compression := c.compression
+	deflate := c.deflate
+	codec := c.codec
 	c.mu.RUnlock()
 
 	if conn == nil {
 		return fmt.Errorf("not connected")
 	}
 
-	data, err := json.Marshal(msg)
+	c.compress(&msg, compression, deflate)
+	data, err := codec.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
+	frame := websocket.TextMessage
+	if codec.Binary() {
+		frame = websocket.BinaryMessage
+	}
 
+	c.sending.Add(1)
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.sending.Add(-1)
 
-	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+	if deflate {
+		conn.EnableWriteCompression(len(data) >= deflateMinSize)
+	}
+	if err := conn.WriteMessage(frame, data); err != nil {
 		return fmt.Errorf("failed to write message: %w", err)
 	}
 
@@ -149,11 +333,15 @@ func (c *Client) SendMessage(msg protocol.Message) error {
 
 func (c *Client) Close(ctx context.Context) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
+	c.closed = true
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
 	if c.conn != nil {
 		select {
 		case <-ctx.Done():
+			c.mu.Unlock()
 			return ctx.Err()
 		default:
 			if err := c.conn.WriteMessage(websocket.CloseMessage,
@@ -161,14 +349,18 @@ func (c *Client) Close(ctx context.Context) error {
 				c.logger.Warn("Error sending close message", zap.Error(err))
 			}
 			if err := c.conn.Close(); err != nil {
+				c.mu.Unlock()
 				return fmt.Errorf("error closing connection: %w", err)
 			}
 			c.conn = nil
 		}
 	}
+	// The read pump takes the lock on its way out
+	done := c.done
+	c.mu.Unlock()
 
 	select {
-	case <-c.done:
+	case <-done:
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
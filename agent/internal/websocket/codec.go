@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// defaultCodecs are the binary codecs offered when registering
+var defaultCodecs = []string{protocol.CodecCBOR}
+
+var jsonCodec, _ = protocol.NewCodec(protocol.CodecJSON)
+
+// SetCodecs sets the binary codecs offered to the server when registering,
+// in order of preference. No codecs keeps every connection on JSON. The
+// offer applies from the next registration.
+func (c *Client) SetCodecs(names []string) error {
+	for _, name := range names {
+		if _, err := protocol.NewCodec(name); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.codecs = append([]string(nil), names...)
+	return nil
+}
+
+// Codec returns the name of the codec in use
+func (c *Client) Codec() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.codec.Name()
+}
+
+// handleRegistered switches to the codec the server accepted
+func (c *Client) handleRegistered(conn *websocket.Conn, msg protocol.Message) error {
+	var reply protocol.Registered
+	if err := json.Unmarshal(msg.Payload, &reply); err != nil {
+		return fmt.Errorf("invalid registration reply: %w", err)
+	}
+	name := reply.Codec
+	if name == "" {
+		name = protocol.CodecJSON
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name != protocol.CodecJSON && !contains(c.codecs, name) {
+		return fmt.Errorf("server chose a codec that wasn't offered: %s", name)
+	}
+	codec, err := protocol.NewCodec(name)
+	if err != nil {
+		return err
+	}
+	// A reply to an earlier connection is stale
+	if c.conn != conn {
+		return nil
+	}
+	c.codec = codec
+	c.logger.Info("Registered with server", zap.String("codec", name))
+	return nil
+}
+
+// decode decodes a frame read from the server. Text frames are always
+// JSON; binary frames use the negotiated codec.
+func (c *Client) decode(messageType int, data []byte, msg *protocol.Message) error {
+	if messageType == websocket.TextMessage {
+		return json.Unmarshal(data, msg)
+	}
+	c.mu.RLock()
+	codec := c.codec
+	c.mu.RUnlock()
+	if !codec.Binary() {
+		return fmt.Errorf("binary message before a binary codec was negotiated")
+	}
+	return codec.Unmarshal(data, msg)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"compress/flate"
+	"sync/atomic"
+
+	"shh/agent/internal/protocol"
+)
+
+// deflateMinSize is the smallest message worth compressing with
+// permessage-deflate
+const deflateMinSize = 256
+
+// CompressionConfig controls how messages are compressed
+type CompressionConfig struct {
+	// Deflate negotiates permessage-deflate with the server
+	Deflate bool
+	// Level is the flate level, from 1 (fastest) to 9 (smallest)
+	Level int
+	// GzipThreshold is the smallest payload gzipped when the server did
+	// not accept permessage-deflate; 0 disables gzip
+	GzipThreshold int
+}
+
+// DefaultCompressionConfig negotiates deflate and falls back to gzipping
+// payloads of 4KB and more
+var DefaultCompressionConfig = CompressionConfig{
+	Deflate:       true,
+	Level:         flate.BestSpeed,
+	GzipThreshold: 4096,
+}
+
+// compressionStats counts gzipped payloads
+type compressionStats struct {
+	messages atomic.Uint64
+	in       atomic.Uint64
+	out      atomic.Uint64
+}
+
+// SetCompression changes how messages are compressed. Deflate settings
+// apply from the next connection.
+func (c *Client) SetCompression(config CompressionConfig) {
+	if config.Level < flate.BestSpeed || config.Level > flate.BestCompression {
+		config.Level = flate.BestSpeed
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.compression = config
+}
+
+// CompressionStats returns the bytes saved by gzipping payloads
+func (c *Client) CompressionStats() protocol.CompressionStats {
+	c.mu.RLock()
+	deflate := c.deflate
+	c.mu.RUnlock()
+
+	in, out := c.stats.in.Load(), c.stats.out.Load()
+	return protocol.CompressionStats{
+		Deflate:    deflate,
+		Messages:   c.stats.messages.Load(),
+		BytesIn:    in,
+		BytesOut:   out,
+		BytesSaved: int64(in) - int64(out),
+	}
+}
+
+// compress gzips the payload of msg if it is large enough and the
+// connection doesn't compress already
+func (c *Client) compress(msg *protocol.Message, config CompressionConfig, deflate bool) {
+	if deflate || config.GzipThreshold <= 0 || len(msg.Payload) < config.GzipThreshold {
+		return
+	}
+	size := len(msg.Payload)
+	ok, err := protocol.EncodePayload(msg)
+	if err != nil || !ok {
+		return
+	}
+	c.stats.messages.Add(1)
+	c.stats.in.Add(uint64(size))
+	c.stats.out.Add(uint64(len(msg.Payload)))
+}
@@ -0,0 +1,314 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/crash"
+	"shh/agent/internal/protocol"
+	"shh/agent/internal/store"
+)
+
+// maxDeadLetters bounds the dead letters kept; the oldest are dropped
+const maxDeadLetters = 100
+
+// RetryPolicy decides how often a failed message handler is retried
+// before its message becomes a dead letter
+type RetryPolicy struct {
+	// Attempts counts the handler calls, the first included; 1 disables
+	// retries
+	Attempts int
+	// Backoff is the wait before the first retry, doubled after each
+	// one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy retries twice, after 2 and 4 seconds
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   3,
+	Backoff:    2 * time.Second,
+	MaxBackoff: 30 * time.Second,
+}
+
+// DeadLetter is a message whose handler kept failing
+type DeadLetter struct {
+	Message      protocol.Message   `json:"message"`
+	Error        string             `json:"error"`
+	ErrorCode    protocol.ErrorCode `json:"error_code,omitempty"`
+	Attempts     int                `json:"attempts"`
+	FirstFailure time.Time          `json:"first_failure"`
+	LastFailure  time.Time          `json:"last_failure"`
+}
+
+// deadLetters holds the dead letters by message ID, persisted in records
+// when set
+type deadLetters struct {
+	mu      sync.Mutex
+	policy  RetryPolicy
+	letters map[string]DeadLetter
+	records *store.Bucket[DeadLetter]
+}
+
+func newDeadLetters() *deadLetters {
+	return &deadLetters{
+		policy:  DefaultRetryPolicy,
+		letters: make(map[string]DeadLetter),
+	}
+}
+
+// SetRetryPolicy changes how failed message handlers are retried
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	if policy.Attempts < 1 {
+		policy.Attempts = 1
+	}
+	c.dead.mu.Lock()
+	defer c.dead.mu.Unlock()
+	c.dead.policy = policy
+}
+
+// SetDeadLetterStore keeps dead letters in s and restores them, so that
+// they can still be retried after a restart
+func (c *Client) SetDeadLetterStore(s *store.Store) error {
+	records := store.NewBucket[DeadLetter](s, store.BucketDeadLetters)
+	saved, err := records.All()
+	if err != nil {
+		return fmt.Errorf("failed to load dead letters: %w", err)
+	}
+	c.dead.mu.Lock()
+	defer c.dead.mu.Unlock()
+	c.dead.records = records
+	for id, letter := range saved {
+		if _, ok := c.dead.letters[id]; !ok {
+			c.dead.letters[id] = letter
+		}
+	}
+	c.logger.Info("Dead letters restored", zap.Int("letters", len(saved)))
+	return nil
+}
+
+// DeadLetters returns the messages whose handlers kept failing, oldest
+// first
+func (c *Client) DeadLetters() []DeadLetter {
+	c.dead.mu.Lock()
+	defer c.dead.mu.Unlock()
+	return c.dead.sorted()
+}
+
+// RetryDeadLetter runs the handler of a dead letter again, removing the
+// letter if it succeeds
+func (c *Client) RetryDeadLetter(ctx context.Context, id string) error {
+	c.dead.mu.Lock()
+	letter, ok := c.dead.letters[id]
+	c.dead.mu.Unlock()
+	if !ok {
+		return protocol.Errorf(protocol.ErrorNotFound, "dead letter not found: %s", id)
+	}
+
+	c.mu.RLock()
+	handler, exists := c.handlers[letter.Message.Type]
+	c.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("no handler registered for message type %s", letter.Message.Type)
+	}
+
+	start := time.Now()
+	err := handler(ctx, letter.Message)
+	c.observe(string(letter.Message.Type), start, err)
+	if err != nil {
+		letter.Attempts++
+		letter.Error = err.Error()
+		letter.ErrorCode = protocol.CodeOf(err)
+		letter.LastFailure = time.Now()
+		c.dead.put(c.logger, letter)
+		return err
+	}
+	c.dead.remove(c.logger, id)
+	return nil
+}
+
+// PurgeDeadLetters removes the dead letters and returns how many there
+// were
+func (c *Client) PurgeDeadLetters() int {
+	c.dead.mu.Lock()
+	ids := make([]string, 0, len(c.dead.letters))
+	for id := range c.dead.letters {
+		ids = append(ids, id)
+	}
+	c.dead.mu.Unlock()
+	for _, id := range ids {
+		c.dead.remove(c.logger, id)
+	}
+	return len(ids)
+}
+
+// HandleDeadLetterCommand runs a deadletters:* command
+func (c *Client) HandleDeadLetterCommand(ctx context.Context, cmd string, args []string) (interface{}, error) {
+	switch cmd {
+	case "deadletters:list":
+		return c.DeadLetters(), nil
+	case "deadletters:retry":
+		// deadletters:retry <message-id>
+		if len(args) < 1 {
+			return nil, protocol.Errorf(protocol.ErrorValidation, "message ID required")
+		}
+		return nil, c.RetryDeadLetter(ctx, args[0])
+	case "deadletters:purge":
+		return map[string]int{"purged": c.PurgeDeadLetters()}, nil
+	default:
+		return nil, protocol.Errorf(protocol.ErrorValidation, "unknown dead letter command: %s", cmd)
+	}
+}
+
+// dispatch runs the handler of msg, retrying it in the background by the
+// retry policy when it fails. A message that fails every attempt becomes
+// a dead letter and the server is notified. Commands are never retried
+// automatically: they may have had effects before failing, so they become
+// dead letters at once, to be retried by hand.
+func (c *Client) dispatch(handler protocol.MessageHandler, msg protocol.Message) {
+	start := time.Now()
+	err := handler(context.Background(), msg)
+	c.observe(string(msg.Type), start, err)
+	if err == nil {
+		return
+	}
+	c.logger.Error("Handler failed",
+		zap.String("type", string(msg.Type)),
+		zap.String("id", msg.ID),
+		zap.Error(err))
+
+	letter := DeadLetter{
+		Message:      msg,
+		Error:        err.Error(),
+		ErrorCode:    protocol.CodeOf(err),
+		Attempts:     1,
+		FirstFailure: start,
+		LastFailure:  time.Now(),
+	}
+	c.dead.mu.Lock()
+	policy := c.dead.policy
+	c.dead.mu.Unlock()
+	if policy.Attempts <= 1 || msg.Type == protocol.TypeCommand {
+		c.bury(letter)
+		return
+	}
+	crash.Go("websocket-retry", func() { c.retry(handler, letter, policy) })
+}
+
+// retry calls the handler of a failed message until it succeeds or the
+// policy's attempts are used up
+func (c *Client) retry(handler protocol.MessageHandler, letter DeadLetter, policy RetryPolicy) {
+	backoff := policy.Backoff
+	for letter.Attempts < policy.Attempts {
+		time.Sleep(backoff)
+		if backoff *= 2; policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+
+		start := time.Now()
+		err := handler(context.Background(), letter.Message)
+		c.observe(string(letter.Message.Type), start, err)
+		if err == nil {
+			c.logger.Info("Handler succeeded on retry",
+				zap.String("type", string(letter.Message.Type)),
+				zap.String("id", letter.Message.ID),
+				zap.Int("attempts", letter.Attempts+1))
+			return
+		}
+		letter.Attempts++
+		letter.Error = err.Error()
+		letter.ErrorCode = protocol.CodeOf(err)
+		letter.LastFailure = time.Now()
+	}
+	c.bury(letter)
+}
+
+// bury keeps a message that failed every attempt and tells the server
+func (c *Client) bury(letter DeadLetter) {
+	c.logger.Warn("Message moved to dead letters",
+		zap.String("type", string(letter.Message.Type)),
+		zap.String("id", letter.Message.ID),
+		zap.Int("attempts", letter.Attempts),
+		zap.String("error", letter.Error))
+	c.dead.put(c.logger, letter)
+
+	payload, err := json.Marshal(protocol.DispatchFailure{
+		MessageID:    letter.Message.ID,
+		MessageType:  letter.Message.Type,
+		Error:        letter.Error,
+		ErrorCode:    letter.ErrorCode,
+		Attempts:     letter.Attempts,
+		FirstFailure: letter.FirstFailure,
+		LastFailure:  letter.LastFailure,
+	})
+	if err != nil {
+		c.logger.Error("Failed to marshal dispatch failure", zap.Error(err))
+		return
+	}
+	if err := c.SendMessage(protocol.Message{
+		Type:      protocol.TypeDispatchFailed,
+		ID:        letter.Message.ID,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	}); err != nil {
+		c.logger.Warn("Failed to report dead letter", zap.String("id", letter.Message.ID), zap.Error(err))
+	}
+}
+
+// put stores a letter, dropping the oldest beyond maxDeadLetters
+func (d *deadLetters) put(logger *zap.Logger, letter DeadLetter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.letters[letter.Message.ID] = letter
+	d.save(logger, letter)
+	if len(d.letters) > maxDeadLetters {
+		for _, old := range d.sorted()[:len(d.letters)-maxDeadLetters] {
+			d.delete(logger, old.Message.ID)
+		}
+	}
+}
+
+func (d *deadLetters) remove(logger *zap.Logger, id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.delete(logger, id)
+}
+
+// sorted returns the letters by first failure. The caller holds mu.
+func (d *deadLetters) sorted() []DeadLetter {
+	letters := make([]DeadLetter, 0, len(d.letters))
+	for _, letter := range d.letters {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FirstFailure.Before(letters[j].FirstFailure)
+	})
+	return letters
+}
+
+// save persists a letter if a store is set. The caller holds mu.
+func (d *deadLetters) save(logger *zap.Logger, letter DeadLetter) {
+	if d.records == nil {
+		return
+	}
+	if err := d.records.Put(letter.Message.ID, letter); err != nil {
+		logger.Warn("Failed to persist dead letter", zap.String("id", letter.Message.ID), zap.Error(err))
+	}
+}
+
+// delete removes a letter. The caller holds mu.
+func (d *deadLetters) delete(logger *zap.Logger, id string) {
+	delete(d.letters, id)
+	if d.records == nil {
+		return
+	}
+	if err := d.records.Delete(id); err != nil {
+		logger.Warn("Failed to delete dead letter", zap.String("id", id), zap.Error(err))
+	}
+}
@@ -0,0 +1,362 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// Connection states reported in events
+const (
+	StateConnected    = "connected"
+	StateDisconnected = "disconnected"
+	StateFailover     = "failover"
+	StateFailback     = "failback"
+)
+
+const (
+	defaultReconnectDelay = 5 * time.Second
+	handshakeTimeout      = 10 * time.Second
+)
+
+// Endpoint is a server the client can connect to. Lower priorities are
+// preferred; among servers of equal priority, higher weights are tried
+// first proportionally more often.
+type Endpoint struct {
+	URL      string `json:"url"`
+	Priority int    `json:"priority"`
+	Weight   int    `json:"weight"`
+}
+
+// SetEndpoints replaces the servers the client connects to. A connected
+// client reconnects if its server is no longer listed.
+func (c *Client) SetEndpoints(ctx context.Context, endpoints []Endpoint) error {
+	if len(endpoints) == 0 {
+		return fmt.Errorf("at least one server is required")
+	}
+	c.mu.Lock()
+	c.endpoints = append([]Endpoint(nil), endpoints...)
+	current := c.url
+	connected := c.conn != nil
+	c.mu.Unlock()
+
+	if !connected {
+		return nil
+	}
+	for _, e := range endpoints {
+		if e.URL == current {
+			return nil
+		}
+	}
+	if err := c.Close(ctx); err != nil {
+		return fmt.Errorf("failed to close connection: %w", err)
+	}
+	if err := c.Connect(ctx); err != nil {
+		return err
+	}
+	c.logger.Info("Reconnected after server change", zap.String("url", c.URL()))
+	return nil
+}
+
+// SetFailover sets how long to wait between reconnect attempts and how
+// often to retry more preferred servers while connected to another. A
+// failback interval of 0 stays on the current server until it fails.
+func (c *Client) SetFailover(reconnectDelay, failback time.Duration) {
+	if reconnectDelay <= 0 {
+		reconnectDelay = defaultReconnectDelay
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnectDelay = reconnectDelay
+	c.failback = failback
+}
+
+// SetEvents sends connection state changes to events
+func (c *Client) SetEvents(events chan<- interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = events
+}
+
+// URL returns the server in use
+func (c *Client) URL() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.url
+}
+
+// connectAny connects to the first reachable server in order of
+// preference. lost is when the previous connection was lost, if any.
+func (c *Client) connectAny(ctx context.Context, lost time.Time) error {
+	c.mu.RLock()
+	endpoints := orderEndpoints(c.endpoints)
+	previous := c.url
+	c.mu.RUnlock()
+
+	var errs []error
+	for _, e := range endpoints {
+		conn, deflate, err := c.dial(ctx, e.URL)
+		if err == nil {
+			err = c.attach(conn, e.URL, deflate)
+		}
+		if err != nil {
+			c.logger.Warn("Server unreachable", zap.String("url", e.URL), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", e.URL, err))
+			continue
+		}
+
+		event := protocol.ConnectionEvent{State: StateConnected, URL: e.URL, Timestamp: time.Now()}
+		if e.Priority > endpoints[0].Priority {
+			event.State = StateFailover
+		}
+		if previous != e.URL {
+			event.Previous = previous
+		}
+		if err := errors.Join(errs...); err != nil {
+			event.Error = err.Error()
+		}
+		if !lost.IsZero() {
+			event.Downtime = time.Since(lost).Seconds()
+		}
+		c.logger.Info("Connected to server",
+			zap.String("url", e.URL),
+			zap.String("state", event.State))
+		c.emit(event)
+		return nil
+	}
+	return fmt.Errorf("failed to connect to websocket: %w", errors.Join(errs...))
+}
+
+// supervise reconnects when the connection is lost and fails back to
+// more preferred servers, until stop is closed
+func (c *Client) supervise(stop chan struct{}) {
+	for {
+		c.mu.RLock()
+		done := c.done
+		failback := c.failback
+		preferred := c.isPreferred()
+		c.mu.RUnlock()
+
+		var probe <-chan time.Time
+		var timer *time.Timer
+		if failback > 0 && !preferred {
+			timer = time.NewTimer(failback)
+			probe = timer.C
+		}
+
+		select {
+		case <-stop:
+		case <-done:
+			// Close stops supervision before closing the connection
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			c.reconnect(stop)
+		case <-probe:
+			c.tryFailback()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+	}
+}
+
+// reconnect retries the servers until one accepts or stop is closed
+func (c *Client) reconnect(stop chan struct{}) {
+	lost := time.Now()
+	c.mu.RLock()
+	url := c.url
+	delay := c.reconnectDelay
+	c.mu.RUnlock()
+
+	c.logger.Warn("Connection to server lost", zap.String("url", url))
+	c.emit(protocol.ConnectionEvent{State: StateDisconnected, URL: url, Timestamp: lost})
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout*time.Duration(len(c.endpointList())))
+		err := c.connectAny(ctx, lost)
+		cancel()
+		if err == nil {
+			return
+		}
+		c.logger.Warn("Failed to reconnect", zap.Error(err))
+	}
+}
+
+// tryFailback moves the connection to the most preferred reachable server
+// that is preferred over the current one
+func (c *Client) tryFailback() {
+	c.mu.RLock()
+	current := c.url
+	old := c.conn
+	priority, ok := c.priorityOf(current)
+	if !ok {
+		priority = math.MaxInt
+	}
+	endpoints := orderEndpoints(c.endpoints)
+	c.mu.RUnlock()
+
+	for _, e := range endpoints {
+		if e.Priority >= priority {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+		conn, deflate, err := c.dial(ctx, e.URL)
+		cancel()
+		if err != nil {
+			c.logger.Debug("Preferred server still unreachable", zap.String("url", e.URL), zap.Error(err))
+			continue
+		}
+		if err := c.attach(conn, e.URL, deflate); err != nil {
+			c.logger.Warn("Failed to fail back", zap.String("url", e.URL), zap.Error(err))
+			return
+		}
+		if old != nil {
+			c.mu.Lock()
+			if err := old.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "failback")); err != nil {
+				c.logger.Debug("Error sending close message", zap.Error(err))
+			}
+			old.Close()
+			c.mu.Unlock()
+		}
+		c.logger.Info("Failed back to preferred server",
+			zap.String("url", e.URL),
+			zap.String("previous", current))
+		c.emit(protocol.ConnectionEvent{State: StateFailback, URL: e.URL, Previous: current, Timestamp: time.Now()})
+		return
+	}
+}
+
+func (c *Client) endpointList() []Endpoint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.endpoints
+}
+
+// priorityOf returns the priority of a listed server. The caller holds mu.
+func (c *Client) priorityOf(url string) (int, bool) {
+	for _, e := range c.endpoints {
+		if e.URL == url {
+			return e.Priority, true
+		}
+	}
+	return 0, false
+}
+
+// isPreferred reports whether the server in use has the best priority.
+// The caller holds mu.
+func (c *Client) isPreferred() bool {
+	priority, ok := c.priorityOf(c.url)
+	if !ok {
+		return false
+	}
+	for _, e := range c.endpoints {
+		if e.Priority < priority {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) emit(event protocol.ConnectionEvent) {
+	c.mu.RLock()
+	events := c.events
+	c.mu.RUnlock()
+	if events == nil {
+		return
+	}
+	select {
+	case events <- event:
+	default:
+		c.logger.Warn("Failed to send connection event: channel full")
+	}
+}
+
+// dial connects to a server, reporting whether it accepted
+// permessage-deflate
+func (c *Client) dial(ctx context.Context, url string) (*websocket.Conn, bool, error) {
+	c.mu.RLock()
+	compression := c.compression
+	identity := c.identity
+	c.mu.RUnlock()
+
+	dialer := websocket.Dialer{
+		HandshakeTimeout:  handshakeTimeout,
+		EnableCompression: compression.Deflate,
+	}
+	var header http.Header
+	if identity != nil {
+		dialer.TLSClientConfig = identity.TLSConfig()
+		header = identity.Header()
+	}
+	conn, resp, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, false, err
+	}
+	deflate := compression.Deflate && resp != nil &&
+		strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	return conn, deflate, nil
+}
+
+// orderEndpoints sorts servers by priority and shuffles servers of equal
+// priority by weight
+func orderEndpoints(endpoints []Endpoint) []Endpoint {
+	ordered := append([]Endpoint(nil), endpoints...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Priority < ordered[j].Priority })
+	for start := 0; start < len(ordered); {
+		end := start
+		for end < len(ordered) && ordered[end].Priority == ordered[start].Priority {
+			end++
+		}
+		weightedShuffle(ordered[start:end])
+		start = end
+	}
+	return ordered
+}
+
+func weightedShuffle(group []Endpoint) {
+	weight := func(e Endpoint) int {
+		if e.Weight <= 0 {
+			return 1
+		}
+		return e.Weight
+	}
+	for i := range group {
+		total := 0
+		for _, e := range group[i:] {
+			total += weight(e)
+		}
+		pick := rand.Intn(total)
+		for j := i; j < len(group); j++ {
+			if pick -= weight(group[j]); pick < 0 {
+				group[i], group[j] = group[j], group[i]
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package websocket
+
+import "time"
+
+// HandlerObserver is told how long each message and request handler took
+// and whether it failed
+type HandlerObserver interface {
+	ObserveHandler(handler string, d time.Duration, err error)
+}
+
+// SetObserver reports handler calls to o. Message handlers are named by
+// message type, request handlers as "request:<method>".
+func (c *Client) SetObserver(o HandlerObserver) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observer = o
+}
+
+// SendQueueDepth returns how many messages are waiting to be written
+func (c *Client) SendQueueDepth() int {
+	return int(c.sending.Load())
+}
+
+func (c *Client) observe(handler string, start time.Time, err error) {
+	c.mu.RLock()
+	o := c.observer
+	c.mu.RUnlock()
+	if o != nil {
+		o.ObserveHandler(handler, time.Since(start), err)
+	}
+}
@@ -0,0 +1,214 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// globalLimit names the limit on all messages in throttle errors
+const globalLimit = "global"
+
+// RateLimit allows Rate messages per second, in bursts of up to Burst.
+// A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimits limit the messages the server sends the agent, so that a
+// runaway server can't make the agent overload its host with commands
+type RateLimits struct {
+	Global RateLimit
+	// Types limit message types, and request methods as
+	// "request:<method>", on top of the global limit
+	Types map[string]RateLimit
+}
+
+// DefaultRateLimits allow 50 messages per second with bursts of 200, of
+// which 10 commands per second with bursts of 50
+var DefaultRateLimits = RateLimits{
+	Global: RateLimit{Rate: 50, Burst: 200},
+	Types: map[string]RateLimit{
+		string(protocol.TypeCommand): {Rate: 10, Burst: 50},
+	},
+}
+
+// tokenBucket holds the tokens left of a limit
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	// rejecting is set while messages are refused, to log only the first
+	rejecting bool
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.burst()), last: now}
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst < 1 {
+		return 1
+	}
+	return l.Burst
+}
+
+// refill adds the tokens earned since the last call and returns how long
+// until a token is available
+func (b *tokenBucket) refill(now time.Time) time.Duration {
+	if b == nil || b.limit.Rate <= 0 {
+		return 0
+	}
+	b.tokens = math.Min(float64(b.limit.burst()), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take() {
+	if b != nil && b.limit.Rate > 0 {
+		b.tokens--
+		b.rejecting = false
+	}
+}
+
+// rateLimiter applies RateLimits to inbound messages
+type rateLimiter struct {
+	mu     sync.Mutex
+	limits RateLimits
+	global *tokenBucket
+	types  map[string]*tokenBucket
+	// throttled counts the messages refused
+	throttled atomic.Uint64
+}
+
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	l := &rateLimiter{}
+	l.set(limits)
+	return l
+}
+
+// set replaces the limits, refilling the buckets
+func (l *rateLimiter) set(limits RateLimits) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	l.global = newTokenBucket(limits.Global, now)
+	l.types = make(map[string]*tokenBucket, len(limits.Types))
+	for key, limit := range limits.Types {
+		l.types[key] = newTokenBucket(limit, now)
+	}
+}
+
+// allow takes a token for a message of kind if both its own and the
+// global limit have one. Otherwise it returns the limit exceeded, how
+// long until it allows the message and whether the limit just started
+// refusing messages.
+func (l *rateLimiter) allow(kind string) (limit string, retry time.Duration, first bool) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	typed := l.types[kind]
+	if wait := typed.refill(now); wait > 0 {
+		first = !typed.rejecting
+		typed.rejecting = true
+		l.throttled.Add(1)
+		return kind, wait, first
+	}
+	if wait := l.global.refill(now); wait > 0 {
+		first = !l.global.rejecting
+		l.global.rejecting = true
+		l.throttled.Add(1)
+		return globalLimit, wait, first
+	}
+	typed.take()
+	l.global.take()
+	return "", 0, false
+}
+
+// SetRateLimits replaces the limits on messages from the server
+func (c *Client) SetRateLimits(limits RateLimits) {
+	c.limiter.set(limits)
+}
+
+// Throttled returns how many messages from the server were refused for
+// exceeding the rate limits
+func (c *Client) Throttled() uint64 {
+	return c.limiter.throttled.Load()
+}
+
+// admit checks msg against the rate limits. A refused message is answered
+// with a throttle error instead of being handled: requests with an
+// ErrCodeThrottled reply, other messages with a failed response.
+func (c *Client) admit(msg protocol.Message) bool {
+	kind := string(msg.Type)
+	var method string
+	if msg.Type == protocol.TypeRequest {
+		var req protocol.Request
+		if err := json.Unmarshal(msg.Payload, &req); err == nil {
+			method = req.Method
+			kind = "request:" + method
+		}
+	}
+	limit, retry, first := c.limiter.allow(kind)
+	if limit == "" {
+		return true
+	}
+
+	if first {
+		c.logger.Warn("Throttling messages from server",
+			zap.String("type", kind),
+			zap.String("limit", limit),
+			zap.Duration("retry_after", retry))
+	}
+	throttled := protocol.Throttled{
+		Type:       msg.Type,
+		Method:     method,
+		Limit:      limit,
+		RetryAfter: retry.Seconds(),
+	}
+	data, err := json.Marshal(throttled)
+	if err != nil {
+		c.logger.Error("Failed to marshal throttle error", zap.Error(err))
+		return false
+	}
+	message := fmt.Sprintf("rate limit %s exceeded, retry after %s", limit, retry.Round(time.Millisecond))
+
+	reply := protocol.Message{ID: msg.ID, Timestamp: time.Now()}
+	if msg.Type == protocol.TypeRequest {
+		reply.Type = protocol.TypeReply
+		reply.Payload, err = json.Marshal(protocol.Reply{Error: &protocol.RPCError{
+			Code:    protocol.ErrCodeThrottled,
+			Message: message,
+			Data:    data,
+		}})
+	} else {
+		reply.Type = protocol.TypeResponse
+		reply.Payload, err = json.Marshal(protocol.AgentResponse{
+			Success:   false,
+			Data:      data,
+			Error:     message,
+			ErrorCode: protocol.ErrorThrottled,
+		})
+	}
+	if err != nil {
+		c.logger.Error("Failed to marshal throttle error", zap.Error(err))
+		return false
+	}
+	if err := c.SendMessage(reply); err != nil {
+		c.logger.Debug("Failed to send throttle error", zap.String("id", msg.ID), zap.Error(err))
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2026, 3, 2, 13, 37, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		limit RateLimit
+		// taken tokens at start, then a check after elapsed
+		taken   int
+		elapsed time.Duration
+		wait    time.Duration
+	}{
+		{"full bucket", RateLimit{Rate: 10, Burst: 5}, 0, 0, 0},
+		{"last token of the burst", RateLimit{Rate: 10, Burst: 5}, 4, 0, 0},
+		{"burst spent", RateLimit{Rate: 10, Burst: 5}, 5, 0, 100 * time.Millisecond},
+		{"partly refilled", RateLimit{Rate: 10, Burst: 5}, 5, 40 * time.Millisecond, 60 * time.Millisecond},
+		{"refilled", RateLimit{Rate: 10, Burst: 5}, 5, 100 * time.Millisecond, 0},
+		{"zero burst allows one", RateLimit{Rate: 2}, 1, 0, 500 * time.Millisecond},
+		{"disabled", RateLimit{}, 100, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(tt.limit, start)
+			for i := 0; i < tt.taken; i++ {
+				b.take()
+			}
+			got := b.refill(start.Add(tt.elapsed))
+			if diff := got - tt.wait; diff < -time.Microsecond || diff > time.Microsecond {
+				t.Errorf("wait = %s, want %s", got, tt.wait)
+			}
+		})
+	}
+}
+
+func TestTokenBucketCapsAtBurst(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 3}, start)
+	// An idle hour earns no more than the burst
+	b.refill(start.Add(time.Hour))
+	for i := 0; i < 3; i++ {
+		if wait := b.refill(start.Add(time.Hour)); wait != 0 {
+			t.Fatalf("token %d: wait %s", i+1, wait)
+		}
+		b.take()
+	}
+	if wait := b.refill(start.Add(time.Hour)); wait == 0 {
+		t.Error("allowed more than the burst")
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	limits := RateLimits{
+		Global: RateLimit{Rate: 0.001, Burst: 4},
+		Types: map[string]RateLimit{
+			"command":          {Rate: 0.001, Burst: 2},
+			"request:exec.run": {Rate: 0.001, Burst: 1},
+		},
+	}
+
+	tests := []struct {
+		name string
+		// kinds are allowed in order
+		kinds []string
+		// limits exceeded, "" where allowed
+		want []string
+		// first refusal of each limit
+		first []bool
+	}{
+		{
+			name:  "type limit",
+			kinds: []string{"command", "command", "command", "command"},
+			want:  []string{"", "", "command", "command"},
+			first: []bool{false, false, true, false},
+		},
+		{
+			name:  "method limit",
+			kinds: []string{"request:exec.run", "request:exec.run", "request:ping"},
+			want:  []string{"", "request:exec.run", ""},
+			first: []bool{false, true, false},
+		},
+		{
+			name:  "global limit",
+			kinds: []string{"event", "event", "event", "event", "event", "command"},
+			want:  []string{"", "", "", "", globalLimit, globalLimit},
+			first: []bool{false, false, false, false, true, false},
+		},
+		{
+			name:  "refused messages take no global token",
+			kinds: []string{"command", "command", "command", "command", "event", "event"},
+			want:  []string{"", "", "command", "command", "", ""},
+			first: []bool{false, false, true, false, false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(limits)
+			for i, kind := range tt.kinds {
+				limit, retry, first := l.allow(kind)
+				if limit != tt.want[i] || first != tt.first[i] {
+					t.Errorf("message %d (%s): limit %q first %v, want %q %v", i+1, kind, limit, first, tt.want[i], tt.first[i])
+				}
+				if (limit == "") != (retry == 0) {
+					t.Errorf("message %d (%s): retry after %s", i+1, kind, retry)
+				}
+			}
+			refused := 0
+			for _, limit := range tt.want {
+				if limit != "" {
+					refused++
+				}
+			}
+			if got := l.throttled.Load(); got != uint64(refused) {
+				t.Errorf("throttled %d, want %d", got, refused)
+			}
+		})
+	}
+}
+
+func TestRateLimiterSetRefills(t *testing.T) {
+	l := newRateLimiter(RateLimits{Global: RateLimit{Rate: 0.001, Burst: 1}})
+	l.allow("event")
+	if limit, _, _ := l.allow("event"); limit != globalLimit {
+		t.Fatalf("limit %q, want %q", limit, globalLimit)
+	}
+	l.set(RateLimits{Global: RateLimit{Rate: 0.001, Burst: 1}})
+	if limit, _, _ := l.allow("event"); limit != "" {
+		t.Errorf("limit %q after set, want the bucket refilled", limit)
+	}
+}
@@ -0,0 +1,196 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"shh/agent/internal/protocol"
+)
+
+// defaultRequestTimeout bounds requests whose context has no deadline
+const defaultRequestTimeout = 30 * time.Second
+
+// errConnectionLost fails requests whose connection closed before the reply
+var errConnectionLost = errors.New("connection lost before reply")
+
+// RequestHandler answers a request from the server. The result is sent
+// back as JSON; a *protocol.RPCError is passed through as is and any
+// other error is sent as an internal error.
+type RequestHandler func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// Typed adapts fn into a RequestHandler that decodes the params into P
+func Typed[P, R any](fn func(ctx context.Context, params P) (R, error)) RequestHandler {
+	return func(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+		var params P
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, &protocol.RPCError{Code: protocol.ErrCodeInvalidParams, Message: err.Error()}
+			}
+		}
+		return fn(ctx, params)
+	}
+}
+
+// pendingRequest waits for the reply to a request sent over conn
+type pendingRequest struct {
+	conn  *websocket.Conn
+	reply chan protocol.Reply
+}
+
+// HandleRequest registers the handler for a server request method
+func (c *Client) HandleRequest(method string, handler RequestHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.methods[method] = handler
+}
+
+// SendRequest calls method on the server and decodes the result into
+// result, which may be nil. Requests time out with ctx, or after 30
+// seconds if ctx has no deadline, and fail if the connection is lost
+// before the reply.
+func (c *Client) SendRequest(ctx context.Context, method string, params, result interface{}) error {
+	req := protocol.Request{Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal params: %w", err)
+		}
+		req.Params = data
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		defer cancel()
+	}
+
+	id := fmt.Sprintf("request-%d", c.nextRequest.Add(1))
+	ch := make(chan protocol.Reply, 1)
+	c.mu.Lock()
+	if c.conn == nil {
+		c.mu.Unlock()
+		return fmt.Errorf("not connected")
+	}
+	c.pending[id] = pendingRequest{conn: c.conn, reply: ch}
+	c.mu.Unlock()
+	defer c.forget(id)
+
+	if err := c.SendMessage(protocol.Message{
+		Type:      protocol.TypeRequest,
+		ID:        id,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	}); err != nil {
+		return err
+	}
+
+	select {
+	case reply, ok := <-ch:
+		if !ok {
+			return fmt.Errorf("%s: %w", method, errConnectionLost)
+		}
+		if reply.Error != nil {
+			return reply.Error
+		}
+		if result != nil && len(reply.Result) > 0 {
+			if err := json.Unmarshal(reply.Result, result); err != nil {
+				return fmt.Errorf("failed to decode %s result: %w", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+// handleReply hands a reply to the request waiting for it
+func (c *Client) handleReply(msg protocol.Message) {
+	var reply protocol.Reply
+	if err := json.Unmarshal(msg.Payload, &reply); err != nil {
+		c.logger.Error("Invalid reply", zap.String("id", msg.ID), zap.Error(err))
+		return
+	}
+	c.mu.Lock()
+	pending, ok := c.pending[msg.ID]
+	delete(c.pending, msg.ID)
+	c.mu.Unlock()
+	if !ok {
+		c.logger.Debug("Ignoring reply to unknown request", zap.String("id", msg.ID))
+		return
+	}
+	pending.reply <- reply
+}
+
+// handleRequest runs the handler for a server request and sends its reply
+func (c *Client) handleRequest(ctx context.Context, msg protocol.Message) {
+	var reply protocol.Reply
+	result, err := c.callHandler(ctx, msg)
+	if err == nil && result != nil {
+		reply.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		var rpcErr *protocol.RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &protocol.RPCError{Code: protocol.ErrCodeInternal, Message: err.Error()}
+		}
+		reply.Error = rpcErr
+		reply.Result = nil
+	}
+
+	payload, err := json.Marshal(reply)
+	if err != nil {
+		c.logger.Error("Failed to marshal reply", zap.Error(err))
+		return
+	}
+	if err := c.SendMessage(protocol.Message{
+		Type:      protocol.TypeReply,
+		ID:        msg.ID,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	}); err != nil {
+		c.logger.Error("Failed to send reply", zap.String("id", msg.ID), zap.Error(err))
+	}
+}
+
+func (c *Client) callHandler(ctx context.Context, msg protocol.Message) (interface{}, error) {
+	var req protocol.Request
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return nil, &protocol.RPCError{Code: protocol.ErrCodeInvalidParams, Message: err.Error()}
+	}
+	c.mu.RLock()
+	handler, ok := c.methods[req.Method]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, &protocol.RPCError{Code: protocol.ErrCodeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+	start := time.Now()
+	result, err := handler(ctx, req.Params)
+	c.observe("request:"+req.Method, start, err)
+	return result, err
+}
+
+// failPending fails the requests sent over conn, whose replies can no
+// longer arrive. The caller holds mu.
+func (c *Client) failPending(conn *websocket.Conn) {
+	for id, pending := range c.pending {
+		if pending.conn == conn {
+			close(pending.reply)
+			delete(c.pending, id)
+		}
+	}
+}
+
+func (c *Client) forget(id string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}